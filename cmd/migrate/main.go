@@ -0,0 +1,172 @@
+// Команда migrate управляет миграциями базы данных, выбранной в DATABASE_DRIVER.
+// Сервер по умолчанию сам применяет миграции при старте; с флагом -skip-migrations
+// это делается отдельно этой командой.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"novel-server/internal/database"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/joho/godotenv"
+)
+
+const usage = `Usage: migrate [flags] <command>
+
+Commands:
+  up             apply all pending migrations
+  down N         roll back the last N applied migrations
+  status         list migrations and whether they are applied
+  redo           roll back and re-apply the last applied migration
+  create <name>  create an empty migration file with the next version
+
+Flags:
+`
+
+func main() {
+	// Переменные окружения могут быть заданы и без .env
+	_ = godotenv.Load()
+	cfg := database.NewConfig()
+
+	dir := flag.String("dir", database.MigrationsDir(cfg.Driver), "migrations directory")
+	allowModified := flag.Bool("allow-modified", false, "run up, down and redo even if files of applied migrations changed")
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if err := run(context.Background(), cfg, *dir, *allowModified, flag.Args()); err != nil {
+		fmt.Fprintln(os.Stderr, "migrate:", err)
+		os.Exit(1)
+	}
+}
+
+// run выполняет команду args
+func run(ctx context.Context, cfg *database.Config, dir string, allowModified bool, args []string) error {
+	if len(args) == 0 {
+		flag.Usage()
+		return fmt.Errorf("no command given")
+	}
+	command, args := args[0], args[1:]
+
+	// create работает только с файлами, база данных не нужна
+	if command == "create" {
+		if len(args) != 1 {
+			return fmt.Errorf("usage: migrate create <name>")
+		}
+		path, err := database.CreateMigration(dir, args[0])
+		if err != nil {
+			return err
+		}
+		fmt.Println("Created", path)
+		return nil
+	}
+
+	migrator, closeDB, err := openMigrator(ctx, cfg, dir)
+	if err != nil {
+		return err
+	}
+	defer closeDB()
+	migrator.AllowModified = allowModified
+
+	switch command {
+	case "up":
+		if len(args) != 0 {
+			return fmt.Errorf("usage: migrate up")
+		}
+		count, err := migrator.Up(ctx)
+		if count > 0 || err == nil {
+			fmt.Printf("Applied %d migration(s)\n", count)
+		}
+		return err
+	case "down":
+		if len(args) != 1 {
+			return fmt.Errorf("usage: migrate down N")
+		}
+		n, err := strconv.Atoi(args[0])
+		if err != nil || n <= 0 {
+			return fmt.Errorf("invalid number of migrations %q", args[0])
+		}
+		count, err := migrator.Down(ctx, n)
+		if count > 0 || err == nil {
+			fmt.Printf("Rolled back %d migration(s)\n", count)
+		}
+		return err
+	case "redo":
+		if len(args) != 0 {
+			return fmt.Errorf("usage: migrate redo")
+		}
+		version, err := migrator.Redo(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Redid migration %d\n", version)
+		return nil
+	case "status":
+		if len(args) != 0 {
+			return fmt.Errorf("usage: migrate status")
+		}
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+		printStatus(statuses)
+		return nil
+	default:
+		flag.Usage()
+		return fmt.Errorf("unknown command %q", command)
+	}
+}
+
+// openMigrator подключается к базе данных без автоматических миграций
+func openMigrator(ctx context.Context, cfg *database.Config, dir string) (*database.Migrator, func(), error) {
+	switch cfg.Driver {
+	case database.DriverPostgres:
+		db, err := database.ConnectDB(ctx, cfg)
+		if err != nil {
+			return nil, nil, err
+		}
+		return database.NewPostgresMigrator(db, dir), func() { database.CloseDB(db) }, nil
+	case database.DriverSQLite:
+		db, err := database.OpenSQLite(ctx, cfg.SQLitePath)
+		if err != nil {
+			return nil, nil, err
+		}
+		return database.NewSQLiteMigrator(db, dir), func() { database.CloseSQLite(db) }, nil
+	case database.DriverMemory:
+		return nil, nil, fmt.Errorf("driver %q keeps data in process memory and has no migrations", cfg.Driver)
+	default:
+		return nil, nil, fmt.Errorf("unknown database driver %q (expected %q or %q)", cfg.Driver, database.DriverPostgres, database.DriverSQLite)
+	}
+}
+
+// printStatus печатает таблицу миграций
+func printStatus(statuses []database.MigrationStatus) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED AT\tNOTE")
+	pending := 0
+	for _, s := range statuses {
+		appliedAt := "pending"
+		if s.AppliedAt != nil {
+			appliedAt = s.AppliedAt.Local().Format(time.DateTime)
+		} else {
+			pending++
+		}
+		note := ""
+		switch {
+		case s.Missing:
+			note = "file missing"
+		case s.Modified:
+			note = "file changed after apply"
+		}
+		fmt.Fprintf(w, "%03d\t%s\t%s\t%s\n", s.Version, s.Name, appliedAt, note)
+	}
+	w.Flush()
+	fmt.Printf("%d pending migration(s)\n", pending)
+}
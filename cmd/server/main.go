@@ -2,20 +2,28 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
 	"net/http"
 	"novel-server/internal/api"
 	"novel-server/internal/auth"
 	"novel-server/internal/config"
 	"novel-server/internal/database"
-	"novel-server/internal/deepseek"
+	"novel-server/internal/llm"
 	"novel-server/internal/logger"
-	"novel-server/internal/repository"
+	"novel-server/internal/prompts"
 	"novel-server/internal/service"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 )
 
 func main() {
+	// Миграции можно отключить, чтобы применять их отдельно командой cmd/migrate
+	skipMigrations := flag.Bool("skip-migrations", false, "do not apply database migrations on startup")
+	flag.Parse()
+
 	// Загружаем конфигурацию
 	cfg, err := config.LoadConfig()
 	if err != nil {
@@ -24,13 +32,15 @@ func main() {
 	}
 
 	// --- Инициализация базы данных ---
-	logger.Logger.Info("Initializing database and running migrations...")
-	dbPool, err := database.InitDB(context.Background())
+	dbConfig := database.NewConfig()
+	dbConfig.SkipMigrations = *skipMigrations
+	logger.Logger.Info("Initializing database and running migrations...", "driver", dbConfig.Driver)
+	store, err := openStorage(context.Background(), dbConfig)
 	if err != nil {
 		logger.Logger.Error("Failed to initialize database and run migrations", "err", err)
 		os.Exit(1)
 	}
-	defer database.CloseDB(dbPool)
+	defer store.close()
 	logger.Logger.Info("Database initialization and migrations completed successfully")
 	// ----------------------------------
 
@@ -41,25 +51,57 @@ func main() {
 	}
 	// -------------------------
 
-	// Инициализируем репозиторий новелл
-	novelRepo := repository.NewPostgresNovelRepository(dbPool)
-	logger.Logger.Info("Novel repository initialized")
+	// Репозитории новелл и черновиков
+	novelRepo := store.novels
+	draftRepo := store.drafts
 
-	// Инициализируем репозиторий черновиков новелл
-	draftRepo := repository.NewPostgresNovelDraftRepository(dbPool)
-	logger.Logger.Info("Novel draft repository initialized")
+	// Инициализируем провайдера языковой модели
+	llmProvider, err := llm.NewProvider(cfg.LLM)
+	if err != nil {
+		logger.Logger.Error("Failed to create LLM provider", "err", err)
+		os.Exit(1)
+	}
+	// Каждый вызов модели записывается в llm_usage для учета расхода токенов
+	usageRepo := store.usage
+	llmProvider = llm.NewUsageRecordingProvider(llmProvider, usageRepo, cfg.LLM.Prices)
+	logger.Logger.Info("LLM provider initialized", "provider", llmProvider.Name(), "model", llmProvider.Model())
 
-	// Инициализируем клиент DeepSeek
-	dsClient := deepseek.NewClient(cfg.DeepSeek.APIKey, cfg.DeepSeek.ModelName)
+	// Загружаем шаблоны промптов
+	promptVersions := make(map[prompts.Name]string, len(cfg.Prompts.Versions))
+	for name, version := range cfg.Prompts.Versions {
+		promptVersions[prompts.Name(name)] = version
+	}
+	promptRegistry, err := prompts.NewRegistry(cfg.Prompts.Dir, promptVersions)
+	if err != nil {
+		logger.Logger.Error("Failed to load prompts", "err", err, "dir", cfg.Prompts.Dir)
+		os.Exit(1)
+	}
 
 	// Инициализируем сервис для работы с новеллами
-	novelContentService, err := service.NewNovelContentService(dsClient, novelRepo)
+	novelContentService, err := service.NewNovelContentService(llmProvider, novelRepo, promptRegistry, cfg.LLM.RepairAttempts)
 	if err != nil {
 		logger.Logger.Error("Error creating novel content service", "err", err)
 		os.Exit(1)
 	}
 
-	novelService, err := service.NewNovelService(dsClient, novelRepo, draftRepo, novelContentService)
+	// Инициализируем очередь генерации сетапа и ее воркеры
+	setupJobRepo := store.setupJobs
+	setupWorkers := service.NewSetupWorkerPool(setupJobRepo, novelContentService, cfg.Setup)
+
+	// Контекст отменяется по SIGINT/SIGTERM, чтобы корректно остановить воркеры и сервер
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	setupWorkers.Start(ctx)
+
+	// Изменения файлов промптов подхватываются без перезапуска
+	if cfg.Prompts.ReloadInterval > 0 {
+		go promptRegistry.Watch(ctx, cfg.Prompts.ReloadInterval)
+	}
+
+	// Сохранения прохождения
+	saveSlotRepo := store.saveSlots
+
+	novelService, err := service.NewNovelService(llmProvider, novelRepo, draftRepo, novelContentService, setupJobRepo, setupWorkers, saveSlotRepo, promptRegistry, cfg.LLM.RepairAttempts)
 	if err != nil {
 		logger.Logger.Error("Error creating novel service", "err", err)
 		os.Exit(1)
@@ -69,7 +111,15 @@ func main() {
 	mux := http.NewServeMux()
 
 	// Инициализируем обработчик API
-	api.RegisterHandlers(mux, novelService, novelContentService, cfg.API.BasePath)
+	usageService := service.NewUsageService(usageRepo)
+	// Квоты генерации: счетчики запросов в user_quota_counters, токены из llm_usage
+	quotaRepo := store.quotas
+	quotaService := service.NewQuotaService(quotaRepo, usageRepo, cfg.Quota)
+	// Учетные записи и refresh-токены
+	userRepo := store.users
+	authService := service.NewAuthService(userRepo)
+	adminService := service.NewAdminService(userRepo, novelRepo, setupJobRepo)
+	api.RegisterHandlers(mux, novelService, novelContentService, usageService, quotaService, authService, adminService, cfg.API.BasePath)
 
 	// Базовый корневой маршрут
 	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
@@ -82,8 +132,26 @@ func main() {
 	logger.Logger.Info("API endpoints", "generate", fmt.Sprintf("%s/generate-novel", cfg.API.BasePath), "content", fmt.Sprintf("%s/generate-novel-content", cfg.API.BasePath))
 
 	// Запуск HTTP сервера
-	if err := http.ListenAndServe(addr, mux); err != nil {
+	server := &http.Server{Addr: addr, Handler: mux}
+	serverErr := make(chan error, 1)
+	go func() {
+		serverErr <- server.ListenAndServe()
+	}()
+
+	select {
+	case err := <-serverErr:
 		logger.Logger.Error("Could not start server", "err", err)
 		os.Exit(1)
+	case <-ctx.Done():
+	}
+
+	logger.Logger.Info("Shutting down server...")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		logger.Logger.Error("Server shutdown failed", "err", err)
 	}
+	// Воркеры возвращают прерванные задачи в очередь перед выходом
+	setupWorkers.Wait()
+	logger.Logger.Info("Server stopped")
 }
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"novel-server/internal/database"
+	"novel-server/internal/domain"
+	"novel-server/internal/logger"
+	"novel-server/internal/repository"
+)
+
+// storage - репозитории выбранной базы данных
+type storage struct {
+	novels    repository.NovelRepository
+	drafts    domain.NovelDraftRepository
+	usage     repository.UsageRepository
+	setupJobs repository.SetupJobRepository
+	saveSlots repository.SaveSlotRepository
+	quotas    repository.QuotaRepository
+	users     repository.UserRepository
+	close     func()
+}
+
+// openStorage подключается к базе данных, выбранной в DATABASE_DRIVER, выполняет миграции (если не задан
+// cfg.SkipMigrations) и создает репозитории. PostgreSQL - основной вариант, SQLite - для развертывания на одном узле,
+// память - для разработки и тестов без внешних зависимостей
+func openStorage(ctx context.Context, cfg *database.Config) (*storage, error) {
+	switch cfg.Driver {
+	case database.DriverPostgres:
+		dbPool, err := database.InitDB(ctx, cfg)
+		if err != nil {
+			return nil, err
+		}
+		novels := repository.NewPostgresNovelRepository(dbPool)
+		return &storage{
+			novels:    novels,
+			drafts:    repository.NewPostgresNovelDraftRepository(dbPool),
+			usage:     repository.NewPostgresUsageRepository(dbPool),
+			setupJobs: repository.NewPostgresSetupJobRepository(dbPool),
+			saveSlots: repository.NewPostgresSaveSlotRepository(dbPool),
+			quotas:    repository.NewPostgresQuotaRepository(dbPool),
+			users:     repository.NewPostgresUserRepository(dbPool),
+			close: func() {
+				novels.Close()
+				database.CloseDB(dbPool)
+			},
+		}, nil
+	case database.DriverSQLite:
+		db, err := database.InitSQLite(ctx, cfg)
+		if err != nil {
+			return nil, err
+		}
+		return &storage{
+			novels:    repository.NewSQLiteNovelRepository(db),
+			drafts:    repository.NewSQLiteNovelDraftRepository(db),
+			usage:     repository.NewSQLiteUsageRepository(db),
+			setupJobs: repository.NewSQLiteSetupJobRepository(db),
+			saveSlots: repository.NewSQLiteSaveSlotRepository(db),
+			quotas:    repository.NewSQLiteQuotaRepository(db),
+			users:     repository.NewSQLiteUserRepository(db),
+			close:     func() { database.CloseSQLite(db) },
+		}, nil
+	case database.DriverMemory:
+		logger.Logger.Warn("Using in-memory storage: all data will be lost on restart")
+		novels := repository.NewMemoryNovelRepository()
+		return &storage{
+			novels:    novels,
+			drafts:    repository.NewMemoryNovelDraftRepository(),
+			usage:     repository.NewMemoryUsageRepository(),
+			setupJobs: repository.NewMemorySetupJobRepository(novels),
+			saveSlots: repository.NewMemorySaveSlotRepository(),
+			quotas:    repository.NewMemoryQuotaRepository(),
+			users:     repository.NewMemoryUserRepository(),
+			close:     func() {},
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown database driver %q (expected %q, %q or %q)", cfg.Driver,
+			database.DriverPostgres, database.DriverSQLite, database.DriverMemory)
+	}
+}
@@ -7,20 +7,15 @@ import (
 )
 
 // NewNovelHandler создает новый экземпляр обработчика
-func NewNovelHandler(novelService *service.NovelService, novelContentService *service.NovelContentService) *novel_handlers.NovelHandler {
-	return novel_handlers.NewNovelHandler(novelService, novelContentService)
+func NewNovelHandler(novelService *service.NovelService, novelContentService *service.NovelContentService, usageService *service.UsageService, quotaService *service.QuotaService, authService *service.AuthService, adminService *service.AdminService) *novel_handlers.NovelHandler {
+	return novel_handlers.NewNovelHandler(novelService, novelContentService, usageService, quotaService, authService, adminService)
 }
 
 // RegisterHandlers регистрирует все обработчики API на указанном мультиплексоре
-func RegisterHandlers(mux *http.ServeMux, novelService *service.NovelService, novelContentService *service.NovelContentService, basePath string) {
+func RegisterHandlers(mux *http.ServeMux, novelService *service.NovelService, novelContentService *service.NovelContentService, usageService *service.UsageService, quotaService *service.QuotaService, authService *service.AuthService, adminService *service.AdminService, basePath string) {
 	// Создаем обработчик для новелл
-	novelHandler := novel_handlers.NewNovelHandler(novelService, novelContentService)
+	novelHandler := novel_handlers.NewNovelHandler(novelService, novelContentService, usageService, quotaService, authService, adminService)
 
 	// Регистрируем маршруты для обработчика новелл
 	novelHandler.RegisterRoutes(mux, basePath)
 }
-
-// AuthMiddleware проверяет JWT токен и добавляет UserID в контекст
-func AuthMiddleware(next http.HandlerFunc) http.HandlerFunc {
-	return novel_handlers.AuthMiddleware(next)
-}
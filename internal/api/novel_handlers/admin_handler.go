@@ -0,0 +1,191 @@
+package novel_handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"novel-server/internal/auth"
+	"novel-server/internal/logger"
+	"novel-server/internal/service"
+	"strconv"
+
+	"github.com/google/uuid"
+)
+
+// userIDFromPath разбирает ID пользователя из пути запроса. При ошибке отвечает 400.
+func userIDFromPath(w http.ResponseWriter, r *http.Request) (uuid.UUID, bool) {
+	userID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid user id format")
+		return uuid.Nil, false
+	}
+	return userID, true
+}
+
+// queryInt разбирает неотрицательный числовой параметр запроса (0, если его нет)
+func queryInt(r *http.Request, name string) (int, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		return 0, errors.New("invalid " + name)
+	}
+	return n, nil
+}
+
+// respondAdminError переводит ошибки AdminService в HTTP-статусы
+func respondAdminError(w http.ResponseWriter, err error, action string) {
+	switch {
+	case errors.Is(err, service.ErrUserNotFound):
+		respondWithError(w, http.StatusNotFound, "User not found")
+	case errors.Is(err, service.ErrNovelNotFound):
+		respondWithError(w, http.StatusNotFound, "Novel not found")
+	case errors.Is(err, service.ErrInvalidRole):
+		respondWithError(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, service.ErrCannotChangeSelf), errors.Is(err, service.ErrUserDisabled):
+		respondWithError(w, http.StatusConflict, err.Error())
+	default:
+		logger.Logger.Error("Admin: request failed", "action", action, "err", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to "+action)
+	}
+}
+
+// ListUsers возвращает учетные записи.
+// GET /admin/users?limit=&offset=
+func (h *NovelHandler) ListUsers(w http.ResponseWriter, r *http.Request) {
+	limit, err := queryInt(r, "limit")
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid limit")
+		return
+	}
+	offset, err := queryInt(r, "offset")
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid offset")
+		return
+	}
+
+	users, err := h.adminService.ListUsers(r.Context(), limit, offset)
+	if err != nil {
+		respondAdminError(w, err, "list users")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{"users": users})
+}
+
+// SetUserRole меняет роль пользователя.
+// PUT /admin/users/{id}/role, тело: {"role": "player|author|moderator|admin"}
+func (h *NovelHandler) SetUserRole(w http.ResponseWriter, r *http.Request) {
+	actorID, _ := r.Context().Value(auth.UserIDKey).(string)
+	userID, ok := userIDFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Role string `json:"role"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request format. Expected {'role': 'string'}")
+		return
+	}
+	defer r.Body.Close()
+
+	if err := h.adminService.SetUserRole(r.Context(), actorID, userID, req.Role); err != nil {
+		respondAdminError(w, err, "set user role")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]string{"user_id": userID.String(), "role": req.Role})
+}
+
+// DisableUser блокирует пользователя.
+// POST /admin/users/{id}/disable
+func (h *NovelHandler) DisableUser(w http.ResponseWriter, r *http.Request) {
+	h.setUserDisabled(w, r, true)
+}
+
+// EnableUser снимает блокировку с пользователя.
+// POST /admin/users/{id}/enable
+func (h *NovelHandler) EnableUser(w http.ResponseWriter, r *http.Request) {
+	h.setUserDisabled(w, r, false)
+}
+
+// setUserDisabled - общая часть DisableUser и EnableUser
+func (h *NovelHandler) setUserDisabled(w http.ResponseWriter, r *http.Request, disabled bool) {
+	actorID, _ := r.Context().Value(auth.UserIDKey).(string)
+	userID, ok := userIDFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.adminService.SetUserDisabled(r.Context(), actorID, userID, disabled); err != nil {
+		respondAdminError(w, err, "update user")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ForceDeleteNovel удаляет любую новеллу вместе с прогрессом и сохранениями игроков.
+// DELETE /admin/novels/{id}
+func (h *NovelHandler) ForceDeleteNovel(w http.ResponseWriter, r *http.Request) {
+	actorID, _ := r.Context().Value(auth.UserIDKey).(string)
+	novelID, ok := novelIDFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.adminService.DeleteNovel(r.Context(), actorID, novelID); err != nil {
+		respondAdminError(w, err, "delete novel")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// SetNovelOwner передает новеллу другому пользователю.
+// PUT /admin/novels/{id}/owner, тело: {"user_id": "uuid"}
+func (h *NovelHandler) SetNovelOwner(w http.ResponseWriter, r *http.Request) {
+	actorID, _ := r.Context().Value(auth.UserIDKey).(string)
+	novelID, ok := novelIDFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		UserID string `json:"user_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request format. Expected {'user_id': 'uuid'}")
+		return
+	}
+	defer r.Body.Close()
+
+	ownerID, err := uuid.Parse(req.UserID)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid user_id format")
+		return
+	}
+
+	if err := h.adminService.SetNovelOwner(r.Context(), actorID, novelID, ownerID); err != nil {
+		respondAdminError(w, err, "reassign novel")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]string{"novel_id": novelID.String(), "user_id": ownerID.String()})
+}
+
+// ListFailedGenerations возвращает задачи сетапа, исчерпавшие все попытки.
+// GET /admin/failed-generations?limit=
+func (h *NovelHandler) ListFailedGenerations(w http.ResponseWriter, r *http.Request) {
+	limit, err := queryInt(r, "limit")
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid limit")
+		return
+	}
+
+	jobs, err := h.adminService.ListFailedGenerations(r.Context(), limit)
+	if err != nil {
+		respondAdminError(w, err, "list failed generations")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{"jobs": jobs})
+}
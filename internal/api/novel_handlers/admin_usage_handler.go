@@ -0,0 +1,77 @@
+package novel_handlers
+
+import (
+	"errors"
+	"net/http"
+	"novel-server/internal/domain"
+	"novel-server/internal/logger"
+	"novel-server/internal/service"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// parseUsageTime разбирает границу периода: дату YYYY-MM-DD (UTC) или время в RFC 3339
+func parseUsageTime(value string) (time.Time, error) {
+	if t, err := time.Parse(time.DateOnly, value); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+// GetUsageSummary возвращает расход токенов и стоимость вызовов модели,
+// сгруппированные по пользователям, новеллам или дням.
+// GET /admin/usage/{group}?from=&to=&user_id=&novel_id=&limit=
+// group: users | novels | days. Период - [from, to), по умолчанию последние 30 дней.
+func (h *NovelHandler) GetUsageSummary(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter := domain.LLMUsageFilter{UserID: query.Get("user_id")}
+
+	if from := query.Get("from"); from != "" {
+		t, err := parseUsageTime(from)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid 'from', expected YYYY-MM-DD or RFC 3339")
+			return
+		}
+		filter.From = t
+	}
+	if to := query.Get("to"); to != "" {
+		t, err := parseUsageTime(to)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid 'to', expected YYYY-MM-DD or RFC 3339")
+			return
+		}
+		filter.To = t
+	}
+	if novelIDStr := query.Get("novel_id"); novelIDStr != "" {
+		novelID, err := uuid.Parse(novelIDStr)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid novel_id format")
+			return
+		}
+		filter.NovelID = &novelID
+	}
+	if limitStr := query.Get("limit"); limitStr != "" {
+		limit, err := strconv.Atoi(limitStr)
+		if err != nil || limit <= 0 {
+			respondWithError(w, http.StatusBadRequest, "Invalid limit")
+			return
+		}
+		filter.Limit = limit
+	}
+
+	group := r.PathValue("group")
+	summaries, err := h.usageService.Summarize(r.Context(), group, filter)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidUsageQuery) {
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		logger.Logger.Error("GetUsageSummary: error summarizing usage", "err", err, "group", group)
+		respondWithError(w, http.StatusInternalServerError, "Failed to get usage summary")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{"group": group, "usage": summaries})
+}
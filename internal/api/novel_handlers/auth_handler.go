@@ -2,42 +2,120 @@ package novel_handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
-	"novel-server/internal/auth"
 	"novel-server/internal/logger"
+	"novel-server/internal/service"
 )
 
-// Authenticate генерирует JWT токен для пользователя
-func (h *NovelHandler) Authenticate(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		respondWithError(w, http.StatusMethodNotAllowed, "Only POST method is allowed")
+// credentialsRequest - тело запросов регистрации и входа
+type credentialsRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// refreshTokenRequest - тело запросов обновления токена и выхода
+type refreshTokenRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// Register создает учетную запись и возвращает пару токенов
+func (h *NovelHandler) Register(w http.ResponseWriter, r *http.Request) {
+	var req credentialsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request format. Expected {'username': 'string', 'password': 'string'}")
 		return
 	}
+	defer r.Body.Close()
 
-	var req struct {
-		UserID string `json:"user_id"`
+	user, tokens, err := h.authService.Register(r.Context(), req.Username, req.Password)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidUsername), errors.Is(err, service.ErrWeakPassword):
+			respondWithError(w, http.StatusBadRequest, err.Error())
+		case errors.Is(err, service.ErrUsernameTaken):
+			respondWithError(w, http.StatusConflict, err.Error())
+		default:
+			logger.Logger.Error("Error registering user", "username", req.Username, "err", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to register user")
+		}
+		return
 	}
 
+	respondWithJSON(w, http.StatusCreated, map[string]interface{}{
+		"user":   user,
+		"tokens": tokens,
+	})
+}
+
+// Login проверяет логин и пароль и возвращает пару токенов
+func (h *NovelHandler) Login(w http.ResponseWriter, r *http.Request) {
+	var req credentialsRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		respondWithError(w, http.StatusBadRequest, "Invalid request format. Expected {'user_id': 'string'}")
+		respondWithError(w, http.StatusBadRequest, "Invalid request format. Expected {'username': 'string', 'password': 'string'}")
 		return
 	}
 	defer r.Body.Close()
 
-	if req.UserID == "" {
-		respondWithError(w, http.StatusBadRequest, "user_id is required")
+	tokens, err := h.authService.Login(r.Context(), req.Username, req.Password)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidCredentials) {
+			respondWithError(w, http.StatusUnauthorized, err.Error())
+			return
+		}
+		if errors.Is(err, service.ErrAccountDisabled) {
+			respondWithError(w, http.StatusForbidden, err.Error())
+			return
+		}
+		logger.Logger.Error("Error logging in", "username", req.Username, "err", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to log in")
 		return
 	}
 
-	// Здесь в будущем может быть проверка пароля или другие методы аутентификации
-	logger.Logger.Info("Generating token", "userID", req.UserID)
+	respondWithJSON(w, http.StatusOK, tokens)
+}
 
-	tokenString, err := auth.GenerateToken(req.UserID)
+// RefreshToken обменивает refresh-токен на новую пару токенов
+func (h *NovelHandler) RefreshToken(w http.ResponseWriter, r *http.Request) {
+	var req refreshTokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.RefreshToken == "" {
+		respondWithError(w, http.StatusBadRequest, "Invalid request format. Expected {'refresh_token': 'string'}")
+		return
+	}
+	defer r.Body.Close()
+
+	tokens, err := h.authService.Refresh(r.Context(), req.RefreshToken)
 	if err != nil {
-		logger.Logger.Error("Error generating token", "userID", req.UserID, "err", err)
-		respondWithError(w, http.StatusInternalServerError, "Failed to generate token")
+		if errors.Is(err, service.ErrInvalidRefreshToken) {
+			respondWithError(w, http.StatusUnauthorized, err.Error())
+			return
+		}
+		if errors.Is(err, service.ErrAccountDisabled) {
+			respondWithError(w, http.StatusForbidden, err.Error())
+			return
+		}
+		logger.Logger.Error("Error refreshing token", "err", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to refresh token")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, tokens)
+}
+
+// Logout отзывает refresh-токен и все токены, полученные из него обновлением
+func (h *NovelHandler) Logout(w http.ResponseWriter, r *http.Request) {
+	var req refreshTokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.RefreshToken == "" {
+		respondWithError(w, http.StatusBadRequest, "Invalid request format. Expected {'refresh_token': 'string'}")
+		return
+	}
+	defer r.Body.Close()
+
+	if err := h.authService.Logout(r.Context(), req.RefreshToken); err != nil {
+		logger.Logger.Error("Error logging out", "err", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to log out")
 		return
 	}
 
-	respondWithJSON(w, http.StatusOK, map[string]string{"token": tokenString})
+	w.WriteHeader(http.StatusNoContent)
 }
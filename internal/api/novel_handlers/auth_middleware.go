@@ -2,16 +2,25 @@ package novel_handlers
 
 import (
 	"context"
+	"errors"
 	"net/http"
 	"novel-server/internal/auth"
+	"novel-server/internal/domain"
 	"novel-server/internal/logger"
+	"novel-server/internal/service"
 )
 
-// AuthMiddleware проверяет JWT токен и добавляет UserID в контекст
-func AuthMiddleware(next http.HandlerFunc) http.HandlerFunc {
+// AuthMiddleware проверяет JWT токен и учетную запись и добавляет UserID в контекст.
+// Заблокированная учетная запись получает 403 сразу, не дожидаясь истечения токена.
+func (h *NovelHandler) AuthMiddleware(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		// Получаем токен из заголовка Authorization
 		tokenString := r.Header.Get("Authorization")
+		if tokenString == "" && r.Header.Get("Accept") == "text/event-stream" {
+			// Браузерный EventSource не умеет передавать заголовки, поэтому для SSE
+			// допускаем токен в параметре запроса
+			tokenString = r.URL.Query().Get("access_token")
+		}
 		if tokenString == "" {
 			logger.Logger.Warn("AUTH: no Authorization header provided")
 			respondWithError(w, http.StatusUnauthorized, "Authorization token is required")
@@ -31,10 +40,45 @@ func AuthMiddleware(next http.HandlerFunc) http.HandlerFunc {
 			respondWithError(w, http.StatusUnauthorized, "Invalid or expired token")
 			return
 		}
+		if err := h.authService.CheckAccount(r.Context(), claims.UserID); err != nil {
+			switch {
+			case errors.Is(err, service.ErrAccountDisabled):
+				logger.Logger.Warn("AUTH: disabled account", "userID", claims.UserID)
+				respondWithError(w, http.StatusForbidden, err.Error())
+			case errors.Is(err, service.ErrUnknownAccount):
+				logger.Logger.Warn("AUTH: token of an unknown account", "userID", claims.UserID)
+				respondWithError(w, http.StatusUnauthorized, "Invalid or expired token")
+			default:
+				logger.Logger.Error("AUTH: error checking account", "userID", claims.UserID, "err", err)
+				respondWithError(w, http.StatusInternalServerError, "Failed to check account")
+			}
+			return
+		}
 
-		// Используем константу UserIDKey из пакета auth
+		// Используем константы UserIDKey и RoleKey из пакета auth
 		ctx := context.WithValue(r.Context(), auth.UserIDKey, claims.UserID)
-		logger.Logger.Info("AUTH: user added to context", "userID", claims.UserID)
+		ctx = context.WithValue(ctx, auth.RoleKey, claims.Role)
+		logger.Logger.Info("AUTH: user added to context", "userID", claims.UserID, "role", claims.Role)
 		next(w, r.WithContext(ctx))
 	}
 }
+
+// RequireRole пропускает только пользователей с ролью minRole или выше (см. domain.RoleAtLeast).
+// Проверяет токен и учетную запись так же, как AuthMiddleware.
+func (h *NovelHandler) RequireRole(minRole string, next http.HandlerFunc) http.HandlerFunc {
+	return h.AuthMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		role, _ := r.Context().Value(auth.RoleKey).(string)
+		if !domain.RoleAtLeast(role, minRole) {
+			userID, _ := r.Context().Value(auth.UserIDKey).(string)
+			logger.Logger.Warn("AUTH: access denied by role", "userID", userID, "role", role, "required", minRole)
+			respondWithError(w, http.StatusForbidden, "Role '"+minRole+"' or higher is required")
+			return
+		}
+		next(w, r)
+	})
+}
+
+// AdminMiddleware пропускает только администраторов.
+func (h *NovelHandler) AdminMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return h.RequireRole(domain.RoleAdmin, next)
+}
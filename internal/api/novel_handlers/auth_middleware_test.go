@@ -0,0 +1,90 @@
+package novel_handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"novel-server/internal/auth"
+	"novel-server/internal/domain"
+	"novel-server/internal/repository"
+	"novel-server/internal/service"
+	"testing"
+)
+
+// newTestUser создает учетную запись с ролью role и возвращает ее access-токен
+func newTestUser(t *testing.T, users *repository.MemoryUserRepository, username, role string) (*domain.User, string) {
+	t.Helper()
+	ctx := context.Background()
+
+	user := &domain.User{Username: username, PasswordHash: "-", Role: role}
+	if err := users.CreateUser(ctx, user); err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	token, err := auth.GenerateToken(user.UserID.String(), user.Username, role)
+	if err != nil {
+		t.Fatalf("GenerateToken: %v", err)
+	}
+	return user, token
+}
+
+// serve выполняет запрос с токеном token через handler и возвращает статус ответа
+func serve(handler http.HandlerFunc, token string) int {
+	req := httptest.NewRequest(http.MethodGet, "/api/test", nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+	return rec.Code
+}
+
+func TestAuthMiddleware(t *testing.T) {
+	t.Setenv("JWT_SECRET", "test-secret")
+	if err := auth.InitJWT(); err != nil {
+		t.Fatalf("InitJWT: %v", err)
+	}
+	users := repository.NewMemoryUserRepository()
+	h := &NovelHandler{authService: service.NewAuthService(users)}
+
+	tokens := make(map[string]string)
+	for _, role := range []string{domain.RolePlayer, domain.RoleAuthor, domain.RoleModerator, domain.RoleAdmin} {
+		_, tokens[role] = newTestUser(t, users, role+"-user", role)
+	}
+	disabled, disabledToken := newTestUser(t, users, "disabled-user", domain.RoleAdmin)
+	if err := users.SetUserDisabled(context.Background(), disabled.UserID, true); err != nil {
+		t.Fatalf("SetUserDisabled: %v", err)
+	}
+	unknownToken, err := auth.GenerateToken("6c0e5e1c-3c56-4a3e-9b38-3f1f4f1d2c11", "ghost", domain.RoleAdmin)
+	if err != nil {
+		t.Fatalf("GenerateToken: %v", err)
+	}
+
+	ok := func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		token   string
+		want    int
+	}{
+		{"no token", h.AuthMiddleware(ok), "", http.StatusUnauthorized},
+		{"invalid token", h.AuthMiddleware(ok), "not-a-jwt", http.StatusUnauthorized},
+		{"player", h.AuthMiddleware(ok), tokens[domain.RolePlayer], http.StatusOK},
+		{"disabled account", h.AuthMiddleware(ok), disabledToken, http.StatusForbidden},
+		{"unknown account", h.AuthMiddleware(ok), unknownToken, http.StatusUnauthorized},
+		{"player below author", h.RequireRole(domain.RoleAuthor, ok), tokens[domain.RolePlayer], http.StatusForbidden},
+		{"author", h.RequireRole(domain.RoleAuthor, ok), tokens[domain.RoleAuthor], http.StatusOK},
+		{"admin above author", h.RequireRole(domain.RoleAuthor, ok), tokens[domain.RoleAdmin], http.StatusOK},
+		{"author below moderator", h.RequireRole(domain.RoleModerator, ok), tokens[domain.RoleAuthor], http.StatusForbidden},
+		{"moderator", h.RequireRole(domain.RoleModerator, ok), tokens[domain.RoleModerator], http.StatusOK},
+		{"moderator below admin", h.AdminMiddleware(ok), tokens[domain.RoleModerator], http.StatusForbidden},
+		{"admin", h.AdminMiddleware(ok), tokens[domain.RoleAdmin], http.StatusOK},
+		{"disabled admin", h.AdminMiddleware(ok), disabledToken, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := serve(tt.handler, tt.token); got != tt.want {
+				t.Errorf("status = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
@@ -3,6 +3,7 @@ package novel_handlers
 import (
 	"encoding/json"
 	"net/http"
+	"novel-server/internal/domain"
 	"novel-server/internal/logger"
 	"novel-server/internal/service"
 )
@@ -11,35 +12,100 @@ import (
 type NovelHandler struct {
 	novelService        *service.NovelService
 	novelContentService *service.NovelContentService
+	usageService        *service.UsageService
+	quotaService        *service.QuotaService
+	authService         *service.AuthService
+	adminService        *service.AdminService
 }
 
 // NewNovelHandler создает новый экземпляр обработчика
-func NewNovelHandler(novelService *service.NovelService, novelContentService *service.NovelContentService) *NovelHandler {
+func NewNovelHandler(novelService *service.NovelService, novelContentService *service.NovelContentService, usageService *service.UsageService, quotaService *service.QuotaService, authService *service.AuthService, adminService *service.AdminService) *NovelHandler {
 	return &NovelHandler{
 		novelService:        novelService,
 		novelContentService: novelContentService,
+		usageService:        usageService,
+		quotaService:        quotaService,
+		authService:         authService,
+		adminService:        adminService,
 	}
 }
 
 // RegisterRoutes регистрирует маршруты обработчика
 func (h *NovelHandler) RegisterRoutes(mux *http.ServeMux, basePath string) {
-	mux.HandleFunc(basePath+"/auth/token", h.Authenticate)
+	// Учетные записи и токены
+	mux.HandleFunc("POST "+basePath+"/auth/register", h.Register)
+	mux.HandleFunc("POST "+basePath+"/auth/login", h.Login)
+	mux.HandleFunc("POST "+basePath+"/auth/refresh", h.RefreshToken)
+	mux.HandleFunc("POST "+basePath+"/auth/logout", h.Logout)
 
-	// Новые маршруты для работы с черновиками
-	mux.HandleFunc(basePath+"/create-draft", AuthMiddleware(h.CreateNovelDraft))
-	mux.HandleFunc(basePath+"/confirm-draft", AuthMiddleware(h.ConfirmNovelDraft))
-	mux.HandleFunc(basePath+"/refine-draft", AuthMiddleware(h.RefineNovelDraft))
+	// Новые маршруты для работы с черновиками. Создавать новеллы могут авторы и выше,
+	// запросы к модели списываются из квот пользователя
+	mux.HandleFunc(basePath+"/create-draft", h.RequireRole(domain.RoleAuthor, h.QuotaMiddleware(domain.QuotaDrafts, h.CreateNovelDraft)))
+	mux.HandleFunc(basePath+"/confirm-draft", h.RequireRole(domain.RoleAuthor, h.QuotaMiddleware(domain.QuotaTokens, h.ConfirmNovelDraft)))
+	mux.HandleFunc(basePath+"/refine-draft", h.RequireRole(domain.RoleAuthor, h.QuotaMiddleware(domain.QuotaDrafts, h.RefineNovelDraft)))
+
+	// Черновики текущего пользователя и история их ревизий
+	mux.HandleFunc("GET "+basePath+"/drafts", h.AuthMiddleware(h.ListDrafts))
+	mux.HandleFunc("GET "+basePath+"/drafts/{id}", h.AuthMiddleware(h.GetDraft))
+	mux.HandleFunc("DELETE "+basePath+"/drafts/{id}", h.AuthMiddleware(h.DeleteDraft))
+	mux.HandleFunc("GET "+basePath+"/drafts/{id}/revisions", h.AuthMiddleware(h.ListDraftRevisions))
+	mux.HandleFunc("GET "+basePath+"/drafts/{id}/revisions/{rev}", h.AuthMiddleware(h.GetDraftRevision))
+	mux.HandleFunc("POST "+basePath+"/drafts/{id}/revisions/{rev}/rollback", h.AuthMiddleware(h.RollbackDraft))
+	mux.HandleFunc("GET "+basePath+"/drafts/{id}/diff", h.AuthMiddleware(h.DiffDraftRevisions))
 
 	// Для обратной совместимости используем тот же обработчик CreateNovelDraft
 	// TODO: удалить после перехода всех клиентов на новый API
-	mux.HandleFunc(basePath+"/generate-novel", AuthMiddleware(h.CreateNovelDraft))
+	mux.HandleFunc(basePath+"/generate-novel", h.RequireRole(domain.RoleAuthor, h.QuotaMiddleware(domain.QuotaDrafts, h.CreateNovelDraft)))
 
 	// Остальные существующие маршруты
-	mux.HandleFunc(basePath+"/generate-novel-content", AuthMiddleware(h.GenerateNovelContent))
-	mux.HandleFunc(basePath+"/novel-action", AuthMiddleware(h.HandleNovelAction))
-	mux.HandleFunc(basePath+"/inline-response", AuthMiddleware(h.HandleInlineResponse))
-	mux.HandleFunc(basePath+"/novels", AuthMiddleware(h.ListNovels))
-	mux.HandleFunc(basePath+"/novel-details", h.GetNovelDetails)
+	mux.HandleFunc(basePath+"/generate-novel-content", h.AuthMiddleware(h.QuotaMiddleware(domain.QuotaScenes, h.GenerateNovelContent)))
+	mux.HandleFunc(basePath+"/generate-novel-content/stream", h.AuthMiddleware(h.QuotaMiddleware(domain.QuotaScenes, h.GenerateNovelContentStream)))
+	mux.HandleFunc(basePath+"/novel-action", h.AuthMiddleware(h.HandleNovelAction))
+	mux.HandleFunc(basePath+"/inline-response", h.AuthMiddleware(h.HandleInlineResponse))
+	mux.HandleFunc(basePath+"/novels", h.AuthMiddleware(h.ListNovels))
+	mux.HandleFunc(basePath+"/novel-details", h.AuthMiddleware(h.GetNovelDetails))
+
+	// Редактирование и удаление своих новелл, сброс своего прохождения
+	mux.HandleFunc("PATCH "+basePath+"/novels/{id}", h.AuthMiddleware(h.UpdateNovel))
+	mux.HandleFunc("DELETE "+basePath+"/novels/{id}", h.AuthMiddleware(h.DeleteNovel))
+	mux.HandleFunc("DELETE "+basePath+"/novels/{id}/progress", h.AuthMiddleware(h.DeleteProgress))
+
+	// Очередь генерации сетапа
+	mux.HandleFunc("GET "+basePath+"/novels/{id}/setup-status", h.AuthMiddleware(h.GetSetupStatus))
+	mux.HandleFunc("POST "+basePath+"/novels/{id}/setup-retry", h.AuthMiddleware(h.RetrySetup))
+	mux.HandleFunc("GET "+basePath+"/setup-jobs", h.AuthMiddleware(h.ListSetupJobs))
+
+	// Граф ветвлений новеллы для автора
+	mux.HandleFunc("GET "+basePath+"/novels/{id}/graph", h.AuthMiddleware(h.GetStoryGraph))
+
+	// Видимость новеллы и ссылки на нее
+	mux.HandleFunc("PUT "+basePath+"/novels/{id}/visibility", h.AuthMiddleware(h.SetNovelVisibility))
+	mux.HandleFunc("POST "+basePath+"/novels/{id}/share-link", h.AuthMiddleware(h.CreateShareLink))
+	mux.HandleFunc("DELETE "+basePath+"/novels/{id}/share-link", h.AuthMiddleware(h.DeleteShareLink))
+	mux.HandleFunc("GET "+basePath+"/shared/{token}", h.AuthMiddleware(h.OpenShareLink))
+
+	// Сохранения прохождения
+	mux.HandleFunc("GET "+basePath+"/novels/{id}/saves", h.AuthMiddleware(h.ListSaveSlots))
+	mux.HandleFunc("POST "+basePath+"/novels/{id}/saves", h.AuthMiddleware(h.CreateSaveSlot))
+	mux.HandleFunc("POST "+basePath+"/novels/{id}/saves/{slot}/load", h.AuthMiddleware(h.LoadSaveSlot))
+	mux.HandleFunc("DELETE "+basePath+"/novels/{id}/saves/{slot}", h.AuthMiddleware(h.DeleteSaveSlot))
+
+	// Остаток квот текущего пользователя
+	mux.HandleFunc("GET "+basePath+"/me/quota", h.AuthMiddleware(h.GetQuota))
+
+	// Расход токенов и стоимость вызовов модели (только для администраторов)
+	mux.HandleFunc("GET "+basePath+"/admin/usage/{group}", h.AdminMiddleware(h.GetUsageSummary))
+
+	// Модерация: упавшие генерации и удаление любой новеллы
+	mux.HandleFunc("GET "+basePath+"/admin/failed-generations", h.RequireRole(domain.RoleModerator, h.ListFailedGenerations))
+	mux.HandleFunc("DELETE "+basePath+"/admin/novels/{id}", h.RequireRole(domain.RoleModerator, h.ForceDeleteNovel))
+
+	// Управление пользователями и владельцами новелл (только для администраторов)
+	mux.HandleFunc("GET "+basePath+"/admin/users", h.AdminMiddleware(h.ListUsers))
+	mux.HandleFunc("PUT "+basePath+"/admin/users/{id}/role", h.AdminMiddleware(h.SetUserRole))
+	mux.HandleFunc("POST "+basePath+"/admin/users/{id}/disable", h.AdminMiddleware(h.DisableUser))
+	mux.HandleFunc("POST "+basePath+"/admin/users/{id}/enable", h.AdminMiddleware(h.EnableUser))
+	mux.HandleFunc("PUT "+basePath+"/admin/novels/{id}/owner", h.AdminMiddleware(h.SetNovelOwner))
 }
 
 // respondWithError отправляет ошибку в формате JSON
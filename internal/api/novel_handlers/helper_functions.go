@@ -33,7 +33,8 @@ func createSimplifiedResponse(fullResponse *domain.NovelContentResponse) domain.
 	}
 
 	// Преобразуем события в упрощенные для клиента
-	simplifiedEvents := convertToSimplifiedEvents(events)
+	// Условия вариантов выбора проверяются на итоговом состоянии
+	simplifiedEvents := domain.SimplifyEvents(events, &fullResponse.State)
 
 	// Проверяем, завершена ли история
 	isComplete := fullResponse.State.CurrentStage == domain.StageComplete
@@ -79,267 +80,3 @@ func createSimplifiedResponse(fullResponse *domain.NovelContentResponse) domain.
 		SetupCharacters:   setupCharacters,
 	}
 }
-
-// convertToSimplifiedEvents преобразует обычные события в упрощенные для клиента
-func convertToSimplifiedEvents(events []domain.Event) []domain.SimplifiedEvent {
-	if events == nil {
-		return nil
-	}
-
-	result := make([]domain.SimplifiedEvent, len(events))
-
-	for i, event := range events {
-		simplifiedEvent := domain.SimplifiedEvent{
-			EventType:   event.EventType,
-			Speaker:     event.Speaker,
-			Text:        event.Text,
-			Character:   event.Character,
-			From:        event.From,
-			To:          event.To,
-			Description: event.Description,
-		}
-
-		// Обрабатываем особые типы событий
-		switch event.EventType {
-		case "choice":
-			// Преобразуем выборы, скрывая последствия
-			simplifiedChoices := make([]domain.SimplifiedChoice, len(event.Choices))
-			for j, choice := range event.Choices {
-				simplifiedChoices[j] = domain.SimplifiedChoice{
-					Text: choice.Text,
-					// Последствия (consequences) не передаем клиенту
-				}
-			}
-			simplifiedEvent.Choices = simplifiedChoices
-
-		case "inline_choice":
-			// В inline_choice есть дополнительные поля
-			if event.Data != nil && event.Data["choice_id"] != nil {
-				if choiceID, ok := event.Data["choice_id"].(string); ok {
-					simplifiedEvent.ChoiceID = choiceID
-				}
-			}
-			simplifiedEvent.Description = event.Description
-
-			// Преобразуем выборы, скрывая последствия
-			if event.Data != nil && event.Data["choices"] != nil {
-				if choices, ok := event.Data["choices"].([]interface{}); ok {
-					simplifiedChoices := make([]domain.SimplifiedChoice, 0, len(choices))
-					for _, choiceInterface := range choices {
-						if choice, ok := choiceInterface.(map[string]interface{}); ok {
-							if textVal, ok := choice["text"]; ok && textVal != nil {
-								if text, ok := textVal.(string); ok {
-									simplifiedChoices = append(simplifiedChoices, domain.SimplifiedChoice{
-										Text: text,
-										// Последствия (consequences) не передаем клиенту
-									})
-								}
-							}
-						}
-					}
-					simplifiedEvent.Choices = simplifiedChoices
-				}
-			}
-
-		case "inline_response":
-			// Обработка inline_response
-			if event.Data != nil && event.Data["choice_id"] != nil {
-				if choiceID, ok := event.Data["choice_id"].(string); ok {
-					simplifiedEvent.ChoiceID = choiceID
-				}
-			}
-
-			if event.Data != nil && event.Data["responses"] != nil {
-				if responses, ok := event.Data["responses"].([]interface{}); ok {
-					simplifiedResponses := make([]domain.SimplifiedResponse, 0, len(responses))
-
-					for _, respInterface := range responses {
-						if resp, ok := respInterface.(map[string]interface{}); ok {
-							choiceText := ""
-							if textVal, ok := resp["choice_text"]; ok && textVal != nil {
-								if text, ok := textVal.(string); ok {
-									choiceText = text
-								}
-							}
-
-							simplifiedResponse := domain.SimplifiedResponse{
-								ChoiceText: choiceText,
-							}
-
-							// Преобразуем response_events
-							if responseEvents, ok := resp["response_events"].([]interface{}); ok && responseEvents != nil {
-								respEvents := make([]domain.Event, 0, len(responseEvents))
-
-								for _, eventInterface := range responseEvents {
-									if eventMap, ok := eventInterface.(map[string]interface{}); ok {
-										// Проверяем event_type
-										if eventTypeVal, ok := eventMap["event_type"]; ok && eventTypeVal != nil {
-											if eventType, ok := eventTypeVal.(string); ok {
-												// Конвертируем из map в Event
-												respEvent := domain.Event{
-													EventType: eventType,
-												}
-
-												if speaker, ok := eventMap["speaker"].(string); ok {
-													respEvent.Speaker = speaker
-												}
-												if text, ok := eventMap["text"].(string); ok {
-													respEvent.Text = text
-												}
-												if expression, ok := eventMap["expression"].(string); ok {
-													// Сохраняем выражение для диалогов
-													if respEvent.Data == nil {
-														respEvent.Data = make(map[string]interface{})
-													}
-													respEvent.Data["expression"] = expression
-												}
-
-												// Добавляем обработку полей character и to для emotion_change
-												if eventType == "emotion_change" {
-													if character, ok := eventMap["character"].(string); ok {
-														respEvent.Character = character
-													}
-													if to, ok := eventMap["to"].(string); ok {
-														respEvent.To = to
-													}
-												}
-
-												respEvents = append(respEvents, respEvent)
-											}
-										}
-									}
-								}
-
-								// Преобразуем вложенные события в упрощенные
-								simplifiedResponse.ResponseEvents = convertToSimplifiedEvents(respEvents)
-							}
-
-							simplifiedResponses = append(simplifiedResponses, simplifiedResponse)
-						}
-					}
-
-					simplifiedEvent.Responses = simplifiedResponses
-				}
-			}
-		}
-
-		result[i] = simplifiedEvent
-	}
-
-	return result
-}
-
-// processUserChoice обрабатывает выбор пользователя и применяет последствия к состоянию
-func processUserChoice(state *domain.NovelState, scene domain.Scene, choiceText string) {
-	// Ищем событие с выбором в сцене
-	var choiceEvent *domain.Event
-	for i, event := range scene.Events {
-		if event.EventType == "choice" && len(event.Choices) > 0 {
-			choiceEvent = &scene.Events[i]
-			break
-		}
-	}
-
-	if choiceEvent == nil {
-		return // Нет события с выбором
-	}
-
-	// Ищем выбор по тексту
-	var selectedChoice *domain.Choice
-	for i, choice := range choiceEvent.Choices {
-		if choice.Text == choiceText {
-			selectedChoice = &choiceEvent.Choices[i]
-			break
-		}
-	}
-
-	if selectedChoice == nil {
-		return // Выбор не найден
-	}
-
-	// Сохраняем выбор в истории
-	state.PreviousChoices = append(state.PreviousChoices, choiceText)
-
-	// Если у выбора есть последствия, применяем их к состоянию
-	if selectedChoice.Consequences != nil {
-		// Обновляем отношения с персонажами
-		if relationshipChanges, ok := selectedChoice.Consequences["relationship"].(map[string]interface{}); ok {
-			for character, valueInterface := range relationshipChanges {
-				if value, ok := valueInterface.(float64); ok {
-					// Убедимся, что map существует
-					if state.Relationship == nil {
-						state.Relationship = make(map[string]int)
-					}
-					// Обновляем значение отношения
-					state.Relationship[character] += int(value)
-				}
-			}
-		}
-
-		// Добавляем глобальные флаги
-		if flagsToAdd, ok := selectedChoice.Consequences["add_global_flags"].([]interface{}); ok {
-			for _, flagInterface := range flagsToAdd {
-				if flag, ok := flagInterface.(string); ok {
-					// Проверяем, существует ли уже такой флаг
-					flagExists := false
-					for _, existingFlag := range state.GlobalFlags {
-						if existingFlag == flag {
-							flagExists = true
-							break
-						}
-					}
-					if !flagExists {
-						state.GlobalFlags = append(state.GlobalFlags, flag)
-					}
-				}
-			}
-		}
-
-		// Удаляем глобальные флаги
-		if flagsToRemove, ok := selectedChoice.Consequences["remove_global_flags"].([]interface{}); ok {
-			for _, flagInterface := range flagsToRemove {
-				if flag, ok := flagInterface.(string); ok {
-					// Ищем и удаляем флаг
-					for i, existingFlag := range state.GlobalFlags {
-						if existingFlag == flag {
-							// Удаляем флаг, сохраняя порядок других элементов
-							state.GlobalFlags = append(state.GlobalFlags[:i], state.GlobalFlags[i+1:]...)
-							break
-						}
-					}
-				}
-			}
-		}
-
-		// Обновляем переменные истории
-		if storyVariables, ok := selectedChoice.Consequences["story_variables"].(map[string]interface{}); ok {
-			// Убедимся, что map существует
-			if state.StoryVariables == nil {
-				state.StoryVariables = make(map[string]interface{})
-			}
-			// Обновляем переменные
-			for key, value := range storyVariables {
-				state.StoryVariables[key] = value
-			}
-		}
-
-		// Добавляем ветки истории
-		if branches, ok := selectedChoice.Consequences["story_branches"].([]interface{}); ok {
-			for _, branchInterface := range branches {
-				if branch, ok := branchInterface.(string); ok {
-					// Проверяем, существует ли уже такая ветка
-					branchExists := false
-					for _, existingBranch := range state.StoryBranches {
-						if existingBranch == branch {
-							branchExists = true
-							break
-						}
-					}
-					if !branchExists {
-						state.StoryBranches = append(state.StoryBranches, branch)
-					}
-				}
-			}
-		}
-	}
-}
@@ -2,10 +2,12 @@ package novel_handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
 	"novel-server/internal/auth"
 	"novel-server/internal/domain"
+	"novel-server/internal/service"
 
 	"github.com/google/uuid"
 )
@@ -54,6 +56,14 @@ func (h *NovelHandler) HandleInlineResponse(w http.ResponseWriter, r *http.Reque
 	// Получаем текущее состояние из репозитория через сервис
 	result, err := h.novelContentService.HandleInlineResponse(r.Context(), userID, request)
 	if err != nil {
+		if errors.Is(err, service.ErrChoiceLocked) {
+			respondWithError(w, http.StatusConflict, err.Error())
+			return
+		}
+		if errors.Is(err, service.ErrNovelNotFound) {
+			respondWithError(w, http.StatusNotFound, "Novel not found")
+			return
+		}
 		log.Printf("[API] HandleInlineResponse - Error processing inline response: %v", err)
 		respondWithError(w, http.StatusInternalServerError, "Failed to process inline response")
 		return
@@ -2,10 +2,12 @@ package novel_handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
 	"novel-server/internal/auth"
 	"novel-server/internal/domain"
+	"novel-server/internal/service"
 
 	"github.com/google/uuid"
 )
@@ -82,6 +84,10 @@ func (h *NovelHandler) HandleNovelAction(w http.ResponseWriter, r *http.Request)
 		// Генерируем контент с перезапуском
 		fullResponse, err := h.novelContentService.GenerateNovelContent(r.Context(), fullContentRequest)
 		if err != nil {
+			if errors.Is(err, service.ErrSceneNotPlayed) || errors.Is(err, service.ErrNovelNotFound) {
+				respondWithError(w, http.StatusNotFound, err.Error())
+				return
+			}
 			log.Printf("[API] HandleNovelAction - Error restarting novel: %v", err)
 			respondWithError(w, http.StatusInternalServerError, "Failed to restart novel")
 			return
@@ -93,8 +99,31 @@ func (h *NovelHandler) HandleNovelAction(w http.ResponseWriter, r *http.Request)
 		// Отправляем упрощенный ответ
 		respondWithJSON(w, http.StatusOK, simplifiedResponse)
 	} else if request.Action == "get_scene" {
-		// TODO: Имплементация для получения информации о конкретной сцене
-		respondWithError(w, http.StatusNotImplemented, "get_scene action not implemented yet")
+		// Проверяем обязательные параметры
+		if request.SceneIndex == nil {
+			respondWithError(w, http.StatusBadRequest, "scene_index is required for get_scene action")
+			return
+		}
+
+		sceneIndex := *request.SceneIndex
+		if sceneIndex < 0 {
+			respondWithError(w, http.StatusBadRequest, "Invalid scene_index value")
+			return
+		}
+
+		// Возвращаем уже пройденную сцену без генерации и без изменения прогресса
+		fullResponse, err := h.novelContentService.GetScene(r.Context(), request.NovelID, userID, sceneIndex)
+		if err != nil {
+			if errors.Is(err, service.ErrSceneNotPlayed) || errors.Is(err, service.ErrNovelNotFound) {
+				respondWithError(w, http.StatusNotFound, err.Error())
+				return
+			}
+			log.Printf("[API] HandleNovelAction - Error getting scene: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to get scene")
+			return
+		}
+
+		respondWithJSON(w, http.StatusOK, createSimplifiedResponse(fullResponse))
 	} else {
 		respondWithError(w, http.StatusBadRequest, "Unknown action")
 	}
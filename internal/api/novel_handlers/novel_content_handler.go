@@ -2,10 +2,12 @@ package novel_handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 	"novel-server/internal/auth"
 	"novel-server/internal/domain"
 	"novel-server/internal/logger"
+	"novel-server/internal/service"
 
 	"github.com/google/uuid"
 )
@@ -54,6 +56,21 @@ func (h *NovelHandler) GenerateNovelContent(w http.ResponseWriter, r *http.Reque
 	// Генерируем контент новеллы
 	fullResponse, err := h.novelContentService.GenerateNovelContent(r.Context(), fullRequest)
 	if err != nil {
+		if errors.Is(err, service.ErrChoiceLocked) {
+			respondWithError(w, http.StatusConflict, err.Error())
+			return
+		}
+		if errors.Is(err, service.ErrSceneNotPlayed) {
+			respondWithError(w, http.StatusNotFound, err.Error())
+			return
+		}
+		if errors.Is(err, service.ErrNovelNotFound) {
+			respondWithError(w, http.StatusNotFound, "Novel not found")
+			return
+		}
+		if respondQuotaExceeded(w, err) {
+			return
+		}
 		logger.Logger.Error("Error generating novel content", "err", err)
 		respondWithError(w, http.StatusInternalServerError, "Failed to generate novel content")
 		return
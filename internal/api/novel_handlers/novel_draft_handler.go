@@ -0,0 +1,220 @@
+package novel_handlers
+
+import (
+	"errors"
+	"net/http"
+	"novel-server/internal/auth"
+	"novel-server/internal/logger"
+	"novel-server/internal/service"
+	"strconv"
+
+	"github.com/google/uuid"
+)
+
+// draftIDFromPath извлекает ID черновика из шаблона маршрута {id}.
+// При ошибке сам отвечает клиенту и возвращает false.
+func draftIDFromPath(w http.ResponseWriter, r *http.Request) (uuid.UUID, bool) {
+	draftID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid draft id format")
+		return uuid.Nil, false
+	}
+	return draftID, true
+}
+
+// revisionFromPath извлекает номер ревизии черновика из шаблона маршрута {rev}.
+// При ошибке сам отвечает клиенту и возвращает false.
+func revisionFromPath(w http.ResponseWriter, r *http.Request) (int, bool) {
+	revision, err := strconv.Atoi(r.PathValue("rev"))
+	if err != nil || revision <= 0 {
+		respondWithError(w, http.StatusBadRequest, "Invalid revision")
+		return 0, false
+	}
+	return revision, true
+}
+
+// respondDraftError переводит ошибки черновиков и их ревизий в HTTP-статусы
+func respondDraftError(w http.ResponseWriter, err error, action string) {
+	switch {
+	case errors.Is(err, service.ErrDraftNotFound):
+		respondWithError(w, http.StatusNotFound, "Draft not found")
+	case errors.Is(err, service.ErrDraftRevisionNotFound):
+		respondWithError(w, http.StatusNotFound, "Draft revision not found")
+	case errors.Is(err, service.ErrDraftRevisionCurrent):
+		respondWithError(w, http.StatusConflict, err.Error())
+	default:
+		logger.Logger.Error("Drafts: request failed", "action", action, "err", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to "+action)
+	}
+}
+
+// ListDrafts возвращает черновики текущего пользователя.
+// GET /drafts?limit=&offset=
+func (h *NovelHandler) ListDrafts(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(auth.UserIDKey).(string)
+	if !ok || userID == "" {
+		respondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+	limit, err := queryInt(r, "limit")
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid limit")
+		return
+	}
+	offset, err := queryInt(r, "offset")
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid offset")
+		return
+	}
+
+	drafts, err := h.novelService.ListDrafts(r.Context(), userID, limit, offset)
+	if err != nil {
+		logger.Logger.Error("ListDrafts: error listing drafts", "err", err, "userID", userID)
+		respondWithError(w, http.StatusInternalServerError, "Failed to list drafts")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{"drafts": drafts})
+}
+
+// GetDraft возвращает черновик текущего пользователя вместе с конфигом.
+// GET /drafts/{id}
+func (h *NovelHandler) GetDraft(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(auth.UserIDKey).(string)
+	if !ok || userID == "" {
+		respondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+	draftID, ok := draftIDFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	draft, err := h.novelService.GetDraft(r.Context(), userID, draftID)
+	if err != nil {
+		respondDraftError(w, err, "get draft")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, draft)
+}
+
+// DeleteDraft удаляет черновик текущего пользователя.
+// DELETE /drafts/{id}
+func (h *NovelHandler) DeleteDraft(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(auth.UserIDKey).(string)
+	if !ok || userID == "" {
+		respondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+	draftID, ok := draftIDFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.novelService.DeleteDraft(r.Context(), userID, draftID); err != nil {
+		respondDraftError(w, err, "delete draft")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ListDraftRevisions возвращает историю ревизий черновика.
+// GET /drafts/{id}/revisions
+func (h *NovelHandler) ListDraftRevisions(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(auth.UserIDKey).(string)
+	if !ok || userID == "" {
+		respondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+	draftID, ok := draftIDFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	revisions, err := h.novelService.ListDraftRevisions(r.Context(), userID, draftID)
+	if err != nil {
+		respondDraftError(w, err, "list draft revisions")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{"revisions": revisions})
+}
+
+// GetDraftRevision возвращает ревизию черновика вместе с конфигом.
+// GET /drafts/{id}/revisions/{rev}
+func (h *NovelHandler) GetDraftRevision(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(auth.UserIDKey).(string)
+	if !ok || userID == "" {
+		respondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+	draftID, ok := draftIDFromPath(w, r)
+	if !ok {
+		return
+	}
+	revision, ok := revisionFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	v, err := h.novelService.GetDraftRevision(r.Context(), userID, draftID, revision)
+	if err != nil {
+		respondDraftError(w, err, "get draft revision")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, v)
+}
+
+// DiffDraftRevisions сравнивает две ревизии черновика поле за полем.
+// GET /drafts/{id}/diff?from=N[&to=M], без to - с текущей ревизией
+func (h *NovelHandler) DiffDraftRevisions(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(auth.UserIDKey).(string)
+	if !ok || userID == "" {
+		respondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+	draftID, ok := draftIDFromPath(w, r)
+	if !ok {
+		return
+	}
+	from, err := queryInt(r, "from")
+	if err != nil || from == 0 {
+		respondWithError(w, http.StatusBadRequest, "from is required and must be a revision number")
+		return
+	}
+	to, err := queryInt(r, "to")
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid to")
+		return
+	}
+
+	diff, err := h.novelService.DiffDraftRevisions(r.Context(), userID, draftID, from, to)
+	if err != nil {
+		respondDraftError(w, err, "diff draft revisions")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, diff)
+}
+
+// RollbackDraft возвращает черновик к ревизии {rev}, добавляя новую ревизию.
+// POST /drafts/{id}/revisions/{rev}/rollback
+func (h *NovelHandler) RollbackDraft(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(auth.UserIDKey).(string)
+	if !ok || userID == "" {
+		respondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+	draftID, ok := draftIDFromPath(w, r)
+	if !ok {
+		return
+	}
+	revision, ok := revisionFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	v, err := h.novelService.RollbackDraft(r.Context(), userID, draftID, revision)
+	if err != nil {
+		respondDraftError(w, err, "roll back draft")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, v)
+}
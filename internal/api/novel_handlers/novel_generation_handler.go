@@ -2,10 +2,12 @@ package novel_handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
 	"novel-server/internal/auth"
 	"novel-server/internal/domain"
+	"novel-server/internal/service"
 
 	"github.com/google/uuid"
 )
@@ -53,6 +55,9 @@ func (h *NovelHandler) CreateNovelDraft(w http.ResponseWriter, r *http.Request)
 	// Генерируем конфигурацию новеллы и сохраняем как черновик
 	draftID, config, err := h.novelService.CreateDraft(r.Context(), userID, request)
 	if err != nil {
+		if respondQuotaExceeded(w, err) {
+			return
+		}
 		log.Printf("Error creating novel draft: %v", err)
 		respondWithError(w, http.StatusInternalServerError, "Failed to create novel draft")
 		return
@@ -104,6 +109,10 @@ func (h *NovelHandler) ConfirmNovelDraft(w http.ResponseWriter, r *http.Request)
 	// Вызываем сервис для подтверждения черновика
 	novelID, err := h.novelService.ConfirmDraft(r.Context(), userID, request.DraftID)
 	if err != nil {
+		if errors.Is(err, service.ErrDraftNotFound) {
+			respondWithError(w, http.StatusNotFound, "Draft not found")
+			return
+		}
 		log.Printf("Error confirming draft: %v", err)
 		respondWithError(w, http.StatusInternalServerError, "Failed to confirm novel draft")
 		return
@@ -163,6 +172,13 @@ func (h *NovelHandler) RefineNovelDraft(w http.ResponseWriter, r *http.Request)
 	// Вызываем сервис для уточнения черновика
 	updatedConfig, err := h.novelService.RefineDraft(r.Context(), userID, request.DraftID, request.AdditionalPrompt)
 	if err != nil {
+		if errors.Is(err, service.ErrDraftNotFound) {
+			respondWithError(w, http.StatusNotFound, "Draft not found")
+			return
+		}
+		if respondQuotaExceeded(w, err) {
+			return
+		}
 		log.Printf("Error refining draft: %v", err)
 		respondWithError(w, http.StatusInternalServerError, "Failed to refine novel draft")
 		return
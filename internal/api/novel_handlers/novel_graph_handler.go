@@ -0,0 +1,51 @@
+package novel_handlers
+
+import (
+	"errors"
+	"net/http"
+	"novel-server/internal/auth"
+	"novel-server/internal/logger"
+	"novel-server/internal/service"
+)
+
+// GetStoryGraph возвращает граф ветвлений новеллы в формате JSON или Graphviz DOT.
+// GET /novels/{id}/graph?format=json|dot
+func (h *NovelHandler) GetStoryGraph(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(auth.UserIDKey).(string)
+	if !ok || userID == "" {
+		respondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+	novelID, ok := novelIDFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "json"
+	}
+	if format != "json" && format != "dot" {
+		respondWithError(w, http.StatusBadRequest, "format must be json or dot")
+		return
+	}
+
+	graph, err := h.novelService.GetStoryGraph(r.Context(), userID, novelID)
+	if err != nil {
+		if errors.Is(err, service.ErrNovelNotFound) {
+			respondWithError(w, http.StatusNotFound, "Novel not found")
+			return
+		}
+		logger.Logger.Error("GetStoryGraph: error building story graph", "err", err, "novelID", novelID)
+		respondWithError(w, http.StatusInternalServerError, "Failed to build story graph")
+		return
+	}
+
+	if format == "dot" {
+		w.Header().Set("Content-Type", "text/vnd.graphviz; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(graph.DOT()))
+		return
+	}
+	respondWithJSON(w, http.StatusOK, graph)
+}
@@ -1,15 +1,18 @@
 package novel_handlers
 
 import (
+	"errors"
 	"net/http"
 	"novel-server/internal/domain"
 	"novel-server/internal/logger"
+	"novel-server/internal/repository"
+	"novel-server/internal/service"
 	"strconv"
 
 	"github.com/google/uuid"
 )
 
-// ListNovels обрабатывает запрос на получение списка всех новелл с пагинацией
+// ListNovels обрабатывает запрос на получение списка новелл пользователя с пагинацией
 func (h *NovelHandler) ListNovels(w http.ResponseWriter, r *http.Request) {
 	// Проверяем метод запроса
 	if r.Method != http.MethodGet {
@@ -40,15 +43,24 @@ func (h *NovelHandler) ListNovels(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	// Формируем запрос
+	// Формируем запрос. scope: mine (по умолчанию), public или all (для модераторов)
 	request := domain.ListNovelsRequest{
 		Limit:  limit,
 		Cursor: cursor,
+		Scope:  query.Get("scope"),
 	}
 
 	// Получаем список новелл
 	response, err := h.novelService.ListNovels(r.Context(), request)
 	if err != nil {
+		if errors.Is(err, service.ErrPermissionDenied) {
+			respondWithError(w, http.StatusForbidden, "Only moderators can list novels of all users")
+			return
+		}
+		if errors.Is(err, service.ErrInvalidNovelScope) {
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
 		logger.Logger.Error("ListNovels: error listing novels", "err", err)
 		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve novels list")
 		return
@@ -89,7 +101,7 @@ func (h *NovelHandler) GetNovelDetails(w http.ResponseWriter, r *http.Request) {
 		logger.Logger.Error("GetNovelDetails: error getting details", "err", err)
 
 		// Обрабатываем различные ошибки
-		if err.Error() == "novel not found" {
+		if errors.Is(err, service.ErrNovelNotFound) || errors.Is(err, repository.ErrNotFound) {
 			respondWithError(w, http.StatusNotFound, "Novel not found")
 			return
 		}
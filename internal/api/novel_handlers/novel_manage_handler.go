@@ -0,0 +1,98 @@
+package novel_handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"novel-server/internal/auth"
+	"novel-server/internal/logger"
+	"novel-server/internal/service"
+)
+
+// respondNovelManageError переводит ошибки редактирования и удаления новеллы в HTTP-статусы
+func respondNovelManageError(w http.ResponseWriter, err error, action string) {
+	switch {
+	case errors.Is(err, service.ErrNovelNotFound):
+		respondWithError(w, http.StatusNotFound, "Novel not found")
+	case errors.Is(err, service.ErrNoProgress):
+		respondWithError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, service.ErrPermissionDenied):
+		respondWithError(w, http.StatusForbidden, "Only the owner can "+action)
+	case errors.Is(err, service.ErrInvalidNovelUpdate):
+		respondWithError(w, http.StatusBadRequest, err.Error())
+	default:
+		logger.Logger.Error("Novel: request failed", "action", action, "err", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to "+action)
+	}
+}
+
+// UpdateNovel меняет название и (или) краткое описание новеллы.
+// PATCH /novels/{id}, тело: {"title": "...", "short_description": "..."} (любое из полей)
+func (h *NovelHandler) UpdateNovel(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(auth.UserIDKey).(string)
+	if !ok || userID == "" {
+		respondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+	novelID, ok := novelIDFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	var request struct {
+		Title            *string `json:"title"`
+		ShortDescription *string `json:"short_description"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request format")
+		return
+	}
+	defer r.Body.Close()
+
+	meta, err := h.novelService.UpdateNovel(r.Context(), userID, novelID, request.Title, request.ShortDescription)
+	if err != nil {
+		respondNovelManageError(w, err, "update novel")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, meta)
+}
+
+// DeleteNovel удаляет новеллу текущего пользователя вместе с прогрессом и сохранениями всех игроков.
+// DELETE /novels/{id}
+func (h *NovelHandler) DeleteNovel(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(auth.UserIDKey).(string)
+	if !ok || userID == "" {
+		respondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+	novelID, ok := novelIDFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.novelService.DeleteNovel(r.Context(), userID, novelID); err != nil {
+		respondNovelManageError(w, err, "delete novel")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// DeleteProgress удаляет прохождение текущего пользователя в новелле.
+// DELETE /novels/{id}/progress
+func (h *NovelHandler) DeleteProgress(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(auth.UserIDKey).(string)
+	if !ok || userID == "" {
+		respondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+	novelID, ok := novelIDFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.novelService.DeleteProgress(r.Context(), userID, novelID); err != nil {
+		respondNovelManageError(w, err, "delete progress")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
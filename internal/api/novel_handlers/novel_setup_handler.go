@@ -0,0 +1,99 @@
+package novel_handlers
+
+import (
+	"errors"
+	"net/http"
+	"novel-server/internal/auth"
+	"novel-server/internal/logger"
+	"novel-server/internal/service"
+
+	"github.com/google/uuid"
+)
+
+// novelIDFromPath извлекает ID новеллы из шаблона маршрута {id}.
+// При ошибке сам отвечает клиенту и возвращает false.
+func novelIDFromPath(w http.ResponseWriter, r *http.Request) (uuid.UUID, bool) {
+	novelID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid novel id format")
+		return uuid.Nil, false
+	}
+	return novelID, true
+}
+
+// GetSetupStatus возвращает состояние генерации сетапа новеллы.
+// GET /novels/{id}/setup-status
+func (h *NovelHandler) GetSetupStatus(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(auth.UserIDKey).(string)
+	if !ok || userID == "" {
+		respondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+	novelID, ok := novelIDFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	job, err := h.novelService.GetSetupStatus(r.Context(), userID, novelID)
+	if err != nil {
+		if errors.Is(err, service.ErrSetupJobNotFound) {
+			respondWithError(w, http.StatusNotFound, "Setup job not found")
+			return
+		}
+		logger.Logger.Error("GetSetupStatus: error getting setup status", "err", err, "novelID", novelID)
+		respondWithError(w, http.StatusInternalServerError, "Failed to get setup status")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, job)
+}
+
+// RetrySetup перезапускает упавшую генерацию сетапа новеллы.
+// POST /novels/{id}/setup-retry
+func (h *NovelHandler) RetrySetup(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(auth.UserIDKey).(string)
+	if !ok || userID == "" {
+		respondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+	novelID, ok := novelIDFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	job, err := h.novelService.RetrySetup(r.Context(), userID, novelID)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrSetupJobNotFound):
+			respondWithError(w, http.StatusNotFound, "Setup job not found")
+		case errors.Is(err, service.ErrSetupNotRetryable):
+			respondWithError(w, http.StatusConflict, err.Error())
+		default:
+			logger.Logger.Error("RetrySetup: error retrying setup", "err", err, "novelID", novelID)
+			respondWithError(w, http.StatusInternalServerError, "Failed to retry setup")
+		}
+		return
+	}
+
+	respondWithJSON(w, http.StatusAccepted, job)
+}
+
+// ListSetupJobs возвращает незавершенные задачи сетапа текущего пользователя,
+// чтобы новеллы с упавшим сетапом не терялись из списка.
+// GET /setup-jobs
+func (h *NovelHandler) ListSetupJobs(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(auth.UserIDKey).(string)
+	if !ok || userID == "" {
+		respondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	jobs, err := h.novelService.ListSetupJobs(r.Context(), userID)
+	if err != nil {
+		logger.Logger.Error("ListSetupJobs: error listing setup jobs", "err", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to list setup jobs")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{"jobs": jobs})
+}
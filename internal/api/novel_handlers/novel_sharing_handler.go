@@ -0,0 +1,117 @@
+package novel_handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"novel-server/internal/auth"
+	"novel-server/internal/logger"
+	"novel-server/internal/service"
+)
+
+// respondSharingError переводит ошибки видимости и ссылок в HTTP-статусы
+func respondSharingError(w http.ResponseWriter, err error, action string) {
+	switch {
+	case errors.Is(err, service.ErrNovelNotFound):
+		respondWithError(w, http.StatusNotFound, "Novel not found")
+	case errors.Is(err, service.ErrShareLinkNotFound):
+		respondWithError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, service.ErrPermissionDenied):
+		respondWithError(w, http.StatusForbidden, "Only the owner can change sharing settings")
+	case errors.Is(err, service.ErrInvalidVisibility):
+		respondWithError(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, service.ErrNovelPrivate):
+		respondWithError(w, http.StatusConflict, err.Error())
+	default:
+		logger.Logger.Error("Sharing: request failed", "action", action, "err", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to "+action)
+	}
+}
+
+// SetNovelVisibility меняет видимость новеллы.
+// PUT /novels/{id}/visibility, тело: {"visibility": "private|unlisted|public"}
+func (h *NovelHandler) SetNovelVisibility(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(auth.UserIDKey).(string)
+	if !ok || userID == "" {
+		respondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+	novelID, ok := novelIDFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Visibility string `json:"visibility"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request format. Expected {'visibility': 'string'}")
+		return
+	}
+	defer r.Body.Close()
+
+	if err := h.novelService.SetNovelVisibility(r.Context(), userID, novelID, req.Visibility); err != nil {
+		respondSharingError(w, err, "set visibility")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]string{"novel_id": novelID.String(), "visibility": req.Visibility})
+}
+
+// CreateShareLink создает ссылку на новеллу (прежняя ссылка перестает работать).
+// POST /novels/{id}/share-link
+func (h *NovelHandler) CreateShareLink(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(auth.UserIDKey).(string)
+	if !ok || userID == "" {
+		respondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+	novelID, ok := novelIDFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	link, err := h.novelService.CreateShareLink(r.Context(), userID, novelID)
+	if err != nil {
+		respondSharingError(w, err, "create share link")
+		return
+	}
+	respondWithJSON(w, http.StatusCreated, link)
+}
+
+// DeleteShareLink отключает ссылку на новеллу и отзывает доступ открывших ее.
+// DELETE /novels/{id}/share-link
+func (h *NovelHandler) DeleteShareLink(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(auth.UserIDKey).(string)
+	if !ok || userID == "" {
+		respondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+	novelID, ok := novelIDFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.novelService.DeleteShareLink(r.Context(), userID, novelID); err != nil {
+		respondSharingError(w, err, "delete share link")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// OpenShareLink открывает ссылку на новеллу и возвращает ее детали.
+// После этого новеллу можно проходить по novel_id.
+// GET /shared/{token}
+func (h *NovelHandler) OpenShareLink(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(auth.UserIDKey).(string)
+	if !ok || userID == "" {
+		respondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	details, err := h.novelService.OpenShareLink(r.Context(), userID, r.PathValue("token"))
+	if err != nil {
+		respondSharingError(w, err, "open share link")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, details)
+}
@@ -0,0 +1,118 @@
+package novel_handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"novel-server/internal/auth"
+	"novel-server/internal/domain"
+	"novel-server/internal/logger"
+	"novel-server/internal/service"
+	"strconv"
+
+	"github.com/google/uuid"
+)
+
+// sseWriter пишет сообщения Server-Sent Events и сразу отправляет их клиенту.
+type sseWriter struct {
+	w       http.ResponseWriter
+	flusher http.Flusher
+	nextID  int
+}
+
+// send отправляет одно SSE-сообщение с JSON-данными.
+func (s *sseWriter) send(event string, payload interface{}) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal SSE payload: %w", err)
+	}
+	s.nextID++
+	if _, err := fmt.Fprintf(s.w, "id: %d\nevent: %s\ndata: %s\n\n", s.nextID, event, data); err != nil {
+		return err
+	}
+	s.flusher.Flush()
+	return nil
+}
+
+// GenerateNovelContentStream генерирует следующую сцену и отдает ее по мере генерации через SSE.
+//
+// GET /generate-novel-content/stream?novel_id=...&choice_text=...&scene_index=...
+//
+// Сообщения:
+//   - scene_event: очередное событие сцены (SimplifiedEvent), как только модель его дописала;
+//   - complete: итоговый SimplifiedNovelContentResponse, после него поток закрывается;
+//   - error: генерация не удалась, поток закрывается.
+func (h *NovelHandler) GenerateNovelContentStream(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondWithError(w, http.StatusMethodNotAllowed, "Only GET method is allowed")
+		return
+	}
+
+	userID, ok := r.Context().Value(auth.UserIDKey).(string)
+	if !ok || userID == "" {
+		logger.Logger.Error("GenerateNovelContentStream: userID not found in context")
+		respondWithError(w, http.StatusInternalServerError, "Internal server error: User ID missing")
+		return
+	}
+
+	query := r.URL.Query()
+	novelID, err := uuid.Parse(query.Get("novel_id"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "novel_id is required and must be a valid UUID")
+		return
+	}
+
+	request := domain.NovelContentRequest{
+		NovelID: novelID,
+		UserID:  userID,
+	}
+	if choiceText := query.Get("choice_text"); choiceText != "" {
+		userChoice := &domain.UserChoice{ChoiceText: choiceText}
+		if sceneIndexStr := query.Get("scene_index"); sceneIndexStr != "" {
+			sceneIndex, err := strconv.Atoi(sceneIndexStr)
+			if err != nil || sceneIndex < 0 {
+				respondWithError(w, http.StatusBadRequest, "Invalid scene_index value")
+				return
+			}
+			userChoice.SceneIndex = sceneIndex
+		}
+		request.UserChoice = userChoice
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		respondWithError(w, http.StatusInternalServerError, "Streaming is not supported")
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no") // Отключаем буферизацию в nginx
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	sse := &sseWriter{w: w, flusher: flusher}
+	logger.Logger.Info("GenerateNovelContentStream: streaming started", "userID", userID, "novelID", novelID)
+
+	fullResponse, err := h.novelContentService.GenerateNovelContentStream(r.Context(), request, func(event domain.Event, state *domain.NovelState) error {
+		return sse.send("scene_event", domain.SimplifyEvent(event, state))
+	})
+	if err != nil {
+		logger.Logger.Error("Error streaming novel content", "err", err, "novelID", novelID)
+		if r.Context().Err() == nil {
+			message := "Failed to generate novel content"
+			if errors.Is(err, service.ErrChoiceLocked) || errors.Is(err, service.ErrSceneNotPlayed) || errors.Is(err, service.ErrNovelNotFound) ||
+				errors.Is(err, service.ErrQuotaExceeded) {
+				message = err.Error()
+			}
+			sse.send("error", map[string]string{"error": message})
+		}
+		return
+	}
+
+	if err := sse.send("complete", createSimplifiedResponse(fullResponse)); err != nil {
+		logger.Logger.Warn("GenerateNovelContentStream: failed to send final message", "err", err)
+	}
+}
@@ -0,0 +1,68 @@
+package novel_handlers
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"novel-server/internal/auth"
+	"novel-server/internal/logger"
+	"novel-server/internal/service"
+	"strconv"
+)
+
+// QuotaMiddleware проверяет квоту kind (domain.Quota*) перед вызовом next, а списывает запрос
+// сам сервис, когда действительно обращается к модели (service.QuotaService.WithCharge).
+// Поэтому некорректные запросы, недоступные новеллы и сцены из кеша квоту не расходуют.
+// Должен стоять после AuthMiddleware. Если квота исчерпана, отвечает 429 с заголовком Retry-After.
+func (h *NovelHandler) QuotaMiddleware(kind string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := r.Context().Value(auth.UserIDKey).(string)
+		if !ok || userID == "" {
+			respondWithError(w, http.StatusUnauthorized, "User not authenticated")
+			return
+		}
+
+		if err := h.quotaService.Check(r.Context(), userID, kind); err != nil {
+			if respondQuotaExceeded(w, err) {
+				return
+			}
+			logger.Logger.Error("QuotaMiddleware: error checking quota", "err", err, "kind", kind, "userID", userID)
+			respondWithError(w, http.StatusInternalServerError, "Failed to check quota")
+			return
+		}
+
+		next(w, r.WithContext(h.quotaService.WithCharge(r.Context(), userID, kind)))
+	}
+}
+
+// respondQuotaExceeded отвечает 429 с заголовком Retry-After, если err - исчерпанная квота.
+// Возвращает false, если err другая и ответ не отправлен.
+func respondQuotaExceeded(w http.ResponseWriter, err error) bool {
+	var quotaErr *service.QuotaExceededError
+	if !errors.As(err, &quotaErr) {
+		return false
+	}
+	retryAfter := int(math.Ceil(quotaErr.RetryAfter.Seconds()))
+	w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+	respondWithError(w, http.StatusTooManyRequests, quotaErr.Error())
+	return true
+}
+
+// GetQuota возвращает использование и остаток квот текущего пользователя.
+// GET /me/quota
+func (h *NovelHandler) GetQuota(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(auth.UserIDKey).(string)
+	if !ok || userID == "" {
+		respondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	status, err := h.quotaService.Status(r.Context(), userID)
+	if err != nil {
+		logger.Logger.Error("GetQuota: error getting quota status", "err", err, "userID", userID)
+		respondWithError(w, http.StatusInternalServerError, "Failed to get quota")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, status)
+}
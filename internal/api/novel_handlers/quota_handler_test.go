@@ -0,0 +1,49 @@
+package novel_handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"novel-server/internal/auth"
+	"novel-server/internal/config"
+	"novel-server/internal/domain"
+	"novel-server/internal/repository"
+	"novel-server/internal/service"
+	"testing"
+)
+
+func TestQuotaMiddleware(t *testing.T) {
+	quotas := service.NewQuotaService(repository.NewMemoryQuotaRepository(), repository.NewMemoryUsageRepository(),
+		config.QuotaConfig{ScenesPerHour: 1})
+	h := &NovelHandler{quotaService: quotas}
+	const userID = "player"
+
+	serveQuota := func(next http.HandlerFunc) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/generate-novel-content", nil)
+		req = req.WithContext(context.WithValue(req.Context(), auth.UserIDKey, userID))
+		rec := httptest.NewRecorder()
+		h.QuotaMiddleware(domain.QuotaScenes, next)(rec, req)
+		return rec
+	}
+
+	// Ответ без генерации квоту не расходует, сколько бы раз его ни запрашивали
+	for range 3 {
+		rec := serveQuota(func(w http.ResponseWriter, r *http.Request) {
+			respondWithError(w, http.StatusBadRequest, "Invalid request format")
+		})
+		if rec.Code != http.StatusBadRequest {
+			t.Fatalf("status = %d, want %d", rec.Code, http.StatusBadRequest)
+		}
+	}
+
+	// Исчерпанная квота отклоняется до вызова обработчика
+	if err := quotas.Consume(context.Background(), userID, domain.QuotaScenes); err != nil {
+		t.Fatalf("Consume: %v", err)
+	}
+	called := false
+	rec := serveQuota(func(w http.ResponseWriter, r *http.Request) { called = true })
+	if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") == "" || called {
+		t.Fatalf("status = %d, Retry-After %q, handler called %v; want 429 before the handler",
+			rec.Code, rec.Header().Get("Retry-After"), called)
+	}
+}
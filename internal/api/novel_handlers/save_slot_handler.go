@@ -0,0 +1,151 @@
+package novel_handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"novel-server/internal/auth"
+	"novel-server/internal/logger"
+	"novel-server/internal/service"
+
+	"github.com/google/uuid"
+)
+
+// slotIDFromPath извлекает ID сохранения из шаблона маршрута {slot}.
+// При ошибке сам отвечает клиенту и возвращает false.
+func slotIDFromPath(w http.ResponseWriter, r *http.Request) (uuid.UUID, bool) {
+	slotID, err := uuid.Parse(r.PathValue("slot"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid save slot id format")
+		return uuid.Nil, false
+	}
+	return slotID, true
+}
+
+// CreateSaveSlot сохраняет текущее прохождение в именованный слот.
+// POST /novels/{id}/saves
+func (h *NovelHandler) CreateSaveSlot(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(auth.UserIDKey).(string)
+	if !ok || userID == "" {
+		respondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+	novelID, ok := novelIDFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	var request struct {
+		Name string `json:"name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request format")
+		return
+	}
+	defer r.Body.Close()
+
+	slot, err := h.novelService.CreateSaveSlot(r.Context(), userID, novelID, request.Name)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidSaveSlotName):
+			respondWithError(w, http.StatusBadRequest, err.Error())
+		case errors.Is(err, service.ErrNothingToSave):
+			respondWithError(w, http.StatusConflict, "Novel has not been started yet")
+		default:
+			logger.Logger.Error("CreateSaveSlot: error saving slot", "err", err, "novelID", novelID)
+			respondWithError(w, http.StatusInternalServerError, "Failed to save progress")
+		}
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, slot)
+}
+
+// ListSaveSlots возвращает сохранения текущего пользователя в новелле.
+// GET /novels/{id}/saves
+func (h *NovelHandler) ListSaveSlots(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(auth.UserIDKey).(string)
+	if !ok || userID == "" {
+		respondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+	novelID, ok := novelIDFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	slots, err := h.novelService.ListSaveSlots(r.Context(), userID, novelID)
+	if err != nil {
+		logger.Logger.Error("ListSaveSlots: error listing save slots", "err", err, "novelID", novelID)
+		respondWithError(w, http.StatusInternalServerError, "Failed to list save slots")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{"saves": slots})
+}
+
+// LoadSaveSlot делает сохранение текущим прохождением и возвращает сохраненную сцену.
+// POST /novels/{id}/saves/{slot}/load
+func (h *NovelHandler) LoadSaveSlot(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(auth.UserIDKey).(string)
+	if !ok || userID == "" {
+		respondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+	novelID, ok := novelIDFromPath(w, r)
+	if !ok {
+		return
+	}
+	slotID, ok := slotIDFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	fullResponse, err := h.novelService.LoadSaveSlot(r.Context(), userID, novelID, slotID)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrSaveSlotNotFound):
+			respondWithError(w, http.StatusNotFound, "Save slot not found")
+		case errors.Is(err, service.ErrSceneNotPlayed):
+			respondWithError(w, http.StatusNotFound, err.Error())
+		case errors.Is(err, service.ErrNovelNotFound):
+			respondWithError(w, http.StatusNotFound, "Novel not found")
+		default:
+			logger.Logger.Error("LoadSaveSlot: error loading save slot", "err", err, "novelID", novelID, "slotID", slotID)
+			respondWithError(w, http.StatusInternalServerError, "Failed to load save slot")
+		}
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, createSimplifiedResponse(fullResponse))
+}
+
+// DeleteSaveSlot удаляет сохранение.
+// DELETE /novels/{id}/saves/{slot}
+func (h *NovelHandler) DeleteSaveSlot(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(auth.UserIDKey).(string)
+	if !ok || userID == "" {
+		respondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+	novelID, ok := novelIDFromPath(w, r)
+	if !ok {
+		return
+	}
+	slotID, ok := slotIDFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.novelService.DeleteSaveSlot(r.Context(), userID, novelID, slotID); err != nil {
+		if errors.Is(err, service.ErrSaveSlotNotFound) {
+			respondWithError(w, http.StatusNotFound, "Save slot not found")
+			return
+		}
+		logger.Logger.Error("DeleteSaveSlot: error deleting save slot", "err", err, "novelID", novelID, "slotID", slotID)
+		respondWithError(w, http.StatusInternalServerError, "Failed to delete save slot")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
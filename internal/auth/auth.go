@@ -13,10 +13,14 @@ import (
 
 var jwtSecret []byte
 var jwtExpiration time.Duration
+var refreshTokenTTL time.Duration
 
 // CustomClaims определяет пользовательские данные, которые мы хотим хранить в токене.
+// UserID - ID учетной записи из таблицы users (он же Subject), Role - domain.Role*.
 type CustomClaims struct {
-	UserID string `json:"user_id"`
+	UserID   string `json:"user_id"`
+	Username string `json:"username"`
+	Role     string `json:"role"`
 	jwt.RegisteredClaims
 }
 
@@ -27,6 +31,9 @@ type contextKey string
 // UserIDKey - ключ для хранения ID пользователя в контексте (экспортируемый).
 const UserIDKey = contextKey("userID")
 
+// RoleKey - ключ для хранения роли пользователя в контексте.
+const RoleKey = contextKey("role")
+
 // --- Конец ключа контекста ---
 
 // InitJWT инициализирует параметры JWT из переменных окружения.
@@ -37,29 +44,54 @@ func InitJWT() error {
 	}
 	jwtSecret = []byte(secret)
 
+	// Access-токен короткоживущий: он не отзывается, поэтому после logout действует до истечения срока
 	expMinutesStr := os.Getenv("JWT_EXPIRATION_MINUTES")
 	if expMinutesStr == "" {
-		expMinutesStr = "60" // Default to 60 minutes
+		expMinutesStr = "15" // Default to 15 minutes
 	}
 	expMinutes, err := strconv.Atoi(expMinutesStr)
 	if err != nil {
 		return fmt.Errorf("invalid JWT_EXPIRATION_MINUTES value: %w", err)
 	}
 	jwtExpiration = time.Duration(expMinutes) * time.Minute
-	log.Printf("JWT initialized with expiration: %v", jwtExpiration)
+
+	refreshHoursStr := os.Getenv("REFRESH_TOKEN_TTL_HOURS")
+	if refreshHoursStr == "" {
+		refreshHoursStr = "720" // Default to 30 days
+	}
+	refreshHours, err := strconv.Atoi(refreshHoursStr)
+	if err != nil {
+		return fmt.Errorf("invalid REFRESH_TOKEN_TTL_HOURS value: %w", err)
+	}
+	refreshTokenTTL = time.Duration(refreshHours) * time.Hour
+	log.Printf("JWT initialized with expiration: %v, refresh token TTL: %v", jwtExpiration, refreshTokenTTL)
 	return nil
 }
 
-// GenerateToken создает новый JWT для указанного UserID.
-func GenerateToken(userID string) (string, error) {
+// AccessTokenTTL возвращает срок действия access-токена.
+func AccessTokenTTL() time.Duration {
+	return jwtExpiration
+}
+
+// RefreshTokenTTL возвращает срок действия refresh-токена.
+func RefreshTokenTTL() time.Duration {
+	return refreshTokenTTL
+}
+
+// GenerateToken создает новый access-токен (JWT) для учетной записи.
+// Роль попадает в токен, поэтому ее изменение вступает в силу после обновления токена.
+func GenerateToken(userID, username, role string) (string, error) {
 	if len(jwtSecret) == 0 {
 		return "", errors.New("JWT secret not initialized")
 	}
 
 	expirationTime := time.Now().Add(jwtExpiration)
 	claims := &CustomClaims{
-		UserID: userID,
+		UserID:   userID,
+		Username: username,
+		Role:     role,
 		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   userID,
 			ExpiresAt: jwt.NewNumericDate(expirationTime),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 			Issuer:    "novel-server", // Можно добавить
@@ -0,0 +1,51 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// dummyPasswordHash сравнивается с паролем, когда пользователь не найден,
+// чтобы время ответа не выдавало существование логина
+var dummyPasswordHash, _ = bcrypt.GenerateFromPassword([]byte("novel-server-dummy-password"), bcrypt.DefaultCost)
+
+// HashPassword возвращает bcrypt-хеш пароля.
+func HashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", fmt.Errorf("failed to hash password: %w", err)
+	}
+	return string(hash), nil
+}
+
+// CheckPassword сообщает, соответствует ли пароль bcrypt-хешу.
+// Пустой hash означает "пользователь не найден": сравнение все равно выполняется и возвращает false.
+func CheckPassword(hash, password string) bool {
+	if hash == "" {
+		bcrypt.CompareHashAndPassword(dummyPasswordHash, []byte(password))
+		return false
+	}
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+}
+
+// NewRefreshToken создает случайный refresh-токен. Клиенту отдается token,
+// а в базе хранится только его хеш (см. HashRefreshToken).
+func NewRefreshToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate refresh token: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// HashRefreshToken возвращает SHA-256 refresh-токена в hex. Токен случайный и длинный,
+// поэтому медленный хеш не нужен.
+func HashRefreshToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -4,15 +4,20 @@ import (
 	"fmt"
 	"os"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 )
 
 // Config содержит все конфигурационные параметры приложения
 type Config struct {
-	Server   ServerConfig
-	API      APIConfig
-	DeepSeek DeepSeekConfig
+	Server  ServerConfig
+	API     APIConfig
+	LLM     LLMConfig
+	Setup   SetupConfig
+	Prompts PromptsConfig
+	Quota   QuotaConfig
 }
 
 // ServerConfig содержит настройки HTTP сервера
@@ -26,10 +31,57 @@ type APIConfig struct {
 	BasePath string
 }
 
-// DeepSeekConfig содержит настройки для работы с DeepSeek
-type DeepSeekConfig struct {
-	APIKey    string
-	ModelName string
+// LLMConfig содержит настройки провайдера языковой модели
+type LLMConfig struct {
+	Provider       string // openrouter, openai, llamacpp, ollama, scripted
+	BaseURL        string // Пустое значение - адрес провайдера по умолчанию
+	APIKey         string
+	ModelName      string
+	Timeout        time.Duration
+	FixturesDir    string                // Каталог с записанными ответами для провайдера scripted
+	RecordDir      string                // Если задан, все ответы модели записываются сюда для последующего воспроизведения
+	RepairAttempts int                   // Сколько раз просить модель исправить ответ, не прошедший проверку по JSON-схеме
+	Prices         map[string]ModelPrice // Цены моделей для учета стоимости; модели без цены считаются бесплатными
+	Retry          RetryConfig
+}
+
+// RetryConfig содержит политику повторов запросов к модели
+type RetryConfig struct {
+	MaxAttempts    int           // Попыток на каждую модель (1 - без повторов)
+	Backoff        time.Duration // Задержка перед первым повтором; удваивается с каждой попыткой
+	MaxBackoff     time.Duration // Верхняя граница задержки
+	RequestTimeout time.Duration // Ограничение времени одной попытки; 0 - только таймаут HTTP-клиента
+	FallbackModels []string      // Модели, которые пробуются по порядку, если основная недоступна
+}
+
+// ModelPrice - цена модели в долларах за миллион токенов
+type ModelPrice struct {
+	Prompt     float64
+	Completion float64
+}
+
+// SetupConfig содержит настройки очереди генерации сетапа новелл
+type SetupConfig struct {
+	Workers      int           // Количество воркеров
+	MaxAttempts  int           // Максимум попыток на задачу до статуса failed
+	RetryBackoff time.Duration // Базовая задержка перед повтором (удваивается с каждой попыткой)
+	JobTimeout   time.Duration // Ограничение времени одной попытки
+	PollInterval time.Duration // Как часто воркеры проверяют очередь
+	StaleAfter   time.Duration // Через сколько задача в running считается зависшей
+}
+
+// PromptsConfig содержит настройки реестра шаблонов промптов
+type PromptsConfig struct {
+	Dir            string            // Каталог с шаблонами <name>/<version>.md
+	Versions       map[string]string // Закрепленные версии промптов (name -> version); остальные - последняя версия
+	ReloadInterval time.Duration     // Как часто проверять изменения файлов; 0 - не перезагружать
+}
+
+// QuotaConfig содержит лимиты генерации на пользователя; 0 - без ограничения
+type QuotaConfig struct {
+	DraftsPerDay   int   // Создание и уточнение черновиков в сутки (UTC)
+	ScenesPerHour  int   // Запросы генерации сетапа и сцен в час
+	TokensPerMonth int64 // Токены модели в календарный месяц (UTC)
 }
 
 // LoadConfig загружает конфигурацию из переменных окружения
@@ -49,20 +101,132 @@ func LoadConfig() (*Config, error) {
 		API: APIConfig{
 			BasePath: getEnv("API_BASE_PATH", "/api"),
 		},
-		DeepSeek: DeepSeekConfig{
-			APIKey:    getEnv("OPENROUTER_API_KEY", ""),
-			ModelName: getEnv("DEEPSEEK_MODEL", "deepseek/deepseek-chat-v3-0324:free"),
+		LLM: LLMConfig{
+			Provider: strings.ToLower(getEnv("LLM_PROVIDER", "openrouter")),
+			BaseURL:  getEnv("LLM_BASE_URL", ""),
+			// Старые переменные OPENROUTER_API_KEY и DEEPSEEK_MODEL поддерживаются для совместимости
+			APIKey:         getEnv("LLM_API_KEY", getEnv("OPENROUTER_API_KEY", "")),
+			ModelName:      getEnv("LLM_MODEL", getEnv("DEEPSEEK_MODEL", "deepseek/deepseek-chat-v3-0324:free")),
+			Timeout:        time.Duration(getEnvAsInt("LLM_TIMEOUT_SECONDS", 300)) * time.Second,
+			FixturesDir:    getEnv("LLM_FIXTURES_DIR", "testdata/llm"),
+			RecordDir:      getEnv("LLM_RECORD_DIR", ""),
+			RepairAttempts: getEnvAsInt("LLM_REPAIR_ATTEMPTS", 2),
+			Retry: RetryConfig{
+				MaxAttempts:    getEnvAsInt("LLM_MAX_ATTEMPTS", 3),
+				Backoff:        time.Duration(getEnvAsInt("LLM_RETRY_BACKOFF_MS", 1000)) * time.Millisecond,
+				MaxBackoff:     time.Duration(getEnvAsInt("LLM_RETRY_MAX_BACKOFF_MS", 30000)) * time.Millisecond,
+				RequestTimeout: time.Duration(getEnvAsInt("LLM_REQUEST_TIMEOUT_SECONDS", 180)) * time.Second,
+				FallbackModels: splitList(getEnv("LLM_FALLBACK_MODELS", "")),
+			},
+		},
+		Setup: SetupConfig{
+			Workers:      getEnvAsInt("SETUP_WORKERS", 2),
+			MaxAttempts:  getEnvAsInt("SETUP_MAX_ATTEMPTS", 3),
+			RetryBackoff: time.Duration(getEnvAsInt("SETUP_RETRY_BACKOFF_SECONDS", 30)) * time.Second,
+			JobTimeout:   time.Duration(getEnvAsInt("SETUP_JOB_TIMEOUT_SECONDS", 600)) * time.Second,
+			PollInterval: time.Duration(getEnvAsInt("SETUP_POLL_INTERVAL_SECONDS", 5)) * time.Second,
+			StaleAfter:   time.Duration(getEnvAsInt("SETUP_STALE_AFTER_SECONDS", 900)) * time.Second,
 		},
+		Prompts: PromptsConfig{
+			Dir:            getEnv("PROMPTS_DIR", "promts"),
+			ReloadInterval: time.Duration(getEnvAsInt("PROMPTS_RELOAD_SECONDS", 5)) * time.Second,
+		},
+		Quota: QuotaConfig{
+			DraftsPerDay:   getEnvAsInt("QUOTA_DRAFTS_PER_DAY", 20),
+			ScenesPerHour:  getEnvAsInt("QUOTA_SCENES_PER_HOUR", 60),
+			TokensPerMonth: int64(getEnvAsInt("QUOTA_TOKENS_PER_MONTH", 0)),
+		},
+	}
+
+	// PROMPT_VERSIONS имеет вид "narrator=v1,novel_creator=v2"
+	versions, err := parsePromptVersions(getEnv("PROMPT_VERSIONS", ""))
+	if err != nil {
+		return nil, err
 	}
+	config.Prompts.Versions = versions
+
+	// LLM_PRICES имеет вид "model=prompt:completion;model=prompt:completion" (доллары за миллион токенов)
+	prices, err := parseModelPrices(getEnv("LLM_PRICES", ""))
+	if err != nil {
+		return nil, err
+	}
+	config.LLM.Prices = prices
 
 	// Проверка обязательных параметров
-	if config.DeepSeek.APIKey == "" {
-		return nil, fmt.Errorf("OPENROUTER_API_KEY is not set")
+	switch config.LLM.Provider {
+	case "openrouter", "openai":
+		if config.LLM.APIKey == "" {
+			return nil, fmt.Errorf("LLM_API_KEY (or OPENROUTER_API_KEY) is not set for provider %q", config.LLM.Provider)
+		}
+	case "llamacpp", "ollama", "scripted", "fake":
+		// Локальные серверы и записанные ответы не требуют ключа
+	default:
+		return nil, fmt.Errorf("unknown LLM_PROVIDER %q", config.LLM.Provider)
 	}
 
 	return config, nil
 }
 
+// parsePromptVersions разбирает список закрепленных версий промптов вида "name=version,name=version"
+func parsePromptVersions(value string) (map[string]string, error) {
+	versions := make(map[string]string)
+	for _, pair := range strings.Split(value, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		name, version, ok := strings.Cut(pair, "=")
+		name, version = strings.TrimSpace(name), strings.TrimSpace(version)
+		if !ok || name == "" || version == "" {
+			return nil, fmt.Errorf("invalid PROMPT_VERSIONS entry %q, expected name=version", pair)
+		}
+		versions[name] = version
+	}
+	return versions, nil
+}
+
+// parseModelPrices разбирает цены моделей вида "model=prompt:completion;model=prompt:completion".
+// Разделитель записей - ";", так как имена моделей OpenRouter содержат ":" и "/".
+func parseModelPrices(value string) (map[string]ModelPrice, error) {
+	prices := make(map[string]ModelPrice)
+	for _, entry := range strings.Split(value, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		idx := strings.LastIndex(entry, "=")
+		if idx <= 0 {
+			return nil, fmt.Errorf("invalid LLM_PRICES entry %q, expected model=prompt:completion", entry)
+		}
+		model, priceStr := strings.TrimSpace(entry[:idx]), strings.TrimSpace(entry[idx+1:])
+		promptStr, completionStr, ok := strings.Cut(priceStr, ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid LLM_PRICES entry %q, expected model=prompt:completion", entry)
+		}
+		prompt, err := strconv.ParseFloat(strings.TrimSpace(promptStr), 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid prompt price in LLM_PRICES entry %q: %w", entry, err)
+		}
+		completion, err := strconv.ParseFloat(strings.TrimSpace(completionStr), 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid completion price in LLM_PRICES entry %q: %w", entry, err)
+		}
+		prices[model] = ModelPrice{Prompt: prompt, Completion: completion}
+	}
+	return prices, nil
+}
+
+// splitList разбирает список через запятую, пропуская пустые элементы
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
 // getEnv возвращает значение переменной окружения или значение по умолчанию
 func getEnv(key, defaultValue string) string {
 	value := os.Getenv(key)
@@ -5,25 +5,38 @@ import (
 	"os"
 )
 
+// Драйверы базы данных (DATABASE_DRIVER)
+const (
+	DriverPostgres = "postgres"
+	DriverSQLite   = "sqlite"
+	DriverMemory   = "memory" // Данные в памяти процесса, теряются при перезапуске
+)
+
 // Config представляет конфигурацию подключения к базе данных
 type Config struct {
-	Host     string
-	Port     int
-	User     string
-	Password string
-	DBName   string
-	SSLMode  string
+	Driver     string
+	Host       string
+	Port       int
+	User       string
+	Password   string
+	DBName     string
+	SSLMode    string
+	SQLitePath string // Файл базы для драйвера sqlite
+
+	SkipMigrations bool // Не выполнять миграции при подключении (флаг сервера -skip-migrations)
 }
 
 // NewConfig создает новую конфигурацию из переменных окружения
 func NewConfig() *Config {
 	return &Config{
-		Host:     getEnvOrDefault("DATABASE_HOST", "localhost"),
-		Port:     getEnvAsIntOrDefault("DATABASE_PORT", 5432),
-		User:     getEnvOrDefault("DATABASE_USER", "postgres"),
-		Password: getEnvOrDefault("DATABASE_PASSWORD", "postgres"),
-		DBName:   getEnvOrDefault("DATABASE_NAME", "novel_db"),
-		SSLMode:  "disable", // В .env не указан, оставляем по умолчанию
+		Driver:     getEnvOrDefault("DATABASE_DRIVER", DriverPostgres),
+		Host:       getEnvOrDefault("DATABASE_HOST", "localhost"),
+		Port:       getEnvAsIntOrDefault("DATABASE_PORT", 5432),
+		User:       getEnvOrDefault("DATABASE_USER", "postgres"),
+		Password:   getEnvOrDefault("DATABASE_PASSWORD", "postgres"),
+		DBName:     getEnvOrDefault("DATABASE_NAME", "novel_db"),
+		SSLMode:    "disable", // В .env не указан, оставляем по умолчанию
+		SQLitePath: getEnvOrDefault("DATABASE_SQLITE_PATH", "novel.db"),
 	}
 }
 
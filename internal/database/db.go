@@ -5,31 +5,43 @@ import (
 	"fmt"
 	"novel-server/internal/logger"
 	"os"
-	"path/filepath"
 
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
-// InitDB инициализирует подключение к базе данных и выполняет миграции
-func InitDB(ctx context.Context) (*pgxpool.Pool, error) {
-	config := NewConfig()
-	logger.Logger.Info("Connecting to database", "host", config.Host, "port", config.Port)
+// ConnectDB создает пул соединений с PostgreSQL из cfg и проверяет соединение, без миграций
+func ConnectDB(ctx context.Context, cfg *Config) (*pgxpool.Pool, error) {
+	logger.Logger.Info("Connecting to database", "host", cfg.Host, "port", cfg.Port)
 
 	// Создаем пул соединений
-	db, err := pgxpool.New(ctx, config.ConnectionString())
+	db, err := pgxpool.New(ctx, cfg.ConnectionString())
 	if err != nil {
 		return nil, fmt.Errorf("failed to create connection pool: %w", err)
 	}
 
 	// Проверяем соединение
 	if err := db.Ping(ctx); err != nil {
+		db.Close()
 		return nil, fmt.Errorf("failed to ping database: %w", err)
 	}
 
 	logger.Logger.Info("Successfully connected to database")
+	return db, nil
+}
+
+// InitDB инициализирует подключение к базе данных и выполняет миграции, если они не отключены
+func InitDB(ctx context.Context, cfg *Config) (*pgxpool.Pool, error) {
+	db, err := ConnectDB(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
 
 	// Получаем путь к директории с миграциями
-	migrationsDir := filepath.Join("migrations")
+	migrationsDir := MigrationsDir(DriverPostgres)
+	if cfg.SkipMigrations {
+		logger.Logger.Warn("Automatic migrations are disabled; apply them with cmd/migrate", "dir", migrationsDir)
+		return db, nil
+	}
 	if _, err := os.Stat(migrationsDir); os.IsNotExist(err) {
 		logger.Logger.Warn("Migrations directory not found", "dir", migrationsDir)
 		return db, nil
@@ -37,6 +49,7 @@ func InitDB(ctx context.Context) (*pgxpool.Pool, error) {
 
 	// Выполняем миграции
 	if err := RunMigrations(ctx, db, migrationsDir); err != nil {
+		db.Close()
 		return nil, fmt.Errorf("failed to run migrations: %w", err)
 	}
 
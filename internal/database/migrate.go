@@ -2,107 +2,385 @@ package database
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"log"
 	"os"
 	"path/filepath"
+	"regexp"
 	"sort"
 	"strings"
+	"time"
 
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
+// Разделители частей файла миграции
+const (
+	migrateUpMarker   = "-- +migrate Up"
+	migrateDownMarker = "-- +migrate Down"
+)
+
+// MigrationsDir возвращает каталог миграций драйвера (DATABASE_DRIVER)
+func MigrationsDir(driver string) string {
+	if driver == DriverSQLite {
+		return sqliteMigrationsDir
+	}
+	return "migrations"
+}
+
 // Migration представляет информацию о миграции
 type Migration struct {
-	Version int
-	Up      string
-	Down    string
+	Version  int
+	Name     string // Имя файла без версии и расширения
+	Up       string
+	Down     string
+	Checksum string // SHA-256 содержимого файла
+}
+
+// MigrationStatus - состояние одной миграции для команды status
+type MigrationStatus struct {
+	Version   int
+	Name      string     // Пусто, если файла миграции нет
+	AppliedAt *time.Time // nil - миграция не применена
+	Modified  bool       // Файл изменился после применения миграции
+	Missing   bool       // Миграция применена, но ее файла нет
+}
+
+// appliedMigration - строка таблицы migrations
+type appliedMigration struct {
+	appliedAt time.Time
+	checksum  string // Пусто у миграций, примененных до появления контрольных сумм
+}
+
+// migrationStore - таблица migrations и выполнение миграций в конкретной базе данных
+type migrationStore interface {
+	// prepare создает таблицу migrations, а в старой таблице добавляет колонку checksum
+	prepare(ctx context.Context) error
+	applied(ctx context.Context) (map[int]appliedMigration, error)
+	// apply выполняет Up-часть миграции и отмечает ее примененной в одной транзакции
+	apply(ctx context.Context, m Migration) error
+	// revert выполняет Down-часть миграции и снимает отметку в одной транзакции
+	revert(ctx context.Context, m Migration) error
+	setChecksum(ctx context.Context, version int, checksum string) error
+}
+
+// Migrator применяет и откатывает миграции из каталога. Каждая миграция выполняется
+// в своей транзакции, поэтому ошибка не оставляет ее примененной наполовину.
+//
+// Контрольная сумма файла сохраняется при применении миграции. Если файл примененной
+// миграции потом изменился, up, down и redo отказываются работать, пока не задан AllowModified:
+// измененная Down-часть может не соответствовать тому, что было применено.
+type Migrator struct {
+	store migrationStore
+	dir   string
+
+	AllowModified bool
+}
+
+// NewPostgresMigrator создает Migrator для PostgreSQL
+func NewPostgresMigrator(db *pgxpool.Pool, migrationsDir string) *Migrator {
+	return &Migrator{store: &postgresMigrationStore{db: db}, dir: migrationsDir}
 }
 
 // RunMigrations выполняет все миграции из указанной директории
 func RunMigrations(ctx context.Context, db *pgxpool.Pool, migrationsDir string) error {
 	log.Printf("[DB] Starting migrations from directory: %s", migrationsDir)
+	_, err := NewPostgresMigrator(db, migrationsDir).Up(ctx)
+	return err
+}
+
+// migrationSet - файлы миграций и уже примененные миграции
+type migrationSet struct {
+	files    []Migration
+	applied  map[int]appliedMigration
+	modified []int // Версии примененных миграций, файлы которых изменились
+}
 
-	// Создаем таблицу для отслеживания миграций, если её нет
-	if err := createMigrationsTable(ctx, db); err != nil {
-		return fmt.Errorf("failed to create migrations table: %w", err)
+// file возвращает миграцию версии version из каталога
+func (s *migrationSet) file(version int) (Migration, bool) {
+	for _, m := range s.files {
+		if m.Version == version {
+			return m, true
+		}
 	}
+	return Migration{}, false
+}
 
-	// Получаем список выполненных миграций
-	applied, err := getAppliedMigrations(ctx, db)
-	if err != nil {
-		return fmt.Errorf("failed to get applied migrations: %w", err)
+// appliedDesc возвращает версии примененных миграций, последние первыми
+func (s *migrationSet) appliedDesc() []int {
+	versions := make([]int, 0, len(s.applied))
+	for version := range s.applied {
+		versions = append(versions, version)
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(versions)))
+	return versions
+}
+
+// load читает файлы миграций и таблицу migrations. Миграциям, примененным до появления
+// контрольных сумм, записывается сумма текущего файла.
+func (m *Migrator) load(ctx context.Context) (*migrationSet, error) {
+	if err := m.store.prepare(ctx); err != nil {
+		return nil, fmt.Errorf("failed to create migrations table: %w", err)
 	}
 
-	// Получаем список файлов миграций
-	files, err := os.ReadDir(migrationsDir)
+	applied, err := m.store.applied(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to read migrations directory: %w", err)
+		return nil, fmt.Errorf("failed to get applied migrations: %w", err)
 	}
 
-	// Сортируем файлы по имени (они должны быть в формате 001_name.sql, 002_name.sql и т.д.)
-	sort.Slice(files, func(i, j int) bool {
-		return files[i].Name() < files[j].Name()
-	})
+	files, err := listMigrationFiles(m.dir)
+	if err != nil {
+		return nil, err
+	}
 
-	// Применяем каждую миграцию
+	set := &migrationSet{applied: applied}
 	for _, file := range files {
-		if !strings.HasSuffix(file.Name(), ".sql") {
-			continue
+		migration, err := readMigration(file.path, file.version)
+		if err != nil {
+			return nil, err
 		}
+		set.files = append(set.files, migration)
 
-		version := getMigrationVersion(file.Name())
-		if version == 0 {
-			log.Printf("[DB] Skipping invalid migration file: %s", file.Name())
-			continue
+		record, ok := applied[migration.Version]
+		switch {
+		case !ok:
+		case record.checksum == "":
+			if err := m.store.setChecksum(ctx, migration.Version, migration.Checksum); err != nil {
+				return nil, fmt.Errorf("failed to record checksum of migration %d: %w", migration.Version, err)
+			}
+			record.checksum = migration.Checksum
+			applied[migration.Version] = record
+			log.Printf("[DB] Recorded checksum of migration %d", migration.Version)
+		case record.checksum != migration.Checksum:
+			set.modified = append(set.modified, migration.Version)
 		}
+	}
+	return set, nil
+}
 
+// checkModified возвращает ошибку, если изменились файлы примененных миграций
+func (m *Migrator) checkModified(set *migrationSet) error {
+	if m.AllowModified {
+		return nil
+	}
+	if len(set.modified) > 0 {
+		return fmt.Errorf("files of applied migrations %v changed after they were applied; restore them and add a new migration instead", set.modified)
+	}
+	return nil
+}
+
+// containsVersion сообщает, есть ли version в versions
+func containsVersion(versions []int, version int) bool {
+	for _, v := range versions {
+		if v == version {
+			return true
+		}
+	}
+	return false
+}
+
+// Up применяет все непримененные миграции в порядке версий и возвращает их количество
+func (m *Migrator) Up(ctx context.Context) (int, error) {
+	set, err := m.load(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if err := m.checkModified(set); err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, migration := range set.files {
 		// Пропускаем уже примененные миграции
-		if applied[version] {
-			log.Printf("[DB] Migration %d already applied", version)
+		if _, ok := set.applied[migration.Version]; ok {
+			log.Printf("[DB] Migration %d already applied", migration.Version)
 			continue
 		}
 
-		// Читаем и применяем миграцию
-		if err := applyMigration(ctx, db, filepath.Join(migrationsDir, file.Name()), version); err != nil {
-			return fmt.Errorf("failed to apply migration %d: %w", version, err)
+		if err := m.store.apply(ctx, migration); err != nil {
+			return count, fmt.Errorf("failed to apply migration %d: %w", migration.Version, err)
+		}
+		count++
+		log.Printf("[DB] Successfully applied migration %d", migration.Version)
+	}
+	return count, nil
+}
+
+// Down откатывает n последних примененных миграций и возвращает количество откаченных
+func (m *Migrator) Down(ctx context.Context, n int) (int, error) {
+	if n <= 0 {
+		return 0, fmt.Errorf("number of migrations to roll back must be positive, got %d", n)
+	}
+
+	set, err := m.load(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if err := m.checkModified(set); err != nil {
+		return 0, err
+	}
+
+	versions := set.appliedDesc()
+	if n > len(versions) {
+		n = len(versions)
+	}
+	for i, version := range versions[:n] {
+		if err := m.revert(ctx, set, version); err != nil {
+			return i, err
 		}
+	}
+	return n, nil
+}
 
-		log.Printf("[DB] Successfully applied migration %d", version)
+// revert откатывает примененную миграцию version
+func (m *Migrator) revert(ctx context.Context, set *migrationSet, version int) error {
+	migration, ok := set.file(version)
+	if !ok {
+		return fmt.Errorf("cannot roll back migration %d: its file is missing from %s", version, m.dir)
+	}
+	if migration.Down == "" {
+		return fmt.Errorf("cannot roll back migration %d: its Down section is empty", version)
 	}
 
+	if err := m.store.revert(ctx, migration); err != nil {
+		return fmt.Errorf("failed to roll back migration %d: %w", version, err)
+	}
+	log.Printf("[DB] Successfully rolled back migration %d", version)
 	return nil
 }
 
-// createMigrationsTable создает таблицу для отслеживания миграций
-func createMigrationsTable(ctx context.Context, db *pgxpool.Pool) error {
-	sql := `
-		CREATE TABLE IF NOT EXISTS migrations (
-			version INTEGER PRIMARY KEY,
-			applied_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
-		)`
-	_, err := db.Exec(ctx, sql)
-	return err
+// Redo откатывает и заново применяет последнюю примененную миграцию и возвращает ее версию.
+// Откат выполняется по Down-части из текущего файла, поэтому измененную миграцию Redo,
+// как и Down, откатывает только с AllowModified.
+func (m *Migrator) Redo(ctx context.Context) (int, error) {
+	set, err := m.load(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	versions := set.appliedDesc()
+	if len(versions) == 0 {
+		return 0, errors.New("no applied migrations to redo")
+	}
+	version := versions[0]
+	if err := m.checkModified(set); err != nil {
+		return 0, err
+	}
+
+	if err := m.revert(ctx, set, version); err != nil {
+		return 0, err
+	}
+	migration, _ := set.file(version)
+	if err := m.store.apply(ctx, migration); err != nil {
+		return 0, fmt.Errorf("failed to apply migration %d: %w", version, err)
+	}
+	log.Printf("[DB] Successfully applied migration %d", version)
+	return version, nil
 }
 
-// getAppliedMigrations возвращает список уже примененных миграций
-func getAppliedMigrations(ctx context.Context, db *pgxpool.Pool) (map[int]bool, error) {
-	sql := `SELECT version FROM migrations`
-	rows, err := db.Query(ctx, sql)
+// Status возвращает состояние всех миграций: из каталога и примененных, в порядке версий
+func (m *Migrator) Status(ctx context.Context) ([]MigrationStatus, error) {
+	set, err := m.load(ctx)
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
 
-	applied := make(map[int]bool)
-	for rows.Next() {
-		var version int
-		if err := rows.Scan(&version); err != nil {
-			return nil, err
+	statuses := []MigrationStatus{}
+	for _, migration := range set.files {
+		status := MigrationStatus{
+			Version:  migration.Version,
+			Name:     migration.Name,
+			Modified: containsVersion(set.modified, migration.Version),
 		}
-		applied[version] = true
+		if record, ok := set.applied[migration.Version]; ok {
+			appliedAt := record.appliedAt
+			status.AppliedAt = &appliedAt
+		}
+		statuses = append(statuses, status)
 	}
-	return applied, rows.Err()
+	for version, record := range set.applied {
+		if _, ok := set.file(version); !ok {
+			appliedAt := record.appliedAt
+			statuses = append(statuses, MigrationStatus{Version: version, AppliedAt: &appliedAt, Missing: true})
+		}
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Version < statuses[j].Version
+	})
+	return statuses, nil
+}
+
+// migrationNamePattern - допустимое имя новой миграции
+var migrationNamePattern = regexp.MustCompile(`^[a-z0-9_]+$`)
+
+// CreateMigration создает в каталоге пустой файл миграции со следующей версией и возвращает его путь
+func CreateMigration(migrationsDir, name string) (string, error) {
+	name = strings.ToLower(strings.NewReplacer(" ", "_", "-", "_").Replace(strings.TrimSpace(name)))
+	if !migrationNamePattern.MatchString(name) {
+		return "", fmt.Errorf("invalid migration name %q: use letters, digits and underscores", name)
+	}
+
+	files, err := listMigrationFiles(migrationsDir)
+	if err != nil {
+		return "", err
+	}
+	version := 1
+	if len(files) > 0 {
+		version = files[len(files)-1].version + 1
+	}
+
+	path := filepath.Join(migrationsDir, fmt.Sprintf("%03d_%s.sql", version, name))
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return "", fmt.Errorf("failed to create migration file: %w", err)
+	}
+	defer f.Close()
+
+	if _, err := f.WriteString(migrateUpMarker + "\n\n" + migrateDownMarker + "\n"); err != nil {
+		return "", fmt.Errorf("failed to write migration file: %w", err)
+	}
+	return path, nil
+}
+
+// migrationFile - файл миграции и ее версия
+type migrationFile struct {
+	version int
+	path    string
+}
+
+// listMigrationFiles возвращает файлы миграций каталога в порядке версий.
+// Подкаталоги (например, migrations/sqlite) не просматриваются.
+func listMigrationFiles(migrationsDir string) ([]migrationFile, error) {
+	entries, err := os.ReadDir(migrationsDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read migrations directory: %w", err)
+	}
+
+	// Сортируем файлы по имени (они должны быть в формате 001_name.sql, 002_name.sql и т.д.)
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name() < entries[j].Name()
+	})
+
+	files := []migrationFile{}
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".sql") {
+			continue
+		}
+
+		version := getMigrationVersion(entry.Name())
+		if version == 0 {
+			log.Printf("[DB] Skipping invalid migration file: %s", entry.Name())
+			continue
+		}
+		if n := len(files); n > 0 && files[n-1].version == version {
+			return nil, fmt.Errorf("duplicate migration version %d: %s and %s", version, files[n-1].path, entry.Name())
+		}
+		files = append(files, migrationFile{version: version, path: filepath.Join(migrationsDir, entry.Name())})
+	}
+	return files, nil
 }
 
 // getMigrationVersion извлекает версию миграции из имени файла
@@ -115,39 +393,94 @@ func getMigrationVersion(filename string) int {
 	return version
 }
 
-// applyMigration применяет одну миграцию
-func applyMigration(ctx context.Context, db *pgxpool.Pool, filepath string, version int) error {
-	content, err := os.ReadFile(filepath)
+// readMigration читает файл миграции и разделяет его на Up и Down части
+func readMigration(path string, version int) (Migration, error) {
+	content, err := os.ReadFile(path)
 	if err != nil {
-		return err
+		return Migration{}, err
 	}
 
-	// Разделяем миграцию на Up и Down части
-	parts := strings.Split(string(content), "-- +migrate Down")
+	parts := strings.Split(string(content), migrateDownMarker)
 	if len(parts) != 2 {
-		return fmt.Errorf("invalid migration file format: %s", filepath)
+		return Migration{}, fmt.Errorf("invalid migration file format: %s", path)
+	}
+
+	sum := sha256.Sum256(content)
+	name := strings.TrimSuffix(filepath.Base(path), ".sql")
+	return Migration{
+		Version:  version,
+		Name:     name[strings.Index(name, "_")+1:],
+		Up:       strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(parts[0]), migrateUpMarker)),
+		Down:     strings.TrimSpace(parts[1]),
+		Checksum: hex.EncodeToString(sum[:]),
+	}, nil
+}
+
+// postgresMigrationStore - таблица migrations в PostgreSQL
+type postgresMigrationStore struct {
+	db *pgxpool.Pool
+}
+
+func (s *postgresMigrationStore) prepare(ctx context.Context) error {
+	sql := `
+		CREATE TABLE IF NOT EXISTS migrations (
+			version INTEGER PRIMARY KEY,
+			applied_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+			checksum TEXT
+		)`
+	if _, err := s.db.Exec(ctx, sql); err != nil {
+		return err
+	}
+	// Таблица могла быть создана до появления контрольных сумм
+	_, err := s.db.Exec(ctx, `ALTER TABLE migrations ADD COLUMN IF NOT EXISTS checksum TEXT`)
+	return err
+}
+
+func (s *postgresMigrationStore) applied(ctx context.Context) (map[int]appliedMigration, error) {
+	rows, err := s.db.Query(ctx, `SELECT version, applied_at, COALESCE(checksum, '') FROM migrations`)
+	if err != nil {
+		return nil, err
 	}
+	defer rows.Close()
 
-	upSQL := strings.TrimPrefix(parts[0], "-- +migrate Up")
-	upSQL = strings.TrimSpace(upSQL)
+	applied := make(map[int]appliedMigration)
+	for rows.Next() {
+		var version int
+		var record appliedMigration
+		if err := rows.Scan(&version, &record.appliedAt, &record.checksum); err != nil {
+			return nil, err
+		}
+		applied[version] = record
+	}
+	return applied, rows.Err()
+}
 
-	// Начинаем транзакцию
-	tx, err := db.Begin(ctx)
+// inTx выполняет sql миграции и запрос к таблице migrations в одной транзакции
+func (s *postgresMigrationStore) inTx(ctx context.Context, sql, mark string, args ...any) error {
+	tx, err := s.db.Begin(ctx)
 	if err != nil {
 		return err
 	}
 	defer tx.Rollback(ctx)
 
-	// Выполняем миграцию
-	if _, err := tx.Exec(ctx, upSQL); err != nil {
+	if _, err := tx.Exec(ctx, sql); err != nil {
 		return fmt.Errorf("failed to execute migration: %w", err)
 	}
-
-	// Отмечаем миграцию как выполненную
-	if _, err := tx.Exec(ctx, "INSERT INTO migrations (version) VALUES ($1)", version); err != nil {
-		return fmt.Errorf("failed to mark migration as applied: %w", err)
+	if _, err := tx.Exec(ctx, mark, args...); err != nil {
+		return fmt.Errorf("failed to update migrations table: %w", err)
 	}
-
-	// Подтверждаем транзакцию
 	return tx.Commit(ctx)
 }
+
+func (s *postgresMigrationStore) apply(ctx context.Context, m Migration) error {
+	return s.inTx(ctx, m.Up, `INSERT INTO migrations (version, checksum) VALUES ($1, $2)`, m.Version, m.Checksum)
+}
+
+func (s *postgresMigrationStore) revert(ctx context.Context, m Migration) error {
+	return s.inTx(ctx, m.Down, `DELETE FROM migrations WHERE version = $1`, m.Version)
+}
+
+func (s *postgresMigrationStore) setChecksum(ctx context.Context, version int, checksum string) error {
+	_, err := s.db.Exec(ctx, `UPDATE migrations SET checksum = $1 WHERE version = $2`, checksum, version)
+	return err
+}
@@ -0,0 +1,70 @@
+package database_test
+
+import (
+	"context"
+	"database/sql"
+	"novel-server/internal/database"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeMigration записывает файл миграции с частями Up и Down
+func writeMigration(t *testing.T, dir, name, up, down string) {
+	t.Helper()
+	content := "-- +migrate Up\n" + up + "\n\n-- +migrate Down\n" + down + "\n"
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+}
+
+// tableExists сообщает, есть ли в базе таблица name
+func tableExists(t *testing.T, db *sql.DB, name string) bool {
+	t.Helper()
+	var count int
+	if err := db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?", name).Scan(&count); err != nil {
+		t.Fatalf("query sqlite_master: %v", err)
+	}
+	return count > 0
+}
+
+func TestRedoModifiedMigration(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	db, err := database.OpenSQLite(ctx, filepath.Join(t.TempDir(), "migrate.db"))
+	if err != nil {
+		t.Fatalf("OpenSQLite: %v", err)
+	}
+	t.Cleanup(func() { database.CloseSQLite(db) })
+
+	writeMigration(t, dir, "001_notes.sql", "CREATE TABLE notes (id INTEGER PRIMARY KEY);", "DROP TABLE notes;")
+	if _, err := database.NewSQLiteMigrator(db, dir).Up(ctx); err != nil {
+		t.Fatalf("Up: %v", err)
+	}
+
+	// Новая Down-часть уже не соответствует примененной Up-части
+	writeMigration(t, dir, "001_notes.sql", "CREATE TABLE memos (id INTEGER PRIMARY KEY);", "DROP TABLE memos;")
+
+	if _, err := database.NewSQLiteMigrator(db, dir).Redo(ctx); err == nil {
+		t.Fatalf("Redo of a modified migration succeeded without AllowModified")
+	}
+	if !tableExists(t, db, "notes") || tableExists(t, db, "memos") {
+		t.Fatalf("refused Redo changed the schema")
+	}
+
+	// С AllowModified Redo откатывает по текущему файлу
+	migrator := database.NewSQLiteMigrator(db, dir)
+	migrator.AllowModified = true
+	if _, err := migrator.Redo(ctx); err == nil {
+		t.Fatalf("Redo rolled back with a Down section for a table that does not exist")
+	}
+
+	writeMigration(t, dir, "001_notes.sql", "CREATE TABLE notes (id INTEGER PRIMARY KEY, body TEXT);", "DROP TABLE notes;")
+	version, err := migrator.Redo(ctx)
+	if err != nil {
+		t.Fatalf("Redo with AllowModified: %v", err)
+	}
+	if version != 1 || !tableExists(t, db, "notes") {
+		t.Fatalf("Redo = %d, notes table exists %v", version, tableExists(t, db, "notes"))
+	}
+}
@@ -0,0 +1,162 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"novel-server/internal/logger"
+	"os"
+	"path/filepath"
+
+	_ "github.com/mattn/go-sqlite3" // Драйвер sqlite3 для database/sql
+)
+
+// sqliteMigrationsDir - каталог миграций SQLite. Миграции PostgreSQL из migrations
+// используют uuid-ossp, plpgsql и JSONB, поэтому у SQLite своя схема
+var sqliteMigrationsDir = filepath.Join("migrations", "sqlite")
+
+// sqliteDSN возвращает строку подключения к файлу базы. WAL позволяет читать во время записи,
+// busy_timeout заставляет ждать блокировку вместо ошибки SQLITE_BUSY, а BEGIN IMMEDIATE
+// сразу берет блокировку записи, чтобы параллельные транзакции не упирались друг в друга
+// при переходе от чтения к записи. Внешние ключи в SQLite по умолчанию выключены.
+func sqliteDSN(path string) string {
+	return fmt.Sprintf("%s?_foreign_keys=1&_busy_timeout=5000&_journal_mode=WAL&_txlock=immediate", path)
+}
+
+// OpenSQLite открывает файл базы SQLite (создает его, если файла нет) без миграций
+func OpenSQLite(ctx context.Context, path string) (*sql.DB, error) {
+	logger.Logger.Info("Opening SQLite database", "path", path)
+
+	db, err := sql.Open("sqlite3", sqliteDSN(path))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open sqlite database: %w", err)
+	}
+
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to ping sqlite database: %w", err)
+	}
+	return db, nil
+}
+
+// InitSQLite открывает файл базы SQLite из cfg и выполняет миграции, если они не отключены
+func InitSQLite(ctx context.Context, cfg *Config) (*sql.DB, error) {
+	db, err := OpenSQLite(ctx, cfg.SQLitePath)
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.SkipMigrations {
+		logger.Logger.Warn("Automatic migrations are disabled; apply them with cmd/migrate", "dir", sqliteMigrationsDir)
+		return db, nil
+	}
+	if _, err := os.Stat(sqliteMigrationsDir); os.IsNotExist(err) {
+		logger.Logger.Warn("Migrations directory not found", "dir", sqliteMigrationsDir)
+		return db, nil
+	}
+
+	if err := RunSQLiteMigrations(ctx, db, sqliteMigrationsDir); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to run migrations: %w", err)
+	}
+
+	logger.Logger.Info("Database initialization completed")
+	return db, nil
+}
+
+// CloseSQLite закрывает соединения с базой SQLite
+func CloseSQLite(db *sql.DB) {
+	if db != nil {
+		db.Close()
+		logger.Logger.Info("Database connection closed")
+	}
+}
+
+// NewSQLiteMigrator создает Migrator для SQLite
+func NewSQLiteMigrator(db *sql.DB, migrationsDir string) *Migrator {
+	return &Migrator{store: &sqliteMigrationStore{db: db}, dir: migrationsDir}
+}
+
+// RunSQLiteMigrations выполняет все миграции SQLite из указанной директории.
+// Формат файлов и таблица migrations те же, что и у RunMigrations.
+func RunSQLiteMigrations(ctx context.Context, db *sql.DB, migrationsDir string) error {
+	log.Printf("[DB] Starting SQLite migrations from directory: %s", migrationsDir)
+	_, err := NewSQLiteMigrator(db, migrationsDir).Up(ctx)
+	return err
+}
+
+// sqliteMigrationStore - таблица migrations в SQLite
+type sqliteMigrationStore struct {
+	db *sql.DB
+}
+
+func (s *sqliteMigrationStore) prepare(ctx context.Context) error {
+	createSQL := `
+		CREATE TABLE IF NOT EXISTS migrations (
+			version INTEGER PRIMARY KEY,
+			applied_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			checksum TEXT
+		)`
+	if _, err := s.db.ExecContext(ctx, createSQL); err != nil {
+		return err
+	}
+
+	// Таблица могла быть создана до появления контрольных сумм; ADD COLUMN IF NOT EXISTS в SQLite нет
+	var hasChecksum bool
+	err := s.db.QueryRowContext(ctx, `SELECT COUNT(*) > 0 FROM pragma_table_info('migrations') WHERE name = 'checksum'`).Scan(&hasChecksum)
+	if err != nil || hasChecksum {
+		return err
+	}
+	_, err = s.db.ExecContext(ctx, `ALTER TABLE migrations ADD COLUMN checksum TEXT`)
+	return err
+}
+
+func (s *sqliteMigrationStore) applied(ctx context.Context) (map[int]appliedMigration, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT version, applied_at, COALESCE(checksum, '') FROM migrations`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := make(map[int]appliedMigration)
+	for rows.Next() {
+		var version int
+		var record appliedMigration
+		if err := rows.Scan(&version, &record.appliedAt, &record.checksum); err != nil {
+			return nil, err
+		}
+		applied[version] = record
+	}
+	return applied, rows.Err()
+}
+
+// inTx выполняет sql миграции и запрос к таблице migrations в одной транзакции
+func (s *sqliteMigrationStore) inTx(ctx context.Context, migrationSQL, mark string, args ...any) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, migrationSQL); err != nil {
+		return fmt.Errorf("failed to execute migration: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, mark, args...); err != nil {
+		return fmt.Errorf("failed to update migrations table: %w", err)
+	}
+	return tx.Commit()
+}
+
+func (s *sqliteMigrationStore) apply(ctx context.Context, m Migration) error {
+	return s.inTx(ctx, m.Up, `INSERT INTO migrations (version, checksum) VALUES (?, ?)`, m.Version, m.Checksum)
+}
+
+func (s *sqliteMigrationStore) revert(ctx context.Context, m Migration) error {
+	return s.inTx(ctx, m.Down, `DELETE FROM migrations WHERE version = ?`, m.Version)
+}
+
+func (s *sqliteMigrationStore) setChecksum(ctx context.Context, version int, checksum string) error {
+	_, err := s.db.ExecContext(ctx, `UPDATE migrations SET checksum = ? WHERE version = ?`, checksum, version)
+	return err
+}
@@ -0,0 +1,456 @@
+package domain
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Condition - условие на состояние новеллы, например `rel("Mira") >= 3 && !flag("betrayed")`.
+//
+// Синтаксис:
+//   - flag("name") - true, если в global_flags есть флаг name;
+//   - rel("Name") - значение relationship персонажа (0, если его нет);
+//   - var("name") или просто name - значение story_variables (null, если его нет);
+//   - литералы: числа, строки в двойных или одинарных кавычках, true, false, null;
+//   - сравнения ==, !=, <, <=, >, >= (порядок определен только для чисел);
+//   - логические &&, ||, ! и скобки.
+//
+// В JSON условие хранится строкой и разбирается при десериализации,
+// поэтому синтаксическая ошибка обнаруживается сразу при разборе ответа модели.
+type Condition struct {
+	source string
+	root   condNode
+}
+
+// ParseCondition разбирает условие из строки
+func ParseCondition(source string) (Condition, error) {
+	p := &condParser{}
+	if err := p.tokenize(source); err != nil {
+		return Condition{}, fmt.Errorf("condition %q: %w", source, err)
+	}
+	if len(p.tokens) == 0 {
+		return Condition{}, fmt.Errorf("condition is empty")
+	}
+	root, err := p.parseOr()
+	if err == nil && p.pos < len(p.tokens) {
+		err = fmt.Errorf("unexpected %q", p.tokens[p.pos].text)
+	}
+	if err != nil {
+		return Condition{}, fmt.Errorf("condition %q: %w", source, err)
+	}
+	return Condition{source: strings.TrimSpace(source), root: root}, nil
+}
+
+// String возвращает исходный текст условия
+func (c Condition) String() string {
+	return c.source
+}
+
+// IsZero сообщает, что условие не задано
+func (c Condition) IsZero() bool {
+	return c.root == nil
+}
+
+// Eval вычисляет условие на состоянии state. Незаданное условие всегда истинно.
+func (c Condition) Eval(state *NovelState) (bool, error) {
+	if c.root == nil {
+		return true, nil
+	}
+	value, err := c.root.eval(state)
+	if err != nil {
+		return false, fmt.Errorf("condition %q: %w", c.source, err)
+	}
+	return truthy(value), nil
+}
+
+// MarshalJSON сериализует условие исходной строкой
+func (c Condition) MarshalJSON() ([]byte, error) {
+	return json.Marshal(c.source)
+}
+
+// UnmarshalJSON разбирает условие из JSON-строки
+func (c *Condition) UnmarshalJSON(data []byte) error {
+	var source string
+	if err := json.Unmarshal(data, &source); err != nil {
+		return fmt.Errorf("condition must be a string: %w", err)
+	}
+	parsed, err := ParseCondition(source)
+	if err != nil {
+		return err
+	}
+	*c = parsed
+	return nil
+}
+
+// condNode - узел разобранного условия. Значения: nil, bool, float64 или string.
+type condNode interface {
+	eval(state *NovelState) (interface{}, error)
+}
+
+type literalNode struct{ value interface{} }
+
+func (n literalNode) eval(*NovelState) (interface{}, error) { return n.value, nil }
+
+type flagNode struct{ name string }
+
+func (n flagNode) eval(state *NovelState) (interface{}, error) {
+	return hasFlag(state.GlobalFlags, n.name), nil
+}
+
+type relNode struct{ name string }
+
+func (n relNode) eval(state *NovelState) (interface{}, error) {
+	if value, ok := state.Relationship[n.name]; ok {
+		return float64(value), nil
+	}
+	for character, value := range state.Relationship {
+		if sameName(character, n.name) {
+			return float64(value), nil
+		}
+	}
+	return float64(0), nil
+}
+
+type varNode struct{ name string }
+
+func (n varNode) eval(state *NovelState) (interface{}, error) {
+	value, ok := state.StoryVariables[n.name]
+	if !ok {
+		return nil, nil
+	}
+	if number, ok := toNumber(value); ok {
+		return number, nil
+	}
+	switch value.(type) {
+	case nil, bool, string:
+		return value, nil
+	}
+	return nil, fmt.Errorf("story variable %q has unsupported type %T", n.name, value)
+}
+
+type notNode struct{ operand condNode }
+
+func (n notNode) eval(state *NovelState) (interface{}, error) {
+	value, err := n.operand.eval(state)
+	if err != nil {
+		return nil, err
+	}
+	return !truthy(value), nil
+}
+
+// logicNode - && или || с вычислением по короткой схеме
+type logicNode struct {
+	op          string
+	left, right condNode
+}
+
+func (n logicNode) eval(state *NovelState) (interface{}, error) {
+	left, err := n.left.eval(state)
+	if err != nil {
+		return nil, err
+	}
+	if n.op == "&&" && !truthy(left) {
+		return false, nil
+	}
+	if n.op == "||" && truthy(left) {
+		return true, nil
+	}
+	right, err := n.right.eval(state)
+	if err != nil {
+		return nil, err
+	}
+	return truthy(right), nil
+}
+
+type compareNode struct {
+	op          string
+	left, right condNode
+}
+
+func (n compareNode) eval(state *NovelState) (interface{}, error) {
+	left, err := n.left.eval(state)
+	if err != nil {
+		return nil, err
+	}
+	right, err := n.right.eval(state)
+	if err != nil {
+		return nil, err
+	}
+
+	switch n.op {
+	case "==":
+		return left == right, nil
+	case "!=":
+		return left != right, nil
+	}
+
+	l, lok := left.(float64)
+	r, rok := right.(float64)
+	if !lok || !rok {
+		return nil, fmt.Errorf("operator %s needs numbers, got %v and %v", n.op, left, right)
+	}
+	switch n.op {
+	case "<":
+		return l < r, nil
+	case "<=":
+		return l <= r, nil
+	case ">":
+		return l > r, nil
+	default: // ">="
+		return l >= r, nil
+	}
+}
+
+// truthy приводит значение условия к bool: null, false, 0 и "" ложны
+func truthy(value interface{}) bool {
+	switch v := value.(type) {
+	case nil:
+		return false
+	case bool:
+		return v
+	case float64:
+		return v != 0
+	case string:
+		return v != ""
+	}
+	return true
+}
+
+// toNumber приводит числовое значение story_variables к float64
+func toNumber(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case int:
+		return float64(v), true
+	case json.Number:
+		f, err := v.Float64()
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// Разбор условия
+
+type condTokenKind int
+
+const (
+	tokenOp condTokenKind = iota
+	tokenIdent
+	tokenNumber
+	tokenString
+)
+
+type condToken struct {
+	kind  condTokenKind
+	text  string
+	value interface{} // Для чисел и строк
+}
+
+type condParser struct {
+	tokens []condToken
+	pos    int
+}
+
+// tokenize разбивает условие на токены
+func (p *condParser) tokenize(source string) error {
+	for i := 0; i < len(source); {
+		c := source[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case strings.HasPrefix(source[i:], "&&"), strings.HasPrefix(source[i:], "||"),
+			strings.HasPrefix(source[i:], "=="), strings.HasPrefix(source[i:], "!="),
+			strings.HasPrefix(source[i:], "<="), strings.HasPrefix(source[i:], ">="):
+			p.tokens = append(p.tokens, condToken{kind: tokenOp, text: source[i : i+2]})
+			i += 2
+		case strings.IndexByte("!<>()", c) >= 0:
+			p.tokens = append(p.tokens, condToken{kind: tokenOp, text: string(c)})
+			i++
+		case c == '"' || c == '\'':
+			end := i + 1
+			for end < len(source) && source[end] != c {
+				if source[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(source) {
+				return fmt.Errorf("unterminated string")
+			}
+			var value string
+			if c == '\'' {
+				// Одинарные кавычки удобнее внутри JSON; из экранирования поддерживаем только \'
+				value = strings.ReplaceAll(source[i+1:end], `\'`, `'`)
+			} else {
+				var err error
+				if value, err = strconv.Unquote(source[i : end+1]); err != nil {
+					return fmt.Errorf("invalid string %s", source[i:end+1])
+				}
+			}
+			p.tokens = append(p.tokens, condToken{kind: tokenString, text: source[i : end+1], value: value})
+			i = end + 1
+		case c == '-' || c == '.' || (c >= '0' && c <= '9'):
+			end := i + 1
+			for end < len(source) && (source[end] == '.' || (source[end] >= '0' && source[end] <= '9')) {
+				end++
+			}
+			number, err := strconv.ParseFloat(source[i:end], 64)
+			if err != nil {
+				return fmt.Errorf("invalid number %q", source[i:end])
+			}
+			p.tokens = append(p.tokens, condToken{kind: tokenNumber, text: source[i:end], value: number})
+			i = end
+		case c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z'):
+			end := i + 1
+			for end < len(source) && (source[end] == '_' || (source[end] >= 'a' && source[end] <= 'z') ||
+				(source[end] >= 'A' && source[end] <= 'Z') || (source[end] >= '0' && source[end] <= '9')) {
+				end++
+			}
+			p.tokens = append(p.tokens, condToken{kind: tokenIdent, text: source[i:end]})
+			i = end
+		default:
+			return fmt.Errorf("unexpected character %q", c)
+		}
+	}
+	return nil
+}
+
+// peekOp сообщает, является ли следующий токен оператором op
+func (p *condParser) peekOp(op string) bool {
+	return p.pos < len(p.tokens) && p.tokens[p.pos].kind == tokenOp && p.tokens[p.pos].text == op
+}
+
+// expectOp пропускает оператор op или возвращает ошибку
+func (p *condParser) expectOp(op string) error {
+	if !p.peekOp(op) {
+		if p.pos < len(p.tokens) {
+			return fmt.Errorf("expected %q, got %q", op, p.tokens[p.pos].text)
+		}
+		return fmt.Errorf("expected %q at the end", op)
+	}
+	p.pos++
+	return nil
+}
+
+func (p *condParser) parseOr() (condNode, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peekOp("||") {
+		p.pos++
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = logicNode{op: "||", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *condParser) parseAnd() (condNode, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.peekOp("&&") {
+		p.pos++
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = logicNode{op: "&&", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *condParser) parseUnary() (condNode, error) {
+	if p.peekOp("!") {
+		p.pos++
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return notNode{operand: operand}, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *condParser) parseComparison() (condNode, error) {
+	left, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	for _, op := range []string{"==", "!=", "<=", ">=", "<", ">"} {
+		if p.peekOp(op) {
+			p.pos++
+			right, err := p.parsePrimary()
+			if err != nil {
+				return nil, err
+			}
+			return compareNode{op: op, left: left, right: right}, nil
+		}
+	}
+	return left, nil
+}
+
+func (p *condParser) parsePrimary() (condNode, error) {
+	if p.pos >= len(p.tokens) {
+		return nil, fmt.Errorf("unexpected end of condition")
+	}
+	token := p.tokens[p.pos]
+	p.pos++
+
+	switch token.kind {
+	case tokenNumber, tokenString:
+		return literalNode{value: token.value}, nil
+	case tokenOp:
+		if token.text != "(" {
+			return nil, fmt.Errorf("unexpected %q", token.text)
+		}
+		node, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expectOp(")"); err != nil {
+			return nil, err
+		}
+		return node, nil
+	}
+
+	switch token.text {
+	case "true":
+		return literalNode{value: true}, nil
+	case "false":
+		return literalNode{value: false}, nil
+	case "null":
+		return literalNode{value: nil}, nil
+	}
+
+	if !p.peekOp("(") {
+		// Голый идентификатор - переменная истории
+		return varNode{name: token.text}, nil
+	}
+	p.pos++
+	if p.pos >= len(p.tokens) || p.tokens[p.pos].kind != tokenString {
+		return nil, fmt.Errorf("%s() expects a quoted name", token.text)
+	}
+	name := p.tokens[p.pos].value.(string)
+	p.pos++
+	if err := p.expectOp(")"); err != nil {
+		return nil, err
+	}
+
+	switch token.text {
+	case "flag":
+		return flagNode{name: name}, nil
+	case "rel":
+		return relNode{name: name}, nil
+	case "var":
+		return varNode{name: name}, nil
+	}
+	return nil, fmt.Errorf("unknown function %s()", token.text)
+}
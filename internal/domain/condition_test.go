@@ -0,0 +1,177 @@
+package domain
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+// conditionState - состояние, на котором проверяются условия
+func conditionState() *NovelState {
+	return &NovelState{
+		GlobalFlags:  []string{"met_mira"},
+		Relationship: map[string]int{"Mira": 3},
+		StoryVariables: map[string]interface{}{
+			"coins":  float64(5),
+			"level":  2,
+			"name":   "Alex",
+			"broken": true,
+			"empty":  nil,
+			"items":  []interface{}{"key"},
+		},
+	}
+}
+
+func TestParseConditionErrors(t *testing.T) {
+	tests := []struct {
+		source string
+		want   string
+	}{
+		{``, "condition is empty"},
+		{`   `, "condition is empty"},
+		{`rel(`, "rel() expects a quoted name"},
+		{`rel(Mira)`, "rel() expects a quoted name"},
+		{`flag("a"`, `expected ")" at the end`},
+		{`flag("a" "b")`, `expected ")", got "\"b\""`},
+		{`(coins > 1`, `expected ")" at the end`},
+		{`coins > 1)`, `unexpected ")"`},
+		{`coins 1`, `unexpected "1"`},
+		{`coins + 1`, "unexpected character '+'"},
+		{`"abc`, "unterminated string"},
+		{`'abc\'`, "unterminated string"},
+		{`"a\q"`, "invalid string"},
+		{`1..2 > 0`, `invalid number "1..2"`},
+		{`coins ==`, "unexpected end of condition"},
+		{`&& coins`, `unexpected "&&"`},
+		{`!`, "unexpected end of condition"},
+		{`score("Mira") > 1`, "unknown function score()"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.source, func(t *testing.T) {
+			_, err := ParseCondition(tt.source)
+			if err == nil {
+				t.Fatalf("ParseCondition(%q) succeeded", tt.source)
+			}
+			if !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("ParseCondition(%q) error = %q, want it to contain %q", tt.source, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestConditionEval(t *testing.T) {
+	tests := []struct {
+		source string
+		want   bool
+	}{
+		// Приоритет: ! сильнее сравнений в операнде, && сильнее ||
+		{`true || false && false`, true},
+		{`(true || false) && false`, false},
+		{`false && false || true`, true},
+		{`false && (false || true)`, false},
+		{`!false && false`, false},
+		{`!(false && false)`, true},
+		{`!!flag("met_mira")`, true},
+		{`!flag("met_mira") || rel("Mira") >= 3`, true},
+		{`!(flag("met_mira") && rel("mira") > 3)`, true},
+		{`((rel("Mira") == 3))`, true},
+
+		// Функции и переменные
+		{`flag("betrayed")`, false},
+		{`rel(' Mira ') == 3`, true},
+		{`rel("Nobody") == 0`, true},
+		{`var("coins") > 4 && coins < 6`, true},
+		{`level == 2`, true},
+		{`coins >= 5.0 && -1 < coins`, true},
+		{`name == 'Alex' && name != "Bob"`, true},
+		{`name == "alex"`, false},
+		{`coins == "5"`, false},
+		{`broken == true`, true},
+		{`broken`, true},
+		{`name`, true},
+
+		// Отсутствующие и пустые переменные
+		{`missing`, false},
+		{`missing == null`, true},
+		{`empty == null && !empty`, true},
+		{`var("missing") != 0`, true},
+
+		// Короткая схема: правая часть с ошибкой не вычисляется
+		{`false && name > 1`, false},
+		{`true || items == 1`, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.source, func(t *testing.T) {
+			condition, err := ParseCondition(tt.source)
+			if err != nil {
+				t.Fatalf("ParseCondition(%q): %v", tt.source, err)
+			}
+			got, err := condition.Eval(conditionState())
+			if err != nil {
+				t.Fatalf("Eval(%q): %v", tt.source, err)
+			}
+			if got != tt.want {
+				t.Fatalf("Eval(%q) = %t, want %t", tt.source, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConditionEvalErrors(t *testing.T) {
+	tests := []struct {
+		source string
+		want   string
+	}{
+		{`name > 1`, "operator > needs numbers, got Alex and 1"},
+		{`missing < 1`, "operator < needs numbers, got <nil> and 1"},
+		{`broken >= 0`, "operator >= needs numbers"},
+		{`rel("Mira") <= "3"`, "operator <= needs numbers"},
+		{`items == 1`, `story variable "items" has unsupported type []interface {}`},
+		{`!(coins > 1 && name < 2)`, "operator < needs numbers"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.source, func(t *testing.T) {
+			condition, err := ParseCondition(tt.source)
+			if err != nil {
+				t.Fatalf("ParseCondition(%q): %v", tt.source, err)
+			}
+			_, err = condition.Eval(conditionState())
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("Eval(%q) error = %v, want it to contain %q", tt.source, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestConditionJSON(t *testing.T) {
+	var choice struct {
+		Requires Condition `json:"requires"`
+	}
+	if err := json.Unmarshal([]byte(`{"requires":" rel(\"Mira\") >= 3 "}`), &choice); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if ok, err := choice.Requires.Eval(conditionState()); err != nil || !ok {
+		t.Fatalf("Eval = %t, %v, want true", ok, err)
+	}
+	data, err := json.Marshal(choice)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	// Условие сохраняется исходной строкой без крайних пробелов
+	var stored map[string]string
+	if err := json.Unmarshal(data, &stored); err != nil || stored["requires"] != `rel("Mira") >= 3` {
+		t.Fatalf("Marshal = %s (%v)", data, err)
+	}
+
+	if err := json.Unmarshal([]byte(`{"requires":"rel(Mira)"}`), &choice); err == nil {
+		t.Fatal("Unmarshal accepted a condition with a syntax error")
+	}
+	if err := json.Unmarshal([]byte(`{"requires":3}`), &choice); err == nil || !strings.Contains(err.Error(), "condition must be a string") {
+		t.Fatalf("Unmarshal(number) error = %v", err)
+	}
+
+	var zero Condition
+	if ok, err := zero.Eval(conditionState()); !zero.IsZero() || err != nil || !ok {
+		t.Fatalf("zero condition: IsZero %t, Eval %t, %v", zero.IsZero(), ok, err)
+	}
+}
@@ -45,6 +45,7 @@ type NovelConfig struct {
 		GenerateCharacters     bool `json:"generate_characters"`
 		GenerateStartScene     bool `json:"generate_start_scene"`
 	} `json:"required_output"`
+	PromptVersion string `json:"prompt_version,omitempty"` // Версия промпта нарратора, по которой сгенерирован конфиг
 }
 
 // NovelGenerationResponse представляет ответ от API генерации новеллы
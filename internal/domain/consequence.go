@@ -0,0 +1,175 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Поведение варианта выбора, условие requires которого не выполнено
+const (
+	WhenLockedDisable = "disable" // Вариант показывается неактивным (по умолчанию)
+	WhenLockedHide    = "hide"    // Вариант не показывается
+)
+
+// Consequences - последствия выбора. Поля global_flags, relationship и story_variables
+// совпадают с прежним форматом, остальные расширяют его.
+//
+// Эффекты применяются в фиксированном порядке: флаги (добавление, затем удаление),
+// отношения (set, затем изменение на relationship, затем clamp), переменные
+// (story_variables, затем increment и decrement) и в конце условные блоки conditional -
+// их условия вычисляются на состоянии с уже примененными эффектами.
+type Consequences struct {
+	GlobalFlags       []string                  `json:"global_flags,omitempty"`       // Добавить флаги
+	RemoveFlags       []string                  `json:"remove_flags,omitempty"`       // Убрать флаги
+	SetRelationship   map[string]int            `json:"set_relationship,omitempty"`   // Установить значение отношения
+	Relationship      map[string]int            `json:"relationship,omitempty"`       // Изменить отношение на величину
+	ClampRelationship map[string]Range          `json:"clamp_relationship,omitempty"` // Ограничить отношение диапазоном
+	StoryVariables    map[string]interface{}    `json:"story_variables,omitempty"`    // Установить переменные
+	Increment         map[string]float64        `json:"increment,omitempty"`          // Увеличить числовые переменные
+	Decrement         map[string]float64        `json:"decrement,omitempty"`          // Уменьшить числовые переменные
+	Conditional       []ConditionalConsequences `json:"conditional,omitempty"`        // Последствия по условию
+}
+
+// Range - диапазон значений; незаданная граница не ограничивает
+type Range struct {
+	Min *int `json:"min,omitempty"`
+	Max *int `json:"max,omitempty"`
+}
+
+// ConditionalConsequences - последствия, которые применяются, только если выполнено условие If
+type ConditionalConsequences struct {
+	If   Condition     `json:"if"`
+	Then *Consequences `json:"then,omitempty"`
+	Else *Consequences `json:"else,omitempty"`
+}
+
+// validate проверяет последствия на ошибки, которые можно обнаружить без состояния
+func (c *Consequences) validate() error {
+	if c == nil {
+		return nil
+	}
+	for character, r := range c.ClampRelationship {
+		if r.Min != nil && r.Max != nil && *r.Min > *r.Max {
+			return fmt.Errorf("clamp_relationship %q: min %d is greater than max %d", character, *r.Min, *r.Max)
+		}
+	}
+	for i, conditional := range c.Conditional {
+		if conditional.If.IsZero() {
+			return fmt.Errorf("conditional[%d] requires if", i)
+		}
+		if conditional.Then == nil && conditional.Else == nil {
+			return fmt.Errorf("conditional[%d] requires then or else", i)
+		}
+		if err := conditional.Then.validate(); err != nil {
+			return fmt.Errorf("conditional[%d].then: %w", i, err)
+		}
+		if err := conditional.Else.validate(); err != nil {
+			return fmt.Errorf("conditional[%d].else: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// Apply применяет последствия к состоянию. Эффект, который нельзя применить
+// (например, increment нечисловой переменной или ошибка в условии), пропускается,
+// остальные применяются; все такие ошибки возвращаются разом (errors.Join).
+func (c *Consequences) Apply(state *NovelState) error {
+	if c == nil {
+		return nil
+	}
+	var errs []error
+
+	for _, flag := range c.GlobalFlags {
+		if !hasFlag(state.GlobalFlags, flag) {
+			state.GlobalFlags = append(state.GlobalFlags, flag)
+		}
+	}
+	if len(c.RemoveFlags) > 0 {
+		flags := make([]string, 0, len(state.GlobalFlags))
+		for _, flag := range state.GlobalFlags {
+			if !hasFlag(c.RemoveFlags, flag) {
+				flags = append(flags, flag)
+			}
+		}
+		state.GlobalFlags = flags
+	}
+
+	if state.Relationship == nil && (len(c.SetRelationship) > 0 || len(c.Relationship) > 0 || len(c.ClampRelationship) > 0) {
+		state.Relationship = make(map[string]int)
+	}
+	for character, value := range c.SetRelationship {
+		state.Relationship[character] = value
+	}
+	for character, delta := range c.Relationship {
+		state.Relationship[character] += delta
+	}
+	for character, r := range c.ClampRelationship {
+		value := state.Relationship[character]
+		if r.Min != nil && value < *r.Min {
+			value = *r.Min
+		}
+		if r.Max != nil && value > *r.Max {
+			value = *r.Max
+		}
+		state.Relationship[character] = value
+	}
+
+	if state.StoryVariables == nil && (len(c.StoryVariables) > 0 || len(c.Increment) > 0 || len(c.Decrement) > 0) {
+		state.StoryVariables = make(map[string]interface{})
+	}
+	for key, value := range c.StoryVariables {
+		state.StoryVariables[key] = value
+	}
+	for key, delta := range c.Increment {
+		if err := addToVariable(state, key, delta); err != nil {
+			errs = append(errs, fmt.Errorf("increment: %w", err))
+		}
+	}
+	for key, delta := range c.Decrement {
+		if err := addToVariable(state, key, -delta); err != nil {
+			errs = append(errs, fmt.Errorf("decrement: %w", err))
+		}
+	}
+
+	for i, conditional := range c.Conditional {
+		ok, err := conditional.If.Eval(state)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("conditional[%d]: %w", i, err))
+			continue
+		}
+		branch := conditional.Else
+		if ok {
+			branch = conditional.Then
+		}
+		if err := branch.Apply(state); err != nil {
+			errs = append(errs, fmt.Errorf("conditional[%d]: %w", i, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// addToVariable прибавляет delta к числовой переменной истории; отсутствующая переменная считается нулем
+func addToVariable(state *NovelState, key string, delta float64) error {
+	current, exists := state.StoryVariables[key]
+	if !exists || current == nil {
+		state.StoryVariables[key] = delta
+		return nil
+	}
+	number, ok := toNumber(current)
+	if !ok {
+		return fmt.Errorf("story variable %q is not a number (%v)", key, current)
+	}
+	state.StoryVariables[key] = number + delta
+	return nil
+}
+
+// hasFlag сообщает, есть ли flag в списке flags
+func hasFlag(flags []string, flag string) bool {
+	for _, f := range flags {
+		if f == flag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,189 @@
+package domain
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// parseConsequences разбирает последствия из JSON, как они приходят от модели
+func parseConsequences(t *testing.T, data string) *Consequences {
+	t.Helper()
+
+	var c Consequences
+	if err := json.Unmarshal([]byte(data), &c); err != nil {
+		t.Fatalf("Unmarshal(%s): %v", data, err)
+	}
+	return &c
+}
+
+func TestConsequencesApply(t *testing.T) {
+	tests := []struct {
+		name         string
+		state        NovelState
+		consequences string
+		wantFlags    []string
+		wantRel      map[string]int
+		wantVars     map[string]interface{}
+		wantErrs     []string // Фрагменты ошибок, собранных errors.Join
+	}{
+		{
+			name:         "flags are added before removal",
+			state:        NovelState{GlobalFlags: []string{"a", "c"}},
+			consequences: `{"global_flags":["a","b","d"],"remove_flags":["a","d"]}`,
+			wantFlags:    []string{"c", "b"},
+		},
+		{
+			name:         "set, then change, then clamp relationship",
+			state:        NovelState{Relationship: map[string]int{"Mira": 1, "Tom": -9}},
+			consequences: `{"set_relationship":{"Mira":5},"relationship":{"Mira":3,"Tom":-2},"clamp_relationship":{"Mira":{"max":6},"Tom":{"min":-10,"max":10},"Ann":{"min":2}}}`,
+			wantRel:      map[string]int{"Mira": 6, "Tom": -10, "Ann": 2},
+		},
+		{
+			name:         "nil maps are created",
+			state:        NovelState{},
+			consequences: `{"relationship":{"Mira":1},"story_variables":{"door":"open"},"increment":{"coins":2}}`,
+			wantRel:      map[string]int{"Mira": 1},
+			wantVars:     map[string]interface{}{"door": "open", "coins": float64(2)},
+		},
+		{
+			name:         "increment and decrement numbers",
+			state:        NovelState{StoryVariables: map[string]interface{}{"coins": float64(2), "level": 1, "empty": nil}},
+			consequences: `{"story_variables":{"keys":1},"increment":{"coins":3,"keys":1,"empty":4},"decrement":{"coins":1.5,"new":2}}`,
+			wantVars:     map[string]interface{}{"coins": 3.5, "level": 1, "keys": float64(2), "empty": float64(4), "new": float64(-2)},
+		},
+		{
+			name:         "non-numeric increment and decrement are collected",
+			state:        NovelState{StoryVariables: map[string]interface{}{"name": "Alex", "broken": true}},
+			consequences: `{"increment":{"name":1,"coins":1},"decrement":{"broken":1},"global_flags":["still_applied"]}`,
+			wantFlags:    []string{"still_applied"},
+			wantVars:     map[string]interface{}{"name": "Alex", "broken": true, "coins": float64(1)},
+			wantErrs: []string{
+				`increment: story variable "name" is not a number (Alex)`,
+				`decrement: story variable "broken" is not a number (true)`,
+			},
+		},
+		{
+			name:  "conditions see the effects applied before them",
+			state: NovelState{Relationship: map[string]int{"Mira": 2}},
+			consequences: `{"relationship":{"Mira":1},"conditional":[
+				{"if":"rel(\"Mira\") >= 3","then":{"global_flags":["friends"]},"else":{"global_flags":["strangers"]}},
+				{"if":"flag(\"friends\")","then":{"story_variables":{"ending":"good"}}}
+			]}`,
+			wantFlags: []string{"friends"},
+			wantRel:   map[string]int{"Mira": 3},
+			wantVars:  map[string]interface{}{"ending": "good"},
+		},
+		{
+			name:  "nested conditional in then and else",
+			state: NovelState{GlobalFlags: []string{"met_mira"}, StoryVariables: map[string]interface{}{"coins": float64(1)}},
+			consequences: `{"conditional":[{"if":"flag(\"met_mira\")",
+				"then":{"increment":{"coins":1},"conditional":[{"if":"coins >= 2",
+					"then":{"global_flags":["rich"],"conditional":[{"if":"flag(\"rich\") && !flag(\"poor\")","else":{"global_flags":["unreachable"]},"then":{"set_relationship":{"Mira":7}}}]},
+					"else":{"global_flags":["poor"]}}]},
+				"else":{"global_flags":["never_met"]}}]}`,
+			wantFlags: []string{"met_mira", "rich"},
+			wantRel:   map[string]int{"Mira": 7},
+			wantVars:  map[string]interface{}{"coins": float64(2)},
+		},
+		{
+			name:         "missing branch does nothing",
+			state:        NovelState{},
+			consequences: `{"conditional":[{"if":"flag(\"missing\")","then":{"global_flags":["x"]}}]}`,
+		},
+		{
+			name:         "condition errors skip only their block",
+			state:        NovelState{StoryVariables: map[string]interface{}{"name": "Alex"}},
+			consequences: `{"conditional":[{"if":"name > 1","then":{"global_flags":["x"]}},{"if":"true","then":{"global_flags":["y"],"increment":{"name":1}}}]}`,
+			wantFlags:    []string{"y"},
+			wantVars:     map[string]interface{}{"name": "Alex"},
+			wantErrs: []string{
+				"conditional[0]: condition \"name > 1\": operator > needs numbers",
+				`conditional[1]: increment: story variable "name" is not a number`,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			state := tt.state
+			err := parseConsequences(t, tt.consequences).Apply(&state)
+
+			if len(tt.wantErrs) == 0 {
+				if err != nil {
+					t.Fatalf("Apply: %v", err)
+				}
+			} else {
+				var joined interface{ Unwrap() []error }
+				if !errors.As(err, &joined) || len(joined.Unwrap()) != len(tt.wantErrs) {
+					t.Fatalf("Apply error = %v, want %d joined errors", err, len(tt.wantErrs))
+				}
+				for _, want := range tt.wantErrs {
+					if !strings.Contains(err.Error(), want) {
+						t.Fatalf("Apply error = %q, want it to contain %q", err, want)
+					}
+				}
+			}
+
+			if len(state.GlobalFlags) != 0 || len(tt.wantFlags) != 0 {
+				if !reflect.DeepEqual(state.GlobalFlags, tt.wantFlags) {
+					t.Fatalf("flags = %v, want %v", state.GlobalFlags, tt.wantFlags)
+				}
+			}
+			if len(state.Relationship) != 0 || len(tt.wantRel) != 0 {
+				if !reflect.DeepEqual(state.Relationship, tt.wantRel) {
+					t.Fatalf("relationship = %v, want %v", state.Relationship, tt.wantRel)
+				}
+			}
+			if len(state.StoryVariables) != 0 || len(tt.wantVars) != 0 {
+				if !reflect.DeepEqual(state.StoryVariables, tt.wantVars) {
+					t.Fatalf("story variables = %v, want %v", state.StoryVariables, tt.wantVars)
+				}
+			}
+		})
+	}
+
+	var nilConsequences *Consequences
+	if err := nilConsequences.Apply(&NovelState{}); err != nil {
+		t.Fatalf("nil consequences: %v", err)
+	}
+}
+
+func TestConsequencesValidate(t *testing.T) {
+	tests := []struct {
+		name         string
+		consequences string
+		want         string // Фрагмент ошибки; пусто - последствия корректны
+	}{
+		{"valid", `{"clamp_relationship":{"Mira":{"min":0,"max":0},"Tom":{"min":5}},"conditional":[{"if":"true","else":{}}]}`, ""},
+		{"clamp min greater than max", `{"clamp_relationship":{"Mira":{"min":5,"max":1}}}`, `clamp_relationship "Mira": min 5 is greater than max 1`},
+		{"conditional without if", `{"conditional":[{"then":{}}]}`, "conditional[0] requires if"},
+		{"conditional without branches", `{"conditional":[{"if":"true"},{"if":"true"}]}`, "conditional[0] requires then or else"},
+		{"invalid clamp in nested then", `{"conditional":[{"if":"true","then":{"conditional":[{"if":"true","else":{"clamp_relationship":{"Mira":{"min":2,"max":1}}}}]}}]}`,
+			`conditional[0].then: conditional[0].else: clamp_relationship "Mira"`},
+		{"invalid second block", `{"conditional":[{"if":"true","then":{}},{"if":"false","else":{"conditional":[{"if":"true"}]}}]}`,
+			"conditional[1].else: conditional[0] requires then or else"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := parseConsequences(t, tt.consequences).validate()
+			if tt.want == "" {
+				if err != nil {
+					t.Fatalf("validate: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("validate error = %v, want it to contain %q", err, tt.want)
+			}
+		})
+	}
+
+	// Условие с синтаксической ошибкой отклоняется уже при разборе JSON
+	var c Consequences
+	if err := json.Unmarshal([]byte(`{"conditional":[{"if":"rel(","then":{}}]}`), &c); err == nil {
+		t.Fatal("Unmarshal accepted a conditional with a syntax error")
+	}
+}
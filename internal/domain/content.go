@@ -1,6 +1,11 @@
 package domain
 
-import "github.com/google/uuid"
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/google/uuid"
+)
 
 // NovelContentRequest представляет запрос на генерацию контента новеллы
 // упрощенный клиентом формат.
@@ -76,21 +81,31 @@ type Scene struct {
 	Events       []Event `json:"events"`
 }
 
-type Event struct {
-	EventType   string                 `json:"event_type"`
-	Speaker     string                 `json:"speaker,omitempty"`
-	Text        string                 `json:"text,omitempty"`
-	Character   string                 `json:"character,omitempty"`
-	From        string                 `json:"from,omitempty"`
-	To          string                 `json:"to,omitempty"`
-	Description string                 `json:"description,omitempty"`
-	Choices     []Choice               `json:"choices,omitempty"`
-	Data        map[string]interface{} `json:"data,omitempty"`
-}
-
-type Choice struct {
-	Text         string                 `json:"text"`
-	Consequences map[string]interface{} `json:"consequences,omitempty"`
+// UnmarshalJSON разбирает сохраненную сцену. Раньше тип события не проверялся, поэтому
+// в старых состояниях могут встречаться события неизвестных типов - они пропускаются,
+// чтобы такие состояния оставались читаемыми. Остальные ошибки возвращаются как есть.
+func (s *Scene) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		BackgroundID string            `json:"background_id"`
+		Events       []json.RawMessage `json:"events"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	s.BackgroundID = raw.BackgroundID
+	s.Events = make([]Event, 0, len(raw.Events))
+	for _, rawEvent := range raw.Events {
+		var event Event
+		if err := json.Unmarshal(rawEvent, &event); err != nil {
+			if errors.Is(err, ErrUnknownEventType) {
+				continue
+			}
+			return err
+		}
+		s.Events = append(s.Events, event)
+	}
+	return nil
 }
 
 const (
@@ -129,7 +144,8 @@ type SimplifiedEvent struct {
 }
 
 type SimplifiedChoice struct {
-	Text string `json:"text"`
+	Text     string `json:"text"`
+	Disabled bool   `json:"disabled,omitempty"` // Условие requires не выполнено
 }
 
 type SimplifiedResponse struct {
@@ -137,6 +153,80 @@ type SimplifiedResponse struct {
 	ResponseEvents []SimplifiedEvent `json:"response_events"`
 }
 
+// SimplifyEvents преобразует события сцены в формат для клиента.
+// Последствия выборов клиенту не передаются. Условия requires вариантов выбора
+// проверяются на состоянии state: недоступные варианты скрываются или помечаются
+// disabled. Если state равен nil, условия не проверяются.
+func SimplifyEvents(events []Event, state *NovelState) []SimplifiedEvent {
+	if events == nil {
+		return nil
+	}
+	result := make([]SimplifiedEvent, len(events))
+	for i, event := range events {
+		result[i] = SimplifyEvent(event, state)
+	}
+	return result
+}
+
+// SimplifyEvent преобразует одно событие сцены в формат для клиента (см. SimplifyEvents)
+func SimplifyEvent(event Event, state *NovelState) SimplifiedEvent {
+	simplified := SimplifiedEvent{EventType: event.Type()}
+
+	switch payload := event.Payload.(type) {
+	case DialogueEvent:
+		simplified.Speaker = payload.Speaker
+		simplified.Text = payload.Text
+	case MonologueEvent:
+		simplified.Speaker = payload.Speaker
+		simplified.Text = payload.Text
+	case NarrationEvent:
+		simplified.Text = payload.Text
+	case MoveEvent:
+		simplified.Character = payload.Character
+		simplified.From = payload.From
+		simplified.To = payload.To
+	case EmotionChangeEvent:
+		simplified.Character = payload.Character
+		simplified.From = payload.From
+		simplified.To = payload.To
+	case ChoiceEvent:
+		simplified.Description = payload.Description
+		simplified.Choices = simplifyChoices(payload.Choices, state)
+	case InlineChoiceEvent:
+		simplified.ChoiceID = payload.ChoiceID
+		simplified.Description = payload.Description
+		simplified.Choices = simplifyChoices(payload.Choices, state)
+	case InlineResponseEvent:
+		simplified.ChoiceID = payload.ChoiceID
+		simplified.Responses = make([]SimplifiedResponse, len(payload.Responses))
+		for i, response := range payload.Responses {
+			simplified.Responses[i] = SimplifiedResponse{
+				ChoiceText:     response.ChoiceText,
+				ResponseEvents: SimplifyEvents(response.ResponseEvents, state),
+			}
+		}
+	}
+
+	return simplified
+}
+
+// simplifyChoices оставляет от вариантов выбора только текст и признак недоступности.
+// Вариант, условие которого не удалось вычислить, считается недоступным.
+func simplifyChoices(choices []Choice, state *NovelState) []SimplifiedChoice {
+	simplified := make([]SimplifiedChoice, 0, len(choices))
+	for _, choice := range choices {
+		available := true
+		if state != nil {
+			available, _ = choice.Available(state)
+		}
+		if !available && choice.Hidden() {
+			continue
+		}
+		simplified = append(simplified, SimplifiedChoice{Text: choice.Text, Disabled: !available})
+	}
+	return simplified
+}
+
 type InlineResponseRequest struct {
 	NovelID     uuid.UUID `json:"novel_id"`
 	SceneIndex  int       `json:"scene_index"`
@@ -153,7 +243,8 @@ type InlineResponseResult struct {
 
 // NovelStateChanges представляет изменения состояния, которые нужно вернуть клиенту.
 type NovelStateChanges struct {
-	GlobalFlags    []string               `json:"global_flags,omitempty"`
-	Relationship   map[string]int         `json:"relationship,omitempty"`
-	StoryVariables map[string]interface{} `json:"story_variables,omitempty"`
+	GlobalFlags        []string               `json:"global_flags,omitempty"`
+	RemovedGlobalFlags []string               `json:"removed_global_flags,omitempty"`
+	Relationship       map[string]int         `json:"relationship,omitempty"`
+	StoryVariables     map[string]interface{} `json:"story_variables,omitempty"`
 }
@@ -0,0 +1,103 @@
+package domain
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Источники ревизии черновика
+const (
+	DraftRevisionCreate   = "create"   // Черновик создан по промпту пользователя
+	DraftRevisionRefine   = "refine"   // Черновик уточнен дополнительным промптом
+	DraftRevisionRollback = "rollback" // Восстановлен конфиг ревизии RestoredFrom
+)
+
+// DraftRevision - одна версия конфига черновика. Ревизии нумеруются с 1 и не меняются:
+// откат добавляет новую ревизию с конфигом одной из прежних.
+type DraftRevision struct {
+	DraftID      uuid.UUID       `json:"draft_id"`
+	Revision     int             `json:"revision"`
+	Source       string          `json:"source"`                  // DraftRevision*
+	Prompt       string          `json:"prompt"`                  // Промпт создания или уточнения
+	RestoredFrom *int            `json:"restored_from,omitempty"` // Для отката - восстановленная ревизия
+	Patch        json.RawMessage `json:"patch,omitempty"`         // Для уточнения - изменения конфига от модели (JSON Merge Patch)
+	Config       *NovelConfig    `json:"config,omitempty"`        // Не заполняется в списке ревизий
+	CreatedAt    time.Time       `json:"created_at"`
+}
+
+// ConfigFieldChange - изменение одного поля конфига. Field - путь поля через точку
+// в терминах JSON (например, "player_preferences.tone"); массивы сравниваются целиком.
+// From равно nil, если поля не было, To - если его не стало.
+type ConfigFieldChange struct {
+	Field string      `json:"field"`
+	From  interface{} `json:"from"`
+	To    interface{} `json:"to"`
+}
+
+// DraftRevisionDiff - отличия конфига ревизии To от ревизии From
+type DraftRevisionDiff struct {
+	DraftID uuid.UUID           `json:"draft_id"`
+	From    int                 `json:"from"`
+	To      int                 `json:"to"`
+	Changes []ConfigFieldChange `json:"changes"`
+}
+
+// DiffNovelConfigs сравнивает два конфига поле за полем и возвращает изменения,
+// упорядоченные по пути поля.
+func DiffNovelConfigs(from, to *NovelConfig) ([]ConfigFieldChange, error) {
+	fromFields, err := flattenConfig(from)
+	if err != nil {
+		return nil, err
+	}
+	toFields, err := flattenConfig(to)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := []ConfigFieldChange{}
+	for field, fromValue := range fromFields {
+		toValue, ok := toFields[field]
+		if !ok || !reflect.DeepEqual(fromValue, toValue) {
+			changes = append(changes, ConfigFieldChange{Field: field, From: fromValue, To: toValue})
+		}
+	}
+	for field, toValue := range toFields {
+		if _, ok := fromFields[field]; !ok {
+			changes = append(changes, ConfigFieldChange{Field: field, To: toValue})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Field < changes[j].Field })
+	return changes, nil
+}
+
+// flattenConfig раскладывает конфиг в плоскую карту "путь поля -> значение"
+func flattenConfig(config *NovelConfig) (map[string]interface{}, error) {
+	data, err := json.Marshal(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal config: %w", err)
+	}
+	var tree map[string]interface{}
+	if err := json.Unmarshal(data, &tree); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal config: %w", err)
+	}
+
+	fields := make(map[string]interface{})
+	var walk func(prefix string, node map[string]interface{})
+	walk = func(prefix string, node map[string]interface{}) {
+		for key, value := range node {
+			path := prefix + key
+			if nested, ok := value.(map[string]interface{}); ok {
+				walk(path+".", nested)
+				continue
+			}
+			fields[path] = value
+		}
+	}
+	walk("", tree)
+	return fields, nil
+}
@@ -0,0 +1,57 @@
+package domain
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiffNovelConfigs(t *testing.T) {
+	from := &NovelConfig{Title: "Old", Genre: "fantasy"}
+	from.PlayerPreferences.Tone = "dark"
+	from.PlayerPreferences.Themes = []string{"magic", "war"}
+	from.StoryConfig.CharacterCount = 3
+	from.PromptVersion = "v1"
+
+	to := &NovelConfig{Title: "New", Genre: "fantasy"}
+	to.PlayerPreferences.Tone = "dark"
+	to.PlayerPreferences.Themes = []string{"magic"}
+	to.StoryConfig.CharacterCount = 4
+
+	changes, err := DiffNovelConfigs(from, to)
+	if err != nil {
+		t.Fatalf("DiffNovelConfigs: %v", err)
+	}
+	// Числа сравниваются после JSON, поэтому они float64; массивы отличаются целиком
+	want := []ConfigFieldChange{
+		{Field: "player_preferences.themes", From: []interface{}{"magic", "war"}, To: []interface{}{"magic"}},
+		{Field: "prompt_version", From: "v1", To: nil},
+		{Field: "story_config.character_count", From: float64(3), To: float64(4)},
+		{Field: "title", From: "Old", To: "New"},
+	}
+	if !reflect.DeepEqual(changes, want) {
+		t.Fatalf("DiffNovelConfigs = %+v, want %+v", changes, want)
+	}
+
+	// Поле, которого не было, появляется с пустым From
+	added, err := DiffNovelConfigs(to, from)
+	if err != nil {
+		t.Fatalf("DiffNovelConfigs(reverse): %v", err)
+	}
+	if len(added) != len(want) || added[1] != (ConfigFieldChange{Field: "prompt_version", From: nil, To: "v1"}) {
+		t.Fatalf("DiffNovelConfigs(reverse) = %+v, want prompt_version added", added)
+	}
+}
+
+func TestDiffNovelConfigsEqual(t *testing.T) {
+	config := &NovelConfig{Title: "Same"}
+	config.PlayerPreferences.WorldLore = []string{"lore"}
+
+	changes, err := DiffNovelConfigs(config, config)
+	if err != nil {
+		t.Fatalf("DiffNovelConfigs: %v", err)
+	}
+	// Пустой список, а не nil: в JSON ответа он должен быть [], а не null
+	if changes == nil || len(changes) != 0 {
+		t.Fatalf("DiffNovelConfigs = %#v, want an empty list", changes)
+	}
+}
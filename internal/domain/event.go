@@ -0,0 +1,367 @@
+package domain
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// Типы событий сцены
+const (
+	EventTypeDialogue       = "dialogue"
+	EventTypeMonologue      = "monologue"
+	EventTypeNarration      = "narration"
+	EventTypeMove           = "move"
+	EventTypeEmotionChange  = "emotion_change"
+	EventTypeChoice         = "choice"
+	EventTypeInlineChoice   = "inline_choice"
+	EventTypeInlineResponse = "inline_response"
+)
+
+// ErrUnknownEventType возвращается при разборе события с неизвестным event_type
+var ErrUnknownEventType = errors.New("unknown event type")
+
+// EventPayload - данные события конкретного типа.
+// Реализации: DialogueEvent, MonologueEvent, NarrationEvent, MoveEvent,
+// EmotionChangeEvent, ChoiceEvent, InlineChoiceEvent, InlineResponseEvent.
+type EventPayload interface {
+	EventType() string
+	// validate проверяет обязательные поля события
+	validate() error
+}
+
+// Event - событие сцены. В JSON событие хранится плоским объектом с полем event_type,
+// как его генерирует модель; в Go данные события лежат в типизированном Payload.
+type Event struct {
+	Payload EventPayload
+}
+
+// NewEvent оборачивает данные события в Event
+func NewEvent(payload EventPayload) Event {
+	return Event{Payload: payload}
+}
+
+// Type возвращает event_type события или пустую строку, если событие пустое
+func (e Event) Type() string {
+	if e.Payload == nil {
+		return ""
+	}
+	return e.Payload.EventType()
+}
+
+// Validate проверяет, что у события известный тип и заполнены обязательные поля
+func (e Event) Validate() error {
+	if e.Payload == nil {
+		return fmt.Errorf("event has no payload")
+	}
+	return e.Payload.validate()
+}
+
+// MarshalJSON сериализует событие плоским объектом: {"event_type": ..., поля события}
+func (e Event) MarshalJSON() ([]byte, error) {
+	if e.Payload == nil {
+		return nil, fmt.Errorf("cannot marshal event without payload")
+	}
+	fields, err := json.Marshal(e.Payload)
+	if err != nil {
+		return nil, err
+	}
+	typeJSON, err := json.Marshal(e.Payload.EventType())
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(`{"event_type":`)
+	buf.Write(typeJSON)
+	if inner := bytes.TrimSpace(fields[1 : len(fields)-1]); len(inner) > 0 {
+		buf.WriteByte(',')
+		buf.Write(inner)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// UnmarshalJSON разбирает плоский объект события. Для совместимости с сохраненными
+// состояниями и с ответами модели, нарушающими промпт, поля из вложенного объекта
+// "data" поднимаются на корневой уровень (если там нет поля с тем же именем).
+func (e *Event) UnmarshalJSON(data []byte) error {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return fmt.Errorf("event must be a JSON object: %w", err)
+	}
+
+	if nested, ok := fields["data"]; ok {
+		var dataFields map[string]json.RawMessage
+		if err := json.Unmarshal(nested, &dataFields); err == nil {
+			for key, value := range dataFields {
+				if _, exists := fields[key]; !exists {
+					fields[key] = value
+				}
+			}
+		}
+		delete(fields, "data")
+	}
+
+	var eventType string
+	if rawType, ok := fields["event_type"]; ok {
+		if err := json.Unmarshal(rawType, &eventType); err != nil {
+			return fmt.Errorf("event_type must be a string: %w", err)
+		}
+	}
+	delete(fields, "event_type")
+
+	payload, err := newEventPayload(eventType)
+	if err != nil {
+		return err
+	}
+
+	flat, err := json.Marshal(fields)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(flat, payload); err != nil {
+		return fmt.Errorf("invalid %s event: %w", eventType, err)
+	}
+
+	e.Payload = derefPayload(payload)
+	return nil
+}
+
+// newEventPayload возвращает указатель на пустые данные события типа eventType
+func newEventPayload(eventType string) (interface{}, error) {
+	switch eventType {
+	case EventTypeDialogue:
+		return &DialogueEvent{}, nil
+	case EventTypeMonologue:
+		return &MonologueEvent{}, nil
+	case EventTypeNarration:
+		return &NarrationEvent{}, nil
+	case EventTypeMove:
+		return &MoveEvent{}, nil
+	case EventTypeEmotionChange:
+		return &EmotionChangeEvent{}, nil
+	case EventTypeChoice:
+		return &ChoiceEvent{}, nil
+	case EventTypeInlineChoice:
+		return &InlineChoiceEvent{}, nil
+	case EventTypeInlineResponse:
+		return &InlineResponseEvent{}, nil
+	case "":
+		return nil, fmt.Errorf("%w: event_type is missing", ErrUnknownEventType)
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnknownEventType, eventType)
+	}
+}
+
+// derefPayload превращает указатель из newEventPayload в значение, которое хранится в Event
+func derefPayload(payload interface{}) EventPayload {
+	switch p := payload.(type) {
+	case *DialogueEvent:
+		return *p
+	case *MonologueEvent:
+		return *p
+	case *NarrationEvent:
+		return *p
+	case *MoveEvent:
+		return *p
+	case *EmotionChangeEvent:
+		return *p
+	case *ChoiceEvent:
+		return *p
+	case *InlineChoiceEvent:
+		return *p
+	case *InlineResponseEvent:
+		return *p
+	}
+	return nil
+}
+
+// DialogueEvent - реплика персонажа или игрока
+type DialogueEvent struct {
+	Speaker string `json:"speaker"`
+	Text    string `json:"text"`
+}
+
+func (DialogueEvent) EventType() string { return EventTypeDialogue }
+
+func (d DialogueEvent) validate() error {
+	if d.Speaker == "" || d.Text == "" {
+		return fmt.Errorf("dialogue event requires speaker and text")
+	}
+	return nil
+}
+
+// MonologueEvent - мысли протагониста
+type MonologueEvent struct {
+	Speaker string `json:"speaker,omitempty"`
+	Text    string `json:"text"`
+}
+
+func (MonologueEvent) EventType() string { return EventTypeMonologue }
+
+func (m MonologueEvent) validate() error {
+	if m.Text == "" {
+		return fmt.Errorf("monologue event requires text")
+	}
+	return nil
+}
+
+// NarrationEvent - описание окружения или атмосферы
+type NarrationEvent struct {
+	Text string `json:"text"`
+}
+
+func (NarrationEvent) EventType() string { return EventTypeNarration }
+
+func (n NarrationEvent) validate() error {
+	if n.Text == "" {
+		return fmt.Errorf("narration event requires text")
+	}
+	return nil
+}
+
+// MoveEvent - перемещение персонажа между позициями на экране
+type MoveEvent struct {
+	Character string `json:"character"`
+	From      string `json:"from,omitempty"`
+	To        string `json:"to"`
+}
+
+func (MoveEvent) EventType() string { return EventTypeMove }
+
+func (m MoveEvent) validate() error {
+	if m.Character == "" || m.To == "" {
+		return fmt.Errorf("move event requires character and to")
+	}
+	return nil
+}
+
+// EmotionChangeEvent - смена эмоции персонажа
+type EmotionChangeEvent struct {
+	Character string `json:"character"`
+	From      string `json:"from,omitempty"`
+	To        string `json:"to"`
+}
+
+func (EmotionChangeEvent) EventType() string { return EventTypeEmotionChange }
+
+func (c EmotionChangeEvent) validate() error {
+	if c.Character == "" || c.To == "" {
+		return fmt.Errorf("emotion_change event requires character and to")
+	}
+	return nil
+}
+
+// ChoiceEvent - выбор игрока в конце сцены, переводящий историю к следующей сцене
+type ChoiceEvent struct {
+	Description string   `json:"description,omitempty"`
+	Choices     []Choice `json:"choices"`
+}
+
+func (ChoiceEvent) EventType() string { return EventTypeChoice }
+
+func (c ChoiceEvent) validate() error {
+	return validateChoices(EventTypeChoice, c.Choices)
+}
+
+// InlineChoiceEvent - выбор посреди сцены, не меняющий индекс сцены
+type InlineChoiceEvent struct {
+	ChoiceID    string   `json:"choice_id"`
+	Description string   `json:"description,omitempty"`
+	Choices     []Choice `json:"choices"`
+}
+
+func (InlineChoiceEvent) EventType() string { return EventTypeInlineChoice }
+
+func (c InlineChoiceEvent) validate() error {
+	if c.ChoiceID == "" {
+		return fmt.Errorf("inline_choice event requires choice_id")
+	}
+	return validateChoices(EventTypeInlineChoice, c.Choices)
+}
+
+// InlineResponseEvent - события, которые показываются после каждого варианта inline_choice
+type InlineResponseEvent struct {
+	ChoiceID  string           `json:"choice_id"`
+	Responses []InlineResponse `json:"responses"`
+}
+
+func (InlineResponseEvent) EventType() string { return EventTypeInlineResponse }
+
+func (r InlineResponseEvent) validate() error {
+	if r.ChoiceID == "" {
+		return fmt.Errorf("inline_response event requires choice_id")
+	}
+	if len(r.Responses) == 0 {
+		return fmt.Errorf("inline_response event requires responses")
+	}
+	for i, response := range r.Responses {
+		if response.ChoiceText == "" {
+			return fmt.Errorf("inline_response responses[%d] requires choice_text", i)
+		}
+		if err := response.Consequences.validate(); err != nil {
+			return fmt.Errorf("inline_response responses[%d].consequences: %w", i, err)
+		}
+		for j, event := range response.ResponseEvents {
+			if err := event.Validate(); err != nil {
+				return fmt.Errorf("inline_response responses[%d].response_events[%d]: %w", i, j, err)
+			}
+		}
+	}
+	return nil
+}
+
+// InlineResponse - реакция на один из вариантов inline_choice
+type InlineResponse struct {
+	ChoiceText     string  `json:"choice_text"`
+	ResponseEvents []Event `json:"response_events"`
+	// Последствия, которые применяются при выборе этого варианта
+	Consequences        *Consequences          `json:"consequences,omitempty"`
+	RelationshipChanges map[string]int         `json:"relationship_changes,omitempty"`
+	AddGlobalFlags      []string               `json:"add_global_flags,omitempty"`
+	StoryVariables      map[string]interface{} `json:"story_variables,omitempty"`
+}
+
+// Choice - вариант выбора игрока
+type Choice struct {
+	Text string `json:"text"`
+	// Requires - условие, при котором вариант доступен; WhenLocked - что делать
+	// с недоступным вариантом: WhenLockedDisable (по умолчанию) или WhenLockedHide
+	Requires     *Condition    `json:"requires,omitempty"`
+	WhenLocked   string        `json:"when_locked,omitempty"`
+	Consequences *Consequences `json:"consequences,omitempty"`
+}
+
+// Available сообщает, выполнено ли условие requires варианта на состоянии state
+func (c Choice) Available(state *NovelState) (bool, error) {
+	if c.Requires == nil {
+		return true, nil
+	}
+	return c.Requires.Eval(state)
+}
+
+// Hidden сообщает, что недоступный вариант нужно скрыть, а не показывать неактивным
+func (c Choice) Hidden() bool {
+	return c.WhenLocked == WhenLockedHide
+}
+
+// validateChoices проверяет варианты выбора события eventType
+func validateChoices(eventType string, choices []Choice) error {
+	if len(choices) == 0 {
+		return fmt.Errorf("%s event requires choices", eventType)
+	}
+	for i, choice := range choices {
+		if choice.Text == "" {
+			return fmt.Errorf("%s choices[%d] requires text", eventType, i)
+		}
+		if choice.WhenLocked != "" && choice.WhenLocked != WhenLockedDisable && choice.WhenLocked != WhenLockedHide {
+			return fmt.Errorf("%s choices[%d]: when_locked must be %q or %q", eventType, i, WhenLockedDisable, WhenLockedHide)
+		}
+		if err := choice.Consequences.validate(); err != nil {
+			return fmt.Errorf("%s choices[%d].consequences: %w", eventType, i, err)
+		}
+	}
+	return nil
+}
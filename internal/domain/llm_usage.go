@@ -0,0 +1,60 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Операции, для которых вызывается модель
+const (
+	LLMOperationDraft  = "draft"  // Создание черновика
+	LLMOperationRefine = "refine" // Уточнение черновика
+	LLMOperationSetup  = "setup"  // Генерация сетапа
+	LLMOperationScene  = "scene"  // Генерация сцены
+)
+
+// Группировки агрегатов использования модели
+const (
+	LLMUsageByUser  = "users"  // По пользователям
+	LLMUsageByNovel = "novels" // По новеллам
+	LLMUsageByDay   = "days"   // По дням (UTC)
+)
+
+// LLMUsage - запись об одном вызове модели
+type LLMUsage struct {
+	UsageID          uuid.UUID  `json:"usage_id"`
+	UserID           string     `json:"user_id"`
+	NovelID          *uuid.UUID `json:"novel_id,omitempty"` // nil для черновиков, у которых еще нет новеллы
+	Operation        string     `json:"operation"`
+	Provider         string     `json:"provider"`
+	Model            string     `json:"model"`
+	PromptTokens     int        `json:"prompt_tokens"`
+	CompletionTokens int        `json:"completion_tokens"`
+	TotalTokens      int        `json:"total_tokens"`
+	Cost             float64    `json:"cost"` // В долларах по ценам на момент вызова
+	LatencyMs        int64      `json:"latency_ms"`
+	CreatedAt        time.Time  `json:"created_at"`
+}
+
+// LLMUsageFilter ограничивает выборку записей для агрегатов.
+// Пустые UserID и NovelID означают "все".
+type LLMUsageFilter struct {
+	From    time.Time
+	To      time.Time
+	UserID  string
+	NovelID *uuid.UUID
+	Limit   int
+}
+
+// LLMUsageSummary - агрегат использования модели по ключу группировки
+// (ID пользователя, ID новеллы или дата YYYY-MM-DD)
+type LLMUsageSummary struct {
+	Key              string  `json:"key"`
+	Calls            int64   `json:"calls"`
+	PromptTokens     int64   `json:"prompt_tokens"`
+	CompletionTokens int64   `json:"completion_tokens"`
+	TotalTokens      int64   `json:"total_tokens"`
+	Cost             float64 `json:"cost"`
+	AvgLatencyMs     int64   `json:"avg_latency_ms"`
+}
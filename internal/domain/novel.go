@@ -11,19 +11,42 @@ import (
 type NovelDraft struct {
 	DraftID   uuid.UUID   `json:"draft_id"`
 	UserID    string      `json:"user_id"`
+	Revision  int         `json:"revision"` // Номер текущей ревизии (см. DraftRevision)
 	Config    NovelConfig `json:"config"`
 	CreatedAt time.Time   `json:"created_at"`
 	UpdatedAt time.Time   `json:"updated_at"`
 }
 
+// NovelDraftSummary - краткая информация о черновике для списка черновиков
+type NovelDraftSummary struct {
+	DraftID          uuid.UUID `json:"draft_id"`
+	Title            string    `json:"title"`
+	ShortDescription string    `json:"short_description"`
+	Genre            string    `json:"genre"`
+	Revision         int       `json:"revision"`
+	CreatedAt        time.Time `json:"created_at"`
+	UpdatedAt        time.Time `json:"updated_at"`
+}
+
 // NovelDraftRepository определяет интерфейс для хранилища черновиков новелл
 type NovelDraftRepository interface {
-	// SaveDraft сохраняет новый черновик
-	SaveDraft(ctx context.Context, userID string, draftID uuid.UUID, configJSON []byte) error
+	// SaveDraft сохраняет новый черновик вместе с его первой ревизией (prompt - промпт создания)
+	SaveDraft(ctx context.Context, userID string, draftID uuid.UUID, configJSON []byte, prompt string) error
 	// GetDraftConfigJSON получает сериализованный конфиг черновика по ID
 	GetDraftConfigJSON(ctx context.Context, userID string, draftID uuid.UUID) ([]byte, error)
-	// UpdateDraftConfigJSON обновляет конфиг существующего черновика
-	UpdateDraftConfigJSON(ctx context.Context, userID string, draftID uuid.UUID, configJSON []byte) error
-	// DeleteDraft удаляет черновик
+	// GetDraft возвращает черновик вместе с конфигом. Возвращает repository.ErrNotFound, если его нет
+	GetDraft(ctx context.Context, userID string, draftID uuid.UUID) (*NovelDraft, error)
+	// ListDrafts возвращает черновики пользователя, последние измененные первыми
+	ListDrafts(ctx context.Context, userID string, limit, offset int) ([]NovelDraftSummary, error)
+	// AppendDraftRevision атомарно заменяет конфиг черновика на configJSON и добавляет ревизию
+	// с источником, промптом и RestoredFrom из revision. Заполняет revision.Revision и CreatedAt.
+	// Возвращает repository.ErrNotFound, если черновика нет.
+	AppendDraftRevision(ctx context.Context, userID string, draftID uuid.UUID, configJSON []byte, revision *DraftRevision) error
+	// ListDraftRevisions возвращает ревизии черновика без конфигов, по возрастанию номера
+	ListDraftRevisions(ctx context.Context, userID string, draftID uuid.UUID) ([]DraftRevision, error)
+	// GetDraftRevision возвращает ревизию черновика вместе с конфигом.
+	// Возвращает repository.ErrNotFound, если черновика или ревизии нет
+	GetDraftRevision(ctx context.Context, userID string, draftID uuid.UUID, revision int) (*DraftRevision, error)
+	// DeleteDraft удаляет черновик. Возвращает repository.ErrNotFound, если его нет
 	DeleteDraft(ctx context.Context, userID string, draftID uuid.UUID) error
 }
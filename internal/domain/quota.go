@@ -0,0 +1,26 @@
+package domain
+
+import "time"
+
+// Виды квот на генерацию
+const (
+	QuotaDrafts = "drafts" // Создание и уточнение черновиков в сутки
+	QuotaScenes = "scenes" // Запросы генерации сетапа и сцен в час
+	QuotaTokens = "tokens" // Токены модели в месяц
+)
+
+// QuotaUsage - использование одной квоты в текущем окне
+type QuotaUsage struct {
+	Limit     int64     `json:"limit"` // 0 вместе с Unlimited - квота не ограничена
+	Used      int64     `json:"used"`
+	Remaining int64     `json:"remaining"`
+	ResetsAt  time.Time `json:"resets_at"`
+	Unlimited bool      `json:"unlimited,omitempty"`
+}
+
+// QuotaStatus - остаток всех квот пользователя
+type QuotaStatus struct {
+	Drafts QuotaUsage `json:"drafts"`
+	Scenes QuotaUsage `json:"scenes"`
+	Tokens QuotaUsage `json:"tokens"`
+}
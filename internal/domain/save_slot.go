@@ -0,0 +1,21 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// SaveSlot - именованное сохранение прохождения новеллы пользователем.
+// Хранит копию прогресса (user_story_progress) всех пройденных сцен, чтобы после загрузки
+// можно было продолжить историю, перезапуститься с любой из этих сцен или посмотреть их.
+type SaveSlot struct {
+	SlotID     uuid.UUID           `json:"slot_id"`
+	NovelID    uuid.UUID           `json:"novel_id"`
+	UserID     string              `json:"-"`
+	Name       string              `json:"name"`
+	SceneIndex int                 `json:"scene_index"` // Текущая сцена на момент сохранения
+	Progress   []UserStoryProgress `json:"-"`           // Прогресс сцен 0..SceneIndex
+	CreatedAt  time.Time           `json:"created_at"`
+	UpdatedAt  time.Time           `json:"updated_at"`
+}
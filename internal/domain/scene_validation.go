@@ -0,0 +1,133 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// SceneCast - персонажи и фоны из сетапа новеллы, на которые может ссылаться сцена
+type SceneCast struct {
+	PlayerName  string
+	Characters  []Character
+	Backgrounds []Background
+}
+
+// NewSceneCast собирает SceneCast из состояния новеллы
+func NewSceneCast(state *NovelState) SceneCast {
+	return SceneCast{
+		PlayerName:  state.PlayerName,
+		Characters:  state.Characters,
+		Backgrounds: state.Backgrounds,
+	}
+}
+
+// ValidateScene проверяет сцену: background_id должен быть фоном из сетапа,
+// говорящие - персонажами сетапа или игроком, персонажи в move/emotion_change и
+// в scene.characters - персонажами сетапа, а inline_response должен ссылаться
+// на предшествующий inline_choice. Возвращает все найденные нарушения разом (errors.Join).
+func (c SceneCast) ValidateScene(scene SceneContent) error {
+	var errs []error
+
+	if !c.hasBackground(scene.BackgroundID) {
+		errs = append(errs, fmt.Errorf("background_id %q is not one of the setup backgrounds (%s)",
+			scene.BackgroundID, strings.Join(c.backgroundIDs(), ", ")))
+	}
+	for i, character := range scene.Characters {
+		if !c.hasCharacter(character.Name) {
+			errs = append(errs, fmt.Errorf("characters[%d]: %q is not a setup character", i, character.Name))
+		}
+	}
+	if len(scene.Events) == 0 {
+		errs = append(errs, fmt.Errorf("scene has no events"))
+	}
+
+	inlineChoices := make(map[string]bool)
+	errs = append(errs, c.validateEvents("events", scene.Events, inlineChoices)...)
+
+	return errors.Join(errs...)
+}
+
+// validateEvents проверяет список событий; path - путь к списку для сообщений об ошибках
+func (c SceneCast) validateEvents(path string, events []Event, inlineChoices map[string]bool) []error {
+	var errs []error
+	for i, event := range events {
+		eventPath := fmt.Sprintf("%s[%d]", path, i)
+		if err := event.Validate(); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", eventPath, err))
+			continue
+		}
+
+		switch payload := event.Payload.(type) {
+		case DialogueEvent:
+			if !c.hasSpeaker(payload.Speaker) {
+				errs = append(errs, fmt.Errorf("%s: dialogue speaker %q is neither a setup character nor the player %q",
+					eventPath, payload.Speaker, c.PlayerName))
+			}
+		case MonologueEvent:
+			if payload.Speaker != "" && !c.hasSpeaker(payload.Speaker) {
+				errs = append(errs, fmt.Errorf("%s: monologue speaker %q is neither a setup character nor the player %q",
+					eventPath, payload.Speaker, c.PlayerName))
+			}
+		case MoveEvent:
+			if !c.hasCharacter(payload.Character) {
+				errs = append(errs, fmt.Errorf("%s: move character %q is not a setup character", eventPath, payload.Character))
+			}
+		case EmotionChangeEvent:
+			if !c.hasCharacter(payload.Character) {
+				errs = append(errs, fmt.Errorf("%s: emotion_change character %q is not a setup character", eventPath, payload.Character))
+			}
+		case InlineChoiceEvent:
+			inlineChoices[payload.ChoiceID] = true
+		case InlineResponseEvent:
+			if !inlineChoices[payload.ChoiceID] {
+				errs = append(errs, fmt.Errorf("%s: inline_response choice_id %q has no preceding inline_choice", eventPath, payload.ChoiceID))
+			}
+			for j, response := range payload.Responses {
+				responsePath := fmt.Sprintf("%s.responses[%d].response_events", eventPath, j)
+				errs = append(errs, c.validateEvents(responsePath, response.ResponseEvents, inlineChoices)...)
+			}
+		}
+	}
+	return errs
+}
+
+// hasSpeaker сообщает, может ли name говорить в сцене: это персонаж сетапа или игрок
+func (c SceneCast) hasSpeaker(name string) bool {
+	return sameName(name, c.PlayerName) || c.hasCharacter(name)
+}
+
+// hasCharacter сообщает, есть ли персонаж name в сетапе
+func (c SceneCast) hasCharacter(name string) bool {
+	for _, character := range c.Characters {
+		if sameName(name, character.Name) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasBackground сообщает, есть ли фон id в сетапе
+func (c SceneCast) hasBackground(id string) bool {
+	for _, background := range c.Backgrounds {
+		if background.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// backgroundIDs возвращает ID фонов сетапа для сообщений об ошибках
+func (c SceneCast) backgroundIDs() []string {
+	ids := make([]string, len(c.Backgrounds))
+	for i, background := range c.Backgrounds {
+		ids[i] = background.ID
+	}
+	return ids
+}
+
+// sameName сравнивает имена без учета регистра и окружающих пробелов
+func sameName(a, b string) bool {
+	a, b = strings.TrimSpace(a), strings.TrimSpace(b)
+	return a != "" && strings.EqualFold(a, b)
+}
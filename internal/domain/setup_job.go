@@ -0,0 +1,37 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Статусы задачи генерации сетапа новеллы
+const (
+	SetupJobQueued  = "queued"  // Ожидает воркера (в том числе повторную попытку после ошибки)
+	SetupJobRunning = "running" // Выполняется воркером
+	SetupJobFailed  = "failed"  // Все попытки исчерпаны, нужен ручной повтор
+	SetupJobDone    = "done"    // Сетап сгенерирован и сохранен
+)
+
+// SetupJob представляет задачу на генерацию сетапа новеллы в очереди
+type SetupJob struct {
+	JobID       uuid.UUID  `json:"job_id"`
+	NovelID     uuid.UUID  `json:"novel_id"`
+	UserID      string     `json:"-"`
+	Status      string     `json:"status"`
+	Attempts    int        `json:"attempts"`
+	MaxAttempts int        `json:"max_attempts"`
+	LastError   string     `json:"last_error,omitempty"`
+	RunAfter    time.Time  `json:"run_after"`
+	LockedAt    *time.Time `json:"locked_at,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+// FailedSetupJob - упавшая задача сетапа для административного API: с владельцем и названием новеллы
+type FailedSetupJob struct {
+	SetupJob
+	UserID     string `json:"user_id"`
+	NovelTitle string `json:"novel_title"`
+}
@@ -30,6 +30,7 @@ type NovelState struct {
 	StorySummarySoFar    string                 `json:"story_summary_so_far,omitempty"`
 	FutureDirection      string                 `json:"future_direction,omitempty"`
 	IsAdultContent       bool                   `json:"is_adult_content"`
+	PromptVersion        string                 `json:"prompt_version,omitempty"` // Версия промпта, по которой сгенерирована текущая сцена (или сетап)
 }
 
 // NovelMetadata представляет краткую информацию о новелле
@@ -48,6 +49,7 @@ type NovelMetadata struct {
 type ListNovelsRequest struct {
 	Limit  int        `json:"limit,omitempty"`
 	Cursor *uuid.UUID `json:"cursor,omitempty"`
+	Scope  string     `json:"scope,omitempty"` // domain.NovelScope*, по умолчанию свои новеллы
 }
 
 type ListNovelsResponse struct {
@@ -62,6 +64,7 @@ type NovelListItem struct {
 	Title                 string    `json:"title"`
 	ShortDescription      string    `json:"short_description"`
 	IsAdultContent        bool      `json:"is_adult_content"`
+	Visibility            string    `json:"visibility"`
 	CreatedAt             time.Time `json:"created_at"`
 	UpdatedAt             time.Time `json:"updated_at"`
 	IsSetuped             bool      `json:"is_setuped"`
@@ -72,6 +75,8 @@ type NovelListItem struct {
 
 type NovelDetailsResponse struct {
 	NovelID          uuid.UUID   `json:"novel_id"`
+	UserID           string      `json:"user_id"` // Владелец (автор) новеллы
+	Visibility       string      `json:"visibility"`
 	Title            string      `json:"title"`
 	ShortDescription string      `json:"short_description"`
 	Genre            string      `json:"genre"`
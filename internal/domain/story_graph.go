@@ -0,0 +1,108 @@
+package domain
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// StoryStateRef - ссылка на сохраненное состояние новеллы (строка novel_states)
+type StoryStateRef struct {
+	SceneIndex int
+	StateHash  string
+}
+
+// StoryPathStep - шаг пути игрока по новелле (строка user_story_progress)
+type StoryPathStep struct {
+	UserID          string
+	SceneIndex      int
+	StateHash       string
+	PreviousChoices []string
+}
+
+// StoryGraph - граф ветвлений новеллы: узлы - состояния (индекс сцены + хеш состояния),
+// ребра - выборы игроков, которые переводят из одного состояния в другое.
+type StoryGraph struct {
+	NovelID uuid.UUID        `json:"novel_id"`
+	Nodes   []StoryGraphNode `json:"nodes"`
+	Edges   []StoryGraphEdge `json:"edges"`
+}
+
+// StoryGraphNode - узел графа ветвлений
+type StoryGraphNode struct {
+	ID         string `json:"id"` // "<scene_index>:<state_hash>"
+	SceneIndex int    `json:"scene_index"`
+	StateHash  string `json:"state_hash"`
+	Players    int    `json:"players"` // Сколько игроков прошли через это состояние
+	Cached     bool   `json:"cached"`  // Сцена для состояния сохранена в novel_states
+}
+
+// StoryGraphEdge - переход между состояниями
+type StoryGraphEdge struct {
+	From    string `json:"from"`
+	To      string `json:"to"`
+	Choice  string `json:"choice"`  // Пусто, если выбор не удалось определить
+	Players int    `json:"players"` // Сколько игроков сделали этот выбор
+}
+
+// StoryGraphNodeID возвращает ID узла графа для состояния
+func StoryGraphNodeID(sceneIndex int, stateHash string) string {
+	return fmt.Sprintf("%d:%s", sceneIndex, stateHash)
+}
+
+// DOT возвращает граф в формате Graphviz DOT. Толщина ребра пропорциональна
+// числу игроков, узлы без игроков (только из кеша) рисуются пунктиром.
+func (g *StoryGraph) DOT() string {
+	maxPlayers := 1
+	for _, edge := range g.Edges {
+		if edge.Players > maxPlayers {
+			maxPlayers = edge.Players
+		}
+	}
+
+	var sb strings.Builder
+	sb.WriteString("digraph story {\n")
+	sb.WriteString("  rankdir=LR;\n")
+	sb.WriteString("  node [shape=box, fontname=\"Helvetica\"];\n")
+	sb.WriteString("  edge [fontname=\"Helvetica\"];\n")
+
+	for _, node := range g.Nodes {
+		label := fmt.Sprintf("Scene %d\n%s\nplayers: %d", node.SceneIndex, shortHash(node.StateHash), node.Players)
+		style := ""
+		if node.Players == 0 {
+			style = ", style=dashed"
+		}
+		fmt.Fprintf(&sb, "  %s [label=%s%s];\n", dotQuote(node.ID), dotQuote(label), style)
+	}
+	for _, edge := range g.Edges {
+		choice := edge.Choice
+		if choice == "" {
+			choice = "?"
+		}
+		label := fmt.Sprintf("%s (%d)", choice, edge.Players)
+		penWidth := 1 + 4*float64(edge.Players)/float64(maxPlayers)
+		fmt.Fprintf(&sb, "  %s -> %s [label=%s, penwidth=%.1f];\n",
+			dotQuote(edge.From), dotQuote(edge.To), dotQuote(label), penWidth)
+	}
+
+	sb.WriteString("}\n")
+	return sb.String()
+}
+
+// shortHash сокращает хеш состояния для подписи узла
+func shortHash(hash string) string {
+	if len(hash) > 12 {
+		return hash[:12]
+	}
+	return hash
+}
+
+// dotQuote экранирует строку для DOT
+func dotQuote(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+	s = strings.ReplaceAll(s, "\r", "")
+	s = strings.ReplaceAll(s, "\n", `\n`)
+	return `"` + s + `"`
+}
@@ -0,0 +1,68 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Роли пользователей. Каждая следующая роль включает права предыдущих
+const (
+	RolePlayer    = "player"    // Прохождение новелл
+	RoleAuthor    = "author"    // Создание новелл по черновикам
+	RoleModerator = "moderator" // Просмотр всех новелл и упавших генераций, удаление новелл
+	RoleAdmin     = "admin"     // Управление пользователями и владельцами новелл, расход модели
+)
+
+// DefaultUserRole - роль новой учетной записи
+const DefaultUserRole = RoleAuthor
+
+// roleRanks - порядок ролей по возрастанию прав
+var roleRanks = map[string]int{
+	RolePlayer:    1,
+	RoleAuthor:    2,
+	RoleModerator: 3,
+	RoleAdmin:     4,
+}
+
+// IsValidRole сообщает, существует ли роль
+func IsValidRole(role string) bool {
+	_, ok := roleRanks[role]
+	return ok
+}
+
+// RoleAtLeast сообщает, что роль role дает права роли min. Неизвестная роль не дает никаких прав.
+func RoleAtLeast(role, min string) bool {
+	rank, ok := roleRanks[role]
+	return ok && rank >= roleRanks[min]
+}
+
+// User - учетная запись пользователя
+type User struct {
+	UserID       uuid.UUID  `json:"user_id"`
+	Username     string     `json:"username"`
+	PasswordHash string     `json:"-"`
+	Role         string     `json:"role"`
+	DisabledAt   *time.Time `json:"disabled_at,omitempty"` // Учетная запись заблокирована администратором
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+}
+
+// RefreshToken - выданный refresh-токен. Сам токен не хранится, только его хеш.
+// Токены одной цепочки ротаций (одного входа) имеют общий FamilyID.
+type RefreshToken struct {
+	TokenID   uuid.UUID
+	UserID    uuid.UUID
+	FamilyID  uuid.UUID
+	ExpiresAt time.Time
+	RevokedAt *time.Time
+	CreatedAt time.Time
+}
+
+// AuthTokens - пара токенов, которую получает клиент при входе и обновлении
+type AuthTokens struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"` // Срок действия access-токена в секундах
+}
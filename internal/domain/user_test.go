@@ -0,0 +1,21 @@
+package domain
+
+import "testing"
+
+func TestRoleAtLeast(t *testing.T) {
+	roles := []string{RolePlayer, RoleAuthor, RoleModerator, RoleAdmin}
+	for i, role := range roles {
+		for j, min := range roles {
+			if got, want := RoleAtLeast(role, min), i >= j; got != want {
+				t.Errorf("RoleAtLeast(%q, %q) = %v, want %v", role, min, got, want)
+			}
+		}
+	}
+
+	// Неизвестная или пустая роль не дает никаких прав
+	for _, role := range []string{"", "root", "Admin"} {
+		if RoleAtLeast(role, RolePlayer) {
+			t.Errorf("RoleAtLeast(%q, player) = true", role)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package domain
+
+import "github.com/google/uuid"
+
+// Видимость новеллы. Новая новелла приватная
+const (
+	VisibilityPrivate  = "private"  // Только владелец (и модераторы)
+	VisibilityUnlisted = "unlisted" // Не попадает в общий список, доступна по ссылке
+	VisibilityPublic   = "public"   // В общем списке, доступна всем
+)
+
+// IsValidVisibility сообщает, существует ли видимость
+func IsValidVisibility(visibility string) bool {
+	switch visibility {
+	case VisibilityPrivate, VisibilityUnlisted, VisibilityPublic:
+		return true
+	}
+	return false
+}
+
+// Области списка новелл (параметр scope)
+const (
+	NovelScopeMine   = "mine"   // Новеллы пользователя (по умолчанию)
+	NovelScopePublic = "public" // Публичные новеллы всех пользователей
+	NovelScopeAll    = "all"    // Все новеллы (только для модераторов)
+)
+
+// NovelAccess - данные новеллы, нужные для проверки доступа
+type NovelAccess struct {
+	OwnerID    string
+	Visibility string
+	Granted    bool // Пользователь открывал ссылку на новеллу
+}
+
+// CanView сообщает, может ли пользователь userID с ролью role читать и проходить новеллу.
+// Скрытую (unlisted) новеллу видят те, кто открыл ссылку на нее.
+func (a *NovelAccess) CanView(userID, role string) bool {
+	switch {
+	case a.OwnerID == userID, RoleAtLeast(role, RoleModerator):
+		return true
+	case a.Visibility == VisibilityPublic:
+		return true
+	case a.Visibility == VisibilityUnlisted:
+		return a.Granted
+	default:
+		return false
+	}
+}
+
+// NovelShareLink - ссылка на новеллу для других пользователей
+type NovelShareLink struct {
+	NovelID    uuid.UUID `json:"novel_id"`
+	ShareToken string    `json:"share_token"`
+	Visibility string    `json:"visibility"`
+}
@@ -0,0 +1,42 @@
+package domain
+
+import "testing"
+
+func TestNovelAccessCanView(t *testing.T) {
+	const owner, viewer = "owner", "viewer"
+
+	tests := []struct {
+		visibility string
+		userID     string
+		role       string
+		granted    bool
+		want       bool
+	}{
+		{VisibilityPrivate, owner, RolePlayer, false, true},
+		{VisibilityPrivate, viewer, RoleAuthor, false, false},
+		{VisibilityPrivate, viewer, RoleAuthor, true, false}, // Ссылка не открывает приватную новеллу
+		{VisibilityPrivate, viewer, RoleModerator, false, true},
+		{VisibilityPrivate, viewer, RoleAdmin, false, true},
+		{VisibilityPrivate, viewer, "", false, false},
+
+		{VisibilityUnlisted, owner, RolePlayer, false, true},
+		{VisibilityUnlisted, viewer, RoleAuthor, false, false},
+		{VisibilityUnlisted, viewer, RolePlayer, true, true},
+		{VisibilityUnlisted, viewer, RoleModerator, false, true},
+
+		{VisibilityPublic, owner, RolePlayer, false, true},
+		{VisibilityPublic, viewer, RolePlayer, false, true},
+		{VisibilityPublic, viewer, "", false, true},
+		{VisibilityPublic, viewer, RolePlayer, true, true},
+
+		{"unknown", viewer, RoleAuthor, true, false},
+		{"unknown", owner, RoleAuthor, false, true},
+	}
+	for _, tt := range tests {
+		access := NovelAccess{OwnerID: owner, Visibility: tt.visibility, Granted: tt.granted}
+		if got := access.CanView(tt.userID, tt.role); got != tt.want {
+			t.Errorf("%s novel, user %s, role %q, granted %v: CanView = %v, want %v",
+				tt.visibility, tt.userID, tt.role, tt.granted, got, tt.want)
+		}
+	}
+}
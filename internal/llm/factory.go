@@ -0,0 +1,50 @@
+package llm
+
+import (
+	"fmt"
+	"novel-server/internal/config"
+)
+
+// llamaCppDefaultBaseURL - адрес OpenAI-совместимого API llama.cpp server по умолчанию.
+const llamaCppDefaultBaseURL = "http://localhost:8080/v1"
+
+// NewProvider создает провайдера языковой модели по конфигурации.
+// Провайдер оборачивается в RetryingProvider, а если задан cfg.RecordDir - еще и в RecordingProvider.
+func NewProvider(cfg config.LLMConfig) (LLMProvider, error) {
+	base, err := newBaseProvider(cfg)
+	if err != nil {
+		return nil, err
+	}
+	var provider LLMProvider = NewRetryingProvider(base, cfg.Retry)
+	if cfg.RecordDir != "" {
+		return NewRecordingProvider(provider, cfg.RecordDir)
+	}
+	return provider, nil
+}
+
+// newBaseProvider создает провайдера без оберток.
+func newBaseProvider(cfg config.LLMConfig) (LLMProvider, error) {
+	switch cfg.Provider {
+	case "openrouter", "":
+		baseURL := cfg.BaseURL
+		if baseURL == "" {
+			baseURL = OpenRouterBaseURL
+		}
+		return NewOpenAIProvider("openrouter", baseURL, cfg.APIKey, cfg.ModelName, cfg.Timeout), nil
+	case "openai":
+		// Пустой BaseURL - официальный API OpenAI
+		return NewOpenAIProvider("openai", cfg.BaseURL, cfg.APIKey, cfg.ModelName, cfg.Timeout), nil
+	case "llamacpp":
+		baseURL := cfg.BaseURL
+		if baseURL == "" {
+			baseURL = llamaCppDefaultBaseURL
+		}
+		return NewOpenAIProvider("llamacpp", baseURL, cfg.APIKey, cfg.ModelName, cfg.Timeout), nil
+	case "ollama":
+		return NewOllamaProvider(cfg.BaseURL, cfg.ModelName, cfg.Timeout), nil
+	case "scripted", "fake": // fake - прежнее имя
+		return LoadScriptedProvider(cfg.FixturesDir)
+	default:
+		return nil, fmt.Errorf("unknown LLM provider: %s", cfg.Provider)
+	}
+}
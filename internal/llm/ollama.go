@@ -0,0 +1,215 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// OllamaDefaultBaseURL - адрес локального сервера Ollama по умолчанию.
+const OllamaDefaultBaseURL = "http://localhost:11434"
+
+// OllamaProvider работает с нативным API Ollama (/api/chat).
+type OllamaProvider struct {
+	baseURL    string
+	modelName  string
+	httpClient *http.Client
+}
+
+// NewOllamaProvider создает провайдера для локального сервера Ollama.
+func NewOllamaProvider(baseURL, model string, timeout time.Duration) *OllamaProvider {
+	if baseURL == "" {
+		baseURL = OllamaDefaultBaseURL
+	}
+	return &OllamaProvider{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		modelName:  model,
+		httpClient: &http.Client{Timeout: timeout},
+	}
+}
+
+// ollamaChatRequest - тело запроса к /api/chat.
+type ollamaChatRequest struct {
+	Model    string                 `json:"model"`
+	Messages []Message              `json:"messages"`
+	Stream   bool                   `json:"stream"`
+	Format   string                 `json:"format,omitempty"`
+	Options  map[string]interface{} `json:"options,omitempty"`
+}
+
+// ollamaChatResponse - ответ /api/chat целиком (stream=false) или один фрагмент потока.
+type ollamaChatResponse struct {
+	Model           string  `json:"model"`
+	Message         Message `json:"message"`
+	Done            bool    `json:"done"`
+	DoneReason      string  `json:"done_reason"`
+	PromptEvalCount int     `json:"prompt_eval_count"`
+	EvalCount       int     `json:"eval_count"`
+	Error           string  `json:"error"`
+}
+
+// Name возвращает имя провайдера.
+func (p *OllamaProvider) Name() string { return "ollama" }
+
+// Model возвращает модель по умолчанию.
+func (p *OllamaProvider) Model() string { return p.modelName }
+
+// ChatCompletion отправляет запрос на завершение чата и возвращает текст ответа.
+func (p *OllamaProvider) ChatCompletion(ctx context.Context, messages []Message) (string, error) {
+	result, err := p.ChatCompletionWithOptions(ctx, messages, ChatOptions{})
+	if err != nil {
+		return "", err
+	}
+	return result.Content, nil
+}
+
+// ChatCompletionWithOptions отправляет запрос на завершение чата с дополнительными опциями.
+func (p *OllamaProvider) ChatCompletionWithOptions(ctx context.Context, messages []Message, opts ChatOptions) (*ChatResult, error) {
+	if len(messages) == 0 {
+		return nil, fmt.Errorf("messages cannot be empty")
+	}
+
+	resp, err := p.post(ctx, p.buildRequest(messages, opts, false))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var chatResp ollamaChatResponse
+	if err := json.NewDecoder(resp.Body).Decode(&chatResp); err != nil {
+		return nil, fmt.Errorf("failed to decode ollama response: %w", err)
+	}
+	if chatResp.Error != "" {
+		return nil, fmt.Errorf("ollama chat completion failed: %s", chatResp.Error)
+	}
+	if chatResp.Message.Content == "" {
+		return nil, ErrEmptyResponse
+	}
+
+	result := chatResp.result()
+	result.Content = chatResp.Message.Content
+	return result, nil
+}
+
+// ChatCompletionStream отправляет запрос с stream=true. Ollama отвечает NDJSON:
+// по одному объекту на строку, последний объект содержит done=true и счетчики токенов.
+func (p *OllamaProvider) ChatCompletionStream(ctx context.Context, messages []Message, opts ChatOptions, onDelta DeltaFunc) (*ChatResult, error) {
+	if len(messages) == 0 {
+		return nil, fmt.Errorf("messages cannot be empty")
+	}
+
+	resp, err := p.post(ctx, p.buildRequest(messages, opts, true))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var content strings.Builder
+	var result *ChatResult
+	decoder := json.NewDecoder(resp.Body)
+	for {
+		var chunk ollamaChatResponse
+		if err := decoder.Decode(&chunk); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, fmt.Errorf("failed to decode ollama stream: %w", err)
+		}
+		if chunk.Error != "" {
+			return nil, fmt.Errorf("ollama chat completion stream failed: %s", chunk.Error)
+		}
+		if delta := chunk.Message.Content; delta != "" {
+			content.WriteString(delta)
+			if err := onDelta(delta); err != nil {
+				return nil, err
+			}
+		}
+		if chunk.Done {
+			result = chunk.result()
+			break
+		}
+	}
+
+	if content.Len() == 0 {
+		return nil, ErrEmptyResponse
+	}
+	if result == nil {
+		return nil, fmt.Errorf("ollama stream ended before completion")
+	}
+	result.Content = content.String()
+	return result, nil
+}
+
+// buildRequest переводит сообщения и опции в запрос Ollama.
+func (p *OllamaProvider) buildRequest(messages []Message, opts ChatOptions, stream bool) ollamaChatRequest {
+	request := ollamaChatRequest{
+		Model:    p.modelName,
+		Messages: messages,
+		Stream:   stream,
+	}
+	if opts.Model != "" {
+		request.Model = opts.Model
+	}
+	if opts.JSONMode {
+		request.Format = "json"
+	}
+	options := map[string]interface{}{}
+	if opts.Temperature != nil {
+		options["temperature"] = *opts.Temperature
+	}
+	if opts.MaxTokens > 0 {
+		options["num_predict"] = opts.MaxTokens
+	}
+	if len(options) > 0 {
+		request.Options = options
+	}
+	return request
+}
+
+// post отправляет запрос в /api/chat и проверяет HTTP-статус ответа.
+// При успехе вызывающий обязан закрыть resp.Body.
+func (p *OllamaProvider) post(ctx context.Context, request ollamaChatRequest) (*http.Response, error) {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal ollama request: %w", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, p.baseURL+"/api/chat", bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create ollama request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	resp, err := p.httpClient.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("ollama chat completion failed: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		respBody, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("ollama chat completion failed: %w", &StatusError{
+			StatusCode: resp.StatusCode,
+			Body:       strings.TrimSpace(string(respBody)),
+		})
+	}
+	return resp, nil
+}
+
+// result переводит метаданные ответа Ollama в ChatResult (без текста).
+func (r *ollamaChatResponse) result() *ChatResult {
+	return &ChatResult{
+		Model:        r.Model,
+		FinishReason: r.DoneReason,
+		Usage: UsageInfo{
+			PromptTokens:     r.PromptEvalCount,
+			CompletionTokens: r.EvalCount,
+			TotalTokens:      r.PromptEvalCount + r.EvalCount,
+		},
+	}
+}
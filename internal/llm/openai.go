@@ -0,0 +1,177 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// OpenRouterBaseURL - адрес OpenAI-совместимого API OpenRouter.
+const OpenRouterBaseURL = "https://openrouter.ai/api/v1"
+
+// OpenAIProvider работает с любым OpenAI-совместимым API:
+// OpenAI, OpenRouter, llama.cpp server, vLLM и т.п.
+type OpenAIProvider struct {
+	name      string
+	client    *openai.Client
+	modelName string
+}
+
+// NewOpenAIProvider создает провайдера для OpenAI-совместимого API.
+// name - имя провайдера для логов, baseURL - адрес API (пустой - официальный OpenAI),
+// apiKey может быть пустым для локальных серверов.
+func NewOpenAIProvider(name, baseURL, apiKey, model string, timeout time.Duration) *OpenAIProvider {
+	config := openai.DefaultConfig(apiKey)
+	if baseURL != "" {
+		config.BaseURL = baseURL
+	}
+	config.HTTPClient = &http.Client{
+		Timeout: timeout,
+	}
+
+	return &OpenAIProvider{
+		name:      name,
+		client:    openai.NewClientWithConfig(config),
+		modelName: model,
+	}
+}
+
+// NewOpenRouterProvider создает провайдера для OpenRouter.
+func NewOpenRouterProvider(apiKey, model string, timeout time.Duration) *OpenAIProvider {
+	return NewOpenAIProvider("openrouter", OpenRouterBaseURL, apiKey, model, timeout)
+}
+
+// Name возвращает имя провайдера.
+func (p *OpenAIProvider) Name() string { return p.name }
+
+// Model возвращает модель по умолчанию.
+func (p *OpenAIProvider) Model() string { return p.modelName }
+
+// ChatCompletion отправляет запрос на завершение чата и возвращает текст ответа.
+func (p *OpenAIProvider) ChatCompletion(ctx context.Context, messages []Message) (string, error) {
+	result, err := p.ChatCompletionWithOptions(ctx, messages, ChatOptions{})
+	if err != nil {
+		return "", err
+	}
+	return result.Content, nil
+}
+
+// ChatCompletionWithOptions отправляет запрос на завершение чата с дополнительными опциями.
+func (p *OpenAIProvider) ChatCompletionWithOptions(ctx context.Context, messages []Message, opts ChatOptions) (*ChatResult, error) {
+	if len(messages) == 0 {
+		return nil, fmt.Errorf("messages cannot be empty")
+	}
+
+	resp, err := p.client.CreateChatCompletion(ctx, p.buildRequest(messages, opts))
+	if err != nil {
+		return nil, fmt.Errorf("%s chat completion failed: %w", p.name, err)
+	}
+
+	if len(resp.Choices) == 0 || resp.Choices[0].Message.Content == "" {
+		return nil, ErrEmptyResponse
+	}
+
+	return &ChatResult{
+		Content:      resp.Choices[0].Message.Content,
+		Model:        resp.Model,
+		FinishReason: string(resp.Choices[0].FinishReason),
+		Usage: UsageInfo{
+			PromptTokens:     resp.Usage.PromptTokens,
+			CompletionTokens: resp.Usage.CompletionTokens,
+			TotalTokens:      resp.Usage.TotalTokens,
+		},
+	}, nil
+}
+
+// buildRequest переводит сообщения и опции в запрос go-openai.
+func (p *OpenAIProvider) buildRequest(messages []Message, opts ChatOptions) openai.ChatCompletionRequest {
+	request := openai.ChatCompletionRequest{
+		Model:     p.modelName,
+		Messages:  make([]openai.ChatCompletionMessage, 0, len(messages)),
+		MaxTokens: opts.MaxTokens,
+	}
+	if opts.Model != "" {
+		request.Model = opts.Model
+	}
+	if opts.Temperature != nil {
+		request.Temperature = *opts.Temperature
+	}
+	if opts.JSONMode {
+		request.ResponseFormat = &openai.ChatCompletionResponseFormat{
+			Type: openai.ChatCompletionResponseFormatTypeJSONObject,
+		}
+	}
+	for _, m := range messages {
+		request.Messages = append(request.Messages, openai.ChatCompletionMessage{
+			Role:    m.Role,
+			Content: m.Content,
+		})
+	}
+	return request
+}
+
+// ChatCompletionStream отправляет запрос с stream=true и передает фрагменты ответа в onDelta.
+func (p *OpenAIProvider) ChatCompletionStream(ctx context.Context, messages []Message, opts ChatOptions, onDelta DeltaFunc) (*ChatResult, error) {
+	if len(messages) == 0 {
+		return nil, fmt.Errorf("messages cannot be empty")
+	}
+
+	request := p.buildRequest(messages, opts)
+	request.Stream = true
+	request.StreamOptions = &openai.StreamOptions{IncludeUsage: true}
+
+	stream, err := p.client.CreateChatCompletionStream(ctx, request)
+	if err != nil {
+		return nil, fmt.Errorf("%s chat completion stream failed: %w", p.name, err)
+	}
+	defer stream.Close()
+
+	result := &ChatResult{Model: request.Model}
+	var content strings.Builder
+	for {
+		chunk, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s chat completion stream failed: %w", p.name, err)
+		}
+
+		if chunk.Model != "" {
+			result.Model = chunk.Model
+		}
+		if chunk.Usage != nil {
+			result.Usage = UsageInfo{
+				PromptTokens:     chunk.Usage.PromptTokens,
+				CompletionTokens: chunk.Usage.CompletionTokens,
+				TotalTokens:      chunk.Usage.TotalTokens,
+			}
+		}
+		if len(chunk.Choices) == 0 {
+			continue
+		}
+		if chunk.Choices[0].FinishReason != "" {
+			result.FinishReason = string(chunk.Choices[0].FinishReason)
+		}
+		delta := chunk.Choices[0].Delta.Content
+		if delta == "" {
+			continue
+		}
+		content.WriteString(delta)
+		if err := onDelta(delta); err != nil {
+			return nil, err
+		}
+	}
+
+	if content.Len() == 0 {
+		return nil, ErrEmptyResponse
+	}
+	result.Content = content.String()
+	return result, nil
+}
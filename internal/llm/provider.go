@@ -0,0 +1,93 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// Роли сообщений в диалоге с моделью.
+const (
+	RoleSystem    = "system"
+	RoleUser      = "user"
+	RoleAssistant = "assistant"
+)
+
+// ErrEmptyResponse возвращается, когда модель не вернула ни одного варианта ответа
+// или вернула пустой текст.
+var ErrEmptyResponse = errors.New("received empty response from API")
+
+// StatusError - ответ бэкенда с неуспешным HTTP-статусом.
+// По статусу RetryingProvider решает, повторять ли запрос.
+type StatusError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("status %d: %s", e.StatusCode, e.Body)
+}
+
+// Message представляет одно сообщение в диалоге с моделью.
+type Message struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// ChatOptions содержит необязательные параметры запроса.
+// Нулевые значения означают "использовать значения провайдера по умолчанию".
+type ChatOptions struct {
+	Model       string   // Переопределяет модель провайдера для одного запроса
+	Temperature *float32 // nil - температура по умолчанию
+	MaxTokens   int      // 0 - без ограничения
+	JSONMode    bool     // Просить модель вернуть строго JSON (если бэкенд это поддерживает)
+}
+
+// UsageInfo содержит информацию об использовании токенов.
+type UsageInfo struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+// ChatResult - полный результат запроса к модели.
+type ChatResult struct {
+	Content      string
+	Model        string // Модель, которая фактически ответила
+	FinishReason string
+	Usage        UsageInfo
+}
+
+// DeltaFunc получает очередной фрагмент текста при потоковой генерации.
+type DeltaFunc func(delta string) error
+
+// LLMProvider - абстракция над бэкендом языковой модели.
+// Сервисы работают только с этим интерфейсом и не знают, какой API стоит за ним.
+type LLMProvider interface {
+	// ChatCompletion отправляет диалог модели и возвращает текст ответа.
+	ChatCompletion(ctx context.Context, messages []Message) (string, error)
+	// ChatCompletionWithOptions отправляет диалог с дополнительными опциями
+	// и возвращает ответ вместе с метаданными (модель, токены).
+	ChatCompletionWithOptions(ctx context.Context, messages []Message, opts ChatOptions) (*ChatResult, error)
+	// ChatCompletionStream отправляет диалог и передает текст ответа по частям в onDelta
+	// по мере генерации. Возвращает итоговый результат целиком, когда модель закончила.
+	// Если onDelta возвращает ошибку, генерация прерывается с этой ошибкой.
+	ChatCompletionStream(ctx context.Context, messages []Message, opts ChatOptions, onDelta DeltaFunc) (*ChatResult, error)
+	// Name возвращает имя провайдера (openrouter, openai, ollama, ...).
+	Name() string
+	// Model возвращает модель, используемую по умолчанию.
+	Model() string
+}
+
+// SetSystemPrompt возвращает диалог с системным промптом в начале.
+// Если первое сообщение уже системное, его содержимое заменяется.
+func SetSystemPrompt(messages []Message, systemPrompt string) []Message {
+	if len(messages) == 0 || messages[0].Role != RoleSystem {
+		return append([]Message{{Role: RoleSystem, Content: systemPrompt}}, messages...)
+	}
+
+	result := make([]Message, len(messages))
+	copy(result, messages)
+	result[0].Content = systemPrompt
+	return result
+}
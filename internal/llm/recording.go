@@ -0,0 +1,68 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+	"novel-server/internal/logger"
+	"os"
+	"path/filepath"
+)
+
+// RecordingProvider оборачивает настоящего провайдера и сохраняет каждый ответ
+// в dir/hashes/<PromptHash>.json. Записанный каталог затем воспроизводится
+// через LoadScriptedProvider без доступа к сети.
+type RecordingProvider struct {
+	inner LLMProvider
+	dir   string
+}
+
+// NewRecordingProvider создает записывающую обертку над провайдером.
+func NewRecordingProvider(inner LLMProvider, dir string) (*RecordingProvider, error) {
+	if err := os.MkdirAll(filepath.Join(dir, "hashes"), 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create recordings dir: %w", err)
+	}
+	return &RecordingProvider{inner: inner, dir: dir}, nil
+}
+
+// Name возвращает имя обернутого провайдера.
+func (p *RecordingProvider) Name() string { return p.inner.Name() }
+
+// Model возвращает модель обернутого провайдера.
+func (p *RecordingProvider) Model() string { return p.inner.Model() }
+
+// ChatCompletion вызывает обернутого провайдера и записывает ответ.
+func (p *RecordingProvider) ChatCompletion(ctx context.Context, messages []Message) (string, error) {
+	result, err := p.ChatCompletionWithOptions(ctx, messages, ChatOptions{})
+	if err != nil {
+		return "", err
+	}
+	return result.Content, nil
+}
+
+// ChatCompletionWithOptions вызывает обернутого провайдера и записывает ответ.
+func (p *RecordingProvider) ChatCompletionWithOptions(ctx context.Context, messages []Message, opts ChatOptions) (*ChatResult, error) {
+	result, err := p.inner.ChatCompletionWithOptions(ctx, messages, opts)
+	if err != nil {
+		return nil, err
+	}
+	p.record(messages, result.Content)
+	return result, nil
+}
+
+// ChatCompletionStream стримит ответ обернутого провайдера и записывает его целиком.
+func (p *RecordingProvider) ChatCompletionStream(ctx context.Context, messages []Message, opts ChatOptions, onDelta DeltaFunc) (*ChatResult, error) {
+	result, err := p.inner.ChatCompletionStream(ctx, messages, opts, onDelta)
+	if err != nil {
+		return nil, err
+	}
+	p.record(messages, result.Content)
+	return result, nil
+}
+
+// record сохраняет ответ на диск. Ошибка записи не должна ломать запрос.
+func (p *RecordingProvider) record(messages []Message, content string) {
+	path := filepath.Join(p.dir, "hashes", PromptHash(messages)+".json")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		logger.Logger.Warn("Failed to record LLM response", "path", path, "err", err)
+	}
+}
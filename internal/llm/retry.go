@@ -0,0 +1,223 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"novel-server/internal/config"
+	"novel-server/internal/logger"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// RetryingProvider оборачивает провайдера политикой повторов: неудачная попытка повторяется
+// с экспоненциальной задержкой и случайным разбросом, а когда попытки на модель исчерпаны
+// или модель недоступна, запрос отправляется следующей резервной модели.
+// Повторяются только временные ошибки: 429, 5xx, таймауты, сетевые ошибки и пустые ответы.
+type RetryingProvider struct {
+	inner LLMProvider
+	cfg   config.RetryConfig
+	sleep func(ctx context.Context, d time.Duration) error // Ожидание перед повтором; подменяется в тестах
+}
+
+// NewRetryingProvider создает обертку с политикой повторов.
+func NewRetryingProvider(inner LLMProvider, cfg config.RetryConfig) *RetryingProvider {
+	if cfg.MaxAttempts < 1 {
+		cfg.MaxAttempts = 1
+	}
+	return &RetryingProvider{inner: inner, cfg: cfg, sleep: sleepContext}
+}
+
+// sleepContext ждет d или отмены ctx
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// Name возвращает имя обернутого провайдера.
+func (p *RetryingProvider) Name() string { return p.inner.Name() }
+
+// Model возвращает основную модель обернутого провайдера.
+func (p *RetryingProvider) Model() string { return p.inner.Model() }
+
+// ChatCompletion отправляет диалог с повторами и резервными моделями.
+func (p *RetryingProvider) ChatCompletion(ctx context.Context, messages []Message) (string, error) {
+	result, err := p.ChatCompletionWithOptions(ctx, messages, ChatOptions{})
+	if err != nil {
+		return "", err
+	}
+	return result.Content, nil
+}
+
+// ChatCompletionWithOptions отправляет диалог с повторами и резервными моделями.
+func (p *RetryingProvider) ChatCompletionWithOptions(ctx context.Context, messages []Message, opts ChatOptions) (*ChatResult, error) {
+	return p.do(ctx, opts, func(ctx context.Context, opts ChatOptions) (*ChatResult, error) {
+		return p.inner.ChatCompletionWithOptions(ctx, messages, opts)
+	}, nil)
+}
+
+// ChatCompletionStream стримит ответ с повторами и резервными моделями.
+// Повтор возможен, только пока клиенту не передан ни один фрагмент ответа:
+// после этого ошибка возвращается как есть, чтобы текст не задвоился.
+func (p *RetryingProvider) ChatCompletionStream(ctx context.Context, messages []Message, opts ChatOptions, onDelta DeltaFunc) (*ChatResult, error) {
+	delivered := false
+	return p.do(ctx, opts, func(ctx context.Context, opts ChatOptions) (*ChatResult, error) {
+		return p.inner.ChatCompletionStream(ctx, messages, opts, func(delta string) error {
+			delivered = true
+			return onDelta(delta)
+		})
+	}, func() bool { return delivered })
+}
+
+// do выполняет call по очереди для основной и резервных моделей, повторяя временные ошибки.
+// started (может быть nil) сообщает, что ответ уже частично передан и повторять нельзя.
+func (p *RetryingProvider) do(ctx context.Context, opts ChatOptions, call func(context.Context, ChatOptions) (*ChatResult, error), started func() bool) (*ChatResult, error) {
+	primary := opts.Model
+	if primary == "" {
+		primary = p.inner.Model()
+	}
+	models := []string{primary}
+	for _, model := range p.cfg.FallbackModels {
+		if model != primary {
+			models = append(models, model)
+		}
+	}
+
+	var lastErr error
+	for i, model := range models {
+		opts.Model = model
+		for attempt := 1; attempt <= p.cfg.MaxAttempts; attempt++ {
+			result, err := p.attempt(ctx, opts, call)
+			if err == nil {
+				if i > 0 || attempt > 1 {
+					logger.Logger.Info("LLM request succeeded after retry", "provider", p.inner.Name(), "model", model, "attempt", attempt)
+				}
+				return result, nil
+			}
+			lastErr = err
+
+			// Запрос отменен клиентом или сервер останавливается - повторять незачем
+			if ctx.Err() != nil {
+				return nil, err
+			}
+			if started != nil && started() {
+				return nil, err
+			}
+
+			reason, action := classifyError(err)
+			logger.Logger.Warn("LLM attempt failed", "provider", p.inner.Name(), "model", model,
+				"attempt", attempt, "max_attempts", p.cfg.MaxAttempts, "reason", reason, "err", err)
+
+			if action == failRequest {
+				return nil, err
+			}
+			if action == nextModel || attempt == p.cfg.MaxAttempts {
+				break
+			}
+
+			delay := p.backoff(attempt)
+			logger.Logger.Info("Retrying LLM request", "model", model, "delay", delay)
+			if err := p.sleep(ctx, delay); err != nil {
+				return nil, err
+			}
+		}
+
+		if i+1 < len(models) {
+			logger.Logger.Warn("Switching to fallback model", "from", model, "to", models[i+1])
+		}
+	}
+
+	return nil, fmt.Errorf("LLM request failed on all models (%d): %w", len(models), lastErr)
+}
+
+// attempt выполняет одну попытку с собственным таймаутом.
+func (p *RetryingProvider) attempt(ctx context.Context, opts ChatOptions, call func(context.Context, ChatOptions) (*ChatResult, error)) (*ChatResult, error) {
+	if p.cfg.RequestTimeout <= 0 {
+		return call(ctx, opts)
+	}
+	attemptCtx, cancel := context.WithTimeout(ctx, p.cfg.RequestTimeout)
+	defer cancel()
+	return call(attemptCtx, opts)
+}
+
+// backoff возвращает задержку перед повтором номер attempt: база удваивается с каждой попыткой
+// (не больше MaxBackoff), а фактическая задержка выбирается случайно между половиной и полным значением,
+// чтобы параллельные запросы не повторялись одновременно.
+func (p *RetryingProvider) backoff(attempt int) time.Duration {
+	delay := p.cfg.Backoff << (attempt - 1)
+	if p.cfg.MaxBackoff > 0 && (delay > p.cfg.MaxBackoff || delay <= 0) {
+		delay = p.cfg.MaxBackoff
+	}
+	if delay <= 0 {
+		return 0
+	}
+	half := delay / 2
+	return half + rand.N(delay-half+1)
+}
+
+// retryAction - что делать после неудачной попытки
+type retryAction int
+
+const (
+	retrySameModel retryAction = iota // Временная ошибка: повторить с той же моделью
+	nextModel                         // Модель недоступна: сразу перейти к резервной
+	failRequest                       // Ошибка запроса: повтор не поможет
+)
+
+// classifyError возвращает причину ошибки для лога и решение о повторе.
+func classifyError(err error) (string, retryAction) {
+	if errors.Is(err, ErrEmptyResponse) {
+		return "empty response", retrySameModel
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return "request timeout", retrySameModel
+	}
+
+	if status := httpStatus(err); status != 0 {
+		switch {
+		case status == http.StatusTooManyRequests:
+			return "rate limited (429)", retrySameModel
+		case status == http.StatusRequestTimeout:
+			return "request timeout (408)", retrySameModel
+		case status >= 500:
+			return fmt.Sprintf("server error (%d)", status), retrySameModel
+		case status == http.StatusNotFound:
+			return "model not found (404)", nextModel
+		default:
+			return fmt.Sprintf("client error (%d)", status), failRequest
+		}
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return "network error", retrySameModel
+	}
+	return "non-retryable error", failRequest
+}
+
+// httpStatus извлекает HTTP-статус из ошибки бэкенда (0, если статуса нет).
+func httpStatus(err error) int {
+	var apiErr *openai.APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.HTTPStatusCode
+	}
+	var reqErr *openai.RequestError
+	if errors.As(err, &reqErr) {
+		return reqErr.HTTPStatusCode
+	}
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode
+	}
+	return 0
+}
@@ -0,0 +1,251 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"novel-server/internal/config"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// stubStep - ответ stubProvider на один вызов
+type stubStep struct {
+	deltas []string // Фрагменты, которые стрим передает до ошибки или ответа
+	err    error
+	block  bool // Ждать отмены контекста попытки и вернуть ее ошибку
+}
+
+// stubProvider отвечает по очереди шагами steps и запоминает модели и контексты вызовов
+type stubProvider struct {
+	steps     []stubStep
+	models    []string
+	deadlines []time.Duration // Время до дедлайна контекста попытки; 0 - дедлайна нет
+}
+
+func (p *stubProvider) next(ctx context.Context, opts ChatOptions, onDelta DeltaFunc) (*ChatResult, error) {
+	p.models = append(p.models, opts.Model)
+	var deadline time.Duration
+	if d, ok := ctx.Deadline(); ok {
+		deadline = time.Until(d)
+	}
+	p.deadlines = append(p.deadlines, deadline)
+
+	if len(p.steps) == 0 {
+		return nil, errors.New("stub: no steps left")
+	}
+	step := p.steps[0]
+	p.steps = p.steps[1:]
+
+	for _, delta := range step.deltas {
+		if err := onDelta(delta); err != nil {
+			return nil, err
+		}
+	}
+	if step.block {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	if step.err != nil {
+		return nil, step.err
+	}
+	return &ChatResult{Content: "ok", Model: opts.Model}, nil
+}
+
+func (p *stubProvider) ChatCompletion(ctx context.Context, messages []Message) (string, error) {
+	result, err := p.ChatCompletionWithOptions(ctx, messages, ChatOptions{})
+	if err != nil {
+		return "", err
+	}
+	return result.Content, nil
+}
+
+func (p *stubProvider) ChatCompletionWithOptions(ctx context.Context, messages []Message, opts ChatOptions) (*ChatResult, error) {
+	return p.next(ctx, opts, func(string) error { return nil })
+}
+
+func (p *stubProvider) ChatCompletionStream(ctx context.Context, messages []Message, opts ChatOptions, onDelta DeltaFunc) (*ChatResult, error) {
+	return p.next(ctx, opts, onDelta)
+}
+
+func (p *stubProvider) Name() string  { return "stub" }
+func (p *stubProvider) Model() string { return "main" }
+
+// newTestRetrying оборачивает inner политикой повторов и записывает задержки вместо ожидания
+func newTestRetrying(inner LLMProvider, cfg config.RetryConfig) (*RetryingProvider, *[]time.Duration) {
+	p := NewRetryingProvider(inner, cfg)
+	var delays []time.Duration
+	p.sleep = func(ctx context.Context, d time.Duration) error {
+		delays = append(delays, d)
+		return ctx.Err()
+	}
+	return p, &delays
+}
+
+func status(code int) error {
+	return &StatusError{StatusCode: code, Body: http.StatusText(code)}
+}
+
+func TestRetryingProvider(t *testing.T) {
+	cfg := config.RetryConfig{
+		MaxAttempts:    3,
+		Backoff:        100 * time.Millisecond,
+		MaxBackoff:     time.Second,
+		FallbackModels: []string{"backup"},
+	}
+
+	tests := []struct {
+		name       string
+		steps      []stubStep
+		wantModels []string
+		wantSleeps int
+		wantErr    bool
+	}{
+		{"success", []stubStep{{}}, []string{"main"}, 0, false},
+		{"429 retried", []stubStep{{err: status(429)}, {}}, []string{"main", "main"}, 1, false},
+		{"408 retried", []stubStep{{err: status(408)}, {}}, []string{"main", "main"}, 1, false},
+		{"5xx retried", []stubStep{{err: status(500)}, {err: status(503)}, {}}, []string{"main", "main", "main"}, 2, false},
+		{"openai 429 retried", []stubStep{{err: &openai.APIError{HTTPStatusCode: 429}}, {}}, []string{"main", "main"}, 1, false},
+		{"empty response retried", []stubStep{{err: ErrEmptyResponse}, {}}, []string{"main", "main"}, 1, false},
+		{"timeout retried", []stubStep{{err: context.DeadlineExceeded}, {}}, []string{"main", "main"}, 1, false},
+		{"network error retried", []stubStep{{err: &net.DNSError{Err: "no such host", IsTemporary: true}}, {}}, []string{"main", "main"}, 1, false},
+		{"400 fails at once", []stubStep{{err: status(400)}}, []string{"main"}, 0, true},
+		{"401 fails at once", []stubStep{{err: status(401)}}, []string{"main"}, 0, true},
+		{"unknown error fails at once", []stubStep{{err: errors.New("boom")}}, []string{"main"}, 0, true},
+		{"404 switches to fallback", []stubStep{{err: status(404)}, {}}, []string{"main", "backup"}, 0, false},
+		{
+			"attempts exhausted switch to fallback",
+			[]stubStep{{err: status(502)}, {err: status(502)}, {err: status(502)}, {}},
+			[]string{"main", "main", "main", "backup"}, 2, false,
+		},
+		{
+			"all models fail",
+			[]stubStep{{err: status(502)}, {err: status(502)}, {err: status(502)}, {err: status(404)}},
+			[]string{"main", "main", "main", "backup"}, 2, true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inner := &stubProvider{steps: tt.steps}
+			p, delays := newTestRetrying(inner, cfg)
+
+			result, err := p.ChatCompletionWithOptions(context.Background(), nil, ChatOptions{})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && result.Model != tt.wantModels[len(tt.wantModels)-1] {
+				t.Errorf("result model = %q, want %q", result.Model, tt.wantModels[len(tt.wantModels)-1])
+			}
+			if !slices.Equal(inner.models, tt.wantModels) {
+				t.Errorf("models = %v, want %v", inner.models, tt.wantModels)
+			}
+			if len(*delays) != tt.wantSleeps {
+				t.Errorf("sleeps = %v, want %d", *delays, tt.wantSleeps)
+			}
+		})
+	}
+}
+
+func TestRetryingProviderKeepsLastError(t *testing.T) {
+	inner := &stubProvider{steps: []stubStep{{err: status(503)}}}
+	p, _ := newTestRetrying(inner, config.RetryConfig{MaxAttempts: 1})
+
+	_, err := p.ChatCompletionWithOptions(context.Background(), nil, ChatOptions{})
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != 503 {
+		t.Fatalf("error = %v, want the last StatusError 503", err)
+	}
+}
+
+func TestRetryingProviderBackoff(t *testing.T) {
+	p := NewRetryingProvider(&stubProvider{}, config.RetryConfig{
+		MaxAttempts: 10,
+		Backoff:     100 * time.Millisecond,
+		MaxBackoff:  time.Second,
+	})
+
+	for attempt := 1; attempt <= 70; attempt++ {
+		base := min(p.cfg.Backoff<<(attempt-1), p.cfg.MaxBackoff)
+		if base <= 0 {
+			base = p.cfg.MaxBackoff // Сдвиг переполнился
+		}
+		for range 50 {
+			if delay := p.backoff(attempt); delay < base/2 || delay > base {
+				t.Fatalf("backoff(%d) = %v, want between %v and %v", attempt, delay, base/2, base)
+			}
+		}
+	}
+}
+
+func TestRetryingProviderAttemptTimeout(t *testing.T) {
+	const timeout = 50 * time.Millisecond
+	inner := &stubProvider{steps: []stubStep{{block: true}, {}}}
+	p, delays := newTestRetrying(inner, config.RetryConfig{MaxAttempts: 2, RequestTimeout: timeout})
+
+	if _, err := p.ChatCompletionWithOptions(context.Background(), nil, ChatOptions{}); err != nil {
+		t.Fatalf("ChatCompletionWithOptions: %v", err)
+	}
+	if len(inner.models) != 2 || len(*delays) != 1 {
+		t.Fatalf("calls = %d, sleeps = %d; want the timed out attempt to be retried", len(inner.models), len(*delays))
+	}
+	for i, deadline := range inner.deadlines {
+		if deadline <= 0 || deadline > timeout {
+			t.Errorf("attempt %d deadline in %v, want within %v", i+1, deadline, timeout)
+		}
+	}
+}
+
+func TestRetryingProviderCancelledContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	inner := &stubProvider{steps: []stubStep{{err: status(503)}, {}}}
+	p := NewRetryingProvider(inner, config.RetryConfig{MaxAttempts: 3, Backoff: time.Hour})
+	p.sleep = func(ctx context.Context, d time.Duration) error {
+		cancel()
+		return sleepContext(ctx, d)
+	}
+
+	if _, err := p.ChatCompletionWithOptions(ctx, nil, ChatOptions{}); !errors.Is(err, context.Canceled) {
+		t.Fatalf("error = %v, want context.Canceled", err)
+	}
+	if len(inner.models) != 1 {
+		t.Fatalf("calls = %d, want no retry after cancellation", len(inner.models))
+	}
+}
+
+func TestRetryingProviderStream(t *testing.T) {
+	tests := []struct {
+		name       string
+		steps      []stubStep
+		wantCalls  int
+		wantDeltas []string
+		wantErr    bool
+	}{
+		{"retried before output", []stubStep{{err: status(503)}, {deltas: []string{"a", "b"}}}, 2, []string{"a", "b"}, false},
+		{"not retried after output", []stubStep{{deltas: []string{"a"}, err: status(503)}, {deltas: []string{"a", "b"}}}, 1, []string{"a"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inner := &stubProvider{steps: tt.steps}
+			p, _ := newTestRetrying(inner, config.RetryConfig{MaxAttempts: 3})
+
+			var deltas []string
+			_, err := p.ChatCompletionStream(context.Background(), nil, ChatOptions{}, func(delta string) error {
+				deltas = append(deltas, delta)
+				return nil
+			})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if len(inner.models) != tt.wantCalls {
+				t.Errorf("calls = %d, want %d", len(inner.models), tt.wantCalls)
+			}
+			if !slices.Equal(deltas, tt.wantDeltas) {
+				t.Errorf("deltas = %v, want %v", deltas, tt.wantDeltas)
+			}
+		})
+	}
+}
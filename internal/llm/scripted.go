@@ -0,0 +1,299 @@
+package llm
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// DefaultScriptKinds сопоставляет виды запросов с фрагментами системных промптов из promts/.
+// По этим фрагментам ScriptedProvider понимает, какой "сценарист" сейчас вызывается.
+var DefaultScriptKinds = map[string]string{
+	"narrator":        "Initial Story Request Generator",
+	"narrator_refine": "Story Config Refinement",
+	"novel_creator":   "Visual Novel Generation Assistant",
+}
+
+// ScriptedCall - запись об одном вызове ScriptedProvider.
+type ScriptedCall struct {
+	Hash     string
+	Kind     string
+	Messages []Message
+}
+
+// ScriptedProvider - детерминированный провайдер без сети.
+// Отдает заранее записанные ответы: сначала ищет ответ по хешу промпта,
+// затем берет следующий ответ из очереди для вида запроса (narrator, novel_creator, ...).
+// Используется для офлайн-тестов всего конвейера черновик → сетап → сцены.
+type ScriptedProvider struct {
+	mu        sync.Mutex
+	modelName string
+	byHash    map[string]string
+	queues    map[string][]string
+	kinds     map[string]string // kind -> фрагмент системного промпта
+	calls     []ScriptedCall
+}
+
+// NewScriptedProvider создает пустой ScriptedProvider с видами запросов по умолчанию.
+func NewScriptedProvider() *ScriptedProvider {
+	p := &ScriptedProvider{
+		modelName: "scripted",
+		byHash:    make(map[string]string),
+		queues:    make(map[string][]string),
+		kinds:     make(map[string]string),
+	}
+	for kind, marker := range DefaultScriptKinds {
+		p.kinds[kind] = marker
+	}
+	return p
+}
+
+// LoadScriptedProvider загружает фикстуры из каталога:
+//
+//	dir/hashes/<sha256>.json  - ответ на конкретный промпт (см. PromptHash)
+//	dir/<kind>/*.json         - очередь ответов для вида запроса, в порядке имен файлов
+//	dir/kinds.json            - необязательно: {"<kind>": "<фрагмент системного промпта>"}
+//
+// Ответы хранятся как есть - в том виде, в котором их вернула бы модель.
+func LoadScriptedProvider(dir string) (*ScriptedProvider, error) {
+	p := NewScriptedProvider()
+
+	kindsData, err := os.ReadFile(filepath.Join(dir, "kinds.json"))
+	if err == nil {
+		var kinds map[string]string
+		if err := json.Unmarshal(kindsData, &kinds); err != nil {
+			return nil, fmt.Errorf("failed to parse kinds.json: %w", err)
+		}
+		for kind, marker := range kinds {
+			p.kinds[kind] = marker
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read kinds.json: %w", err)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read fixtures dir %s: %w", dir, err)
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		files, err := readFixtureFiles(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		if entry.Name() == "hashes" {
+			for _, f := range files {
+				p.byHash[strings.TrimSuffix(f.name, filepath.Ext(f.name))] = f.content
+			}
+			continue
+		}
+		for _, f := range files {
+			p.queues[entry.Name()] = append(p.queues[entry.Name()], f.content)
+		}
+	}
+
+	return p, nil
+}
+
+type fixtureFile struct {
+	name    string
+	content string
+}
+
+// readFixtureFiles читает все файлы каталога в порядке имен.
+func readFixtureFiles(dir string) ([]fixtureFile, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read fixtures dir %s: %w", dir, err)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+
+	var files []fixtureFile
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read fixture %s: %w", entry.Name(), err)
+		}
+		files = append(files, fixtureFile{name: entry.Name(), content: string(data)})
+	}
+	return files, nil
+}
+
+// PromptHash вычисляет детерминированный хеш диалога (роли и тексты сообщений).
+// Модель в хеш не входит, чтобы записи можно было воспроизводить с любой моделью.
+func PromptHash(messages []Message) string {
+	h := sha256.New()
+	for _, m := range messages {
+		h.Write([]byte(m.Role))
+		h.Write([]byte{0})
+		h.Write([]byte(m.Content))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// AddHashed регистрирует ответ на диалог с указанным хешем.
+func (p *ScriptedProvider) AddHashed(hash, response string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.byHash[hash] = response
+}
+
+// Enqueue добавляет ответы в очередь для вида запроса.
+func (p *ScriptedProvider) Enqueue(kind string, responses ...string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.queues[kind] = append(p.queues[kind], responses...)
+}
+
+// MatchKind задает фрагмент системного промпта, по которому определяется вид запроса.
+func (p *ScriptedProvider) MatchKind(kind, marker string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.kinds[kind] = marker
+}
+
+// Calls возвращает копию журнала вызовов.
+func (p *ScriptedProvider) Calls() []ScriptedCall {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	calls := make([]ScriptedCall, len(p.calls))
+	copy(calls, p.calls)
+	return calls
+}
+
+// Remaining возвращает число неиспользованных ответов в очереди вида запроса.
+func (p *ScriptedProvider) Remaining(kind string) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.queues[kind])
+}
+
+// Name возвращает имя провайдера.
+func (p *ScriptedProvider) Name() string { return "scripted" }
+
+// Model возвращает имя модели.
+func (p *ScriptedProvider) Model() string { return p.modelName }
+
+// ChatCompletion возвращает записанный ответ.
+func (p *ScriptedProvider) ChatCompletion(ctx context.Context, messages []Message) (string, error) {
+	result, err := p.ChatCompletionWithOptions(ctx, messages, ChatOptions{})
+	if err != nil {
+		return "", err
+	}
+	return result.Content, nil
+}
+
+// ChatCompletionWithOptions возвращает записанный ответ вместе с оценкой числа токенов.
+func (p *ScriptedProvider) ChatCompletionWithOptions(ctx context.Context, messages []Message, opts ChatOptions) (*ChatResult, error) {
+	if len(messages) == 0 {
+		return nil, fmt.Errorf("messages cannot be empty")
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	content, err := p.next(messages)
+	if err != nil {
+		return nil, err
+	}
+
+	model := p.modelName
+	if opts.Model != "" {
+		model = opts.Model
+	}
+	promptTokens := 0
+	for _, m := range messages {
+		promptTokens += approxTokens(m.Content)
+	}
+	completionTokens := approxTokens(content)
+
+	return &ChatResult{
+		Content:      content,
+		Model:        model,
+		FinishReason: "stop",
+		Usage: UsageInfo{
+			PromptTokens:     promptTokens,
+			CompletionTokens: completionTokens,
+			TotalTokens:      promptTokens + completionTokens,
+		},
+	}, nil
+}
+
+// scriptedChunkSize - размер фрагмента, которыми ScriptedProvider "стримит" ответ.
+const scriptedChunkSize = 64
+
+// ChatCompletionStream отдает записанный ответ фрагментами фиксированного размера.
+func (p *ScriptedProvider) ChatCompletionStream(ctx context.Context, messages []Message, opts ChatOptions, onDelta DeltaFunc) (*ChatResult, error) {
+	result, err := p.ChatCompletionWithOptions(ctx, messages, opts)
+	if err != nil {
+		return nil, err
+	}
+	for start := 0; start < len(result.Content); start += scriptedChunkSize {
+		end := start + scriptedChunkSize
+		if end > len(result.Content) {
+			end = len(result.Content)
+		}
+		if err := onDelta(result.Content[start:end]); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// next выбирает ответ для диалога и записывает вызов в журнал.
+func (p *ScriptedProvider) next(messages []Message) (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	hash := PromptHash(messages)
+	kind := p.kindOf(messages)
+	p.calls = append(p.calls, ScriptedCall{Hash: hash, Kind: kind, Messages: messages})
+
+	if response, ok := p.byHash[hash]; ok {
+		return response, nil
+	}
+
+	queue := p.queues[kind]
+	if len(queue) == 0 {
+		return "", fmt.Errorf("scripted provider: no response recorded for prompt %s (kind %q)", hash, kind)
+	}
+	p.queues[kind] = queue[1:]
+	return queue[0], nil
+}
+
+// kindOf определяет вид запроса по системному промпту. Если ни один фрагмент не подошел,
+// возвращается "default".
+func (p *ScriptedProvider) kindOf(messages []Message) string {
+	if messages[0].Role == RoleSystem {
+		// Перебираем виды в фиксированном порядке, чтобы результат не зависел от обхода map
+		kinds := make([]string, 0, len(p.kinds))
+		for kind := range p.kinds {
+			kinds = append(kinds, kind)
+		}
+		sort.Strings(kinds)
+		for _, kind := range kinds {
+			if strings.Contains(messages[0].Content, p.kinds[kind]) {
+				return kind
+			}
+		}
+	}
+	return "default"
+}
+
+// approxTokens грубо оценивает число токенов (около 4 символов на токен).
+func approxTokens(s string) int {
+	return (len(s) + 3) / 4
+}
@@ -0,0 +1,157 @@
+package llm
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// dialog возвращает диалог с системным промптом system и сообщением пользователя user
+func dialog(system, user string) []Message {
+	return []Message{{Role: RoleSystem, Content: system}, {Role: RoleUser, Content: user}}
+}
+
+func TestScriptedProviderHashBeforeQueue(t *testing.T) {
+	p := NewScriptedProvider()
+	messages := dialog("# Visual Novel Generation Assistant", "scene 1")
+	p.Enqueue("novel_creator", "queued")
+	p.AddHashed(PromptHash(messages), "hashed")
+
+	ctx := context.Background()
+	if got, err := p.ChatCompletion(ctx, messages); err != nil || got != "hashed" {
+		t.Fatalf("ChatCompletion = %q, %v; want the hashed response", got, err)
+	}
+	// Ответ по хешу не расходуется и не трогает очередь
+	if got, err := p.ChatCompletion(ctx, messages); err != nil || got != "hashed" {
+		t.Fatalf("second ChatCompletion = %q, %v; want the hashed response again", got, err)
+	}
+	if got := p.Remaining("novel_creator"); got != 1 {
+		t.Fatalf("Remaining = %d, want 1", got)
+	}
+	if got, err := p.ChatCompletion(ctx, dialog("# Visual Novel Generation Assistant", "scene 2")); err != nil || got != "queued" {
+		t.Fatalf("ChatCompletion(other prompt) = %q, %v; want the queued response", got, err)
+	}
+}
+
+func TestScriptedProviderKinds(t *testing.T) {
+	p := NewScriptedProvider()
+	p.MatchKind("a_custom", "Assistant")
+
+	tests := []struct {
+		name     string
+		messages []Message
+		want     string
+	}{
+		{"narrator", dialog("# Initial Story Request Generator", "x"), "narrator"},
+		{"narrator_refine", dialog("# Story Config Refinement", "x"), "narrator_refine"},
+		{"no system prompt", []Message{{Role: RoleUser, Content: "Visual Novel Generation Assistant"}}, "default"},
+		{"no marker", dialog("# Something else", "x"), "default"},
+		// Подходят a_custom и novel_creator: побеждает первый по имени вида
+		{"first kind by name", dialog("# Visual Novel Generation Assistant", "x"), "a_custom"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := p.kindOf(tt.messages); got != tt.want {
+				t.Errorf("kindOf = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScriptedProviderQueue(t *testing.T) {
+	p := NewScriptedProvider()
+	p.Enqueue("narrator", "first", "second")
+	ctx := context.Background()
+	messages := dialog("# Initial Story Request Generator", "x")
+
+	for _, want := range []string{"first", "second"} {
+		if got, err := p.ChatCompletion(ctx, messages); err != nil || got != want {
+			t.Fatalf("ChatCompletion = %q, %v; want %q", got, err, want)
+		}
+	}
+	_, err := p.ChatCompletion(ctx, messages)
+	if err == nil || !strings.Contains(err.Error(), `kind "narrator"`) {
+		t.Fatalf("ChatCompletion with an empty queue: error = %v", err)
+	}
+	if calls := p.Calls(); len(calls) != 3 || calls[2].Kind != "narrator" || calls[2].Hash != PromptHash(messages) {
+		t.Fatalf("Calls = %+v", calls)
+	}
+}
+
+func TestScriptedProviderStream(t *testing.T) {
+	p := NewScriptedProvider()
+	response := strings.Repeat("0123456789", 15)
+	p.Enqueue("default", response)
+
+	var chunks []string
+	result, err := p.ChatCompletionStream(context.Background(), dialog("system", "x"), ChatOptions{Model: "other"}, func(delta string) error {
+		chunks = append(chunks, delta)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("ChatCompletionStream: %v", err)
+	}
+	if result.Content != response || result.Model != "other" || strings.Join(chunks, "") != response || len(chunks) != 3 {
+		t.Fatalf("result %q (model %q), %d chunks", result.Content, result.Model, len(chunks))
+	}
+	if p.Name() != "scripted" || p.Model() != "scripted" {
+		t.Fatalf("Name = %q, Model = %q", p.Name(), p.Model())
+	}
+}
+
+// writeFixture записывает файл фикстуры, создавая каталоги
+func writeFixture(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatalf("MkdirAll: %v", err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+}
+
+func TestLoadScriptedProvider(t *testing.T) {
+	dir := t.TempDir()
+	hashed := dialog("# Custom Writer", "hashed prompt")
+	writeFixture(t, filepath.Join(dir, "kinds.json"), `{"writer": "Custom Writer"}`)
+	writeFixture(t, filepath.Join(dir, "writer", "002_b.json"), "second")
+	writeFixture(t, filepath.Join(dir, "writer", "001_a.json"), "first")
+	writeFixture(t, filepath.Join(dir, "hashes", PromptHash(hashed)+".json"), "by hash")
+	writeFixture(t, filepath.Join(dir, "README.md"), "not a fixture")
+
+	p, err := LoadScriptedProvider(dir)
+	if err != nil {
+		t.Fatalf("LoadScriptedProvider: %v", err)
+	}
+	if got := p.Remaining("writer"); got != 2 {
+		t.Fatalf("Remaining(writer) = %d, want 2", got)
+	}
+
+	ctx := context.Background()
+	for _, tt := range []struct {
+		messages []Message
+		want     string
+	}{
+		{hashed, "by hash"},
+		{dialog("# Custom Writer", "x"), "first"},
+		{dialog("# Custom Writer", "y"), "second"},
+	} {
+		if got, err := p.ChatCompletion(ctx, tt.messages); err != nil || got != tt.want {
+			t.Fatalf("ChatCompletion = %q, %v; want %q", got, err, tt.want)
+		}
+	}
+}
+
+func TestLoadScriptedProviderErrors(t *testing.T) {
+	if _, err := LoadScriptedProvider(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Errorf("LoadScriptedProvider(missing dir) succeeded")
+	}
+
+	dir := t.TempDir()
+	writeFixture(t, filepath.Join(dir, "kinds.json"), `{"writer":`)
+	if _, err := LoadScriptedProvider(dir); err == nil || !strings.Contains(err.Error(), "kinds.json") {
+		t.Errorf("LoadScriptedProvider(broken kinds.json): error = %v", err)
+	}
+}
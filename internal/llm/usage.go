@@ -0,0 +1,140 @@
+package llm
+
+import (
+	"context"
+	"novel-server/internal/config"
+	"novel-server/internal/domain"
+	"novel-server/internal/logger"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// UsageTags описывает, для чего и для кого вызывается модель.
+// Сервисы кладут их в контекст запроса, а UsageRecordingProvider записывает вместе с токенами.
+type UsageTags struct {
+	Operation string // domain.LLMOperation*
+	UserID    string
+	NovelID   uuid.UUID // uuid.Nil, если новеллы еще нет
+}
+
+type usageTagsKey struct{}
+
+// WithUsageTags возвращает контекст с метками учета для вызовов модели.
+func WithUsageTags(ctx context.Context, tags UsageTags) context.Context {
+	return context.WithValue(ctx, usageTagsKey{}, tags)
+}
+
+// UsageTagsFromContext возвращает метки учета из контекста.
+func UsageTagsFromContext(ctx context.Context) (UsageTags, bool) {
+	tags, ok := ctx.Value(usageTagsKey{}).(UsageTags)
+	return tags, ok
+}
+
+// UsageRecorder сохраняет записи об использовании модели.
+type UsageRecorder interface {
+	RecordLLMUsage(ctx context.Context, usage *domain.LLMUsage) error
+}
+
+// UsageRecordingProvider оборачивает провайдера и записывает токены, задержку и стоимость
+// каждого успешного вызова вместе с метками из контекста (см. WithUsageTags).
+// Неудачные вызовы не записываются: бэкенд не сообщает для них расход токенов.
+type UsageRecordingProvider struct {
+	inner    LLMProvider
+	recorder UsageRecorder
+	prices   map[string]config.ModelPrice
+}
+
+// NewUsageRecordingProvider создает обертку учета над провайдером.
+// prices - цены моделей за миллион токенов; для моделей без цены стоимость записывается нулевой.
+func NewUsageRecordingProvider(inner LLMProvider, recorder UsageRecorder, prices map[string]config.ModelPrice) *UsageRecordingProvider {
+	return &UsageRecordingProvider{inner: inner, recorder: recorder, prices: prices}
+}
+
+// Name возвращает имя обернутого провайдера.
+func (p *UsageRecordingProvider) Name() string { return p.inner.Name() }
+
+// Model возвращает модель обернутого провайдера.
+func (p *UsageRecordingProvider) Model() string { return p.inner.Model() }
+
+// ChatCompletion вызывает обернутого провайдера и записывает расход.
+func (p *UsageRecordingProvider) ChatCompletion(ctx context.Context, messages []Message) (string, error) {
+	result, err := p.ChatCompletionWithOptions(ctx, messages, ChatOptions{})
+	if err != nil {
+		return "", err
+	}
+	return result.Content, nil
+}
+
+// ChatCompletionWithOptions вызывает обернутого провайдера и записывает расход.
+func (p *UsageRecordingProvider) ChatCompletionWithOptions(ctx context.Context, messages []Message, opts ChatOptions) (*ChatResult, error) {
+	started := time.Now()
+	result, err := p.inner.ChatCompletionWithOptions(ctx, messages, opts)
+	if err != nil {
+		return nil, err
+	}
+	p.record(ctx, result, time.Since(started))
+	return result, nil
+}
+
+// ChatCompletionStream стримит ответ обернутого провайдера и записывает расход, когда ответ получен целиком.
+func (p *UsageRecordingProvider) ChatCompletionStream(ctx context.Context, messages []Message, opts ChatOptions, onDelta DeltaFunc) (*ChatResult, error) {
+	started := time.Now()
+	result, err := p.inner.ChatCompletionStream(ctx, messages, opts, onDelta)
+	if err != nil {
+		return nil, err
+	}
+	p.record(ctx, result, time.Since(started))
+	return result, nil
+}
+
+// record сохраняет запись об использовании. Ошибка записи не должна ломать запрос.
+func (p *UsageRecordingProvider) record(ctx context.Context, result *ChatResult, latency time.Duration) {
+	tags, ok := UsageTagsFromContext(ctx)
+	if !ok {
+		logger.Logger.Warn("LLM call without usage tags, recording as unknown operation")
+		tags.Operation = "unknown"
+	}
+
+	model := result.Model
+	if model == "" {
+		model = p.inner.Model()
+	}
+
+	usage := &domain.LLMUsage{
+		UserID:           tags.UserID,
+		Operation:        tags.Operation,
+		Provider:         p.inner.Name(),
+		Model:            model,
+		PromptTokens:     result.Usage.PromptTokens,
+		CompletionTokens: result.Usage.CompletionTokens,
+		TotalTokens:      result.Usage.TotalTokens,
+		Cost:             p.cost(model, result.Usage),
+		LatencyMs:        latency.Milliseconds(),
+	}
+	if tags.NovelID != uuid.Nil {
+		novelID := tags.NovelID
+		usage.NovelID = &novelID
+	}
+	if usage.TotalTokens == 0 {
+		usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
+	}
+
+	// Ответ уже получен, поэтому запись не должна прерываться отменой запроса клиентом
+	if err := p.recorder.RecordLLMUsage(context.WithoutCancel(ctx), usage); err != nil {
+		logger.Logger.Warn("Failed to record LLM usage", "operation", usage.Operation, "model", model, "err", err)
+	}
+}
+
+// cost считает стоимость вызова в долларах. Цену ищем сначала по модели, которая ответила,
+// затем по модели провайдера (OpenRouter может вернуть более точное имя модели).
+func (p *UsageRecordingProvider) cost(model string, usage UsageInfo) float64 {
+	price, ok := p.prices[model]
+	if !ok {
+		price, ok = p.prices[p.inner.Model()]
+	}
+	if !ok {
+		return 0
+	}
+	return (float64(usage.PromptTokens)*price.Prompt + float64(usage.CompletionTokens)*price.Completion) / 1_000_000
+}
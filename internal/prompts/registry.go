@@ -0,0 +1,263 @@
+// Package prompts загружает версионированные шаблоны системных промптов и следит за их изменениями.
+//
+// Шаблоны лежат в каталоге в виде <dir>/<name>/<version>.md и используют синтаксис text/template.
+// Активной считается закрепленная в конфигурации версия, а если она не задана - последняя
+// из версий вида v<число> (v2 новее v1, v10 новее v9).
+package prompts
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+// Name - имя промпта (подкаталог в каталоге промптов)
+type Name string
+
+const (
+	// Narrator - генерация конфигурации новеллы по запросу пользователя
+	Narrator Name = "narrator"
+	// NarratorRefine - изменение готовой конфигурации новеллы по запросу пользователя
+	NarratorRefine Name = "narrator_refine"
+	// NovelCreator - генерация сетапа и сцен новеллы
+	NovelCreator Name = "novel_creator"
+)
+
+// Data - переменные, доступные в шаблоне. Неизвестные на момент запроса значения остаются нулевыми
+// (например, язык при создании черновика еще не известен).
+type Data struct {
+	Language         string // Язык новеллы
+	IsAdultContent   bool   // Новелла для взрослых
+	SceneCount       int    // Планируемое количество сцен
+	SceneIndex       int    // Индекс генерируемой сцены
+	SceneEventTarget int    // Желаемое количество событий в сцене
+	Stage            string // Текущая стадия новеллы (setup, scene_ready, ...)
+}
+
+// Prompt - отрисованный промпт вместе с его версией
+type Prompt struct {
+	Name    Name
+	Version string
+	Text    string
+}
+
+// ID возвращает идентификатор версии промпта для записи в базу: "<name>/<version>"
+func (p Prompt) ID() string {
+	return string(p.Name) + "/" + p.Version
+}
+
+// promptSet - загруженные версии одного промпта
+type promptSet struct {
+	templates map[string]*template.Template
+	versions  []string // По возрастанию
+}
+
+// Registry хранит загруженные шаблоны промптов. Безопасен для конкурентного использования.
+type Registry struct {
+	dir  string
+	pins map[Name]string
+
+	mu          sync.RWMutex
+	sets        map[Name]*promptSet
+	fingerprint string
+}
+
+// NewRegistry загружает все шаблоны из dir. pins закрепляет версии промптов;
+// закрепленная версия должна существовать.
+func NewRegistry(dir string, pins map[Name]string) (*Registry, error) {
+	r := &Registry{dir: dir, pins: pins}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Reload перечитывает шаблоны из каталога. Если какой-то шаблон не разбирается или
+// закрепленной версии нет, возвращает ошибку и оставляет прежние шаблоны.
+func (r *Registry) Reload() error {
+	sets, fingerprint, err := r.load()
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	r.sets = sets
+	r.fingerprint = fingerprint
+	r.mu.Unlock()
+
+	for name, set := range sets {
+		log.Printf("[Prompts] Loaded %s: versions %v, active %s", name, set.versions, r.activeVersion(name, set))
+	}
+	return nil
+}
+
+// load читает и разбирает все шаблоны каталога
+func (r *Registry) load() (map[Name]*promptSet, string, error) {
+	files, fingerprint, err := r.scan()
+	if err != nil {
+		return nil, "", err
+	}
+	if len(files) == 0 {
+		return nil, "", fmt.Errorf("no prompt templates found in %s", r.dir)
+	}
+
+	sets := make(map[Name]*promptSet)
+	for _, file := range files {
+		content, err := os.ReadFile(file)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to read prompt %s: %w", file, err)
+		}
+
+		name := Name(filepath.Base(filepath.Dir(file)))
+		version := strings.TrimSuffix(filepath.Base(file), ".md")
+		tmpl, err := template.New(string(name) + "/" + version).Option("missingkey=error").Parse(string(content))
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to parse prompt %s: %w", file, err)
+		}
+
+		set := sets[name]
+		if set == nil {
+			set = &promptSet{templates: make(map[string]*template.Template)}
+			sets[name] = set
+		}
+		set.templates[version] = tmpl
+		set.versions = append(set.versions, version)
+	}
+
+	for _, set := range sets {
+		sort.Slice(set.versions, func(i, j int) bool { return versionLess(set.versions[i], set.versions[j]) })
+	}
+	for name, version := range r.pins {
+		set := sets[name]
+		if set == nil || set.templates[version] == nil {
+			return nil, "", fmt.Errorf("pinned prompt version %s/%s not found in %s", name, version, r.dir)
+		}
+	}
+
+	return sets, fingerprint, nil
+}
+
+// scan возвращает файлы шаблонов и их отпечаток (имена, размеры, время изменения),
+// по которому Watch замечает изменения
+func (r *Registry) scan() ([]string, string, error) {
+	files, err := filepath.Glob(filepath.Join(r.dir, "*", "*.md"))
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to list prompts in %s: %w", r.dir, err)
+	}
+	var fingerprint strings.Builder
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to stat prompt %s: %w", file, err)
+		}
+		fmt.Fprintf(&fingerprint, "%s|%d|%d\n", file, info.Size(), info.ModTime().UnixNano())
+	}
+	return files, fingerprint.String(), nil
+}
+
+// Has сообщает, есть ли хотя бы одна версия промпта name
+func (r *Registry) Has(name Name) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.sets[name] != nil
+}
+
+// Render отрисовывает активную версию промпта name с переменными data
+func (r *Registry) Render(name Name, data Data) (Prompt, error) {
+	r.mu.RLock()
+	set := r.sets[name]
+	var version string
+	var tmpl *template.Template
+	if set != nil {
+		version = r.activeVersion(name, set)
+		tmpl = set.templates[version]
+	}
+	r.mu.RUnlock()
+
+	if tmpl == nil {
+		return Prompt{}, fmt.Errorf("prompt %q not found in %s", name, r.dir)
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return Prompt{}, fmt.Errorf("failed to render prompt %s/%s: %w", name, version, err)
+	}
+	return Prompt{Name: name, Version: version, Text: buf.String()}, nil
+}
+
+// activeVersion возвращает закрепленную версию промпта или последнюю
+func (r *Registry) activeVersion(name Name, set *promptSet) string {
+	if version, ok := r.pins[name]; ok {
+		return version
+	}
+	return set.versions[len(set.versions)-1]
+}
+
+// Watch раз в interval проверяет, изменились ли файлы промптов, и перечитывает их.
+// Ошибка перезагрузки попадает в лог, а в работе остаются прежние шаблоны. Работает до отмены ctx.
+func (r *Registry) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			fingerprint, changed := r.changed()
+			if !changed {
+				continue
+			}
+			log.Printf("[Prompts] Prompt files in %s changed, reloading", r.dir)
+			if err := r.Reload(); err != nil {
+				log.Printf("[Prompts] Reload failed, keeping previous prompts: %v", err)
+				// Не повторяем перезагрузку, пока файлы не изменятся снова
+				r.mu.Lock()
+				r.fingerprint = fingerprint
+				r.mu.Unlock()
+			}
+		}
+	}
+}
+
+// changed возвращает текущий отпечаток файлов шаблонов и сообщает, отличается ли он от загруженного
+func (r *Registry) changed() (string, bool) {
+	_, fingerprint, err := r.scan()
+	if err != nil {
+		// Например, файл удалили между чтением каталога и stat - перезагрузка разберется
+		return "", true
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return fingerprint, fingerprint != r.fingerprint
+}
+
+// versionLess сравнивает версии вида v<число>; остальные версии сравниваются как строки
+func versionLess(a, b string) bool {
+	na, okA := versionNumber(a)
+	nb, okB := versionNumber(b)
+	switch {
+	case okA && okB:
+		return na < nb
+	case okA != okB:
+		return okB // Произвольные версии считаются старше числовых, чтобы не стать активными по умолчанию
+	default:
+		return a < b
+	}
+}
+
+// versionNumber извлекает число из версии вида v<число>
+func versionNumber(version string) (int, bool) {
+	n, err := strconv.Atoi(strings.TrimPrefix(version, "v"))
+	return n, err == nil
+}
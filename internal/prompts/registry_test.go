@@ -0,0 +1,50 @@
+package prompts_test
+
+import (
+	"novel-server/internal/prompts"
+	"strings"
+	"testing"
+)
+
+func TestRenderNovelCreator(t *testing.T) {
+	registry, err := prompts.NewRegistry("../../promts", nil)
+	if err != nil {
+		t.Fatalf("NewRegistry: %v", err)
+	}
+
+	prompt, err := registry.Render(prompts.NovelCreator, prompts.Data{
+		Language:         "Russian",
+		IsAdultContent:   true,
+		SceneCount:       6,
+		SceneIndex:       2,
+		SceneEventTarget: 14,
+		Stage:            "scene_ready",
+	})
+	if err != nil {
+		t.Fatalf("Render: %v", err)
+	}
+	for _, want := range []string{
+		"The language of this novel is **Russian**.",
+		"marked as adult content (`is_adult_content: true`)",
+		"This novel has 6 scenes; the current request is for the `scene_ready` stage, scene index 2.",
+		"For this novel `scene_event_target` is **14**.",
+	} {
+		if !strings.Contains(prompt.Text, want) {
+			t.Errorf("prompt does not contain %q", want)
+		}
+	}
+
+	// Неизвестные значения не попадают в промпт
+	prompt, err = registry.Render(prompts.NovelCreator, prompts.Data{})
+	if err != nil {
+		t.Fatalf("Render(empty data): %v", err)
+	}
+	for _, unwanted := range []string{"The language of this novel", "This novel has", "For this novel"} {
+		if strings.Contains(prompt.Text, unwanted) {
+			t.Errorf("prompt with empty data contains %q", unwanted)
+		}
+	}
+	if !strings.Contains(prompt.Text, "for a general audience (`is_adult_content: false`)") {
+		t.Errorf("prompt with empty data does not describe a general audience novel")
+	}
+}
@@ -0,0 +1,277 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"novel-server/internal/domain"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// MemoryNovelDraftRepository реализует NovelDraftRepository в памяти процесса
+// с той же семантикой, что и PostgresNovelDraftRepository.
+type MemoryNovelDraftRepository struct {
+	mu     sync.RWMutex
+	drafts map[uuid.UUID]*memoryDraft
+}
+
+// memoryDraft - черновик вместе со всеми его ревизиями (по возрастанию номера)
+type memoryDraft struct {
+	draftID    uuid.UUID
+	userID     string
+	revision   int
+	configJSON []byte
+	createdAt  time.Time
+	updatedAt  time.Time
+	revisions  []memoryDraftRevision
+}
+
+// memoryDraftRevision - строка таблицы novel_draft_revisions
+type memoryDraftRevision struct {
+	revision     int
+	source       string
+	prompt       string
+	restoredFrom *int
+	patch        json.RawMessage
+	configJSON   []byte
+	createdAt    time.Time
+}
+
+// NewMemoryNovelDraftRepository создает пустое хранилище черновиков в памяти.
+func NewMemoryNovelDraftRepository() *MemoryNovelDraftRepository {
+	return &MemoryNovelDraftRepository{drafts: make(map[uuid.UUID]*memoryDraft)}
+}
+
+// userDraftLocked возвращает черновик пользователя или nil, если его нет
+func (r *MemoryNovelDraftRepository) userDraftLocked(userID string, draftID uuid.UUID) *memoryDraft {
+	draft, ok := r.drafts[draftID]
+	if !ok || draft.userID != userID {
+		return nil
+	}
+	return draft
+}
+
+// SaveDraft сохраняет новый черновик вместе с его первой ревизией
+func (r *MemoryNovelDraftRepository) SaveDraft(ctx context.Context, userID string, draftID uuid.UUID, configJSON []byte, prompt string) error {
+	if !json.Valid(configJSON) {
+		return fmt.Errorf("failed to save draft: config is not valid JSON")
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.drafts[draftID]; ok {
+		return fmt.Errorf("failed to save draft: %w", ErrAlreadyExists)
+	}
+	now := time.Now()
+	r.drafts[draftID] = &memoryDraft{
+		draftID:    draftID,
+		userID:     userID,
+		revision:   1,
+		configJSON: cloneBytes(configJSON),
+		createdAt:  now,
+		updatedAt:  now,
+		revisions: []memoryDraftRevision{{
+			revision:   1,
+			source:     domain.DraftRevisionCreate,
+			prompt:     prompt,
+			configJSON: cloneBytes(configJSON),
+			createdAt:  now,
+		}},
+	}
+	return nil
+}
+
+// GetDraftConfigJSON получает сериализованный конфиг черновика по ID
+func (r *MemoryNovelDraftRepository) GetDraftConfigJSON(ctx context.Context, userID string, draftID uuid.UUID) ([]byte, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	draft := r.userDraftLocked(userID, draftID)
+	if draft == nil {
+		return nil, fmt.Errorf("failed to get draft: %w", ErrNotFound)
+	}
+	return cloneBytes(draft.configJSON), nil
+}
+
+// GetDraft возвращает черновик пользователя вместе с конфигом. Возвращает ErrNotFound, если его нет.
+func (r *MemoryNovelDraftRepository) GetDraft(ctx context.Context, userID string, draftID uuid.UUID) (*domain.NovelDraft, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	d := r.userDraftLocked(userID, draftID)
+	if d == nil {
+		return nil, ErrNotFound
+	}
+	draft := domain.NovelDraft{
+		DraftID:   d.draftID,
+		UserID:    d.userID,
+		Revision:  d.revision,
+		CreatedAt: d.createdAt,
+		UpdatedAt: d.updatedAt,
+	}
+	if err := json.Unmarshal(d.configJSON, &draft.Config); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal draft config: %w", err)
+	}
+	return &draft, nil
+}
+
+// ListDrafts возвращает черновики пользователя без полного конфига, последние измененные первыми
+func (r *MemoryNovelDraftRepository) ListDrafts(ctx context.Context, userID string, limit, offset int) ([]domain.NovelDraftSummary, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	drafts := []domain.NovelDraftSummary{}
+	for _, d := range r.drafts {
+		if d.userID != userID {
+			continue
+		}
+		var config struct {
+			Title            string `json:"title"`
+			ShortDescription string `json:"short_description"`
+			Genre            string `json:"genre"`
+		}
+		if err := json.Unmarshal(d.configJSON, &config); err != nil {
+			return nil, fmt.Errorf("failed to scan draft: %w", err)
+		}
+		drafts = append(drafts, domain.NovelDraftSummary{
+			DraftID:          d.draftID,
+			Title:            config.Title,
+			ShortDescription: config.ShortDescription,
+			Genre:            config.Genre,
+			Revision:         d.revision,
+			CreatedAt:        d.createdAt,
+			UpdatedAt:        d.updatedAt,
+		})
+	}
+	sort.Slice(drafts, func(i, j int) bool {
+		if !drafts[i].UpdatedAt.Equal(drafts[j].UpdatedAt) {
+			return drafts[i].UpdatedAt.After(drafts[j].UpdatedAt)
+		}
+		return bytes.Compare(drafts[i].DraftID[:], drafts[j].DraftID[:]) < 0
+	})
+	return paginate(drafts, limit, offset), nil
+}
+
+// AppendDraftRevision заменяет конфиг черновика и добавляет ревизию под одной блокировкой,
+// поэтому параллельные уточнения получают разные номера ревизий.
+func (r *MemoryNovelDraftRepository) AppendDraftRevision(ctx context.Context, userID string, draftID uuid.UUID, configJSON []byte, revision *domain.DraftRevision) error {
+	if !json.Valid(configJSON) {
+		return fmt.Errorf("failed to update draft: config is not valid JSON")
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	draft := r.userDraftLocked(userID, draftID)
+	if draft == nil {
+		return ErrNotFound
+	}
+
+	now := time.Now()
+	draft.revision++
+	draft.configJSON = cloneBytes(configJSON)
+	draft.updatedAt = now
+
+	var restoredFrom *int
+	if revision.RestoredFrom != nil {
+		from := *revision.RestoredFrom
+		restoredFrom = &from
+	}
+	var patch json.RawMessage
+	if len(revision.Patch) > 0 {
+		patch = json.RawMessage(cloneBytes(revision.Patch))
+	}
+	draft.revisions = append(draft.revisions, memoryDraftRevision{
+		revision:     draft.revision,
+		source:       revision.Source,
+		prompt:       revision.Prompt,
+		restoredFrom: restoredFrom,
+		patch:        patch,
+		configJSON:   cloneBytes(configJSON),
+		createdAt:    now,
+	})
+
+	revision.DraftID = draftID
+	revision.Revision = draft.revision
+	revision.CreatedAt = now
+	return nil
+}
+
+// toDomain возвращает ревизию без конфига
+func (v *memoryDraftRevision) toDomain(draftID uuid.UUID) domain.DraftRevision {
+	revision := domain.DraftRevision{
+		DraftID:   draftID,
+		Revision:  v.revision,
+		Source:    v.source,
+		Prompt:    v.prompt,
+		CreatedAt: v.createdAt,
+	}
+	if v.restoredFrom != nil {
+		from := *v.restoredFrom
+		revision.RestoredFrom = &from
+	}
+	if v.patch != nil {
+		revision.Patch = json.RawMessage(cloneBytes(v.patch))
+	}
+	return revision
+}
+
+// ListDraftRevisions возвращает ревизии черновика пользователя без конфигов (но с патчами), по возрастанию номера
+func (r *MemoryNovelDraftRepository) ListDraftRevisions(ctx context.Context, userID string, draftID uuid.UUID) ([]domain.DraftRevision, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	revisions := []domain.DraftRevision{}
+	draft := r.userDraftLocked(userID, draftID)
+	if draft == nil {
+		return revisions, nil
+	}
+	for i := range draft.revisions {
+		revisions = append(revisions, draft.revisions[i].toDomain(draftID))
+	}
+	return revisions, nil
+}
+
+// GetDraftRevision возвращает ревизию черновика пользователя вместе с конфигом.
+// Возвращает ErrNotFound, если черновика или ревизии нет.
+func (r *MemoryNovelDraftRepository) GetDraftRevision(ctx context.Context, userID string, draftID uuid.UUID, revision int) (*domain.DraftRevision, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	draft := r.userDraftLocked(userID, draftID)
+	if draft == nil {
+		return nil, ErrNotFound
+	}
+	for i := range draft.revisions {
+		if draft.revisions[i].revision != revision {
+			continue
+		}
+		v := draft.revisions[i].toDomain(draftID)
+		v.Config = &domain.NovelConfig{}
+		if err := json.Unmarshal(draft.revisions[i].configJSON, v.Config); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal draft revision config: %w", err)
+		}
+		return &v, nil
+	}
+	return nil, ErrNotFound
+}
+
+// DeleteDraft удаляет черновик вместе с его ревизиями
+func (r *MemoryNovelDraftRepository) DeleteDraft(ctx context.Context, userID string, draftID uuid.UUID) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.userDraftLocked(userID, draftID) == nil {
+		return ErrNotFound
+	}
+	delete(r.drafts, draftID)
+	return nil
+}
+
+var _ domain.NovelDraftRepository = (*MemoryNovelDraftRepository)(nil)
@@ -0,0 +1,52 @@
+package repository
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// MemoryQuotaRepository реализует QuotaRepository в памяти процесса
+type MemoryQuotaRepository struct {
+	mu       sync.Mutex
+	counters map[memoryQuotaKey]int
+}
+
+// memoryQuotaKey - ключ таблицы user_quota_counters. Окно хранится в наносекундах,
+// чтобы одинаковые моменты в разных часовых поясах давали один ключ.
+type memoryQuotaKey struct {
+	userID      string
+	kind        string
+	windowStart int64
+}
+
+// NewMemoryQuotaRepository создает пустое хранилище счетчиков квот в памяти.
+func NewMemoryQuotaRepository() *MemoryQuotaRepository {
+	return &MemoryQuotaRepository{counters: make(map[memoryQuotaKey]int)}
+}
+
+// ConsumeQuota атомарно увеличивает счетчик, если лимит еще не исчерпан
+func (r *MemoryQuotaRepository) ConsumeQuota(ctx context.Context, userID, kind string, windowStart time.Time, limit int) (int, bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := memoryQuotaKey{userID: userID, kind: kind, windowStart: windowStart.UnixNano()}
+	used, ok := r.counters[key]
+	// Как в SQL-реализациях: первая запись в окне создает счетчик даже при нулевом лимите
+	if ok && used >= limit {
+		return limit, false, nil
+	}
+	used++
+	r.counters[key] = used
+	return used, true, nil
+}
+
+// GetQuotaUsage возвращает значение счетчика в окне
+func (r *MemoryQuotaRepository) GetQuotaUsage(ctx context.Context, userID, kind string, windowStart time.Time) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.counters[memoryQuotaKey{userID: userID, kind: kind, windowStart: windowStart.UnixNano()}], nil
+}
+
+var _ QuotaRepository = (*MemoryQuotaRepository)(nil)
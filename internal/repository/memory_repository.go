@@ -0,0 +1,1092 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"novel-server/internal/domain"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// MemoryNovelRepository реализует NovelRepository в памяти процесса. Данные теряются при
+// перезапуске; хранилище предназначено для тестов и запуска без базы данных.
+// Семантика совпадает с PostgresNovelRepository, включая ErrNotFound для отсутствующих записей.
+type MemoryNovelRepository struct {
+	mu sync.RWMutex
+
+	novels map[uuid.UUID]*memoryNovel
+	// states и storyProgress хранятся в порядке вставки: первый подходящий элемент -
+	// самая ранняя запись, как ORDER BY created_at в PostgreSQL
+	states        []*memoryNovelState
+	storyProgress []*memoryStoryProgress
+	progress      map[memoryProgressKey]int
+}
+
+// memoryNovel - строка таблицы novels вместе с выданными доступами по ссылке
+type memoryNovel struct {
+	novelID          uuid.UUID
+	userID           string
+	title            string
+	shortDescription string
+	configData       []byte
+	isAdultContent   bool
+	visibility       string
+	shareToken       string
+	setupStateData   []byte
+	grants           map[string]bool
+	createdAt        time.Time
+	updatedAt        time.Time
+}
+
+// memoryNovelState - строка таблицы novel_states
+type memoryNovelState struct {
+	novelID    uuid.UUID
+	sceneIndex int
+	stateHash  string
+	stateData  []byte
+	createdAt  time.Time
+	updatedAt  time.Time
+}
+
+// memoryStoryProgress - строка таблицы user_story_progress. Прогресс хранится
+// сериализованным, чтобы вызывающий код не мог изменить его после сохранения.
+type memoryStoryProgress struct {
+	novelID    uuid.UUID
+	userID     string
+	sceneIndex int
+	stateHash  string
+	data       []byte
+}
+
+// memoryProgressKey - ключ таблицы user_novel_progress
+type memoryProgressKey struct {
+	novelID uuid.UUID
+	userID  string
+}
+
+// NewMemoryNovelRepository создает пустое хранилище новелл в памяти.
+func NewMemoryNovelRepository() *MemoryNovelRepository {
+	return &MemoryNovelRepository{
+		novels:   make(map[uuid.UUID]*memoryNovel),
+		progress: make(map[memoryProgressKey]int),
+	}
+}
+
+// cloneBytes копирует данные, чтобы хранилище не разделяло срезы с вызывающим кодом
+func cloneBytes(data []byte) []byte {
+	if data == nil {
+		return nil
+	}
+	return append([]byte(nil), data...)
+}
+
+// currentStage возвращает значение current_stage из состояния новеллы
+func currentStage(stateData []byte) string {
+	var state struct {
+		CurrentStage string `json:"current_stage"`
+	}
+	if err := json.Unmarshal(stateData, &state); err != nil {
+		return ""
+	}
+	return state.CurrentStage
+}
+
+// novelTitle возвращает название новеллы и false, если новеллы нет
+func (r *MemoryNovelRepository) novelTitle(novelID uuid.UUID) (string, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	novel, ok := r.novels[novelID]
+	if !ok {
+		return "", false
+	}
+	return novel.title, true
+}
+
+// cloneLocked копирует все данные хранилища для транзакции WithTx. Срезы байт не копируются:
+// хранилище их не изменяет, а только заменяет.
+func (r *MemoryNovelRepository) cloneLocked() *MemoryNovelRepository {
+	clone := &MemoryNovelRepository{
+		novels:        make(map[uuid.UUID]*memoryNovel, len(r.novels)),
+		states:        make([]*memoryNovelState, 0, len(r.states)),
+		storyProgress: make([]*memoryStoryProgress, 0, len(r.storyProgress)),
+		progress:      make(map[memoryProgressKey]int, len(r.progress)),
+	}
+	for id, novel := range r.novels {
+		copied := *novel
+		copied.grants = make(map[string]bool, len(novel.grants))
+		for userID := range novel.grants {
+			copied.grants[userID] = true
+		}
+		clone.novels[id] = &copied
+	}
+	for _, state := range r.states {
+		copied := *state
+		clone.states = append(clone.states, &copied)
+	}
+	for _, p := range r.storyProgress {
+		copied := *p
+		clone.storyProgress = append(clone.storyProgress, &copied)
+	}
+	for key, sceneIndex := range r.progress {
+		clone.progress[key] = sceneIndex
+	}
+	return clone
+}
+
+// WithTx выполняет fn над копией хранилища и заменяет данные хранилища копией, если fn вернула nil.
+// На время fn хранилище заблокировано, поэтому fn должна обращаться только к tx.
+func (r *MemoryNovelRepository) WithTx(ctx context.Context, fn func(tx NovelRepository) error) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	tx := r.cloneLocked()
+	if err := fn(tx); err != nil {
+		return err
+	}
+	r.novels = tx.novels
+	r.states = tx.states
+	r.storyProgress = tx.storyProgress
+	r.progress = tx.progress
+	return nil
+}
+
+// LockSceneGeneration выполняет fn сразу: хранилище доступно только своему процессу
+func (r *MemoryNovelRepository) LockSceneGeneration(ctx context.Context, novelID uuid.UUID, stateHash string, fn func(ctx context.Context) error) error {
+	return fn(ctx)
+}
+
+// CreateNovel создает новую запись о новелле в хранилище.
+func (r *MemoryNovelRepository) CreateNovel(ctx context.Context, userID string, config *domain.NovelConfig) (uuid.UUID, error) {
+	if userID == "" {
+		return uuid.Nil, fmt.Errorf("userID cannot be empty")
+	}
+
+	configData, err := json.Marshal(config)
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("failed to marshal novel config: %w", err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	novelID := uuid.New()
+	r.novels[novelID] = &memoryNovel{
+		novelID:          novelID,
+		userID:           userID,
+		title:            config.Title,
+		shortDescription: config.ShortDescription,
+		configData:       configData,
+		isAdultContent:   config.IsAdultContent,
+		visibility:       domain.VisibilityPrivate,
+		grants:           make(map[string]bool),
+		createdAt:        now,
+		updatedAt:        now,
+	}
+	return novelID, nil
+}
+
+// metadata возвращает метаданные новеллы
+func (n *memoryNovel) metadata() domain.NovelMetadata {
+	return domain.NovelMetadata{
+		NovelID:          n.novelID,
+		UserID:           n.userID,
+		Title:            n.title,
+		ShortDescription: n.shortDescription,
+		CreatedAt:        n.createdAt,
+		UpdatedAt:        n.updatedAt,
+	}
+}
+
+// GetNovelMetadataByID возвращает краткую информацию (метаданные) о новелле по ID.
+func (r *MemoryNovelRepository) GetNovelMetadataByID(ctx context.Context, novelID uuid.UUID, userID string) (*domain.NovelMetadata, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	novel, ok := r.novels[novelID]
+	if !ok || novel.userID != userID {
+		return nil, fmt.Errorf("novel not found or not owned by user: %w", ErrNotFound)
+	}
+	meta := novel.metadata()
+	return &meta, nil
+}
+
+// GetNovelConfigByID возвращает полную конфигурацию новеллы по ID.
+func (r *MemoryNovelRepository) GetNovelConfigByID(ctx context.Context, novelID uuid.UUID, userID string) (*domain.NovelConfig, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	novel, ok := r.novels[novelID]
+	if !ok {
+		return nil, fmt.Errorf("novel not found: %w", ErrNotFound)
+	}
+
+	var config domain.NovelConfig
+	if err := json.Unmarshal(novel.configData, &config); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal novel config data: %w", err)
+	}
+	config.Title = novel.title
+	config.ShortDescription = novel.shortDescription
+	return &config, nil
+}
+
+// ListNovelsByUser возвращает список метаданных новелл для указанного пользователя.
+func (r *MemoryNovelRepository) ListNovelsByUser(ctx context.Context, userID string, limit, offset int) ([]domain.NovelMetadata, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	novels := []domain.NovelMetadata{}
+	for _, novel := range r.novels {
+		if novel.userID == userID {
+			novels = append(novels, novel.metadata())
+		}
+	}
+	sort.Slice(novels, func(i, j int) bool {
+		return novels[i].UpdatedAt.After(novels[j].UpdatedAt)
+	})
+	return paginate(novels, limit, offset), nil
+}
+
+// paginate возвращает страницу items как LIMIT limit OFFSET offset
+func paginate[T any](items []T, limit, offset int) []T {
+	if offset < 0 {
+		offset = 0
+	}
+	if offset >= len(items) {
+		return items[:0]
+	}
+	items = items[offset:]
+	if limit >= 0 && limit < len(items) {
+		items = items[:limit]
+	}
+	return items
+}
+
+// isSetupedLocked сообщает, есть ли у новеллы сетап или сцена с индексом 0
+func (r *MemoryNovelRepository) isSetupedLocked(novel *memoryNovel) bool {
+	if novel.setupStateData != nil {
+		return true
+	}
+	_, ok := r.earliestStateLocked(novel.novelID, 0)
+	return ok
+}
+
+// inScope сообщает, попадает ли новелла в область списка scope для пользователя userID
+func (n *memoryNovel) inScope(scope, userID string) bool {
+	switch scope {
+	case domain.NovelScopeAll:
+		return true
+	case domain.NovelScopePublic:
+		return n.visibility == domain.VisibilityPublic
+	default:
+		return n.userID == userID
+	}
+}
+
+// novelBefore сообщает, идет ли новелла a раньше b в списке (created_at DESC, novel_id DESC)
+func novelBefore(a, b *memoryNovel) bool {
+	if !a.createdAt.Equal(b.createdAt) {
+		return a.createdAt.After(b.createdAt)
+	}
+	return bytes.Compare(a.novelID[:], b.novelID[:]) > 0
+}
+
+// ListNovels возвращает список новелл с поддержкой курсорной пагинации и информацией о прогрессе пользователя.
+func (r *MemoryNovelRepository) ListNovels(ctx context.Context, userID, scope string, limit int, cursor *uuid.UUID) ([]domain.NovelListItem, int, *uuid.UUID, error) {
+	if userID == "" {
+		return nil, 0, nil, fmt.Errorf("userID is required to list novels with progress")
+	}
+	if limit <= 0 {
+		limit = 10
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var cursorNovel *memoryNovel
+	if cursor != nil {
+		var ok bool
+		if cursorNovel, ok = r.novels[*cursor]; !ok {
+			return nil, 0, nil, fmt.Errorf("cursor novel not found")
+		}
+	}
+
+	candidates := []*memoryNovel{}
+	totalCount := 0
+	for _, novel := range r.novels {
+		if !novel.inScope(scope, userID) {
+			continue
+		}
+		if r.isSetupedLocked(novel) {
+			totalCount++
+		}
+		if cursorNovel != nil && !novelBefore(cursorNovel, novel) {
+			continue
+		}
+		candidates = append(candidates, novel)
+	}
+	sort.Slice(candidates, func(i, j int) bool { return novelBefore(candidates[i], candidates[j]) })
+
+	var nextCursor *uuid.UUID
+	if len(candidates) > limit {
+		nextID := candidates[limit-1].novelID
+		nextCursor = &nextID
+		candidates = candidates[:limit]
+	}
+
+	novels := make([]domain.NovelListItem, 0, len(candidates))
+	for _, novel := range candidates {
+		item := domain.NovelListItem{
+			NovelID:          novel.novelID,
+			Title:            novel.title,
+			ShortDescription: novel.shortDescription,
+			IsAdultContent:   novel.isAdultContent,
+			Visibility:       novel.visibility,
+			CreatedAt:        novel.createdAt,
+			UpdatedAt:        novel.updatedAt,
+			IsSetuped:        r.isSetupedLocked(novel),
+		}
+		if sceneIndex, ok := r.progress[memoryProgressKey{novel.novelID, userID}]; ok {
+			item.IsStartedByUser = true
+			item.CurrentUserSceneIndex = &sceneIndex
+		}
+
+		var config domain.NovelConfig
+		if err := json.Unmarshal(novel.configData, &config); err != nil {
+			if item.ShortDescription == "" {
+				item.ShortDescription = "Описание недоступно"
+			}
+		} else {
+			item.TotalScenesCount = determineSceneCountFromLength(config.StoryConfig.Length)
+			if item.ShortDescription == "" && config.ShortDescription != "" {
+				item.ShortDescription = config.ShortDescription
+			}
+		}
+		novels = append(novels, item)
+	}
+
+	return novels, totalCount, nextCursor, nil
+}
+
+// GetNovelDetails возвращает детальную информацию о новелле, включая персонажей из сетапа
+func (r *MemoryNovelRepository) GetNovelDetails(ctx context.Context, novelID uuid.UUID) (*domain.NovelDetailsResponse, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	novel, ok := r.novels[novelID]
+	if !ok {
+		return nil, fmt.Errorf("novel not found: %w", ErrNotFound)
+	}
+
+	details := domain.NovelDetailsResponse{
+		NovelID:          novel.novelID,
+		UserID:           novel.userID,
+		Visibility:       novel.visibility,
+		Title:            novel.title,
+		ShortDescription: novel.shortDescription,
+		CreatedAt:        novel.createdAt,
+		UpdatedAt:        novel.updatedAt,
+	}
+	for _, state := range r.states {
+		if state.novelID == novelID {
+			details.ScenesCount++
+		}
+	}
+
+	var config domain.NovelConfig
+	if err := json.Unmarshal(novel.configData, &config); err == nil {
+		details.Genre = config.Genre
+		details.Language = config.Language
+		details.WorldContext = config.WorldContext
+		details.EndingPreference = config.EndingPreference
+		details.PlayerName = config.PlayerName
+		details.PlayerGender = config.PlayerGender
+		if details.ShortDescription == "" && config.ShortDescription != "" {
+			details.ShortDescription = config.ShortDescription
+		}
+	}
+
+	if !r.isSetupedLocked(novel) {
+		return nil, fmt.Errorf("novel not setuped")
+	}
+
+	if setupStateData, err := r.setupStateLocked(novelID); err == nil {
+		var setupState domain.NovelState
+		if err := json.Unmarshal(setupStateData, &setupState); err == nil {
+			details.Characters = setupState.Characters
+		}
+	}
+
+	return &details, nil
+}
+
+// GetNovelIsAdult возвращает флаг is_adult_content для новеллы.
+func (r *MemoryNovelRepository) GetNovelIsAdult(ctx context.Context, novelID uuid.UUID) (bool, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	novel, ok := r.novels[novelID]
+	if !ok {
+		return false, fmt.Errorf("novel not found: %w", ErrNotFound)
+	}
+	return novel.isAdultContent, nil
+}
+
+// UpdateNovel меняет название и краткое описание новеллы владельца ownerID
+// и в полях новеллы, и в ее конфиге.
+func (r *MemoryNovelRepository) UpdateNovel(ctx context.Context, novelID uuid.UUID, ownerID string, title, shortDescription *string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	novel, ok := r.novels[novelID]
+	if !ok || novel.userID != ownerID {
+		return ErrNotFound
+	}
+
+	var config map[string]interface{}
+	if err := json.Unmarshal(novel.configData, &config); err != nil || config == nil {
+		config = make(map[string]interface{})
+	}
+	if title != nil {
+		novel.title = *title
+		config["title"] = *title
+	}
+	if shortDescription != nil {
+		novel.shortDescription = *shortDescription
+		config["short_description"] = *shortDescription
+	}
+	configData, err := json.Marshal(config)
+	if err != nil {
+		return fmt.Errorf("failed to update novel: %w", err)
+	}
+	novel.configData = configData
+	novel.updatedAt = time.Now()
+	return nil
+}
+
+// DeleteNovel удаляет новеллу вместе с ее состояниями, прогрессом игроков и доступами по ссылке.
+func (r *MemoryNovelRepository) DeleteNovel(ctx context.Context, novelID uuid.UUID) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.novels[novelID]; !ok {
+		return ErrNotFound
+	}
+	delete(r.novels, novelID)
+
+	states := r.states[:0]
+	for _, state := range r.states {
+		if state.novelID != novelID {
+			states = append(states, state)
+		}
+	}
+	r.states = states
+
+	r.removeStoryProgressLocked(func(p *memoryStoryProgress) bool { return p.novelID == novelID })
+	for key := range r.progress {
+		if key.novelID == novelID {
+			delete(r.progress, key)
+		}
+	}
+	return nil
+}
+
+// SetNovelOwner передает новеллу другому пользователю.
+func (r *MemoryNovelRepository) SetNovelOwner(ctx context.Context, novelID uuid.UUID, userID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	novel, ok := r.novels[novelID]
+	if !ok {
+		return ErrNotFound
+	}
+	novel.userID = userID
+	novel.updatedAt = time.Now()
+	return nil
+}
+
+// GetNovelAccess возвращает владельца и видимость новеллы и сообщает, открывал ли userID ссылку на нее
+func (r *MemoryNovelRepository) GetNovelAccess(ctx context.Context, novelID uuid.UUID, userID string) (*domain.NovelAccess, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	novel, ok := r.novels[novelID]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &domain.NovelAccess{
+		OwnerID:    novel.userID,
+		Visibility: novel.visibility,
+		Granted:    novel.grants[userID],
+	}, nil
+}
+
+// SetNovelVisibility меняет видимость новеллы владельца ownerID
+func (r *MemoryNovelRepository) SetNovelVisibility(ctx context.Context, novelID uuid.UUID, ownerID, visibility string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	novel, ok := r.novels[novelID]
+	if !ok || novel.userID != ownerID {
+		return ErrNotFound
+	}
+	novel.visibility = visibility
+	novel.updatedAt = time.Now()
+	return nil
+}
+
+// SetNovelShareToken задает токен ссылки на новеллу владельца ownerID.
+// Пустой token отключает ссылку и отзывает доступ всех, кто ее открывал.
+func (r *MemoryNovelRepository) SetNovelShareToken(ctx context.Context, novelID uuid.UUID, ownerID, token string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	novel, ok := r.novels[novelID]
+	if !ok || novel.userID != ownerID {
+		return ErrNotFound
+	}
+	if token != "" {
+		// share_token уникален
+		for _, other := range r.novels {
+			if other != novel && other.shareToken == token {
+				return fmt.Errorf("failed to set share token: %w", ErrAlreadyExists)
+			}
+		}
+	}
+	novel.shareToken = token
+	if token == "" {
+		novel.grants = make(map[string]bool)
+	}
+	novel.updatedAt = time.Now()
+	return nil
+}
+
+// GetNovelByShareToken возвращает ID и видимость новеллы по токену ссылки
+func (r *MemoryNovelRepository) GetNovelByShareToken(ctx context.Context, token string) (uuid.UUID, string, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if token == "" {
+		return uuid.Nil, "", ErrNotFound
+	}
+	for _, novel := range r.novels {
+		if novel.shareToken == token {
+			return novel.novelID, novel.visibility, nil
+		}
+	}
+	return uuid.Nil, "", ErrNotFound
+}
+
+// GrantNovelAccess запоминает, что userID открыл ссылку на новеллу
+func (r *MemoryNovelRepository) GrantNovelAccess(ctx context.Context, novelID uuid.UUID, userID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	novel, ok := r.novels[novelID]
+	if !ok {
+		return fmt.Errorf("failed to grant novel access: novel %s not found", novelID)
+	}
+	novel.grants[userID] = true
+	return nil
+}
+
+// upsertProgressLocked обновляет текущую сцену пользователя. При keepMax индекс сцены
+// только растет, иначе заменяется на sceneIndex.
+func (r *MemoryNovelRepository) upsertProgressLocked(novelID uuid.UUID, userID string, sceneIndex int, keepMax bool) error {
+	if _, ok := r.novels[novelID]; !ok {
+		return fmt.Errorf("failed to update user progress: novel %s not found", novelID)
+	}
+	key := memoryProgressKey{novelID, userID}
+	if current, ok := r.progress[key]; ok && keepMax && current >= sceneIndex {
+		return nil
+	}
+	r.progress[key] = sceneIndex
+	return nil
+}
+
+// saveSetupStateLocked сохраняет сетап в поле новеллы; отсутствие новеллы не считается ошибкой,
+// как UPDATE без затронутых строк
+func (r *MemoryNovelRepository) saveSetupStateLocked(novelID uuid.UUID, setupData []byte) {
+	if novel, ok := r.novels[novelID]; ok {
+		novel.setupStateData = cloneBytes(setupData)
+		novel.updatedAt = time.Now()
+	}
+}
+
+// SaveNovelState сохраняет состояние новеллы (stateData) для определенной сцены.
+// Сетап (current_stage="setup") сохраняется отдельно, в поле новеллы.
+func (r *MemoryNovelRepository) SaveNovelState(ctx context.Context, novelID uuid.UUID, sceneIndex int, userID string, stateHash string, stateData []byte) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if currentStage(stateData) == "setup" {
+		r.saveSetupStateLocked(novelID, stateData)
+		return r.upsertProgressLocked(novelID, userID, sceneIndex, true)
+	}
+
+	if _, ok := r.novels[novelID]; !ok {
+		return fmt.Errorf("failed to save novel state: novel %s not found", novelID)
+	}
+
+	now := time.Now()
+	existing := false
+	for _, state := range r.states {
+		if state.novelID == novelID && state.sceneIndex == sceneIndex && state.stateHash == stateHash {
+			// Как ON CONFLICT DO UPDATE SET updated_at: данные остаются прежними
+			state.updatedAt = now
+			existing = true
+			break
+		}
+	}
+	if !existing {
+		r.states = append(r.states, &memoryNovelState{
+			novelID:    novelID,
+			sceneIndex: sceneIndex,
+			stateHash:  stateHash,
+			stateData:  cloneBytes(stateData),
+			createdAt:  now,
+			updatedAt:  now,
+		})
+	}
+
+	return r.upsertProgressLocked(novelID, userID, sceneIndex, true)
+}
+
+// earliestStateLocked возвращает самое раннее состояние новеллы для сцены sceneIndex
+func (r *MemoryNovelRepository) earliestStateLocked(novelID uuid.UUID, sceneIndex int) ([]byte, bool) {
+	for _, state := range r.states {
+		if state.novelID == novelID && state.sceneIndex == sceneIndex {
+			return state.stateData, true
+		}
+	}
+	return nil, false
+}
+
+// setupSceneIndex возвращает индекс первой сцены сетапа (0, если сцен нет)
+func setupSceneIndex(setupData []byte) (int, bool) {
+	var setupState struct {
+		Scenes []struct {
+			Index int `json:"index"`
+		} `json:"scenes"`
+	}
+	if err := json.Unmarshal(setupData, &setupState); err != nil || len(setupState.Scenes) == 0 {
+		return 0, false
+	}
+	return setupState.Scenes[0].Index, true
+}
+
+// GetLatestNovelState возвращает самое последнее сохраненное состояние новеллы (stateData)
+// и его индекс сцены для конкретного пользователя.
+func (r *MemoryNovelRepository) GetLatestNovelState(ctx context.Context, novelID uuid.UUID, userID string) (stateData []byte, sceneIndex int, err error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	currentSceneIndex, ok := r.progress[memoryProgressKey{novelID, userID}]
+	if !ok {
+		// Новый пользователь: первая сцена новеллы, иначе сетап
+		if data, ok := r.earliestStateLocked(novelID, 0); ok {
+			return cloneBytes(data), 0, nil
+		}
+		setupData, err := r.setupStateLocked(novelID)
+		if err != nil {
+			return nil, -1, nil
+		}
+		index, _ := setupSceneIndex(setupData)
+		return cloneBytes(setupData), index, nil
+	}
+
+	if setupData, err := r.setupStateLocked(novelID); err == nil {
+		if index, ok := setupSceneIndex(setupData); ok && index == currentSceneIndex {
+			return cloneBytes(setupData), currentSceneIndex, nil
+		}
+	}
+
+	data, ok := r.earliestStateLocked(novelID, currentSceneIndex)
+	if !ok {
+		return nil, -1, nil
+	}
+	return cloneBytes(data), currentSceneIndex, nil
+}
+
+// GetNovelStateByHash возвращает состояние новеллы (stateData) по его хешу.
+// Возвращает ошибку ErrNotFound, если состояние с таким хешом не найдено.
+func (r *MemoryNovelRepository) GetNovelStateByHash(ctx context.Context, stateHash string) (stateData []byte, err error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, state := range r.states {
+		if state.stateHash == stateHash {
+			return cloneBytes(state.stateData), nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// GetNovelStateBySceneIndex возвращает самое раннее состояние новеллы для индекса сцены.
+// Возвращает ошибку ErrNotFound, если состояние с таким индексом сцены не найдено.
+func (r *MemoryNovelRepository) GetNovelStateBySceneIndex(ctx context.Context, novelID uuid.UUID, sceneIndex int) (stateData []byte, err error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	data, ok := r.earliestStateLocked(novelID, sceneIndex)
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return cloneBytes(data), nil
+}
+
+// setupStateLocked возвращает сетап новеллы. SaveNovelState хранит сетап только в поле новеллы,
+// поэтому, в отличие от PostgreSQL, искать его среди состояний не нужно.
+func (r *MemoryNovelRepository) setupStateLocked(novelID uuid.UUID) ([]byte, error) {
+	novel, ok := r.novels[novelID]
+	if !ok || novel.setupStateData == nil {
+		return nil, ErrNotFound
+	}
+	return novel.setupStateData, nil
+}
+
+// GetNovelSetupState возвращает сетап новеллы (состояние со значением current_stage="setup").
+// Возвращает ErrNotFound, если сетапа нет.
+func (r *MemoryNovelRepository) GetNovelSetupState(ctx context.Context, novelID uuid.UUID) (stateData []byte, err error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	data, err := r.setupStateLocked(novelID)
+	if err != nil {
+		return nil, err
+	}
+	return cloneBytes(data), nil
+}
+
+// SaveNovelSetupState сохраняет сетап новеллы в поле новеллы
+func (r *MemoryNovelRepository) SaveNovelSetupState(ctx context.Context, novelID uuid.UUID, setupData []byte) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.saveSetupStateLocked(novelID, setupData)
+	return nil
+}
+
+// GetUserNovelProgress возвращает индекс текущей сцены пользователя в новелле
+// или -1, если прогресс не найден.
+func (r *MemoryNovelRepository) GetUserNovelProgress(ctx context.Context, novelID uuid.UUID, userID string) (sceneIndex int, err error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	sceneIndex, ok := r.progress[memoryProgressKey{novelID, userID}]
+	if !ok {
+		return -1, nil
+	}
+	return sceneIndex, nil
+}
+
+// encodeStoryProgress сериализует прогресс для хранения, проставляя ключ и даты
+func encodeStoryProgress(novelID uuid.UUID, userID string, sceneIndex int, progress domain.UserStoryProgress, createdAt, updatedAt time.Time) (*memoryStoryProgress, error) {
+	progress.NovelID = novelID
+	progress.UserID = userID
+	progress.SceneIndex = sceneIndex
+	progress.CreatedAt = createdAt
+	progress.UpdatedAt = updatedAt
+	data, err := json.Marshal(progress)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal user story progress: %w", err)
+	}
+	return &memoryStoryProgress{
+		novelID:    novelID,
+		userID:     userID,
+		sceneIndex: sceneIndex,
+		stateHash:  progress.StateHash,
+		data:       data,
+	}, nil
+}
+
+// decode возвращает копию сохраненного прогресса
+func (p *memoryStoryProgress) decode() (*domain.UserStoryProgress, error) {
+	var progress domain.UserStoryProgress
+	if err := json.Unmarshal(p.data, &progress); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal user story progress: %w", err)
+	}
+	return &progress, nil
+}
+
+// findStoryProgressLocked возвращает прогресс пользователя для сцены
+func (r *MemoryNovelRepository) findStoryProgressLocked(novelID uuid.UUID, userID string, sceneIndex int) (int, *memoryStoryProgress) {
+	for i, p := range r.storyProgress {
+		if p.novelID == novelID && p.userID == userID && p.sceneIndex == sceneIndex {
+			return i, p
+		}
+	}
+	return -1, nil
+}
+
+// removeStoryProgressLocked удаляет прогресс, для которого match возвращает true, и сообщает число удаленных записей
+func (r *MemoryNovelRepository) removeStoryProgressLocked(match func(p *memoryStoryProgress) bool) int {
+	kept := r.storyProgress[:0]
+	removed := 0
+	for _, p := range r.storyProgress {
+		if match(p) {
+			removed++
+			continue
+		}
+		kept = append(kept, p)
+	}
+	for i := len(kept); i < len(r.storyProgress); i++ {
+		r.storyProgress[i] = nil
+	}
+	r.storyProgress = kept
+	return removed
+}
+
+// SaveUserStoryProgress сохраняет динамические элементы прогресса пользователя
+// для конкретной сцены новеллы.
+func (r *MemoryNovelRepository) SaveUserStoryProgress(ctx context.Context, novelID uuid.UUID, sceneIndex int, userID string,
+	progress *domain.UserStoryProgress) error {
+	if progress == nil {
+		return fmt.Errorf("progress is nil")
+	}
+	if progress.StateHash == "" {
+		return fmt.Errorf("state hash is empty")
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// Для сцены с индексом 0 проверяем, не сетап ли это
+	if sceneIndex == 0 {
+		for _, state := range r.states {
+			if state.stateHash == progress.StateHash {
+				if currentStage(state.stateData) == "setup" {
+					r.saveSetupStateLocked(novelID, state.stateData)
+				}
+				break
+			}
+		}
+	}
+
+	if _, ok := r.novels[novelID]; !ok {
+		return fmt.Errorf("failed to save user story progress: novel %s not found", novelID)
+	}
+
+	now := time.Now()
+	i, existing := r.findStoryProgressLocked(novelID, userID, sceneIndex)
+	createdAt := now
+	if existing != nil {
+		if current, err := existing.decode(); err == nil {
+			createdAt = current.CreatedAt
+		}
+	}
+	entry, err := encodeStoryProgress(novelID, userID, sceneIndex, *progress, createdAt, now)
+	if err != nil {
+		return err
+	}
+	if existing != nil {
+		r.storyProgress[i] = entry
+	} else {
+		r.storyProgress = append(r.storyProgress, entry)
+	}
+
+	return r.upsertProgressLocked(novelID, userID, sceneIndex, true)
+}
+
+// GetLatestUserStoryProgress возвращает прогресс пользователя для его текущей сцены.
+// Возвращает nil и -1, если прогресс не найден.
+func (r *MemoryNovelRepository) GetLatestUserStoryProgress(ctx context.Context, novelID uuid.UUID, userID string) (*domain.UserStoryProgress, int, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	currentSceneIndex, ok := r.progress[memoryProgressKey{novelID, userID}]
+	if !ok {
+		return nil, -1, nil
+	}
+	_, entry := r.findStoryProgressLocked(novelID, userID, currentSceneIndex)
+	if entry == nil {
+		return nil, currentSceneIndex, nil
+	}
+	progress, err := entry.decode()
+	if err != nil {
+		return nil, currentSceneIndex, err
+	}
+	return progress, currentSceneIndex, nil
+}
+
+// GetUserStoryProgressByHash возвращает прогресс истории по хешу состояния.
+func (r *MemoryNovelRepository) GetUserStoryProgressByHash(ctx context.Context, stateHash string) (*domain.UserStoryProgress, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, p := range r.storyProgress {
+		if p.stateHash == stateHash {
+			return p.decode()
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// GetUserStoryProgress возвращает прогресс пользователя для конкретной сцены.
+// Возвращает ErrNotFound, если пользователь эту сцену не проходил.
+func (r *MemoryNovelRepository) GetUserStoryProgress(ctx context.Context, novelID uuid.UUID, userID string, sceneIndex int) (*domain.UserStoryProgress, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	_, entry := r.findStoryProgressLocked(novelID, userID, sceneIndex)
+	if entry == nil {
+		return nil, ErrNotFound
+	}
+	return entry.decode()
+}
+
+// ListUserStoryProgress возвращает прогресс пользователя по всем пройденным сценам
+// в порядке индекса сцены.
+func (r *MemoryNovelRepository) ListUserStoryProgress(ctx context.Context, novelID uuid.UUID, userID string) ([]domain.UserStoryProgress, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	track := []domain.UserStoryProgress{}
+	for _, p := range r.storyProgress {
+		if p.novelID != novelID || p.userID != userID {
+			continue
+		}
+		progress, err := p.decode()
+		if err != nil {
+			return nil, err
+		}
+		track = append(track, *progress)
+	}
+	sort.Slice(track, func(i, j int) bool { return track[i].SceneIndex < track[j].SceneIndex })
+	return track, nil
+}
+
+// ReplaceUserStoryProgress заменяет весь прогресс пользователя в новелле на track
+// и делает sceneIndex текущей сценой.
+func (r *MemoryNovelRepository) ReplaceUserStoryProgress(ctx context.Context, novelID uuid.UUID, userID string, sceneIndex int, track []domain.UserStoryProgress) error {
+	// Сериализуем заранее, чтобы при ошибке хранилище осталось прежним
+	now := time.Now()
+	entries := make([]*memoryStoryProgress, 0, len(track))
+	seen := make(map[int]bool, len(track))
+	for _, progress := range track {
+		if seen[progress.SceneIndex] {
+			return fmt.Errorf("failed to insert user story progress: duplicate scene index %d", progress.SceneIndex)
+		}
+		seen[progress.SceneIndex] = true
+		entry, err := encodeStoryProgress(novelID, userID, progress.SceneIndex, progress, now, now)
+		if err != nil {
+			return err
+		}
+		entries = append(entries, entry)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.novels[novelID]; !ok {
+		return fmt.Errorf("failed to update user progress: novel %s not found", novelID)
+	}
+	r.removeStoryProgressLocked(func(p *memoryStoryProgress) bool { return p.novelID == novelID && p.userID == userID })
+	r.storyProgress = append(r.storyProgress, entries...)
+	return r.upsertProgressLocked(novelID, userID, sceneIndex, false)
+}
+
+// GetNovelState возвращает состояние новеллы (stateData) для сцены с указанным хешем.
+// Возвращает ErrNotFound, если такого состояния нет.
+func (r *MemoryNovelRepository) GetNovelState(ctx context.Context, novelID uuid.UUID, sceneIndex int, stateHash string) (stateData []byte, err error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, state := range r.states {
+		if state.novelID == novelID && state.sceneIndex == sceneIndex && state.stateHash == stateHash {
+			return cloneBytes(state.stateData), nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// RewindUserProgress откатывает прогресс пользователя к сцене sceneIndex:
+// удаляет прогресс всех последующих сцен и делает sceneIndex текущей сценой.
+func (r *MemoryNovelRepository) RewindUserProgress(ctx context.Context, novelID uuid.UUID, userID string, sceneIndex int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.novels[novelID]; !ok {
+		return fmt.Errorf("failed to update user progress: novel %s not found", novelID)
+	}
+	r.removeStoryProgressLocked(func(p *memoryStoryProgress) bool {
+		return p.novelID == novelID && p.userID == userID && p.sceneIndex > sceneIndex
+	})
+	return r.upsertProgressLocked(novelID, userID, sceneIndex, false)
+}
+
+// DeleteUserProgress удаляет текущую сцену и прогресс всех сцен пользователя в новелле.
+func (r *MemoryNovelRepository) DeleteUserProgress(ctx context.Context, novelID uuid.UUID, userID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	removed := r.removeStoryProgressLocked(func(p *memoryStoryProgress) bool { return p.novelID == novelID && p.userID == userID })
+	key := memoryProgressKey{novelID, userID}
+	if _, ok := r.progress[key]; ok {
+		delete(r.progress, key)
+		removed++
+	}
+	if removed == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// ListNovelStateRefs возвращает все сохраненные состояния новеллы (индекс сцены и хеш)
+// в порядке индекса сцены.
+func (r *MemoryNovelRepository) ListNovelStateRefs(ctx context.Context, novelID uuid.UUID) ([]domain.StoryStateRef, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	refs := []domain.StoryStateRef{}
+	for _, state := range r.states {
+		if state.novelID == novelID {
+			refs = append(refs, domain.StoryStateRef{SceneIndex: state.sceneIndex, StateHash: state.stateHash})
+		}
+	}
+	sort.Slice(refs, func(i, j int) bool {
+		if refs[i].SceneIndex != refs[j].SceneIndex {
+			return refs[i].SceneIndex < refs[j].SceneIndex
+		}
+		return refs[i].StateHash < refs[j].StateHash
+	})
+	return refs, nil
+}
+
+// ListStoryPathSteps возвращает пути всех игроков новеллы, упорядоченные по пользователю и индексу сцены.
+func (r *MemoryNovelRepository) ListStoryPathSteps(ctx context.Context, novelID uuid.UUID) ([]domain.StoryPathStep, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	steps := []domain.StoryPathStep{}
+	for _, p := range r.storyProgress {
+		if p.novelID != novelID {
+			continue
+		}
+		progress, err := p.decode()
+		if err != nil {
+			return nil, err
+		}
+		steps = append(steps, domain.StoryPathStep{
+			UserID:          progress.UserID,
+			SceneIndex:      progress.SceneIndex,
+			StateHash:       progress.StateHash,
+			PreviousChoices: progress.PreviousChoices,
+		})
+	}
+	sort.Slice(steps, func(i, j int) bool {
+		if steps[i].UserID != steps[j].UserID {
+			return steps[i].UserID < steps[j].UserID
+		}
+		return steps[i].SceneIndex < steps[j].SceneIndex
+	})
+	return steps, nil
+}
+
+var _ NovelRepository = (*MemoryNovelRepository)(nil)
@@ -0,0 +1,20 @@
+package repository_test
+
+import (
+	"novel-server/internal/domain"
+	"novel-server/internal/repository"
+	"novel-server/internal/repository/repotest"
+	"testing"
+)
+
+func TestMemoryNovelRepository(t *testing.T) {
+	repotest.RunNovelRepositorySuite(t, func(t *testing.T) repository.NovelRepository {
+		return repository.NewMemoryNovelRepository()
+	})
+}
+
+func TestMemoryNovelDraftRepository(t *testing.T) {
+	repotest.RunNovelDraftRepositorySuite(t, func(t *testing.T) domain.NovelDraftRepository {
+		return repository.NewMemoryNovelDraftRepository()
+	})
+}
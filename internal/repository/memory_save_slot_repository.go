@@ -0,0 +1,125 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"novel-server/internal/domain"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// MemorySaveSlotRepository реализует SaveSlotRepository в памяти процесса
+type MemorySaveSlotRepository struct {
+	mu    sync.RWMutex
+	slots map[uuid.UUID]*memorySaveSlot
+}
+
+// memorySaveSlot - строка таблицы save_slots. Прогресс хранится сериализованным,
+// чтобы вызывающий код не мог изменить его после сохранения.
+type memorySaveSlot struct {
+	slot     domain.SaveSlot
+	progress []byte
+}
+
+// NewMemorySaveSlotRepository создает пустое хранилище сохранений в памяти.
+func NewMemorySaveSlotRepository() *MemorySaveSlotRepository {
+	return &MemorySaveSlotRepository{slots: make(map[uuid.UUID]*memorySaveSlot)}
+}
+
+// UpsertSaveSlot сохраняет слот, перезаписывая слот с тем же именем
+func (r *MemorySaveSlotRepository) UpsertSaveSlot(ctx context.Context, slot *domain.SaveSlot) (*domain.SaveSlot, error) {
+	progressJSON, err := json.Marshal(slot.Progress)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal save slot progress: %w", err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	var stored *memorySaveSlot
+	for _, existing := range r.slots {
+		if existing.slot.NovelID == slot.NovelID && existing.slot.UserID == slot.UserID && existing.slot.Name == slot.Name {
+			stored = existing
+			break
+		}
+	}
+	// Перезаписанный слот сохраняет свой ID и дату создания
+	if stored == nil {
+		stored = &memorySaveSlot{slot: domain.SaveSlot{
+			SlotID:    uuid.New(),
+			NovelID:   slot.NovelID,
+			UserID:    slot.UserID,
+			Name:      slot.Name,
+			CreatedAt: now,
+		}}
+		r.slots[stored.slot.SlotID] = stored
+	}
+	stored.slot.SceneIndex = slot.SceneIndex
+	stored.slot.UpdatedAt = now
+	stored.progress = progressJSON
+
+	saved := stored.slot
+	saved.Progress = slot.Progress
+	return &saved, nil
+}
+
+// ListSaveSlots возвращает сохранения пользователя в новелле, новые первыми
+func (r *MemorySaveSlotRepository) ListSaveSlots(ctx context.Context, novelID uuid.UUID, userID string) ([]domain.SaveSlot, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	slots := []domain.SaveSlot{}
+	for _, stored := range r.slots {
+		if stored.slot.NovelID == novelID && stored.slot.UserID == userID {
+			slots = append(slots, stored.slot)
+		}
+	}
+	sort.Slice(slots, func(i, j int) bool {
+		return slots[i].UpdatedAt.After(slots[j].UpdatedAt)
+	})
+	return slots, nil
+}
+
+// userSlotLocked возвращает сохранение пользователя в новелле или nil, если его нет
+func (r *MemorySaveSlotRepository) userSlotLocked(novelID uuid.UUID, userID string, slotID uuid.UUID) *memorySaveSlot {
+	stored, ok := r.slots[slotID]
+	if !ok || stored.slot.NovelID != novelID || stored.slot.UserID != userID {
+		return nil
+	}
+	return stored
+}
+
+// GetSaveSlot возвращает сохранение вместе с прогрессом
+func (r *MemorySaveSlotRepository) GetSaveSlot(ctx context.Context, novelID uuid.UUID, userID string, slotID uuid.UUID) (*domain.SaveSlot, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	stored := r.userSlotLocked(novelID, userID, slotID)
+	if stored == nil {
+		return nil, ErrNotFound
+	}
+	slot := stored.slot
+	if err := json.Unmarshal(stored.progress, &slot.Progress); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal save slot progress: %w", err)
+	}
+	return &slot, nil
+}
+
+// DeleteSaveSlot удаляет сохранение
+func (r *MemorySaveSlotRepository) DeleteSaveSlot(ctx context.Context, novelID uuid.UUID, userID string, slotID uuid.UUID) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.userSlotLocked(novelID, userID, slotID) == nil {
+		return ErrNotFound
+	}
+	delete(r.slots, slotID)
+	return nil
+}
+
+var _ SaveSlotRepository = (*MemorySaveSlotRepository)(nil)
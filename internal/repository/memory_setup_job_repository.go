@@ -0,0 +1,239 @@
+package repository
+
+import (
+	"context"
+	"novel-server/internal/domain"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// MemorySetupJobRepository реализует SetupJobRepository в памяти процесса.
+// Задачи забираются под блокировкой хранилища, поэтому одна задача не достается двоим воркерам.
+type MemorySetupJobRepository struct {
+	mu   sync.Mutex
+	jobs map[uuid.UUID]*domain.SetupJob // по ID новеллы
+	// novels - хранилище новелл для названий в ListFailedSetupJobs. Задачи удаленных новелл
+	// удаляются вместе с ними, как ON DELETE CASCADE в SQL-реализациях.
+	novels *MemoryNovelRepository
+}
+
+// NewMemorySetupJobRepository создает пустую очередь задач сетапа в памяти
+// для новелл из хранилища novels.
+func NewMemorySetupJobRepository(novels *MemoryNovelRepository) *MemorySetupJobRepository {
+	return &MemorySetupJobRepository{
+		jobs:   make(map[uuid.UUID]*domain.SetupJob),
+		novels: novels,
+	}
+}
+
+// copySetupJob возвращает копию задачи, чтобы вызывающий код не менял хранилище
+func copySetupJob(job *domain.SetupJob) *domain.SetupJob {
+	copied := *job
+	if job.LockedAt != nil {
+		lockedAt := *job.LockedAt
+		copied.LockedAt = &lockedAt
+	}
+	return &copied
+}
+
+// pruneLocked удаляет задачи новелл, которых больше нет
+func (r *MemorySetupJobRepository) pruneLocked() {
+	for novelID := range r.jobs {
+		if _, ok := r.novels.novelTitle(novelID); !ok {
+			delete(r.jobs, novelID)
+		}
+	}
+}
+
+// jobByIDLocked возвращает задачу по ее ID или nil, если ее нет
+func (r *MemorySetupJobRepository) jobByIDLocked(jobID uuid.UUID) *domain.SetupJob {
+	for _, job := range r.jobs {
+		if job.JobID == jobID {
+			return job
+		}
+	}
+	return nil
+}
+
+// EnqueueSetupJob ставит сетап новеллы в очередь. Если задача уже есть, возвращает ее.
+func (r *MemorySetupJobRepository) EnqueueSetupJob(ctx context.Context, novelID uuid.UUID, userID string, maxAttempts int) (*domain.SetupJob, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	job, ok := r.jobs[novelID]
+	if !ok {
+		now := time.Now()
+		job = &domain.SetupJob{
+			JobID:       uuid.New(),
+			NovelID:     novelID,
+			UserID:      userID,
+			Status:      domain.SetupJobQueued,
+			MaxAttempts: maxAttempts,
+			RunAfter:    now,
+			CreatedAt:   now,
+			UpdatedAt:   now,
+		}
+		r.jobs[novelID] = job
+	}
+	return copySetupJob(job), nil
+}
+
+// ClaimNextSetupJob забирает следующую задачу
+func (r *MemorySetupJobRepository) ClaimNextSetupJob(ctx context.Context) (*domain.SetupJob, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.pruneLocked()
+
+	now := time.Now()
+	var next *domain.SetupJob
+	for _, job := range r.jobs {
+		if job.Status != domain.SetupJobQueued || job.RunAfter.After(now) {
+			continue
+		}
+		if next == nil || job.RunAfter.Before(next.RunAfter) {
+			next = job
+		}
+	}
+	if next == nil {
+		return nil, nil
+	}
+
+	next.Status = domain.SetupJobRunning
+	next.Attempts++
+	next.LockedAt = &now
+	next.UpdatedAt = now
+	return copySetupJob(next), nil
+}
+
+// CompleteSetupJob помечает задачу выполненной
+func (r *MemorySetupJobRepository) CompleteSetupJob(ctx context.Context, jobID uuid.UUID) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if job := r.jobByIDLocked(jobID); job != nil {
+		job.Status = domain.SetupJobDone
+		job.LastError = ""
+		job.LockedAt = nil
+		job.UpdatedAt = time.Now()
+	}
+	return nil
+}
+
+// FailSetupJob записывает ошибку попытки и либо планирует повтор, либо помечает задачу упавшей
+func (r *MemorySetupJobRepository) FailSetupJob(ctx context.Context, jobID uuid.UUID, lastError string, retryAt *time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	job := r.jobByIDLocked(jobID)
+	if job == nil {
+		return nil
+	}
+	job.LastError = lastError
+	job.LockedAt = nil
+	job.UpdatedAt = time.Now()
+	if retryAt != nil {
+		job.Status = domain.SetupJobQueued
+		job.RunAfter = *retryAt
+	} else {
+		job.Status = domain.SetupJobFailed
+	}
+	return nil
+}
+
+// GetSetupJobByNovelID возвращает задачу новеллы
+func (r *MemorySetupJobRepository) GetSetupJobByNovelID(ctx context.Context, novelID uuid.UUID) (*domain.SetupJob, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.pruneLocked()
+
+	job, ok := r.jobs[novelID]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return copySetupJob(job), nil
+}
+
+// ListUnfinishedSetupJobs возвращает незавершенные задачи пользователя, новые первыми
+func (r *MemorySetupJobRepository) ListUnfinishedSetupJobs(ctx context.Context, userID string) ([]domain.SetupJob, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.pruneLocked()
+
+	jobs := []domain.SetupJob{}
+	for _, job := range r.jobs {
+		if job.UserID == userID && job.Status != domain.SetupJobDone {
+			jobs = append(jobs, *copySetupJob(job))
+		}
+	}
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].CreatedAt.After(jobs[j].CreatedAt)
+	})
+	return jobs, nil
+}
+
+// ListFailedSetupJobs возвращает упавшие задачи всех пользователей вместе с названием новеллы
+func (r *MemorySetupJobRepository) ListFailedSetupJobs(ctx context.Context, limit int) ([]domain.FailedSetupJob, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.pruneLocked()
+
+	jobs := []domain.FailedSetupJob{}
+	for _, job := range r.jobs {
+		if job.Status != domain.SetupJobFailed {
+			continue
+		}
+		title, _ := r.novels.novelTitle(job.NovelID)
+		jobs = append(jobs, domain.FailedSetupJob{SetupJob: *copySetupJob(job), UserID: job.UserID, NovelTitle: title})
+	}
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].UpdatedAt.After(jobs[j].UpdatedAt)
+	})
+	return paginate(jobs, limit, 0), nil
+}
+
+// RetrySetupJob возвращает упавшую задачу в очередь
+func (r *MemorySetupJobRepository) RetrySetupJob(ctx context.Context, novelID uuid.UUID) (*domain.SetupJob, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.pruneLocked()
+
+	job, ok := r.jobs[novelID]
+	if !ok || job.Status != domain.SetupJobFailed {
+		return nil, ErrNotFound
+	}
+	now := time.Now()
+	job.Status = domain.SetupJobQueued
+	job.Attempts = 0
+	job.RunAfter = now
+	job.LockedAt = nil
+	job.UpdatedAt = now
+	return copySetupJob(job), nil
+}
+
+// RequeueStaleSetupJobs возвращает в очередь зависшие задачи
+func (r *MemorySetupJobRepository) RequeueStaleSetupJobs(ctx context.Context, staleAfter time.Duration) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	requeued := 0
+	for _, job := range r.jobs {
+		if job.Status != domain.SetupJobRunning || job.LockedAt == nil || !job.LockedAt.Before(now.Add(-staleAfter)) {
+			continue
+		}
+		job.Status = domain.SetupJobQueued
+		job.RunAfter = now
+		job.LockedAt = nil
+		job.UpdatedAt = now
+		if job.LastError == "" {
+			job.LastError = "worker stopped before finishing the job"
+		}
+		requeued++
+	}
+	return requeued, nil
+}
+
+var _ SetupJobRepository = (*MemorySetupJobRepository)(nil)
@@ -0,0 +1,120 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"novel-server/internal/domain"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// MemoryUsageRepository реализует UsageRepository в памяти процесса
+type MemoryUsageRepository struct {
+	mu      sync.RWMutex
+	records []domain.LLMUsage
+}
+
+// NewMemoryUsageRepository создает пустое хранилище учета использования модели в памяти.
+func NewMemoryUsageRepository() *MemoryUsageRepository {
+	return &MemoryUsageRepository{}
+}
+
+// memoryUsageGroupKeys - ключи группировки для SummarizeLLMUsage
+var memoryUsageGroupKeys = map[string]func(usage *domain.LLMUsage) string{
+	domain.LLMUsageByUser: func(usage *domain.LLMUsage) string { return usage.UserID },
+	domain.LLMUsageByNovel: func(usage *domain.LLMUsage) string {
+		if usage.NovelID == nil {
+			return ""
+		}
+		return usage.NovelID.String()
+	},
+	domain.LLMUsageByDay: func(usage *domain.LLMUsage) string { return usage.CreatedAt.UTC().Format(time.DateOnly) },
+}
+
+// RecordLLMUsage сохраняет запись об одном вызове модели
+func (r *MemoryUsageRepository) RecordLLMUsage(ctx context.Context, usage *domain.LLMUsage) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	usage.UsageID = uuid.New()
+	usage.CreatedAt = time.Now()
+	stored := *usage
+	if usage.NovelID != nil {
+		novelID := *usage.NovelID
+		stored.NovelID = &novelID
+	}
+	r.records = append(r.records, stored)
+	return nil
+}
+
+// SummarizeLLMUsage возвращает агрегаты использования модели за период
+func (r *MemoryUsageRepository) SummarizeLLMUsage(ctx context.Context, groupBy string, filter domain.LLMUsageFilter) ([]domain.LLMUsageSummary, error) {
+	keyOf, ok := memoryUsageGroupKeys[groupBy]
+	if !ok {
+		return nil, fmt.Errorf("unknown usage grouping %q", groupBy)
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	groups := make(map[string]*domain.LLMUsageSummary)
+	latency := make(map[string]int64)
+	for i := range r.records {
+		usage := &r.records[i]
+		if usage.CreatedAt.Before(filter.From) || !usage.CreatedAt.Before(filter.To) {
+			continue
+		}
+		if filter.UserID != "" && usage.UserID != filter.UserID {
+			continue
+		}
+		if filter.NovelID != nil && (usage.NovelID == nil || *usage.NovelID != *filter.NovelID) {
+			continue
+		}
+
+		key := keyOf(usage)
+		summary, ok := groups[key]
+		if !ok {
+			summary = &domain.LLMUsageSummary{Key: key}
+			groups[key] = summary
+		}
+		summary.Calls++
+		summary.PromptTokens += int64(usage.PromptTokens)
+		summary.CompletionTokens += int64(usage.CompletionTokens)
+		summary.TotalTokens += int64(usage.TotalTokens)
+		summary.Cost += usage.Cost
+		latency[key] += usage.LatencyMs
+	}
+
+	summaries := make([]domain.LLMUsageSummary, 0, len(groups))
+	for key, summary := range groups {
+		summary.AvgLatencyMs = latency[key] / summary.Calls
+		summaries = append(summaries, *summary)
+	}
+	// Как в SQL-реализациях: дни по дате, остальное по убыванию расхода токенов
+	sort.Slice(summaries, func(i, j int) bool {
+		if groupBy != domain.LLMUsageByDay && summaries[i].TotalTokens != summaries[j].TotalTokens {
+			return summaries[i].TotalTokens > summaries[j].TotalTokens
+		}
+		return summaries[i].Key < summaries[j].Key
+	})
+	return paginate(summaries, filter.Limit, 0), nil
+}
+
+// CountUserTokens возвращает число токенов, израсходованных пользователем начиная с from
+func (r *MemoryUsageRepository) CountUserTokens(ctx context.Context, userID string, from time.Time) (int64, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var total int64
+	for i := range r.records {
+		if r.records[i].UserID == userID && !r.records[i].CreatedAt.Before(from) {
+			total += int64(r.records[i].TotalTokens)
+		}
+	}
+	return total, nil
+}
+
+var _ UsageRepository = (*MemoryUsageRepository)(nil)
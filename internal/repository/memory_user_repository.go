@@ -0,0 +1,224 @@
+package repository
+
+import (
+	"context"
+	"novel-server/internal/domain"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// MemoryUserRepository реализует UserRepository в памяти процесса
+// с той же семантикой, что и PostgresUserRepository.
+type MemoryUserRepository struct {
+	mu     sync.RWMutex
+	users  map[uuid.UUID]*domain.User
+	tokens map[string]*domain.RefreshToken // по хешу токена
+}
+
+// NewMemoryUserRepository создает пустое хранилище учетных записей в памяти.
+func NewMemoryUserRepository() *MemoryUserRepository {
+	return &MemoryUserRepository{
+		users:  make(map[uuid.UUID]*domain.User),
+		tokens: make(map[string]*domain.RefreshToken),
+	}
+}
+
+// copyUser возвращает копию учетной записи, чтобы вызывающий код не менял хранилище
+func copyUser(user *domain.User) *domain.User {
+	copied := *user
+	if user.DisabledAt != nil {
+		disabledAt := *user.DisabledAt
+		copied.DisabledAt = &disabledAt
+	}
+	return &copied
+}
+
+// CreateUser создает учетную запись
+func (r *MemoryUserRepository) CreateUser(ctx context.Context, user *domain.User) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, existing := range r.users {
+		if strings.EqualFold(existing.Username, user.Username) {
+			return ErrAlreadyExists
+		}
+	}
+
+	now := time.Now()
+	user.UserID = uuid.New()
+	user.CreatedAt = now
+	user.UpdatedAt = now
+	stored := copyUser(user)
+	stored.DisabledAt = nil
+	r.users[user.UserID] = stored
+	return nil
+}
+
+// GetUserByUsername ищет учетную запись по логину без учета регистра
+func (r *MemoryUserRepository) GetUserByUsername(ctx context.Context, username string) (*domain.User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, user := range r.users {
+		if strings.EqualFold(user.Username, username) {
+			return copyUser(user), nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// GetUserByID возвращает учетную запись по ID
+func (r *MemoryUserRepository) GetUserByID(ctx context.Context, userID uuid.UUID) (*domain.User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	user, ok := r.users[userID]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return copyUser(user), nil
+}
+
+// ListUsers возвращает учетные записи, новые первыми
+func (r *MemoryUserRepository) ListUsers(ctx context.Context, limit, offset int) ([]domain.User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	users := make([]domain.User, 0, len(r.users))
+	for _, user := range r.users {
+		users = append(users, *copyUser(user))
+	}
+	sort.Slice(users, func(i, j int) bool {
+		if !users[i].CreatedAt.Equal(users[j].CreatedAt) {
+			return users[i].CreatedAt.After(users[j].CreatedAt)
+		}
+		return users[i].UserID.String() < users[j].UserID.String()
+	})
+	return paginate(users, limit, offset), nil
+}
+
+// SetUserRole меняет роль учетной записи
+func (r *MemoryUserRepository) SetUserRole(ctx context.Context, userID uuid.UUID, role string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	user, ok := r.users[userID]
+	if !ok {
+		return ErrNotFound
+	}
+	user.Role = role
+	user.UpdatedAt = time.Now()
+	return nil
+}
+
+// SetUserDisabled блокирует или разблокирует учетную запись.
+// При блокировке отзываются все refresh-токены пользователя.
+func (r *MemoryUserRepository) SetUserDisabled(ctx context.Context, userID uuid.UUID, disabled bool) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	user, ok := r.users[userID]
+	if !ok {
+		return ErrNotFound
+	}
+	now := time.Now()
+	user.UpdatedAt = now
+	if !disabled {
+		user.DisabledAt = nil
+		return nil
+	}
+
+	// Повторная блокировка не сдвигает время первой
+	if user.DisabledAt == nil {
+		user.DisabledAt = &now
+	}
+	for _, token := range r.tokens {
+		if token.UserID == userID && token.RevokedAt == nil {
+			token.RevokedAt = &now
+		}
+	}
+	return nil
+}
+
+// insertTokenLocked сохраняет refresh-токен и заполняет его ID и время создания
+func (r *MemoryUserRepository) insertTokenLocked(token *domain.RefreshToken, tokenHash string) {
+	token.TokenID = uuid.New()
+	token.CreatedAt = time.Now()
+	stored := *token
+	stored.RevokedAt = nil
+	r.tokens[tokenHash] = &stored
+}
+
+// CreateRefreshToken сохраняет хеш нового refresh-токена.
+// Заодно удаляет истекшие токены пользователя, чтобы хранилище не росло.
+func (r *MemoryUserRepository) CreateRefreshToken(ctx context.Context, token *domain.RefreshToken, tokenHash string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	for hash, existing := range r.tokens {
+		if existing.UserID == token.UserID && existing.ExpiresAt.Before(now) {
+			delete(r.tokens, hash)
+		}
+	}
+	r.insertTokenLocked(token, tokenHash)
+	return nil
+}
+
+// GetRefreshToken возвращает refresh-токен по хешу
+func (r *MemoryUserRepository) GetRefreshToken(ctx context.Context, tokenHash string) (*domain.RefreshToken, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	token, ok := r.tokens[tokenHash]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	copied := *token
+	if token.RevokedAt != nil {
+		revokedAt := *token.RevokedAt
+		copied.RevokedAt = &revokedAt
+	}
+	return &copied, nil
+}
+
+// RotateRefreshToken отзывает старый токен и сохраняет новый под одной блокировкой
+func (r *MemoryUserRepository) RotateRefreshToken(ctx context.Context, oldTokenID uuid.UUID, next *domain.RefreshToken, nextHash string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var old *domain.RefreshToken
+	for _, token := range r.tokens {
+		if token.TokenID == oldTokenID && token.RevokedAt == nil {
+			old = token
+			break
+		}
+	}
+	if old == nil {
+		return ErrNotFound
+	}
+	now := time.Now()
+	old.RevokedAt = &now
+	r.insertTokenLocked(next, nextHash)
+	return nil
+}
+
+// RevokeRefreshTokenFamily отзывает все действующие токены семейства
+func (r *MemoryUserRepository) RevokeRefreshTokenFamily(ctx context.Context, familyID uuid.UUID) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	for _, token := range r.tokens {
+		if token.FamilyID == familyID && token.RevokedAt == nil {
+			token.RevokedAt = &now
+		}
+	}
+	return nil
+}
+
+var _ UserRepository = (*MemoryUserRepository)(nil)
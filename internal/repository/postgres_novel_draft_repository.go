@@ -2,11 +2,14 @@ package repository
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"log"
+	"novel-server/internal/domain"
 
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
@@ -22,21 +25,38 @@ func NewPostgresNovelDraftRepository(pool *pgxpool.Pool) *PostgresNovelDraftRepo
 	}
 }
 
-// SaveDraft сохраняет новый черновик в базу данных
-func (r *PostgresNovelDraftRepository) SaveDraft(ctx context.Context, userID string, draftID uuid.UUID, configJSON []byte) error {
+// SaveDraft сохраняет новый черновик в базу данных вместе с его первой ревизией
+func (r *PostgresNovelDraftRepository) SaveDraft(ctx context.Context, userID string, draftID uuid.UUID, configJSON []byte, prompt string) error {
 	log.Printf("[PostgresNovelDraftRepository] SaveDraft - Saving draft with ID: %s for UserID: %s", draftID, userID)
 
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
 	query := `
-		INSERT INTO novel_drafts (draft_id, user_id, config_json)
-		VALUES ($1, $2, $3)
+		INSERT INTO novel_drafts (draft_id, user_id, config_json, revision)
+		VALUES ($1, $2, $3, 1)
 	`
-
-	_, err := r.pool.Exec(ctx, query, draftID, userID, configJSON)
-	if err != nil {
+	if _, err := tx.Exec(ctx, query, draftID, userID, configJSON); err != nil {
 		log.Printf("[PostgresNovelDraftRepository] SaveDraft - Error saving draft: %v", err)
 		return fmt.Errorf("failed to save draft: %w", err)
 	}
 
+	revisionQuery := `
+		INSERT INTO novel_draft_revisions (draft_id, revision, source, prompt, config_json)
+		VALUES ($1, 1, $2, $3, $4)
+	`
+	if _, err := tx.Exec(ctx, revisionQuery, draftID, domain.DraftRevisionCreate, prompt, configJSON); err != nil {
+		log.Printf("[PostgresNovelDraftRepository] SaveDraft - Error saving revision: %v", err)
+		return fmt.Errorf("failed to save draft revision: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
 	log.Printf("[PostgresNovelDraftRepository] SaveDraft - Successfully saved draft with ID: %s", draftID)
 	return nil
 }
@@ -61,28 +81,54 @@ func (r *PostgresNovelDraftRepository) GetDraftConfigJSON(ctx context.Context, u
 	return configJSON, nil
 }
 
-// UpdateDraftConfigJSON обновляет сериализованный конфиг существующего черновика
-func (r *PostgresNovelDraftRepository) UpdateDraftConfigJSON(ctx context.Context, userID string, draftID uuid.UUID, configJSON []byte) error {
-	log.Printf("[PostgresNovelDraftRepository] UpdateDraftConfigJSON - Updating draft with ID: %s for UserID: %s", draftID, userID)
+// AppendDraftRevision заменяет конфиг черновика и добавляет ревизию в одной транзакции.
+// UPDATE блокирует строку черновика, поэтому параллельные уточнения получают разные номера ревизий.
+func (r *PostgresNovelDraftRepository) AppendDraftRevision(ctx context.Context, userID string, draftID uuid.UUID, configJSON []byte, revision *domain.DraftRevision) error {
+	log.Printf("[PostgresNovelDraftRepository] AppendDraftRevision - Updating draft with ID: %s for UserID: %s", draftID, userID)
+
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
 
 	query := `
 		UPDATE novel_drafts
-		SET config_json = $3
+		SET config_json = $3, revision = revision + 1
 		WHERE draft_id = $1 AND user_id = $2
+		RETURNING revision
 	`
+	if err := tx.QueryRow(ctx, query, draftID, userID, configJSON).Scan(&revision.Revision); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			log.Printf("[PostgresNovelDraftRepository] AppendDraftRevision - Draft not found: %s", draftID)
+			return ErrNotFound
+		}
+		log.Printf("[PostgresNovelDraftRepository] AppendDraftRevision - Error updating draft: %v", err)
+		return fmt.Errorf("failed to update draft: %w", err)
+	}
 
-	result, err := r.pool.Exec(ctx, query, draftID, userID, configJSON)
+	revisionQuery := `
+		INSERT INTO novel_draft_revisions (draft_id, revision, source, prompt, restored_from, patch, config_json)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING created_at
+	`
+	var patch []byte
+	if len(revision.Patch) > 0 {
+		patch = revision.Patch
+	}
+	err = tx.QueryRow(ctx, revisionQuery, draftID, revision.Revision, revision.Source, revision.Prompt, revision.RestoredFrom, patch, configJSON).
+		Scan(&revision.CreatedAt)
 	if err != nil {
-		log.Printf("[PostgresNovelDraftRepository] UpdateDraftConfigJSON - Error updating draft: %v", err)
-		return fmt.Errorf("failed to update draft: %w", err)
+		log.Printf("[PostgresNovelDraftRepository] AppendDraftRevision - Error saving revision: %v", err)
+		return fmt.Errorf("failed to save draft revision: %w", err)
 	}
 
-	if result.RowsAffected() == 0 {
-		log.Printf("[PostgresNovelDraftRepository] UpdateDraftConfigJSON - Draft not found: %s", draftID)
-		return errors.New("draft not found")
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
 	}
+	revision.DraftID = draftID
 
-	log.Printf("[PostgresNovelDraftRepository] UpdateDraftConfigJSON - Successfully updated draft with ID: %s", draftID)
+	log.Printf("[PostgresNovelDraftRepository] AppendDraftRevision - Draft %s is now at revision %d", draftID, revision.Revision)
 	return nil
 }
 
@@ -103,9 +149,125 @@ func (r *PostgresNovelDraftRepository) DeleteDraft(ctx context.Context, userID s
 
 	if result.RowsAffected() == 0 {
 		log.Printf("[PostgresNovelDraftRepository] DeleteDraft - Draft not found: %s", draftID)
-		return errors.New("draft not found")
+		return ErrNotFound
 	}
 
 	log.Printf("[PostgresNovelDraftRepository] DeleteDraft - Successfully deleted draft with ID: %s", draftID)
 	return nil
 }
+
+// ListDrafts возвращает черновики пользователя без полного конфига, последние измененные первыми
+func (r *PostgresNovelDraftRepository) ListDrafts(ctx context.Context, userID string, limit, offset int) ([]domain.NovelDraftSummary, error) {
+	query := `
+		SELECT draft_id, COALESCE(config_json->>'title', ''), COALESCE(config_json->>'short_description', ''),
+			COALESCE(config_json->>'genre', ''), revision, created_at, updated_at
+		FROM novel_drafts
+		WHERE user_id = $1
+		ORDER BY updated_at DESC, draft_id
+		LIMIT $2 OFFSET $3
+	`
+
+	rows, err := r.pool.Query(ctx, query, userID, limit, offset)
+	if err != nil {
+		log.Printf("[PostgresNovelDraftRepository] ListDrafts - Error listing drafts: %v", err)
+		return nil, fmt.Errorf("failed to list drafts: %w", err)
+	}
+	defer rows.Close()
+
+	drafts := []domain.NovelDraftSummary{}
+	for rows.Next() {
+		var d domain.NovelDraftSummary
+		if err := rows.Scan(&d.DraftID, &d.Title, &d.ShortDescription, &d.Genre, &d.Revision, &d.CreatedAt, &d.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan draft: %w", err)
+		}
+		drafts = append(drafts, d)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read drafts: %w", err)
+	}
+	return drafts, nil
+}
+
+// GetDraft возвращает черновик пользователя вместе с конфигом. Возвращает ErrNotFound, если его нет.
+func (r *PostgresNovelDraftRepository) GetDraft(ctx context.Context, userID string, draftID uuid.UUID) (*domain.NovelDraft, error) {
+	query := `
+		SELECT draft_id, user_id, revision, config_json, created_at, updated_at
+		FROM novel_drafts
+		WHERE draft_id = $1 AND user_id = $2
+	`
+
+	var draft domain.NovelDraft
+	var configJSON []byte
+	err := r.pool.QueryRow(ctx, query, draftID, userID).Scan(&draft.DraftID, &draft.UserID, &draft.Revision, &configJSON, &draft.CreatedAt, &draft.UpdatedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		log.Printf("[PostgresNovelDraftRepository] GetDraft - Error getting draft: %v", err)
+		return nil, fmt.Errorf("failed to get draft: %w", err)
+	}
+	if err := json.Unmarshal(configJSON, &draft.Config); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal draft config: %w", err)
+	}
+	return &draft, nil
+}
+
+// ListDraftRevisions возвращает ревизии черновика пользователя без конфигов (но с патчами), по возрастанию номера
+func (r *PostgresNovelDraftRepository) ListDraftRevisions(ctx context.Context, userID string, draftID uuid.UUID) ([]domain.DraftRevision, error) {
+	query := `
+		SELECT v.draft_id, v.revision, v.source, v.prompt, v.restored_from, v.patch, v.created_at
+		FROM novel_draft_revisions v
+		JOIN novel_drafts d ON d.draft_id = v.draft_id
+		WHERE v.draft_id = $1 AND d.user_id = $2
+		ORDER BY v.revision
+	`
+
+	rows, err := r.pool.Query(ctx, query, draftID, userID)
+	if err != nil {
+		log.Printf("[PostgresNovelDraftRepository] ListDraftRevisions - Error listing revisions: %v", err)
+		return nil, fmt.Errorf("failed to list draft revisions: %w", err)
+	}
+	defer rows.Close()
+
+	revisions := []domain.DraftRevision{}
+	for rows.Next() {
+		var v domain.DraftRevision
+		if err := rows.Scan(&v.DraftID, &v.Revision, &v.Source, &v.Prompt, &v.RestoredFrom, &v.Patch, &v.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan draft revision: %w", err)
+		}
+		revisions = append(revisions, v)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read draft revisions: %w", err)
+	}
+	return revisions, nil
+}
+
+// GetDraftRevision возвращает ревизию черновика пользователя вместе с конфигом.
+// Возвращает ErrNotFound, если черновика или ревизии нет.
+func (r *PostgresNovelDraftRepository) GetDraftRevision(ctx context.Context, userID string, draftID uuid.UUID, revision int) (*domain.DraftRevision, error) {
+	query := `
+		SELECT v.draft_id, v.revision, v.source, v.prompt, v.restored_from, v.patch, v.config_json, v.created_at
+		FROM novel_draft_revisions v
+		JOIN novel_drafts d ON d.draft_id = v.draft_id
+		WHERE v.draft_id = $1 AND d.user_id = $2 AND v.revision = $3
+	`
+
+	var v domain.DraftRevision
+	var configJSON []byte
+	err := r.pool.QueryRow(ctx, query, draftID, userID, revision).
+		Scan(&v.DraftID, &v.Revision, &v.Source, &v.Prompt, &v.RestoredFrom, &v.Patch, &configJSON, &v.CreatedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		log.Printf("[PostgresNovelDraftRepository] GetDraftRevision - Error getting revision: %v", err)
+		return nil, fmt.Errorf("failed to get draft revision: %w", err)
+	}
+
+	v.Config = &domain.NovelConfig{}
+	if err := json.Unmarshal(configJSON, v.Config); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal draft revision config: %w", err)
+	}
+	return &v, nil
+}
@@ -0,0 +1,64 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// PostgresQuotaRepository реализация QuotaRepository для PostgreSQL
+type PostgresQuotaRepository struct {
+	pool *pgxpool.Pool
+}
+
+// NewPostgresQuotaRepository создает новый экземпляр PostgresQuotaRepository
+func NewPostgresQuotaRepository(pool *pgxpool.Pool) *PostgresQuotaRepository {
+	return &PostgresQuotaRepository{
+		pool: pool,
+	}
+}
+
+// ConsumeQuota атомарно увеличивает счетчик, если лимит еще не исчерпан
+func (r *PostgresQuotaRepository) ConsumeQuota(ctx context.Context, userID, kind string, windowStart time.Time, limit int) (int, bool, error) {
+	// Условие в DO UPDATE не дает двум параллельным запросам превысить лимит:
+	// если счетчик уже на лимите, строка не обновляется и RETURNING ничего не возвращает
+	query := `
+		INSERT INTO user_quota_counters (user_id, kind, window_start, used)
+		VALUES ($1, $2, $3, 1)
+		ON CONFLICT (user_id, kind, window_start) DO UPDATE
+		SET used = user_quota_counters.used + 1
+		WHERE user_quota_counters.used < $4
+		RETURNING used`
+
+	var used int
+	err := r.pool.QueryRow(ctx, query, userID, kind, windowStart, limit).Scan(&used)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return limit, false, nil
+		}
+		log.Printf("[QuotaRepo] ConsumeQuota - Error: %v", err)
+		return 0, false, fmt.Errorf("failed to consume quota: %w", err)
+	}
+	return used, true, nil
+}
+
+// GetQuotaUsage возвращает значение счетчика в окне
+func (r *PostgresQuotaRepository) GetQuotaUsage(ctx context.Context, userID, kind string, windowStart time.Time) (int, error) {
+	var used int
+	err := r.pool.QueryRow(ctx,
+		`SELECT used FROM user_quota_counters WHERE user_id = $1 AND kind = $2 AND window_start = $3`,
+		userID, kind, windowStart).Scan(&used)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, nil
+		}
+		log.Printf("[QuotaRepo] GetQuotaUsage - Error: %v", err)
+		return 0, fmt.Errorf("failed to get quota usage: %w", err)
+	}
+	return used, nil
+}
@@ -6,31 +6,161 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"log"
 	"novel-server/internal/domain"
 	"novel-server/internal/logger"
 
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5" // Для проверки ошибок PostgreSQL
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 	// Убираем "github.com/jmoiron/sqlx"
 	// Убираем "github.com/lib/pq" // PostgreSQL driver
 )
 
+// pgxQuerier - общее у пула соединений и транзакции. Внутри транзакции Begin
+// создает точку сохранения, поэтому методы с собственной транзакцией работают и в WithTx.
+type pgxQuerier interface {
+	Exec(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+	Begin(ctx context.Context) (pgx.Tx, error)
+}
+
 // PostgresNovelRepository реализует NovelRepository для PostgreSQL.
 type PostgresNovelRepository struct {
-	db *pgxpool.Pool
+	db    pgxQuerier     // Пул соединений или транзакция WithTx
+	locks *sceneLockPool // Соединения для блокировок генерации; nil у репозитория транзакции
 }
 
 // NewPostgresNovelRepository создает новый экземпляр PostgresNovelRepository.
+// Соединения для блокировок генерации (см. LockSceneGeneration) закрывает Close.
 func NewPostgresNovelRepository(db *pgxpool.Pool) *PostgresNovelRepository {
 	if db == nil {
 		logger.Logger.Error("database connection provided to repository is nil")
 		panic("nil db")
 	}
-	return &PostgresNovelRepository{db: db}
+	return &PostgresNovelRepository{db: db, locks: newSceneLockPool(db.Config())}
+}
+
+// Close закрывает соединения блокировок генерации. Основной пул закрывает его владелец.
+func (r *PostgresNovelRepository) Close() {
+	if r.locks != nil {
+		r.locks.close()
+	}
+}
+
+// withTx выполняет fn в транзакции; репозиторий tx работает через нее
+func (r *PostgresNovelRepository) withTx(ctx context.Context, fn func(tx *PostgresNovelRepository) error) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if err := fn(&PostgresNovelRepository{db: tx}); err != nil {
+		return err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// WithTx выполняет fn в одной транзакции. Вложенный вызов создает точку сохранения.
+func (r *PostgresNovelRepository) WithTx(ctx context.Context, fn func(tx NovelRepository) error) error {
+	return r.withTx(ctx, func(tx *PostgresNovelRepository) error {
+		return fn(tx)
+	})
+}
+
+// sceneGenerationLockKey - ключ advisory-блокировки ветки; hashtextextended переводит его в bigint
+func sceneGenerationLockKey(novelID uuid.UUID, stateHash string) string {
+	return "scene_generation:" + novelID.String() + ":" + stateHash
+}
+
+// sceneLockMaxConns - сколько веток процесс может генерировать одновременно с блокировкой в PostgreSQL.
+// Остальные генерации ждут свободного соединения, не занимая основной пул.
+const sceneLockMaxConns = 8
+
+// sceneLockPool - отдельный небольшой пул для блокировок генерации. Блокировка держится минутами,
+// пока отвечает модель; на соединениях основного пула такие генерации заняли бы его целиком,
+// и их собственные запросы к базе ждали бы соединения вечно. Пул создается при первой блокировке.
+type sceneLockPool struct {
+	mu     sync.Mutex
+	config *pgxpool.Config
+	pool   *pgxpool.Pool
+}
+
+// newSceneLockPool готовит пул блокировок с настройками подключения основного пула config
+func newSceneLockPool(config *pgxpool.Config) *sceneLockPool {
+	config.MaxConns = sceneLockMaxConns
+	config.MinConns = 0
+	return &sceneLockPool{config: config}
+}
+
+// acquire берет соединение для блокировки, при необходимости создавая пул
+func (p *sceneLockPool) acquire(ctx context.Context) (*pgxpool.Conn, error) {
+	p.mu.Lock()
+	if p.pool == nil {
+		pool, err := pgxpool.NewWithConfig(context.Background(), p.config)
+		if err != nil {
+			p.mu.Unlock()
+			return nil, fmt.Errorf("failed to create scene generation lock pool: %w", err)
+		}
+		p.pool = pool
+	}
+	pool := p.pool
+	p.mu.Unlock()
+
+	return pool.Acquire(ctx)
+}
+
+// close закрывает пул, если он был создан
+func (p *sceneLockPool) close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.pool != nil {
+		p.pool.Close()
+		p.pool = nil
+	}
+}
+
+// LockSceneGeneration удерживает advisory-блокировку ветки на время fn. Блокировка берется
+// на соединении отдельного пула sceneLockPool. Внутри WithTx блокировка действует до конца транзакции.
+func (r *PostgresNovelRepository) LockSceneGeneration(ctx context.Context, novelID uuid.UUID, stateHash string, fn func(ctx context.Context) error) error {
+	key := sceneGenerationLockKey(novelID, stateHash)
+
+	if r.locks == nil {
+		if _, err := r.db.Exec(ctx, `SELECT pg_advisory_xact_lock(hashtextextended($1, 0))`, key); err != nil {
+			return fmt.Errorf("failed to acquire scene generation lock: %w", err)
+		}
+		return fn(ctx)
+	}
+
+	conn, err := r.locks.acquire(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get connection for scene generation lock: %w", err)
+	}
+	if _, err := conn.Exec(ctx, `SELECT pg_advisory_lock(hashtextextended($1, 0))`, key); err != nil {
+		// Прерванное ожидание закрывает соединение, и пул его не переиспользует
+		conn.Release()
+		return fmt.Errorf("failed to acquire scene generation lock: %w", err)
+	}
+	defer func() {
+		if _, err := conn.Exec(context.Background(), `SELECT pg_advisory_unlock(hashtextextended($1, 0))`, key); err != nil {
+			// Соединение с неснятой блокировкой не возвращаем в пул: закрытие снимает блокировку
+			log.Printf("[LockSceneGeneration] Failed to release lock %s, closing connection: %v", key, err)
+			conn.Hijack().Close(context.Background())
+			return
+		}
+		conn.Release()
+	}()
+	return fn(ctx)
 }
 
 // CreateNovel создает новую запись о новелле в хранилище.
@@ -49,11 +179,11 @@ func (r *PostgresNovelRepository) CreateNovel(ctx context.Context, userID string
 
 	novelID := uuid.New()
 	query := `
-		INSERT INTO novels (novel_id, user_id, title, short_description, config_data, created_at, updated_at, is_adult_content)
-		VALUES ($1, $2, $3, $4, $5, NOW(), NOW(), $6)
+		INSERT INTO novels (novel_id, user_id, title, short_description, config_data, created_at, updated_at, is_adult_content, prompt_version)
+		VALUES ($1, $2, $3, $4, $5, NOW(), NOW(), $6, NULLIF($7, ''))
 	`
 
-	_, err = r.db.Exec(ctx, query, novelID, userID, config.Title, config.ShortDescription, configData, config.IsAdultContent)
+	_, err = r.db.Exec(ctx, query, novelID, userID, config.Title, config.ShortDescription, configData, config.IsAdultContent, config.PromptVersion)
 	if err != nil {
 		logger.Logger.Error("CreateNovel - insert error", "novelID", novelID, "err", err)
 		return uuid.Nil, fmt.Errorf("failed to insert novel: %w", err)
@@ -76,7 +206,7 @@ func (r *PostgresNovelRepository) GetNovelMetadataByID(ctx context.Context, nove
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			logger.Logger.Warn("GetNovelMetadataByID - not found or access denied", "novelID", novelID, "userID", userID)
-			return nil, fmt.Errorf("novel not found or not owned by user")
+			return nil, fmt.Errorf("novel not found or not owned by user: %w", ErrNotFound)
 		}
 		logger.Logger.Error("GetNovelMetadataByID - query error", "err", err)
 		return nil, fmt.Errorf("failed to get novel metadata: %w", err)
@@ -97,7 +227,7 @@ func (r *PostgresNovelRepository) GetNovelConfigByID(ctx context.Context, novelI
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			log.Printf("[Repo] GetNovelConfigByID - Novel not found: %s", novelID)
-			return nil, fmt.Errorf("novel not found")
+			return nil, fmt.Errorf("novel not found: %w", ErrNotFound)
 		}
 		log.Printf("[Repo] GetNovelConfigByID - Error scanning config: %v", err)
 		return nil, fmt.Errorf("failed to get novel config: %w", err)
@@ -172,12 +302,21 @@ func (r *PostgresNovelRepository) ListNovelsByUser(ctx context.Context, userID s
 
 // SaveNovelState сохраняет состояние новеллы (stateData) для определенной сцены
 // Если в stateData значение current_stage равно "setup", то данные сохраняются в таблицу novels в поле setup_state_data.
+// Состояние и прогресс пользователя сохраняются в одной транзакции.
 func (r *PostgresNovelRepository) SaveNovelState(ctx context.Context, novelID uuid.UUID, sceneIndex int, userID string, stateHash string, stateData []byte) error {
+	return r.withTx(ctx, func(tx *PostgresNovelRepository) error {
+		return tx.saveNovelState(ctx, novelID, sceneIndex, userID, stateHash, stateData)
+	})
+}
+
+// saveNovelState выполняет SaveNovelState без собственной транзакции
+func (r *PostgresNovelRepository) saveNovelState(ctx context.Context, novelID uuid.UUID, sceneIndex int, userID string, stateHash string, stateData []byte) error {
 	log.Printf("[Repo] Saving state. NovelID: %s, SceneIndex: %d, UserID: %s, Hash: %s", novelID, sceneIndex, userID, stateHash)
 
 	// Проверяем, является ли состояние сетапом по значению current_stage
 	var state struct {
-		CurrentStage string `json:"current_stage"`
+		CurrentStage  string `json:"current_stage"`
+		PromptVersion string `json:"prompt_version"`
 	}
 	if err := json.Unmarshal(stateData, &state); err != nil {
 		log.Printf("[Repo] Warning: Failed to unmarshal state to check current_stage: %v", err)
@@ -210,8 +349,8 @@ func (r *PostgresNovelRepository) SaveNovelState(ctx context.Context, novelID uu
 
 		_, err = r.db.Exec(ctx, updateUserProgressQuery, novelID, userID, sceneIndex)
 		if err != nil {
-			log.Printf("[Repo] Warning: Could not update user progress for setup: %v", err)
-			// Не возвращаем ошибку, так как основное состояние уже сохранено
+			log.Printf("[Repo] Error updating user progress for setup: %v", err)
+			return fmt.Errorf("failed to update user progress: %w", err)
 		}
 
 		log.Printf("[Repo] Setup state saved only to novels table. Not saving to novel_states. NovelID: %s", novelID)
@@ -220,14 +359,14 @@ func (r *PostgresNovelRepository) SaveNovelState(ctx context.Context, novelID uu
 
 	// Для обычных сцен (не сетап) сохраняем в novel_states
 	query := `
-		INSERT INTO novel_states (novel_id, scene_index, state_hash, state_data, created_at, updated_at)
-		VALUES ($1, $2, $3, $4, NOW(), NOW())
+		INSERT INTO novel_states (novel_id, scene_index, state_hash, state_data, prompt_version, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, NULLIF($5, ''), NOW(), NOW())
 		ON CONFLICT (novel_id, scene_index, state_hash) DO UPDATE
 		SET updated_at = NOW();
 	`
 
 	// Сохраняем в БД, обновляя updated_at в случае конфликта ключей
-	_, err := r.db.Exec(ctx, query, novelID, sceneIndex, stateHash, stateData)
+	_, err := r.db.Exec(ctx, query, novelID, sceneIndex, stateHash, stateData, state.PromptVersion)
 	if err != nil {
 		log.Printf("[Repo] Error saving state: %v", err)
 		return fmt.Errorf("failed to save novel state: %w", err)
@@ -247,8 +386,8 @@ func (r *PostgresNovelRepository) SaveNovelState(ctx context.Context, novelID uu
 
 	_, err = r.db.Exec(ctx, updateUserProgressQuery, novelID, userID, sceneIndex)
 	if err != nil {
-		log.Printf("[Repo] Warning: Could not update user progress: %v", err)
-		// Не возвращаем ошибку, так как основное состояние уже сохранено
+		log.Printf("[Repo] Error updating user progress: %v", err)
+		return fmt.Errorf("failed to update user progress: %w", err)
 	}
 
 	return nil
@@ -292,57 +431,36 @@ func (r *PostgresNovelRepository) GetLatestNovelState(ctx context.Context, novel
 				return existingStateData, 0, nil
 			}
 
-			// Если сцены с индексом 0 нет, проверяем старую логику для обратной совместимости
-			log.Printf("[Repo] No existing scene 0 found. Checking old schema for user-specific state.")
+			// Если сцены с индексом 0 нет, проверяем наличие сетапа (сцены с current_stage="setup")
+			log.Printf("[Repo] No existing scene 0 found, checking for setup state. NovelID: %s, UserID: %s", novelID, userID)
+
+			setupData, setupErr := r.GetNovelSetupState(ctx, novelID)
+			if setupErr == nil {
+				// Нашли сетап, определяем его scene_index
+				var setupState struct {
+					CurrentStage string `json:"current_stage"`
+					Scenes       []struct {
+						Index int `json:"index"`
+					} `json:"scenes"`
+				}
 
-			fallbackQuery := `
-				SELECT scene_index, state_data 
-				FROM novel_states 
-				WHERE novel_id = $1 AND user_id = $2
-				ORDER BY scene_index DESC, updated_at DESC 
-				LIMIT 1;
-			`
+				setupSceneIndex := 0 // По умолчанию считаем, что сетап имеет индекс 0
 
-			err = r.db.QueryRow(ctx, fallbackQuery, novelID, userID).Scan(&sceneIndex, &stateData)
-			if err != nil {
-				if errors.Is(err, pgx.ErrNoRows) {
-					// Если прямой запрос не нашел данных, проверяем наличие сетапа (сцены с current_stage="setup")
-					log.Printf("[Repo] No direct state found, checking for setup state. NovelID: %s, UserID: %s", novelID, userID)
-
-					setupData, setupErr := r.GetNovelSetupState(ctx, novelID)
-					if setupErr == nil {
-						// Нашли сетап, определяем его scene_index
-						var setupState struct {
-							CurrentStage string `json:"current_stage"`
-							Scenes       []struct {
-								Index int `json:"index"`
-							} `json:"scenes"`
-						}
-
-						setupSceneIndex := 0 // По умолчанию считаем, что сетап имеет индекс 0
-
-						if err := json.Unmarshal(setupData, &setupState); err == nil {
-							// Если смогли распарсить JSON и найти индекс сцены, используем его
-							if len(setupState.Scenes) > 0 {
-								setupSceneIndex = setupState.Scenes[0].Index
-							}
-						}
-
-						log.Printf("[Repo] Returning setup state (current_stage='setup'). NovelID: %s, UserID: %s, SceneIndex: %d",
-							novelID, userID, setupSceneIndex)
-						return setupData, setupSceneIndex, nil
+				if err := json.Unmarshal(setupData, &setupState); err == nil {
+					// Если смогли распарсить JSON и найти индекс сцены, используем его
+					if len(setupState.Scenes) > 0 {
+						setupSceneIndex = setupState.Scenes[0].Index
 					}
-
-					log.Printf("[Repo] No latest state found for user. NovelID: %s, UserID: %s", novelID, userID)
-					// Возвращаем -1 как индикатор отсутствия состояния, а не ошибку
-					return nil, -1, nil
 				}
-				log.Printf("[Repo] Error getting latest state directly: %v", err)
-				return nil, -1, fmt.Errorf("failed to get latest novel state: %w", err)
+
+				log.Printf("[Repo] Returning setup state (current_stage='setup'). NovelID: %s, UserID: %s, SceneIndex: %d",
+					novelID, userID, setupSceneIndex)
+				return setupData, setupSceneIndex, nil
 			}
 
-			log.Printf("[Repo] Found latest state directly. NovelID: %s, UserID: %s, SceneIndex: %d", novelID, userID, sceneIndex)
-			return stateData, sceneIndex, nil
+			log.Printf("[Repo] No latest state found for user. NovelID: %s, UserID: %s", novelID, userID)
+			// Возвращаем -1 как индикатор отсутствия состояния, а не ошибку
+			return nil, -1, nil
 		}
 
 		log.Printf("[Repo] Error getting user progress: %v", err)
@@ -397,7 +515,7 @@ func (r *PostgresNovelRepository) GetLatestNovelState(ctx context.Context, novel
 }
 
 // GetNovelStateByHash возвращает состояние новеллы (stateData) по его хешу.
-// Возвращает ошибку ErrNoRows, если состояние с таким хешом не найдено.
+// Возвращает ошибку ErrNotFound, если состояние с таким хешом не найдено.
 func (r *PostgresNovelRepository) GetNovelStateByHash(ctx context.Context, stateHash string) (stateData []byte, err error) {
 	query := `SELECT state_data FROM novel_states WHERE state_hash = $1 LIMIT 1;`
 	log.Printf("[Repo] Getting state by hash. Hash: %s", stateHash)
@@ -405,7 +523,7 @@ func (r *PostgresNovelRepository) GetNovelStateByHash(ctx context.Context, state
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			log.Printf("[Repo] State not found by hash: %s", stateHash)
-			return nil, pgx.ErrNoRows // Возвращаем стандартную ошибку
+			return nil, ErrNotFound // Возвращаем стандартную ошибку
 		}
 		log.Printf("[Repo] Error getting state by hash: %v", err)
 		return nil, fmt.Errorf("failed to get novel state by hash: %w", err)
@@ -416,7 +534,7 @@ func (r *PostgresNovelRepository) GetNovelStateByHash(ctx context.Context, state
 
 // GetNovelStateBySceneIndex возвращает состояние новеллы (stateData) для определенного индекса сцены.
 // Возвращает самое раннее состояние (первое созданное), которое должно быть общим для всех пользователей.
-// Возвращает ошибку ErrNoRows, если состояние с таким индексом сцены не найдено.
+// Возвращает ошибку ErrNotFound, если состояние с таким индексом сцены не найдено.
 func (r *PostgresNovelRepository) GetNovelStateBySceneIndex(ctx context.Context, novelID uuid.UUID, sceneIndex int) (stateData []byte, err error) {
 	query := `
 		SELECT state_data 
@@ -432,7 +550,7 @@ func (r *PostgresNovelRepository) GetNovelStateBySceneIndex(ctx context.Context,
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			log.Printf("[Repo] State not found for scene index: %d in novel: %s", sceneIndex, novelID)
-			return nil, pgx.ErrNoRows
+			return nil, ErrNotFound
 		}
 		log.Printf("[Repo] Error getting state by scene index: %v", err)
 		return nil, fmt.Errorf("failed to get novel state by scene index: %w", err)
@@ -465,7 +583,7 @@ func (r *PostgresNovelRepository) GetNovelSetupState(ctx context.Context, novelI
 
 	// Получаем состояния и проверяем их поле current_stage
 	queryOld := `
-		SELECT state_data, user_id, created_at, state_hash  
+		SELECT state_data, created_at, state_hash
 		FROM novel_states 
 		WHERE novel_id = $1
 		ORDER BY created_at ASC;
@@ -480,11 +598,10 @@ func (r *PostgresNovelRepository) GetNovelSetupState(ctx context.Context, novelI
 
 	for rows.Next() {
 		var tempStateData []byte
-		var userID string
 		var createdAt time.Time
 		var stateHash string
 
-		err := rows.Scan(&tempStateData, &userID, &createdAt, &stateHash)
+		err := rows.Scan(&tempStateData, &createdAt, &stateHash)
 		if err != nil {
 			log.Printf("[Repo] Error scanning row: %v", err)
 			continue
@@ -500,8 +617,8 @@ func (r *PostgresNovelRepository) GetNovelSetupState(ctx context.Context, novelI
 		}
 
 		if state.CurrentStage == "setup" {
-			log.Printf("[Repo] Found setup state (current_stage='setup') in novel_states. NovelID: %s, UserID: %s, CreatedAt: %s, StateHash: %s",
-				novelID, userID, createdAt.Format(time.RFC3339), stateHash)
+			log.Printf("[Repo] Found setup state (current_stage='setup') in novel_states. NovelID: %s, CreatedAt: %s, StateHash: %s",
+				novelID, createdAt.Format(time.RFC3339), stateHash)
 
 			// Сохраняем найденный сетап в таблицу novels для будущего использования
 			err = r.SaveNovelSetupState(ctx, novelID, tempStateData)
@@ -521,15 +638,23 @@ func (r *PostgresNovelRepository) GetNovelSetupState(ctx context.Context, novelI
 
 	// Если сетап не найден ни в одной из таблиц
 	log.Printf("[Repo] Setup state not found for NovelID: %s", novelID)
-	return nil, pgx.ErrNoRows
+	return nil, ErrNotFound
 }
 
-// SaveNovelSetupState сохраняет сетап новеллы в поле setup_state_data таблицы novels
+// SaveNovelSetupState сохраняет сетап новеллы в поле setup_state_data таблицы novels,
+// а версию промпта, которым он сгенерирован, - в setup_prompt_version
 func (r *PostgresNovelRepository) SaveNovelSetupState(ctx context.Context, novelID uuid.UUID, setupData []byte) error {
-	query := `UPDATE novels SET setup_state_data = $1, updated_at = CURRENT_TIMESTAMP WHERE novel_id = $2;`
+	var setup struct {
+		PromptVersion string `json:"prompt_version"`
+	}
+	if err := json.Unmarshal(setupData, &setup); err != nil {
+		log.Printf("[Repo] Warning: Failed to unmarshal setup state to read prompt_version: %v", err)
+	}
+
+	query := `UPDATE novels SET setup_state_data = $1, setup_prompt_version = NULLIF($2, ''), updated_at = CURRENT_TIMESTAMP WHERE novel_id = $3;`
 
 	log.Printf("[Repo] Saving setup state to novels table. NovelID: %s", novelID)
-	_, err := r.db.Exec(ctx, query, setupData, novelID)
+	_, err := r.db.Exec(ctx, query, setupData, setup.PromptVersion, novelID)
 	if err != nil {
 		log.Printf("[Repo] Error saving setup state to novels table: %v", err)
 		return fmt.Errorf("failed to save setup state to novels table: %w", err)
@@ -540,8 +665,8 @@ func (r *PostgresNovelRepository) SaveNovelSetupState(ctx context.Context, novel
 }
 
 // ListNovels возвращает список новелл с поддержкой курсорной пагинации и информацией о прогрессе пользователя.
-func (r *PostgresNovelRepository) ListNovels(ctx context.Context, userID string, limit int, cursor *uuid.UUID) ([]domain.NovelListItem, int, *uuid.UUID, error) {
-	log.Printf("[Repo] ListNovels called for UserID: %s, Limit: %d, Cursor: %v", userID, limit, cursor)
+func (r *PostgresNovelRepository) ListNovels(ctx context.Context, userID, scope string, limit int, cursor *uuid.UUID) ([]domain.NovelListItem, int, *uuid.UUID, error) {
+	log.Printf("[Repo] ListNovels called for UserID: %s, Scope: %s, Limit: %d, Cursor: %v", userID, scope, limit, cursor)
 
 	if userID == "" {
 		log.Println("[Repo] ListNovels - Error: userID is required to get progress.")
@@ -566,6 +691,7 @@ func (r *PostgresNovelRepository) ListNovels(ctx context.Context, userID string,
 			n.created_at,
 			n.updated_at,
 			n.is_adult_content,
+			n.visibility,
 			(n.setup_state_data IS NOT NULL OR EXISTS(SELECT 1 FROM novel_states ns_setup WHERE ns_setup.novel_id = n.novel_id AND ns_setup.scene_index = 0)) as is_setuped,
 			(
 				SELECT up.current_scene_index
@@ -578,6 +704,13 @@ func (r *PostgresNovelRepository) ListNovels(ctx context.Context, userID string,
 	args = append(args, userID)
 	paramCount++ // $1 = userID
 
+	// Условия WHERE: область списка и курсор
+	conditions := []string{}
+	scopeCondition := novelScopeCondition(scope)
+	if scopeCondition != "" {
+		conditions = append(conditions, scopeCondition)
+	}
+
 	// Добавляем условие для курсорной пагинации, если курсор предоставлен
 	if cursor != nil {
 		// Получаем created_at для курсора (отдельным запросом для простоты)
@@ -594,13 +727,16 @@ func (r *PostgresNovelRepository) ListNovels(ctx context.Context, userID string,
 
 		// Добавляем условие WHERE (Keyset pagination)
 		// (created_at < cursor_created_at) OR (created_at = cursor_created_at AND novel_id < cursor_novel_id)
-		queryBuilder.WriteString(fmt.Sprintf(`
-			WHERE (n.created_at < $%d) OR (n.created_at = $%d AND n.novel_id < $%d)
-		`, paramCount+1, paramCount+2, paramCount+3))
+		conditions = append(conditions, fmt.Sprintf("((n.created_at < $%d) OR (n.created_at = $%d AND n.novel_id < $%d))",
+			paramCount+1, paramCount+2, paramCount+3))
 		args = append(args, cursorCreatedAt, cursorCreatedAt, *cursor)
 		paramCount += 3
 	}
 
+	if len(conditions) > 0 {
+		queryBuilder.WriteString("\n\t\tWHERE " + strings.Join(conditions, " AND ") + "\n")
+	}
+
 	// Добавляем сортировку и лимит
 	queryBuilder.WriteString(fmt.Sprintf(`
 		ORDER BY n.created_at DESC, n.novel_id DESC
@@ -638,6 +774,7 @@ func (r *PostgresNovelRepository) ListNovels(ctx context.Context, userID string,
 			&item.CreatedAt,
 			&item.UpdatedAt,
 			&isAdultContent,
+			&item.Visibility,
 			&isSetuped,
 			&currentUserSceneIndex,
 		); err != nil {
@@ -683,8 +820,15 @@ func (r *PostgresNovelRepository) ListNovels(ctx context.Context, userID string,
 
 	// Получаем общее количество новелл (только засетапленные)
 	var totalCount int
-	countQuery := `SELECT COUNT(*) FROM novels WHERE setup_state_data IS NOT NULL OR EXISTS (SELECT 1 FROM novel_states ns WHERE ns.novel_id = novels.novel_id AND ns.scene_index = 0)`
-	if err := r.db.QueryRow(ctx, countQuery).Scan(&totalCount); err != nil {
+	countQuery := `SELECT COUNT(*) FROM novels n WHERE (n.setup_state_data IS NOT NULL OR EXISTS (SELECT 1 FROM novel_states ns WHERE ns.novel_id = n.novel_id AND ns.scene_index = 0))`
+	countArgs := []interface{}{}
+	if scopeCondition != "" {
+		countQuery += " AND " + scopeCondition
+		if strings.Contains(scopeCondition, "$1") {
+			countArgs = append(countArgs, userID)
+		}
+	}
+	if err := r.db.QueryRow(ctx, countQuery, countArgs...).Scan(&totalCount); err != nil {
 		log.Printf("[Repo] ListNovels - Error counting total setuped novels: %v", err)
 		totalCount = 0 // Не критично, если счетчик не сработает
 	}
@@ -702,6 +846,19 @@ func (r *PostgresNovelRepository) ListNovels(ctx context.Context, userID string,
 	return novels, totalCount, nextCursor, nil
 }
 
+// novelScopeCondition возвращает условие WHERE для области списка новелл.
+// Условие ссылается на таблицу novels как n и на ID пользователя как $1.
+func novelScopeCondition(scope string) string {
+	switch scope {
+	case domain.NovelScopeAll:
+		return ""
+	case domain.NovelScopePublic:
+		return "n.visibility = 'public'"
+	default:
+		return "n.user_id = $1"
+	}
+}
+
 // Вспомогательная функция для определения количества сцен по строке длины
 // (Эта функция должна быть идентична той, что используется в NovelContentService)
 func determineSceneCountFromLength(length string) int {
@@ -725,7 +882,7 @@ func (r *PostgresNovelRepository) GetNovelDetails(ctx context.Context, novelID u
 
 	// Получаем основную информацию о новелле
 	query := `
-		SELECT n.novel_id, n.title, COALESCE(n.short_description, '') as short_description, n.config_data, n.created_at, n.updated_at,
+		SELECT n.novel_id, n.user_id, n.visibility, n.title, COALESCE(n.short_description, '') as short_description, n.config_data, n.created_at, n.updated_at,
 			   (SELECT COUNT(*) FROM novel_states ns WHERE ns.novel_id = n.novel_id) as scenes_count,
 			   (n.setup_state_data IS NOT NULL OR EXISTS(SELECT 1 FROM novel_states ns WHERE ns.novel_id = n.novel_id AND ns.scene_index = 0)) as is_setuped
 		FROM novels n
@@ -740,6 +897,8 @@ func (r *PostgresNovelRepository) GetNovelDetails(ctx context.Context, novelID u
 	// Выполняем запрос
 	err := r.db.QueryRow(ctx, query, novelID).Scan(
 		&novelDetails.NovelID,
+		&novelDetails.UserID,
+		&novelDetails.Visibility,
 		&novelDetails.Title,
 		&shortDescription,
 		&configJSON,
@@ -752,7 +911,7 @@ func (r *PostgresNovelRepository) GetNovelDetails(ctx context.Context, novelID u
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			log.Printf("[Repo] GetNovelDetails - Novel not found: %s", novelID)
-			return nil, fmt.Errorf("novel not found")
+			return nil, fmt.Errorf("novel not found: %w", ErrNotFound)
 		}
 		log.Printf("[Repo] GetNovelDetails - Error querying novel: %v", err)
 		return nil, fmt.Errorf("failed to get novel details: %w", err)
@@ -814,7 +973,7 @@ func (r *PostgresNovelRepository) GetNovelIsAdult(ctx context.Context, novelID u
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			log.Printf("[Repo] GetNovelIsAdult - Novel not found: %s", novelID)
-			return false, fmt.Errorf("novel not found")
+			return false, fmt.Errorf("novel not found: %w", ErrNotFound)
 		}
 		log.Printf("[Repo] GetNovelIsAdult - Error querying is_adult_content: %v", err)
 		return false, fmt.Errorf("failed to get is_adult_content flag: %w", err)
@@ -823,9 +982,162 @@ func (r *PostgresNovelRepository) GetNovelIsAdult(ctx context.Context, novelID u
 	return isAdult, nil
 }
 
-// DB возвращает пул соединений с базой данных для низкоуровневых операций
-func (r *PostgresNovelRepository) DB() *pgxpool.Pool {
-	return r.db
+// DeleteNovel удаляет новеллу. Состояния, прогресс игроков, сохранения и задача сетапа
+// удаляются каскадно (ON DELETE CASCADE); записи расхода модели остаются для истории.
+func (r *PostgresNovelRepository) DeleteNovel(ctx context.Context, novelID uuid.UUID) error {
+	log.Printf("[Repo] DeleteNovel called for NovelID: %s", novelID)
+	tag, err := r.db.Exec(ctx, `DELETE FROM novels WHERE novel_id = $1`, novelID)
+	if err != nil {
+		log.Printf("[Repo] DeleteNovel - Error: %v", err)
+		return fmt.Errorf("failed to delete novel: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// UpdateNovel меняет название и краткое описание новеллы владельца ownerID. Поля обновляются
+// и в колонках, и в config_data, чтобы конфиг новеллы оставался согласованным.
+func (r *PostgresNovelRepository) UpdateNovel(ctx context.Context, novelID uuid.UUID, ownerID string, title, shortDescription *string) error {
+	log.Printf("[Repo] UpdateNovel called for NovelID: %s, UserID: %s", novelID, ownerID)
+	query := `
+		UPDATE novels
+		SET title = COALESCE($3, title),
+			short_description = COALESCE($4, short_description),
+			config_data = config_data || jsonb_strip_nulls(jsonb_build_object('title', $3::text, 'short_description', $4::text))
+		WHERE novel_id = $1 AND user_id = $2
+	`
+	tag, err := r.db.Exec(ctx, query, novelID, ownerID, title, shortDescription)
+	if err != nil {
+		log.Printf("[Repo] UpdateNovel - Error: %v", err)
+		return fmt.Errorf("failed to update novel: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// SetNovelOwner передает новеллу другому пользователю. Задача сетапа переходит вместе с ней,
+// чтобы статус и повтор генерации были доступны новому владельцу.
+func (r *PostgresNovelRepository) SetNovelOwner(ctx context.Context, novelID uuid.UUID, userID string) error {
+	log.Printf("[Repo] SetNovelOwner called for NovelID: %s, new owner: %s", novelID, userID)
+
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	tag, err := tx.Exec(ctx, `UPDATE novels SET user_id = $2 WHERE novel_id = $1`, novelID, userID)
+	if err != nil {
+		log.Printf("[Repo] SetNovelOwner - Error updating novel: %v", err)
+		return fmt.Errorf("failed to update novel owner: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	if _, err := tx.Exec(ctx, `UPDATE novel_setup_jobs SET user_id = $2 WHERE novel_id = $1`, novelID, userID); err != nil {
+		log.Printf("[Repo] SetNovelOwner - Error updating setup job: %v", err)
+		return fmt.Errorf("failed to update setup job owner: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// GetNovelAccess возвращает владельца и видимость новеллы и сообщает, открывал ли userID ссылку на нее
+func (r *PostgresNovelRepository) GetNovelAccess(ctx context.Context, novelID uuid.UUID, userID string) (*domain.NovelAccess, error) {
+	query := `
+		SELECT n.user_id, n.visibility,
+			EXISTS(SELECT 1 FROM novel_access_grants g WHERE g.novel_id = n.novel_id AND g.user_id = $2)
+		FROM novels n
+		WHERE n.novel_id = $1
+	`
+	var access domain.NovelAccess
+	err := r.db.QueryRow(ctx, query, novelID, userID).Scan(&access.OwnerID, &access.Visibility, &access.Granted)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		log.Printf("[Repo] GetNovelAccess - Error: %v", err)
+		return nil, fmt.Errorf("failed to get novel access: %w", err)
+	}
+	return &access, nil
+}
+
+// SetNovelVisibility меняет видимость новеллы владельца ownerID
+func (r *PostgresNovelRepository) SetNovelVisibility(ctx context.Context, novelID uuid.UUID, ownerID, visibility string) error {
+	log.Printf("[Repo] SetNovelVisibility called for NovelID: %s, Visibility: %s", novelID, visibility)
+	tag, err := r.db.Exec(ctx, `UPDATE novels SET visibility = $3 WHERE novel_id = $1 AND user_id = $2`, novelID, ownerID, visibility)
+	if err != nil {
+		log.Printf("[Repo] SetNovelVisibility - Error: %v", err)
+		return fmt.Errorf("failed to set novel visibility: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// SetNovelShareToken задает токен ссылки на новеллу владельца ownerID.
+// Пустой token отключает ссылку и отзывает доступ всех, кто ее открывал.
+func (r *PostgresNovelRepository) SetNovelShareToken(ctx context.Context, novelID uuid.UUID, ownerID, token string) error {
+	log.Printf("[Repo] SetNovelShareToken called for NovelID: %s, enabled: %t", novelID, token != "")
+
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	tag, err := tx.Exec(ctx, `UPDATE novels SET share_token = NULLIF($3, '') WHERE novel_id = $1 AND user_id = $2`, novelID, ownerID, token)
+	if err != nil {
+		log.Printf("[Repo] SetNovelShareToken - Error: %v", err)
+		return fmt.Errorf("failed to set share token: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	if token == "" {
+		if _, err := tx.Exec(ctx, `DELETE FROM novel_access_grants WHERE novel_id = $1`, novelID); err != nil {
+			log.Printf("[Repo] SetNovelShareToken - Error deleting grants: %v", err)
+			return fmt.Errorf("failed to revoke novel access: %w", err)
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// GetNovelByShareToken возвращает ID и видимость новеллы по токену ссылки
+func (r *PostgresNovelRepository) GetNovelByShareToken(ctx context.Context, token string) (uuid.UUID, string, error) {
+	var novelID uuid.UUID
+	var visibility string
+	err := r.db.QueryRow(ctx, `SELECT novel_id, visibility FROM novels WHERE share_token = $1`, token).Scan(&novelID, &visibility)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return uuid.Nil, "", ErrNotFound
+		}
+		log.Printf("[Repo] GetNovelByShareToken - Error: %v", err)
+		return uuid.Nil, "", fmt.Errorf("failed to get novel by share token: %w", err)
+	}
+	return novelID, visibility, nil
+}
+
+// GrantNovelAccess запоминает, что userID открыл ссылку на новеллу
+func (r *PostgresNovelRepository) GrantNovelAccess(ctx context.Context, novelID uuid.UUID, userID string) error {
+	query := `INSERT INTO novel_access_grants (novel_id, user_id) VALUES ($1, $2) ON CONFLICT DO NOTHING`
+	if _, err := r.db.Exec(ctx, query, novelID, userID); err != nil {
+		log.Printf("[Repo] GrantNovelAccess - Error: %v", err)
+		return fmt.Errorf("failed to grant novel access: %w", err)
+	}
+	return nil
 }
 
 // GetUserNovelProgress возвращает текущий прогресс пользователя в новелле
@@ -845,27 +1157,6 @@ func (r *PostgresNovelRepository) GetUserNovelProgress(ctx context.Context, nove
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			log.Printf("[Repo] No progress found for user. NovelID: %s, UserID: %s", novelID, userID)
-
-			// Проверяем старую схему для обратной совместимости
-			fallbackQuery := `
-				SELECT MAX(scene_index)
-				FROM novel_states
-				WHERE novel_id = $1 AND user_id = $2;
-			`
-
-			var maxSceneIndex sql.NullInt64
-			err = r.db.QueryRow(ctx, fallbackQuery, novelID, userID).Scan(&maxSceneIndex)
-			if err != nil {
-				log.Printf("[Repo] Error getting fallback progress: %v", err)
-				return -1, fmt.Errorf("failed to get fallback user progress: %w", err)
-			}
-
-			if maxSceneIndex.Valid {
-				sceneIndex = int(maxSceneIndex.Int64)
-				log.Printf("[Repo] Found fallback progress. NovelID: %s, UserID: %s, SceneIndex: %d", novelID, userID, sceneIndex)
-				return sceneIndex, nil
-			}
-
 			return -1, nil
 		}
 
@@ -878,9 +1169,17 @@ func (r *PostgresNovelRepository) GetUserNovelProgress(ctx context.Context, nove
 }
 
 // SaveUserStoryProgress сохраняет динамические элементы прогресса пользователя
-// для конкретной сцены новеллы.
+// для конкретной сцены новеллы. Прогресс сцены и текущая сцена сохраняются в одной транзакции.
 func (r *PostgresNovelRepository) SaveUserStoryProgress(ctx context.Context, novelID uuid.UUID, sceneIndex int, userID string,
 	progress *domain.UserStoryProgress) error {
+	return r.withTx(ctx, func(tx *PostgresNovelRepository) error {
+		return tx.saveUserStoryProgress(ctx, novelID, sceneIndex, userID, progress)
+	})
+}
+
+// saveUserStoryProgress выполняет SaveUserStoryProgress без собственной транзакции
+func (r *PostgresNovelRepository) saveUserStoryProgress(ctx context.Context, novelID uuid.UUID, sceneIndex int, userID string,
+	progress *domain.UserStoryProgress) error {
 
 	// Проверяем входные данные
 	if progress == nil {
@@ -900,7 +1199,7 @@ func (r *PostgresNovelRepository) SaveUserStoryProgress(ctx context.Context, nov
 		// Получаем данные состояния по хешу, чтобы проверить current_stage
 		stateData, err := r.GetNovelStateByHash(ctx, progress.StateHash)
 		if err != nil {
-			if !errors.Is(err, pgx.ErrNoRows) {
+			if !errors.Is(err, ErrNotFound) {
 				log.Printf("[Repo] SaveUserStoryProgress - Error getting state by hash %s: %v", progress.StateHash, err)
 				// Не возвращаем ошибку, так как основная цель - сохранить прогресс
 			} else {
@@ -1004,8 +1303,8 @@ func (r *PostgresNovelRepository) SaveUserStoryProgress(ctx context.Context, nov
 
 	_, err = r.db.Exec(ctx, updateProgressQuery, novelID, userID, sceneIndex)
 	if err != nil {
-		log.Printf("[Repo] Warning: Could not update user progress: %v", err)
-		// Не возвращаем ошибку, так как основное сохранение выполнено успешно
+		log.Printf("[Repo] Error updating user progress: %v", err)
+		return fmt.Errorf("failed to update user progress: %w", err)
 	}
 
 	log.Printf("[Repo] Successfully saved user story progress. NovelID: %s, SceneIndex: %d, UserID: %s",
@@ -1049,7 +1348,7 @@ func (r *PostgresNovelRepository) GetUserStoryProgressByHash(ctx context.Context
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			log.Printf("[Repo] No user story progress found by hash: %s", stateHash)
-			return nil, pgx.ErrNoRows
+			return nil, ErrNotFound
 		}
 		log.Printf("[Repo] Error getting user story progress by hash: %v", err)
 		return nil, fmt.Errorf("failed to get user story progress by hash: %w", err)
@@ -1162,3 +1461,351 @@ func (r *PostgresNovelRepository) GetLatestUserStoryProgress(ctx context.Context
 
 	return &progress, currentSceneIndex, nil
 }
+
+// userStoryProgressColumns - список колонок в порядке, ожидаемом scanUserStoryProgress
+const userStoryProgressColumns = `novel_id, user_id, scene_index, global_flags, relationship, story_variables,
+	previous_choices, story_summary_so_far, future_direction, state_hash, created_at, updated_at`
+
+// scanUserStoryProgress сканирует строку с колонками userStoryProgressColumns
+func scanUserStoryProgress(row pgx.Row) (*domain.UserStoryProgress, error) {
+	var progress domain.UserStoryProgress
+	var globalFlagsJSON, relationshipJSON, storyVariablesJSON, previousChoicesJSON []byte
+
+	err := row.Scan(
+		&progress.NovelID,
+		&progress.UserID,
+		&progress.SceneIndex,
+		&globalFlagsJSON,
+		&relationshipJSON,
+		&storyVariablesJSON,
+		&previousChoicesJSON,
+		&progress.StorySummarySoFar,
+		&progress.FutureDirection,
+		&progress.StateHash,
+		&progress.CreatedAt,
+		&progress.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	// Десериализуем JSONB поля
+	if err := json.Unmarshal(globalFlagsJSON, &progress.GlobalFlags); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal global flags: %w", err)
+	}
+	if err := json.Unmarshal(relationshipJSON, &progress.Relationship); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal relationship: %w", err)
+	}
+	if err := json.Unmarshal(storyVariablesJSON, &progress.StoryVariables); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal story variables: %w", err)
+	}
+	if err := json.Unmarshal(previousChoicesJSON, &progress.PreviousChoices); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal previous choices: %w", err)
+	}
+
+	return &progress, nil
+}
+
+// GetUserStoryProgress возвращает прогресс пользователя для конкретной сцены.
+// Возвращает ErrNotFound, если пользователь эту сцену не проходил.
+func (r *PostgresNovelRepository) GetUserStoryProgress(ctx context.Context, novelID uuid.UUID, userID string, sceneIndex int) (*domain.UserStoryProgress, error) {
+	query := `
+		SELECT ` + userStoryProgressColumns + `
+		FROM user_story_progress 
+		WHERE novel_id = $1 AND user_id = $2 AND scene_index = $3 
+		LIMIT 1;
+	`
+
+	log.Printf("[Repo] Getting user story progress. NovelID: %s, UserID: %s, SceneIndex: %d", novelID, userID, sceneIndex)
+
+	progress, err := scanUserStoryProgress(r.db.QueryRow(ctx, query, novelID, userID, sceneIndex))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			log.Printf("[Repo] No user story progress found for scene %d. NovelID: %s, UserID: %s", sceneIndex, novelID, userID)
+			return nil, ErrNotFound
+		}
+		log.Printf("[Repo] Error getting user story progress: %v", err)
+		return nil, fmt.Errorf("failed to get user story progress: %w", err)
+	}
+
+	return progress, nil
+}
+
+// ListUserStoryProgress возвращает прогресс пользователя по всем пройденным сценам
+// в порядке индекса сцены.
+func (r *PostgresNovelRepository) ListUserStoryProgress(ctx context.Context, novelID uuid.UUID, userID string) ([]domain.UserStoryProgress, error) {
+	query := `
+		SELECT ` + userStoryProgressColumns + `
+		FROM user_story_progress 
+		WHERE novel_id = $1 AND user_id = $2
+		ORDER BY scene_index;
+	`
+
+	rows, err := r.db.Query(ctx, query, novelID, userID)
+	if err != nil {
+		log.Printf("[Repo] ListUserStoryProgress - query error: %v", err)
+		return nil, fmt.Errorf("failed to list user story progress: %w", err)
+	}
+	defer rows.Close()
+
+	track := []domain.UserStoryProgress{}
+	for rows.Next() {
+		progress, err := scanUserStoryProgress(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan user story progress: %w", err)
+		}
+		track = append(track, *progress)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error reading user story progress: %w", err)
+	}
+
+	return track, nil
+}
+
+// ReplaceUserStoryProgress заменяет весь прогресс пользователя в новелле на track
+// и делает sceneIndex текущей сценой. Выполняется в одной транзакции.
+func (r *PostgresNovelRepository) ReplaceUserStoryProgress(ctx context.Context, novelID uuid.UUID, userID string, sceneIndex int, track []domain.UserStoryProgress) error {
+	log.Printf("[Repo] Replacing user story progress. NovelID: %s, UserID: %s, SceneIndex: %d, Scenes: %d",
+		novelID, userID, sceneIndex, len(track))
+
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, `DELETE FROM user_story_progress WHERE novel_id = $1 AND user_id = $2;`, novelID, userID); err != nil {
+		log.Printf("[Repo] Error deleting user story progress: %v", err)
+		return fmt.Errorf("failed to delete user story progress: %w", err)
+	}
+
+	insertQuery := `
+		INSERT INTO user_story_progress (
+			novel_id, user_id, scene_index, global_flags, relationship, story_variables, 
+			previous_choices, story_summary_so_far, future_direction, state_hash, created_at, updated_at
+		) VALUES (
+			$1, $2, $3, $4, $5, $6, $7, $8, $9, $10, NOW(), NOW()
+		);
+	`
+	for _, progress := range track {
+		globalFlagsJSON, err := json.Marshal(progress.GlobalFlags)
+		if err != nil {
+			return fmt.Errorf("failed to marshal global flags: %w", err)
+		}
+		relationshipJSON, err := json.Marshal(progress.Relationship)
+		if err != nil {
+			return fmt.Errorf("failed to marshal relationship: %w", err)
+		}
+		storyVariablesJSON, err := json.Marshal(progress.StoryVariables)
+		if err != nil {
+			return fmt.Errorf("failed to marshal story variables: %w", err)
+		}
+		previousChoicesJSON, err := json.Marshal(progress.PreviousChoices)
+		if err != nil {
+			return fmt.Errorf("failed to marshal previous choices: %w", err)
+		}
+
+		_, err = tx.Exec(ctx, insertQuery,
+			novelID,
+			userID,
+			progress.SceneIndex,
+			globalFlagsJSON,
+			relationshipJSON,
+			storyVariablesJSON,
+			previousChoicesJSON,
+			progress.StorySummarySoFar,
+			progress.FutureDirection,
+			progress.StateHash)
+		if err != nil {
+			log.Printf("[Repo] Error inserting user story progress for scene %d: %v", progress.SceneIndex, err)
+			return fmt.Errorf("failed to insert user story progress: %w", err)
+		}
+	}
+
+	progressQuery := `
+		INSERT INTO user_novel_progress (novel_id, user_id, current_scene_index, updated_at)
+		VALUES ($1, $2, $3, NOW())
+		ON CONFLICT (novel_id, user_id) DO UPDATE
+		SET current_scene_index = $3,
+		updated_at = NOW();
+	`
+	if _, err := tx.Exec(ctx, progressQuery, novelID, userID, sceneIndex); err != nil {
+		log.Printf("[Repo] Error updating user progress: %v", err)
+		return fmt.Errorf("failed to update user progress: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit user story progress: %w", err)
+	}
+	return nil
+}
+
+// GetNovelState возвращает состояние новеллы (stateData) для сцены с указанным хешем.
+// Возвращает ErrNotFound, если такого состояния нет.
+func (r *PostgresNovelRepository) GetNovelState(ctx context.Context, novelID uuid.UUID, sceneIndex int, stateHash string) (stateData []byte, err error) {
+	query := `
+		SELECT state_data 
+		FROM novel_states 
+		WHERE novel_id = $1 AND scene_index = $2 AND state_hash = $3
+		LIMIT 1;
+	`
+
+	log.Printf("[Repo] Getting state. NovelID: %s, SceneIndex: %d, Hash: %s", novelID, sceneIndex, stateHash)
+
+	err = r.db.QueryRow(ctx, query, novelID, sceneIndex, stateHash).Scan(&stateData)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			log.Printf("[Repo] State not found. NovelID: %s, SceneIndex: %d, Hash: %s", novelID, sceneIndex, stateHash)
+			return nil, ErrNotFound
+		}
+		log.Printf("[Repo] Error getting state: %v", err)
+		return nil, fmt.Errorf("failed to get novel state: %w", err)
+	}
+
+	return stateData, nil
+}
+
+// RewindUserProgress откатывает прогресс пользователя к сцене sceneIndex:
+// удаляет прогресс всех последующих сцен и делает sceneIndex текущей сценой.
+// Сохраненные сцены (novel_states) не удаляются - они общие для всех игроков.
+func (r *PostgresNovelRepository) RewindUserProgress(ctx context.Context, novelID uuid.UUID, userID string, sceneIndex int) error {
+	log.Printf("[Repo] Rewinding user progress. NovelID: %s, UserID: %s, SceneIndex: %d", novelID, userID, sceneIndex)
+
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	deleteQuery := `
+		DELETE FROM user_story_progress
+		WHERE novel_id = $1 AND user_id = $2 AND scene_index > $3;
+	`
+	tag, err := tx.Exec(ctx, deleteQuery, novelID, userID, sceneIndex)
+	if err != nil {
+		log.Printf("[Repo] Error deleting user story progress: %v", err)
+		return fmt.Errorf("failed to delete user story progress: %w", err)
+	}
+
+	progressQuery := `
+		INSERT INTO user_novel_progress (novel_id, user_id, current_scene_index, updated_at)
+		VALUES ($1, $2, $3, NOW())
+		ON CONFLICT (novel_id, user_id) DO UPDATE
+		SET current_scene_index = $3,
+		updated_at = NOW();
+	`
+	if _, err := tx.Exec(ctx, progressQuery, novelID, userID, sceneIndex); err != nil {
+		log.Printf("[Repo] Error updating user progress: %v", err)
+		return fmt.Errorf("failed to update user progress: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit rewind: %w", err)
+	}
+
+	log.Printf("[Repo] User progress rewound to scene %d, removed %d later scene(s). NovelID: %s, UserID: %s",
+		sceneIndex, tag.RowsAffected(), novelID, userID)
+	return nil
+}
+
+// DeleteUserProgress удаляет текущую сцену и прогресс всех сцен пользователя в новелле.
+// Сохраненные сцены (novel_states) и сохранения пользователя не удаляются.
+func (r *PostgresNovelRepository) DeleteUserProgress(ctx context.Context, novelID uuid.UUID, userID string) error {
+	log.Printf("[Repo] Deleting user progress. NovelID: %s, UserID: %s", novelID, userID)
+
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	storyTag, err := tx.Exec(ctx, `DELETE FROM user_story_progress WHERE novel_id = $1 AND user_id = $2`, novelID, userID)
+	if err != nil {
+		log.Printf("[Repo] Error deleting user story progress: %v", err)
+		return fmt.Errorf("failed to delete user story progress: %w", err)
+	}
+	progressTag, err := tx.Exec(ctx, `DELETE FROM user_novel_progress WHERE novel_id = $1 AND user_id = $2`, novelID, userID)
+	if err != nil {
+		log.Printf("[Repo] Error deleting user progress: %v", err)
+		return fmt.Errorf("failed to delete user progress: %w", err)
+	}
+	if storyTag.RowsAffected() == 0 && progressTag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit progress deletion: %w", err)
+	}
+	return nil
+}
+
+// ListNovelStateRefs возвращает все сохраненные состояния новеллы (индекс сцены и хеш)
+// в порядке индекса сцены.
+func (r *PostgresNovelRepository) ListNovelStateRefs(ctx context.Context, novelID uuid.UUID) ([]domain.StoryStateRef, error) {
+	query := `
+		SELECT DISTINCT scene_index, state_hash
+		FROM novel_states
+		WHERE novel_id = $1
+		ORDER BY scene_index, state_hash;
+	`
+
+	rows, err := r.db.Query(ctx, query, novelID)
+	if err != nil {
+		log.Printf("[Repo] ListNovelStateRefs - query error: %v", err)
+		return nil, fmt.Errorf("failed to list novel states: %w", err)
+	}
+	defer rows.Close()
+
+	refs := []domain.StoryStateRef{}
+	for rows.Next() {
+		var ref domain.StoryStateRef
+		if err := rows.Scan(&ref.SceneIndex, &ref.StateHash); err != nil {
+			return nil, fmt.Errorf("failed to scan novel state: %w", err)
+		}
+		refs = append(refs, ref)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error reading novel states: %w", err)
+	}
+
+	log.Printf("[Repo] ListNovelStateRefs - found %d states for NovelID: %s", len(refs), novelID)
+	return refs, nil
+}
+
+// ListStoryPathSteps возвращает пути всех игроков новеллы из user_story_progress,
+// упорядоченные по пользователю и индексу сцены.
+func (r *PostgresNovelRepository) ListStoryPathSteps(ctx context.Context, novelID uuid.UUID) ([]domain.StoryPathStep, error) {
+	query := `
+		SELECT user_id, scene_index, state_hash, previous_choices
+		FROM user_story_progress
+		WHERE novel_id = $1
+		ORDER BY user_id, scene_index;
+	`
+
+	rows, err := r.db.Query(ctx, query, novelID)
+	if err != nil {
+		log.Printf("[Repo] ListStoryPathSteps - query error: %v", err)
+		return nil, fmt.Errorf("failed to list story progress: %w", err)
+	}
+	defer rows.Close()
+
+	steps := []domain.StoryPathStep{}
+	for rows.Next() {
+		var step domain.StoryPathStep
+		var previousChoicesJSON []byte
+		if err := rows.Scan(&step.UserID, &step.SceneIndex, &step.StateHash, &previousChoicesJSON); err != nil {
+			return nil, fmt.Errorf("failed to scan story progress: %w", err)
+		}
+		if err := json.Unmarshal(previousChoicesJSON, &step.PreviousChoices); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal previous choices: %w", err)
+		}
+		steps = append(steps, step)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error reading story progress: %w", err)
+	}
+
+	log.Printf("[Repo] ListStoryPathSteps - found %d steps for NovelID: %s", len(steps), novelID)
+	return steps, nil
+}
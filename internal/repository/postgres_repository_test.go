@@ -0,0 +1,55 @@
+package repository_test
+
+import (
+	"context"
+	"novel-server/internal/database"
+	"novel-server/internal/domain"
+	"novel-server/internal/repository"
+	"novel-server/internal/repository/repotest"
+	"os"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// postgresDSNEnv - переменная окружения со строкой подключения к тестовой базе PostgreSQL.
+// Без нее проверки PostgreSQL пропускаются. Проверки применяют миграции и оставляют
+// свои данные в базе, поэтому база должна быть отдельной.
+const postgresDSNEnv = "REPOTEST_POSTGRES_DSN"
+
+// openTestPostgres подключается к тестовой базе PostgreSQL и применяет к ней миграции
+func openTestPostgres(t *testing.T) *pgxpool.Pool {
+	t.Helper()
+	dsn := os.Getenv(postgresDSNEnv)
+	if dsn == "" {
+		t.Skipf("%s is not set", postgresDSNEnv)
+	}
+	ctx := context.Background()
+
+	pool, err := pgxpool.New(ctx, dsn)
+	if err != nil {
+		t.Fatalf("pgxpool.New: %v", err)
+	}
+	t.Cleanup(pool.Close)
+
+	if err := database.RunMigrations(ctx, pool, "../../migrations"); err != nil {
+		t.Fatalf("RunMigrations: %v", err)
+	}
+	return pool
+}
+
+func TestPostgresNovelRepository(t *testing.T) {
+	pool := openTestPostgres(t)
+	repotest.RunNovelRepositorySuite(t, func(t *testing.T) repository.NovelRepository {
+		repo := repository.NewPostgresNovelRepository(pool)
+		t.Cleanup(repo.Close)
+		return repo
+	})
+}
+
+func TestPostgresNovelDraftRepository(t *testing.T) {
+	pool := openTestPostgres(t)
+	repotest.RunNovelDraftRepositorySuite(t, func(t *testing.T) domain.NovelDraftRepository {
+		return repository.NewPostgresNovelDraftRepository(pool)
+	})
+}
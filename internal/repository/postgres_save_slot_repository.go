@@ -0,0 +1,133 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"novel-server/internal/domain"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// PostgresSaveSlotRepository реализация SaveSlotRepository для PostgreSQL
+type PostgresSaveSlotRepository struct {
+	pool *pgxpool.Pool
+}
+
+// NewPostgresSaveSlotRepository создает новый экземпляр PostgresSaveSlotRepository
+func NewPostgresSaveSlotRepository(pool *pgxpool.Pool) *PostgresSaveSlotRepository {
+	return &PostgresSaveSlotRepository{
+		pool: pool,
+	}
+}
+
+// saveSlotColumns - список колонок без прогресса в порядке, ожидаемом scanSaveSlot
+const saveSlotColumns = `slot_id, novel_id, user_id, name, scene_index, created_at, updated_at`
+
+// scanSaveSlot сканирует строку с колонками saveSlotColumns
+func scanSaveSlot(row pgx.Row) (*domain.SaveSlot, error) {
+	var slot domain.SaveSlot
+	err := row.Scan(&slot.SlotID, &slot.NovelID, &slot.UserID, &slot.Name, &slot.SceneIndex, &slot.CreatedAt, &slot.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &slot, nil
+}
+
+// UpsertSaveSlot сохраняет слот, перезаписывая слот с тем же именем
+func (r *PostgresSaveSlotRepository) UpsertSaveSlot(ctx context.Context, slot *domain.SaveSlot) (*domain.SaveSlot, error) {
+	log.Printf("[SaveSlotRepo] UpsertSaveSlot - NovelID: %s, UserID: %s, Name: %s, SceneIndex: %d",
+		slot.NovelID, slot.UserID, slot.Name, slot.SceneIndex)
+
+	progressJSON, err := json.Marshal(slot.Progress)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal save slot progress: %w", err)
+	}
+
+	query := `
+		INSERT INTO save_slots (novel_id, user_id, name, scene_index, progress)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (novel_id, user_id, name) DO UPDATE
+		SET scene_index = EXCLUDED.scene_index,
+			progress = EXCLUDED.progress
+		RETURNING ` + saveSlotColumns
+
+	saved, err := scanSaveSlot(r.pool.QueryRow(ctx, query, slot.NovelID, slot.UserID, slot.Name, slot.SceneIndex, progressJSON))
+	if err != nil {
+		log.Printf("[SaveSlotRepo] UpsertSaveSlot - Error: %v", err)
+		return nil, fmt.Errorf("failed to save slot: %w", err)
+	}
+	saved.Progress = slot.Progress
+	return saved, nil
+}
+
+// ListSaveSlots возвращает сохранения пользователя в новелле, новые первыми
+func (r *PostgresSaveSlotRepository) ListSaveSlots(ctx context.Context, novelID uuid.UUID, userID string) ([]domain.SaveSlot, error) {
+	query := `
+		SELECT ` + saveSlotColumns + `
+		FROM save_slots
+		WHERE novel_id = $1 AND user_id = $2
+		ORDER BY updated_at DESC`
+
+	rows, err := r.pool.Query(ctx, query, novelID, userID)
+	if err != nil {
+		log.Printf("[SaveSlotRepo] ListSaveSlots - Error: %v", err)
+		return nil, fmt.Errorf("failed to list save slots: %w", err)
+	}
+	defer rows.Close()
+
+	slots := []domain.SaveSlot{}
+	for rows.Next() {
+		slot, err := scanSaveSlot(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan save slot: %w", err)
+		}
+		slots = append(slots, *slot)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error reading save slots: %w", err)
+	}
+	return slots, nil
+}
+
+// GetSaveSlot возвращает сохранение вместе с прогрессом
+func (r *PostgresSaveSlotRepository) GetSaveSlot(ctx context.Context, novelID uuid.UUID, userID string, slotID uuid.UUID) (*domain.SaveSlot, error) {
+	query := `
+		SELECT ` + saveSlotColumns + `, progress
+		FROM save_slots
+		WHERE slot_id = $1 AND novel_id = $2 AND user_id = $3`
+
+	var slot domain.SaveSlot
+	var progressJSON []byte
+	err := r.pool.QueryRow(ctx, query, slotID, novelID, userID).Scan(&slot.SlotID, &slot.NovelID, &slot.UserID,
+		&slot.Name, &slot.SceneIndex, &slot.CreatedAt, &slot.UpdatedAt, &progressJSON)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		log.Printf("[SaveSlotRepo] GetSaveSlot - Error: %v", err)
+		return nil, fmt.Errorf("failed to get save slot: %w", err)
+	}
+	if err := json.Unmarshal(progressJSON, &slot.Progress); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal save slot progress: %w", err)
+	}
+	return &slot, nil
+}
+
+// DeleteSaveSlot удаляет сохранение
+func (r *PostgresSaveSlotRepository) DeleteSaveSlot(ctx context.Context, novelID uuid.UUID, userID string, slotID uuid.UUID) error {
+	tag, err := r.pool.Exec(ctx, `DELETE FROM save_slots WHERE slot_id = $1 AND novel_id = $2 AND user_id = $3`,
+		slotID, novelID, userID)
+	if err != nil {
+		log.Printf("[SaveSlotRepo] DeleteSaveSlot - Error: %v", err)
+		return fmt.Errorf("failed to delete save slot: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
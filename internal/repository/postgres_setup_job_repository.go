@@ -0,0 +1,234 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"novel-server/internal/domain"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// PostgresSetupJobRepository реализация SetupJobRepository для PostgreSQL
+type PostgresSetupJobRepository struct {
+	pool *pgxpool.Pool
+}
+
+// NewPostgresSetupJobRepository создает новый экземпляр PostgresSetupJobRepository
+func NewPostgresSetupJobRepository(pool *pgxpool.Pool) *PostgresSetupJobRepository {
+	return &PostgresSetupJobRepository{
+		pool: pool,
+	}
+}
+
+// setupJobColumns - список колонок в порядке, ожидаемом scanSetupJob
+const setupJobColumns = `job_id, novel_id, user_id, status, attempts, max_attempts,
+	COALESCE(last_error, ''), run_after, locked_at, created_at, updated_at`
+
+// scanSetupJob сканирует строку с колонками setupJobColumns
+func scanSetupJob(row pgx.Row) (*domain.SetupJob, error) {
+	var job domain.SetupJob
+	err := row.Scan(&job.JobID, &job.NovelID, &job.UserID, &job.Status, &job.Attempts, &job.MaxAttempts,
+		&job.LastError, &job.RunAfter, &job.LockedAt, &job.CreatedAt, &job.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// EnqueueSetupJob ставит сетап новеллы в очередь
+func (r *PostgresSetupJobRepository) EnqueueSetupJob(ctx context.Context, novelID uuid.UUID, userID string, maxAttempts int) (*domain.SetupJob, error) {
+	log.Printf("[SetupJobRepo] EnqueueSetupJob - NovelID: %s, UserID: %s", novelID, userID)
+
+	// DO UPDATE без изменений нужен, чтобы RETURNING вернул уже существующую строку
+	query := `
+		INSERT INTO novel_setup_jobs (novel_id, user_id, max_attempts)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (novel_id) DO UPDATE SET novel_id = EXCLUDED.novel_id
+		RETURNING ` + setupJobColumns
+
+	job, err := scanSetupJob(r.pool.QueryRow(ctx, query, novelID, userID, maxAttempts))
+	if err != nil {
+		log.Printf("[SetupJobRepo] EnqueueSetupJob - Error: %v", err)
+		return nil, fmt.Errorf("failed to enqueue setup job: %w", err)
+	}
+	return job, nil
+}
+
+// ClaimNextSetupJob забирает следующую задачу. FOR UPDATE SKIP LOCKED позволяет
+// нескольким воркерам (и нескольким экземплярам сервера) не брать одну задачу дважды.
+func (r *PostgresSetupJobRepository) ClaimNextSetupJob(ctx context.Context) (*domain.SetupJob, error) {
+	query := `
+		UPDATE novel_setup_jobs
+		SET status = 'running', attempts = attempts + 1, locked_at = NOW()
+		WHERE job_id = (
+			SELECT job_id FROM novel_setup_jobs
+			WHERE status = 'queued' AND run_after <= NOW()
+			ORDER BY run_after
+			FOR UPDATE SKIP LOCKED
+			LIMIT 1
+		)
+		RETURNING ` + setupJobColumns
+
+	job, err := scanSetupJob(r.pool.QueryRow(ctx, query))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim setup job: %w", err)
+	}
+	log.Printf("[SetupJobRepo] ClaimNextSetupJob - Claimed job %s for NovelID: %s (attempt %d/%d)",
+		job.JobID, job.NovelID, job.Attempts, job.MaxAttempts)
+	return job, nil
+}
+
+// CompleteSetupJob помечает задачу выполненной
+func (r *PostgresSetupJobRepository) CompleteSetupJob(ctx context.Context, jobID uuid.UUID) error {
+	query := `
+		UPDATE novel_setup_jobs
+		SET status = 'done', last_error = NULL, locked_at = NULL
+		WHERE job_id = $1
+	`
+	if _, err := r.pool.Exec(ctx, query, jobID); err != nil {
+		return fmt.Errorf("failed to complete setup job: %w", err)
+	}
+	return nil
+}
+
+// FailSetupJob записывает ошибку попытки и либо планирует повтор, либо помечает задачу упавшей
+func (r *PostgresSetupJobRepository) FailSetupJob(ctx context.Context, jobID uuid.UUID, lastError string, retryAt *time.Time) error {
+	var err error
+	if retryAt != nil {
+		query := `
+			UPDATE novel_setup_jobs
+			SET status = 'queued', last_error = $2, run_after = $3, locked_at = NULL
+			WHERE job_id = $1
+		`
+		_, err = r.pool.Exec(ctx, query, jobID, lastError, *retryAt)
+	} else {
+		query := `
+			UPDATE novel_setup_jobs
+			SET status = 'failed', last_error = $2, locked_at = NULL
+			WHERE job_id = $1
+		`
+		_, err = r.pool.Exec(ctx, query, jobID, lastError)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to record setup job failure: %w", err)
+	}
+	return nil
+}
+
+// GetSetupJobByNovelID возвращает задачу новеллы
+func (r *PostgresSetupJobRepository) GetSetupJobByNovelID(ctx context.Context, novelID uuid.UUID) (*domain.SetupJob, error) {
+	query := `SELECT ` + setupJobColumns + ` FROM novel_setup_jobs WHERE novel_id = $1`
+
+	job, err := scanSetupJob(r.pool.QueryRow(ctx, query, novelID))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to get setup job: %w", err)
+	}
+	return job, nil
+}
+
+// ListUnfinishedSetupJobs возвращает незавершенные задачи пользователя, новые первыми
+func (r *PostgresSetupJobRepository) ListUnfinishedSetupJobs(ctx context.Context, userID string) ([]domain.SetupJob, error) {
+	query := `
+		SELECT ` + setupJobColumns + `
+		FROM novel_setup_jobs
+		WHERE user_id = $1 AND status <> 'done'
+		ORDER BY created_at DESC
+	`
+
+	rows, err := r.pool.Query(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list setup jobs: %w", err)
+	}
+	defer rows.Close()
+
+	jobs := []domain.SetupJob{}
+	for rows.Next() {
+		job, err := scanSetupJob(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan setup job: %w", err)
+		}
+		jobs = append(jobs, *job)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate setup jobs: %w", err)
+	}
+	return jobs, nil
+}
+
+// ListFailedSetupJobs возвращает упавшие задачи всех пользователей вместе с названием новеллы
+func (r *PostgresSetupJobRepository) ListFailedSetupJobs(ctx context.Context, limit int) ([]domain.FailedSetupJob, error) {
+	query := `
+		SELECT ` + setupJobColumns + `,
+			(SELECT n.title FROM novels n WHERE n.novel_id = novel_setup_jobs.novel_id)
+		FROM novel_setup_jobs
+		WHERE status = 'failed'
+		ORDER BY updated_at DESC
+		LIMIT $1
+	`
+
+	rows, err := r.pool.Query(ctx, query, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list failed setup jobs: %w", err)
+	}
+	defer rows.Close()
+
+	jobs := []domain.FailedSetupJob{}
+	for rows.Next() {
+		var job domain.FailedSetupJob
+		err := rows.Scan(&job.JobID, &job.NovelID, &job.UserID, &job.Status, &job.Attempts, &job.MaxAttempts,
+			&job.LastError, &job.RunAfter, &job.LockedAt, &job.CreatedAt, &job.UpdatedAt, &job.NovelTitle)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan setup job: %w", err)
+		}
+		jobs = append(jobs, job)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate setup jobs: %w", err)
+	}
+	return jobs, nil
+}
+
+// RetrySetupJob возвращает упавшую задачу в очередь
+func (r *PostgresSetupJobRepository) RetrySetupJob(ctx context.Context, novelID uuid.UUID) (*domain.SetupJob, error) {
+	query := `
+		UPDATE novel_setup_jobs
+		SET status = 'queued', attempts = 0, run_after = NOW(), locked_at = NULL
+		WHERE novel_id = $1 AND status = 'failed'
+		RETURNING ` + setupJobColumns
+
+	job, err := scanSetupJob(r.pool.QueryRow(ctx, query, novelID))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to retry setup job: %w", err)
+	}
+	log.Printf("[SetupJobRepo] RetrySetupJob - Requeued failed job %s for NovelID: %s", job.JobID, novelID)
+	return job, nil
+}
+
+// RequeueStaleSetupJobs возвращает в очередь зависшие задачи
+func (r *PostgresSetupJobRepository) RequeueStaleSetupJobs(ctx context.Context, staleAfter time.Duration) (int, error) {
+	query := `
+		UPDATE novel_setup_jobs
+		SET status = 'queued', run_after = NOW(), locked_at = NULL,
+			last_error = COALESCE(last_error, 'worker stopped before finishing the job')
+		WHERE status = 'running' AND locked_at < NOW() - $1::interval
+	`
+	tag, err := r.pool.Exec(ctx, query, fmt.Sprintf("%d seconds", int(staleAfter.Seconds())))
+	if err != nil {
+		return 0, fmt.Errorf("failed to requeue stale setup jobs: %w", err)
+	}
+	return int(tag.RowsAffected()), nil
+}
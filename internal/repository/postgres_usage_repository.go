@@ -0,0 +1,112 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"novel-server/internal/domain"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// PostgresUsageRepository реализация UsageRepository для PostgreSQL
+type PostgresUsageRepository struct {
+	pool *pgxpool.Pool
+}
+
+// NewPostgresUsageRepository создает новый экземпляр PostgresUsageRepository
+func NewPostgresUsageRepository(pool *pgxpool.Pool) *PostgresUsageRepository {
+	return &PostgresUsageRepository{
+		pool: pool,
+	}
+}
+
+// usageGroupKeys - выражения ключа группировки для SummarizeLLMUsage
+var usageGroupKeys = map[string]string{
+	domain.LLMUsageByUser:  `user_id`,
+	domain.LLMUsageByNovel: `COALESCE(novel_id::text, '')`,
+	domain.LLMUsageByDay:   `to_char(created_at AT TIME ZONE 'UTC', 'YYYY-MM-DD')`,
+}
+
+// RecordLLMUsage сохраняет запись об одном вызове модели
+func (r *PostgresUsageRepository) RecordLLMUsage(ctx context.Context, usage *domain.LLMUsage) error {
+	query := `
+		INSERT INTO llm_usage (user_id, novel_id, operation, provider, model,
+			prompt_tokens, completion_tokens, total_tokens, cost, latency_ms)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		RETURNING usage_id, created_at`
+
+	err := r.pool.QueryRow(ctx, query, usage.UserID, usage.NovelID, usage.Operation, usage.Provider, usage.Model,
+		usage.PromptTokens, usage.CompletionTokens, usage.TotalTokens, usage.Cost, usage.LatencyMs).
+		Scan(&usage.UsageID, &usage.CreatedAt)
+	if err != nil {
+		log.Printf("[UsageRepo] RecordLLMUsage - Error: %v", err)
+		return fmt.Errorf("failed to record llm usage: %w", err)
+	}
+	return nil
+}
+
+// SummarizeLLMUsage возвращает агрегаты использования модели за период
+func (r *PostgresUsageRepository) SummarizeLLMUsage(ctx context.Context, groupBy string, filter domain.LLMUsageFilter) ([]domain.LLMUsageSummary, error) {
+	key, ok := usageGroupKeys[groupBy]
+	if !ok {
+		return nil, fmt.Errorf("unknown usage grouping %q", groupBy)
+	}
+
+	orderBy := `SUM(total_tokens) DESC, key`
+	if groupBy == domain.LLMUsageByDay {
+		orderBy = `key`
+	}
+
+	// Пустые фильтры пользователя и новеллы отключаются через проверку параметра на NULL/пустоту
+	query := `
+		SELECT ` + key + ` AS key,
+			COUNT(*),
+			COALESCE(SUM(prompt_tokens), 0),
+			COALESCE(SUM(completion_tokens), 0),
+			COALESCE(SUM(total_tokens), 0),
+			COALESCE(SUM(cost), 0)::float8,
+			COALESCE(AVG(latency_ms), 0)::bigint
+		FROM llm_usage
+		WHERE created_at >= $1 AND created_at < $2
+			AND ($3 = '' OR user_id = $3)
+			AND ($4::uuid IS NULL OR novel_id = $4)
+		GROUP BY key
+		ORDER BY ` + orderBy + `
+		LIMIT $5`
+
+	rows, err := r.pool.Query(ctx, query, filter.From, filter.To, filter.UserID, filter.NovelID, filter.Limit)
+	if err != nil {
+		log.Printf("[UsageRepo] SummarizeLLMUsage - Error: %v", err)
+		return nil, fmt.Errorf("failed to summarize llm usage: %w", err)
+	}
+	defer rows.Close()
+
+	summaries := []domain.LLMUsageSummary{}
+	for rows.Next() {
+		var summary domain.LLMUsageSummary
+		if err := rows.Scan(&summary.Key, &summary.Calls, &summary.PromptTokens, &summary.CompletionTokens,
+			&summary.TotalTokens, &summary.Cost, &summary.AvgLatencyMs); err != nil {
+			return nil, fmt.Errorf("failed to scan llm usage summary: %w", err)
+		}
+		summaries = append(summaries, summary)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error reading llm usage summary: %w", err)
+	}
+	return summaries, nil
+}
+
+// CountUserTokens возвращает число токенов, израсходованных пользователем начиная с from
+func (r *PostgresUsageRepository) CountUserTokens(ctx context.Context, userID string, from time.Time) (int64, error) {
+	var total int64
+	err := r.pool.QueryRow(ctx,
+		`SELECT COALESCE(SUM(total_tokens), 0) FROM llm_usage WHERE user_id = $1 AND created_at >= $2`,
+		userID, from).Scan(&total)
+	if err != nil {
+		log.Printf("[UsageRepo] CountUserTokens - Error: %v", err)
+		return 0, fmt.Errorf("failed to count user tokens: %w", err)
+	}
+	return total, nil
+}
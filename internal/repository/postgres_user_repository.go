@@ -0,0 +1,259 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"novel-server/internal/domain"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// uniqueViolation - код ошибки PostgreSQL при нарушении ограничения уникальности
+const uniqueViolation = "23505"
+
+// PostgresUserRepository реализация UserRepository для PostgreSQL
+type PostgresUserRepository struct {
+	pool *pgxpool.Pool
+}
+
+// NewPostgresUserRepository создает новый экземпляр PostgresUserRepository
+func NewPostgresUserRepository(pool *pgxpool.Pool) *PostgresUserRepository {
+	return &PostgresUserRepository{
+		pool: pool,
+	}
+}
+
+// userColumns - список колонок в порядке, ожидаемом scanUser
+const userColumns = `user_id, username, password_hash, role, disabled_at, created_at, updated_at`
+
+// scanUser сканирует строку с колонками userColumns
+func scanUser(row pgx.Row) (*domain.User, error) {
+	var user domain.User
+	err := row.Scan(&user.UserID, &user.Username, &user.PasswordHash, &user.Role, &user.DisabledAt, &user.CreatedAt, &user.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// refreshTokenColumns - список колонок в порядке, ожидаемом scanRefreshToken
+const refreshTokenColumns = `token_id, user_id, family_id, expires_at, revoked_at, created_at`
+
+// scanRefreshToken сканирует строку с колонками refreshTokenColumns
+func scanRefreshToken(row pgx.Row) (*domain.RefreshToken, error) {
+	var token domain.RefreshToken
+	err := row.Scan(&token.TokenID, &token.UserID, &token.FamilyID, &token.ExpiresAt, &token.RevokedAt, &token.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+// CreateUser создает учетную запись
+func (r *PostgresUserRepository) CreateUser(ctx context.Context, user *domain.User) error {
+	log.Printf("[UserRepo] CreateUser - Username: %s", user.Username)
+
+	query := `
+		INSERT INTO users (username, password_hash, role)
+		VALUES ($1, $2, $3)
+		RETURNING user_id, created_at, updated_at`
+
+	err := r.pool.QueryRow(ctx, query, user.Username, user.PasswordHash, user.Role).Scan(&user.UserID, &user.CreatedAt, &user.UpdatedAt)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == uniqueViolation {
+			return ErrAlreadyExists
+		}
+		log.Printf("[UserRepo] CreateUser - Error: %v", err)
+		return fmt.Errorf("failed to create user: %w", err)
+	}
+	return nil
+}
+
+// GetUserByUsername ищет учетную запись по логину без учета регистра
+func (r *PostgresUserRepository) GetUserByUsername(ctx context.Context, username string) (*domain.User, error) {
+	query := `SELECT ` + userColumns + ` FROM users WHERE LOWER(username) = LOWER($1)`
+
+	user, err := scanUser(r.pool.QueryRow(ctx, query, username))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		log.Printf("[UserRepo] GetUserByUsername - Error: %v", err)
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+	return user, nil
+}
+
+// GetUserByID возвращает учетную запись по ID
+func (r *PostgresUserRepository) GetUserByID(ctx context.Context, userID uuid.UUID) (*domain.User, error) {
+	query := `SELECT ` + userColumns + ` FROM users WHERE user_id = $1`
+
+	user, err := scanUser(r.pool.QueryRow(ctx, query, userID))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		log.Printf("[UserRepo] GetUserByID - Error: %v", err)
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+	return user, nil
+}
+
+// ListUsers возвращает учетные записи, новые первыми
+func (r *PostgresUserRepository) ListUsers(ctx context.Context, limit, offset int) ([]domain.User, error) {
+	query := `SELECT ` + userColumns + ` FROM users ORDER BY created_at DESC, user_id LIMIT $1 OFFSET $2`
+
+	rows, err := r.pool.Query(ctx, query, limit, offset)
+	if err != nil {
+		log.Printf("[UserRepo] ListUsers - Error: %v", err)
+		return nil, fmt.Errorf("failed to list users: %w", err)
+	}
+	defer rows.Close()
+
+	users := []domain.User{}
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan user: %w", err)
+		}
+		users = append(users, *user)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error reading users: %w", err)
+	}
+	return users, nil
+}
+
+// SetUserRole меняет роль учетной записи
+func (r *PostgresUserRepository) SetUserRole(ctx context.Context, userID uuid.UUID, role string) error {
+	log.Printf("[UserRepo] SetUserRole - UserID: %s, Role: %s", userID, role)
+
+	tag, err := r.pool.Exec(ctx, `UPDATE users SET role = $2 WHERE user_id = $1`, userID, role)
+	if err != nil {
+		log.Printf("[UserRepo] SetUserRole - Error: %v", err)
+		return fmt.Errorf("failed to set user role: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// SetUserDisabled блокирует или разблокирует учетную запись.
+// При блокировке в той же транзакции отзываются все refresh-токены пользователя.
+func (r *PostgresUserRepository) SetUserDisabled(ctx context.Context, userID uuid.UUID, disabled bool) error {
+	log.Printf("[UserRepo] SetUserDisabled - UserID: %s, Disabled: %t", userID, disabled)
+
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	// Повторная блокировка не сдвигает время первой
+	query := `UPDATE users SET disabled_at = CASE WHEN $2 THEN COALESCE(disabled_at, NOW()) END WHERE user_id = $1`
+	tag, err := tx.Exec(ctx, query, userID, disabled)
+	if err != nil {
+		log.Printf("[UserRepo] SetUserDisabled - Error: %v", err)
+		return fmt.Errorf("failed to update user: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+
+	if disabled {
+		_, err = tx.Exec(ctx, `UPDATE refresh_tokens SET revoked_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL`, userID)
+		if err != nil {
+			log.Printf("[UserRepo] SetUserDisabled - Error revoking tokens: %v", err)
+			return fmt.Errorf("failed to revoke refresh tokens: %w", err)
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// CreateRefreshToken сохраняет хеш нового refresh-токена.
+// Заодно удаляет истекшие токены пользователя, чтобы таблица не росла.
+func (r *PostgresUserRepository) CreateRefreshToken(ctx context.Context, token *domain.RefreshToken, tokenHash string) error {
+	if _, err := r.pool.Exec(ctx, `DELETE FROM refresh_tokens WHERE user_id = $1 AND expires_at < NOW()`, token.UserID); err != nil {
+		log.Printf("[UserRepo] CreateRefreshToken - Warning: failed to delete expired tokens: %v", err)
+	}
+
+	err := r.pool.QueryRow(ctx, insertRefreshTokenQuery, token.UserID, token.FamilyID, tokenHash, token.ExpiresAt).
+		Scan(&token.TokenID, &token.CreatedAt)
+	if err != nil {
+		log.Printf("[UserRepo] CreateRefreshToken - Error: %v", err)
+		return fmt.Errorf("failed to create refresh token: %w", err)
+	}
+	return nil
+}
+
+// insertRefreshTokenQuery сохраняет refresh-токен и возвращает его ID и время создания
+const insertRefreshTokenQuery = `
+	INSERT INTO refresh_tokens (user_id, family_id, token_hash, expires_at)
+	VALUES ($1, $2, $3, $4)
+	RETURNING token_id, created_at`
+
+// GetRefreshToken возвращает refresh-токен по хешу
+func (r *PostgresUserRepository) GetRefreshToken(ctx context.Context, tokenHash string) (*domain.RefreshToken, error) {
+	query := `SELECT ` + refreshTokenColumns + ` FROM refresh_tokens WHERE token_hash = $1`
+
+	token, err := scanRefreshToken(r.pool.QueryRow(ctx, query, tokenHash))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		log.Printf("[UserRepo] GetRefreshToken - Error: %v", err)
+		return nil, fmt.Errorf("failed to get refresh token: %w", err)
+	}
+	return token, nil
+}
+
+// RotateRefreshToken отзывает старый токен и сохраняет новый в одной транзакции
+func (r *PostgresUserRepository) RotateRefreshToken(ctx context.Context, oldTokenID uuid.UUID, next *domain.RefreshToken, nextHash string) error {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	tag, err := tx.Exec(ctx, `UPDATE refresh_tokens SET revoked_at = NOW() WHERE token_id = $1 AND revoked_at IS NULL`, oldTokenID)
+	if err != nil {
+		log.Printf("[UserRepo] RotateRefreshToken - Error revoking token: %v", err)
+		return fmt.Errorf("failed to revoke refresh token: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+
+	err = tx.QueryRow(ctx, insertRefreshTokenQuery, next.UserID, next.FamilyID, nextHash, next.ExpiresAt).
+		Scan(&next.TokenID, &next.CreatedAt)
+	if err != nil {
+		log.Printf("[UserRepo] RotateRefreshToken - Error creating token: %v", err)
+		return fmt.Errorf("failed to create refresh token: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// RevokeRefreshTokenFamily отзывает все действующие токены семейства
+func (r *PostgresUserRepository) RevokeRefreshTokenFamily(ctx context.Context, familyID uuid.UUID) error {
+	_, err := r.pool.Exec(ctx, `UPDATE refresh_tokens SET revoked_at = NOW() WHERE family_id = $1 AND revoked_at IS NULL`, familyID)
+	if err != nil {
+		log.Printf("[UserRepo] RevokeRefreshTokenFamily - Error: %v", err)
+		return fmt.Errorf("failed to revoke refresh tokens: %w", err)
+	}
+	return nil
+}
@@ -2,12 +2,21 @@ package repository
 
 import (
 	"context"
+	"errors"
 	"novel-server/internal/domain"
+	"time"
 
 	"github.com/google/uuid"
-	"github.com/jackc/pgx/v5/pgxpool"
 )
 
+// ErrAlreadyExists возвращается, когда запись нарушает ограничение уникальности
+// (например, логин уже занят).
+var ErrAlreadyExists = errors.New("already exists")
+
+// ErrNotFound возвращается, когда запрошенной записи нет. Каждая реализация
+// переводит в нее ошибку своего драйвера (pgx.ErrNoRows, sql.ErrNoRows).
+var ErrNotFound = errors.New("not found")
+
 // NovelRepository определяет методы для взаимодействия с хранилищем новелл.
 type NovelRepository interface {
 	// --- Novels ---
@@ -20,18 +29,42 @@ type NovelRepository interface {
 	GetNovelConfigByID(ctx context.Context, novelID uuid.UUID, userID string) (*domain.NovelConfig, error)
 	// ListNovelsByUser возвращает список метаданных новелл для указанного пользователя.
 	ListNovelsByUser(ctx context.Context, userID string, limit, offset int) ([]domain.NovelMetadata, error)
-	// ListNovels возвращает список новелл с пагинацией
-	ListNovels(ctx context.Context, userID string, limit int, cursor *uuid.UUID) ([]domain.NovelListItem, int, *uuid.UUID, error)
+	// ListNovels возвращает список новелл области scope (domain.NovelScope*) с пагинацией
+	// и прогрессом пользователя userID.
+	ListNovels(ctx context.Context, userID, scope string, limit int, cursor *uuid.UUID) ([]domain.NovelListItem, int, *uuid.UUID, error)
 	// GetNovelDetails возвращает детальную информацию о новелле, включая персонажей из сетапа
 	GetNovelDetails(ctx context.Context, novelID uuid.UUID) (*domain.NovelDetailsResponse, error)
 	// GetNovelIsAdult возвращает флаг is_adult_content для новеллы.
 	GetNovelIsAdult(ctx context.Context, novelID uuid.UUID) (bool, error)
-	// UpdateNovel(ctx context.Context, novelID uuid.UUID, userID string, title *string) error // Если понадобится редактирование
-	// DeleteNovel(ctx context.Context, novelID uuid.UUID, userID string) error // Если понадобится удаление
+	// UpdateNovel меняет название и (или) краткое описание новеллы; nil оставляет поле без изменений.
+	// Возвращает ErrNotFound, если у ownerID такой новеллы нет.
+	UpdateNovel(ctx context.Context, novelID uuid.UUID, ownerID string, title, shortDescription *string) error
+	// DeleteNovel удаляет новеллу вместе с состояниями, прогрессом, сохранениями и задачей сетапа.
+	// Возвращает ErrNotFound, если новеллы нет.
+	DeleteNovel(ctx context.Context, novelID uuid.UUID) error
+	// --- Видимость и ссылки ---
+	// GetNovelAccess возвращает владельца и видимость новеллы и сообщает, открывал ли userID ссылку на нее.
+	// Возвращает ErrNotFound, если новеллы нет.
+	GetNovelAccess(ctx context.Context, novelID uuid.UUID, userID string) (*domain.NovelAccess, error)
+	// SetNovelVisibility меняет видимость новеллы. Возвращает ErrNotFound, если у ownerID такой новеллы нет.
+	SetNovelVisibility(ctx context.Context, novelID uuid.UUID, ownerID, visibility string) error
+	// SetNovelShareToken задает токен ссылки на новеллу; пустой token отключает ссылку и отзывает доступ
+	// всех, кто ее открывал. Возвращает ErrNotFound, если у ownerID такой новеллы нет.
+	SetNovelShareToken(ctx context.Context, novelID uuid.UUID, ownerID, token string) error
+	// GetNovelByShareToken возвращает ID и видимость новеллы по токену ссылки.
+	// Возвращает ErrNotFound, если ссылки нет.
+	GetNovelByShareToken(ctx context.Context, token string) (uuid.UUID, string, error)
+	// GrantNovelAccess запоминает, что userID открыл ссылку на новеллу.
+	GrantNovelAccess(ctx context.Context, novelID uuid.UUID, userID string) error
+
+	// SetNovelOwner передает новеллу (и ее задачу сетапа) пользователю userID.
+	// Возвращает ErrNotFound, если новеллы нет.
+	SetNovelOwner(ctx context.Context, novelID uuid.UUID, userID string) error
 
 	// --- Novel States ---
 	// SaveNovelState сохраняет состояние новеллы (stateData) для определенной сцены,
-	// связывая его с stateHash. Параметр userID используется только для обновления прогресса пользователя.
+	// связывая его с stateHash. Параметр userID используется только для обновления прогресса пользователя;
+	// состояние и прогресс сохраняются атомарно.
 	SaveNovelState(ctx context.Context, novelID uuid.UUID, sceneIndex int, userID string, stateHash string, stateData []byte) error
 
 	// GetLatestNovelState возвращает самое последнее сохраненное состояние новеллы (stateData)
@@ -39,7 +72,7 @@ type NovelRepository interface {
 	GetLatestNovelState(ctx context.Context, novelID uuid.UUID, userID string) (stateData []byte, sceneIndex int, err error)
 
 	// GetNovelStateByHash возвращает состояние новеллы (stateData) по его хешу.
-	// Возвращает ошибку ErrNoRows, если состояние с таким хешом не найдено.
+	// Возвращает ошибку ErrNotFound, если состояние с таким хешом не найдено.
 	GetNovelStateByHash(ctx context.Context, stateHash string) (stateData []byte, err error)
 
 	// GetNovelStateBySceneIndex возвращает состояние новеллы (stateData) для определенного индекса сцены.
@@ -61,7 +94,7 @@ type NovelRepository interface {
 	// --- Методы для работы с динамическим прогрессом пользователя ---
 
 	// SaveUserStoryProgress сохраняет динамические элементы прогресса пользователя
-	// для конкретной сцены новеллы.
+	// для конкретной сцены новеллы и атомарно делает ее текущей, если она дальше текущей.
 	SaveUserStoryProgress(ctx context.Context, novelID uuid.UUID, sceneIndex int, userID string,
 		progress *domain.UserStoryProgress) error
 
@@ -73,8 +106,143 @@ type NovelRepository interface {
 	// Этот метод заменяет GetNovelStateByHash для новой схемы данных.
 	GetUserStoryProgressByHash(ctx context.Context, stateHash string) (*domain.UserStoryProgress, error)
 
-	// --- Низкоуровневый доступ ---
-	// DB возвращает пул соединений с базой данных для более низкоуровневых операций,
-	// которые не охвачены стандартными методами репозитория.
-	DB() *pgxpool.Pool
+	// GetUserStoryProgress возвращает прогресс пользователя для конкретной сцены.
+	// Возвращает ErrNotFound, если пользователь эту сцену не проходил.
+	GetUserStoryProgress(ctx context.Context, novelID uuid.UUID, userID string, sceneIndex int) (*domain.UserStoryProgress, error)
+
+	// ListUserStoryProgress возвращает прогресс пользователя по всем пройденным сценам
+	// в порядке индекса сцены.
+	ListUserStoryProgress(ctx context.Context, novelID uuid.UUID, userID string) ([]domain.UserStoryProgress, error)
+
+	// ReplaceUserStoryProgress атомарно заменяет весь прогресс пользователя в новелле на track
+	// и делает sceneIndex текущей сценой.
+	ReplaceUserStoryProgress(ctx context.Context, novelID uuid.UUID, userID string, sceneIndex int, track []domain.UserStoryProgress) error
+
+	// GetNovelState возвращает состояние новеллы (stateData) для сцены с указанным хешем.
+	// Возвращает ErrNotFound, если такого состояния нет.
+	GetNovelState(ctx context.Context, novelID uuid.UUID, sceneIndex int, stateHash string) (stateData []byte, err error)
+
+	// RewindUserProgress откатывает прогресс пользователя к сцене sceneIndex:
+	// удаляет прогресс всех последующих сцен и делает sceneIndex текущей сценой.
+	RewindUserProgress(ctx context.Context, novelID uuid.UUID, userID string, sceneIndex int) error
+
+	// DeleteUserProgress удаляет весь прогресс пользователя в новелле (сохранения остаются).
+	// Возвращает ErrNotFound, если прогресса нет.
+	DeleteUserProgress(ctx context.Context, novelID uuid.UUID, userID string) error
+
+	// --- Граф ветвлений ---
+
+	// ListNovelStateRefs возвращает индексы сцен и хеши всех сохраненных состояний новеллы.
+	ListNovelStateRefs(ctx context.Context, novelID uuid.UUID) ([]domain.StoryStateRef, error)
+
+	// ListStoryPathSteps возвращает шаги путей всех игроков новеллы,
+	// упорядоченные по пользователю и индексу сцены.
+	ListStoryPathSteps(ctx context.Context, novelID uuid.UUID) ([]domain.StoryPathStep, error)
+
+	// --- Транзакции ---
+
+	// WithTx выполняет fn как единицу работы: все записи через репозиторий tx фиксируются вместе,
+	// если fn вернула nil, и отменяются, если fn вернула ошибку (WithTx возвращает ее же).
+	// Внутри fn нужно обращаться только к tx. WithTx, вызванный у tx, выполняется в той же транзакции.
+	WithTx(ctx context.Context, fn func(tx NovelRepository) error) error
+
+	// --- Блокировки ---
+
+	// LockSceneGeneration выполняет fn, удерживая блокировку генерации ветки stateHash новеллы novelID:
+	// другие вызовы с теми же novelID и stateHash ждут ее освобождения. В PostgreSQL блокировка
+	// общая для всех серверов, работающих с базой. Хранилища одного процесса (SQLite, память)
+	// выполняют fn сразу - внутри процесса одинаковые генерации объединяет сервис.
+	LockSceneGeneration(ctx context.Context, novelID uuid.UUID, stateHash string, fn func(ctx context.Context) error) error
+}
+
+// SaveSlotRepository определяет методы для именованных сохранений прохождения.
+// Сохранение принадлежит пользователю; чужие сохранения методы не находят.
+type SaveSlotRepository interface {
+	// UpsertSaveSlot сохраняет слот. Слот с тем же именем в той же новелле перезаписывается.
+	UpsertSaveSlot(ctx context.Context, slot *domain.SaveSlot) (*domain.SaveSlot, error)
+	// ListSaveSlots возвращает сохранения пользователя в новелле без прогресса, новые первыми.
+	ListSaveSlots(ctx context.Context, novelID uuid.UUID, userID string) ([]domain.SaveSlot, error)
+	// GetSaveSlot возвращает сохранение вместе с прогрессом. Возвращает ErrNotFound, если его нет.
+	GetSaveSlot(ctx context.Context, novelID uuid.UUID, userID string, slotID uuid.UUID) (*domain.SaveSlot, error)
+	// DeleteSaveSlot удаляет сохранение. Возвращает ErrNotFound, если его нет.
+	DeleteSaveSlot(ctx context.Context, novelID uuid.UUID, userID string, slotID uuid.UUID) error
+}
+
+// UsageRepository определяет методы учета использования языковой модели.
+type UsageRepository interface {
+	// RecordLLMUsage сохраняет запись об одном вызове модели.
+	RecordLLMUsage(ctx context.Context, usage *domain.LLMUsage) error
+	// SummarizeLLMUsage возвращает агрегаты за период filter.From..filter.To, сгруппированные
+	// по groupBy (domain.LLMUsageBy*). Пользователи и новеллы упорядочены по убыванию расхода токенов,
+	// дни - по дате.
+	SummarizeLLMUsage(ctx context.Context, groupBy string, filter domain.LLMUsageFilter) ([]domain.LLMUsageSummary, error)
+	// CountUserTokens возвращает число токенов, израсходованных пользователем начиная с from.
+	CountUserTokens(ctx context.Context, userID string, from time.Time) (int64, error)
+}
+
+// QuotaRepository определяет методы для счетчиков квот пользователя.
+// Окно квоты задается временем его начала (например, началом суток).
+type QuotaRepository interface {
+	// ConsumeQuota атомарно увеличивает счетчик kind в окне windowStart, если он меньше limit.
+	// Возвращает новое значение счетчика и false, если лимит уже исчерпан (счетчик не меняется).
+	ConsumeQuota(ctx context.Context, userID, kind string, windowStart time.Time, limit int) (used int, ok bool, err error)
+	// GetQuotaUsage возвращает значение счетчика kind в окне windowStart (0, если запросов не было).
+	GetQuotaUsage(ctx context.Context, userID, kind string, windowStart time.Time) (int, error)
+}
+
+// UserRepository определяет методы для учетных записей и refresh-токенов.
+type UserRepository interface {
+	// CreateUser создает учетную запись и заполняет UserID и даты.
+	// Возвращает ErrAlreadyExists, если логин занят (без учета регистра).
+	CreateUser(ctx context.Context, user *domain.User) error
+	// GetUserByUsername ищет учетную запись по логину без учета регистра.
+	// Возвращает ErrNotFound, если ее нет.
+	GetUserByUsername(ctx context.Context, username string) (*domain.User, error)
+	// GetUserByID возвращает учетную запись. Возвращает ErrNotFound, если ее нет.
+	GetUserByID(ctx context.Context, userID uuid.UUID) (*domain.User, error)
+	// ListUsers возвращает учетные записи, новые первыми.
+	ListUsers(ctx context.Context, limit, offset int) ([]domain.User, error)
+	// SetUserRole меняет роль учетной записи. Возвращает ErrNotFound, если ее нет.
+	SetUserRole(ctx context.Context, userID uuid.UUID, role string) error
+	// SetUserDisabled блокирует или разблокирует учетную запись. Блокировка отзывает
+	// все refresh-токены пользователя. Возвращает ErrNotFound, если учетной записи нет.
+	SetUserDisabled(ctx context.Context, userID uuid.UUID, disabled bool) error
+
+	// CreateRefreshToken сохраняет хеш нового refresh-токена и заполняет TokenID и CreatedAt.
+	CreateRefreshToken(ctx context.Context, token *domain.RefreshToken, tokenHash string) error
+	// GetRefreshToken возвращает refresh-токен по хешу, в том числе отозванный или истекший.
+	// Возвращает ErrNotFound, если его нет.
+	GetRefreshToken(ctx context.Context, tokenHash string) (*domain.RefreshToken, error)
+	// RotateRefreshToken атомарно отзывает действующий токен oldTokenID и сохраняет next.
+	// Возвращает ErrNotFound, если старый токен уже отозван (например, параллельным обновлением).
+	RotateRefreshToken(ctx context.Context, oldTokenID uuid.UUID, next *domain.RefreshToken, nextHash string) error
+	// RevokeRefreshTokenFamily отзывает все действующие токены семейства.
+	RevokeRefreshTokenFamily(ctx context.Context, familyID uuid.UUID) error
+}
+
+// SetupJobRepository определяет методы для очереди задач генерации сетапа новелл.
+// На каждую новеллу приходится не больше одной задачи.
+type SetupJobRepository interface {
+	// EnqueueSetupJob ставит сетап новеллы в очередь. Если задача уже есть, возвращает ее.
+	EnqueueSetupJob(ctx context.Context, novelID uuid.UUID, userID string, maxAttempts int) (*domain.SetupJob, error)
+	// ClaimNextSetupJob атомарно забирает следующую готовую к запуску задачу,
+	// переводя ее в running и увеличивая счетчик попыток. Возвращает nil, nil, если задач нет.
+	ClaimNextSetupJob(ctx context.Context) (*domain.SetupJob, error)
+	// CompleteSetupJob помечает задачу выполненной.
+	CompleteSetupJob(ctx context.Context, jobID uuid.UUID) error
+	// FailSetupJob записывает ошибку попытки. Если retryAt не nil, задача возвращается
+	// в очередь и будет запущена не раньше retryAt, иначе переходит в failed.
+	FailSetupJob(ctx context.Context, jobID uuid.UUID, lastError string, retryAt *time.Time) error
+	// GetSetupJobByNovelID возвращает задачу новеллы. Возвращает ErrNotFound, если задачи нет.
+	GetSetupJobByNovelID(ctx context.Context, novelID uuid.UUID) (*domain.SetupJob, error)
+	// ListUnfinishedSetupJobs возвращает незавершенные (не done) задачи пользователя.
+	ListUnfinishedSetupJobs(ctx context.Context, userID string) ([]domain.SetupJob, error)
+	// RetrySetupJob возвращает упавшую задачу в очередь со сброшенным счетчиком попыток.
+	// Возвращает ErrNotFound, если задачи в статусе failed нет.
+	RetrySetupJob(ctx context.Context, novelID uuid.UUID) (*domain.SetupJob, error)
+	// ListFailedSetupJobs возвращает задачи в статусе failed всех пользователей, последние первыми.
+	ListFailedSetupJobs(ctx context.Context, limit int) ([]domain.FailedSetupJob, error)
+	// RequeueStaleSetupJobs возвращает в очередь задачи, зависшие в running дольше staleAfter
+	// (например, после падения процесса). Возвращает число таких задач.
+	RequeueStaleSetupJobs(ctx context.Context, staleAfter time.Duration) (int, error)
 }
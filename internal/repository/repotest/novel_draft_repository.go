@@ -0,0 +1,270 @@
+package repotest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"novel-server/internal/domain"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+// RunNovelDraftRepositorySuite проверяет реализацию domain.NovelDraftRepository.
+// newRepo вызывается в начале каждой проверки.
+func RunNovelDraftRepositorySuite(t *testing.T, newRepo func(t *testing.T) domain.NovelDraftRepository) {
+	tests := []struct {
+		name string
+		run  func(t *testing.T, repo domain.NovelDraftRepository)
+	}{
+		{"SaveAndGetDraft", testSaveAndGetDraft},
+		{"ListDrafts", testListDrafts},
+		{"DraftRevisions", testDraftRevisions},
+		{"DeleteDraft", testDeleteDraft},
+		{"ConcurrentRevisions", testConcurrentRevisions},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.run(t, newRepo(t))
+		})
+	}
+}
+
+// draftConfigJSON возвращает сериализованный конфиг черновика
+func draftConfigJSON(t *testing.T, title, genre string) []byte {
+	t.Helper()
+	config := domain.NovelConfig{
+		Title:            title,
+		ShortDescription: "Описание " + title,
+		Franchise:        "Original",
+		Genre:            genre,
+		Language:         "Russian",
+	}
+	data, err := json.Marshal(config)
+	if err != nil {
+		t.Fatalf("marshal config: %v", err)
+	}
+	return data
+}
+
+// saveDraft сохраняет новый черновик пользователя userID
+func saveDraft(t *testing.T, repo domain.NovelDraftRepository, userID, title string) uuid.UUID {
+	t.Helper()
+	draftID := uuid.New()
+	if err := repo.SaveDraft(context.Background(), userID, draftID, draftConfigJSON(t, title, "fantasy"), "промпт "+title); err != nil {
+		t.Fatalf("SaveDraft: %v", err)
+	}
+	return draftID
+}
+
+func testSaveAndGetDraft(t *testing.T, repo domain.NovelDraftRepository) {
+	ctx := context.Background()
+	userID := newUserID()
+	draftID := saveDraft(t, repo, userID, "Черновик")
+
+	draft, err := repo.GetDraft(ctx, userID, draftID)
+	if err != nil {
+		t.Fatalf("GetDraft: %v", err)
+	}
+	if draft.DraftID != draftID || draft.UserID != userID || draft.Revision != 1 || draft.Config.Title != "Черновик" {
+		t.Fatalf("GetDraft = %+v", draft)
+	}
+
+	configJSON, err := repo.GetDraftConfigJSON(ctx, userID, draftID)
+	if err != nil {
+		t.Fatalf("GetDraftConfigJSON: %v", err)
+	}
+	var config domain.NovelConfig
+	if err := json.Unmarshal(configJSON, &config); err != nil || config.Genre != "fantasy" {
+		t.Fatalf("GetDraftConfigJSON = %s (%v)", configJSON, err)
+	}
+
+	// Чужой черновик не находится
+	_, err = repo.GetDraft(ctx, newUserID(), draftID)
+	wantNotFound(t, "GetDraft(other user)", err)
+	if _, err := repo.GetDraftConfigJSON(ctx, newUserID(), draftID); err == nil {
+		t.Fatal("GetDraftConfigJSON(other user): want error")
+	}
+	_, err = repo.GetDraft(ctx, userID, uuid.New())
+	wantNotFound(t, "GetDraft(unknown draft)", err)
+}
+
+func testListDrafts(t *testing.T, repo domain.NovelDraftRepository) {
+	ctx := context.Background()
+	userID := newUserID()
+	first := saveDraft(t, repo, userID, "Первый")
+	second := saveDraft(t, repo, userID, "Второй")
+	saveDraft(t, repo, newUserID(), "Чужой")
+
+	drafts, err := repo.ListDrafts(ctx, userID, 10, 0)
+	if err != nil {
+		t.Fatalf("ListDrafts: %v", err)
+	}
+	if len(drafts) != 2 || drafts[0].DraftID != second || drafts[1].DraftID != first {
+		t.Fatalf("ListDrafts = %+v, want both drafts of the user, newest first", drafts)
+	}
+	if drafts[1].Title != "Первый" || drafts[1].ShortDescription != "Описание Первый" || drafts[1].Genre != "fantasy" || drafts[1].Revision != 1 {
+		t.Fatalf("ListDrafts summary = %+v", drafts[1])
+	}
+
+	// Уточненный черновик поднимается в начало списка
+	revision := &domain.DraftRevision{Source: domain.DraftRevisionRefine, Prompt: "мрачнее"}
+	if err := repo.AppendDraftRevision(ctx, userID, first, draftConfigJSON(t, "Первый", "horror"), revision); err != nil {
+		t.Fatalf("AppendDraftRevision: %v", err)
+	}
+	drafts, err = repo.ListDrafts(ctx, userID, 1, 0)
+	if err != nil {
+		t.Fatalf("ListDrafts: %v", err)
+	}
+	if len(drafts) != 1 || drafts[0].DraftID != first || drafts[0].Genre != "horror" || drafts[0].Revision != 2 {
+		t.Fatalf("ListDrafts(limit 1) = %+v, want the refined draft", drafts)
+	}
+	drafts, err = repo.ListDrafts(ctx, userID, 10, 1)
+	if err != nil || len(drafts) != 1 || drafts[0].DraftID != second {
+		t.Fatalf("ListDrafts(offset 1) = (%+v, %v)", drafts, err)
+	}
+}
+
+func testDraftRevisions(t *testing.T, repo domain.NovelDraftRepository) {
+	ctx := context.Background()
+	userID := newUserID()
+	draftID := saveDraft(t, repo, userID, "Ревизии")
+
+	patch := json.RawMessage(`{"genre":"horror"}`)
+	refine := &domain.DraftRevision{Source: domain.DraftRevisionRefine, Prompt: "мрачнее", Patch: patch}
+	if err := repo.AppendDraftRevision(ctx, userID, draftID, draftConfigJSON(t, "Ревизии", "horror"), refine); err != nil {
+		t.Fatalf("AppendDraftRevision(refine): %v", err)
+	}
+	if refine.Revision != 2 || refine.DraftID != draftID || refine.CreatedAt.IsZero() {
+		t.Fatalf("AppendDraftRevision filled %+v, want revision 2 with creation time", refine)
+	}
+
+	restoredFrom := 1
+	rollback := &domain.DraftRevision{Source: domain.DraftRevisionRollback, RestoredFrom: &restoredFrom}
+	if err := repo.AppendDraftRevision(ctx, userID, draftID, draftConfigJSON(t, "Ревизии", "fantasy"), rollback); err != nil {
+		t.Fatalf("AppendDraftRevision(rollback): %v", err)
+	}
+	if rollback.Revision != 3 {
+		t.Fatalf("AppendDraftRevision(rollback) revision = %d, want 3", rollback.Revision)
+	}
+
+	wantNotFound(t, "AppendDraftRevision(other user)",
+		repo.AppendDraftRevision(ctx, newUserID(), draftID, draftConfigJSON(t, "Чужой", "fantasy"), &domain.DraftRevision{Source: domain.DraftRevisionRefine}))
+
+	revisions, err := repo.ListDraftRevisions(ctx, userID, draftID)
+	if err != nil {
+		t.Fatalf("ListDraftRevisions: %v", err)
+	}
+	if len(revisions) != 3 {
+		t.Fatalf("ListDraftRevisions = %d revisions, want 3", len(revisions))
+	}
+	sources := []string{domain.DraftRevisionCreate, domain.DraftRevisionRefine, domain.DraftRevisionRollback}
+	for i, v := range revisions {
+		if v.Revision != i+1 || v.Source != sources[i] || v.Config != nil {
+			t.Fatalf("ListDraftRevisions[%d] = %+v, want revision %d from %q without config", i, v, i+1, sources[i])
+		}
+	}
+	if revisions[0].Prompt != "промпт Ревизии" || revisions[0].Patch != nil {
+		t.Fatalf("ListDraftRevisions[0] = %+v, want the creation prompt and no patch", revisions[0])
+	}
+	if !sameJSON(t, revisions[1].Patch, patch) {
+		t.Fatalf("ListDraftRevisions[1] patch = %s, want %s", revisions[1].Patch, patch)
+	}
+	if revisions[2].RestoredFrom == nil || *revisions[2].RestoredFrom != 1 {
+		t.Fatalf("ListDraftRevisions[2] restored_from = %v, want 1", revisions[2].RestoredFrom)
+	}
+
+	v, err := repo.GetDraftRevision(ctx, userID, draftID, 2)
+	if err != nil {
+		t.Fatalf("GetDraftRevision: %v", err)
+	}
+	if v.Config == nil || v.Config.Genre != "horror" || v.Prompt != "мрачнее" {
+		t.Fatalf("GetDraftRevision(2) = %+v, want the refined config", v)
+	}
+	_, err = repo.GetDraftRevision(ctx, userID, draftID, 4)
+	wantNotFound(t, "GetDraftRevision(unknown revision)", err)
+	_, err = repo.GetDraftRevision(ctx, newUserID(), draftID, 1)
+	wantNotFound(t, "GetDraftRevision(other user)", err)
+
+	draft, err := repo.GetDraft(ctx, userID, draftID)
+	if err != nil || draft.Revision != 3 || draft.Config.Genre != "fantasy" {
+		t.Fatalf("GetDraft after rollback = (%+v, %v), want revision 3 with the restored config", draft, err)
+	}
+}
+
+// sameJSON сообщает, совпадают ли JSON-документы без учета форматирования
+func sameJSON(t *testing.T, a, b json.RawMessage) bool {
+	t.Helper()
+	var va, vb interface{}
+	if err := json.Unmarshal(a, &va); err != nil {
+		return false
+	}
+	if err := json.Unmarshal(b, &vb); err != nil {
+		t.Fatalf("unmarshal %s: %v", b, err)
+	}
+	return reflect.DeepEqual(va, vb)
+}
+
+func testDeleteDraft(t *testing.T, repo domain.NovelDraftRepository) {
+	ctx := context.Background()
+	userID := newUserID()
+	draftID := saveDraft(t, repo, userID, "Удаление")
+
+	wantNotFound(t, "DeleteDraft(other user)", repo.DeleteDraft(ctx, newUserID(), draftID))
+	if err := repo.DeleteDraft(ctx, userID, draftID); err != nil {
+		t.Fatalf("DeleteDraft: %v", err)
+	}
+	_, err := repo.GetDraft(ctx, userID, draftID)
+	wantNotFound(t, "GetDraft(deleted)", err)
+	_, err = repo.GetDraftRevision(ctx, userID, draftID, 1)
+	wantNotFound(t, "GetDraftRevision(deleted draft)", err)
+	revisions, err := repo.ListDraftRevisions(ctx, userID, draftID)
+	if err != nil || len(revisions) != 0 {
+		t.Fatalf("ListDraftRevisions(deleted draft) = (%+v, %v), want empty", revisions, err)
+	}
+	wantNotFound(t, "DeleteDraft(again)", repo.DeleteDraft(ctx, userID, draftID))
+}
+
+func testConcurrentRevisions(t *testing.T, repo domain.NovelDraftRepository) {
+	ctx := context.Background()
+	userID := newUserID()
+	draftID := saveDraft(t, repo, userID, "Гонка")
+
+	const refines = 8
+	configJSON := draftConfigJSON(t, "Гонка", "horror")
+	var wg sync.WaitGroup
+	numbers := make(chan int, refines)
+	errs := make(chan error, refines)
+	for i := 0; i < refines; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			revision := &domain.DraftRevision{Source: domain.DraftRevisionRefine, Prompt: fmt.Sprintf("уточнение %d", i)}
+			if err := repo.AppendDraftRevision(ctx, userID, draftID, configJSON, revision); err != nil {
+				errs <- err
+				return
+			}
+			numbers <- revision.Revision
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	close(numbers)
+	for err := range errs {
+		t.Fatalf("concurrent AppendDraftRevision: %v", err)
+	}
+
+	seen := make(map[int]bool)
+	for n := range numbers {
+		if seen[n] || n < 2 || n > refines+1 {
+			t.Fatalf("concurrent AppendDraftRevision returned revision %d twice or out of range", n)
+		}
+		seen[n] = true
+	}
+	draft, err := repo.GetDraft(ctx, userID, draftID)
+	if err != nil || draft.Revision != refines+1 {
+		t.Fatalf("GetDraft after concurrent refines = (%+v, %v), want revision %d", draft, err, refines+1)
+	}
+}
@@ -0,0 +1,788 @@
+// Пакет repotest содержит общие проверки реализаций репозиториев. Любая реализация
+// (PostgreSQL, SQLite, память) должна их проходить, поэтому сервисы могут работать с любой из них.
+//
+// Проверки не создают таблицы и не очищают хранилище: newRepo может возвращать
+// репозиторий поверх общей базы данных. Каждая проверка использует свои ID пользователей
+// и хеши состояний.
+package repotest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"novel-server/internal/domain"
+	"novel-server/internal/repository"
+	"sync"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+// RunNovelRepositorySuite проверяет реализацию repository.NovelRepository.
+// newRepo вызывается в начале каждой проверки.
+func RunNovelRepositorySuite(t *testing.T, newRepo func(t *testing.T) repository.NovelRepository) {
+	tests := []struct {
+		name string
+		run  func(t *testing.T, repo repository.NovelRepository)
+	}{
+		{"CreateNovel", testCreateNovel},
+		{"MissingNovel", testMissingNovel},
+		{"StateHashLookup", testStateHashLookup},
+		{"EarliestStatePerScene", testEarliestStatePerScene},
+		{"SetupStoredSeparately", testSetupStoredSeparately},
+		{"LatestNovelState", testLatestNovelState},
+		{"ProgressUpsert", testProgressUpsert},
+		{"UserStoryProgress", testUserStoryProgress},
+		{"RewindReplaceDeleteProgress", testRewindReplaceDeleteProgress},
+		{"VisibilityAndShareLinks", testVisibilityAndShareLinks},
+		{"ListNovels", testListNovels},
+		{"UpdateAndDeleteNovel", testUpdateAndDeleteNovel},
+		{"WithTx", testWithTx},
+		{"ConcurrentSaves", testConcurrentSaves},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.run(t, newRepo(t))
+		})
+	}
+}
+
+// newUserID возвращает ID пользователя, которого нет в хранилище
+func newUserID() string {
+	return "repotest-" + uuid.NewString()
+}
+
+// newStateHash возвращает хеш состояния, которого нет в хранилище
+func newStateHash() string {
+	return "repotest-" + uuid.NewString()
+}
+
+// createNovel создает новеллу пользователя userID
+func createNovel(t *testing.T, repo repository.NovelRepository, userID, title string) uuid.UUID {
+	t.Helper()
+	config := &domain.NovelConfig{
+		Title:            title,
+		ShortDescription: "Описание " + title,
+		Franchise:        "Original",
+		Genre:            "fantasy",
+		Language:         "Russian",
+		PlayerName:       "Алекс",
+	}
+	config.StoryConfig.Length = "short"
+	novelID, err := repo.CreateNovel(context.Background(), userID, config)
+	if err != nil {
+		t.Fatalf("CreateNovel: %v", err)
+	}
+	return novelID
+}
+
+// sceneState возвращает состояние сцены с индексом sceneIndex
+func sceneState(sceneIndex int, summary string) []byte {
+	data, _ := json.Marshal(map[string]interface{}{
+		"current_stage":       "scene",
+		"current_scene_index": sceneIndex,
+		"story_summary":       summary,
+	})
+	return data
+}
+
+// setupState возвращает сетап новеллы с одним персонажем
+func setupState(characterName string) []byte {
+	data, _ := json.Marshal(map[string]interface{}{
+		"current_stage": "setup",
+		"characters":    []map[string]string{{"name": characterName, "description": "Проводник"}},
+		"scenes":        []map[string]int{{"index": 0}},
+	})
+	return data
+}
+
+// summaryOf возвращает story_summary из состояния
+func summaryOf(t *testing.T, stateData []byte) string {
+	t.Helper()
+	var state struct {
+		StorySummary string `json:"story_summary"`
+	}
+	if err := json.Unmarshal(stateData, &state); err != nil {
+		t.Fatalf("unmarshal state: %v", err)
+	}
+	return state.StorySummary
+}
+
+// saveState сохраняет состояние сцены и проверяет отсутствие ошибки
+func saveState(t *testing.T, repo repository.NovelRepository, novelID uuid.UUID, sceneIndex int, userID, stateHash string, stateData []byte) {
+	t.Helper()
+	if err := repo.SaveNovelState(context.Background(), novelID, sceneIndex, userID, stateHash, stateData); err != nil {
+		t.Fatalf("SaveNovelState(scene %d): %v", sceneIndex, err)
+	}
+}
+
+// wantProgress проверяет индекс текущей сцены пользователя
+func wantProgress(t *testing.T, repo repository.NovelRepository, novelID uuid.UUID, userID string, want int) {
+	t.Helper()
+	got, err := repo.GetUserNovelProgress(context.Background(), novelID, userID)
+	if err != nil {
+		t.Fatalf("GetUserNovelProgress: %v", err)
+	}
+	if got != want {
+		t.Fatalf("GetUserNovelProgress = %d, want %d", got, want)
+	}
+}
+
+// wantNotFound проверяет, что err - repository.ErrNotFound
+func wantNotFound(t *testing.T, op string, err error) {
+	t.Helper()
+	if !errors.Is(err, repository.ErrNotFound) {
+		t.Fatalf("%s: error = %v, want repository.ErrNotFound", op, err)
+	}
+}
+
+func testCreateNovel(t *testing.T, repo repository.NovelRepository) {
+	ctx := context.Background()
+	owner := newUserID()
+	novelID := createNovel(t, repo, owner, "Лес")
+
+	meta, err := repo.GetNovelMetadataByID(ctx, novelID, owner)
+	if err != nil {
+		t.Fatalf("GetNovelMetadataByID: %v", err)
+	}
+	if meta.NovelID != novelID || meta.UserID != owner || meta.Title != "Лес" || meta.ShortDescription != "Описание Лес" {
+		t.Fatalf("GetNovelMetadataByID = %+v", meta)
+	}
+	_, err = repo.GetNovelMetadataByID(ctx, novelID, newUserID())
+	wantNotFound(t, "GetNovelMetadataByID(other user)", err)
+
+	config, err := repo.GetNovelConfigByID(ctx, novelID, owner)
+	if err != nil {
+		t.Fatalf("GetNovelConfigByID: %v", err)
+	}
+	if config.Title != "Лес" || config.Genre != "fantasy" || config.StoryConfig.Length != "short" {
+		t.Fatalf("GetNovelConfigByID = %+v", config)
+	}
+
+	access, err := repo.GetNovelAccess(ctx, novelID, owner)
+	if err != nil {
+		t.Fatalf("GetNovelAccess: %v", err)
+	}
+	if access.OwnerID != owner || access.Visibility != domain.VisibilityPrivate || access.Granted {
+		t.Fatalf("GetNovelAccess = %+v, want private novel of %s", access, owner)
+	}
+	_, err = repo.GetNovelAccess(ctx, uuid.New(), owner)
+	wantNotFound(t, "GetNovelAccess(unknown novel)", err)
+
+	if _, err := repo.CreateNovel(ctx, "", &domain.NovelConfig{Title: "Без автора"}); err == nil {
+		t.Fatal("CreateNovel with empty userID: want error")
+	}
+}
+
+// testMissingNovel проверяет, что чтение несуществующей новеллы возвращает repository.ErrNotFound
+func testMissingNovel(t *testing.T, repo repository.NovelRepository) {
+	ctx := context.Background()
+	novelID := uuid.New()
+
+	_, err := repo.GetNovelConfigByID(ctx, novelID, newUserID())
+	wantNotFound(t, "GetNovelConfigByID", err)
+	_, err = repo.GetNovelDetails(ctx, novelID)
+	wantNotFound(t, "GetNovelDetails", err)
+	_, err = repo.GetNovelIsAdult(ctx, novelID)
+	wantNotFound(t, "GetNovelIsAdult", err)
+}
+
+func testStateHashLookup(t *testing.T, repo repository.NovelRepository) {
+	ctx := context.Background()
+	userID := newUserID()
+	novelID := createNovel(t, repo, userID, "Хеши")
+	hash := newStateHash()
+
+	saveState(t, repo, novelID, 1, userID, hash, sceneState(1, "первая"))
+	// Повторное сохранение с тем же хешем не меняет состояние
+	saveState(t, repo, novelID, 1, userID, hash, sceneState(1, "вторая"))
+
+	data, err := repo.GetNovelStateByHash(ctx, hash)
+	if err != nil {
+		t.Fatalf("GetNovelStateByHash: %v", err)
+	}
+	if got := summaryOf(t, data); got != "первая" {
+		t.Fatalf("GetNovelStateByHash summary = %q, want %q", got, "первая")
+	}
+
+	data, err = repo.GetNovelState(ctx, novelID, 1, hash)
+	if err != nil {
+		t.Fatalf("GetNovelState: %v", err)
+	}
+	if got := summaryOf(t, data); got != "первая" {
+		t.Fatalf("GetNovelState summary = %q, want %q", got, "первая")
+	}
+
+	_, err = repo.GetNovelStateByHash(ctx, newStateHash())
+	wantNotFound(t, "GetNovelStateByHash(unknown hash)", err)
+	_, err = repo.GetNovelState(ctx, novelID, 2, hash)
+	wantNotFound(t, "GetNovelState(other scene)", err)
+
+	refs, err := repo.ListNovelStateRefs(ctx, novelID)
+	if err != nil {
+		t.Fatalf("ListNovelStateRefs: %v", err)
+	}
+	if len(refs) != 1 || refs[0] != (domain.StoryStateRef{SceneIndex: 1, StateHash: hash}) {
+		t.Fatalf("ListNovelStateRefs = %+v", refs)
+	}
+
+	if err := repo.SaveNovelState(ctx, uuid.New(), 1, userID, newStateHash(), sceneState(1, "сирота")); err == nil {
+		t.Fatal("SaveNovelState for unknown novel: want error")
+	}
+}
+
+func testEarliestStatePerScene(t *testing.T, repo repository.NovelRepository) {
+	ctx := context.Background()
+	novelID := createNovel(t, repo, newUserID(), "Ветвления")
+	first, second := newStateHash(), newStateHash()
+
+	saveState(t, repo, novelID, 1, newUserID(), first, sceneState(1, "первый игрок"))
+	saveState(t, repo, novelID, 1, newUserID(), second, sceneState(1, "второй игрок"))
+	saveState(t, repo, novelID, 2, newUserID(), newStateHash(), sceneState(2, "дальше"))
+
+	data, err := repo.GetNovelStateBySceneIndex(ctx, novelID, 1)
+	if err != nil {
+		t.Fatalf("GetNovelStateBySceneIndex: %v", err)
+	}
+	if got := summaryOf(t, data); got != "первый игрок" {
+		t.Fatalf("GetNovelStateBySceneIndex summary = %q, want the earliest state", got)
+	}
+	_, err = repo.GetNovelStateBySceneIndex(ctx, novelID, 5)
+	wantNotFound(t, "GetNovelStateBySceneIndex(unknown scene)", err)
+
+	refs, err := repo.ListNovelStateRefs(ctx, novelID)
+	if err != nil {
+		t.Fatalf("ListNovelStateRefs: %v", err)
+	}
+	if len(refs) != 3 || refs[0].SceneIndex != 1 || refs[1].SceneIndex != 1 || refs[2].SceneIndex != 2 {
+		t.Fatalf("ListNovelStateRefs = %+v, want 3 states ordered by scene", refs)
+	}
+	if refs[0].StateHash > refs[1].StateHash {
+		t.Fatalf("ListNovelStateRefs = %+v, want states of a scene ordered by hash", refs)
+	}
+}
+
+func testSetupStoredSeparately(t *testing.T, repo repository.NovelRepository) {
+	ctx := context.Background()
+	userID := newUserID()
+	novelID := createNovel(t, repo, userID, "Сетап")
+
+	_, err := repo.GetNovelSetupState(ctx, novelID)
+	wantNotFound(t, "GetNovelSetupState(before setup)", err)
+	if _, err := repo.GetNovelDetails(ctx, novelID); err == nil || err.Error() != "novel not setuped" {
+		t.Fatalf("GetNovelDetails before setup: error = %v, want \"novel not setuped\"", err)
+	}
+
+	saveState(t, repo, novelID, 0, userID, newStateHash(), setupState("Мира"))
+
+	data, err := repo.GetNovelSetupState(ctx, novelID)
+	if err != nil {
+		t.Fatalf("GetNovelSetupState: %v", err)
+	}
+	var setup domain.NovelState
+	if err := json.Unmarshal(data, &setup); err != nil {
+		t.Fatalf("unmarshal setup: %v", err)
+	}
+	if setup.CurrentStage != "setup" {
+		t.Fatalf("GetNovelSetupState current_stage = %q", setup.CurrentStage)
+	}
+
+	// Сетап не попадает в состояния сцен
+	refs, err := repo.ListNovelStateRefs(ctx, novelID)
+	if err != nil {
+		t.Fatalf("ListNovelStateRefs: %v", err)
+	}
+	if len(refs) != 0 {
+		t.Fatalf("ListNovelStateRefs = %+v, want no scene states", refs)
+	}
+	wantProgress(t, repo, novelID, userID, 0)
+
+	details, err := repo.GetNovelDetails(ctx, novelID)
+	if err != nil {
+		t.Fatalf("GetNovelDetails: %v", err)
+	}
+	if details.NovelID != novelID || details.UserID != userID || details.Genre != "fantasy" || details.ScenesCount != 0 {
+		t.Fatalf("GetNovelDetails = %+v", details)
+	}
+	if len(details.Characters) != 1 || details.Characters[0].Name != "Мира" {
+		t.Fatalf("GetNovelDetails characters = %+v, want characters from setup", details.Characters)
+	}
+
+	if err := repo.SaveNovelSetupState(ctx, novelID, setupState("Ян")); err != nil {
+		t.Fatalf("SaveNovelSetupState: %v", err)
+	}
+	details, err = repo.GetNovelDetails(ctx, novelID)
+	if err != nil {
+		t.Fatalf("GetNovelDetails: %v", err)
+	}
+	if len(details.Characters) != 1 || details.Characters[0].Name != "Ян" {
+		t.Fatalf("GetNovelDetails characters = %+v, want the replaced setup", details.Characters)
+	}
+}
+
+func testLatestNovelState(t *testing.T, repo repository.NovelRepository) {
+	ctx := context.Background()
+	author := newUserID()
+	novelID := createNovel(t, repo, author, "Последняя сцена")
+
+	data, sceneIndex, err := repo.GetLatestNovelState(ctx, novelID, author)
+	if err != nil || data != nil || sceneIndex != -1 {
+		t.Fatalf("GetLatestNovelState of empty novel = (%s, %d, %v), want (nil, -1, nil)", data, sceneIndex, err)
+	}
+
+	// Без сцены 0 новый игрок получает сетап
+	saveState(t, repo, novelID, 0, author, newStateHash(), setupState("Мира"))
+	data, sceneIndex, err = repo.GetLatestNovelState(ctx, novelID, newUserID())
+	if err != nil || sceneIndex != 0 {
+		t.Fatalf("GetLatestNovelState for new player = (%d, %v), want the setup", sceneIndex, err)
+	}
+	var state domain.NovelState
+	if err := json.Unmarshal(data, &state); err != nil || state.CurrentStage != "setup" {
+		t.Fatalf("GetLatestNovelState for new player returned %s, want the setup", data)
+	}
+
+	saveState(t, repo, novelID, 0, author, newStateHash(), sceneState(0, "начало"))
+	saveState(t, repo, novelID, 1, author, newStateHash(), sceneState(1, "автор"))
+	saveState(t, repo, novelID, 1, newUserID(), newStateHash(), sceneState(1, "другой игрок"))
+
+	// Новый игрок начинает со сцены 0
+	data, sceneIndex, err = repo.GetLatestNovelState(ctx, novelID, newUserID())
+	if err != nil || sceneIndex != 0 || summaryOf(t, data) != "начало" {
+		t.Fatalf("GetLatestNovelState for new player = (%s, %d, %v), want scene 0", data, sceneIndex, err)
+	}
+
+	// Игрок с прогрессом получает самое раннее состояние своей текущей сцены
+	data, sceneIndex, err = repo.GetLatestNovelState(ctx, novelID, author)
+	if err != nil || sceneIndex != 1 || summaryOf(t, data) != "автор" {
+		t.Fatalf("GetLatestNovelState for author = (%s, %d, %v), want the earliest scene 1", data, sceneIndex, err)
+	}
+}
+
+func testProgressUpsert(t *testing.T, repo repository.NovelRepository) {
+	userID := newUserID()
+	novelID := createNovel(t, repo, userID, "Прогресс")
+
+	wantProgress(t, repo, novelID, userID, -1)
+
+	saveState(t, repo, novelID, 2, userID, newStateHash(), sceneState(2, "вторая"))
+	wantProgress(t, repo, novelID, userID, 2)
+
+	// Прогресс не уменьшается при сохранении более ранней сцены
+	saveState(t, repo, novelID, 1, userID, newStateHash(), sceneState(1, "первая"))
+	wantProgress(t, repo, novelID, userID, 2)
+
+	saveState(t, repo, novelID, 3, userID, newStateHash(), sceneState(3, "третья"))
+	wantProgress(t, repo, novelID, userID, 3)
+
+	// Прогресс других игроков независим
+	wantProgress(t, repo, novelID, newUserID(), -1)
+}
+
+// storyProgress возвращает прогресс сцены с хешем stateHash
+func storyProgress(stateHash, summary string) *domain.UserStoryProgress {
+	return &domain.UserStoryProgress{
+		GlobalFlags:       []string{"met_guide"},
+		Relationship:      map[string]int{"Мира": 2},
+		StoryVariables:    map[string]interface{}{"gold": 10.0},
+		PreviousChoices:   []string{"Пойти в лес"},
+		StorySummarySoFar: summary,
+		FutureDirection:   "Лес темнеет",
+		StateHash:         stateHash,
+	}
+}
+
+func testUserStoryProgress(t *testing.T, repo repository.NovelRepository) {
+	ctx := context.Background()
+	userID := newUserID()
+	novelID := createNovel(t, repo, userID, "Динамика")
+
+	if err := repo.SaveUserStoryProgress(ctx, novelID, 1, userID, nil); err == nil {
+		t.Fatal("SaveUserStoryProgress(nil): want error")
+	}
+	if err := repo.SaveUserStoryProgress(ctx, novelID, 1, userID, storyProgress("", "пусто")); err == nil {
+		t.Fatal("SaveUserStoryProgress with empty hash: want error")
+	}
+
+	progress, sceneIndex, err := repo.GetLatestUserStoryProgress(ctx, novelID, userID)
+	if err != nil || progress != nil || sceneIndex != -1 {
+		t.Fatalf("GetLatestUserStoryProgress without progress = (%v, %d, %v), want (nil, -1, nil)", progress, sceneIndex, err)
+	}
+
+	firstHash, secondHash := newStateHash(), newStateHash()
+	if err := repo.SaveUserStoryProgress(ctx, novelID, 1, userID, storyProgress(firstHash, "сцена 1")); err != nil {
+		t.Fatalf("SaveUserStoryProgress(1): %v", err)
+	}
+	if err := repo.SaveUserStoryProgress(ctx, novelID, 2, userID, storyProgress(secondHash, "сцена 2")); err != nil {
+		t.Fatalf("SaveUserStoryProgress(2): %v", err)
+	}
+	// Повторное сохранение сцены перезаписывает ее прогресс
+	if err := repo.SaveUserStoryProgress(ctx, novelID, 1, userID, storyProgress(firstHash, "сцена 1 заново")); err != nil {
+		t.Fatalf("SaveUserStoryProgress(1 again): %v", err)
+	}
+	wantProgress(t, repo, novelID, userID, 2)
+
+	progress, sceneIndex, err = repo.GetLatestUserStoryProgress(ctx, novelID, userID)
+	if err != nil || sceneIndex != 2 || progress == nil || progress.StorySummarySoFar != "сцена 2" {
+		t.Fatalf("GetLatestUserStoryProgress = (%+v, %d, %v), want scene 2", progress, sceneIndex, err)
+	}
+	if progress.NovelID != novelID || progress.UserID != userID || progress.SceneIndex != 2 ||
+		progress.Relationship["Мира"] != 2 || progress.StoryVariables["gold"] != 10.0 || len(progress.GlobalFlags) != 1 {
+		t.Fatalf("GetLatestUserStoryProgress = %+v, want the saved progress", progress)
+	}
+
+	progress, err = repo.GetUserStoryProgressByHash(ctx, firstHash)
+	if err != nil || progress.SceneIndex != 1 || progress.StorySummarySoFar != "сцена 1 заново" {
+		t.Fatalf("GetUserStoryProgressByHash = (%+v, %v), want the overwritten scene 1", progress, err)
+	}
+	_, err = repo.GetUserStoryProgressByHash(ctx, newStateHash())
+	wantNotFound(t, "GetUserStoryProgressByHash(unknown hash)", err)
+
+	progress, err = repo.GetUserStoryProgress(ctx, novelID, userID, 2)
+	if err != nil || progress.StateHash != secondHash {
+		t.Fatalf("GetUserStoryProgress(2) = (%+v, %v)", progress, err)
+	}
+	_, err = repo.GetUserStoryProgress(ctx, novelID, userID, 3)
+	wantNotFound(t, "GetUserStoryProgress(unplayed scene)", err)
+
+	track, err := repo.ListUserStoryProgress(ctx, novelID, userID)
+	if err != nil {
+		t.Fatalf("ListUserStoryProgress: %v", err)
+	}
+	if len(track) != 2 || track[0].SceneIndex != 1 || track[1].SceneIndex != 2 {
+		t.Fatalf("ListUserStoryProgress = %+v, want scenes 1 and 2", track)
+	}
+
+	steps, err := repo.ListStoryPathSteps(ctx, novelID)
+	if err != nil {
+		t.Fatalf("ListStoryPathSteps: %v", err)
+	}
+	if len(steps) != 2 || steps[0].UserID != userID || steps[0].SceneIndex != 1 || steps[1].StateHash != secondHash ||
+		len(steps[0].PreviousChoices) != 1 {
+		t.Fatalf("ListStoryPathSteps = %+v", steps)
+	}
+}
+
+func testRewindReplaceDeleteProgress(t *testing.T, repo repository.NovelRepository) {
+	ctx := context.Background()
+	userID := newUserID()
+	novelID := createNovel(t, repo, userID, "Перемотка")
+
+	for sceneIndex := 1; sceneIndex <= 3; sceneIndex++ {
+		progress := storyProgress(newStateHash(), fmt.Sprintf("сцена %d", sceneIndex))
+		if err := repo.SaveUserStoryProgress(ctx, novelID, sceneIndex, userID, progress); err != nil {
+			t.Fatalf("SaveUserStoryProgress(%d): %v", sceneIndex, err)
+		}
+	}
+
+	// Перемотка уменьшает прогресс и удаляет последующие сцены
+	if err := repo.RewindUserProgress(ctx, novelID, userID, 1); err != nil {
+		t.Fatalf("RewindUserProgress: %v", err)
+	}
+	wantProgress(t, repo, novelID, userID, 1)
+	track, err := repo.ListUserStoryProgress(ctx, novelID, userID)
+	if err != nil {
+		t.Fatalf("ListUserStoryProgress: %v", err)
+	}
+	if len(track) != 1 || track[0].SceneIndex != 1 {
+		t.Fatalf("ListUserStoryProgress after rewind = %+v, want scene 1 only", track)
+	}
+
+	replacement := []domain.UserStoryProgress{
+		*storyProgress(newStateHash(), "замена 1"),
+		*storyProgress(newStateHash(), "замена 2"),
+	}
+	replacement[0].SceneIndex = 1
+	replacement[1].SceneIndex = 2
+	if err := repo.ReplaceUserStoryProgress(ctx, novelID, userID, 2, replacement); err != nil {
+		t.Fatalf("ReplaceUserStoryProgress: %v", err)
+	}
+	wantProgress(t, repo, novelID, userID, 2)
+	progress, sceneIndex, err := repo.GetLatestUserStoryProgress(ctx, novelID, userID)
+	if err != nil || sceneIndex != 2 || progress == nil || progress.StorySummarySoFar != "замена 2" {
+		t.Fatalf("GetLatestUserStoryProgress after replace = (%+v, %d, %v)", progress, sceneIndex, err)
+	}
+
+	if err := repo.DeleteUserProgress(ctx, novelID, userID); err != nil {
+		t.Fatalf("DeleteUserProgress: %v", err)
+	}
+	wantProgress(t, repo, novelID, userID, -1)
+	track, err = repo.ListUserStoryProgress(ctx, novelID, userID)
+	if err != nil || len(track) != 0 {
+		t.Fatalf("ListUserStoryProgress after delete = (%+v, %v), want empty", track, err)
+	}
+	wantNotFound(t, "DeleteUserProgress(again)", repo.DeleteUserProgress(ctx, novelID, userID))
+}
+
+func testVisibilityAndShareLinks(t *testing.T, repo repository.NovelRepository) {
+	ctx := context.Background()
+	owner, reader := newUserID(), newUserID()
+	novelID := createNovel(t, repo, owner, "Ссылки")
+
+	wantNotFound(t, "SetNovelVisibility(not owner)", repo.SetNovelVisibility(ctx, novelID, reader, domain.VisibilityPublic))
+	if err := repo.SetNovelVisibility(ctx, novelID, owner, domain.VisibilityUnlisted); err != nil {
+		t.Fatalf("SetNovelVisibility: %v", err)
+	}
+
+	token := "repotest-" + uuid.NewString()
+	wantNotFound(t, "SetNovelShareToken(not owner)", repo.SetNovelShareToken(ctx, novelID, reader, token))
+	if err := repo.SetNovelShareToken(ctx, novelID, owner, token); err != nil {
+		t.Fatalf("SetNovelShareToken: %v", err)
+	}
+	gotID, visibility, err := repo.GetNovelByShareToken(ctx, token)
+	if err != nil || gotID != novelID || visibility != domain.VisibilityUnlisted {
+		t.Fatalf("GetNovelByShareToken = (%s, %q, %v)", gotID, visibility, err)
+	}
+
+	if err := repo.GrantNovelAccess(ctx, novelID, reader); err != nil {
+		t.Fatalf("GrantNovelAccess: %v", err)
+	}
+	// Повторный доступ не считается ошибкой
+	if err := repo.GrantNovelAccess(ctx, novelID, reader); err != nil {
+		t.Fatalf("GrantNovelAccess(again): %v", err)
+	}
+	access, err := repo.GetNovelAccess(ctx, novelID, reader)
+	if err != nil || !access.Granted || access.Visibility != domain.VisibilityUnlisted {
+		t.Fatalf("GetNovelAccess(reader) = (%+v, %v), want granted", access, err)
+	}
+
+	// Отключение ссылки отзывает доступ
+	if err := repo.SetNovelShareToken(ctx, novelID, owner, ""); err != nil {
+		t.Fatalf("SetNovelShareToken(disable): %v", err)
+	}
+	_, _, err = repo.GetNovelByShareToken(ctx, token)
+	wantNotFound(t, "GetNovelByShareToken(disabled)", err)
+	access, err = repo.GetNovelAccess(ctx, novelID, reader)
+	if err != nil || access.Granted {
+		t.Fatalf("GetNovelAccess(reader) after disabling = (%+v, %v), want revoked", access, err)
+	}
+
+	newOwner := newUserID()
+	if err := repo.SetNovelOwner(ctx, novelID, newOwner); err != nil {
+		t.Fatalf("SetNovelOwner: %v", err)
+	}
+	access, err = repo.GetNovelAccess(ctx, novelID, newOwner)
+	if err != nil || access.OwnerID != newOwner {
+		t.Fatalf("GetNovelAccess after SetNovelOwner = (%+v, %v)", access, err)
+	}
+	wantNotFound(t, "SetNovelOwner(unknown novel)", repo.SetNovelOwner(ctx, uuid.New(), newOwner))
+}
+
+func testListNovels(t *testing.T, repo repository.NovelRepository) {
+	ctx := context.Background()
+	owner, player := newUserID(), newUserID()
+
+	novelIDs := make([]uuid.UUID, 3)
+	for i := range novelIDs {
+		novelIDs[i] = createNovel(t, repo, owner, fmt.Sprintf("Новелла %d", i))
+	}
+	saveState(t, repo, novelIDs[0], 0, owner, newStateHash(), setupState("Мира"))
+	if err := repo.SetNovelVisibility(ctx, novelIDs[0], owner, domain.VisibilityPublic); err != nil {
+		t.Fatalf("SetNovelVisibility: %v", err)
+	}
+
+	// Свои новеллы: новые первыми, постранично
+	page, total, next, err := repo.ListNovels(ctx, owner, domain.NovelScopeMine, 2, nil)
+	if err != nil {
+		t.Fatalf("ListNovels: %v", err)
+	}
+	if len(page) != 2 || next == nil || total != 1 {
+		t.Fatalf("ListNovels first page = %d novels, total %d, next %v; want 2 novels, 1 setuped, a cursor", len(page), total, next)
+	}
+	if page[0].NovelID != novelIDs[2] || page[1].NovelID != novelIDs[1] || *next != novelIDs[1] {
+		t.Fatalf("ListNovels first page = %s, %s; want newest first", page[0].NovelID, page[1].NovelID)
+	}
+	page, _, next, err = repo.ListNovels(ctx, owner, domain.NovelScopeMine, 2, next)
+	if err != nil {
+		t.Fatalf("ListNovels(cursor): %v", err)
+	}
+	if len(page) != 1 || next != nil || page[0].NovelID != novelIDs[0] {
+		t.Fatalf("ListNovels second page = %+v, next %v; want the oldest novel only", page, next)
+	}
+	item := page[0]
+	if !item.IsSetuped || item.Visibility != domain.VisibilityPublic || item.TotalScenesCount == 0 || !item.IsStartedByUser {
+		t.Fatalf("ListNovels item = %+v, want setuped public novel started by owner", item)
+	}
+
+	// Публичные новеллы видны всем, с прогрессом запрашивающего пользователя
+	page, _, _, err = repo.ListNovels(ctx, player, domain.NovelScopePublic, 100, nil)
+	if err != nil {
+		t.Fatalf("ListNovels(public): %v", err)
+	}
+	found := false
+	for _, item := range page {
+		if item.NovelID == novelIDs[1] || item.NovelID == novelIDs[2] {
+			t.Fatalf("ListNovels(public) contains private novel %s", item.NovelID)
+		}
+		if item.NovelID == novelIDs[0] {
+			found = true
+			if item.IsStartedByUser || item.CurrentUserSceneIndex != nil {
+				t.Fatalf("ListNovels(public) item = %+v, want not started by player", item)
+			}
+		}
+	}
+	if !found && len(page) < 100 {
+		t.Fatalf("ListNovels(public) does not contain public novel %s", novelIDs[0])
+	}
+
+	page, _, _, err = repo.ListNovels(ctx, player, domain.NovelScopeMine, 10, nil)
+	if err != nil || len(page) != 0 {
+		t.Fatalf("ListNovels(mine) of player = (%+v, %v), want empty", page, err)
+	}
+
+	metas, err := repo.ListNovelsByUser(ctx, owner, 10, 0)
+	if err != nil || len(metas) != 3 {
+		t.Fatalf("ListNovelsByUser = (%d novels, %v), want 3", len(metas), err)
+	}
+	metas, err = repo.ListNovelsByUser(ctx, owner, 10, 2)
+	if err != nil || len(metas) != 1 {
+		t.Fatalf("ListNovelsByUser(offset 2) = (%d novels, %v), want 1", len(metas), err)
+	}
+}
+
+func testUpdateAndDeleteNovel(t *testing.T, repo repository.NovelRepository) {
+	ctx := context.Background()
+	owner := newUserID()
+	novelID := createNovel(t, repo, owner, "Старое название")
+
+	title := "Новое название"
+	wantNotFound(t, "UpdateNovel(not owner)", repo.UpdateNovel(ctx, novelID, newUserID(), &title, nil))
+	if err := repo.UpdateNovel(ctx, novelID, owner, &title, nil); err != nil {
+		t.Fatalf("UpdateNovel: %v", err)
+	}
+	config, err := repo.GetNovelConfigByID(ctx, novelID, owner)
+	if err != nil {
+		t.Fatalf("GetNovelConfigByID: %v", err)
+	}
+	if config.Title != title || config.ShortDescription != "Описание Старое название" || config.Genre != "fantasy" {
+		t.Fatalf("GetNovelConfigByID after update = %+v, want new title only", config)
+	}
+
+	hash := newStateHash()
+	saveState(t, repo, novelID, 1, owner, hash, sceneState(1, "сцена"))
+	if err := repo.SaveUserStoryProgress(ctx, novelID, 1, owner, storyProgress(hash, "сцена")); err != nil {
+		t.Fatalf("SaveUserStoryProgress: %v", err)
+	}
+
+	if err := repo.DeleteNovel(ctx, novelID); err != nil {
+		t.Fatalf("DeleteNovel: %v", err)
+	}
+	_, err = repo.GetNovelAccess(ctx, novelID, owner)
+	wantNotFound(t, "GetNovelAccess(deleted)", err)
+	_, err = repo.GetNovelStateByHash(ctx, hash)
+	wantNotFound(t, "GetNovelStateByHash(deleted novel)", err)
+	_, err = repo.GetUserStoryProgressByHash(ctx, hash)
+	wantNotFound(t, "GetUserStoryProgressByHash(deleted novel)", err)
+	wantProgress(t, repo, novelID, owner, -1)
+	wantNotFound(t, "DeleteNovel(again)", repo.DeleteNovel(ctx, novelID))
+}
+
+func testWithTx(t *testing.T, repo repository.NovelRepository) {
+	ctx := context.Background()
+	userID := newUserID()
+	novelID := createNovel(t, repo, userID, "Транзакция")
+
+	// saveStep сохраняет шаг генерации так же, как сервис: состояние, затем прогресс сцены
+	saveStep := func(tx repository.NovelRepository, sceneIndex int, hash string) error {
+		if err := tx.SaveNovelState(ctx, novelID, sceneIndex, userID, hash, sceneState(sceneIndex, "шаг")); err != nil {
+			return err
+		}
+		return tx.SaveUserStoryProgress(ctx, novelID, sceneIndex, userID, storyProgress(hash, "шаг"))
+	}
+
+	// Ошибка fn отменяет все записи
+	failedHash := newStateHash()
+	errAbort := errors.New("abort")
+	err := repo.WithTx(ctx, func(tx repository.NovelRepository) error {
+		if err := saveStep(tx, 1, failedHash); err != nil {
+			return err
+		}
+		// Внутри транзакции записи уже видны
+		if _, err := tx.GetNovelStateByHash(ctx, failedHash); err != nil {
+			return fmt.Errorf("GetNovelStateByHash inside tx: %w", err)
+		}
+		return errAbort
+	})
+	if !errors.Is(err, errAbort) {
+		t.Fatalf("WithTx = %v, want %v", err, errAbort)
+	}
+	_, err = repo.GetNovelStateByHash(ctx, failedHash)
+	wantNotFound(t, "GetNovelStateByHash(rolled back)", err)
+	_, err = repo.GetUserStoryProgressByHash(ctx, failedHash)
+	wantNotFound(t, "GetUserStoryProgressByHash(rolled back)", err)
+	wantProgress(t, repo, novelID, userID, -1)
+
+	// Ошибка записи внутри fn тоже отменяет предыдущие записи
+	orphanHash := newStateHash()
+	err = repo.WithTx(ctx, func(tx repository.NovelRepository) error {
+		if err := saveStep(tx, 1, orphanHash); err != nil {
+			return err
+		}
+		return tx.SaveNovelState(ctx, uuid.New(), 2, userID, newStateHash(), sceneState(2, "чужая"))
+	})
+	if err == nil {
+		t.Fatalf("WithTx with a failing write: error = nil")
+	}
+	_, err = repo.GetNovelStateByHash(ctx, orphanHash)
+	wantNotFound(t, "GetNovelStateByHash(failed write)", err)
+	wantProgress(t, repo, novelID, userID, -1)
+
+	// Успешная транзакция, в том числе вложенная, фиксирует все записи
+	hash1, hash2 := newStateHash(), newStateHash()
+	err = repo.WithTx(ctx, func(tx repository.NovelRepository) error {
+		if err := saveStep(tx, 1, hash1); err != nil {
+			return err
+		}
+		return tx.WithTx(ctx, func(nested repository.NovelRepository) error {
+			return saveStep(nested, 2, hash2)
+		})
+	})
+	if err != nil {
+		t.Fatalf("WithTx: %v", err)
+	}
+	for _, hash := range []string{hash1, hash2} {
+		if _, err := repo.GetNovelStateByHash(ctx, hash); err != nil {
+			t.Fatalf("GetNovelStateByHash(%s): %v", hash, err)
+		}
+	}
+	wantProgress(t, repo, novelID, userID, 2)
+	track, err := repo.ListUserStoryProgress(ctx, novelID, userID)
+	if err != nil || len(track) != 2 {
+		t.Fatalf("ListUserStoryProgress = (%d scenes, %v), want 2", len(track), err)
+	}
+}
+
+func testConcurrentSaves(t *testing.T, repo repository.NovelRepository) {
+	ctx := context.Background()
+	userID := newUserID()
+	novelID := createNovel(t, repo, userID, "Гонка")
+
+	const scenes = 8
+	var wg sync.WaitGroup
+	errs := make(chan error, 2*scenes)
+	for sceneIndex := 1; sceneIndex <= scenes; sceneIndex++ {
+		wg.Add(1)
+		go func(sceneIndex int) {
+			defer wg.Done()
+			hash := newStateHash()
+			if err := repo.SaveNovelState(ctx, novelID, sceneIndex, userID, hash, sceneState(sceneIndex, "сцена")); err != nil {
+				errs <- err
+				return
+			}
+			if err := repo.SaveUserStoryProgress(ctx, novelID, sceneIndex, userID, storyProgress(hash, "сцена")); err != nil {
+				errs <- err
+			}
+		}(sceneIndex)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatalf("concurrent save: %v", err)
+	}
+
+	wantProgress(t, repo, novelID, userID, scenes)
+	track, err := repo.ListUserStoryProgress(ctx, novelID, userID)
+	if err != nil || len(track) != scenes {
+		t.Fatalf("ListUserStoryProgress = (%d scenes, %v), want %d", len(track), err, scenes)
+	}
+}
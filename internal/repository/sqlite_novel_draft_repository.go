@@ -0,0 +1,264 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"novel-server/internal/domain"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// SQLiteNovelDraftRepository реализация NovelDraftRepository для SQLite
+type SQLiteNovelDraftRepository struct {
+	db *sql.DB
+}
+
+// NewSQLiteNovelDraftRepository создает новый экземпляр SQLiteNovelDraftRepository
+func NewSQLiteNovelDraftRepository(db *sql.DB) *SQLiteNovelDraftRepository {
+	return &SQLiteNovelDraftRepository{db: db}
+}
+
+// SaveDraft сохраняет новый черновик в базу данных вместе с его первой ревизией
+func (r *SQLiteNovelDraftRepository) SaveDraft(ctx context.Context, userID string, draftID uuid.UUID, configJSON []byte, prompt string) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	now := sqliteNow()
+	query := `
+		INSERT INTO novel_drafts (draft_id, user_id, config_json, revision, created_at, updated_at)
+		VALUES (?1, ?2, ?3, 1, ?4, ?4)
+	`
+	if _, err := tx.ExecContext(ctx, query, draftID, userID, string(configJSON), now); err != nil {
+		log.Printf("[SQLiteNovelDraftRepository] SaveDraft - Error saving draft: %v", err)
+		return fmt.Errorf("failed to save draft: %w", err)
+	}
+
+	revisionQuery := `
+		INSERT INTO novel_draft_revisions (draft_id, revision, source, prompt, config_json, created_at)
+		VALUES (?, 1, ?, ?, ?, ?)
+	`
+	if _, err := tx.ExecContext(ctx, revisionQuery, draftID, domain.DraftRevisionCreate, prompt, string(configJSON), now); err != nil {
+		log.Printf("[SQLiteNovelDraftRepository] SaveDraft - Error saving revision: %v", err)
+		return fmt.Errorf("failed to save draft revision: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// GetDraftConfigJSON получает сериализованный конфиг черновика по ID
+func (r *SQLiteNovelDraftRepository) GetDraftConfigJSON(ctx context.Context, userID string, draftID uuid.UUID) ([]byte, error) {
+	query := `SELECT config_json FROM novel_drafts WHERE draft_id = ? AND user_id = ?`
+
+	var configJSON []byte
+	if err := r.db.QueryRowContext(ctx, query, draftID, userID).Scan(&configJSON); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			err = ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to get draft: %w", err)
+	}
+	return configJSON, nil
+}
+
+// AppendDraftRevision заменяет конфиг черновика и добавляет ревизию в одной транзакции.
+// Транзакция начинается с блокировки записи (BEGIN IMMEDIATE), поэтому параллельные уточнения
+// получают разные номера ревизий.
+func (r *SQLiteNovelDraftRepository) AppendDraftRevision(ctx context.Context, userID string, draftID uuid.UUID, configJSON []byte, revision *domain.DraftRevision) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	now := sqliteNow()
+	query := `
+		UPDATE novel_drafts
+		SET config_json = ?3, revision = revision + 1, updated_at = ?4
+		WHERE draft_id = ?1 AND user_id = ?2
+		RETURNING revision
+	`
+	if err := tx.QueryRowContext(ctx, query, draftID, userID, string(configJSON), now).Scan(&revision.Revision); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrNotFound
+		}
+		log.Printf("[SQLiteNovelDraftRepository] AppendDraftRevision - Error updating draft: %v", err)
+		return fmt.Errorf("failed to update draft: %w", err)
+	}
+
+	revisionQuery := `
+		INSERT INTO novel_draft_revisions (draft_id, revision, source, prompt, restored_from, patch, config_json, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`
+	var patch *string
+	if len(revision.Patch) > 0 {
+		patchText := string(revision.Patch)
+		patch = &patchText
+	}
+	_, err = tx.ExecContext(ctx, revisionQuery, draftID, revision.Revision, revision.Source, revision.Prompt, revision.RestoredFrom,
+		patch, string(configJSON), now)
+	if err != nil {
+		log.Printf("[SQLiteNovelDraftRepository] AppendDraftRevision - Error saving revision: %v", err)
+		return fmt.Errorf("failed to save draft revision: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	revision.DraftID = draftID
+	revision.CreatedAt = now
+	return nil
+}
+
+// DeleteDraft удаляет черновик вместе с его ревизиями
+func (r *SQLiteNovelDraftRepository) DeleteDraft(ctx context.Context, userID string, draftID uuid.UUID) error {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM novel_drafts WHERE draft_id = ? AND user_id = ?`, draftID, userID)
+	if err != nil {
+		log.Printf("[SQLiteNovelDraftRepository] DeleteDraft - Error deleting draft: %v", err)
+		return fmt.Errorf("failed to delete draft: %w", err)
+	}
+	return sqliteRequireRows(result)
+}
+
+// ListDrafts возвращает черновики пользователя без полного конфига, последние измененные первыми
+func (r *SQLiteNovelDraftRepository) ListDrafts(ctx context.Context, userID string, limit, offset int) ([]domain.NovelDraftSummary, error) {
+	query := `
+		SELECT draft_id, COALESCE(json_extract(config_json, '$.title'), ''), COALESCE(json_extract(config_json, '$.short_description'), ''),
+			COALESCE(json_extract(config_json, '$.genre'), ''), revision, created_at, updated_at
+		FROM novel_drafts
+		WHERE user_id = ?
+		ORDER BY updated_at DESC, draft_id
+		LIMIT ? OFFSET ?
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, userID, limit, offset)
+	if err != nil {
+		log.Printf("[SQLiteNovelDraftRepository] ListDrafts - Error listing drafts: %v", err)
+		return nil, fmt.Errorf("failed to list drafts: %w", err)
+	}
+	defer rows.Close()
+
+	drafts := []domain.NovelDraftSummary{}
+	for rows.Next() {
+		var d domain.NovelDraftSummary
+		if err := rows.Scan(&d.DraftID, &d.Title, &d.ShortDescription, &d.Genre, &d.Revision, &d.CreatedAt, &d.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan draft: %w", err)
+		}
+		drafts = append(drafts, d)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read drafts: %w", err)
+	}
+	return drafts, nil
+}
+
+// GetDraft возвращает черновик пользователя вместе с конфигом. Возвращает ErrNotFound, если его нет.
+func (r *SQLiteNovelDraftRepository) GetDraft(ctx context.Context, userID string, draftID uuid.UUID) (*domain.NovelDraft, error) {
+	query := `
+		SELECT draft_id, user_id, revision, config_json, created_at, updated_at
+		FROM novel_drafts
+		WHERE draft_id = ? AND user_id = ?
+	`
+
+	var draft domain.NovelDraft
+	var configJSON []byte
+	err := r.db.QueryRowContext(ctx, query, draftID, userID).Scan(&draft.DraftID, &draft.UserID, &draft.Revision, &configJSON, &draft.CreatedAt, &draft.UpdatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		log.Printf("[SQLiteNovelDraftRepository] GetDraft - Error getting draft: %v", err)
+		return nil, fmt.Errorf("failed to get draft: %w", err)
+	}
+	if err := json.Unmarshal(configJSON, &draft.Config); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal draft config: %w", err)
+	}
+	return &draft, nil
+}
+
+// sqliteDraftRevisionColumns - колонки ревизии без конфига, в порядке scanSQLiteDraftRevision
+const sqliteDraftRevisionColumns = `v.draft_id, v.revision, v.source, v.prompt, v.restored_from, v.patch, v.created_at`
+
+// scanSQLiteDraftRevision читает ревизию из строки с колонками sqliteDraftRevisionColumns
+// и дополнительными колонками extra после них
+func scanSQLiteDraftRevision(row pgx.Row, extra ...any) (*domain.DraftRevision, error) {
+	var v domain.DraftRevision
+	var patch []byte
+	dest := append([]any{&v.DraftID, &v.Revision, &v.Source, &v.Prompt, &v.RestoredFrom, &patch, &v.CreatedAt}, extra...)
+	if err := row.Scan(dest...); err != nil {
+		return nil, err
+	}
+	if patch != nil {
+		v.Patch = json.RawMessage(patch)
+	}
+	return &v, nil
+}
+
+// ListDraftRevisions возвращает ревизии черновика пользователя без конфигов (но с патчами), по возрастанию номера
+func (r *SQLiteNovelDraftRepository) ListDraftRevisions(ctx context.Context, userID string, draftID uuid.UUID) ([]domain.DraftRevision, error) {
+	query := `
+		SELECT ` + sqliteDraftRevisionColumns + `
+		FROM novel_draft_revisions v
+		JOIN novel_drafts d ON d.draft_id = v.draft_id
+		WHERE v.draft_id = ? AND d.user_id = ?
+		ORDER BY v.revision
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, draftID, userID)
+	if err != nil {
+		log.Printf("[SQLiteNovelDraftRepository] ListDraftRevisions - Error listing revisions: %v", err)
+		return nil, fmt.Errorf("failed to list draft revisions: %w", err)
+	}
+	defer rows.Close()
+
+	revisions := []domain.DraftRevision{}
+	for rows.Next() {
+		v, err := scanSQLiteDraftRevision(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan draft revision: %w", err)
+		}
+		revisions = append(revisions, *v)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read draft revisions: %w", err)
+	}
+	return revisions, nil
+}
+
+// GetDraftRevision возвращает ревизию черновика пользователя вместе с конфигом.
+// Возвращает ErrNotFound, если черновика или ревизии нет.
+func (r *SQLiteNovelDraftRepository) GetDraftRevision(ctx context.Context, userID string, draftID uuid.UUID, revision int) (*domain.DraftRevision, error) {
+	query := `
+		SELECT ` + sqliteDraftRevisionColumns + `, v.config_json
+		FROM novel_draft_revisions v
+		JOIN novel_drafts d ON d.draft_id = v.draft_id
+		WHERE v.draft_id = ? AND d.user_id = ? AND v.revision = ?
+	`
+
+	var configJSON []byte
+	v, err := scanSQLiteDraftRevision(r.db.QueryRowContext(ctx, query, draftID, userID, revision), &configJSON)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		log.Printf("[SQLiteNovelDraftRepository] GetDraftRevision - Error getting revision: %v", err)
+		return nil, fmt.Errorf("failed to get draft revision: %w", err)
+	}
+
+	v.Config = &domain.NovelConfig{}
+	if err := json.Unmarshal(configJSON, v.Config); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal draft revision config: %w", err)
+	}
+	return v, nil
+}
+
+var _ domain.NovelDraftRepository = (*SQLiteNovelDraftRepository)(nil)
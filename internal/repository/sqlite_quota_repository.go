@@ -0,0 +1,62 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+// SQLiteQuotaRepository реализация QuotaRepository для SQLite
+type SQLiteQuotaRepository struct {
+	db *sql.DB
+}
+
+// NewSQLiteQuotaRepository создает новый экземпляр SQLiteQuotaRepository
+func NewSQLiteQuotaRepository(db *sql.DB) *SQLiteQuotaRepository {
+	return &SQLiteQuotaRepository{db: db}
+}
+
+// ConsumeQuota атомарно увеличивает счетчик, если лимит еще не исчерпан
+func (r *SQLiteQuotaRepository) ConsumeQuota(ctx context.Context, userID, kind string, windowStart time.Time, limit int) (int, bool, error) {
+	// Как и в PostgreSQL: если счетчик уже на лимите, DO UPDATE пропускает строку
+	// и RETURNING ничего не возвращает
+	query := `
+		INSERT INTO user_quota_counters (user_id, kind, window_start, used)
+		VALUES (?1, ?2, ?3, 1)
+		ON CONFLICT (user_id, kind, window_start) DO UPDATE
+		SET used = user_quota_counters.used + 1
+		WHERE user_quota_counters.used < ?4
+		RETURNING used`
+
+	var used int
+	err := r.db.QueryRowContext(ctx, query, userID, kind, windowStart.UTC(), limit).Scan(&used)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return limit, false, nil
+		}
+		log.Printf("[QuotaRepo] ConsumeQuota - Error: %v", err)
+		return 0, false, fmt.Errorf("failed to consume quota: %w", err)
+	}
+	return used, true, nil
+}
+
+// GetQuotaUsage возвращает значение счетчика в окне
+func (r *SQLiteQuotaRepository) GetQuotaUsage(ctx context.Context, userID, kind string, windowStart time.Time) (int, error) {
+	var used int
+	err := r.db.QueryRowContext(ctx,
+		`SELECT used FROM user_quota_counters WHERE user_id = ? AND kind = ? AND window_start = ?`,
+		userID, kind, windowStart.UTC()).Scan(&used)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, nil
+		}
+		log.Printf("[QuotaRepo] GetQuotaUsage - Error: %v", err)
+		return 0, fmt.Errorf("failed to get quota usage: %w", err)
+	}
+	return used, nil
+}
+
+var _ QuotaRepository = (*SQLiteQuotaRepository)(nil)
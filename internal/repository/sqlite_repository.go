@@ -0,0 +1,1028 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"novel-server/internal/domain"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mattn/go-sqlite3"
+)
+
+// SQLiteNovelRepository реализует NovelRepository для SQLite (схема из migrations/sqlite).
+// Семантика совпадает с PostgresNovelRepository, включая ErrNotFound для отсутствующих записей.
+type SQLiteNovelRepository struct {
+	db *sql.DB
+	tx *sql.Tx // Транзакция WithTx; nil вне ее
+}
+
+// sqliteConn - общее у *sql.DB и *sql.Tx
+type sqliteConn interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// NewSQLiteNovelRepository создает новый экземпляр SQLiteNovelRepository.
+func NewSQLiteNovelRepository(db *sql.DB) *SQLiteNovelRepository {
+	return &SQLiteNovelRepository{db: db}
+}
+
+// conn возвращает транзакцию WithTx, если репозиторий работает в ней, иначе базу
+func (r *SQLiteNovelRepository) conn() sqliteConn {
+	if r.tx != nil {
+		return r.tx
+	}
+	return r.db
+}
+
+// withTx выполняет fn в транзакции; репозиторий tx работает через нее. SQLite не поддерживает
+// вложенные транзакции, поэтому внутри транзакции fn выполняется в ней же.
+func (r *SQLiteNovelRepository) withTx(ctx context.Context, fn func(tx *SQLiteNovelRepository) error) error {
+	if r.tx != nil {
+		return fn(r)
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := fn(&SQLiteNovelRepository{db: r.db, tx: tx}); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// WithTx выполняет fn в одной транзакции
+func (r *SQLiteNovelRepository) WithTx(ctx context.Context, fn func(tx NovelRepository) error) error {
+	return r.withTx(ctx, func(tx *SQLiteNovelRepository) error {
+		return fn(tx)
+	})
+}
+
+// LockSceneGeneration выполняет fn сразу: с файлом базы работает один процесс сервера
+func (r *SQLiteNovelRepository) LockSceneGeneration(ctx context.Context, novelID uuid.UUID, stateHash string, fn func(ctx context.Context) error) error {
+	return fn(ctx)
+}
+
+// sqliteNow возвращает текущее время для колонок TIMESTAMP. Время пишется в UTC,
+// чтобы строки дат в SQLite сравнивались и сортировались так же, как время.
+func sqliteNow() time.Time {
+	return time.Now().UTC()
+}
+
+// isSQLiteUniqueViolation сообщает, нарушает ли запись ограничение уникальности
+func isSQLiteUniqueViolation(err error) bool {
+	var sqliteErr sqlite3.Error
+	return errors.As(err, &sqliteErr) &&
+		(sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique || sqliteErr.ExtendedCode == sqlite3.ErrConstraintPrimaryKey)
+}
+
+// sqliteAdvanceProgressQuery обновляет текущую сцену пользователя, не уменьшая ее
+const sqliteAdvanceProgressQuery = `
+	INSERT INTO user_novel_progress (novel_id, user_id, current_scene_index, created_at, updated_at)
+	VALUES (?1, ?2, ?3, ?4, ?4)
+	ON CONFLICT (novel_id, user_id) DO UPDATE
+	SET current_scene_index = MAX(user_novel_progress.current_scene_index, excluded.current_scene_index),
+		updated_at = excluded.updated_at`
+
+// sqliteSetProgressQuery делает sceneIndex текущей сценой пользователя
+const sqliteSetProgressQuery = `
+	INSERT INTO user_novel_progress (novel_id, user_id, current_scene_index, created_at, updated_at)
+	VALUES (?1, ?2, ?3, ?4, ?4)
+	ON CONFLICT (novel_id, user_id) DO UPDATE
+	SET current_scene_index = excluded.current_scene_index,
+		updated_at = excluded.updated_at`
+
+// CreateNovel создает новую запись о новелле в хранилище.
+func (r *SQLiteNovelRepository) CreateNovel(ctx context.Context, userID string, config *domain.NovelConfig) (uuid.UUID, error) {
+	if userID == "" {
+		return uuid.Nil, fmt.Errorf("userID cannot be empty")
+	}
+
+	configData, err := json.Marshal(config)
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("failed to marshal novel config: %w", err)
+	}
+
+	novelID := uuid.New()
+	now := sqliteNow()
+	query := `
+		INSERT INTO novels (novel_id, user_id, title, short_description, config_data, created_at, updated_at, is_adult_content, prompt_version)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, NULLIF(?, ''))
+	`
+	_, err = r.conn().ExecContext(ctx, query, novelID, userID, config.Title, config.ShortDescription, string(configData),
+		now, now, config.IsAdultContent, config.PromptVersion)
+	if err != nil {
+		log.Printf("[SQLiteRepo] CreateNovel - insert error: %v", err)
+		return uuid.Nil, fmt.Errorf("failed to insert novel: %w", err)
+	}
+	return novelID, nil
+}
+
+// GetNovelMetadataByID возвращает краткую информацию (метаданные) о новелле по ID.
+func (r *SQLiteNovelRepository) GetNovelMetadataByID(ctx context.Context, novelID uuid.UUID, userID string) (*domain.NovelMetadata, error) {
+	query := `SELECT novel_id, user_id, title, COALESCE(short_description, ''), created_at, updated_at
+			  FROM novels
+			  WHERE novel_id = ? AND user_id = ?`
+
+	var meta domain.NovelMetadata
+	err := r.conn().QueryRowContext(ctx, query, novelID, userID).
+		Scan(&meta.NovelID, &meta.UserID, &meta.Title, &meta.ShortDescription, &meta.CreatedAt, &meta.UpdatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("novel not found or not owned by user: %w", ErrNotFound)
+		}
+		return nil, fmt.Errorf("failed to get novel metadata: %w", err)
+	}
+	return &meta, nil
+}
+
+// GetNovelConfigByID возвращает полную конфигурацию новеллы по ID.
+func (r *SQLiteNovelRepository) GetNovelConfigByID(ctx context.Context, novelID uuid.UUID, userID string) (*domain.NovelConfig, error) {
+	query := `SELECT title, COALESCE(short_description, ''), config_data FROM novels WHERE novel_id = ?`
+
+	var title, shortDescription string
+	var configJSON []byte
+	err := r.conn().QueryRowContext(ctx, query, novelID).Scan(&title, &shortDescription, &configJSON)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("novel not found: %w", ErrNotFound)
+		}
+		return nil, fmt.Errorf("failed to get novel config: %w", err)
+	}
+
+	var config domain.NovelConfig
+	if err := json.Unmarshal(configJSON, &config); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal novel config data: %w", err)
+	}
+	config.Title = title
+	config.ShortDescription = shortDescription
+	return &config, nil
+}
+
+// ListNovelsByUser возвращает список метаданных новелл для указанного пользователя.
+func (r *SQLiteNovelRepository) ListNovelsByUser(ctx context.Context, userID string, limit, offset int) ([]domain.NovelMetadata, error) {
+	query := `SELECT novel_id, user_id, title, COALESCE(short_description, ''), created_at, updated_at
+			  FROM novels
+			  WHERE user_id = ?
+			  ORDER BY updated_at DESC
+			  LIMIT ? OFFSET ?`
+
+	rows, err := r.conn().QueryContext(ctx, query, userID, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list novels: %w", err)
+	}
+	defer rows.Close()
+
+	novels := []domain.NovelMetadata{}
+	for rows.Next() {
+		var meta domain.NovelMetadata
+		if err := rows.Scan(&meta.NovelID, &meta.UserID, &meta.Title, &meta.ShortDescription, &meta.CreatedAt, &meta.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("failed to process novel list: %w", err)
+		}
+		novels = append(novels, meta)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error reading novel list: %w", err)
+	}
+	return novels, nil
+}
+
+// SaveNovelState сохраняет состояние новеллы (stateData) для определенной сцены.
+// Сетап (current_stage="setup") сохраняется только в поле setup_state_data таблицы novels.
+// Состояние и прогресс пользователя сохраняются в одной транзакции.
+func (r *SQLiteNovelRepository) SaveNovelState(ctx context.Context, novelID uuid.UUID, sceneIndex int, userID string, stateHash string, stateData []byte) error {
+	return r.withTx(ctx, func(tx *SQLiteNovelRepository) error {
+		return tx.saveNovelState(ctx, novelID, sceneIndex, userID, stateHash, stateData)
+	})
+}
+
+// saveNovelState выполняет SaveNovelState без собственной транзакции
+func (r *SQLiteNovelRepository) saveNovelState(ctx context.Context, novelID uuid.UUID, sceneIndex int, userID string, stateHash string, stateData []byte) error {
+	var state struct {
+		CurrentStage  string `json:"current_stage"`
+		PromptVersion string `json:"prompt_version"`
+	}
+	if err := json.Unmarshal(stateData, &state); err != nil {
+		log.Printf("[SQLiteRepo] Warning: Failed to unmarshal state to check current_stage: %v", err)
+	}
+
+	if state.CurrentStage == "setup" {
+		if err := r.SaveNovelSetupState(ctx, novelID, stateData); err != nil {
+			return fmt.Errorf("failed to save setup state: %w", err)
+		}
+	} else {
+		query := `
+			INSERT INTO novel_states (novel_id, scene_index, state_hash, state_data, prompt_version, created_at, updated_at)
+			VALUES (?1, ?2, ?3, ?4, NULLIF(?5, ''), ?6, ?6)
+			ON CONFLICT (novel_id, scene_index, state_hash) DO UPDATE
+			SET updated_at = excluded.updated_at
+		`
+		_, err := r.conn().ExecContext(ctx, query, novelID, sceneIndex, stateHash, string(stateData), state.PromptVersion, sqliteNow())
+		if err != nil {
+			log.Printf("[SQLiteRepo] Error saving state: %v", err)
+			return fmt.Errorf("failed to save novel state: %w", err)
+		}
+	}
+
+	if _, err := r.conn().ExecContext(ctx, sqliteAdvanceProgressQuery, novelID, userID, sceneIndex, sqliteNow()); err != nil {
+		log.Printf("[SQLiteRepo] Error updating user progress: %v", err)
+		return fmt.Errorf("failed to update user progress: %w", err)
+	}
+	return nil
+}
+
+// earliestState возвращает самое раннее состояние новеллы для сцены sceneIndex
+func (r *SQLiteNovelRepository) earliestState(ctx context.Context, novelID uuid.UUID, sceneIndex int) ([]byte, error) {
+	query := `
+		SELECT state_data
+		FROM novel_states
+		WHERE novel_id = ? AND scene_index = ?
+		ORDER BY created_at ASC, rowid ASC
+		LIMIT 1
+	`
+	var stateData []byte
+	if err := r.conn().QueryRowContext(ctx, query, novelID, sceneIndex).Scan(&stateData); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to get novel state by scene index: %w", err)
+	}
+	return stateData, nil
+}
+
+// GetLatestNovelState возвращает самое последнее сохраненное состояние новеллы (stateData)
+// и его индекс сцены для конкретного пользователя.
+func (r *SQLiteNovelRepository) GetLatestNovelState(ctx context.Context, novelID uuid.UUID, userID string) (stateData []byte, sceneIndex int, err error) {
+	currentSceneIndex, err := r.GetUserNovelProgress(ctx, novelID, userID)
+	if err != nil {
+		return nil, -1, err
+	}
+
+	if currentSceneIndex < 0 {
+		// Новый пользователь: первая сцена новеллы, иначе сетап
+		stateData, err := r.earliestState(ctx, novelID, 0)
+		if err == nil {
+			return stateData, 0, nil
+		}
+		if !errors.Is(err, ErrNotFound) {
+			return nil, -1, err
+		}
+		setupData, err := r.GetNovelSetupState(ctx, novelID)
+		if err != nil {
+			return nil, -1, nil
+		}
+		index, _ := setupSceneIndex(setupData)
+		return setupData, index, nil
+	}
+
+	if setupData, err := r.GetNovelSetupState(ctx, novelID); err == nil {
+		if index, ok := setupSceneIndex(setupData); ok && index == currentSceneIndex {
+			return setupData, currentSceneIndex, nil
+		}
+	}
+
+	stateData, err = r.earliestState(ctx, novelID, currentSceneIndex)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return nil, -1, nil
+		}
+		return nil, -1, err
+	}
+	return stateData, currentSceneIndex, nil
+}
+
+// GetNovelStateByHash возвращает состояние новеллы (stateData) по его хешу.
+// Возвращает ошибку ErrNotFound, если состояние с таким хешом не найдено.
+func (r *SQLiteNovelRepository) GetNovelStateByHash(ctx context.Context, stateHash string) (stateData []byte, err error) {
+	query := `SELECT state_data FROM novel_states WHERE state_hash = ? ORDER BY created_at ASC, rowid ASC LIMIT 1`
+	if err := r.conn().QueryRowContext(ctx, query, stateHash).Scan(&stateData); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to get novel state by hash: %w", err)
+	}
+	return stateData, nil
+}
+
+// GetNovelStateBySceneIndex возвращает самое раннее состояние новеллы для индекса сцены.
+// Возвращает ошибку ErrNotFound, если состояние с таким индексом сцены не найдено.
+func (r *SQLiteNovelRepository) GetNovelStateBySceneIndex(ctx context.Context, novelID uuid.UUID, sceneIndex int) (stateData []byte, err error) {
+	return r.earliestState(ctx, novelID, sceneIndex)
+}
+
+// GetNovelSetupState возвращает сетап новеллы из поля setup_state_data.
+// SaveNovelState хранит сетап только там, поэтому, в отличие от PostgreSQL, искать его среди состояний не нужно.
+// Возвращает ErrNotFound, если сетапа нет.
+func (r *SQLiteNovelRepository) GetNovelSetupState(ctx context.Context, novelID uuid.UUID) (stateData []byte, err error) {
+	query := `SELECT setup_state_data FROM novels WHERE novel_id = ? AND setup_state_data IS NOT NULL`
+	if err := r.conn().QueryRowContext(ctx, query, novelID).Scan(&stateData); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to get novel setup state: %w", err)
+	}
+	return stateData, nil
+}
+
+// SaveNovelSetupState сохраняет сетап новеллы в поле setup_state_data таблицы novels,
+// а версию промпта, которым он сгенерирован, - в setup_prompt_version
+func (r *SQLiteNovelRepository) SaveNovelSetupState(ctx context.Context, novelID uuid.UUID, setupData []byte) error {
+	var setup struct {
+		PromptVersion string `json:"prompt_version"`
+	}
+	if err := json.Unmarshal(setupData, &setup); err != nil {
+		log.Printf("[SQLiteRepo] Warning: Failed to unmarshal setup state to read prompt_version: %v", err)
+	}
+
+	query := `UPDATE novels SET setup_state_data = ?, setup_prompt_version = NULLIF(?, ''), updated_at = ? WHERE novel_id = ?`
+	if _, err := r.conn().ExecContext(ctx, query, string(setupData), setup.PromptVersion, sqliteNow(), novelID); err != nil {
+		log.Printf("[SQLiteRepo] Error saving setup state to novels table: %v", err)
+		return fmt.Errorf("failed to save setup state to novels table: %w", err)
+	}
+	return nil
+}
+
+// sqliteIsSetupedExpr - выражение "у новеллы n есть сетап или сцена с индексом 0"
+const sqliteIsSetupedExpr = `(n.setup_state_data IS NOT NULL OR EXISTS(SELECT 1 FROM novel_states ns WHERE ns.novel_id = n.novel_id AND ns.scene_index = 0))`
+
+// ListNovels возвращает список новелл с поддержкой курсорной пагинации и информацией о прогрессе пользователя.
+func (r *SQLiteNovelRepository) ListNovels(ctx context.Context, userID, scope string, limit int, cursor *uuid.UUID) ([]domain.NovelListItem, int, *uuid.UUID, error) {
+	if userID == "" {
+		return nil, 0, nil, fmt.Errorf("userID is required to list novels with progress")
+	}
+	if limit <= 0 {
+		limit = 10
+	}
+
+	var queryBuilder strings.Builder
+	queryBuilder.WriteString(`
+		SELECT
+			n.novel_id,
+			n.title,
+			COALESCE(n.short_description, ''),
+			n.config_data,
+			n.created_at,
+			n.updated_at,
+			n.is_adult_content,
+			n.visibility,
+			` + sqliteIsSetupedExpr + `,
+			(
+				SELECT up.current_scene_index
+				FROM user_novel_progress up
+				WHERE up.novel_id = n.novel_id AND up.user_id = ?1
+			)
+		FROM novels n
+	`)
+	args := []interface{}{userID}
+
+	// Условия WHERE: область списка и курсор. Условие области ссылается на пользователя как $1,
+	// в SQLite это ?1
+	conditions := []string{}
+	scopeCondition := strings.ReplaceAll(novelScopeCondition(scope), "$", "?")
+	if scopeCondition != "" {
+		conditions = append(conditions, scopeCondition)
+	}
+
+	if cursor != nil {
+		var cursorCreatedAt time.Time
+		if err := r.conn().QueryRowContext(ctx, `SELECT created_at FROM novels WHERE novel_id = ?`, *cursor).Scan(&cursorCreatedAt); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return nil, 0, nil, fmt.Errorf("cursor novel not found")
+			}
+			return nil, 0, nil, fmt.Errorf("failed to fetch cursor data: %w", err)
+		}
+		// Keyset pagination: (created_at, novel_id) меньше курсора
+		conditions = append(conditions, "((n.created_at < ?2) OR (n.created_at = ?2 AND n.novel_id < ?3))")
+		args = append(args, cursorCreatedAt.UTC(), *cursor)
+	}
+
+	if len(conditions) > 0 {
+		queryBuilder.WriteString("\n\t\tWHERE " + strings.Join(conditions, " AND ") + "\n")
+	}
+
+	// Запрашиваем на 1 больше для определения hasMore
+	queryBuilder.WriteString(fmt.Sprintf(`
+		ORDER BY n.created_at DESC, n.novel_id DESC
+		LIMIT ?%d
+	`, len(args)+1))
+	args = append(args, limit+1)
+
+	rows, err := r.conn().QueryContext(ctx, queryBuilder.String(), args...)
+	if err != nil {
+		log.Printf("[SQLiteRepo] ListNovels - Error querying novels: %v", err)
+		return nil, 0, nil, fmt.Errorf("failed to list novels: %w", err)
+	}
+	defer rows.Close()
+
+	novels := []domain.NovelListItem{}
+	for rows.Next() {
+		var item domain.NovelListItem
+		var configData []byte
+		var currentUserSceneIndex sql.NullInt64
+
+		if err := rows.Scan(
+			&item.NovelID,
+			&item.Title,
+			&item.ShortDescription,
+			&configData,
+			&item.CreatedAt,
+			&item.UpdatedAt,
+			&item.IsAdultContent,
+			&item.Visibility,
+			&item.IsSetuped,
+			&currentUserSceneIndex,
+		); err != nil {
+			return nil, 0, nil, fmt.Errorf("failed to process novel list: %w", err)
+		}
+
+		if currentUserSceneIndex.Valid {
+			item.IsStartedByUser = true
+			sceneIndex := int(currentUserSceneIndex.Int64)
+			item.CurrentUserSceneIndex = &sceneIndex
+		}
+
+		var config domain.NovelConfig
+		if err := json.Unmarshal(configData, &config); err != nil {
+			log.Printf("[SQLiteRepo] ListNovels - Error unmarshaling config for NovelID %s: %v", item.NovelID, err)
+			if item.ShortDescription == "" {
+				item.ShortDescription = "Описание недоступно"
+			}
+		} else {
+			item.TotalScenesCount = determineSceneCountFromLength(config.StoryConfig.Length)
+			if item.ShortDescription == "" && config.ShortDescription != "" {
+				item.ShortDescription = config.ShortDescription
+			}
+		}
+
+		novels = append(novels, item)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, nil, fmt.Errorf("error reading novel list: %w", err)
+	}
+
+	// Общее количество новелл области (только засетапленные)
+	var totalCount int
+	countQuery := `SELECT COUNT(*) FROM novels n WHERE ` + sqliteIsSetupedExpr
+	countArgs := []interface{}{}
+	if scopeCondition != "" {
+		countQuery += " AND " + scopeCondition
+		if strings.Contains(scopeCondition, "?1") {
+			countArgs = append(countArgs, userID)
+		}
+	}
+	if err := r.conn().QueryRowContext(ctx, countQuery, countArgs...).Scan(&totalCount); err != nil {
+		log.Printf("[SQLiteRepo] ListNovels - Error counting total setuped novels: %v", err)
+		totalCount = 0 // Не критично, если счетчик не сработает
+	}
+
+	var nextCursor *uuid.UUID
+	if len(novels) > limit {
+		nextCursor = &novels[limit-1].NovelID
+		novels = novels[:limit]
+	}
+	return novels, totalCount, nextCursor, nil
+}
+
+// GetNovelDetails возвращает детальную информацию о новелле, включая персонажей из сетапа
+func (r *SQLiteNovelRepository) GetNovelDetails(ctx context.Context, novelID uuid.UUID) (*domain.NovelDetailsResponse, error) {
+	query := `
+		SELECT n.novel_id, n.user_id, n.visibility, n.title, COALESCE(n.short_description, ''), n.config_data, n.created_at, n.updated_at,
+			   (SELECT COUNT(*) FROM novel_states ns WHERE ns.novel_id = n.novel_id),
+			   ` + sqliteIsSetupedExpr + `
+		FROM novels n
+		WHERE n.novel_id = ?
+	`
+
+	var details domain.NovelDetailsResponse
+	var configJSON []byte
+	var isSetuped bool
+	err := r.conn().QueryRowContext(ctx, query, novelID).Scan(
+		&details.NovelID,
+		&details.UserID,
+		&details.Visibility,
+		&details.Title,
+		&details.ShortDescription,
+		&configJSON,
+		&details.CreatedAt,
+		&details.UpdatedAt,
+		&details.ScenesCount,
+		&isSetuped,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("novel not found: %w", ErrNotFound)
+		}
+		return nil, fmt.Errorf("failed to get novel details: %w", err)
+	}
+
+	var config domain.NovelConfig
+	if err := json.Unmarshal(configJSON, &config); err != nil {
+		log.Printf("[SQLiteRepo] GetNovelDetails - Error unmarshaling config: %v", err)
+	} else {
+		details.Genre = config.Genre
+		details.Language = config.Language
+		details.WorldContext = config.WorldContext
+		details.EndingPreference = config.EndingPreference
+		details.PlayerName = config.PlayerName
+		details.PlayerGender = config.PlayerGender
+		if details.ShortDescription == "" && config.ShortDescription != "" {
+			details.ShortDescription = config.ShortDescription
+		}
+	}
+
+	if !isSetuped {
+		return nil, fmt.Errorf("novel not setuped")
+	}
+
+	// Персонажи берутся из сетапа; без него список остается пустым
+	if setupStateData, err := r.GetNovelSetupState(ctx, novelID); err == nil {
+		var setupState domain.NovelState
+		if err := json.Unmarshal(setupStateData, &setupState); err != nil {
+			log.Printf("[SQLiteRepo] GetNovelDetails - Error unmarshaling setup state: %v", err)
+		} else {
+			details.Characters = setupState.Characters
+		}
+	}
+	return &details, nil
+}
+
+// GetNovelIsAdult возвращает флаг is_adult_content для новеллы.
+func (r *SQLiteNovelRepository) GetNovelIsAdult(ctx context.Context, novelID uuid.UUID) (bool, error) {
+	var isAdult bool
+	err := r.conn().QueryRowContext(ctx, `SELECT is_adult_content FROM novels WHERE novel_id = ?`, novelID).Scan(&isAdult)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return false, fmt.Errorf("novel not found: %w", ErrNotFound)
+		}
+		return false, fmt.Errorf("failed to get is_adult_content flag: %w", err)
+	}
+	return isAdult, nil
+}
+
+// UpdateNovel меняет название и краткое описание новеллы владельца ownerID. Поля обновляются
+// и в колонках, и в config_data, чтобы конфиг новеллы оставался согласованным.
+func (r *SQLiteNovelRepository) UpdateNovel(ctx context.Context, novelID uuid.UUID, ownerID string, title, shortDescription *string) error {
+	// JSON Merge Patch только с переданными полями: nil оставляет поле конфига без изменений
+	patch := make(map[string]string)
+	if title != nil {
+		patch["title"] = *title
+	}
+	if shortDescription != nil {
+		patch["short_description"] = *shortDescription
+	}
+	patchJSON, err := json.Marshal(patch)
+	if err != nil {
+		return fmt.Errorf("failed to marshal novel patch: %w", err)
+	}
+
+	query := `
+		UPDATE novels
+		SET title = COALESCE(?3, title),
+			short_description = COALESCE(?4, short_description),
+			config_data = json_patch(config_data, ?5),
+			updated_at = ?6
+		WHERE novel_id = ?1 AND user_id = ?2
+	`
+	result, err := r.conn().ExecContext(ctx, query, novelID, ownerID, title, shortDescription, string(patchJSON), sqliteNow())
+	if err != nil {
+		log.Printf("[SQLiteRepo] UpdateNovel - Error: %v", err)
+		return fmt.Errorf("failed to update novel: %w", err)
+	}
+	return sqliteRequireRows(result)
+}
+
+// sqliteRequireRows возвращает ErrNotFound, если запрос не затронул ни одной строки
+func sqliteRequireRows(result sql.Result) error {
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get affected rows: %w", err)
+	}
+	if affected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// DeleteNovel удаляет новеллу. Состояния, прогресс игроков, сохранения, доступы и задача сетапа
+// удаляются каскадно (внешние ключи включены в строке подключения); записи расхода модели остаются.
+func (r *SQLiteNovelRepository) DeleteNovel(ctx context.Context, novelID uuid.UUID) error {
+	result, err := r.conn().ExecContext(ctx, `DELETE FROM novels WHERE novel_id = ?`, novelID)
+	if err != nil {
+		log.Printf("[SQLiteRepo] DeleteNovel - Error: %v", err)
+		return fmt.Errorf("failed to delete novel: %w", err)
+	}
+	return sqliteRequireRows(result)
+}
+
+// SetNovelOwner передает новеллу другому пользователю вместе с задачей сетапа.
+func (r *SQLiteNovelRepository) SetNovelOwner(ctx context.Context, novelID uuid.UUID, userID string) error {
+	return r.withTx(ctx, func(tx *SQLiteNovelRepository) error {
+		now := sqliteNow()
+		result, err := tx.conn().ExecContext(ctx, `UPDATE novels SET user_id = ?, updated_at = ? WHERE novel_id = ?`, userID, now, novelID)
+		if err != nil {
+			return fmt.Errorf("failed to update novel owner: %w", err)
+		}
+		if err := sqliteRequireRows(result); err != nil {
+			return err
+		}
+		if _, err := tx.conn().ExecContext(ctx, `UPDATE novel_setup_jobs SET user_id = ?, updated_at = ? WHERE novel_id = ?`, userID, now, novelID); err != nil {
+			return fmt.Errorf("failed to update setup job owner: %w", err)
+		}
+		return nil
+	})
+}
+
+// GetNovelAccess возвращает владельца и видимость новеллы и сообщает, открывал ли userID ссылку на нее
+func (r *SQLiteNovelRepository) GetNovelAccess(ctx context.Context, novelID uuid.UUID, userID string) (*domain.NovelAccess, error) {
+	query := `
+		SELECT n.user_id, n.visibility,
+			EXISTS(SELECT 1 FROM novel_access_grants g WHERE g.novel_id = n.novel_id AND g.user_id = ?2)
+		FROM novels n
+		WHERE n.novel_id = ?1
+	`
+	var access domain.NovelAccess
+	err := r.conn().QueryRowContext(ctx, query, novelID, userID).Scan(&access.OwnerID, &access.Visibility, &access.Granted)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to get novel access: %w", err)
+	}
+	return &access, nil
+}
+
+// SetNovelVisibility меняет видимость новеллы владельца ownerID
+func (r *SQLiteNovelRepository) SetNovelVisibility(ctx context.Context, novelID uuid.UUID, ownerID, visibility string) error {
+	result, err := r.conn().ExecContext(ctx, `UPDATE novels SET visibility = ?, updated_at = ? WHERE novel_id = ? AND user_id = ?`,
+		visibility, sqliteNow(), novelID, ownerID)
+	if err != nil {
+		return fmt.Errorf("failed to set novel visibility: %w", err)
+	}
+	return sqliteRequireRows(result)
+}
+
+// SetNovelShareToken задает токен ссылки на новеллу владельца ownerID.
+// Пустой token отключает ссылку и отзывает доступ всех, кто ее открывал.
+func (r *SQLiteNovelRepository) SetNovelShareToken(ctx context.Context, novelID uuid.UUID, ownerID, token string) error {
+	return r.withTx(ctx, func(tx *SQLiteNovelRepository) error {
+		result, err := tx.conn().ExecContext(ctx, `UPDATE novels SET share_token = NULLIF(?, ''), updated_at = ? WHERE novel_id = ? AND user_id = ?`,
+			token, sqliteNow(), novelID, ownerID)
+		if err != nil {
+			return fmt.Errorf("failed to set share token: %w", err)
+		}
+		if err := sqliteRequireRows(result); err != nil {
+			return err
+		}
+		if token == "" {
+			if _, err := tx.conn().ExecContext(ctx, `DELETE FROM novel_access_grants WHERE novel_id = ?`, novelID); err != nil {
+				return fmt.Errorf("failed to revoke novel access: %w", err)
+			}
+		}
+		return nil
+	})
+}
+
+// GetNovelByShareToken возвращает ID и видимость новеллы по токену ссылки
+func (r *SQLiteNovelRepository) GetNovelByShareToken(ctx context.Context, token string) (uuid.UUID, string, error) {
+	var novelID uuid.UUID
+	var visibility string
+	err := r.conn().QueryRowContext(ctx, `SELECT novel_id, visibility FROM novels WHERE share_token = ?`, token).Scan(&novelID, &visibility)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return uuid.Nil, "", ErrNotFound
+		}
+		return uuid.Nil, "", fmt.Errorf("failed to get novel by share token: %w", err)
+	}
+	return novelID, visibility, nil
+}
+
+// GrantNovelAccess запоминает, что userID открыл ссылку на новеллу
+func (r *SQLiteNovelRepository) GrantNovelAccess(ctx context.Context, novelID uuid.UUID, userID string) error {
+	query := `INSERT INTO novel_access_grants (novel_id, user_id, created_at) VALUES (?, ?, ?) ON CONFLICT DO NOTHING`
+	if _, err := r.conn().ExecContext(ctx, query, novelID, userID, sqliteNow()); err != nil {
+		return fmt.Errorf("failed to grant novel access: %w", err)
+	}
+	return nil
+}
+
+// GetUserNovelProgress возвращает индекс текущей сцены пользователя в новелле
+// или -1, если прогресс не найден.
+func (r *SQLiteNovelRepository) GetUserNovelProgress(ctx context.Context, novelID uuid.UUID, userID string) (sceneIndex int, err error) {
+	query := `SELECT current_scene_index FROM user_novel_progress WHERE novel_id = ? AND user_id = ?`
+	if err := r.conn().QueryRowContext(ctx, query, novelID, userID).Scan(&sceneIndex); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return -1, nil
+		}
+		return -1, fmt.Errorf("failed to get user progress: %w", err)
+	}
+	return sceneIndex, nil
+}
+
+// sqliteStoryProgressArgs возвращает JSON-поля прогресса в порядке колонок user_story_progress
+func sqliteStoryProgressArgs(progress *domain.UserStoryProgress) ([]interface{}, error) {
+	globalFlagsJSON, err := json.Marshal(progress.GlobalFlags)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal global flags: %w", err)
+	}
+	relationshipJSON, err := json.Marshal(progress.Relationship)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal relationship: %w", err)
+	}
+	storyVariablesJSON, err := json.Marshal(progress.StoryVariables)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal story variables: %w", err)
+	}
+	previousChoicesJSON, err := json.Marshal(progress.PreviousChoices)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal previous choices: %w", err)
+	}
+	return []interface{}{string(globalFlagsJSON), string(relationshipJSON), string(storyVariablesJSON), string(previousChoicesJSON)}, nil
+}
+
+// sqliteInsertStoryProgressQuery сохраняет прогресс сцены; при повторном сохранении дата создания остается прежней
+const sqliteInsertStoryProgressQuery = `
+	INSERT INTO user_story_progress (
+		novel_id, user_id, scene_index, global_flags, relationship, story_variables,
+		previous_choices, story_summary_so_far, future_direction, state_hash, created_at, updated_at
+	) VALUES (?1, ?2, ?3, ?4, ?5, ?6, ?7, ?8, ?9, ?10, ?11, ?11)
+	ON CONFLICT (novel_id, user_id, scene_index) DO UPDATE
+	SET global_flags = excluded.global_flags,
+		relationship = excluded.relationship,
+		story_variables = excluded.story_variables,
+		previous_choices = excluded.previous_choices,
+		story_summary_so_far = excluded.story_summary_so_far,
+		future_direction = excluded.future_direction,
+		state_hash = excluded.state_hash,
+		updated_at = excluded.updated_at`
+
+// SaveUserStoryProgress сохраняет динамические элементы прогресса пользователя
+// для конкретной сцены новеллы. Прогресс сцены и текущая сцена сохраняются в одной транзакции.
+func (r *SQLiteNovelRepository) SaveUserStoryProgress(ctx context.Context, novelID uuid.UUID, sceneIndex int, userID string,
+	progress *domain.UserStoryProgress) error {
+	return r.withTx(ctx, func(tx *SQLiteNovelRepository) error {
+		return tx.saveUserStoryProgress(ctx, novelID, sceneIndex, userID, progress)
+	})
+}
+
+// saveUserStoryProgress выполняет SaveUserStoryProgress без собственной транзакции
+func (r *SQLiteNovelRepository) saveUserStoryProgress(ctx context.Context, novelID uuid.UUID, sceneIndex int, userID string,
+	progress *domain.UserStoryProgress) error {
+	if progress == nil {
+		return fmt.Errorf("progress is nil")
+	}
+	if progress.StateHash == "" {
+		return fmt.Errorf("state hash is empty")
+	}
+
+	// Для сцены с индексом 0 проверяем, не сетап ли это
+	if sceneIndex == 0 {
+		if stateData, err := r.GetNovelStateByHash(ctx, progress.StateHash); err == nil && currentStage(stateData) == "setup" {
+			if err := r.SaveNovelSetupState(ctx, novelID, stateData); err != nil {
+				log.Printf("[SQLiteRepo] SaveUserStoryProgress - Warning: failed to save setup state to novels table: %v", err)
+			}
+		}
+	}
+
+	jsonArgs, err := sqliteStoryProgressArgs(progress)
+	if err != nil {
+		return err
+	}
+	now := sqliteNow()
+	args := append([]interface{}{novelID, userID, sceneIndex}, jsonArgs...)
+	args = append(args, progress.StorySummarySoFar, progress.FutureDirection, progress.StateHash, now)
+	if _, err := r.conn().ExecContext(ctx, sqliteInsertStoryProgressQuery, args...); err != nil {
+		log.Printf("[SQLiteRepo] Error saving user story progress: %v", err)
+		return fmt.Errorf("failed to save user story progress: %w", err)
+	}
+
+	if _, err := r.conn().ExecContext(ctx, sqliteAdvanceProgressQuery, novelID, userID, sceneIndex, now); err != nil {
+		log.Printf("[SQLiteRepo] Error updating user progress: %v", err)
+		return fmt.Errorf("failed to update user progress: %w", err)
+	}
+	return nil
+}
+
+// getStoryProgress возвращает прогресс по условию where. Возвращает ErrNotFound, если его нет.
+func (r *SQLiteNovelRepository) getStoryProgress(ctx context.Context, where string, args ...interface{}) (*domain.UserStoryProgress, error) {
+	query := `SELECT ` + userStoryProgressColumns + ` FROM user_story_progress WHERE ` + where + ` LIMIT 1`
+	progress, err := scanUserStoryProgress(r.conn().QueryRowContext(ctx, query, args...))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to get user story progress: %w", err)
+	}
+	return progress, nil
+}
+
+// GetUserStoryProgressByHash возвращает прогресс истории по хешу состояния.
+func (r *SQLiteNovelRepository) GetUserStoryProgressByHash(ctx context.Context, stateHash string) (*domain.UserStoryProgress, error) {
+	return r.getStoryProgress(ctx, `state_hash = ? ORDER BY created_at ASC, rowid ASC`, stateHash)
+}
+
+// GetLatestUserStoryProgress возвращает прогресс пользователя для его текущей сцены.
+// Возвращает nil и -1, если прогресс не найден.
+func (r *SQLiteNovelRepository) GetLatestUserStoryProgress(ctx context.Context, novelID uuid.UUID, userID string) (*domain.UserStoryProgress, int, error) {
+	currentSceneIndex, err := r.GetUserNovelProgress(ctx, novelID, userID)
+	if err != nil || currentSceneIndex < 0 {
+		return nil, -1, err
+	}
+
+	progress, err := r.GetUserStoryProgress(ctx, novelID, userID, currentSceneIndex)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return nil, currentSceneIndex, nil
+		}
+		return nil, -1, err
+	}
+	return progress, currentSceneIndex, nil
+}
+
+// GetUserStoryProgress возвращает прогресс пользователя для конкретной сцены.
+// Возвращает ErrNotFound, если пользователь эту сцену не проходил.
+func (r *SQLiteNovelRepository) GetUserStoryProgress(ctx context.Context, novelID uuid.UUID, userID string, sceneIndex int) (*domain.UserStoryProgress, error) {
+	return r.getStoryProgress(ctx, `novel_id = ? AND user_id = ? AND scene_index = ?`, novelID, userID, sceneIndex)
+}
+
+// ListUserStoryProgress возвращает прогресс пользователя по всем пройденным сценам
+// в порядке индекса сцены.
+func (r *SQLiteNovelRepository) ListUserStoryProgress(ctx context.Context, novelID uuid.UUID, userID string) ([]domain.UserStoryProgress, error) {
+	query := `
+		SELECT ` + userStoryProgressColumns + `
+		FROM user_story_progress
+		WHERE novel_id = ? AND user_id = ?
+		ORDER BY scene_index
+	`
+	rows, err := r.conn().QueryContext(ctx, query, novelID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list user story progress: %w", err)
+	}
+	defer rows.Close()
+
+	track := []domain.UserStoryProgress{}
+	for rows.Next() {
+		progress, err := scanUserStoryProgress(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan user story progress: %w", err)
+		}
+		track = append(track, *progress)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error reading user story progress: %w", err)
+	}
+	return track, nil
+}
+
+// ReplaceUserStoryProgress заменяет весь прогресс пользователя в новелле на track
+// и делает sceneIndex текущей сценой. Выполняется в одной транзакции.
+func (r *SQLiteNovelRepository) ReplaceUserStoryProgress(ctx context.Context, novelID uuid.UUID, userID string, sceneIndex int, track []domain.UserStoryProgress) error {
+	return r.withTx(ctx, func(tx *SQLiteNovelRepository) error {
+		if _, err := tx.conn().ExecContext(ctx, `DELETE FROM user_story_progress WHERE novel_id = ? AND user_id = ?`, novelID, userID); err != nil {
+			return fmt.Errorf("failed to delete user story progress: %w", err)
+		}
+
+		now := sqliteNow()
+		for i := range track {
+			progress := &track[i]
+			jsonArgs, err := sqliteStoryProgressArgs(progress)
+			if err != nil {
+				return err
+			}
+			args := append([]interface{}{novelID, userID, progress.SceneIndex}, jsonArgs...)
+			args = append(args, progress.StorySummarySoFar, progress.FutureDirection, progress.StateHash, now)
+			if _, err := tx.conn().ExecContext(ctx, sqliteInsertStoryProgressQuery, args...); err != nil {
+				return fmt.Errorf("failed to insert user story progress: %w", err)
+			}
+		}
+
+		if _, err := tx.conn().ExecContext(ctx, sqliteSetProgressQuery, novelID, userID, sceneIndex, now); err != nil {
+			return fmt.Errorf("failed to update user progress: %w", err)
+		}
+		return nil
+	})
+}
+
+// GetNovelState возвращает состояние новеллы (stateData) для сцены с указанным хешем.
+// Возвращает ErrNotFound, если такого состояния нет.
+func (r *SQLiteNovelRepository) GetNovelState(ctx context.Context, novelID uuid.UUID, sceneIndex int, stateHash string) (stateData []byte, err error) {
+	query := `SELECT state_data FROM novel_states WHERE novel_id = ? AND scene_index = ? AND state_hash = ?`
+	if err := r.conn().QueryRowContext(ctx, query, novelID, sceneIndex, stateHash).Scan(&stateData); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to get novel state: %w", err)
+	}
+	return stateData, nil
+}
+
+// RewindUserProgress откатывает прогресс пользователя к сцене sceneIndex:
+// удаляет прогресс всех последующих сцен и делает sceneIndex текущей сценой.
+// Сохраненные сцены (novel_states) не удаляются - они общие для всех игроков.
+func (r *SQLiteNovelRepository) RewindUserProgress(ctx context.Context, novelID uuid.UUID, userID string, sceneIndex int) error {
+	return r.withTx(ctx, func(tx *SQLiteNovelRepository) error {
+		query := `DELETE FROM user_story_progress WHERE novel_id = ? AND user_id = ? AND scene_index > ?`
+		if _, err := tx.conn().ExecContext(ctx, query, novelID, userID, sceneIndex); err != nil {
+			return fmt.Errorf("failed to delete user story progress: %w", err)
+		}
+		if _, err := tx.conn().ExecContext(ctx, sqliteSetProgressQuery, novelID, userID, sceneIndex, sqliteNow()); err != nil {
+			return fmt.Errorf("failed to update user progress: %w", err)
+		}
+		return nil
+	})
+}
+
+// DeleteUserProgress удаляет текущую сцену и прогресс всех сцен пользователя в новелле.
+// Сохраненные сцены (novel_states) и сохранения пользователя не удаляются.
+func (r *SQLiteNovelRepository) DeleteUserProgress(ctx context.Context, novelID uuid.UUID, userID string) error {
+	return r.withTx(ctx, func(tx *SQLiteNovelRepository) error {
+		storyResult, err := tx.conn().ExecContext(ctx, `DELETE FROM user_story_progress WHERE novel_id = ? AND user_id = ?`, novelID, userID)
+		if err != nil {
+			return fmt.Errorf("failed to delete user story progress: %w", err)
+		}
+		progressResult, err := tx.conn().ExecContext(ctx, `DELETE FROM user_novel_progress WHERE novel_id = ? AND user_id = ?`, novelID, userID)
+		if err != nil {
+			return fmt.Errorf("failed to delete user progress: %w", err)
+		}
+		if sqliteRequireRows(storyResult) != nil && sqliteRequireRows(progressResult) != nil {
+			return ErrNotFound
+		}
+		return nil
+	})
+}
+
+// ListNovelStateRefs возвращает все сохраненные состояния новеллы (индекс сцены и хеш)
+// в порядке индекса сцены.
+func (r *SQLiteNovelRepository) ListNovelStateRefs(ctx context.Context, novelID uuid.UUID) ([]domain.StoryStateRef, error) {
+	query := `
+		SELECT DISTINCT scene_index, state_hash
+		FROM novel_states
+		WHERE novel_id = ?
+		ORDER BY scene_index, state_hash
+	`
+	rows, err := r.conn().QueryContext(ctx, query, novelID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list novel states: %w", err)
+	}
+	defer rows.Close()
+
+	refs := []domain.StoryStateRef{}
+	for rows.Next() {
+		var ref domain.StoryStateRef
+		if err := rows.Scan(&ref.SceneIndex, &ref.StateHash); err != nil {
+			return nil, fmt.Errorf("failed to scan novel state: %w", err)
+		}
+		refs = append(refs, ref)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error reading novel states: %w", err)
+	}
+	return refs, nil
+}
+
+// ListStoryPathSteps возвращает пути всех игроков новеллы из user_story_progress,
+// упорядоченные по пользователю и индексу сцены.
+func (r *SQLiteNovelRepository) ListStoryPathSteps(ctx context.Context, novelID uuid.UUID) ([]domain.StoryPathStep, error) {
+	query := `
+		SELECT user_id, scene_index, state_hash, previous_choices
+		FROM user_story_progress
+		WHERE novel_id = ?
+		ORDER BY user_id, scene_index
+	`
+	rows, err := r.conn().QueryContext(ctx, query, novelID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list story progress: %w", err)
+	}
+	defer rows.Close()
+
+	steps := []domain.StoryPathStep{}
+	for rows.Next() {
+		var step domain.StoryPathStep
+		var previousChoicesJSON []byte
+		if err := rows.Scan(&step.UserID, &step.SceneIndex, &step.StateHash, &previousChoicesJSON); err != nil {
+			return nil, fmt.Errorf("failed to scan story progress: %w", err)
+		}
+		if err := json.Unmarshal(previousChoicesJSON, &step.PreviousChoices); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal previous choices: %w", err)
+		}
+		steps = append(steps, step)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error reading story progress: %w", err)
+	}
+	return steps, nil
+}
+
+var _ NovelRepository = (*SQLiteNovelRepository)(nil)
@@ -0,0 +1,43 @@
+package repository_test
+
+import (
+	"context"
+	"database/sql"
+	"novel-server/internal/database"
+	"novel-server/internal/domain"
+	"novel-server/internal/repository"
+	"novel-server/internal/repository/repotest"
+	"path/filepath"
+	"testing"
+)
+
+// openTestSQLite создает базу SQLite во временном каталоге теста и применяет к ней миграции
+func openTestSQLite(t *testing.T) *sql.DB {
+	t.Helper()
+	ctx := context.Background()
+
+	db, err := database.OpenSQLite(ctx, filepath.Join(t.TempDir(), "novel.db"))
+	if err != nil {
+		t.Fatalf("OpenSQLite: %v", err)
+	}
+	t.Cleanup(func() { database.CloseSQLite(db) })
+
+	if err := database.RunSQLiteMigrations(ctx, db, "../../migrations/sqlite"); err != nil {
+		t.Fatalf("RunSQLiteMigrations: %v", err)
+	}
+	return db
+}
+
+func TestSQLiteNovelRepository(t *testing.T) {
+	db := openTestSQLite(t)
+	repotest.RunNovelRepositorySuite(t, func(t *testing.T) repository.NovelRepository {
+		return repository.NewSQLiteNovelRepository(db)
+	})
+}
+
+func TestSQLiteNovelDraftRepository(t *testing.T) {
+	db := openTestSQLite(t)
+	repotest.RunNovelDraftRepositorySuite(t, func(t *testing.T) domain.NovelDraftRepository {
+		return repository.NewSQLiteNovelDraftRepository(db)
+	})
+}
@@ -0,0 +1,133 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"novel-server/internal/domain"
+
+	"github.com/google/uuid"
+)
+
+// SQLiteSaveSlotRepository реализация SaveSlotRepository для SQLite
+type SQLiteSaveSlotRepository struct {
+	db *sql.DB
+}
+
+// NewSQLiteSaveSlotRepository создает новый экземпляр SQLiteSaveSlotRepository
+func NewSQLiteSaveSlotRepository(db *sql.DB) *SQLiteSaveSlotRepository {
+	return &SQLiteSaveSlotRepository{db: db}
+}
+
+// UpsertSaveSlot сохраняет слот, перезаписывая слот с тем же именем
+func (r *SQLiteSaveSlotRepository) UpsertSaveSlot(ctx context.Context, slot *domain.SaveSlot) (*domain.SaveSlot, error) {
+	log.Printf("[SaveSlotRepo] UpsertSaveSlot - NovelID: %s, UserID: %s, Name: %s, SceneIndex: %d",
+		slot.NovelID, slot.UserID, slot.Name, slot.SceneIndex)
+
+	progressJSON, err := json.Marshal(slot.Progress)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal save slot progress: %w", err)
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Перезаписанный слот сохраняет свой ID и дату создания
+	query := `
+		INSERT INTO save_slots (slot_id, novel_id, user_id, name, scene_index, progress, created_at, updated_at)
+		VALUES (?1, ?2, ?3, ?4, ?5, ?6, ?7, ?7)
+		ON CONFLICT (novel_id, user_id, name) DO UPDATE
+		SET scene_index = excluded.scene_index,
+			progress = excluded.progress,
+			updated_at = excluded.updated_at`
+	_, err = tx.ExecContext(ctx, query, uuid.New(), slot.NovelID, slot.UserID, slot.Name, slot.SceneIndex, string(progressJSON), sqliteNow())
+	if err != nil {
+		log.Printf("[SaveSlotRepo] UpsertSaveSlot - Error: %v", err)
+		return nil, fmt.Errorf("failed to save slot: %w", err)
+	}
+
+	selectQuery := `SELECT ` + saveSlotColumns + ` FROM save_slots WHERE novel_id = ? AND user_id = ? AND name = ?`
+	saved, err := scanSaveSlot(tx.QueryRowContext(ctx, selectQuery, slot.NovelID, slot.UserID, slot.Name))
+	if err != nil {
+		log.Printf("[SaveSlotRepo] UpsertSaveSlot - Error reading slot: %v", err)
+		return nil, fmt.Errorf("failed to save slot: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	saved.Progress = slot.Progress
+	return saved, nil
+}
+
+// ListSaveSlots возвращает сохранения пользователя в новелле, новые первыми
+func (r *SQLiteSaveSlotRepository) ListSaveSlots(ctx context.Context, novelID uuid.UUID, userID string) ([]domain.SaveSlot, error) {
+	query := `
+		SELECT ` + saveSlotColumns + `
+		FROM save_slots
+		WHERE novel_id = ? AND user_id = ?
+		ORDER BY updated_at DESC`
+
+	rows, err := r.db.QueryContext(ctx, query, novelID, userID)
+	if err != nil {
+		log.Printf("[SaveSlotRepo] ListSaveSlots - Error: %v", err)
+		return nil, fmt.Errorf("failed to list save slots: %w", err)
+	}
+	defer rows.Close()
+
+	slots := []domain.SaveSlot{}
+	for rows.Next() {
+		slot, err := scanSaveSlot(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan save slot: %w", err)
+		}
+		slots = append(slots, *slot)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error reading save slots: %w", err)
+	}
+	return slots, nil
+}
+
+// GetSaveSlot возвращает сохранение вместе с прогрессом
+func (r *SQLiteSaveSlotRepository) GetSaveSlot(ctx context.Context, novelID uuid.UUID, userID string, slotID uuid.UUID) (*domain.SaveSlot, error) {
+	query := `
+		SELECT ` + saveSlotColumns + `, progress
+		FROM save_slots
+		WHERE slot_id = ? AND novel_id = ? AND user_id = ?`
+
+	var slot domain.SaveSlot
+	var progressJSON []byte
+	err := r.db.QueryRowContext(ctx, query, slotID, novelID, userID).Scan(&slot.SlotID, &slot.NovelID, &slot.UserID,
+		&slot.Name, &slot.SceneIndex, &slot.CreatedAt, &slot.UpdatedAt, &progressJSON)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		log.Printf("[SaveSlotRepo] GetSaveSlot - Error: %v", err)
+		return nil, fmt.Errorf("failed to get save slot: %w", err)
+	}
+	if err := json.Unmarshal(progressJSON, &slot.Progress); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal save slot progress: %w", err)
+	}
+	return &slot, nil
+}
+
+// DeleteSaveSlot удаляет сохранение
+func (r *SQLiteSaveSlotRepository) DeleteSaveSlot(ctx context.Context, novelID uuid.UUID, userID string, slotID uuid.UUID) error {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM save_slots WHERE slot_id = ? AND novel_id = ? AND user_id = ?`,
+		slotID, novelID, userID)
+	if err != nil {
+		log.Printf("[SaveSlotRepo] DeleteSaveSlot - Error: %v", err)
+		return fmt.Errorf("failed to delete save slot: %w", err)
+	}
+	return sqliteRequireRows(result)
+}
+
+var _ SaveSlotRepository = (*SQLiteSaveSlotRepository)(nil)
@@ -0,0 +1,268 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"novel-server/internal/domain"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// SQLiteSetupJobRepository реализация SetupJobRepository для SQLite.
+// Транзакции SQLite начинаются с блокировки записи (BEGIN IMMEDIATE), поэтому
+// воркеры забирают задачи по очереди и одна задача не достается двоим.
+type SQLiteSetupJobRepository struct {
+	db *sql.DB
+}
+
+// NewSQLiteSetupJobRepository создает новый экземпляр SQLiteSetupJobRepository
+func NewSQLiteSetupJobRepository(db *sql.DB) *SQLiteSetupJobRepository {
+	return &SQLiteSetupJobRepository{db: db}
+}
+
+// sqliteSetupJobByNovelQuery возвращает задачу новеллы
+const sqliteSetupJobByNovelQuery = `SELECT ` + setupJobColumns + ` FROM novel_setup_jobs WHERE novel_id = ?`
+
+// EnqueueSetupJob ставит сетап новеллы в очередь. Если задача уже есть, возвращает ее.
+func (r *SQLiteSetupJobRepository) EnqueueSetupJob(ctx context.Context, novelID uuid.UUID, userID string, maxAttempts int) (*domain.SetupJob, error) {
+	log.Printf("[SetupJobRepo] EnqueueSetupJob - NovelID: %s, UserID: %s", novelID, userID)
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	now := sqliteNow()
+	query := `
+		INSERT INTO novel_setup_jobs (job_id, novel_id, user_id, max_attempts, run_after, created_at, updated_at)
+		VALUES (?1, ?2, ?3, ?4, ?5, ?5, ?5)
+		ON CONFLICT (novel_id) DO NOTHING`
+	if _, err := tx.ExecContext(ctx, query, uuid.New(), novelID, userID, maxAttempts, now); err != nil {
+		log.Printf("[SetupJobRepo] EnqueueSetupJob - Error: %v", err)
+		return nil, fmt.Errorf("failed to enqueue setup job: %w", err)
+	}
+
+	job, err := scanSetupJob(tx.QueryRowContext(ctx, sqliteSetupJobByNovelQuery, novelID))
+	if err != nil {
+		log.Printf("[SetupJobRepo] EnqueueSetupJob - Error reading job: %v", err)
+		return nil, fmt.Errorf("failed to enqueue setup job: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return job, nil
+}
+
+// ClaimNextSetupJob забирает следующую задачу
+func (r *SQLiteSetupJobRepository) ClaimNextSetupJob(ctx context.Context) (*domain.SetupJob, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	now := sqliteNow()
+	var jobID uuid.UUID
+	err = tx.QueryRowContext(ctx, `
+		SELECT job_id FROM novel_setup_jobs
+		WHERE status = 'queued' AND run_after <= ?
+		ORDER BY run_after
+		LIMIT 1`, now).Scan(&jobID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim setup job: %w", err)
+	}
+
+	query := `
+		UPDATE novel_setup_jobs
+		SET status = 'running', attempts = attempts + 1, locked_at = ?2, updated_at = ?2
+		WHERE job_id = ?1`
+	if _, err := tx.ExecContext(ctx, query, jobID, now); err != nil {
+		return nil, fmt.Errorf("failed to claim setup job: %w", err)
+	}
+
+	job, err := scanSetupJob(tx.QueryRowContext(ctx, `SELECT `+setupJobColumns+` FROM novel_setup_jobs WHERE job_id = ?`, jobID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim setup job: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	log.Printf("[SetupJobRepo] ClaimNextSetupJob - Claimed job %s for NovelID: %s (attempt %d/%d)",
+		job.JobID, job.NovelID, job.Attempts, job.MaxAttempts)
+	return job, nil
+}
+
+// CompleteSetupJob помечает задачу выполненной
+func (r *SQLiteSetupJobRepository) CompleteSetupJob(ctx context.Context, jobID uuid.UUID) error {
+	query := `
+		UPDATE novel_setup_jobs
+		SET status = 'done', last_error = NULL, locked_at = NULL, updated_at = ?
+		WHERE job_id = ?
+	`
+	if _, err := r.db.ExecContext(ctx, query, sqliteNow(), jobID); err != nil {
+		return fmt.Errorf("failed to complete setup job: %w", err)
+	}
+	return nil
+}
+
+// FailSetupJob записывает ошибку попытки и либо планирует повтор, либо помечает задачу упавшей
+func (r *SQLiteSetupJobRepository) FailSetupJob(ctx context.Context, jobID uuid.UUID, lastError string, retryAt *time.Time) error {
+	var err error
+	if retryAt != nil {
+		query := `
+			UPDATE novel_setup_jobs
+			SET status = 'queued', last_error = ?2, run_after = ?3, locked_at = NULL, updated_at = ?4
+			WHERE job_id = ?1
+		`
+		_, err = r.db.ExecContext(ctx, query, jobID, lastError, retryAt.UTC(), sqliteNow())
+	} else {
+		query := `
+			UPDATE novel_setup_jobs
+			SET status = 'failed', last_error = ?2, locked_at = NULL, updated_at = ?3
+			WHERE job_id = ?1
+		`
+		_, err = r.db.ExecContext(ctx, query, jobID, lastError, sqliteNow())
+	}
+	if err != nil {
+		return fmt.Errorf("failed to record setup job failure: %w", err)
+	}
+	return nil
+}
+
+// GetSetupJobByNovelID возвращает задачу новеллы
+func (r *SQLiteSetupJobRepository) GetSetupJobByNovelID(ctx context.Context, novelID uuid.UUID) (*domain.SetupJob, error) {
+	job, err := scanSetupJob(r.db.QueryRowContext(ctx, sqliteSetupJobByNovelQuery, novelID))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to get setup job: %w", err)
+	}
+	return job, nil
+}
+
+// ListUnfinishedSetupJobs возвращает незавершенные задачи пользователя, новые первыми
+func (r *SQLiteSetupJobRepository) ListUnfinishedSetupJobs(ctx context.Context, userID string) ([]domain.SetupJob, error) {
+	query := `
+		SELECT ` + setupJobColumns + `
+		FROM novel_setup_jobs
+		WHERE user_id = ? AND status <> 'done'
+		ORDER BY created_at DESC
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list setup jobs: %w", err)
+	}
+	defer rows.Close()
+
+	jobs := []domain.SetupJob{}
+	for rows.Next() {
+		job, err := scanSetupJob(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan setup job: %w", err)
+		}
+		jobs = append(jobs, *job)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate setup jobs: %w", err)
+	}
+	return jobs, nil
+}
+
+// ListFailedSetupJobs возвращает упавшие задачи всех пользователей вместе с названием новеллы
+func (r *SQLiteSetupJobRepository) ListFailedSetupJobs(ctx context.Context, limit int) ([]domain.FailedSetupJob, error) {
+	query := `
+		SELECT ` + setupJobColumns + `,
+			(SELECT n.title FROM novels n WHERE n.novel_id = novel_setup_jobs.novel_id)
+		FROM novel_setup_jobs
+		WHERE status = 'failed'
+		ORDER BY updated_at DESC
+		LIMIT ?
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list failed setup jobs: %w", err)
+	}
+	defer rows.Close()
+
+	jobs := []domain.FailedSetupJob{}
+	for rows.Next() {
+		var job domain.FailedSetupJob
+		err := rows.Scan(&job.JobID, &job.NovelID, &job.UserID, &job.Status, &job.Attempts, &job.MaxAttempts,
+			&job.LastError, &job.RunAfter, &job.LockedAt, &job.CreatedAt, &job.UpdatedAt, &job.NovelTitle)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan setup job: %w", err)
+		}
+		jobs = append(jobs, job)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate setup jobs: %w", err)
+	}
+	return jobs, nil
+}
+
+// RetrySetupJob возвращает упавшую задачу в очередь
+func (r *SQLiteSetupJobRepository) RetrySetupJob(ctx context.Context, novelID uuid.UUID) (*domain.SetupJob, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	query := `
+		UPDATE novel_setup_jobs
+		SET status = 'queued', attempts = 0, run_after = ?2, locked_at = NULL, updated_at = ?2
+		WHERE novel_id = ?1 AND status = 'failed'`
+	result, err := tx.ExecContext(ctx, query, novelID, sqliteNow())
+	if err != nil {
+		return nil, fmt.Errorf("failed to retry setup job: %w", err)
+	}
+	if err := sqliteRequireRows(result); err != nil {
+		return nil, err
+	}
+
+	job, err := scanSetupJob(tx.QueryRowContext(ctx, sqliteSetupJobByNovelQuery, novelID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to retry setup job: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	log.Printf("[SetupJobRepo] RetrySetupJob - Requeued failed job %s for NovelID: %s", job.JobID, novelID)
+	return job, nil
+}
+
+// RequeueStaleSetupJobs возвращает в очередь зависшие задачи
+func (r *SQLiteSetupJobRepository) RequeueStaleSetupJobs(ctx context.Context, staleAfter time.Duration) (int, error) {
+	now := sqliteNow()
+	query := `
+		UPDATE novel_setup_jobs
+		SET status = 'queued', run_after = ?1, locked_at = NULL, updated_at = ?1,
+			last_error = COALESCE(last_error, 'worker stopped before finishing the job')
+		WHERE status = 'running' AND locked_at < ?2
+	`
+	result, err := r.db.ExecContext(ctx, query, now, now.Add(-staleAfter))
+	if err != nil {
+		return 0, fmt.Errorf("failed to requeue stale setup jobs: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get affected rows: %w", err)
+	}
+	return int(affected), nil
+}
+
+var _ SetupJobRepository = (*SQLiteSetupJobRepository)(nil)
@@ -0,0 +1,116 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"novel-server/internal/domain"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// SQLiteUsageRepository реализация UsageRepository для SQLite
+type SQLiteUsageRepository struct {
+	db *sql.DB
+}
+
+// NewSQLiteUsageRepository создает новый экземпляр SQLiteUsageRepository
+func NewSQLiteUsageRepository(db *sql.DB) *SQLiteUsageRepository {
+	return &SQLiteUsageRepository{db: db}
+}
+
+// sqliteUsageGroupKeys - выражения ключа группировки для SummarizeLLMUsage.
+// Время хранится строкой в UTC, поэтому дата - первые 10 символов created_at
+var sqliteUsageGroupKeys = map[string]string{
+	domain.LLMUsageByUser:  `user_id`,
+	domain.LLMUsageByNovel: `COALESCE(novel_id, '')`,
+	domain.LLMUsageByDay:   `substr(created_at, 1, 10)`,
+}
+
+// RecordLLMUsage сохраняет запись об одном вызове модели
+func (r *SQLiteUsageRepository) RecordLLMUsage(ctx context.Context, usage *domain.LLMUsage) error {
+	usageID := uuid.New()
+	now := sqliteNow()
+	query := `
+		INSERT INTO llm_usage (usage_id, user_id, novel_id, operation, provider, model,
+			prompt_tokens, completion_tokens, total_tokens, cost, latency_ms, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+
+	_, err := r.db.ExecContext(ctx, query, usageID, usage.UserID, usage.NovelID, usage.Operation, usage.Provider, usage.Model,
+		usage.PromptTokens, usage.CompletionTokens, usage.TotalTokens, usage.Cost, usage.LatencyMs, now)
+	if err != nil {
+		log.Printf("[UsageRepo] RecordLLMUsage - Error: %v", err)
+		return fmt.Errorf("failed to record llm usage: %w", err)
+	}
+	usage.UsageID = usageID
+	usage.CreatedAt = now
+	return nil
+}
+
+// SummarizeLLMUsage возвращает агрегаты использования модели за период
+func (r *SQLiteUsageRepository) SummarizeLLMUsage(ctx context.Context, groupBy string, filter domain.LLMUsageFilter) ([]domain.LLMUsageSummary, error) {
+	key, ok := sqliteUsageGroupKeys[groupBy]
+	if !ok {
+		return nil, fmt.Errorf("unknown usage grouping %q", groupBy)
+	}
+
+	orderBy := `SUM(total_tokens) DESC, usage_key`
+	if groupBy == domain.LLMUsageByDay {
+		orderBy = `usage_key`
+	}
+
+	// Пустые фильтры пользователя и новеллы отключаются через проверку параметра на NULL/пустоту
+	query := `
+		SELECT ` + key + ` AS usage_key,
+			COUNT(*),
+			COALESCE(SUM(prompt_tokens), 0),
+			COALESCE(SUM(completion_tokens), 0),
+			COALESCE(SUM(total_tokens), 0),
+			CAST(COALESCE(SUM(cost), 0) AS REAL),
+			CAST(COALESCE(AVG(latency_ms), 0) AS INTEGER)
+		FROM llm_usage
+		WHERE created_at >= ?1 AND created_at < ?2
+			AND (?3 = '' OR user_id = ?3)
+			AND (?4 IS NULL OR novel_id = ?4)
+		GROUP BY usage_key
+		ORDER BY ` + orderBy + `
+		LIMIT ?5`
+
+	rows, err := r.db.QueryContext(ctx, query, filter.From.UTC(), filter.To.UTC(), filter.UserID, filter.NovelID, filter.Limit)
+	if err != nil {
+		log.Printf("[UsageRepo] SummarizeLLMUsage - Error: %v", err)
+		return nil, fmt.Errorf("failed to summarize llm usage: %w", err)
+	}
+	defer rows.Close()
+
+	summaries := []domain.LLMUsageSummary{}
+	for rows.Next() {
+		var summary domain.LLMUsageSummary
+		if err := rows.Scan(&summary.Key, &summary.Calls, &summary.PromptTokens, &summary.CompletionTokens,
+			&summary.TotalTokens, &summary.Cost, &summary.AvgLatencyMs); err != nil {
+			return nil, fmt.Errorf("failed to scan llm usage summary: %w", err)
+		}
+		summaries = append(summaries, summary)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error reading llm usage summary: %w", err)
+	}
+	return summaries, nil
+}
+
+// CountUserTokens возвращает число токенов, израсходованных пользователем начиная с from
+func (r *SQLiteUsageRepository) CountUserTokens(ctx context.Context, userID string, from time.Time) (int64, error) {
+	var total int64
+	err := r.db.QueryRowContext(ctx,
+		`SELECT COALESCE(SUM(total_tokens), 0) FROM llm_usage WHERE user_id = ? AND created_at >= ?`,
+		userID, from.UTC()).Scan(&total)
+	if err != nil {
+		log.Printf("[UsageRepo] CountUserTokens - Error: %v", err)
+		return 0, fmt.Errorf("failed to count user tokens: %w", err)
+	}
+	return total, nil
+}
+
+var _ UsageRepository = (*SQLiteUsageRepository)(nil)
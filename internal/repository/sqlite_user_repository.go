@@ -0,0 +1,228 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"novel-server/internal/domain"
+
+	"github.com/google/uuid"
+)
+
+// SQLiteUserRepository реализация UserRepository для SQLite
+type SQLiteUserRepository struct {
+	db *sql.DB
+}
+
+// NewSQLiteUserRepository создает новый экземпляр SQLiteUserRepository
+func NewSQLiteUserRepository(db *sql.DB) *SQLiteUserRepository {
+	return &SQLiteUserRepository{db: db}
+}
+
+// CreateUser создает учетную запись
+func (r *SQLiteUserRepository) CreateUser(ctx context.Context, user *domain.User) error {
+	log.Printf("[UserRepo] CreateUser - Username: %s", user.Username)
+
+	userID := uuid.New()
+	now := sqliteNow()
+	query := `
+		INSERT INTO users (user_id, username, password_hash, role, created_at, updated_at)
+		VALUES (?1, ?2, ?3, ?4, ?5, ?5)`
+
+	if _, err := r.db.ExecContext(ctx, query, userID, user.Username, user.PasswordHash, user.Role, now); err != nil {
+		if isSQLiteUniqueViolation(err) {
+			return ErrAlreadyExists
+		}
+		log.Printf("[UserRepo] CreateUser - Error: %v", err)
+		return fmt.Errorf("failed to create user: %w", err)
+	}
+	user.UserID = userID
+	user.CreatedAt = now
+	user.UpdatedAt = now
+	return nil
+}
+
+// getUser возвращает учетную запись по условию where. Возвращает ErrNotFound, если ее нет.
+func (r *SQLiteUserRepository) getUser(ctx context.Context, where string, arg any) (*domain.User, error) {
+	query := `SELECT ` + userColumns + ` FROM users WHERE ` + where
+
+	user, err := scanUser(r.db.QueryRowContext(ctx, query, arg))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		log.Printf("[UserRepo] getUser - Error: %v", err)
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+	return user, nil
+}
+
+// GetUserByUsername ищет учетную запись по логину без учета регистра
+func (r *SQLiteUserRepository) GetUserByUsername(ctx context.Context, username string) (*domain.User, error) {
+	return r.getUser(ctx, `LOWER(username) = LOWER(?)`, username)
+}
+
+// GetUserByID возвращает учетную запись по ID
+func (r *SQLiteUserRepository) GetUserByID(ctx context.Context, userID uuid.UUID) (*domain.User, error) {
+	return r.getUser(ctx, `user_id = ?`, userID)
+}
+
+// ListUsers возвращает учетные записи, новые первыми
+func (r *SQLiteUserRepository) ListUsers(ctx context.Context, limit, offset int) ([]domain.User, error) {
+	query := `SELECT ` + userColumns + ` FROM users ORDER BY created_at DESC, user_id LIMIT ? OFFSET ?`
+
+	rows, err := r.db.QueryContext(ctx, query, limit, offset)
+	if err != nil {
+		log.Printf("[UserRepo] ListUsers - Error: %v", err)
+		return nil, fmt.Errorf("failed to list users: %w", err)
+	}
+	defer rows.Close()
+
+	users := []domain.User{}
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan user: %w", err)
+		}
+		users = append(users, *user)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error reading users: %w", err)
+	}
+	return users, nil
+}
+
+// SetUserRole меняет роль учетной записи
+func (r *SQLiteUserRepository) SetUserRole(ctx context.Context, userID uuid.UUID, role string) error {
+	log.Printf("[UserRepo] SetUserRole - UserID: %s, Role: %s", userID, role)
+
+	result, err := r.db.ExecContext(ctx, `UPDATE users SET role = ?, updated_at = ? WHERE user_id = ?`, role, sqliteNow(), userID)
+	if err != nil {
+		log.Printf("[UserRepo] SetUserRole - Error: %v", err)
+		return fmt.Errorf("failed to set user role: %w", err)
+	}
+	return sqliteRequireRows(result)
+}
+
+// SetUserDisabled блокирует или разблокирует учетную запись.
+// При блокировке в той же транзакции отзываются все refresh-токены пользователя.
+func (r *SQLiteUserRepository) SetUserDisabled(ctx context.Context, userID uuid.UUID, disabled bool) error {
+	log.Printf("[UserRepo] SetUserDisabled - UserID: %s, Disabled: %t", userID, disabled)
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Повторная блокировка не сдвигает время первой
+	now := sqliteNow()
+	query := `UPDATE users SET disabled_at = CASE WHEN ?2 THEN COALESCE(disabled_at, ?3) END, updated_at = ?3 WHERE user_id = ?1`
+	result, err := tx.ExecContext(ctx, query, userID, disabled, now)
+	if err != nil {
+		log.Printf("[UserRepo] SetUserDisabled - Error: %v", err)
+		return fmt.Errorf("failed to update user: %w", err)
+	}
+	if err := sqliteRequireRows(result); err != nil {
+		return err
+	}
+
+	if disabled {
+		_, err = tx.ExecContext(ctx, `UPDATE refresh_tokens SET revoked_at = ? WHERE user_id = ? AND revoked_at IS NULL`, now, userID)
+		if err != nil {
+			log.Printf("[UserRepo] SetUserDisabled - Error revoking tokens: %v", err)
+			return fmt.Errorf("failed to revoke refresh tokens: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// insertRefreshToken сохраняет refresh-токен и заполняет его ID и время создания
+func insertRefreshToken(ctx context.Context, db sqliteConn, token *domain.RefreshToken, tokenHash string) error {
+	tokenID := uuid.New()
+	now := sqliteNow()
+	query := `
+		INSERT INTO refresh_tokens (token_id, user_id, family_id, token_hash, expires_at, created_at)
+		VALUES (?, ?, ?, ?, ?, ?)`
+	if _, err := db.ExecContext(ctx, query, tokenID, token.UserID, token.FamilyID, tokenHash, token.ExpiresAt.UTC(), now); err != nil {
+		return err
+	}
+	token.TokenID = tokenID
+	token.CreatedAt = now
+	return nil
+}
+
+// CreateRefreshToken сохраняет хеш нового refresh-токена.
+// Заодно удаляет истекшие токены пользователя, чтобы таблица не росла.
+func (r *SQLiteUserRepository) CreateRefreshToken(ctx context.Context, token *domain.RefreshToken, tokenHash string) error {
+	if _, err := r.db.ExecContext(ctx, `DELETE FROM refresh_tokens WHERE user_id = ? AND expires_at < ?`, token.UserID, sqliteNow()); err != nil {
+		log.Printf("[UserRepo] CreateRefreshToken - Warning: failed to delete expired tokens: %v", err)
+	}
+
+	if err := insertRefreshToken(ctx, r.db, token, tokenHash); err != nil {
+		log.Printf("[UserRepo] CreateRefreshToken - Error: %v", err)
+		return fmt.Errorf("failed to create refresh token: %w", err)
+	}
+	return nil
+}
+
+// GetRefreshToken возвращает refresh-токен по хешу
+func (r *SQLiteUserRepository) GetRefreshToken(ctx context.Context, tokenHash string) (*domain.RefreshToken, error) {
+	query := `SELECT ` + refreshTokenColumns + ` FROM refresh_tokens WHERE token_hash = ?`
+
+	token, err := scanRefreshToken(r.db.QueryRowContext(ctx, query, tokenHash))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		log.Printf("[UserRepo] GetRefreshToken - Error: %v", err)
+		return nil, fmt.Errorf("failed to get refresh token: %w", err)
+	}
+	return token, nil
+}
+
+// RotateRefreshToken отзывает старый токен и сохраняет новый в одной транзакции
+func (r *SQLiteUserRepository) RotateRefreshToken(ctx context.Context, oldTokenID uuid.UUID, next *domain.RefreshToken, nextHash string) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, `UPDATE refresh_tokens SET revoked_at = ? WHERE token_id = ? AND revoked_at IS NULL`, sqliteNow(), oldTokenID)
+	if err != nil {
+		log.Printf("[UserRepo] RotateRefreshToken - Error revoking token: %v", err)
+		return fmt.Errorf("failed to revoke refresh token: %w", err)
+	}
+	if err := sqliteRequireRows(result); err != nil {
+		return err
+	}
+
+	if err := insertRefreshToken(ctx, tx, next, nextHash); err != nil {
+		log.Printf("[UserRepo] RotateRefreshToken - Error creating token: %v", err)
+		return fmt.Errorf("failed to create refresh token: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// RevokeRefreshTokenFamily отзывает все действующие токены семейства
+func (r *SQLiteUserRepository) RevokeRefreshTokenFamily(ctx context.Context, familyID uuid.UUID) error {
+	_, err := r.db.ExecContext(ctx, `UPDATE refresh_tokens SET revoked_at = ? WHERE family_id = ? AND revoked_at IS NULL`, sqliteNow(), familyID)
+	if err != nil {
+		log.Printf("[UserRepo] RevokeRefreshTokenFamily - Error: %v", err)
+		return fmt.Errorf("failed to revoke refresh tokens: %w", err)
+	}
+	return nil
+}
+
+var _ UserRepository = (*SQLiteUserRepository)(nil)
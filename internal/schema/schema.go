@@ -0,0 +1,140 @@
+// Package schema содержит JSON-схемы ответов моделей и проверку ответов по ним.
+package schema
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/santhosh-tekuri/jsonschema/v6"
+	"golang.org/x/text/language"
+	"golang.org/x/text/message"
+)
+
+// Name - имя встроенной схемы
+type Name string
+
+const (
+	// NarratorConfig - конфигурация новеллы, которую генерирует нарратор (промпт narrator)
+	NarratorConfig Name = "narrator_config"
+	// NarratorConfigPatch - изменения конфигурации при уточнении черновика (промпт narrator_refine)
+	NarratorConfigPatch Name = "narrator_config_patch"
+	// SetupResponse - ответ novel_creator на этапе setup
+	SetupResponse Name = "setup_response"
+	// SceneResponse - ответ novel_creator с очередной сценой (или current_stage: complete)
+	SceneResponse Name = "scene_response"
+)
+
+//go:embed schemas/*.json
+var schemaFiles embed.FS
+
+// schemaBaseURL - базовый адрес, под которым схемы регистрируются в компиляторе
+const schemaBaseURL = "https://novel-server.local/schemas/"
+
+var (
+	compileOnce sync.Once
+	compiled    map[Name]*jsonschema.Schema
+	compileErr  error
+	printer     = message.NewPrinter(language.English)
+)
+
+// ValidationError - ответ модели не прошел проверку по схеме.
+// Issues содержит по одной строке на каждое нарушение в виде "/путь: описание".
+type ValidationError struct {
+	Schema Name
+	Issues []string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("response does not match %s schema: %s", e.Schema, strings.Join(e.Issues, "; "))
+}
+
+// Validate проверяет JSON-документ по схеме name.
+// Возвращает *ValidationError, если документ не соответствует схеме,
+// и обычную ошибку, если документ не является корректным JSON.
+func Validate(name Name, data []byte) error {
+	schemas, err := loadSchemas()
+	if err != nil {
+		return err
+	}
+	sch, ok := schemas[name]
+	if !ok {
+		return fmt.Errorf("unknown schema %q", name)
+	}
+
+	doc, err := jsonschema.UnmarshalJSON(strings.NewReader(string(data)))
+	if err != nil {
+		return fmt.Errorf("invalid JSON: %w", err)
+	}
+
+	err = sch.Validate(doc)
+	if err == nil {
+		return nil
+	}
+	validationErr, ok := err.(*jsonschema.ValidationError)
+	if !ok {
+		return err
+	}
+	return &ValidationError{Schema: name, Issues: collectIssues(validationErr)}
+}
+
+// loadSchemas компилирует встроенные схемы при первом обращении
+func loadSchemas() (map[Name]*jsonschema.Schema, error) {
+	compileOnce.Do(func() {
+		compiler := jsonschema.NewCompiler()
+		names := []Name{NarratorConfig, NarratorConfigPatch, SetupResponse, SceneResponse}
+		for _, name := range names {
+			raw, err := schemaFiles.ReadFile("schemas/" + string(name) + ".json")
+			if err != nil {
+				compileErr = fmt.Errorf("failed to read schema %s: %w", name, err)
+				return
+			}
+			var doc interface{}
+			if err := json.Unmarshal(raw, &doc); err != nil {
+				compileErr = fmt.Errorf("failed to parse schema %s: %w", name, err)
+				return
+			}
+			if err := compiler.AddResource(schemaBaseURL+string(name)+".json", doc); err != nil {
+				compileErr = fmt.Errorf("failed to add schema %s: %w", name, err)
+				return
+			}
+		}
+
+		compiled = make(map[Name]*jsonschema.Schema, len(names))
+		for _, name := range names {
+			sch, err := compiler.Compile(schemaBaseURL + string(name) + ".json")
+			if err != nil {
+				compileErr = fmt.Errorf("failed to compile schema %s: %w", name, err)
+				return
+			}
+			compiled[name] = sch
+		}
+	})
+	return compiled, compileErr
+}
+
+// collectIssues собирает конечные (самые конкретные) нарушения из дерева ошибок валидации
+func collectIssues(err *jsonschema.ValidationError) []string {
+	seen := make(map[string]bool)
+	var issues []string
+	var walk func(e *jsonschema.ValidationError)
+	walk = func(e *jsonschema.ValidationError) {
+		if len(e.Causes) > 0 {
+			for _, cause := range e.Causes {
+				walk(cause)
+			}
+			return
+		}
+		issue := fmt.Sprintf("/%s: %s", strings.Join(e.InstanceLocation, "/"), e.ErrorKind.LocalizedString(printer))
+		if !seen[issue] {
+			seen[issue] = true
+			issues = append(issues, issue)
+		}
+	}
+	walk(err)
+	sort.Strings(issues)
+	return issues
+}
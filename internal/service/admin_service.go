@@ -0,0 +1,127 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log"
+	"novel-server/internal/domain"
+	"novel-server/internal/repository"
+
+	"github.com/google/uuid"
+)
+
+// Ошибки административного API, которые обработчики переводят в HTTP-статусы
+var (
+	ErrUserNotFound     = errors.New("user not found")
+	ErrInvalidRole      = errors.New("role must be one of: player, author, moderator, admin")
+	ErrCannotChangeSelf = errors.New("administrators cannot change their own role or disable themselves")
+	ErrUserDisabled     = errors.New("user is disabled")
+)
+
+// Ограничения постраничных списков административного API
+const (
+	defaultAdminListLimit = 50
+	maxAdminListLimit     = 500
+)
+
+// AdminService - операции модераторов и администраторов над пользователями и новеллами.
+// Права проверяются на уровне маршрутов (RequireRole).
+type AdminService struct {
+	users     repository.UserRepository
+	novelRepo repository.NovelRepository
+	setupJobs repository.SetupJobRepository
+}
+
+// NewAdminService создает новый экземпляр сервиса
+func NewAdminService(users repository.UserRepository, novelRepo repository.NovelRepository, setupJobs repository.SetupJobRepository) *AdminService {
+	return &AdminService{users: users, novelRepo: novelRepo, setupJobs: setupJobs}
+}
+
+// adminListLimit приводит лимит списка к допустимому диапазону
+func adminListLimit(limit int) int {
+	if limit <= 0 {
+		return defaultAdminListLimit
+	}
+	return min(limit, maxAdminListLimit)
+}
+
+// ListUsers возвращает учетные записи, новые первыми
+func (s *AdminService) ListUsers(ctx context.Context, limit, offset int) ([]domain.User, error) {
+	return s.users.ListUsers(ctx, adminListLimit(limit), max(offset, 0))
+}
+
+// SetUserRole меняет роль пользователя. Новая роль попадет в токен при его следующем обновлении.
+func (s *AdminService) SetUserRole(ctx context.Context, actorID string, userID uuid.UUID, role string) error {
+	if !domain.IsValidRole(role) {
+		return ErrInvalidRole
+	}
+	// Администратор не может понизить сам себя и остаться без доступа к админке
+	if actorID == userID.String() {
+		return ErrCannotChangeSelf
+	}
+	if err := s.users.SetUserRole(ctx, userID, role); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return ErrUserNotFound
+		}
+		return err
+	}
+	log.Printf("[AdminService] UserID %s set role of UserID %s to '%s'", actorID, userID, role)
+	return nil
+}
+
+// SetUserDisabled блокирует или разблокирует пользователя. Блокировка отзывает все refresh-токены,
+// поэтому войти и обновить токен нельзя; уже выданный access-токен действует до истечения срока.
+func (s *AdminService) SetUserDisabled(ctx context.Context, actorID string, userID uuid.UUID, disabled bool) error {
+	if actorID == userID.String() {
+		return ErrCannotChangeSelf
+	}
+	if err := s.users.SetUserDisabled(ctx, userID, disabled); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return ErrUserNotFound
+		}
+		return err
+	}
+	log.Printf("[AdminService] UserID %s set disabled=%t for UserID %s", actorID, disabled, userID)
+	return nil
+}
+
+// DeleteNovel удаляет любую новеллу вместе с прогрессом и сохранениями всех игроков
+func (s *AdminService) DeleteNovel(ctx context.Context, actorID string, novelID uuid.UUID) error {
+	if err := s.novelRepo.DeleteNovel(ctx, novelID); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return ErrNovelNotFound
+		}
+		return err
+	}
+	log.Printf("[AdminService] UserID %s force-deleted NovelID %s", actorID, novelID)
+	return nil
+}
+
+// SetNovelOwner передает новеллу другому пользователю. Новый владелец должен существовать
+// и не быть заблокированным.
+func (s *AdminService) SetNovelOwner(ctx context.Context, actorID string, novelID, ownerID uuid.UUID) error {
+	owner, err := s.users.GetUserByID(ctx, ownerID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return ErrUserNotFound
+		}
+		return err
+	}
+	if owner.DisabledAt != nil {
+		return ErrUserDisabled
+	}
+
+	if err := s.novelRepo.SetNovelOwner(ctx, novelID, owner.UserID.String()); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return ErrNovelNotFound
+		}
+		return err
+	}
+	log.Printf("[AdminService] UserID %s reassigned NovelID %s to UserID %s", actorID, novelID, ownerID)
+	return nil
+}
+
+// ListFailedGenerations возвращает задачи сетапа, исчерпавшие все попытки, последние первыми
+func (s *AdminService) ListFailedGenerations(ctx context.Context, limit int) ([]domain.FailedSetupJob, error) {
+	return s.setupJobs.ListFailedSetupJobs(ctx, adminListLimit(limit))
+}
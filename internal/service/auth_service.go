@@ -0,0 +1,220 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"novel-server/internal/auth"
+	"novel-server/internal/domain"
+	"novel-server/internal/repository"
+	"regexp"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Ограничения учетных данных. bcrypt учитывает только первые 72 байта пароля
+const (
+	minPasswordLength = 8
+	maxPasswordBytes  = 72
+)
+
+// usernamePattern - допустимый логин: 3-50 латинских букв, цифр и символов . _ -
+var usernamePattern = regexp.MustCompile(`^[a-zA-Z0-9._-]{3,50}$`)
+
+// Ошибки аутентификации, которые обработчики переводят в HTTP-статусы
+var (
+	ErrInvalidUsername     = errors.New("username must be 3-50 characters: letters, digits, '.', '_' or '-'")
+	ErrWeakPassword        = fmt.Errorf("password must be %d to %d bytes long", minPasswordLength, maxPasswordBytes)
+	ErrUsernameTaken       = errors.New("username is already taken")
+	ErrInvalidCredentials  = errors.New("invalid username or password")
+	ErrInvalidRefreshToken = errors.New("invalid or expired refresh token")
+	ErrAccountDisabled     = errors.New("account is disabled")
+	ErrUnknownAccount      = errors.New("account does not exist")
+)
+
+// AuthService отвечает за учетные записи, вход и выдачу токенов
+type AuthService struct {
+	users repository.UserRepository
+}
+
+// NewAuthService создает новый экземпляр сервиса
+func NewAuthService(users repository.UserRepository) *AuthService {
+	return &AuthService{users: users}
+}
+
+// Register создает учетную запись и сразу выполняет вход
+func (s *AuthService) Register(ctx context.Context, username, password string) (*domain.User, *domain.AuthTokens, error) {
+	if !usernamePattern.MatchString(username) {
+		return nil, nil, ErrInvalidUsername
+	}
+	if len(password) < minPasswordLength || len(password) > maxPasswordBytes {
+		return nil, nil, ErrWeakPassword
+	}
+
+	hash, err := auth.HashPassword(password)
+	if err != nil {
+		return nil, nil, err
+	}
+	user := &domain.User{Username: username, PasswordHash: hash, Role: domain.DefaultUserRole}
+	if err := s.users.CreateUser(ctx, user); err != nil {
+		if errors.Is(err, repository.ErrAlreadyExists) {
+			return nil, nil, ErrUsernameTaken
+		}
+		return nil, nil, err
+	}
+	log.Printf("[AuthService] Registered user %s (%s)", user.Username, user.UserID)
+
+	tokens, err := s.issueTokens(ctx, user, uuid.New())
+	if err != nil {
+		return nil, nil, err
+	}
+	return user, tokens, nil
+}
+
+// Login проверяет логин и пароль и выдает новую пару токенов (новое семейство refresh-токенов)
+func (s *AuthService) Login(ctx context.Context, username, password string) (*domain.AuthTokens, error) {
+	user, err := s.users.GetUserByUsername(ctx, username)
+	if err != nil && !errors.Is(err, repository.ErrNotFound) {
+		return nil, err
+	}
+
+	hash := ""
+	if user != nil {
+		hash = user.PasswordHash
+	}
+	// Для несуществующего логина пароль тоже проверяется, чтобы время ответа было одинаковым
+	if !auth.CheckPassword(hash, password) {
+		log.Printf("[AuthService] Failed login for username '%s'", username)
+		return nil, ErrInvalidCredentials
+	}
+	if user.DisabledAt != nil {
+		log.Printf("[AuthService] Login attempt for disabled user %s", user.UserID)
+		return nil, ErrAccountDisabled
+	}
+
+	return s.issueTokens(ctx, user, uuid.New())
+}
+
+// Refresh обменивает refresh-токен на новую пару токенов. Старый токен отзывается.
+// Роль берется из учетной записи, поэтому новый access-токен получает актуальную роль.
+// Предъявление уже отозванного токена означает, что он мог быть украден: тогда отзывается
+// все семейство, и владельцу придется войти заново.
+func (s *AuthService) Refresh(ctx context.Context, refreshToken string) (*domain.AuthTokens, error) {
+	token, err := s.users.GetRefreshToken(ctx, auth.HashRefreshToken(refreshToken))
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, ErrInvalidRefreshToken
+		}
+		return nil, err
+	}
+
+	if token.RevokedAt != nil {
+		log.Printf("[AuthService] Reuse of revoked refresh token for UserID %s, revoking family %s", token.UserID, token.FamilyID)
+		if err := s.users.RevokeRefreshTokenFamily(ctx, token.FamilyID); err != nil {
+			return nil, err
+		}
+		return nil, ErrInvalidRefreshToken
+	}
+	if time.Now().After(token.ExpiresAt) {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	user, err := s.users.GetUserByID(ctx, token.UserID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, ErrInvalidRefreshToken
+		}
+		return nil, err
+	}
+	if user.DisabledAt != nil {
+		return nil, ErrAccountDisabled
+	}
+
+	nextToken, err := auth.NewRefreshToken()
+	if err != nil {
+		return nil, err
+	}
+	next := &domain.RefreshToken{
+		UserID:    user.UserID,
+		FamilyID:  token.FamilyID,
+		ExpiresAt: time.Now().Add(auth.RefreshTokenTTL()),
+	}
+	if err := s.users.RotateRefreshToken(ctx, token.TokenID, next, auth.HashRefreshToken(nextToken)); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			// Токен только что обновили параллельным запросом
+			return nil, ErrInvalidRefreshToken
+		}
+		return nil, err
+	}
+
+	return s.accessTokens(user, nextToken)
+}
+
+// Logout отзывает семейство refresh-токена, то есть завершает этот вход.
+// Уже выданный access-токен действует до истечения своего короткого срока.
+// Неизвестный токен не считается ошибкой.
+func (s *AuthService) Logout(ctx context.Context, refreshToken string) error {
+	token, err := s.users.GetRefreshToken(ctx, auth.HashRefreshToken(refreshToken))
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil
+		}
+		return err
+	}
+	log.Printf("[AuthService] Logout for UserID %s, revoking family %s", token.UserID, token.FamilyID)
+	return s.users.RevokeRefreshTokenFamily(ctx, token.FamilyID)
+}
+
+// CheckAccount проверяет, что учетная запись из access-токена существует и не заблокирована.
+// Access-токен не отзывается, поэтому без этой проверки заблокированный пользователь
+// сохранял бы доступ до истечения срока токена.
+func (s *AuthService) CheckAccount(ctx context.Context, userID string) error {
+	id, err := uuid.Parse(userID)
+	if err != nil {
+		return ErrUnknownAccount
+	}
+	user, err := s.users.GetUserByID(ctx, id)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return ErrUnknownAccount
+		}
+		return err
+	}
+	if user.DisabledAt != nil {
+		return ErrAccountDisabled
+	}
+	return nil
+}
+
+// issueTokens создает refresh-токен в семействе familyID и access-токен
+func (s *AuthService) issueTokens(ctx context.Context, user *domain.User, familyID uuid.UUID) (*domain.AuthTokens, error) {
+	refreshToken, err := auth.NewRefreshToken()
+	if err != nil {
+		return nil, err
+	}
+	token := &domain.RefreshToken{
+		UserID:    user.UserID,
+		FamilyID:  familyID,
+		ExpiresAt: time.Now().Add(auth.RefreshTokenTTL()),
+	}
+	if err := s.users.CreateRefreshToken(ctx, token, auth.HashRefreshToken(refreshToken)); err != nil {
+		return nil, err
+	}
+	return s.accessTokens(user, refreshToken)
+}
+
+// accessTokens выпускает access-токен и собирает ответ с уже созданным refresh-токеном
+func (s *AuthService) accessTokens(user *domain.User, refreshToken string) (*domain.AuthTokens, error) {
+	accessToken, err := auth.GenerateToken(user.UserID.String(), user.Username, user.Role)
+	if err != nil {
+		return nil, err
+	}
+	return &domain.AuthTokens{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(auth.AccessTokenTTL().Seconds()),
+	}, nil
+}
@@ -0,0 +1,197 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"novel-server/internal/auth"
+	"novel-server/internal/domain"
+	"novel-server/internal/repository"
+	"novel-server/internal/service"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const testPassword = "correct horse"
+
+// newTestAuth создает AuthService поверх хранилища пользователей в памяти и регистрирует пользователя alice
+func newTestAuth(t *testing.T, users repository.UserRepository) (*service.AuthService, *domain.User, *domain.AuthTokens) {
+	t.Helper()
+	t.Setenv("JWT_SECRET", "test-secret")
+	if err := auth.InitJWT(); err != nil {
+		t.Fatalf("InitJWT: %v", err)
+	}
+
+	s := service.NewAuthService(users)
+	user, tokens, err := s.Register(context.Background(), "alice", testPassword)
+	if err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+	return s, user, tokens
+}
+
+func TestRefreshRotatesToken(t *testing.T) {
+	users := repository.NewMemoryUserRepository()
+	s, user, tokens := newTestAuth(t, users)
+	ctx := context.Background()
+
+	next, err := s.Refresh(ctx, tokens.RefreshToken)
+	if err != nil {
+		t.Fatalf("Refresh: %v", err)
+	}
+	if next.RefreshToken == tokens.RefreshToken {
+		t.Fatalf("Refresh returned the same refresh token")
+	}
+	claims, err := auth.ValidateToken(next.AccessToken)
+	if err != nil || claims.UserID != user.UserID.String() {
+		t.Fatalf("access token: claims %+v, error %v", claims, err)
+	}
+
+	old, err := users.GetRefreshToken(ctx, auth.HashRefreshToken(tokens.RefreshToken))
+	if err != nil || old.RevokedAt == nil {
+		t.Fatalf("old token after rotation: %+v, error %v; want it revoked", old, err)
+	}
+	current, err := users.GetRefreshToken(ctx, auth.HashRefreshToken(next.RefreshToken))
+	if err != nil || current.RevokedAt != nil || current.FamilyID != old.FamilyID {
+		t.Fatalf("new token: %+v, error %v; want an active token of the same family", current, err)
+	}
+}
+
+func TestRefreshReuseRevokesFamily(t *testing.T) {
+	users := repository.NewMemoryUserRepository()
+	s, _, tokens := newTestAuth(t, users)
+	ctx := context.Background()
+
+	next, err := s.Refresh(ctx, tokens.RefreshToken)
+	if err != nil {
+		t.Fatalf("Refresh: %v", err)
+	}
+
+	// Повторное предъявление старого токена отзывает и выданный по нему
+	if _, err := s.Refresh(ctx, tokens.RefreshToken); !errors.Is(err, service.ErrInvalidRefreshToken) {
+		t.Fatalf("Refresh(revoked token): error = %v, want ErrInvalidRefreshToken", err)
+	}
+	if _, err := s.Refresh(ctx, next.RefreshToken); !errors.Is(err, service.ErrInvalidRefreshToken) {
+		t.Fatalf("Refresh(token of a revoked family): error = %v, want ErrInvalidRefreshToken", err)
+	}
+
+	// Другой вход того же пользователя не затрагивается
+	other, err := s.Login(ctx, "alice", testPassword)
+	if err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+	if _, err := s.Refresh(ctx, other.RefreshToken); err != nil {
+		t.Fatalf("Refresh(token of another login): %v", err)
+	}
+}
+
+func TestRefreshRejectsExpiredToken(t *testing.T) {
+	users := repository.NewMemoryUserRepository()
+	s, user, _ := newTestAuth(t, users)
+	ctx := context.Background()
+
+	raw, err := auth.NewRefreshToken()
+	if err != nil {
+		t.Fatalf("NewRefreshToken: %v", err)
+	}
+	expired := &domain.RefreshToken{UserID: user.UserID, FamilyID: uuid.New(), ExpiresAt: time.Now().Add(-time.Minute)}
+	if err := users.CreateRefreshToken(ctx, expired, auth.HashRefreshToken(raw)); err != nil {
+		t.Fatalf("CreateRefreshToken: %v", err)
+	}
+
+	if _, err := s.Refresh(ctx, raw); !errors.Is(err, service.ErrInvalidRefreshToken) {
+		t.Fatalf("Refresh(expired token): error = %v, want ErrInvalidRefreshToken", err)
+	}
+	if _, err := s.Refresh(ctx, "unknown"); !errors.Is(err, service.ErrInvalidRefreshToken) {
+		t.Fatalf("Refresh(unknown token): error = %v, want ErrInvalidRefreshToken", err)
+	}
+}
+
+func TestDisabledAccount(t *testing.T) {
+	users := repository.NewMemoryUserRepository()
+	s, user, tokens := newTestAuth(t, users)
+	ctx := context.Background()
+
+	if err := users.SetUserDisabled(ctx, user.UserID, true); err != nil {
+		t.Fatalf("SetUserDisabled: %v", err)
+	}
+	// Блокировка отзывает выданные токены
+	if _, err := s.Refresh(ctx, tokens.RefreshToken); !errors.Is(err, service.ErrInvalidRefreshToken) {
+		t.Fatalf("Refresh(token issued before the block): error = %v, want ErrInvalidRefreshToken", err)
+	}
+	// Даже действующий токен заблокированной учетной записи не обменивается
+	raw, err := auth.NewRefreshToken()
+	if err != nil {
+		t.Fatalf("NewRefreshToken: %v", err)
+	}
+	token := &domain.RefreshToken{UserID: user.UserID, FamilyID: uuid.New(), ExpiresAt: time.Now().Add(time.Hour)}
+	if err := users.CreateRefreshToken(ctx, token, auth.HashRefreshToken(raw)); err != nil {
+		t.Fatalf("CreateRefreshToken: %v", err)
+	}
+	if _, err := s.Refresh(ctx, raw); !errors.Is(err, service.ErrAccountDisabled) {
+		t.Fatalf("Refresh(active token): error = %v, want ErrAccountDisabled", err)
+	}
+	if _, err := s.Login(ctx, "alice", testPassword); !errors.Is(err, service.ErrAccountDisabled) {
+		t.Fatalf("Login: error = %v, want ErrAccountDisabled", err)
+	}
+}
+
+// racingUsers - хранилище, в котором старый токен обновляет параллельный запрос
+// прямо перед ротацией
+type racingUsers struct {
+	*repository.MemoryUserRepository
+}
+
+func (r racingUsers) RotateRefreshToken(ctx context.Context, oldTokenID uuid.UUID, next *domain.RefreshToken, nextHash string) error {
+	winner := *next
+	winner.TokenID = uuid.Nil
+	if err := r.MemoryUserRepository.RotateRefreshToken(ctx, oldTokenID, &winner, nextHash+"-winner"); err != nil {
+		return err
+	}
+	return r.MemoryUserRepository.RotateRefreshToken(ctx, oldTokenID, next, nextHash)
+}
+
+func TestRefreshLostRotationRace(t *testing.T) {
+	users := racingUsers{repository.NewMemoryUserRepository()}
+	s, _, tokens := newTestAuth(t, users)
+
+	if _, err := s.Refresh(context.Background(), tokens.RefreshToken); !errors.Is(err, service.ErrInvalidRefreshToken) {
+		t.Fatalf("Refresh: error = %v, want ErrInvalidRefreshToken", err)
+	}
+}
+
+func TestLogoutRevokesFamily(t *testing.T) {
+	users := repository.NewMemoryUserRepository()
+	s, _, tokens := newTestAuth(t, users)
+	ctx := context.Background()
+
+	if err := s.Logout(ctx, tokens.RefreshToken); err != nil {
+		t.Fatalf("Logout: %v", err)
+	}
+	if _, err := s.Refresh(ctx, tokens.RefreshToken); !errors.Is(err, service.ErrInvalidRefreshToken) {
+		t.Fatalf("Refresh after logout: error = %v, want ErrInvalidRefreshToken", err)
+	}
+	if err := s.Logout(ctx, "unknown"); err != nil {
+		t.Fatalf("Logout(unknown token): %v", err)
+	}
+}
+
+func TestLoginRejectsBadCredentials(t *testing.T) {
+	users := repository.NewMemoryUserRepository()
+	s, _, _ := newTestAuth(t, users)
+	ctx := context.Background()
+
+	if _, err := s.Login(ctx, "alice", testPassword); err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+	// Неизвестный логин и неверный пароль неотличимы
+	for _, tt := range []struct{ username, password string }{
+		{"bob", testPassword},
+		{"alice", "wrong password"},
+	} {
+		if _, err := s.Login(ctx, tt.username, tt.password); err != service.ErrInvalidCredentials {
+			t.Errorf("Login(%q, %q): error = %v, want ErrInvalidCredentials", tt.username, tt.password, err)
+		}
+	}
+}
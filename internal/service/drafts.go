@@ -0,0 +1,221 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"novel-server/internal/domain"
+	"novel-server/internal/repository"
+	"novel-server/internal/schema"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// Ошибки черновиков, которые обработчики переводят в HTTP-статусы
+var (
+	ErrDraftNotFound         = errors.New("draft not found") // Черновика нет или он принадлежит другому пользователю
+	ErrDraftRevisionNotFound = errors.New("draft revision not found")
+	ErrDraftRevisionCurrent  = errors.New("revision is already current")
+)
+
+// Ограничения списка черновиков
+const (
+	defaultDraftListLimit = 20
+	maxDraftListLimit     = 100
+)
+
+// ListDrafts возвращает черновики пользователя, последние измененные первыми
+func (s *NovelService) ListDrafts(ctx context.Context, userID string, limit, offset int) ([]domain.NovelDraftSummary, error) {
+	if limit <= 0 {
+		limit = defaultDraftListLimit
+	}
+	return s.draftRepo.ListDrafts(ctx, userID, min(limit, maxDraftListLimit), max(offset, 0))
+}
+
+// GetDraft возвращает черновик пользователя вместе с конфигом
+func (s *NovelService) GetDraft(ctx context.Context, userID string, draftID uuid.UUID) (*domain.NovelDraft, error) {
+	draft, err := s.draftRepo.GetDraft(ctx, userID, draftID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, ErrDraftNotFound
+		}
+		return nil, err
+	}
+	return draft, nil
+}
+
+// DeleteDraft удаляет черновик пользователя
+func (s *NovelService) DeleteDraft(ctx context.Context, userID string, draftID uuid.UUID) error {
+	if err := s.draftRepo.DeleteDraft(ctx, userID, draftID); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return ErrDraftNotFound
+		}
+		return err
+	}
+	log.Printf("[NovelService] DeleteDraft - UserID %s deleted DraftID %s", userID, draftID)
+	return nil
+}
+
+// ListDraftRevisions возвращает историю ревизий черновика (без конфигов)
+func (s *NovelService) ListDraftRevisions(ctx context.Context, userID string, draftID uuid.UUID) ([]domain.DraftRevision, error) {
+	// Пустой список не отличить от чужого черновика, поэтому сначала проверяем черновик
+	if _, err := s.GetDraft(ctx, userID, draftID); err != nil {
+		return nil, err
+	}
+	return s.draftRepo.ListDraftRevisions(ctx, userID, draftID)
+}
+
+// GetDraftRevision возвращает ревизию черновика вместе с конфигом
+func (s *NovelService) GetDraftRevision(ctx context.Context, userID string, draftID uuid.UUID, revision int) (*domain.DraftRevision, error) {
+	v, err := s.draftRepo.GetDraftRevision(ctx, userID, draftID, revision)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, ErrDraftRevisionNotFound
+		}
+		return nil, err
+	}
+	return v, nil
+}
+
+// DiffDraftRevisions сравнивает конфиги двух ревизий черновика поле за полем.
+// to, равное 0, означает текущую ревизию.
+func (s *NovelService) DiffDraftRevisions(ctx context.Context, userID string, draftID uuid.UUID, from, to int) (*domain.DraftRevisionDiff, error) {
+	if to == 0 {
+		draft, err := s.GetDraft(ctx, userID, draftID)
+		if err != nil {
+			return nil, err
+		}
+		to = draft.Revision
+	}
+
+	fromRevision, err := s.GetDraftRevision(ctx, userID, draftID, from)
+	if err != nil {
+		return nil, err
+	}
+	toRevision, err := s.GetDraftRevision(ctx, userID, draftID, to)
+	if err != nil {
+		return nil, err
+	}
+
+	changes, err := domain.DiffNovelConfigs(fromRevision.Config, toRevision.Config)
+	if err != nil {
+		return nil, err
+	}
+	return &domain.DraftRevisionDiff{DraftID: draftID, From: from, To: to, Changes: changes}, nil
+}
+
+// RollbackDraft возвращает черновик к конфигу ревизии revision. История не переписывается:
+// добавляется новая ревизия с источником rollback, поэтому откат тоже можно отменить.
+func (s *NovelService) RollbackDraft(ctx context.Context, userID string, draftID uuid.UUID, revision int) (*domain.DraftRevision, error) {
+	draft, err := s.GetDraft(ctx, userID, draftID)
+	if err != nil {
+		return nil, err
+	}
+	if draft.Revision == revision {
+		return nil, fmt.Errorf("%w: draft is already at revision %d", ErrDraftRevisionCurrent, revision)
+	}
+
+	target, err := s.GetDraftRevision(ctx, userID, draftID, revision)
+	if err != nil {
+		return nil, err
+	}
+	configJSON, err := json.Marshal(target.Config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal draft config: %w", err)
+	}
+
+	rollback := &domain.DraftRevision{
+		Source:       domain.DraftRevisionRollback,
+		RestoredFrom: &target.Revision,
+		Config:       target.Config,
+	}
+	if err := s.draftRepo.AppendDraftRevision(ctx, userID, draftID, configJSON, rollback); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, ErrDraftNotFound
+		}
+		return nil, err
+	}
+	log.Printf("[NovelService] RollbackDraft - UserID %s restored DraftID %s to revision %d as revision %d",
+		userID, draftID, revision, rollback.Revision)
+	return rollback, nil
+}
+
+// maxRefineHistory - сколько последних уточнений черновика отправляется модели вместе с новым запросом
+const maxRefineHistory = 10
+
+// refineHistory возвращает исходный промпт черновика и уточнения, из которых получилась
+// ревизия current, в хронологическом порядке. Уточнения, отмененные откатом, не входят:
+// после отката история продолжается от восстановленной ревизии.
+func refineHistory(revisions []domain.DraftRevision, current int) (string, []domain.DraftRevision) {
+	byRevision := make(map[int]domain.DraftRevision, len(revisions))
+	for _, v := range revisions {
+		byRevision[v.Revision] = v
+	}
+
+	var originalPrompt string
+	var history []domain.DraftRevision
+	for revision := current; revision >= 1; revision-- {
+		v, ok := byRevision[revision]
+		if !ok {
+			break
+		}
+		switch v.Source {
+		case domain.DraftRevisionCreate:
+			originalPrompt = v.Prompt
+		case domain.DraftRevisionRefine:
+			if len(v.Patch) > 0 && len(history) < maxRefineHistory {
+				history = append(history, v)
+			}
+		case domain.DraftRevisionRollback:
+			// Ревизия отката восстанавливает более раннюю, поэтому RestoredFrom всегда меньше ее номера
+			if v.RestoredFrom != nil {
+				revision = *v.RestoredFrom + 1
+			}
+		}
+	}
+
+	// История собрана от новых ревизий к старым
+	for i, j := 0, len(history)-1; i < j; i, j = i+1, j-1 {
+		history[i], history[j] = history[j], history[i]
+	}
+	return originalPrompt, history
+}
+
+// buildRefinePrompt формирует последнее сообщение запроса на уточнение: исходный запрос,
+// полный текущий конфиг и новый запрос пользователя
+func buildRefinePrompt(originalPrompt string, currentConfig []byte, request string) string {
+	var sb strings.Builder
+	if originalPrompt != "" {
+		sb.WriteString("Original request:\n")
+		sb.WriteString(originalPrompt)
+		sb.WriteString("\n\n")
+	}
+	sb.WriteString("Current configuration:\n")
+	sb.Write(currentConfig)
+	sb.WriteString("\n\nChange request:\n")
+	sb.WriteString(request)
+	sb.WriteString("\n\nRespond with a JSON Merge Patch for the current configuration.")
+	return sb.String()
+}
+
+// mergeConfigPatch применяет патч модели к конфигу и проверяет результат по схеме конфига и Validate
+func mergeConfigPatch(currentConfig, patch []byte) (*domain.NovelConfig, error) {
+	merged, err := applyMergePatch(currentConfig, patch)
+	if err != nil {
+		return nil, err
+	}
+	if err := schema.Validate(schema.NarratorConfig, merged); err != nil {
+		return nil, err
+	}
+	var config domain.NovelConfig
+	if err := json.Unmarshal(merged, &config); err != nil {
+		return nil, fmt.Errorf("failed to parse patched config: %w", err)
+	}
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	return &config, nil
+}
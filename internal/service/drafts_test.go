@@ -0,0 +1,82 @@
+package service
+
+import (
+	"encoding/json"
+	"novel-server/internal/domain"
+	"slices"
+	"testing"
+)
+
+// revisionsOf строит историю черновика: первая ревизия - создание, остальные - уточнения
+// с патчем или откаты, если для номера ревизии задано restored
+func revisionsOf(count int, restored map[int]int) []domain.DraftRevision {
+	revisions := make([]domain.DraftRevision, 0, count)
+	for revision := 1; revision <= count; revision++ {
+		v := domain.DraftRevision{Revision: revision, Source: domain.DraftRevisionRefine, Patch: json.RawMessage(`{"title":"T"}`)}
+		if revision == 1 {
+			v = domain.DraftRevision{Revision: revision, Source: domain.DraftRevisionCreate, Prompt: "original"}
+		}
+		if from, ok := restored[revision]; ok {
+			v = domain.DraftRevision{Revision: revision, Source: domain.DraftRevisionRollback, RestoredFrom: &from}
+		}
+		revisions = append(revisions, v)
+	}
+	return revisions
+}
+
+func TestRefineHistory(t *testing.T) {
+	tests := []struct {
+		name      string
+		revisions []domain.DraftRevision
+		current   int
+		want      []int
+	}{
+		{"only create", revisionsOf(1, nil), 1, nil},
+		{"refines in order", revisionsOf(3, nil), 3, []int{2, 3}},
+		{"earlier current revision", revisionsOf(4, nil), 2, []int{2}},
+		// Уточнение 3 отменено откатом 4 к ревизии 2
+		{"rollback drops undone refines", revisionsOf(5, map[int]int{4: 2}), 5, []int{2, 5}},
+		{"rollback to create", revisionsOf(4, map[int]int{3: 1}), 4, []int{4}},
+		{"rollback of a rollback", revisionsOf(6, map[int]int{4: 2, 5: 3}), 6, []int{2, 3, 6}},
+		{"history limit keeps latest", revisionsOf(15, nil), 15, []int{6, 7, 8, 9, 10, 11, 12, 13, 14, 15}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Порядок ревизий во входном списке не важен
+			revisions := slices.Clone(tt.revisions)
+			slices.Reverse(revisions)
+
+			originalPrompt, history := refineHistory(revisions, tt.current)
+			if originalPrompt != "original" {
+				t.Errorf("original prompt = %q, want %q", originalPrompt, "original")
+			}
+			var got []int
+			for _, v := range history {
+				got = append(got, v.Revision)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("history revisions = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRefineHistorySkipsEmptyPatches(t *testing.T) {
+	revisions := revisionsOf(3, nil)
+	revisions[1].Patch = nil
+
+	if _, history := refineHistory(revisions, 3); len(history) != 1 || history[0].Revision != 3 {
+		t.Fatalf("history = %+v, want only revision 3", history)
+	}
+}
+
+func TestRefineHistoryMissingRevision(t *testing.T) {
+	// Ревизии 2 нет: история обрывается на ней, исходный промпт не найден
+	revisions := revisionsOf(3, nil)
+	revisions = slices.Delete(revisions, 1, 2)
+
+	originalPrompt, history := refineHistory(revisions, 3)
+	if originalPrompt != "" || len(history) != 1 || history[0].Revision != 3 {
+		t.Fatalf("refineHistory = %q, %+v; want no prompt and only revision 3", originalPrompt, history)
+	}
+}
@@ -0,0 +1,114 @@
+package service
+
+import "encoding/json"
+
+// sceneEventScanner инкрементально разбирает JSON-ответ модели по мере его поступления
+// и выдает сырые объекты событий из scene.events (или new_content.events),
+// как только очередной объект полностью получен.
+// Сканер не валидирует JSON - итоговый ответ все равно разбирается целиком после окончания потока.
+type sceneEventScanner struct {
+	buf    []byte
+	frames []scanFrame
+
+	started  bool // Встретили открывающую скобку корневого объекта
+	done     bool // Корневой объект закрыт, дальше ничего не разбираем
+	inString bool
+	escaped  bool
+
+	strStart    int    // Начало текущей строки в buf (позиция после кавычки)
+	lastKey     string // Последний прочитанный ключ объекта
+	stringIsKey bool   // Текущая строка - ключ объекта
+}
+
+// scanFrame описывает открытый контейнер JSON.
+type scanFrame struct {
+	isArray   bool
+	key       string // Ключ, под которым контейнер лежит в родительском объекте
+	start     int    // Позиция открывающей скобки в buf
+	expectKey bool   // Для объекта: следующая строка будет ключом
+}
+
+// Write добавляет очередной фрагмент текста и возвращает события, завершенные в нем.
+func (s *sceneEventScanner) Write(chunk string) []json.RawMessage {
+	var completed []json.RawMessage
+	offset := len(s.buf)
+	s.buf = append(s.buf, chunk...)
+
+	for i := offset; i < len(s.buf) && !s.done; i++ {
+		c := s.buf[i]
+
+		if s.inString {
+			switch {
+			case s.escaped:
+				s.escaped = false
+			case c == '\\':
+				s.escaped = true
+			case c == '"':
+				s.inString = false
+				if s.stringIsKey {
+					s.lastKey = string(s.buf[s.strStart:i])
+				}
+			}
+			continue
+		}
+
+		if !s.started {
+			// Пропускаем все до корневого объекта (например, ```json)
+			if c == '{' {
+				s.started = true
+				s.frames = append(s.frames, scanFrame{start: i, expectKey: true})
+			}
+			continue
+		}
+
+		switch c {
+		case '"':
+			s.inString = true
+			s.strStart = i + 1
+			top := &s.frames[len(s.frames)-1]
+			s.stringIsKey = !top.isArray && top.expectKey
+		case ':':
+			s.frames[len(s.frames)-1].expectKey = false
+		case ',':
+			top := &s.frames[len(s.frames)-1]
+			if !top.isArray {
+				top.expectKey = true
+			}
+		case '{', '[':
+			key := ""
+			if parent := s.frames[len(s.frames)-1]; !parent.isArray {
+				key = s.lastKey
+			}
+			s.frames = append(s.frames, scanFrame{isArray: c == '[', key: key, start: i, expectKey: c == '{'})
+		case '}', ']':
+			closed := s.frames[len(s.frames)-1]
+			if c == '}' && s.isSceneEvent() {
+				raw := make([]byte, i+1-closed.start)
+				copy(raw, s.buf[closed.start:i+1])
+				completed = append(completed, raw)
+			}
+			s.frames = s.frames[:len(s.frames)-1]
+			if len(s.frames) == 0 {
+				s.done = true
+			}
+		}
+	}
+
+	return completed
+}
+
+// isSceneEvent сообщает, является ли закрываемый объект элементом scene.events:
+// корень → scene/new_content → events → объект.
+func (s *sceneEventScanner) isSceneEvent() bool {
+	if len(s.frames) != 4 {
+		return false
+	}
+	scene, events := s.frames[1], s.frames[2]
+	return !scene.isArray && (scene.key == "scene" || scene.key == "new_content") &&
+		events.isArray && events.key == "events"
+}
+
+// String возвращает весь полученный на данный момент текст.
+func (s *sceneEventScanner) String() string {
+	return string(s.buf)
+}
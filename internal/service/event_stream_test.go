@@ -0,0 +1,121 @@
+package service
+
+import (
+	"math/rand"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// scanAll передает payload сканеру кусками по границам cuts и собирает события
+func scanAll(payload string, cuts []int) []string {
+	scanner := &sceneEventScanner{}
+	var events []string
+	prev := 0
+	for _, cut := range append(cuts, len(payload)) {
+		for _, raw := range scanner.Write(payload[prev:cut]) {
+			events = append(events, string(raw))
+		}
+		prev = cut
+	}
+	return events
+}
+
+// Эти события сканер должен найти в streamPayload - ровно в таком виде и порядке
+var streamEvents = []string{
+	`{"event_type":"narration","text":"Rain drums on the windows."}`,
+	`{"event_type":"dialogue","speaker":"Mira","text":"She said \"{not an event}\", then left ] \\"}`,
+	`{ "event_type" : "choice", "description" : "What now?", "choices" : [ {"text":"Stay","consequences":{"relationship":{"Mira":1}}}, {"text":"Go {quietly}","consequences":{}} ] }`,
+}
+
+// streamPayload - ответ модели с кодовым блоком, вложенными объектами "scene" и "events"
+// не на своем месте и текстом после корневого объекта
+var streamPayload = "```json\n" + `{
+  "note": "scene",
+  "meta": {"scene": {"events": [{"event_type":"narration","text":"nested too deep"}]}},
+  "events": [{"event_type":"narration","text":"events under the root"}],
+  "story_summary_so_far": "a \"scene\": {\"events\": [{}]}",
+  "scene": {
+    "background_id": "bg_archive",
+    "characters": [{"name":"Mira","position":"center"}],
+    "events": [` + strings.Join(streamEvents, ",\n      ") + `]
+  }
+}` + "\n```\nThe scene ends here: {\"event_type\":\"narration\"}"
+
+func TestSceneEventScanner(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload string
+		want    []string
+	}{
+		{"scene events", streamPayload, streamEvents},
+		{"new_content events", strings.Replace(streamPayload, `"scene": {
+    "background_id"`, `"new_content": {
+    "background_id"`, 1), streamEvents},
+		{"no scene", `{"current_stage":"setup","characters":[{"name":"Mira"}]}`, nil},
+		{"empty events", `{"scene":{"events":[]}}`, nil},
+		{"events that are not objects", `{"scene":{"events":["text",1,[{"a":1}]]}}`, nil},
+		{"scene array", `{"scene":[{"events":[{"a":1}]}]}`, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := scanAll(tt.payload, nil); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("events = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// Событие выдается в том фрагменте, где закрылась его скобка
+func TestSceneEventScannerEmitsOnClose(t *testing.T) {
+	scanner := &sceneEventScanner{}
+	first := strings.Index(streamPayload, streamEvents[0])
+	closing := first + len(streamEvents[0]) - 1
+
+	if got := scanner.Write(streamPayload[:closing]); len(got) != 0 {
+		t.Fatalf("events before the closing brace: %q", got)
+	}
+	got := scanner.Write(streamPayload[closing : closing+1])
+	if len(got) != 1 || string(got[0]) != streamEvents[0] {
+		t.Fatalf("events on the closing brace = %q, want the first event", got)
+	}
+	if scanner.String() != streamPayload[:closing+1] {
+		t.Fatalf("String() does not return the text received so far")
+	}
+}
+
+// Результат не зависит от того, как поток разбит на фрагменты
+func TestSceneEventScannerChunking(t *testing.T) {
+	payload := streamPayload
+	check := func(t *testing.T, cuts []int) {
+		t.Helper()
+		if got := scanAll(payload, cuts); !reflect.DeepEqual(got, streamEvents) {
+			t.Fatalf("cuts %v: events = %q, want %q", cuts, got, streamEvents)
+		}
+	}
+
+	t.Run("one cut anywhere", func(t *testing.T) {
+		for cut := 0; cut <= len(payload); cut++ {
+			check(t, []int{cut})
+		}
+	})
+	t.Run("fixed chunk sizes", func(t *testing.T) {
+		for size := 1; size <= 64; size++ {
+			var cuts []int
+			for cut := size; cut < len(payload); cut += size {
+				cuts = append(cuts, cut)
+			}
+			check(t, cuts)
+		}
+	})
+	t.Run("random chunks", func(t *testing.T) {
+		rng := rand.New(rand.NewSource(1))
+		for run := 0; run < 500; run++ {
+			var cuts []int
+			for cut := rng.Intn(8); cut < len(payload); cut += rng.Intn(24) {
+				cuts = append(cuts, cut)
+			}
+			check(t, cuts)
+		}
+	})
+}
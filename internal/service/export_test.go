@@ -0,0 +1,13 @@
+package service
+
+// GenerationWaiters возвращает, сколько запросов сейчас ждут генерацию веток
+func (s *NovelContentService) GenerationWaiters() int {
+	s.branchesMu.Lock()
+	defer s.branchesMu.Unlock()
+
+	waiters := 0
+	for _, generation := range s.branches {
+		waiters += generation.waiters
+	}
+	return waiters
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"novel-server/internal/domain"
 	"sort"
 )
 
@@ -27,6 +28,16 @@ func hashStateKey(choice string, flags []string, relationship map[string]int, va
 	return hashData(serializedKey), nil
 }
 
+// hashSceneState вычисляет хеш состояния сцены по последнему сделанному в нем выбору
+// (или пустой строке, если выборов не было) и состоянию мира
+func hashSceneState(state *domain.NovelState) (string, error) {
+	lastChoice := ""
+	if len(state.PreviousChoices) > 0 {
+		lastChoice = state.PreviousChoices[len(state.PreviousChoices)-1]
+	}
+	return hashStateKey(lastChoice, state.GlobalFlags, state.Relationship, state.StoryVariables)
+}
+
 // serializeStateKey сериализует ключ состояния в JSON со стабильным порядком ключей/элементов.
 func serializeStateKey(choice string, flags []string, relationship map[string]int, variables map[string]interface{}) ([]byte, error) {
 	// Сортируем флаги для стабильности
@@ -42,48 +42,3 @@ func (s *NovelContentService) extractSceneContent(state *domain.NovelState, scen
 	log.Printf("[extractSceneContent] Extracted content for scene %d", sceneIndex)
 	return sceneContent, nil
 }
-
-// Вспомогательная функция для безопасного обновления полей состояния
-func updateStateField(fieldPtr interface{}, value interface{}) {
-	if value == nil {
-		return
-	}
-
-	switch v := fieldPtr.(type) {
-	case *string:
-		if strVal, ok := value.(string); ok {
-			*v = strVal
-		}
-	case *int:
-		if floatVal, ok := value.(float64); ok { // JSON числа обычно float64
-			*v = int(floatVal)
-		} else if intVal, ok := value.(int); ok { // На всякий случай
-			*v = intVal
-		}
-	case *[]string:
-		if arrVal, ok := value.([]interface{}); ok {
-			strSlice := []string{}
-			for _, item := range arrVal {
-				if strItem, ok := item.(string); ok {
-					strSlice = append(strSlice, strItem)
-				}
-			}
-			*v = strSlice
-		}
-	case *map[string]int:
-		if mapVal, ok := value.(map[string]interface{}); ok {
-			intMap := make(map[string]int)
-			for key, val := range mapVal {
-				if floatInnerVal, ok := val.(float64); ok {
-					intMap[key] = int(floatInnerVal)
-				}
-			}
-			*v = intMap
-		}
-	case *map[string]interface{}:
-		if mapVal, ok := value.(map[string]interface{}); ok {
-			*v = mapVal
-		}
-		// Добавьте другие типы по необходимости
-	}
-}
@@ -0,0 +1,104 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"novel-server/internal/llm"
+	"novel-server/internal/schema"
+	"strings"
+)
+
+// ErrInvalidModelResponse - модель так и не вернула ответ, соответствующий JSON-схеме
+var ErrInvalidModelResponse = errors.New("invalid model response")
+
+// responseCheck - дополнительная проверка ответа, прошедшего JSON-схему
+// (например, что сцена ссылается только на персонажей и фоны из сетапа)
+type responseCheck func(jsonStr string) error
+
+// validateModelJSON извлекает JSON из ответа модели и проверяет его по схеме и проверкой check (если задана)
+func validateModelJSON(response string, name schema.Name, check responseCheck) (string, error) {
+	jsonStr, err := extractJSONFromResponse(response)
+	if err != nil {
+		return "", err
+	}
+	if err := schema.Validate(name, []byte(jsonStr)); err != nil {
+		return "", err
+	}
+	if check != nil {
+		if err := check(jsonStr); err != nil {
+			return "", err
+		}
+	}
+	return jsonStr, nil
+}
+
+// repairModelJSON проверяет ответ модели по схеме (и проверкой check) и возвращает извлеченный JSON.
+// Если ответ не проходит проверку, модели отправляется ее ответ вместе со списком ошибок
+// с просьбой прислать исправленный JSON - не более maxRepairs раз.
+// messages - диалог, на который модель дала ответ response.
+func repairModelJSON(ctx context.Context, provider llm.LLMProvider, messages []llm.Message, response string, name schema.Name, check responseCheck, maxRepairs int) (string, error) {
+	jsonStr, validationErr := validateModelJSON(response, name, check)
+	if validationErr == nil {
+		return jsonStr, nil
+	}
+
+	// Копируем диалог, чтобы не менять слайс вызывающей стороны
+	conversation := append([]llm.Message(nil), messages...)
+	for attempt := 1; attempt <= maxRepairs; attempt++ {
+		log.Printf("[repairModelJSON] Response does not match %s, asking the model to repair it (attempt %d/%d): %v",
+			name, attempt, maxRepairs, validationErr)
+
+		conversation = append(conversation,
+			llm.Message{Role: llm.RoleAssistant, Content: response},
+			llm.Message{Role: llm.RoleUser, Content: buildRepairPrompt(validationErr)},
+		)
+
+		var err error
+		response, err = provider.ChatCompletion(ctx, conversation)
+		if err != nil {
+			return "", fmt.Errorf("failed to get repaired response from LLM provider %s: %w", provider.Name(), err)
+		}
+
+		jsonStr, validationErr = validateModelJSON(response, name, check)
+		if validationErr == nil {
+			log.Printf("[repairModelJSON] Model repaired %s response after %d attempt(s)", name, attempt)
+			return jsonStr, nil
+		}
+	}
+
+	return "", fmt.Errorf("%w: %w", ErrInvalidModelResponse, validationErr)
+}
+
+// buildRepairPrompt формирует сообщение для модели со списком ошибок ее ответа
+func buildRepairPrompt(validationErr error) string {
+	var sb strings.Builder
+	sb.WriteString("Your previous response is not valid. Problems found:\n")
+
+	var schemaErr *schema.ValidationError
+	var joinedErr interface{ Unwrap() []error }
+	switch {
+	case errors.As(validationErr, &schemaErr):
+		for _, issue := range schemaErr.Issues {
+			sb.WriteString("- ")
+			sb.WriteString(issue)
+			sb.WriteString("\n")
+		}
+	case errors.As(validationErr, &joinedErr):
+		// Несколько нарушений из errors.Join - по одному на строку
+		for _, err := range joinedErr.Unwrap() {
+			sb.WriteString("- ")
+			sb.WriteString(err.Error())
+			sb.WriteString("\n")
+		}
+	default:
+		sb.WriteString("- ")
+		sb.WriteString(validationErr.Error())
+		sb.WriteString("\n")
+	}
+
+	sb.WriteString("\nRespond again with the complete corrected JSON only. ")
+	sb.WriteString("Keep the content that was valid unchanged and do not add any text outside the JSON.")
+	return sb.String()
+}
@@ -0,0 +1,144 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"novel-server/internal/llm"
+	"novel-server/internal/schema"
+	"strings"
+	"testing"
+)
+
+// refineMessages - диалог уточнения конфига; ScriptedProvider отвечает на него из очереди narrator_refine
+var refineMessages = []llm.Message{
+	{Role: llm.RoleSystem, Content: "Story Config Refinement"},
+	{Role: llm.RoleUser, Content: "Make the story darker."},
+}
+
+func TestRepairModelJSON(t *testing.T) {
+	tooLong := func(jsonStr string) error {
+		if strings.Contains(jsonStr, "Long") {
+			return errors.Join(errors.New("title is too long"), errors.New("title repeats the old one"))
+		}
+		return nil
+	}
+
+	tests := []struct {
+		name       string
+		response   string
+		repairs    []string // Ответы модели на просьбы исправить
+		maxRepairs int
+		check      responseCheck
+		want       string
+		wantErr    error    // Ожидаемая ошибка (errors.Is); nil - без ошибки
+		errText    string   // Фрагмент текста ошибки, если wantErr не задан
+		wantPrompt []string // Фрагменты последней просьбы исправить ответ
+	}{
+		{
+			name:       "valid response",
+			response:   `{"title":"Night Shift"}`,
+			maxRepairs: 2,
+			want:       `{"title":"Night Shift"}`,
+		},
+		{
+			name:       "code fence and broken syntax are fixed without asking",
+			response:   "```json\n{\"title\":\"Night Shift\",}\n```\nHope this helps!",
+			maxRepairs: 0,
+			want:       `{"title":"Night Shift"}`,
+		},
+		{
+			name:       "repaired on the second attempt",
+			response:   `{"title":""}`,
+			repairs:    []string{`{"colour":"red"}`, `{"title":"Night Shift"}`},
+			maxRepairs: 2,
+			want:       `{"title":"Night Shift"}`,
+			wantPrompt: []string{"Your previous response is not valid", "value must be one of"},
+		},
+		{
+			name:       "out of attempts",
+			response:   `{"title":""}`,
+			repairs:    []string{`{"title":""}`, `not json at all`},
+			maxRepairs: 2,
+			wantErr:    ErrInvalidModelResponse,
+		},
+		{
+			name:       "no attempts",
+			response:   `{"title":""}`,
+			maxRepairs: 0,
+			wantErr:    ErrInvalidModelResponse,
+		},
+		{
+			name:       "joined check errors are listed one per line",
+			response:   `{"title":"Long Long Title"}`,
+			repairs:    []string{`{"title":"Short"}`},
+			maxRepairs: 1,
+			check:      tooLong,
+			want:       `{"title":"Short"}`,
+			wantPrompt: []string{"- title is too long\n- title repeats the old one\n"},
+		},
+		{
+			name:       "provider error",
+			response:   `{"title":""}`,
+			maxRepairs: 1,
+			errText:    "failed to get repaired response",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := llm.NewScriptedProvider()
+			provider.Enqueue("narrator_refine", tt.repairs...)
+			messages := append([]llm.Message(nil), refineMessages...)
+
+			got, err := repairModelJSON(context.Background(), provider, messages, tt.response, schema.NarratorConfigPatch, tt.check, tt.maxRepairs)
+			switch {
+			case tt.wantErr != nil:
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("error = %v, want %v", err, tt.wantErr)
+				}
+			case tt.errText != "":
+				if err == nil || !strings.Contains(err.Error(), tt.errText) || errors.Is(err, ErrInvalidModelResponse) {
+					t.Fatalf("error = %v, want a provider error", err)
+				}
+			default:
+				if err != nil {
+					t.Fatalf("repairModelJSON: %v", err)
+				}
+				if got != tt.want {
+					t.Fatalf("repairModelJSON = %q, want %q", got, tt.want)
+				}
+			}
+
+			// Вызывающий диалог не меняется, модель спрашивается не больше maxRepairs раз
+			if len(messages) != len(refineMessages) {
+				t.Fatalf("caller's messages changed: %d messages", len(messages))
+			}
+			calls := provider.Calls()
+			if len(calls) > tt.maxRepairs {
+				t.Fatalf("%d repair requests, at most %d allowed", len(calls), tt.maxRepairs)
+			}
+			if rest := provider.Remaining("narrator_refine"); rest != 0 && err == nil {
+				t.Fatalf("%d repaired responses left unused", rest)
+			}
+			for i, call := range calls {
+				// Каждая просьба продолжает диалог: прежний ответ модели и список ошибок
+				if want := len(refineMessages) + 2*(i+1); len(call.Messages) != want {
+					t.Fatalf("repair request %d has %d messages, want %d", i+1, len(call.Messages), want)
+				}
+				last := call.Messages[len(call.Messages)-1]
+				if last.Role != llm.RoleUser || call.Messages[len(call.Messages)-2].Role != llm.RoleAssistant {
+					t.Fatalf("repair request %d does not end with the model answer and a user request", i+1)
+				}
+			}
+			if len(tt.wantPrompt) > 0 {
+				last := calls[len(calls)-1]
+				prompt := last.Messages[len(last.Messages)-1].Content
+				for _, fragment := range tt.wantPrompt {
+					if !strings.Contains(prompt, fragment) {
+						t.Fatalf("repair request %q does not contain %q", prompt, fragment)
+					}
+				}
+			}
+		})
+	}
+}
@@ -5,58 +5,137 @@ import (
 	"strings"
 )
 
-// FixJSON проверяет и исправляет потенциально некорректный JSON
-// В частности, решает проблему незакрытых скобок в конце JSON
+// fixFrame - открытый контейнер JSON при разборе в FixJSON
+type fixFrame struct {
+	closer    byte // '}' или ']'
+	expectKey bool // Для объекта: следующая строка будет ключом
+	afterKey  bool // Для объекта: ключ прочитан, ждем двоеточие
+}
+
+// FixJSON проверяет и исправляет потенциально некорректный JSON от модели.
+// Разбирает текст со стеком открытых скобок и исправляет типичные ошибки:
+//   - висячие запятые перед } и ] (и в конце обрезанного ответа);
+//   - закрывающие скобки не того типа;
+//   - незакрытую строку, ключ без значения и незакрытые скобки в обрезанном ответе.
+//
+// Все, что идет после закрытия корневого значения, отбрасывается.
+// Ошибки типов и структуры FixJSON не исправляет - их ловит проверка по схеме.
 func FixJSON(jsonStr string) string {
 	if jsonStr == "" {
 		return jsonStr
 	}
 
-	// Подсчитываем открывающие и закрывающие скобки
-	counts := map[rune]int{
-		'{': 0,
-		'}': 0,
-		'[': 0,
-		']': 0,
-	}
-
-	// Счетчик для поиска в строках (не считаем скобки внутри строк)
+	out := make([]byte, 0, len(jsonStr)+8)
+	var stack []fixFrame
 	inString := false
 	escaped := false
+	started := false
+	stringIsKey := false
 
-	for _, char := range jsonStr {
-		if char == '"' && !escaped {
-			inString = !inString
+	top := func() *fixFrame {
+		if len(stack) == 0 {
+			return nil
 		}
+		return &stack[len(stack)-1]
+	}
+
+scan:
+	for i := 0; i < len(jsonStr); i++ {
+		c := jsonStr[i]
 
-		if !inString {
-			if count, exists := counts[char]; exists {
-				counts[char] = count + 1
+		if inString {
+			out = append(out, c)
+			switch {
+			case escaped:
+				escaped = false
+			case c == '\\':
+				escaped = true
+			case c == '"':
+				inString = false
+				if stringIsKey {
+					top().afterKey = true
+				}
 			}
+			continue
 		}
 
-		// Отслеживаем экранирование для корректного определения строк
-		if char == '\\' && !escaped {
-			escaped = true
-		} else {
-			escaped = false
+		switch c {
+		case '"':
+			inString = true
+			frame := top()
+			stringIsKey = frame != nil && frame.closer == '}' && frame.expectKey
+			if stringIsKey {
+				frame.expectKey = false
+			}
+			out = append(out, c)
+		case '{', '[':
+			started = true
+			closer := byte('}')
+			if c == '[' {
+				closer = ']'
+			}
+			stack = append(stack, fixFrame{closer: closer, expectKey: c == '{'})
+			out = append(out, c)
+		case '}', ']':
+			if !hasOpenFrame(stack, c) {
+				// Лишняя закрывающая скобка - пропускаем
+				continue
+			}
+			// Закрываем контейнеры, которые модель забыла закрыть перед этой скобкой
+			for {
+				out = trimTrailingComma(out)
+				frame := stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+				out = append(out, frame.closer)
+				if frame.closer == c {
+					break
+				}
+			}
+			if len(stack) == 0 {
+				break scan
+			}
+		case ':':
+			if frame := top(); frame != nil {
+				frame.afterKey = false
+			}
+			out = append(out, c)
+		case ',':
+			if frame := top(); frame != nil && frame.closer == '}' {
+				frame.expectKey = true
+			}
+			out = append(out, c)
+		default:
+			out = append(out, c)
 		}
 	}
 
-	// Проверяем и исправляем баланс
-	fixedJSON := jsonStr
-	imbalance := counts['{'] - counts['}']
-	if imbalance > 0 {
-		log.Printf("[FixJSON] Fixing unbalanced curly braces. Missing closing braces: %d", imbalance)
-		fixedJSON += strings.Repeat("}", imbalance)
+	// Дописываем то, что потерялось, если ответ модели обрезан
+	if inString {
+		if escaped {
+			out = out[:len(out)-1]
+		}
+		out = append(out, '"')
+		if stringIsKey {
+			top().afterKey = true
+		}
 	}
-
-	imbalance = counts['['] - counts[']']
-	if imbalance > 0 {
-		log.Printf("[FixJSON] Fixing unbalanced square brackets. Missing closing brackets: %d", imbalance)
-		fixedJSON += strings.Repeat("]", imbalance)
+	if started && len(stack) > 0 {
+		out = trimTrailingComma(out)
+		frame := top()
+		switch {
+		case frame.afterKey:
+			out = append(out, ":null"...)
+		case strings.HasSuffix(strings.TrimRight(string(out), " \t\r\n"), ":"):
+			out = append(out, "null"...)
+		}
+		for len(stack) > 0 {
+			out = trimTrailingComma(out)
+			out = append(out, stack[len(stack)-1].closer)
+			stack = stack[:len(stack)-1]
+		}
 	}
 
+	fixedJSON := string(out)
 	if fixedJSON != jsonStr {
 		log.Printf("[FixJSON] JSON was fixed. Original length: %d, Fixed length: %d",
 			len(jsonStr), len(fixedJSON))
@@ -64,3 +143,22 @@ func FixJSON(jsonStr string) string {
 
 	return fixedJSON
 }
+
+// hasOpenFrame сообщает, есть ли в стеке контейнер, который закрывает скобка closer
+func hasOpenFrame(stack []fixFrame, closer byte) bool {
+	for i := len(stack) - 1; i >= 0; i-- {
+		if stack[i].closer == closer {
+			return true
+		}
+	}
+	return false
+}
+
+// trimTrailingComma убирает висячую запятую (и пробелы после нее) в конце буфера
+func trimTrailingComma(out []byte) []byte {
+	trimmed := strings.TrimRight(string(out), " \t\r\n")
+	if strings.HasSuffix(trimmed, ",") {
+		return []byte(strings.TrimSuffix(trimmed, ","))
+	}
+	return out
+}
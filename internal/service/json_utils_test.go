@@ -0,0 +1,46 @@
+package service_test
+
+import (
+	"encoding/json"
+	"novel-server/internal/service"
+	"testing"
+)
+
+func TestFixJSON(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"empty", ``, ``},
+		{"valid", `{"a":[1,2],"b":{"c":"x"}}`, `{"a":[1,2],"b":{"c":"x"}}`},
+		{"trailing comma in object", `{"a":1,}`, `{"a":1}`},
+		{"trailing comma and spaces in array", `{"a":[1,2, ]}`, `{"a":[1,2]}`},
+		{"trailing commas on every level", `{"a":[{"b":1,},],}`, `{"a":[{"b":1}]}`},
+		{"array closed by brace", `{"a":[1,2}`, `{"a":[1,2]}`},
+		{"object closed by bracket", `[{"a":1]`, `[{"a":1}]`},
+		{"extra closing bracket", `{"a":[1]]}`, `{"a":[1]}`},
+		{"unclosed containers", `{"a":{"b":[1,2`, `{"a":{"b":[1,2]}}`},
+		{"truncated after comma", `{"a":[1,`, `{"a":[1]}`},
+		{"truncated string", `{"a":"hel`, `{"a":"hel"}`},
+		{"truncated escape", `{"a":"x\`, `{"a":"x"}`},
+		{"truncated key", `{"a":1,"ke`, `{"a":1,"ke":null}`},
+		{"key without value", `{"a":1,"key"`, `{"a":1,"key":null}`},
+		{"colon without value", `{"a":`, `{"a":null}`},
+		{"text after root", `{"a":1} and here is why {"b":2}`, `{"a":1}`},
+		{"closing code fence", "{\"a\":1}\n```", `{"a":1}`},
+		{"brackets and quotes in strings", `{"a":"}{][\",","b":1,}`, `{"a":"}{][\",","b":1}`},
+		{"escaped backslash before quote", `{"a":"x\\","b":[}`, `{"a":"x\\","b":[]}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := service.FixJSON(tt.in)
+			if got != tt.want {
+				t.Fatalf("FixJSON(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+			if got != "" && !json.Valid([]byte(got)) {
+				t.Fatalf("FixJSON(%q) = %q is not valid JSON", tt.in, got)
+			}
+		})
+	}
+}
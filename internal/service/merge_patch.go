@@ -0,0 +1,39 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// applyMergePatch применяет JSON Merge Patch (RFC 7396) к документу target.
+// Объекты сливаются рекурсивно, null удаляет поле, остальные значения (включая массивы) заменяются целиком.
+func applyMergePatch(target, patch []byte) ([]byte, error) {
+	var targetDoc, patchDoc interface{}
+	if err := json.Unmarshal(target, &targetDoc); err != nil {
+		return nil, fmt.Errorf("invalid merge patch target: %w", err)
+	}
+	if err := json.Unmarshal(patch, &patchDoc); err != nil {
+		return nil, fmt.Errorf("invalid merge patch: %w", err)
+	}
+	return json.Marshal(mergePatchValue(targetDoc, patchDoc))
+}
+
+// mergePatchValue - алгоритм MergePatch из RFC 7396 для разобранных JSON-значений
+func mergePatchValue(target, patch interface{}) interface{} {
+	patchObject, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	targetObject, ok := target.(map[string]interface{})
+	if !ok {
+		targetObject = make(map[string]interface{})
+	}
+	for key, value := range patchObject {
+		if value == nil {
+			delete(targetObject, key)
+			continue
+		}
+		targetObject[key] = mergePatchValue(targetObject[key], value)
+	}
+	return targetObject
+}
@@ -0,0 +1,62 @@
+package service
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestApplyMergePatch(t *testing.T) {
+	// Примеры из приложения A RFC 7396
+	tests := []struct {
+		target, patch, want string
+	}{
+		{`{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+		{`{"a":"b"}`, `{"a":null}`, `{}`},
+		{`{"a":"b","b":"c"}`, `{"a":null}`, `{"b":"c"}`},
+		{`{"a":["b"]}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"c"}`, `{"a":["b"]}`, `{"a":["b"]}`},
+		{`{"a":{"b":"c"}}`, `{"a":{"b":"d","c":null}}`, `{"a":{"b":"d"}}`},
+		{`{"a":[{"b":"c"}]}`, `{"a":[1]}`, `{"a":[1]}`},
+		{`["a","b"]`, `["c","d"]`, `["c","d"]`},
+		{`{"a":"b"}`, `["c"]`, `["c"]`},
+		{`{"a":"foo"}`, `null`, `null`},
+		{`{"a":"foo"}`, `"bar"`, `"bar"`},
+		{`{"e":null}`, `{"a":1}`, `{"e":null,"a":1}`},
+		{`[1,2]`, `{"a":"b","c":null}`, `{"a":"b"}`},
+		{`{}`, `{"a":{"bb":{"ccc":null}}}`, `{"a":{"bb":{}}}`},
+
+		// Вложенные объекты сливаются на любой глубине
+		{`{"player_preferences":{"tone":"dark","themes":["a"]},"title":"T"}`, `{"player_preferences":{"tone":"light"}}`,
+			`{"player_preferences":{"tone":"light","themes":["a"]},"title":"T"}`},
+		// Пустой патч ничего не меняет
+		{`{"a":{"b":1}}`, `{}`, `{"a":{"b":1}}`},
+	}
+	for _, tt := range tests {
+		got, err := applyMergePatch([]byte(tt.target), []byte(tt.patch))
+		if err != nil {
+			t.Errorf("applyMergePatch(%s, %s): %v", tt.target, tt.patch, err)
+			continue
+		}
+		var gotValue, wantValue interface{}
+		if err := json.Unmarshal(got, &gotValue); err != nil {
+			t.Fatalf("result %s is not JSON: %v", got, err)
+		}
+		if err := json.Unmarshal([]byte(tt.want), &wantValue); err != nil {
+			t.Fatalf("want %s is not JSON: %v", tt.want, err)
+		}
+		if !reflect.DeepEqual(gotValue, wantValue) {
+			t.Errorf("applyMergePatch(%s, %s) = %s, want %s", tt.target, tt.patch, got, tt.want)
+		}
+	}
+}
+
+func TestApplyMergePatchInvalidJSON(t *testing.T) {
+	if _, err := applyMergePatch([]byte(`{"a":`), []byte(`{}`)); err == nil {
+		t.Errorf("applyMergePatch with an invalid target succeeded")
+	}
+	if _, err := applyMergePatch([]byte(`{}`), []byte(`{"a":`)); err == nil {
+		t.Errorf("applyMergePatch with an invalid patch succeeded")
+	}
+}
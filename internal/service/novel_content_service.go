@@ -8,40 +8,299 @@ import (
 	"errors"
 	"fmt"
 	"log"
-	"novel-server/internal/deepseek"
 	"novel-server/internal/domain"
+	"novel-server/internal/llm"
+	"novel-server/internal/prompts"
 	"novel-server/internal/repository"
-	"os"
+	"novel-server/internal/schema"
+	"sync"
 
 	"github.com/google/uuid"
-	"github.com/jackc/pgx/v5"
-	"github.com/sashabaranov/go-openai"
+	"golang.org/x/sync/singleflight"
 )
 
 // NovelContentService предоставляет функциональность для генерации контента новеллы
 type NovelContentService struct {
-	deepseekClient *deepseek.Client
+	llmProvider    llm.LLMProvider
 	novelRepo      repository.NovelRepository
-	systemPrompt   string
+	prompts        *prompts.Registry
+	repairAttempts int
+	generations    singleflight.Group // Идущие генерации веток, ключ - sceneGenerationKey
+
+	branchesMu sync.Mutex
+	branches   map[string]*branchGeneration // Контексты идущих генераций веток, ключ - sceneGenerationKey
 }
 
-// NewNovelContentService создает новый экземпляр сервиса
-func NewNovelContentService(deepseekClient *deepseek.Client, novelRepo repository.NovelRepository) (*NovelContentService, error) {
-	// Загружаем системный промпт для генерации новеллы
-	promptBytes, err := os.ReadFile("promts/novel_creator.md")
-	if err != nil {
-		return nil, fmt.Errorf("failed to read novel creator prompt: %w", err)
+// NewNovelContentService создает новый экземпляр сервиса.
+// Системный промпт novel_creator берется из реестра promptRegistry при каждой генерации.
+// repairAttempts - сколько раз можно попросить модель исправить ответ, не прошедший проверку по схеме.
+func NewNovelContentService(llmProvider llm.LLMProvider, novelRepo repository.NovelRepository, promptRegistry *prompts.Registry, repairAttempts int) (*NovelContentService, error) {
+	if !promptRegistry.Has(prompts.NovelCreator) {
+		return nil, fmt.Errorf("novel creator prompt %q not found", prompts.NovelCreator)
 	}
 
 	return &NovelContentService{
-		deepseekClient: deepseekClient,
+		llmProvider:    llmProvider,
 		novelRepo:      novelRepo,
-		systemPrompt:   string(promptBytes),
+		prompts:        promptRegistry,
+		repairAttempts: repairAttempts,
+		branches:       make(map[string]*branchGeneration),
 	}, nil
 }
 
+// generationPlan - результат подготовки генерации: либо готовый ответ из кеша,
+// либо состояние, системный промпт и JSON-запрос, который нужно отправить модели, и схема ожидаемого ответа.
+type generationPlan struct {
+	cached         *domain.NovelContentResponse
+	state          *domain.NovelState
+	prompt         prompts.Prompt
+	requestJSON    []byte
+	responseSchema schema.Name
+	responseCheck  responseCheck
+	branchHash     string // Хеш состояния после выбора, которого не нашлось в кеше; пусто для сетапа и сцены 0
+}
+
+// usageTags возвращает метки учета расхода для вызовов модели по этому плану
+func (p *generationPlan) usageTags(request domain.NovelContentRequest) llm.UsageTags {
+	operation := domain.LLMOperationScene
+	if p.responseSchema == schema.SetupResponse {
+		operation = domain.LLMOperationSetup
+	}
+	return llm.UsageTags{Operation: operation, UserID: request.UserID, NovelID: request.NovelID}
+}
+
+// SceneEventFunc получает очередное событие сцены при потоковой генерации.
+// state - состояние игрока, на котором проверяются условия requires вариантов выбора.
+type SceneEventFunc func(event domain.Event, state *domain.NovelState) error
+
 // GenerateNovelContent генерирует или продолжает новеллу на основе запроса
 func (s *NovelContentService) GenerateNovelContent(ctx context.Context, request domain.NovelContentRequest) (*domain.NovelContentResponse, error) {
+	return s.generate(ctx, request, func(ctx context.Context, plan *generationPlan) (*domain.NovelContentResponse, error) {
+		if plan.cached != nil {
+			return plan.cached, nil
+		}
+
+		// Квота списывается только за настоящую генерацию, сцены из кеша бесплатны
+		if err := chargeQuota(ctx); err != nil {
+			return nil, err
+		}
+		ctx = llm.WithUsageTags(ctx, plan.usageTags(request))
+		messages := s.buildContentMessages(plan.prompt, plan.requestJSON)
+		response, err := s.llmProvider.ChatCompletion(ctx, messages)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get response from LLM provider %s: %w", s.llmProvider.Name(), err)
+		}
+		log.Printf("[GenerateNovelContent] Raw response from AI: %s", response)
+
+		jsonStr, err := repairModelJSON(ctx, s.llmProvider, messages, response, plan.responseSchema, plan.responseCheck, s.repairAttempts)
+		if err != nil {
+			return nil, err
+		}
+
+		return s.completeGeneration(ctx, request, plan, jsonStr)
+	})
+}
+
+// GenerateNovelContentStream работает как GenerateNovelContent, но получает ответ модели потоком
+// и передает в onEvent каждое событие сцены, как только оно полностью сгенерировано.
+// Если сцена взята из кеша, все ее события передаются сразу. Возвращает итоговый ответ.
+// Если потоковый ответ не прошел проверку по схеме и модель его исправила, исправленные события
+// в onEvent не передаются - окончательным считается только возвращаемый ответ.
+func (s *NovelContentService) GenerateNovelContentStream(ctx context.Context, request domain.NovelContentRequest, onEvent SceneEventFunc) (*domain.NovelContentResponse, error) {
+	// Генерация может продолжиться для других запросов после выхода из этого метода,
+	// но onEvent вызывающего кода после выхода больше не вызывается
+	events := &sceneEventGate{onEvent: onEvent}
+	defer events.close()
+	onEvent = events.send
+
+	return s.generate(ctx, request, func(ctx context.Context, plan *generationPlan) (*domain.NovelContentResponse, error) {
+		if plan.cached != nil {
+			if sceneContent, ok := plan.cached.NewContent.(*domain.SceneContent); ok && sceneContent != nil {
+				for _, event := range sceneContent.Events {
+					if err := onEvent(event, &plan.cached.State); err != nil {
+						return nil, err
+					}
+				}
+			}
+			return plan.cached, nil
+		}
+
+		// Квота списывается только за настоящую генерацию, сцены из кеша бесплатны
+		if err := chargeQuota(ctx); err != nil {
+			return nil, err
+		}
+		ctx = llm.WithUsageTags(ctx, plan.usageTags(request))
+		messages := s.buildContentMessages(plan.prompt, plan.requestJSON)
+		scanner := &sceneEventScanner{}
+		result, err := s.llmProvider.ChatCompletionStream(ctx, messages, llm.ChatOptions{}, func(delta string) error {
+			for _, raw := range scanner.Write(delta) {
+				var event domain.Event
+				parseErr := json.Unmarshal(raw, &event)
+				if parseErr == nil {
+					parseErr = event.Validate()
+				}
+				if parseErr != nil {
+					// Событие пришло битым - пропускаем его в потоке, итоговый ответ все равно разберется целиком
+					log.Printf("[GenerateNovelContentStream] Skipping malformed streamed event: %v", parseErr)
+					continue
+				}
+				if err := onEvent(event, plan.state); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to stream response from LLM provider %s: %w", s.llmProvider.Name(), err)
+		}
+		log.Printf("[GenerateNovelContentStream] Raw response from AI: %s", result.Content)
+
+		jsonStr, err := repairModelJSON(ctx, s.llmProvider, messages, result.Content, plan.responseSchema, plan.responseCheck, s.repairAttempts)
+		if err != nil {
+			return nil, err
+		}
+
+		return s.completeGeneration(ctx, request, plan, jsonStr)
+	})
+}
+
+// sceneGenerationKey - ключ генерации ветки branchHash новеллы novelID в singleflight
+func sceneGenerationKey(novelID uuid.UUID, branchHash string) string {
+	return novelID.String() + "/" + branchHash
+}
+
+// sceneEventGate передает события в onEvent, пока не закрыт. close дожидается
+// уже начатого вызова onEvent, поэтому после close onEvent не выполняется.
+type sceneEventGate struct {
+	mu      sync.Mutex
+	onEvent SceneEventFunc
+	closed  bool
+}
+
+// send передает событие в onEvent; после close события отбрасываются
+func (g *sceneEventGate) send(event domain.Event, state *domain.NovelState) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.closed {
+		return nil
+	}
+	return g.onEvent(event, state)
+}
+
+// close запрещает дальнейшие вызовы onEvent
+func (g *sceneEventGate) close() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.closed = true
+}
+
+// branchGeneration - контекст генерации ветки, общий для всех запросов, которые ее ждут.
+// Он не зависит от отмены отдельного запроса и отменяется, когда генерацию не ждет никто.
+type branchGeneration struct {
+	ctx     context.Context
+	cancel  context.CancelFunc
+	waiters int
+}
+
+// joinGeneration регистрирует запрос с контекстом ctx как ждущий генерацию ветки key.
+// Значения контекста (роль, метки учета) берутся у первого запроса. Вызывающий код
+// обязан вызвать leaveGeneration.
+func (s *NovelContentService) joinGeneration(ctx context.Context, key string) *branchGeneration {
+	s.branchesMu.Lock()
+	defer s.branchesMu.Unlock()
+
+	generation, ok := s.branches[key]
+	if !ok {
+		generationCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+		generation = &branchGeneration{ctx: generationCtx, cancel: cancel}
+		s.branches[key] = generation
+	}
+	generation.waiters++
+	return generation
+}
+
+// leaveGeneration снимает запрос с ожидания генерации ветки key. Ушел последний - генерация отменяется.
+func (s *NovelContentService) leaveGeneration(key string, generation *branchGeneration) {
+	s.branchesMu.Lock()
+	defer s.branchesMu.Unlock()
+
+	generation.waiters--
+	if generation.waiters == 0 {
+		generation.cancel()
+		if s.branches[key] == generation {
+			delete(s.branches, key)
+		}
+	}
+}
+
+// generate готовит генерацию (prepareGeneration) и выполняет план функцией run.
+//
+// Игроки, одновременно пришедшие в одну ветку (та же новелла и тот же хеш состояния после выбора),
+// не генерируют сцену каждый сам. Один запрос генерирует ее, удерживая блокировку ветки
+// (LockSceneGeneration - в PostgreSQL и между серверами), остальные запросы этого процесса ждут его
+// и затем берут сохраненную сцену из кеша, как при обычном попадании в кеш. Под блокировкой план
+// готовится заново: пока запрос ждал, ветку мог сгенерировать другой сервер.
+//
+// Любой запрос, в том числе начавший генерацию, перестает ждать при отмене своего ctx.
+// Сама генерация идет в общем контексте ветки (branchGeneration) и отменяется, только когда
+// ее не ждет ни один запрос: иначе результат все равно понадобится оставшимся.
+func (s *NovelContentService) generate(ctx context.Context, request domain.NovelContentRequest,
+	run func(ctx context.Context, plan *generationPlan) (*domain.NovelContentResponse, error)) (*domain.NovelContentResponse, error) {
+	plan, err := s.prepareGeneration(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+
+	for plan.branchHash != "" {
+		branchHash := plan.branchHash
+		key := sceneGenerationKey(request.NovelID, branchHash)
+		generation := s.joinGeneration(ctx, key)
+		leader := false
+		results := s.generations.DoChan(key, func() (interface{}, error) {
+			leader = true
+			var response *domain.NovelContentResponse
+			err := s.novelRepo.LockSceneGeneration(generation.ctx, request.NovelID, branchHash, func(ctx context.Context) error {
+				locked, err := s.prepareGeneration(ctx, request)
+				if err != nil {
+					return err
+				}
+				response, err = run(ctx, locked)
+				return err
+			})
+			return response, err
+		})
+
+		var result singleflight.Result
+		select {
+		case result = <-results:
+			s.leaveGeneration(key, generation)
+		case <-ctx.Done():
+			s.leaveGeneration(key, generation)
+			return nil, ctx.Err()
+		}
+
+		// leader записан до отправки результата в канал, поэтому читать его здесь безопасно
+		if leader {
+			if result.Err != nil {
+				return nil, result.Err
+			}
+			return result.Val.(*domain.NovelContentResponse), nil
+		}
+
+		// Ветку генерировал другой запрос. Даже если у него не получилось, план готовится заново:
+		// при промахе кеша этот запрос сам станет генерирующим
+		log.Printf("[GenerateNovelContent] Waited for concurrent generation of branch %s in NovelID %s (err: %v)", branchHash, request.NovelID, result.Err)
+		plan, err = s.prepareGeneration(ctx, request)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return run(ctx, plan)
+}
+
+// prepareGeneration загружает состояние пользователя, применяет его выбор и ищет готовую сцену в кеше.
+// Если сцену нужно генерировать, возвращает состояние и JSON-запрос для модели.
+func (s *NovelContentService) prepareGeneration(ctx context.Context, request domain.NovelContentRequest) (*generationPlan, error) {
 	log.Printf("[GenerateNovelContent] Received request. NovelID: %s, UserID: %s, HasUserChoice: %t, RestartFromSceneIndex: %v",
 		request.NovelID, request.UserID, request.UserChoice != nil, request.RestartFromSceneIndex)
 
@@ -53,13 +312,27 @@ func (s *NovelContentService) GenerateNovelContent(ctx context.Context, request
 		return nil, fmt.Errorf("user_id is required")
 	}
 
+	// Перезапуск с уже пройденной сцены не требует генерации
+	if request.RestartFromSceneIndex != nil {
+		response, err := s.RestartFromScene(ctx, request.NovelID, request.UserID, *request.RestartFromSceneIndex)
+		if err != nil {
+			return nil, err
+		}
+		return &generationPlan{cached: response}, nil
+	}
+
+	// Проходить можно только новеллы, доступные пользователю (см. checkNovelAccess)
+	if _, err := checkNovelAccess(ctx, s.novelRepo, request.NovelID, request.UserID); err != nil {
+		return nil, err
+	}
+
 	var state *domain.NovelState
 	var sceneIndex int
 	var err error
 
 	// Загружаем сетап новеллы (состояние с индексом 0) для получения статических данных
 	setupStateData, setupErr := s.novelRepo.GetNovelSetupState(ctx, request.NovelID)
-	if setupErr != nil && !errors.Is(setupErr, pgx.ErrNoRows) {
+	if setupErr != nil && !errors.Is(setupErr, repository.ErrNotFound) {
 		log.Printf("[GenerateNovelContent] Error getting setup state: %v", setupErr)
 		return nil, fmt.Errorf("failed to get novel setup state: %w", setupErr)
 	}
@@ -104,20 +377,21 @@ func (s *NovelContentService) GenerateNovelContent(ctx context.Context, request
 					sceneContent = nil
 				}
 
-				// Обновить хеш состояния для нового пользователя и сохранить прогресс
-				stateData, err := json.Marshal(*state)
-				if err == nil {
-					err = s.novelRepo.SaveNovelState(ctx, request.NovelID, 0, request.UserID, state.StateHash, stateData)
-					if err != nil {
-						log.Printf("[GenerateNovelContent] Error saving existing state for new user %s: %v", request.UserID, err)
-					}
+				// Сохраняем состояние и прогресс нового пользователя. Хеш в JSON состояния не хранится,
+				// поэтому вычисляем его заново так же, как при сохранении сцены
+				if state.StateHash, err = hashSceneState(state); err != nil {
+					return nil, fmt.Errorf("failed to calculate scene 0 state hash: %w", err)
+				}
+				if err := s.saveStateProgress(ctx, request.NovelID, 0, request.UserID, state); err != nil {
+					log.Printf("[GenerateNovelContent] Error saving existing state for new user %s: %v", request.UserID, err)
+					return nil, err
 				}
 
 				response := &domain.NovelContentResponse{
 					State:      *state,
 					NewContent: sceneContent,
 				}
-				return response, nil
+				return &generationPlan{cached: response}, nil
 			}
 		} else {
 			log.Printf("[GenerateNovelContent] No existing scene 0 found for NovelID %s: %v", request.NovelID, err)
@@ -126,10 +400,17 @@ func (s *NovelContentService) GenerateNovelContent(ctx context.Context, request
 
 	// Продолжаем с обычной логикой получения состояния
 	if progress != nil && setupState != nil {
-		// Объединяем сетап с прогрессом пользователя
-		state = MergeStateWithProgress(setupState, progress)
+		// Сцены, стадия и индекс берутся из сохраненного состояния последней сцены пользователя,
+		// динамические элементы - из его прогресса
+		state, err = loadPlayedState(ctx, s.novelRepo, request.NovelID, request.UserID, latestSceneIndex)
+		if errors.Is(err, ErrSceneNotPlayed) {
+			// Прогресс сохранен вместе с сетапом, а сетап хранится только в новелле
+			state = MergeStateWithProgress(setupState, progress)
+		} else if err != nil {
+			return nil, err
+		}
 		sceneIndex = latestSceneIndex
-		log.Printf("[GenerateNovelContent] Merged setup with user progress for UserID %s in NovelID %s, SceneIndex: %d",
+		log.Printf("[GenerateNovelContent] Merged saved state with user progress for UserID %s in NovelID %s, SceneIndex: %d",
 			request.UserID, request.NovelID, sceneIndex)
 	} else if setupState != nil {
 		// Если есть сетап, но нет прогресса - новый пользователь в существующей новелле
@@ -146,9 +427,11 @@ func (s *NovelContentService) GenerateNovelContent(ctx context.Context, request
 
 	// --- Переменная для хранения JSON запроса к ИИ (если он понадобится) ---
 	var requestJSON []byte
+	var responseSchema schema.Name // Схема, которой должен соответствовать ответ модели на requestJSON
+	var branchHash string          // Ветка, которую нужно сгенерировать (см. generationPlan.branchHash)
 
 	// --- ОБНОВЛЕННАЯ ЛОГИКА: Обработка случая отсутствия состояния у пользователя ---
-	if state == nil && request.RestartFromSceneIndex == nil {
+	if state == nil {
 		log.Printf("[GenerateNovelContent] No saved state found for user %s. Checking for existing scene 0 (setup state)...", request.UserID)
 
 		// 1. Пытаемся получить общее состояние для сцены 0 (setup)
@@ -181,22 +464,13 @@ func (s *NovelContentService) GenerateNovelContent(ctx context.Context, request
 			state.CurrentSceneIndex = 0        // Убедимся, что индекс правильный
 			// state.CurrentStage уже должен быть правильным (StageSceneReady) из кеша
 
-			// Сохраняем это начальное состояние для НОВОГО пользователя
-			initialSaveData, err := json.Marshal(*state)
-			if err != nil {
-				log.Printf("[GenerateNovelContent] Error marshaling initial state for user %s: %v", request.UserID, err)
-				// Ошибка не критична для возврата результата, но логируем
-			} else {
-				// Хеш для сцены 0 обычно не так важен, как для последующих выборов
-				initialHash := state.StateHash // Используем хеш из setupState, если он там был
-				if initialHash == "" {
-					initialHash = "SCENE_0_HASH_PLACEHOLDER"
-				}
-				err = s.novelRepo.SaveNovelState(ctx, request.NovelID, 0, request.UserID, initialHash, initialSaveData)
-				if err != nil {
-					log.Printf("[GenerateNovelContent] Error saving initial state for user %s: %v", request.UserID, err)
-					// Ошибка не критична для возврата результата
-				}
+			// Сохраняем это начальное состояние и прогресс для НОВОГО пользователя
+			if state.StateHash, err = hashSceneState(state); err != nil {
+				return nil, fmt.Errorf("failed to calculate initial state hash: %w", err)
+			}
+			if err := s.saveStateProgress(ctx, request.NovelID, 0, request.UserID, state); err != nil {
+				log.Printf("[GenerateNovelContent] Error saving initial state for user %s: %v", request.UserID, err)
+				return nil, err
 			}
 
 			// Формируем ответ на основе загруженного состояния
@@ -210,9 +484,9 @@ func (s *NovelContentService) GenerateNovelContent(ctx context.Context, request
 				NewContent: sceneContent,
 			}
 			log.Printf("[GenerateNovelContent] Reused existing setup state (scene 0) for user %s.", request.UserID)
-			return response, nil // --- ВОЗВРАЩАЕМ ГОТОВУЮ СЦЕНУ 0 ---
+			return &generationPlan{cached: response}, nil // --- ВОЗВРАЩАЕМ ГОТОВУЮ СЦЕНУ 0 ---
 
-		} else if errors.Is(err, pgx.ErrNoRows) {
+		} else if errors.Is(err, repository.ErrNotFound) {
 			// --- СЦЕНА 0 НЕ НАЙДЕНА В КЕШЕ ---
 			log.Printf("[GenerateNovelContent] No existing setup state found for NovelID %s. Proceeding to generate initial request.", request.NovelID)
 			// Переходим к генерации первоначального запроса
@@ -259,24 +533,12 @@ func (s *NovelContentService) GenerateNovelContent(ctx context.Context, request
 		if err != nil {
 			return nil, fmt.Errorf("failed to prepare initial request: %w", err)
 		}
+		responseSchema = schema.SetupResponse
 		log.Printf("[GenerateNovelContent] Prepared initial request for NovelID: %s", request.NovelID)
 		// --- КОНЕЦ БЛОКА ГЕНЕРАЦИИ ПЕРВОНАЧАЛЬНОГО ЗАПРОСА ---
 
-	} else if request.RestartFromSceneIndex != nil {
-		// --- ОБРАБОТКА ЯВНОГО ЗАПРОСА НА ПЕРЕЗАПУСК ---
-		// TODO: Добавить логику перезапуска с конкретной сцены, если она нужна.
-		// Сейчас она может попасть в блок ниже (обработка существующего state),
-		// но это может быть некорректно, если нужно загружать состояние именно запрошенной сцены.
-		log.Printf("[GenerateNovelContent] Handling explicit restart request (index %d) - current logic might proceed to continuation.", *request.RestartFromSceneIndex)
-		// Если нужно загружать конкретное состояние:
-		// stateData, err := s.novelRepo.GetNovelState(ctx, request.NovelID, request.UserID, *request.RestartFromSceneIndex)
-		// ... обработка ошибки и unmarshal ...
-		// requestJSON, err = s.prepareContinuationRequest(state, nil) // Формируем запрос на продолжение с загруженного состояния
-
-		// --- Пока что оставляем как есть, попадает в блок ниже ---
-
 	} else {
-		// --- ОБРАБОТКА СУЩЕСТВУЮЩЕГО СОСТОЯНИЯ ПОЛЬЗОВАТЕЛЯ (> сцены 0 или при перезапуске) ---
+		// --- ОБРАБОТКА СУЩЕСТВУЮЩЕГО СОСТОЯНИЯ ПОЛЬЗОВАТЕЛЯ (> сцены 0) ---
 		log.Printf("[GenerateNovelContent] Found saved state for UserID %s, NovelID: %s, SceneIndex: %d, Stage: %s",
 			request.UserID, request.NovelID, sceneIndex, state.CurrentStage)
 
@@ -290,7 +552,10 @@ func (s *NovelContentService) GenerateNovelContent(ctx context.Context, request
 			if len(updatedState.Scenes) > updatedState.CurrentSceneIndex {
 				scene := updatedState.Scenes[updatedState.CurrentSceneIndex]
 				// Применяем последствия выбора к состоянию
-				processUserChoice(&updatedState, scene, request.UserChoice.ChoiceText)
+				if err := processUserChoice(&updatedState, scene, request.UserChoice.ChoiceText); err != nil {
+					log.Printf("[GenerateNovelContent] User choice rejected: %v", err)
+					return nil, err
+				}
 				log.Printf("[GenerateNovelContent] Processed user choice.")
 
 				// --- DEBUG LOGGING: Состояние после выбора ---
@@ -376,26 +641,21 @@ func (s *NovelContentService) GenerateNovelContent(ctx context.Context, request
 						response.NewContent = sceneContent
 					}
 
-					// Сохраняем итоговое ОБЪЕДИНЕННОЕ состояние для ТЕКУЩЕГО пользователя
-					finalStateData, err := json.Marshal(updatedState)
-					if err != nil {
-						log.Printf("[GenerateNovelContent] Error marshaling final state after cache: %v", err)
-						// Критическая ошибка, не можем сохранить
-						return nil, fmt.Errorf("failed to marshal final state after cache: %w", err)
-					}
-					err = s.novelRepo.SaveNovelState(ctx, request.NovelID, nextSceneIndex, request.UserID, expectedStateHash, finalStateData)
+					// Сохраняем итоговое ОБЪЕДИНЕННОЕ состояние и прогресс ТЕКУЩЕГО пользователя, как после генерации
+					err = s.saveStateProgress(ctx, request.NovelID, nextSceneIndex, request.UserID, &updatedState)
 					if err != nil {
 						log.Printf("[GenerateNovelContent] Error saving merged state after cache load for user %s: %v", request.UserID, err)
-						// Не критично, возвращаем результат, но логируем ошибку сохранения
+						return nil, err
 					}
 
 					log.Printf("[GenerateNovelContent] Reused existing state for scene %d using hash %s for UserID %s.", nextSceneIndex, expectedStateHash, request.UserID)
-					return response, nil // --- ВОЗВРАЩАЕМ РЕЗУЛЬТАТ ИЗ КЕША ---
-				} else if errors.Is(err, pgx.ErrNoRows) {
+					return &generationPlan{cached: response}, nil // --- ВОЗВРАЩАЕМ РЕЗУЛЬТАТ ИЗ КЕША ---
+				} else if errors.Is(err, repository.ErrNotFound) {
 					// --- DEBUG LOGGING: Кеш не найден ---
-					log.Printf("[DEBUG_HASH_SEARCH] No compatible state found by hash %s (pgx.ErrNoRows). Proceeding to generate content.", expectedStateHash)
+					log.Printf("[DEBUG_HASH_SEARCH] No compatible state found by hash %s. Proceeding to generate content.", expectedStateHash)
 					// --- END DEBUG LOGGING ---
 					// Состояние с таким хешом не найдено, продолжаем генерацию
+					branchHash = expectedStateHash
 				} else {
 					// --- DEBUG LOGGING: Ошибка поиска по хешу ---
 					log.Printf("[DEBUG_HASH_SEARCH] Error searching state by hash %s: %v. Proceeding to generate content.", expectedStateHash, err)
@@ -439,20 +699,20 @@ func (s *NovelContentService) GenerateNovelContent(ctx context.Context, request
 								sceneContent = nil
 							}
 
-							// Сохраняем состояние для текущего пользователя (на всякий случай, если GetLatest не вернул полное состояние)
-							stateData, err := json.Marshal(existingScene)
-							if err == nil {
-								err = s.novelRepo.SaveNovelState(ctx, request.NovelID, 0, request.UserID, existingScene.StateHash, stateData)
-								if err != nil {
-									log.Printf("[GenerateNovelContent] Error saving scene 0 state for user %s: %v", request.UserID, err)
-								}
+							// Сохраняем состояние и прогресс текущего пользователя (на всякий случай, если GetLatest не вернул полное состояние)
+							if existingScene.StateHash, err = hashSceneState(&existingScene); err != nil {
+								return nil, fmt.Errorf("failed to calculate scene 0 state hash: %w", err)
+							}
+							if err := s.saveStateProgress(ctx, request.NovelID, 0, request.UserID, &existingScene); err != nil {
+								log.Printf("[GenerateNovelContent] Error saving scene 0 state for user %s: %v", request.UserID, err)
+								return nil, err
 							}
 
 							response := &domain.NovelContentResponse{
 								State:      existingScene,
 								NewContent: sceneContent,
 							}
-							return response, nil // --- ВОЗВРАЩАЕМ СУЩЕСТВУЮЩУЮ СЦЕНУ 0 ---
+							return &generationPlan{cached: response}, nil // --- ВОЗВРАЩАЕМ СУЩЕСТВУЮЩУЮ СЦЕНУ 0 ---
 						} else {
 							log.Printf("[GenerateNovelContent] Found scene 0 but it's not in scene_ready stage (it's %s). Will generate.",
 								existingScene.CurrentStage)
@@ -476,6 +736,7 @@ func (s *NovelContentService) GenerateNovelContent(ctx context.Context, request
 		if err != nil {
 			return nil, fmt.Errorf("failed to prepare continuation request: %w", err)
 		}
+		responseSchema = schema.SceneResponse
 		log.Printf("[GenerateNovelContent] Prepared continuation request for NovelID: %s, SceneIndex: %d", request.NovelID, state.CurrentSceneIndex)
 
 	} // Конец основного блока else (обработка существующего состояния)
@@ -488,54 +749,71 @@ func (s *NovelContentService) GenerateNovelContent(ctx context.Context, request
 		return nil, fmt.Errorf("internal error: failed to determine AI request type")
 	}
 
-	// log.Printf("[GenerateNovelContent] Sending request to AI: %s", string(requestJSON))
-
-	// Создаем сообщения для отправки в DeepSeek
-	messages := []openai.ChatCompletionMessage{
-		{
-			Role:    openai.ChatMessageRoleUser,
-			Content: string(requestJSON),
-		},
+	prompt, err := s.renderPrompt(ctx, request, state)
+	if err != nil {
+		return nil, err
 	}
 
-	// Устанавливаем системный промпт
-	messages = deepseek.SetSystemPrompt(messages, s.systemPrompt)
+	plan := &generationPlan{state: state, prompt: prompt, requestJSON: requestJSON, responseSchema: responseSchema, branchHash: branchHash}
+	if responseSchema == schema.SceneResponse {
+		// Сцена должна ссылаться только на персонажей и фоны из сетапа
+		plan.responseCheck = sceneCastCheck(state)
+	}
+	return plan, nil
+}
 
-	// Отправляем запрос к DeepSeek
-	// log.Printf("[GenerateNovelContent] Sending request to AI with messages: %+v", messages)
-	response, err := s.deepseekClient.ChatCompletion(ctx, messages)
+// renderPrompt отрисовывает активную версию системного промпта novel_creator для состояния state
+func (s *NovelContentService) renderPrompt(ctx context.Context, request domain.NovelContentRequest, state *domain.NovelState) (prompts.Prompt, error) {
+	data := prompts.Data{
+		Language:       state.Language,
+		IsAdultContent: state.IsAdultContent,
+		SceneCount:     state.SceneCount,
+		SceneIndex:     state.CurrentSceneIndex,
+		Stage:          state.CurrentStage,
+	}
+	// Желаемое количество событий в сцене есть только в конфиге новеллы
+	config, err := s.novelRepo.GetNovelConfigByID(ctx, request.NovelID, request.UserID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get response from DeepSeek: %w", err)
+		log.Printf("[GenerateNovelContent] Warning: Could not get config for prompt variables: %v", err)
+	} else {
+		data.SceneEventTarget = config.StoryConfig.SceneEventTarget
 	}
-	log.Printf("[GenerateNovelContent] Raw response from AI: %s", response)
 
-	// Извлекаем JSON из ответа модели
-	jsonStr, err := extractJSONFromResponse(response)
+	prompt, err := s.prompts.Render(prompts.NovelCreator, data)
 	if err != nil {
-		return nil, fmt.Errorf("failed to extract JSON from response: %w", err)
+		return prompts.Prompt{}, err
 	}
+	log.Printf("[GenerateNovelContent] Using prompt %s", prompt.ID())
+	return prompt, nil
+}
+
+// buildContentMessages формирует диалог для novel_creator из системного промпта и JSON-запроса.
+func (s *NovelContentService) buildContentMessages(prompt prompts.Prompt, requestJSON []byte) []llm.Message {
+	messages := []llm.Message{
+		{
+			Role:    llm.RoleUser,
+			Content: string(requestJSON),
+		},
+	}
+	return llm.SetSystemPrompt(messages, prompt.Text)
+}
+
+// completeGeneration разбирает проверенный по схеме JSON-ответ модели, обновляет состояние и сохраняет прогресс пользователя.
+func (s *NovelContentService) completeGeneration(ctx context.Context, request domain.NovelContentRequest, plan *generationPlan, jsonStr string) (*domain.NovelContentResponse, error) {
 	log.Printf("[GenerateNovelContent] Received JSON response from AI: %s", jsonStr)
 
 	// Обрабатываем ответ и обновляем состояние новеллы
-	novelResponse, err := s.processModelResponse(jsonStr, state)
+	novelResponse, err := s.processModelResponse(jsonStr, plan.state)
 	if err != nil {
 		return nil, fmt.Errorf("failed to process model response: %w", err)
 	}
+	// Запоминаем версию промпта, по которой сгенерирован сетап или сцена
+	novelResponse.State.PromptVersion = plan.prompt.ID()
 	log.Printf("[GenerateNovelContent] Processed model response. New Stage: %s, New SceneIndex: %d, Has NewContent: %t",
 		novelResponse.State.CurrentStage, novelResponse.State.CurrentSceneIndex, novelResponse.NewContent != nil)
 
 	// Вычисляем хеш для нового сгенерированного состояния
-	// Используем последний сделанный выбор (если был) или пустую строку
-	lastChoice := ""
-	if len(novelResponse.State.PreviousChoices) > 0 {
-		lastChoice = novelResponse.State.PreviousChoices[len(novelResponse.State.PreviousChoices)-1]
-	}
-	finalStateHash, err := hashStateKey(
-		lastChoice,
-		novelResponse.State.GlobalFlags,
-		novelResponse.State.Relationship,
-		novelResponse.State.StoryVariables,
-	)
+	finalStateHash, err := hashSceneState(&novelResponse.State)
 	if err != nil {
 		log.Printf("[GenerateNovelContent] Error calculating hash for final generated state: %v", err)
 		// Не можем сохранить с правильным хешом, но можем вернуть результат
@@ -545,12 +823,12 @@ func (s *NovelContentService) GenerateNovelContent(ctx context.Context, request
 	}
 	novelResponse.State.StateHash = finalStateHash // Сохраняем хеш в объекте состояния
 
-	// Сохраняем обновленное состояние новеллы, используя новый метод
+	// Сохраняем обновленное состояние новеллы. Несохраненную сцену не отдаем: иначе клиент
+	// продолжит со сцены, которой нет в базе
 	err = s.saveStateProgress(ctx, request.NovelID, novelResponse.State.CurrentSceneIndex, request.UserID, &novelResponse.State)
 	if err != nil {
-		// Ошибка сохранения не критична для возврата ответа, но важна
 		log.Printf("[GenerateNovelContent] Error saving final generated state: %v", err)
-		// return nil, fmt.Errorf("failed to save novel state: %w", err)
+		return nil, err
 	}
 
 	return novelResponse, nil
@@ -561,6 +839,10 @@ func (s *NovelContentService) HandleInlineResponse(ctx context.Context, userID s
 	log.Printf("[NovelContentService] HandleInlineResponse called for NovelID: %s, SceneIndex: %d, ChoiceID: %s",
 		request.NovelID, request.SceneIndex, request.ChoiceID)
 
+	if _, err := checkNovelAccess(ctx, s.novelRepo, request.NovelID, userID); err != nil {
+		return nil, err
+	}
+
 	// Получаем текущее состояние из репозитория
 	stateData, sceneIndex, err := s.novelRepo.GetLatestNovelState(ctx, request.NovelID, userID)
 	if err != nil {
@@ -602,14 +884,18 @@ func (s *NovelContentService) HandleInlineResponse(ctx context.Context, userID s
 
 	currentScene := currentState.Scenes[request.SceneIndex]
 
-	// Ищем событие inline_response с соответствующим choice_id
-	var targetEvent *domain.Event
-	for i := range currentScene.Events {
-		event := &currentScene.Events[i]
-		if event.EventType == "inline_response" && event.Data != nil {
-			if choiceID, ok := event.Data["choice_id"].(string); ok && choiceID == request.ChoiceID {
-				targetEvent = event
-				break
+	// Ищем события inline_choice и inline_response с соответствующим choice_id
+	var choiceEvent *domain.InlineChoiceEvent
+	var targetEvent *domain.InlineResponseEvent
+	for _, event := range currentScene.Events {
+		switch payload := event.Payload.(type) {
+		case domain.InlineChoiceEvent:
+			if payload.ChoiceID == request.ChoiceID && choiceEvent == nil {
+				choiceEvent = &payload
+			}
+		case domain.InlineResponseEvent:
+			if payload.ChoiceID == request.ChoiceID && targetEvent == nil {
+				targetEvent = &payload
 			}
 		}
 	}
@@ -620,157 +906,47 @@ func (s *NovelContentService) HandleInlineResponse(ctx context.Context, userID s
 		return nil, fmt.Errorf("inline_response event with choice_id '%s' not found", request.ChoiceID)
 	}
 
-	// Получаем responses из события
-	responses, ok := targetEvent.Data["responses"].([]interface{})
-	if !ok || len(responses) <= request.ResponseIdx {
-		log.Printf("[NovelContentService] HandleInlineResponse - Response index %d out of bounds or invalid responses", request.ResponseIdx)
-		return nil, fmt.Errorf("response index out of bounds or invalid responses array")
-	}
-
-	// Получаем выбранный response
-	responseMap, ok := responses[request.ResponseIdx].(map[string]interface{})
-	if !ok {
-		log.Printf("[NovelContentService] HandleInlineResponse - Invalid response format at index %d", request.ResponseIdx)
-		log.Printf("[NovelContentService] HandleInlineResponse - Response data type: %T, value: %+v", responses[request.ResponseIdx], responses[request.ResponseIdx])
-		return nil, fmt.Errorf("invalid response format")
+	// Получаем выбранный response. Сначала ищем по тексту: скрытые варианты не показываются
+	// клиенту, поэтому его индексы могут не совпадать с индексами responses
+	responseIdx := -1
+	for i, response := range targetEvent.Responses {
+		if response.ChoiceText == request.ChoiceText {
+			responseIdx = i
+			break
+		}
 	}
-
-	// Проверяем соответствие текста выбора
-	responseText, ok := responseMap["choice_text"].(string)
-	if !ok || responseText != request.ChoiceText {
-		log.Printf("[NovelContentService] HandleInlineResponse - Choice text mismatch: '%s' vs '%s'", responseText, request.ChoiceText)
-		log.Printf("[NovelContentService] HandleInlineResponse - Response keys available: %+v", getMapKeys(responseMap))
+	if responseIdx < 0 {
 		// Не возвращаем ошибку, а просто логируем предупреждение, так как клиент мог получить устаревшие данные
-		log.Printf("[NovelContentService] HandleInlineResponse - WARNING: Proceeding despite text mismatch")
+		log.Printf("[NovelContentService] HandleInlineResponse - WARNING: No response with choice text '%s', using response index %d",
+			request.ChoiceText, request.ResponseIdx)
+		responseIdx = request.ResponseIdx
 	}
-
-	// Создаем структуру для отслеживания изменений
-	stateChanges := domain.NovelStateChanges{
-		Relationship:   make(map[string]int),
-		StoryVariables: make(map[string]interface{}),
-		GlobalFlags:    []string{},
+	if responseIdx < 0 || responseIdx >= len(targetEvent.Responses) {
+		log.Printf("[NovelContentService] HandleInlineResponse - Response index %d out of bounds (%d responses)",
+			responseIdx, len(targetEvent.Responses))
+		return nil, fmt.Errorf("response index out of bounds")
 	}
+	response := targetEvent.Responses[responseIdx]
 
-	// Вычисляем изменения от выбранного response и ПРИМЕНЯЕМ их к состоянию
-	// 1. Изменения в отношениях (relationship)
-	if relationshipChanges, ok := responseMap["relationship_changes"].(map[string]interface{}); ok {
-		for character, valueInterface := range relationshipChanges {
-			if value, ok := valueInterface.(float64); ok {
-				// Обновляем значение в состоянии
-				intValue := int(value)
-				if currentState.Relationship == nil {
-					currentState.Relationship = make(map[string]int)
-				}
-
-				// Получаем текущее значение из состояния или 0, если его нет
-				currentValue := currentState.Relationship[character]
-				// Расчитываем новое значение
-				newValue := currentValue + intValue
-				// Применяем к состоянию
-				currentState.Relationship[character] = newValue
-
-				// Добавляем в stateChanges для отправки клиенту
-				stateChanges.Relationship[character] = newValue
-
-				log.Printf("[NovelContentService] HandleInlineResponse - Applied relationship change for '%s': %+d (now %d)",
-					character, intValue, newValue)
-			} else {
-				log.Printf("[NovelContentService] HandleInlineResponse - Invalid relationship change value type for '%s': %T",
-					character, valueInterface)
-			}
-		}
-	} else if responseMap["relationship_changes"] != nil {
-		log.Printf("[NovelContentService] HandleInlineResponse - relationship_changes has unexpected type: %T",
-			responseMap["relationship_changes"])
+	// Проверяем условие варианта и применяем последствия к состоянию
+	before := snapshotState(&currentState)
+	inlineChoice := domain.InlineChoiceEvent{ChoiceID: request.ChoiceID}
+	if choiceEvent != nil {
+		inlineChoice = *choiceEvent
 	}
-
-	// 2. Добавление глобальных флагов
-	if flagsToAdd, ok := responseMap["add_global_flags"].([]interface{}); ok {
-		for _, flagInterface := range flagsToAdd {
-			if flag, ok := flagInterface.(string); ok {
-				// Проверяем, не существует ли уже такой флаг
-				flagExists := false
-				for _, existingFlag := range currentState.GlobalFlags {
-					if existingFlag == flag {
-						flagExists = true
-						break
-					}
-				}
-
-				if !flagExists {
-					// Добавляем флаг в состояние
-					currentState.GlobalFlags = append(currentState.GlobalFlags, flag)
-					// Добавляем флаг в stateChanges для отправки клиенту
-					stateChanges.GlobalFlags = append(stateChanges.GlobalFlags, flag)
-					log.Printf("[NovelContentService] HandleInlineResponse - Added global flag to state: '%s'", flag)
-				}
-			} else {
-				log.Printf("[NovelContentService] HandleInlineResponse - Invalid flag type: %T", flagInterface)
-			}
-		}
-	} else if responseMap["add_global_flags"] != nil {
-		log.Printf("[NovelContentService] HandleInlineResponse - add_global_flags has unexpected type: %T",
-			responseMap["add_global_flags"])
+	if err := applyInlineChoice(&currentState, inlineChoice, response); err != nil {
+		log.Printf("[NovelContentService] HandleInlineResponse - Choice rejected: %v", err)
+		return nil, err
 	}
 
-	// 3. Обновление story_variables
-	if variableChanges, ok := responseMap["story_variables"].(map[string]interface{}); ok {
-		if currentState.StoryVariables == nil {
-			currentState.StoryVariables = make(map[string]interface{})
-		}
-		for key, value := range variableChanges {
-			// Применяем изменение к состоянию
-			currentState.StoryVariables[key] = value
-			// Добавляем переменную в stateChanges для отправки клиенту
-			stateChanges.StoryVariables[key] = value
-			log.Printf("[NovelContentService] HandleInlineResponse - Updated story variable '%s': %v", key, value)
-		}
-	} else if responseMap["story_variables"] != nil {
-		log.Printf("[NovelContentService] HandleInlineResponse - story_variables has unexpected type: %T",
-			responseMap["story_variables"])
-	}
+	// Изменения для отправки клиенту
+	stateChanges := diffStateChanges(before, &currentState)
+	log.Printf("[NovelContentService] HandleInlineResponse - Applied consequences: flags +%v -%v, relationship %v, story variables %v",
+		stateChanges.GlobalFlags, stateChanges.RemovedGlobalFlags, stateChanges.Relationship, stateChanges.StoryVariables)
 
 	// Получаем события для отображения после выбора
-	var nextEvents []domain.SimplifiedEvent
-	if responseEvents, ok := responseMap["response_events"].([]interface{}); ok {
-		events := make([]domain.Event, 0, len(responseEvents))
-
-		for i, eventInterface := range responseEvents {
-			if eventMap, ok := eventInterface.(map[string]interface{}); ok {
-				eventType, hasType := eventMap["event_type"].(string)
-				if !hasType {
-					log.Printf("[NovelContentService] HandleInlineResponse - Response event #%d missing event_type", i)
-					continue
-				}
-
-				event := domain.Event{
-					EventType: eventType,
-				}
-
-				// Заполняем поля события в зависимости от их наличия
-				if text, ok := eventMap["text"].(string); ok {
-					event.Text = text
-				}
-				if speaker, ok := eventMap["speaker"].(string); ok {
-					event.Speaker = speaker
-				}
-				// И так далее для других полей...
-
-				events = append(events, event)
-			} else {
-				log.Printf("[NovelContentService] HandleInlineResponse - Invalid response event format at index %d: %T",
-					i, eventInterface)
-			}
-		}
-
-		// Преобразуем события в упрощенную форму для клиента
-		nextEvents = convertEventsToSimplified(events)
-		log.Printf("[NovelContentService] HandleInlineResponse - Created %d next events from %d response events",
-			len(nextEvents), len(responseEvents))
-	} else {
-		log.Printf("[NovelContentService] HandleInlineResponse - response_events has unexpected type or is missing: %T",
-			responseMap["response_events"])
-	}
+	nextEvents := domain.SimplifyEvents(response.ResponseEvents, &currentState)
+	log.Printf("[NovelContentService] HandleInlineResponse - Created %d next events", len(nextEvents))
 
 	// Важно: сохраняем изменения в базе данных
 	// Добавляем выбор в список предыдущих выборов
@@ -786,10 +962,9 @@ func (s *NovelContentService) HandleInlineResponse(ctx context.Context, userID s
 	err = s.saveStateProgress(ctx, request.NovelID, request.SceneIndex, userID, &currentState)
 	if err != nil {
 		log.Printf("[NovelContentService] HandleInlineResponse - Error saving updated state: %v", err)
-		// Несмотря на ошибку сохранения, продолжаем и возвращаем изменения клиенту
-	} else {
-		log.Printf("[NovelContentService] HandleInlineResponse - Successfully saved updated state to database")
+		return nil, err
 	}
+	log.Printf("[NovelContentService] HandleInlineResponse - Successfully saved updated state to database")
 
 	log.Printf("[NovelContentService] HandleInlineResponse - Successfully processed inline response for NovelID: %s, SceneIndex: %d",
 		request.NovelID, request.SceneIndex)
@@ -802,52 +977,6 @@ func (s *NovelContentService) HandleInlineResponse(ctx context.Context, userID s
 	}, nil
 }
 
-// getMapKeys вспомогательная функция для получения списка ключей из карты
-func getMapKeys(m map[string]interface{}) []string {
-	keys := make([]string, 0, len(m))
-	for k := range m {
-		keys = append(keys, k)
-	}
-	return keys
-}
-
-// convertEventsToSimplified преобразует события в упрощенную форму для клиента
-func convertEventsToSimplified(events []domain.Event) []domain.SimplifiedEvent {
-	result := make([]domain.SimplifiedEvent, len(events))
-
-	for i, event := range events {
-		result[i] = domain.SimplifiedEvent{
-			EventType:   event.EventType,
-			Speaker:     event.Speaker,
-			Text:        event.Text,
-			Character:   event.Character,
-			From:        event.From,
-			To:          event.To,
-			Description: event.Description,
-		}
-
-		// Копируем choices, если они есть
-		if len(event.Choices) > 0 {
-			simplifiedChoices := make([]domain.SimplifiedChoice, len(event.Choices))
-			for j, choice := range event.Choices {
-				simplifiedChoices[j] = domain.SimplifiedChoice{
-					Text: choice.Text,
-				}
-			}
-			result[i].Choices = simplifiedChoices
-		}
-
-		// Копируем дополнительные данные для специальных типов событий
-		if event.EventType == "inline_choice" && event.Data != nil {
-			if choiceID, ok := event.Data["choice_id"].(string); ok {
-				result[i].ChoiceID = choiceID
-			}
-		}
-	}
-
-	return result
-}
-
 // calculateStateHash вычисляет хеш состояния на основе его динамических элементов
 func calculateStateHash(state *domain.NovelState) string {
 	if state == nil {
@@ -877,52 +1006,17 @@ func calculateStateHash(state *domain.NovelState) string {
 	return hex.EncodeToString(hash[:])
 }
 
-// getCachedState сначала ищет состояние в user_story_progress, если не находит,
-// пытается найти в novel_states (для обратной совместимости).
-// Если находит, создает полное состояние, объединяя статический сетап с динамическим прогрессом.
+// getCachedState ищет в novel_states уже сгенерированную сцену nextSceneIndex новеллы с хешем stateHash.
+// Сохраненное состояние содержит и сцену, и состояние мира после нее, поэтому сетап не подмешивается.
+// Возвращает repository.ErrNotFound, если ветку еще никто не генерировал.
 func (s *NovelContentService) getCachedState(ctx context.Context, novelID uuid.UUID, stateHash string, nextSceneIndex int) (*domain.NovelState, error) {
 	log.Printf("[GetCachedState] Searching for cached state with hash: %s for scene: %d", stateHash, nextSceneIndex)
 
-	// Сначала пробуем найти в новой таблице user_story_progress
-	progress, err := s.novelRepo.GetUserStoryProgressByHash(ctx, stateHash)
-	if err == nil {
-		// Нашли прогресс по хешу, теперь нужно получить сетап новеллы
-		setupStateData, err := s.novelRepo.GetNovelSetupState(ctx, novelID)
-		if err != nil {
-			log.Printf("[GetCachedState] Error getting setup state for novel %s: %v", novelID, err)
-			return nil, fmt.Errorf("failed to get setup state: %w", err)
-		}
-
-		// Десериализуем сетап
-		var setupState domain.NovelState
-		if err := json.Unmarshal(setupStateData, &setupState); err != nil {
-			log.Printf("[GetCachedState] Error unmarshaling setup state: %v", err)
-			return nil, fmt.Errorf("failed to unmarshal setup state: %w", err)
-		}
-
-		// Объединяем сетап с прогрессом
-		mergedState := MergeStateWithProgress(&setupState, progress)
-
-		// Устанавливаем правильный индекс сцены
-		mergedState.CurrentSceneIndex = nextSceneIndex
-
-		log.Printf("[GetCachedState] Found and merged state from user_story_progress for hash: %s", stateHash)
-		return mergedState, nil
-	}
-
-	// Если не нашли в user_story_progress и ошибка не "не найдено", возвращаем ошибку
-	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
-		log.Printf("[GetCachedState] Error getting user story progress by hash: %v", err)
-		return nil, fmt.Errorf("failed to get user story progress: %w", err)
-	}
-
-	// Для обратной совместимости пробуем найти в старой таблице novel_states
-	log.Printf("[GetCachedState] Trying fallback to novel_states for hash: %s", stateHash)
-	existingStateData, err := s.novelRepo.GetNovelStateByHash(ctx, stateHash)
+	existingStateData, err := s.novelRepo.GetNovelState(ctx, novelID, nextSceneIndex, stateHash)
 	if err != nil {
-		if errors.Is(err, pgx.ErrNoRows) {
-			log.Printf("[GetCachedState] State not found in both tables for hash: %s", stateHash)
-			return nil, pgx.ErrNoRows
+		if errors.Is(err, repository.ErrNotFound) {
+			log.Printf("[GetCachedState] State not found for hash: %s", stateHash)
+			return nil, repository.ErrNotFound
 		}
 		log.Printf("[GetCachedState] Error getting state from novel_states: %v", err)
 		return nil, fmt.Errorf("failed to get novel state: %w", err)
@@ -942,7 +1036,8 @@ func (s *NovelContentService) getCachedState(ctx context.Context, novelID uuid.U
 	return &existingState, nil
 }
 
-// saveStateProgress сохраняет состояние и прогресс пользователя.
+// saveStateProgress сохраняет состояние и прогресс пользователя в одной транзакции:
+// при ошибке любой записи не сохраняется ничего.
 // Также сохраняет сетап в таблицу novels если current_stage = "setup".
 func (s *NovelContentService) saveStateProgress(ctx context.Context, novelID uuid.UUID, sceneIndex int, userID string, state *domain.NovelState) error {
 	// Сериализуем полное состояние для сохранения
@@ -951,21 +1046,25 @@ func (s *NovelContentService) saveStateProgress(ctx context.Context, novelID uui
 		return fmt.Errorf("failed to marshal state: %w", err)
 	}
 
+	return s.novelRepo.WithTx(ctx, func(tx repository.NovelRepository) error {
+		return saveStateProgressTx(ctx, tx, novelID, sceneIndex, userID, state, stateData)
+	})
+}
+
+// saveStateProgressTx выполняет записи saveStateProgress через репозиторий транзакции tx
+func saveStateProgressTx(ctx context.Context, tx repository.NovelRepository, novelID uuid.UUID, sceneIndex int, userID string,
+	state *domain.NovelState, stateData []byte) error {
 	// Проверяем, является ли это сетапом по значению current_stage
 	if state.CurrentStage == domain.StageSetup {
 		log.Printf("[saveStateProgress] Detected setup state (current_stage='%s'). Saving to novels table. NovelID: %s",
 			state.CurrentStage, novelID)
-		err = s.novelRepo.SaveNovelSetupState(ctx, novelID, stateData)
-		if err != nil {
-			log.Printf("[saveStateProgress] Warning: Failed to save setup state to novels table: %v. Continuing with standard save...", err)
-			// Продолжаем выполнение даже при ошибке
-		} else {
-			log.Printf("[saveStateProgress] Successfully saved setup state to novels table for NovelID: %s", novelID)
+		if err := tx.SaveNovelSetupState(ctx, novelID, stateData); err != nil {
+			return fmt.Errorf("failed to save setup state: %w", err)
 		}
 	}
 
-	// Сначала пробуем сохранить полное состояние с хешем, исключая user_id
-	err = s.novelRepo.SaveNovelState(ctx, novelID, sceneIndex, userID, state.StateHash, stateData)
+	// Сначала сохраняем полное состояние с хешем, исключая user_id
+	err := tx.SaveNovelState(ctx, novelID, sceneIndex, userID, state.StateHash, stateData)
 	if err != nil {
 		return fmt.Errorf("failed to save novel state: %w", err)
 	}
@@ -985,7 +1084,7 @@ func (s *NovelContentService) saveStateProgress(ctx context.Context, novelID uui
 	}
 
 	// Затем сохраняем прогресс пользователя
-	err = s.novelRepo.SaveUserStoryProgress(ctx, novelID, sceneIndex, userID, progress)
+	err = tx.SaveUserStoryProgress(ctx, novelID, sceneIndex, userID, progress)
 	if err != nil {
 		return fmt.Errorf("failed to save user story progress: %w", err)
 	}
@@ -993,8 +1092,8 @@ func (s *NovelContentService) saveStateProgress(ctx context.Context, novelID uui
 	return nil
 }
 
-// MergeStateWithProgress объединяет статические данные из базового состояния (сетапа)
-// с динамическими элементами из прогресса пользователя
+// MergeStateWithProgress объединяет сохраненное состояние сцены (сцены, стадия, сетап)
+// с динамическими элементами и индексом сцены из прогресса пользователя
 func MergeStateWithProgress(baseState *domain.NovelState, progress *domain.UserStoryProgress) *domain.NovelState {
 	if baseState == nil {
 		log.Println("[MergeStateWithProgress] Error: baseState is nil")
@@ -1017,8 +1116,9 @@ func MergeStateWithProgress(baseState *domain.NovelState, progress *domain.UserS
 	result.StorySummarySoFar = progress.StorySummarySoFar
 	result.FutureDirection = progress.FutureDirection
 
-	// Добавляем информацию о хеше из прогресса
+	// Добавляем информацию о хеше и сцене из прогресса
 	result.StateHash = progress.StateHash
+	result.CurrentSceneIndex = progress.SceneIndex
 
 	return &result
 }
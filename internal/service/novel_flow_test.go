@@ -0,0 +1,339 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"novel-server/internal/config"
+	"novel-server/internal/domain"
+	"novel-server/internal/llm"
+	"novel-server/internal/prompts"
+	"novel-server/internal/repository"
+	"novel-server/internal/service"
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// testServices - сервисы поверх хранилищ в памяти и записанных ответов модели из testdata/llm
+type testServices struct {
+	provider *llm.ScriptedProvider
+	novels   *repository.MemoryNovelRepository
+	content  *service.NovelContentService
+	novel    *service.NovelService
+}
+
+// newTestServices собирает сервисы и запускает воркер сетапа. wrap, если задан,
+// оборачивает провайдер модели, например чтобы задерживать его ответы.
+func newTestServices(t *testing.T, wrap func(llm.LLMProvider) llm.LLMProvider) *testServices {
+	t.Helper()
+	return newTestServicesWithJobs(t, wrap, nil)
+}
+
+// newTestServicesWithJobs работает как newTestServices; wrapJobs, если задан,
+// оборачивает очередь задач сетапа, которую видит NovelService
+func newTestServicesWithJobs(t *testing.T, wrap func(llm.LLMProvider) llm.LLMProvider, wrapJobs func(repository.SetupJobRepository) repository.SetupJobRepository) *testServices {
+	t.Helper()
+
+	provider, err := llm.LoadScriptedProvider("../../testdata/llm")
+	if err != nil {
+		t.Fatalf("LoadScriptedProvider: %v", err)
+	}
+	registry, err := prompts.NewRegistry("../../promts", nil)
+	if err != nil {
+		t.Fatalf("NewRegistry: %v", err)
+	}
+
+	var model llm.LLMProvider = provider
+	if wrap != nil {
+		model = wrap(provider)
+	}
+
+	novels := repository.NewMemoryNovelRepository()
+	setupJobs := repository.NewMemorySetupJobRepository(novels)
+	content, err := service.NewNovelContentService(model, novels, registry, 0)
+	if err != nil {
+		t.Fatalf("NewNovelContentService: %v", err)
+	}
+	workers := service.NewSetupWorkerPool(setupJobs, content, config.SetupConfig{
+		Workers:      1,
+		MaxAttempts:  1,
+		RetryBackoff: time.Second,
+		JobTimeout:   10 * time.Second,
+		PollInterval: 10 * time.Millisecond,
+		StaleAfter:   time.Minute,
+	})
+	var novelJobs repository.SetupJobRepository = setupJobs
+	if wrapJobs != nil {
+		novelJobs = wrapJobs(setupJobs)
+	}
+	novel, err := service.NewNovelService(model, novels, repository.NewMemoryNovelDraftRepository(), content,
+		novelJobs, workers, repository.NewMemorySaveSlotRepository(), registry, 0)
+	if err != nil {
+		t.Fatalf("NewNovelService: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	workers.Start(ctx)
+	t.Cleanup(func() {
+		cancel()
+		workers.Wait()
+	})
+	return &testServices{provider: provider, novels: novels, content: content, novel: novel}
+}
+
+// createNovel создает новеллу из черновика и ждет, пока воркер подготовит ее сетап
+func createNovel(t *testing.T, s *testServices, author string) uuid.UUID {
+	t.Helper()
+	ctx := context.Background()
+
+	draftID, cfg, err := s.novel.CreateDraft(ctx, author, domain.NovelGenerationRequest{UserPrompt: "A mystery in a clockwork archive"})
+	if err != nil {
+		t.Fatalf("CreateDraft: %v", err)
+	}
+	if cfg.Title != "The Clockwork Archive" {
+		t.Fatalf("draft title = %q", cfg.Title)
+	}
+	novelID, err := s.novel.ConfirmDraft(ctx, author, draftID)
+	if err != nil {
+		t.Fatalf("ConfirmDraft: %v", err)
+	}
+	waitSetup(t, s, author, novelID)
+	return novelID
+}
+
+// waitSetup ждет, пока воркер сетапа закончит задачу новеллы
+func waitSetup(t *testing.T, s *testServices, userID string, novelID uuid.UUID) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		job, err := s.novel.GetSetupStatus(context.Background(), userID, novelID)
+		if err != nil {
+			t.Fatalf("GetSetupStatus: %v", err)
+		}
+		switch {
+		case job.Status == domain.SetupJobDone:
+			return
+		case job.Status == domain.SetupJobFailed:
+			t.Fatalf("setup job failed: %s", job.LastError)
+		case time.Now().After(deadline):
+			t.Fatalf("setup job is still %s", job.Status)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// playFirstScene получает первую сцену и извиняется в ней перед Мирой
+func playFirstScene(t *testing.T, s *testServices, userID string, novelID uuid.UUID) *domain.NovelContentResponse {
+	t.Helper()
+	ctx := context.Background()
+
+	first, err := s.content.GenerateNovelContent(ctx, domain.NovelContentRequest{NovelID: novelID, UserID: userID})
+	if err != nil {
+		t.Fatalf("GenerateNovelContent(first scene): %v", err)
+	}
+	if first.State.CurrentStage != domain.StageSceneReady || first.State.CurrentSceneIndex != 0 || first.NewContent == nil {
+		t.Fatalf("first scene: stage %q, index %d, content %v", first.State.CurrentStage, first.State.CurrentSceneIndex, first.NewContent)
+	}
+
+	inline, err := s.content.HandleInlineResponse(ctx, userID, domain.InlineResponseRequest{
+		NovelID:    novelID,
+		SceneIndex: first.State.CurrentSceneIndex,
+		ChoiceID:   "apology_01",
+		ChoiceText: "Apologize.",
+	})
+	if err != nil {
+		t.Fatalf("HandleInlineResponse: %v", err)
+	}
+	if got := inline.UpdatedState.Relationship["Mira"]; got != 1 {
+		t.Fatalf("relationship with Mira after the apology = %d, want 1", got)
+	}
+	return first
+}
+
+// repairClockRequest - выбор починить часы в конце первой сцены
+func repairClockRequest(userID string, novelID uuid.UUID) domain.NovelContentRequest {
+	return domain.NovelContentRequest{
+		NovelID:    novelID,
+		UserID:     userID,
+		UserChoice: &domain.UserChoice{SceneIndex: 0, ChoiceText: "Repair the clock."},
+	}
+}
+
+// checkSecondScene проверяет, что вторая сцена идет после выбора починить часы и учитывает его
+func checkSecondScene(t *testing.T, second *domain.NovelContentResponse) {
+	t.Helper()
+
+	if second.State.CurrentStage != domain.StageSceneReady || second.State.CurrentSceneIndex != 1 || len(second.State.Scenes) != 2 {
+		t.Fatalf("second scene: stage %q, index %d, %d scenes", second.State.CurrentStage, second.State.CurrentSceneIndex, len(second.State.Scenes))
+	}
+	if !slices.Contains(second.State.GlobalFlags, "repaired_clock") || second.State.StoryVariables["clock_state"] != "repaired" {
+		t.Fatalf("choice consequences are missing: flags %v, variables %v", second.State.GlobalFlags, second.State.StoryVariables)
+	}
+	if second.State.Relationship["Mira"] != 1 {
+		t.Fatalf("relationship with Mira in the second scene = %d, want 1", second.State.Relationship["Mira"])
+	}
+}
+
+// playFirstTwoScenes проходит первую сцену (извиняется перед Мирой) и выбирает починить часы
+func playFirstTwoScenes(t *testing.T, s *testServices, userID string, novelID uuid.UUID) (first, second *domain.NovelContentResponse) {
+	t.Helper()
+
+	first = playFirstScene(t, s, userID, novelID)
+	second, err := s.content.GenerateNovelContent(context.Background(), repairClockRequest(userID, novelID))
+	if err != nil {
+		t.Fatalf("GenerateNovelContent(second scene): %v", err)
+	}
+	checkSecondScene(t, second)
+	return first, second
+}
+
+func TestNovelFlow(t *testing.T) {
+	s := newTestServices(t, nil)
+	ctx := context.Background()
+	author := uuid.NewString()
+
+	novelID := createNovel(t, s, author)
+
+	first, second := playFirstTwoScenes(t, s, author, novelID)
+	if reflect.DeepEqual(second.State.Scenes[1], first.State.Scenes[0]) {
+		t.Fatalf("second scene repeats the first one")
+	}
+	if got := s.provider.Remaining("novel_creator"); got != 0 {
+		t.Fatalf("%d novel_creator responses left unused", got)
+	}
+	calls := len(s.provider.Calls())
+
+	// Второй игрок проходит ту же ветку: сцены берутся из кеша, модель не вызывается
+	if err := s.novel.SetNovelVisibility(ctx, author, novelID, domain.VisibilityPublic); err != nil {
+		t.Fatalf("SetNovelVisibility: %v", err)
+	}
+	player := uuid.NewString()
+	playerFirst, playerSecond := playFirstTwoScenes(t, s, player, novelID)
+	if !reflect.DeepEqual(playerFirst.State.Scenes, first.State.Scenes) || !reflect.DeepEqual(playerSecond.State.Scenes, second.State.Scenes) {
+		t.Fatalf("second player got different scenes")
+	}
+	if got := len(s.provider.Calls()); got != calls {
+		t.Fatalf("second player made %d model calls, want 0", got-calls)
+	}
+}
+
+func TestRestartFromScene(t *testing.T) {
+	s := newTestServices(t, nil)
+	ctx := context.Background()
+	author := uuid.NewString()
+
+	novelID := createNovel(t, s, author)
+	first, second := playFirstTwoScenes(t, s, author, novelID)
+	calls := len(s.provider.Calls())
+
+	restarted, err := s.content.RestartFromScene(ctx, novelID, author, 0)
+	if err != nil {
+		t.Fatalf("RestartFromScene: %v", err)
+	}
+	if restarted.State.CurrentSceneIndex != 0 || !reflect.DeepEqual(restarted.State.Scenes, first.State.Scenes) {
+		t.Fatalf("restarted scene: index %d, %d scenes", restarted.State.CurrentSceneIndex, len(restarted.State.Scenes))
+	}
+	if slices.Contains(restarted.State.GlobalFlags, "repaired_clock") {
+		t.Fatalf("consequences of the second scene survived the restart: flags %v", restarted.State.GlobalFlags)
+	}
+
+	// Вторая сцена после отката больше не считается пройденной
+	if _, err := s.content.GetScene(ctx, novelID, author, 1); err == nil {
+		t.Fatalf("GetScene(1) after the restart succeeded")
+	}
+	got, err := s.content.GetScene(ctx, novelID, author, 0)
+	if err != nil {
+		t.Fatalf("GetScene(0): %v", err)
+	}
+	if !reflect.DeepEqual(got.State, restarted.State) {
+		t.Fatalf("GetScene(0) after the restart differs from the restarted scene")
+	}
+
+	// Тот же выбор снова ведет к сохраненной второй сцене без вызова модели
+	again, err := s.content.GenerateNovelContent(ctx, repairClockRequest(author, novelID))
+	if err != nil {
+		t.Fatalf("GenerateNovelContent(second scene again): %v", err)
+	}
+	checkSecondScene(t, again)
+	if !reflect.DeepEqual(again.State.Scenes, second.State.Scenes) {
+		t.Fatalf("second scene after the restart differs")
+	}
+	if got := len(s.provider.Calls()); got != calls {
+		t.Fatalf("replaying the second scene made %d model calls, want 0", got-calls)
+	}
+}
+
+// failingSetupJobs - очередь задач сетапа, которая отказывает в постановке, пока fail true
+type failingSetupJobs struct {
+	repository.SetupJobRepository
+	fail bool
+}
+
+func (f *failingSetupJobs) EnqueueSetupJob(ctx context.Context, novelID uuid.UUID, userID string, maxAttempts int) (*domain.SetupJob, error) {
+	if f.fail {
+		return nil, errors.New("queue is unavailable")
+	}
+	return f.SetupJobRepository.EnqueueSetupJob(ctx, novelID, userID, maxAttempts)
+}
+
+func TestConfirmDraftWithoutSetupJob(t *testing.T) {
+	jobs := &failingSetupJobs{fail: true}
+	s := newTestServicesWithJobs(t, nil, func(inner repository.SetupJobRepository) repository.SetupJobRepository {
+		jobs.SetupJobRepository = inner
+		return jobs
+	})
+	ctx := context.Background()
+	author := uuid.NewString()
+
+	draftID, _, err := s.novel.CreateDraft(ctx, author, domain.NovelGenerationRequest{UserPrompt: "A mystery in a clockwork archive"})
+	if err != nil {
+		t.Fatalf("CreateDraft: %v", err)
+	}
+	if _, err := s.novel.ConfirmDraft(ctx, author, draftID); err == nil {
+		t.Fatalf("ConfirmDraft succeeded without a setup job")
+	}
+	if novels, err := s.novels.ListNovelsByUser(ctx, author, 10, 0); err != nil || len(novels) != 0 {
+		t.Fatalf("novels after the failed confirmation: %d, error %v", len(novels), err)
+	}
+
+	// Черновик остался, и повторное подтверждение создает ровно одну новеллу
+	jobs.fail = false
+	novelID, err := s.novel.ConfirmDraft(ctx, author, draftID)
+	if err != nil {
+		t.Fatalf("ConfirmDraft after the queue recovered: %v", err)
+	}
+	waitSetup(t, s, author, novelID)
+	novels, err := s.novels.ListNovelsByUser(ctx, author, 10, 0)
+	if err != nil || len(novels) != 1 || novels[0].NovelID != novelID {
+		t.Fatalf("novels after the retry: %v, error %v", novels, err)
+	}
+}
+
+func TestReusedFirstSceneSavesProgress(t *testing.T) {
+	s := newTestServices(t, nil)
+	ctx := context.Background()
+	author := uuid.NewString()
+
+	novelID := createNovel(t, s, author)
+	playFirstScene(t, s, author, novelID)
+	if err := s.novel.SetNovelVisibility(ctx, author, novelID, domain.VisibilityPublic); err != nil {
+		t.Fatalf("SetNovelVisibility: %v", err)
+	}
+
+	// Первая сцена нового игрока берется у автора, но прогресс сохраняется вместе с состоянием
+	player := uuid.NewString()
+	if _, err := s.content.GenerateNovelContent(ctx, domain.NovelContentRequest{NovelID: novelID, UserID: player}); err != nil {
+		t.Fatalf("GenerateNovelContent(first scene): %v", err)
+	}
+	progress, err := s.novels.GetUserStoryProgress(ctx, novelID, player, 0)
+	if err != nil {
+		t.Fatalf("GetUserStoryProgress: %v", err)
+	}
+	if _, err := s.novels.GetNovelState(ctx, novelID, 0, progress.StateHash); err != nil {
+		t.Fatalf("no scene 0 state for the saved progress hash %q: %v", progress.StateHash, err)
+	}
+}
@@ -0,0 +1,98 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"novel-server/internal/domain"
+	"novel-server/internal/repository"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+)
+
+// Ограничения полей новеллы (по размеру колонок таблицы novels)
+const (
+	maxNovelTitleLength            = 255
+	maxNovelShortDescriptionLength = 500
+)
+
+// Ошибки редактирования новеллы и прогресса, которые обработчики переводят в HTTP-статусы
+var (
+	ErrInvalidNovelUpdate = errors.New("invalid novel update")
+	ErrNoProgress         = errors.New("no progress in this novel")
+)
+
+// UpdateNovel меняет название и (или) краткое описание новеллы. Поле, равное nil, не меняется.
+// Доступно только владельцу.
+func (s *NovelService) UpdateNovel(ctx context.Context, userID string, novelID uuid.UUID, title, shortDescription *string) (*domain.NovelMetadata, error) {
+	if title == nil && shortDescription == nil {
+		return nil, fmt.Errorf("%w: title or short_description is required", ErrInvalidNovelUpdate)
+	}
+	if title != nil {
+		trimmed := strings.TrimSpace(*title)
+		if trimmed == "" {
+			return nil, fmt.Errorf("%w: title cannot be empty", ErrInvalidNovelUpdate)
+		}
+		if utf8.RuneCountInString(trimmed) > maxNovelTitleLength {
+			return nil, fmt.Errorf("%w: title is longer than %d characters", ErrInvalidNovelUpdate, maxNovelTitleLength)
+		}
+		title = &trimmed
+	}
+	if shortDescription != nil {
+		trimmed := strings.TrimSpace(*shortDescription)
+		if utf8.RuneCountInString(trimmed) > maxNovelShortDescriptionLength {
+			return nil, fmt.Errorf("%w: short_description is longer than %d characters", ErrInvalidNovelUpdate, maxNovelShortDescriptionLength)
+		}
+		shortDescription = &trimmed
+	}
+
+	if err := s.checkNovelOwner(ctx, userID, novelID); err != nil {
+		return nil, err
+	}
+	if err := s.novelRepo.UpdateNovel(ctx, novelID, userID, title, shortDescription); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, ErrNovelNotFound
+		}
+		return nil, err
+	}
+	log.Printf("[NovelService] UpdateNovel - UserID %s updated NovelID %s", userID, novelID)
+
+	meta, err := s.novelRepo.GetNovelMetadataByID(ctx, novelID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get updated novel: %w", err)
+	}
+	return meta, nil
+}
+
+// DeleteNovel удаляет новеллу владельца вместе с состояниями, прогрессом и сохранениями
+// всех игроков и задачей сетапа. Модераторы удаляют чужие новеллы через AdminService.
+func (s *NovelService) DeleteNovel(ctx context.Context, userID string, novelID uuid.UUID) error {
+	if err := s.checkNovelOwner(ctx, userID, novelID); err != nil {
+		return err
+	}
+	if err := s.novelRepo.DeleteNovel(ctx, novelID); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return ErrNovelNotFound
+		}
+		return err
+	}
+	log.Printf("[NovelService] DeleteNovel - UserID %s deleted NovelID %s", userID, novelID)
+	return nil
+}
+
+// DeleteProgress удаляет прохождение пользователя в новелле, чтобы начать ее заново.
+// Сохранения пользователя не удаляются. Доступ к новелле не проверяется:
+// свой прогресс можно удалить и после того, как новелла стала недоступна.
+func (s *NovelService) DeleteProgress(ctx context.Context, userID string, novelID uuid.UUID) error {
+	if err := s.novelRepo.DeleteUserProgress(ctx, novelID, userID); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return ErrNoProgress
+		}
+		return err
+	}
+	log.Printf("[NovelService] DeleteProgress - UserID %s deleted progress in NovelID %s", userID, novelID)
+	return nil
+}
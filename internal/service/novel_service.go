@@ -3,45 +3,71 @@ package service
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"novel-server/internal/auth"
-	"novel-server/internal/deepseek"
 	"novel-server/internal/domain"
+	"novel-server/internal/llm"
+	"novel-server/internal/prompts"
 	"novel-server/internal/repository"
+	"novel-server/internal/schema"
 	"os"
 	"strings"
 
 	"github.com/google/uuid"
 	// "github.com/jackc/pgx/v5/pgxpool" // Убираем зависимость от pgxpool
+)
+
+// ErrNovelNotFound - новеллы нет или она принадлежит другому пользователю
+var ErrNovelNotFound = errors.New("novel not found")
+
+// ErrPermissionDenied - роли пользователя или его прав на новеллу недостаточно для запроса
+var ErrPermissionDenied = errors.New("permission denied")
+
+// ErrInvalidNovelScope - неизвестная область списка новелл
+var ErrInvalidNovelScope = errors.New("scope must be one of: mine, public, all")
 
-	"github.com/sashabaranov/go-openai"
+// Ошибки очереди сетапа, которые обработчики переводят в HTTP-статусы
+var (
+	ErrSetupJobNotFound  = errors.New("setup job not found")
+	ErrSetupNotRetryable = errors.New("setup cannot be retried")
 )
 
 // NovelService предоставляет функциональность для работы с новеллами и их черновиками
 type NovelService struct {
-	deepseekClient      *deepseek.Client
+	llmProvider         llm.LLMProvider
 	novelRepo           repository.NovelRepository  // Используем интерфейс репозитория для новелл
 	draftRepo           domain.NovelDraftRepository // Исправлено: используем интерфейс из domain
-	systemPrompt        string
+	prompts             *prompts.Registry
 	novelContentService *NovelContentService // Добавлен сервис для генерации контента
+	setupJobs           repository.SetupJobRepository
+	setupWorkers        *SetupWorkerPool
+	saveSlots           repository.SaveSlotRepository
+	repairAttempts      int // Сколько раз можно попросить нарратора исправить невалидный конфиг
 }
 
 // NewNovelService создает новый экземпляр сервиса
-func NewNovelService(deepseekClient *deepseek.Client, novelRepo repository.NovelRepository, draftRepo domain.NovelDraftRepository, novelContentService *NovelContentService) (*NovelService, error) {
-	// Загружаем системный промпт для генерации новеллы
-	promptBytes, err := os.ReadFile("promts/narrator.md")
-	if err != nil {
-		return nil, fmt.Errorf("failed to read narrator prompt: %w", err)
+func NewNovelService(llmProvider llm.LLMProvider, novelRepo repository.NovelRepository, draftRepo domain.NovelDraftRepository, novelContentService *NovelContentService, setupJobs repository.SetupJobRepository, setupWorkers *SetupWorkerPool, saveSlots repository.SaveSlotRepository, promptRegistry *prompts.Registry, repairAttempts int) (*NovelService, error) {
+	// Системный промпт нарратора берется из реестра при каждом запросе
+	if !promptRegistry.Has(prompts.Narrator) {
+		return nil, fmt.Errorf("narrator prompt %q not found", prompts.Narrator)
+	}
+	if !promptRegistry.Has(prompts.NarratorRefine) {
+		return nil, fmt.Errorf("narrator refine prompt %q not found", prompts.NarratorRefine)
 	}
 
 	return &NovelService{
-		deepseekClient:      deepseekClient,
+		llmProvider:         llmProvider,
 		novelRepo:           novelRepo,
 		draftRepo:           draftRepo, // Инициализируем draftRepo
-		systemPrompt:        string(promptBytes),
+		prompts:             promptRegistry,
 		novelContentService: novelContentService, // Инициализируем сервис для генерации контента
+		setupJobs:           setupJobs,
+		setupWorkers:        setupWorkers,
+		saveSlots:           saveSlots,
+		repairAttempts:      repairAttempts,
 	}, nil
 }
 
@@ -53,36 +79,41 @@ func (s *NovelService) CreateDraft(ctx context.Context, userID string, request d
 		return uuid.Nil, nil, fmt.Errorf("userID cannot be empty")
 	}
 
-	// 1. Создаем сообщения для отправки в DeepSeek (или другой ИИ)
-	messages := []openai.ChatCompletionMessage{
+	// 1. Создаем сообщения для отправки модели
+	messages := []llm.Message{
 		{
-			Role: openai.ChatMessageRoleUser,
+			Role: llm.RoleUser,
 			// TODO: Возможно, нужно будет объединять request.UserPrompt с существующим конфигом, если это уточнение?
 			// Пока считаем, что это всегда новый черновик или полное переписывание.
 			Content: request.UserPrompt,
 		},
 	}
 
-	// Устанавливаем системный промпт
-	messages = deepseek.SetSystemPrompt(messages, s.systemPrompt)
+	// Устанавливаем системный промпт. Язык и прочие параметры новеллы еще не известны
+	prompt, err := s.prompts.Render(prompts.Narrator, prompts.Data{})
+	if err != nil {
+		return uuid.Nil, nil, err
+	}
+	messages = llm.SetSystemPrompt(messages, prompt.Text)
 
-	// 2. Отправляем запрос к ИИ-нарратору
-	response, err := s.deepseekClient.ChatCompletion(ctx, messages)
+	// 2. Отправляем запрос к ИИ-нарратору. Новеллы еще нет, расход учитывается только за пользователем
+	if err := chargeQuota(ctx); err != nil {
+		return uuid.Nil, nil, err
+	}
+	ctx = llm.WithUsageTags(ctx, llm.UsageTags{Operation: domain.LLMOperationDraft, UserID: userID})
+	response, err := s.llmProvider.ChatCompletion(ctx, messages)
 	if err != nil {
 		log.Printf("[NovelService] CreateDraft - Error from AI Narrator: %v", err)
 		return uuid.Nil, nil, fmt.Errorf("failed to get response from AI Narrator: %w", err)
 	}
 
-	// 3. Извлекаем JSON из ответа модели
-	jsonStr, err := extractJSONFromResponse(response)
+	// 3. Извлекаем JSON из ответа модели и проверяем его по схеме (при необходимости модель исправляет ответ)
+	jsonStr, err := repairModelJSON(ctx, s.llmProvider, messages, response, schema.NarratorConfig, nil, s.repairAttempts)
 	if err != nil {
-		log.Printf("[NovelService] CreateDraft - Error extracting JSON: %v", err)
-		return uuid.Nil, nil, fmt.Errorf("failed to extract JSON from response: %w\nResponse: %s", err, response)
+		log.Printf("[NovelService] CreateDraft - Invalid JSON from AI Narrator: %v\nResponse: %s", err, response)
+		return uuid.Nil, nil, fmt.Errorf("failed to get valid config from AI Narrator: %w", err)
 	}
 
-	// Проверяем и исправляем JSON для дополнительной безопасности
-	jsonStr = FixJSON(jsonStr)
-
 	// 4. Парсим JSON в структуру NovelConfig
 	var config domain.NovelConfig
 	err = json.Unmarshal([]byte(jsonStr), &config)
@@ -96,6 +127,7 @@ func (s *NovelService) CreateDraft(ctx context.Context, userID string, request d
 		log.Printf("[NovelService] CreateDraft - Invalid config generated: %v", err)
 		return uuid.Nil, nil, fmt.Errorf("invalid configuration generated: %w", err)
 	}
+	config.PromptVersion = prompt.ID()
 	log.Printf("[NovelService] CreateDraft - Successfully generated and validated config for UserID: %s, Title: %s", userID, config.Title)
 
 	// 6. Генерируем новый DraftID
@@ -109,7 +141,7 @@ func (s *NovelService) CreateDraft(ctx context.Context, userID string, request d
 	}
 
 	// 8. Сохраняем черновик в репозитории черновиков
-	err = s.draftRepo.SaveDraft(ctx, userID, draftID, configJSON)
+	err = s.draftRepo.SaveDraft(ctx, userID, draftID, configJSON, request.UserPrompt)
 	if err != nil {
 		log.Printf("[NovelService] CreateDraft - Error saving draft to repository: %v", err)
 		return uuid.Nil, nil, fmt.Errorf("failed to save novel draft: %w", err)
@@ -134,35 +166,21 @@ func extractJSONFromResponse(response string) (string, error) {
 	// Очищаем ответ от возможных префиксов/суффиксов
 	response = strings.TrimSpace(response)
 
-	// Проверяем, начинается ли ответ с ```json
-	jsonBlockPrefix := "```json"
-	if strings.HasPrefix(response, jsonBlockPrefix) {
-		response = strings.TrimPrefix(response, jsonBlockPrefix)
-		// Ищем закрывающий ```
-		jsonEndMarker := "```"
-		if endIndex := strings.LastIndex(response, jsonEndMarker); endIndex != -1 {
-			response = response[:endIndex]
-		}
+	// Проверяем, начинается ли ответ с блока кода ```json (или просто ```)
+	if strings.HasPrefix(response, "```") {
+		response = strings.TrimPrefix(response, "```")
+		response = strings.TrimPrefix(response, "json")
 	}
-	response = strings.TrimSpace(response)
 
-	// Проверяем, начинается ли ответ с открывающей фигурной скобки
+	// Проверяем, есть ли в ответе открывающая фигурная скобка
 	jsonStartIndex := strings.Index(response, "{")
 	if jsonStartIndex == -1 {
 		return "", fmt.Errorf("no JSON object start found in response")
 	}
 
-	// Проверяем, заканчивается ли ответ закрывающей фигурной скобкой
-	jsonEndIndex := strings.LastIndex(response, "}")
-	if jsonEndIndex == -1 {
-		return "", fmt.Errorf("no JSON object end found in response")
-	}
-
-	// Извлекаем JSON
-	jsonStr := response[jsonStartIndex : jsonEndIndex+1]
-
-	// Исправляем потенциально некорректный JSON
-	jsonStr = FixJSON(jsonStr)
+	// Исправляем потенциально некорректный JSON. FixJSON сам отбрасывает все после
+	// корневого объекта (закрывающий ``` и пояснения) и дописывает конец обрезанного ответа.
+	jsonStr := FixJSON(response[jsonStartIndex:])
 
 	// Валидация JSON
 	var js json.RawMessage
@@ -203,8 +221,24 @@ func (s *NovelService) ListNovels(ctx context.Context, request domain.ListNovels
 		return nil, fmt.Errorf("user authentication required to list novels with progress")
 	}
 
+	// Свои и публичные новеллы доступны всем, новеллы всех пользователей - только модераторам
+	scope := request.Scope
+	switch scope {
+	case "":
+		scope = domain.NovelScopeMine
+	case domain.NovelScopeMine, domain.NovelScopePublic:
+	case domain.NovelScopeAll:
+		role, _ := ctx.Value(auth.RoleKey).(string)
+		if !domain.RoleAtLeast(role, domain.RoleModerator) {
+			log.Printf("[Service] ListNovels - UserID %s with role '%s' requested all novels", userID, role)
+			return nil, ErrPermissionDenied
+		}
+	default:
+		return nil, ErrInvalidNovelScope
+	}
+
 	// Получаем список новелл из репозитория с поддержкой пагинации и UserID
-	novels, total, nextCursor, err := s.novelRepo.ListNovels(ctx, userID, request.Limit, request.Cursor)
+	novels, total, nextCursor, err := s.novelRepo.ListNovels(ctx, userID, scope, request.Limit, request.Cursor)
 	if err != nil {
 		log.Printf("[Service] ListNovels - Error from repository: %v", err)
 		return nil, fmt.Errorf("failed to list novels: %w", err)
@@ -228,6 +262,7 @@ func (s *NovelService) ListNovels(ctx context.Context, request domain.ListNovels
 		nextRequest := domain.ListNovelsRequest{
 			Limit:  request.Limit,
 			Cursor: nextCursor,
+			Scope:  request.Scope,
 			// UserID теперь берется из контекста в начале функции
 		}
 		log.Printf("[Service] ListNovels - No setuped novels found, recursively calling for next page with cursor %s", *nextCursor)
@@ -246,10 +281,16 @@ func (s *NovelService) ListNovels(ctx context.Context, request domain.ListNovels
 	return response, nil
 }
 
-// GetNovelDetails возвращает детальную информацию о новелле
+// GetNovelDetails возвращает детальную информацию о новелле с учетом ее видимости.
+// Для пользователя без доступа новеллы не существует (ErrNovelNotFound).
 func (s *NovelService) GetNovelDetails(ctx context.Context, novelID uuid.UUID) (*domain.NovelDetailsResponse, error) {
 	log.Printf("[Service] GetNovelDetails called for NovelID: %s", novelID)
 
+	userID, _ := ctx.Value(auth.UserIDKey).(string)
+	if _, err := checkNovelAccess(ctx, s.novelRepo, novelID, userID); err != nil {
+		return nil, err
+	}
+
 	// Получаем детальную информацию о новелле из репозитория
 	details, err := s.novelRepo.GetNovelDetails(ctx, novelID)
 	if err != nil {
@@ -269,6 +310,9 @@ func (s *NovelService) ConfirmDraft(ctx context.Context, userID string, draftID
 	configJSON, err := s.draftRepo.GetDraftConfigJSON(ctx, userID, draftID)
 	if err != nil {
 		log.Printf("[NovelService] ConfirmDraft - Error getting draft: %v", err)
+		if errors.Is(err, repository.ErrNotFound) {
+			return uuid.Nil, ErrDraftNotFound
+		}
 		return uuid.Nil, fmt.Errorf("failed to get draft: %w", err)
 	}
 
@@ -294,119 +338,178 @@ func (s *NovelService) ConfirmDraft(ctx context.Context, userID string, draftID
 	}
 	log.Printf("[NovelService] ConfirmDraft - Successfully created novel with ID: %s from draft: %s", novelID, draftID)
 
-	// 5. Удаляем черновик
+	// 5. Ставим генерацию сетапа в очередь. Задача хранится в БД и переживет перезапуск сервера.
+	// Новелла без задачи так и осталась бы без сетапа, а черновик сохраняется, и повторное
+	// подтверждение создало бы вторую новеллу, поэтому при ошибке новелла удаляется.
+	job, err := s.setupJobs.EnqueueSetupJob(ctx, novelID, userID, s.setupWorkers.MaxAttempts())
+	if err != nil {
+		log.Printf("[NovelService] ConfirmDraft - Error enqueueing setup job: %v", err)
+		// Запрос мог быть отменен, а новеллу удалить все равно нужно
+		if delErr := s.novelRepo.DeleteNovel(context.WithoutCancel(ctx), novelID); delErr != nil {
+			log.Printf("[NovelService] ConfirmDraft - Error deleting novel %s without setup job: %v", novelID, delErr)
+		}
+		return uuid.Nil, fmt.Errorf("failed to schedule novel setup: %w", err)
+	}
+	s.setupWorkers.Notify()
+	log.Printf("[NovelService] ConfirmDraft - Setup job %s queued for NovelID: %s", job.JobID, novelID)
+
+	// 6. Удаляем черновик
 	err = s.draftRepo.DeleteDraft(ctx, userID, draftID)
 	if err != nil {
 		// Не возвращаем ошибку, если не смогли удалить черновик, просто логируем
 		log.Printf("[NovelService] ConfirmDraft - Warning: failed to delete draft after confirmation: %v", err)
 	}
 
-	// 6. Автоматически запускаем генерацию начального сетапа новеллы
-	// Подготавливаем запрос для генерации контента
-	contentRequest := domain.NovelContentRequest{
-		NovelID: novelID,
-		UserID:  userID,
+	log.Printf("[NovelService] ConfirmDraft - Returning NovelID: %s. Setup generation will continue in background.", novelID)
+	return novelID, nil
+}
+
+// GetSetupStatus возвращает состояние задачи генерации сетапа новеллы пользователя
+func (s *NovelService) GetSetupStatus(ctx context.Context, userID string, novelID uuid.UUID) (*domain.SetupJob, error) {
+	job, err := s.setupJobs.GetSetupJobByNovelID(ctx, novelID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, ErrSetupJobNotFound
+		}
+		return nil, fmt.Errorf("failed to get setup job: %w", err)
 	}
+	// Чужие задачи не показываем, чтобы не раскрывать существование новеллы
+	if job.UserID != userID {
+		return nil, ErrSetupJobNotFound
+	}
+	return job, nil
+}
 
-	// Запускаем асинхронную генерацию сетапа новеллы
-	go func() {
-		// Создаем новый контекст для асинхронной операции
-		asyncCtx := context.Background()
+// RetrySetup возвращает упавшую задачу генерации сетапа в очередь
+func (s *NovelService) RetrySetup(ctx context.Context, userID string, novelID uuid.UUID) (*domain.SetupJob, error) {
+	job, err := s.GetSetupStatus(ctx, userID, novelID)
+	if err != nil {
+		return nil, err
+	}
+	if job.Status != domain.SetupJobFailed {
+		return nil, fmt.Errorf("%w: setup is %s", ErrSetupNotRetryable, job.Status)
+	}
 
-		log.Printf("[NovelService] ConfirmDraft - Starting async setup generation for NovelID: %s", novelID)
-		_, genErr := s.novelContentService.GenerateNovelContent(asyncCtx, contentRequest)
-		if genErr != nil {
-			log.Printf("[NovelService] ConfirmDraft - Error generating setup asynchronously: %v", genErr)
-		} else {
-			log.Printf("[NovelService] ConfirmDraft - Successfully generated setup for NovelID: %s", novelID)
+	job, err = s.setupJobs.RetrySetupJob(ctx, novelID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			// Задачу успел перезапустить параллельный запрос
+			return nil, fmt.Errorf("%w: setup is no longer failed", ErrSetupNotRetryable)
 		}
-	}()
+		return nil, fmt.Errorf("failed to retry setup job: %w", err)
+	}
+	s.setupWorkers.Notify()
+	log.Printf("[NovelService] RetrySetup - Setup for NovelID %s requeued by UserID %s", novelID, userID)
+	return job, nil
+}
 
-	log.Printf("[NovelService] ConfirmDraft - Returning NovelID: %s. Setup generation will continue asynchronously.", novelID)
-	return novelID, nil
+// ListSetupJobs возвращает незавершенные задачи сетапа пользователя (в очереди, выполняются или упали)
+func (s *NovelService) ListSetupJobs(ctx context.Context, userID string) ([]domain.SetupJob, error) {
+	jobs, err := s.setupJobs.ListUnfinishedSetupJobs(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list setup jobs: %w", err)
+	}
+	return jobs, nil
 }
 
-// RefineDraft уточняет черновик новеллы с помощью дополнительного пользовательского промпта
+// RefineDraft уточняет черновик новеллы с помощью дополнительного пользовательского промпта.
+// Модели отправляются полный текущий конфиг, исходный запрос и прежние уточнения, а в ответ она
+// присылает JSON Merge Patch. Поля, которых запрос не касается, поэтому остаются без изменений.
 func (s *NovelService) RefineDraft(ctx context.Context, userID string, draftID uuid.UUID, additionalPrompt string) (*domain.NovelConfig, error) {
 	log.Printf("[NovelService] RefineDraft called for UserID: %s, DraftID: %s", userID, draftID)
 
-	// 1. Получаем конфиг черновика из репозитория
-	configJSON, err := s.draftRepo.GetDraftConfigJSON(ctx, userID, draftID)
+	// 1. Получаем черновик и историю его ревизий
+	draft, err := s.draftRepo.GetDraft(ctx, userID, draftID)
 	if err != nil {
 		log.Printf("[NovelService] RefineDraft - Error getting draft: %v", err)
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, ErrDraftNotFound
+		}
 		return nil, fmt.Errorf("failed to get draft: %w", err)
 	}
-
-	// 2. Десериализуем JSON в структуру NovelConfig
-	var existingConfig domain.NovelConfig
-	err = json.Unmarshal(configJSON, &existingConfig)
+	revisions, err := s.draftRepo.ListDraftRevisions(ctx, userID, draftID)
 	if err != nil {
-		log.Printf("[NovelService] RefineDraft - Error unmarshaling config: %v", err)
-		return nil, fmt.Errorf("failed to parse draft config: %w", err)
+		log.Printf("[NovelService] RefineDraft - Error getting draft revisions: %v", err)
+		return nil, fmt.Errorf("failed to get draft revisions: %w", err)
 	}
-
-	// 3. Создаем составной промпт, включая текущую конфигурацию и новый запрос пользователя
-	combinedPrompt := fmt.Sprintf("Current configuration: Title: %s, Genre: %s, Summary: %s\n\nAdditional request: %s",
-		existingConfig.Title,
-		existingConfig.Genre,
-		existingConfig.StorySummary,
-		additionalPrompt)
-
-	// 4. Создаем сообщения для отправки в ИИ-нарратор
-	messages := []openai.ChatCompletionMessage{
-		{
-			Role:    openai.ChatMessageRoleUser,
-			Content: combinedPrompt,
-		},
+	currentJSON, err := json.Marshal(draft.Config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal draft config: %w", err)
+	}
+
+	// 2. Собираем диалог: прежние уточнения (запрос и патч модели) и новый запрос с полным конфигом
+	originalPrompt, history := refineHistory(revisions, draft.Revision)
+	messages := make([]llm.Message, 0, 2*len(history)+2)
+	for _, v := range history {
+		messages = append(messages,
+			llm.Message{Role: llm.RoleUser, Content: v.Prompt},
+			llm.Message{Role: llm.RoleAssistant, Content: string(v.Patch)},
+		)
+	}
+	messages = append(messages, llm.Message{
+		Role:    llm.RoleUser,
+		Content: buildRefinePrompt(originalPrompt, currentJSON, additionalPrompt),
+	})
+
+	prompt, err := s.prompts.Render(prompts.NarratorRefine, prompts.Data{
+		Language:       draft.Config.Language,
+		IsAdultContent: draft.Config.IsAdultContent,
+	})
+	if err != nil {
+		return nil, err
 	}
+	messages = llm.SetSystemPrompt(messages, prompt.Text)
 
-	messages = deepseek.SetSystemPrompt(messages, s.systemPrompt)
-
-	// 5. Отправляем запрос к ИИ-нарратору
-	response, err := s.deepseekClient.ChatCompletion(ctx, messages)
+	// 3. Отправляем запрос к ИИ-нарратору
+	if err := chargeQuota(ctx); err != nil {
+		return nil, err
+	}
+	ctx = llm.WithUsageTags(ctx, llm.UsageTags{Operation: domain.LLMOperationRefine, UserID: userID})
+	response, err := s.llmProvider.ChatCompletion(ctx, messages)
 	if err != nil {
 		log.Printf("[NovelService] RefineDraft - Error from AI Narrator: %v", err)
 		return nil, fmt.Errorf("failed to get response from AI Narrator: %w", err)
 	}
 
-	// 6. Извлекаем JSON из ответа модели
-	jsonStr, err := extractJSONFromResponse(response)
-	if err != nil {
-		log.Printf("[NovelService] RefineDraft - Error extracting JSON: %v", err)
-		return nil, fmt.Errorf("failed to extract JSON from response: %w\nResponse: %s", err, response)
+	// 4. Проверяем патч по схеме и проверяем конфиг, который из него получается:
+	// об ошибках в любом из них модель узнает и может прислать исправленный патч
+	check := func(patchStr string) error {
+		_, err := mergeConfigPatch(currentJSON, []byte(patchStr))
+		return err
 	}
-
-	// Проверяем и исправляем JSON для дополнительной безопасности
-	jsonStr = FixJSON(jsonStr)
-
-	// 7. Парсим JSON в структуру NovelConfig
-	var updatedConfig domain.NovelConfig
-	err = json.Unmarshal([]byte(jsonStr), &updatedConfig)
+	patchStr, err := repairModelJSON(ctx, s.llmProvider, messages, response, schema.NarratorConfigPatch, check, s.repairAttempts)
 	if err != nil {
-		log.Printf("[NovelService] RefineDraft - Error parsing JSON: %v\nJSON String: %s", err, jsonStr)
-		return nil, fmt.Errorf("failed to parse JSON config: %w", err)
+		log.Printf("[NovelService] RefineDraft - Invalid patch from AI Narrator: %v\nResponse: %s", err, response)
+		return nil, fmt.Errorf("failed to get valid config patch from AI Narrator: %w", err)
 	}
 
-	// 8. Валидируем обновленную конфигурацию
-	if err = updatedConfig.Validate(); err != nil {
-		log.Printf("[NovelService] RefineDraft - Invalid updated config: %v", err)
+	// 5. Применяем патч к текущему конфигу
+	updatedConfig, err := mergeConfigPatch(currentJSON, []byte(patchStr))
+	if err != nil {
 		return nil, fmt.Errorf("invalid updated configuration: %w", err)
 	}
+	updatedConfig.PromptVersion = prompt.ID()
 
-	// 9. Сериализуем обновленный конфиг обратно в JSON для сохранения
+	// 6. Сериализуем обновленный конфиг обратно в JSON для сохранения
 	updatedConfigJSON, err := json.Marshal(updatedConfig)
 	if err != nil {
 		log.Printf("[NovelService] RefineDraft - Error marshaling updated config: %v", err)
 		return nil, fmt.Errorf("failed to marshal updated config: %w", err)
 	}
 
-	// 10. Обновляем черновик в репозитории
-	err = s.draftRepo.UpdateDraftConfigJSON(ctx, userID, draftID, updatedConfigJSON)
+	// 7. Обновляем черновик в репозитории. Прежний конфиг остается в истории ревизий,
+	// а патч понадобится как ответ модели в диалоге следующих уточнений
+	revision := &domain.DraftRevision{
+		Source: domain.DraftRevisionRefine,
+		Prompt: additionalPrompt,
+		Patch:  json.RawMessage(patchStr),
+	}
+	err = s.draftRepo.AppendDraftRevision(ctx, userID, draftID, updatedConfigJSON, revision)
 	if err != nil {
 		log.Printf("[NovelService] RefineDraft - Error updating draft: %v", err)
 		return nil, fmt.Errorf("failed to update draft: %w", err)
 	}
 
-	log.Printf("[NovelService] RefineDraft - Successfully refined draft with ID: %s", draftID)
-	return &updatedConfig, nil
+	log.Printf("[NovelService] RefineDraft - Successfully refined draft with ID: %s (revision %d)", draftID, revision.Revision)
+	return updatedConfig, nil
 }
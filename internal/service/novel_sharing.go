@@ -0,0 +1,146 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"novel-server/internal/auth"
+	"novel-server/internal/domain"
+	"novel-server/internal/repository"
+
+	"github.com/google/uuid"
+)
+
+// Ошибки видимости и ссылок, которые обработчики переводят в HTTP-статусы
+var (
+	ErrInvalidVisibility = errors.New("visibility must be one of: private, unlisted, public")
+	ErrNovelPrivate      = errors.New("private novels cannot be shared, make the novel unlisted or public first")
+	ErrShareLinkNotFound = errors.New("share link not found")
+)
+
+// checkNovelAccess проверяет, что пользователь может читать и проходить новеллу
+// (см. domain.NovelAccess.CanView). Роль берется из контекста запроса.
+// Возвращает ErrNovelNotFound, если новеллы нет или доступа к ней нет.
+func checkNovelAccess(ctx context.Context, novelRepo repository.NovelRepository, novelID uuid.UUID, userID string) (*domain.NovelAccess, error) {
+	access, err := novelRepo.GetNovelAccess(ctx, novelID, userID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, ErrNovelNotFound
+		}
+		return nil, err
+	}
+	role, _ := ctx.Value(auth.RoleKey).(string)
+	if !access.CanView(userID, role) {
+		log.Printf("[Access] UserID %s (role '%s') has no access to %s NovelID %s", userID, role, access.Visibility, novelID)
+		return nil, ErrNovelNotFound
+	}
+	return access, nil
+}
+
+// checkNovelOwner проверяет, что пользователь - владелец новеллы. Тем, кто новеллу видит,
+// но не владеет ею, возвращает ErrPermissionDenied, остальным - ErrNovelNotFound.
+func (s *NovelService) checkNovelOwner(ctx context.Context, userID string, novelID uuid.UUID) error {
+	access, err := checkNovelAccess(ctx, s.novelRepo, novelID, userID)
+	if err != nil {
+		return err
+	}
+	if access.OwnerID != userID {
+		return ErrPermissionDenied
+	}
+	return nil
+}
+
+// newShareToken создает случайный токен ссылки (128 бит)
+func newShareToken() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate share token: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// SetNovelVisibility меняет видимость новеллы. Доступно только владельцу.
+func (s *NovelService) SetNovelVisibility(ctx context.Context, userID string, novelID uuid.UUID, visibility string) error {
+	if !domain.IsValidVisibility(visibility) {
+		return ErrInvalidVisibility
+	}
+	if err := s.checkNovelOwner(ctx, userID, novelID); err != nil {
+		return err
+	}
+	if err := s.novelRepo.SetNovelVisibility(ctx, novelID, userID, visibility); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return ErrNovelNotFound
+		}
+		return err
+	}
+	log.Printf("[NovelService] UserID %s set visibility of NovelID %s to '%s'", userID, novelID, visibility)
+	return nil
+}
+
+// CreateShareLink создает ссылку на новеллу с новым токеном. Прежняя ссылка перестает работать,
+// но те, кто уже ее открыл, сохраняют доступ. Доступно только владельцу скрытой или публичной новеллы.
+func (s *NovelService) CreateShareLink(ctx context.Context, userID string, novelID uuid.UUID) (*domain.NovelShareLink, error) {
+	access, err := checkNovelAccess(ctx, s.novelRepo, novelID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if access.OwnerID != userID {
+		return nil, ErrPermissionDenied
+	}
+	if access.Visibility == domain.VisibilityPrivate {
+		return nil, ErrNovelPrivate
+	}
+
+	token, err := newShareToken()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.novelRepo.SetNovelShareToken(ctx, novelID, userID, token); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, ErrNovelNotFound
+		}
+		return nil, err
+	}
+	log.Printf("[NovelService] UserID %s created share link for NovelID %s", userID, novelID)
+	return &domain.NovelShareLink{NovelID: novelID, ShareToken: token, Visibility: access.Visibility}, nil
+}
+
+// DeleteShareLink отключает ссылку на новеллу и отзывает доступ всех, кто ее открывал.
+func (s *NovelService) DeleteShareLink(ctx context.Context, userID string, novelID uuid.UUID) error {
+	if err := s.checkNovelOwner(ctx, userID, novelID); err != nil {
+		return err
+	}
+	if err := s.novelRepo.SetNovelShareToken(ctx, novelID, userID, ""); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return ErrNovelNotFound
+		}
+		return err
+	}
+	log.Printf("[NovelService] UserID %s deleted share link for NovelID %s", userID, novelID)
+	return nil
+}
+
+// OpenShareLink открывает ссылку на новеллу: запоминает доступ пользователя и возвращает
+// детали новеллы. После этого новеллу можно проходить по ее ID. Ссылка на новеллу,
+// ставшую приватной, не работает.
+func (s *NovelService) OpenShareLink(ctx context.Context, userID, token string) (*domain.NovelDetailsResponse, error) {
+	novelID, visibility, err := s.novelRepo.GetNovelByShareToken(ctx, token)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, ErrShareLinkNotFound
+		}
+		return nil, err
+	}
+	if visibility == domain.VisibilityPrivate {
+		return nil, ErrShareLinkNotFound
+	}
+
+	if err := s.novelRepo.GrantNovelAccess(ctx, novelID, userID); err != nil {
+		return nil, err
+	}
+	log.Printf("[NovelService] UserID %s opened share link for NovelID %s", userID, novelID)
+	return s.GetNovelDetails(ctx, novelID)
+}
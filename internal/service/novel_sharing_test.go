@@ -0,0 +1,158 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"novel-server/internal/auth"
+	"novel-server/internal/domain"
+	"novel-server/internal/service"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+// asUser возвращает контекст запроса пользователя userID с ролью role, как после AuthMiddleware
+func asUser(userID, role string) context.Context {
+	ctx := context.WithValue(context.Background(), auth.UserIDKey, userID)
+	return context.WithValue(ctx, auth.RoleKey, role)
+}
+
+// sharedNovel создает скрытую новеллу, которую пользователь granted открыл по ссылке
+func sharedNovel(t *testing.T, s *testServices, author, granted string) uuid.UUID {
+	t.Helper()
+
+	novelID := createNovel(t, s, author)
+	ownerCtx := asUser(author, domain.RoleAuthor)
+	if err := s.novel.SetNovelVisibility(ownerCtx, author, novelID, domain.VisibilityUnlisted); err != nil {
+		t.Fatalf("SetNovelVisibility(unlisted): %v", err)
+	}
+	link, err := s.novel.CreateShareLink(ownerCtx, author, novelID)
+	if err != nil {
+		t.Fatalf("CreateShareLink: %v", err)
+	}
+	if _, err := s.novel.OpenShareLink(asUser(granted, domain.RolePlayer), granted, link.ShareToken); err != nil {
+		t.Fatalf("OpenShareLink: %v", err)
+	}
+	return novelID
+}
+
+func TestNovelAccess(t *testing.T) {
+	s := newTestServices(t, nil)
+	author, granted, stranger, moderator := uuid.NewString(), uuid.NewString(), uuid.NewString(), uuid.NewString()
+	novelID := sharedNovel(t, s, author, granted)
+
+	viewers := []struct {
+		name   string
+		userID string
+		role   string
+	}{
+		{"owner", author, domain.RoleAuthor},
+		{"granted", granted, domain.RolePlayer},
+		{"stranger", stranger, domain.RoleAuthor},
+		{"moderator", moderator, domain.RoleModerator},
+	}
+	tests := []struct {
+		visibility string
+		canView    map[string]bool
+	}{
+		{domain.VisibilityPrivate, map[string]bool{"owner": true, "moderator": true}},
+		{domain.VisibilityUnlisted, map[string]bool{"owner": true, "granted": true, "moderator": true}},
+		{domain.VisibilityPublic, map[string]bool{"owner": true, "granted": true, "stranger": true, "moderator": true}},
+	}
+	for _, tt := range tests {
+		// Доступ по открытой ссылке сохраняется при смене видимости, но приватную новеллу не открывает
+		if err := s.novel.SetNovelVisibility(asUser(author, domain.RoleAuthor), author, novelID, tt.visibility); err != nil {
+			t.Fatalf("SetNovelVisibility(%s): %v", tt.visibility, err)
+		}
+		for _, viewer := range viewers {
+			t.Run(tt.visibility+"/"+viewer.name, func(t *testing.T) {
+				_, err := s.novel.GetNovelDetails(asUser(viewer.userID, viewer.role), novelID)
+				if tt.canView[viewer.name] {
+					if err != nil {
+						t.Fatalf("GetNovelDetails: %v", err)
+					}
+					return
+				}
+				if !errors.Is(err, service.ErrNovelNotFound) {
+					t.Fatalf("GetNovelDetails: error = %v, want ErrNovelNotFound", err)
+				}
+				// Без доступа нельзя и проходить новеллу
+				_, err = s.content.GenerateNovelContent(asUser(viewer.userID, viewer.role), domain.NovelContentRequest{NovelID: novelID, UserID: viewer.userID})
+				if !errors.Is(err, service.ErrNovelNotFound) {
+					t.Fatalf("GenerateNovelContent: error = %v, want ErrNovelNotFound", err)
+				}
+			})
+		}
+	}
+}
+
+func TestShareLinks(t *testing.T) {
+	s := newTestServices(t, nil)
+	author, player, other := uuid.NewString(), uuid.NewString(), uuid.NewString()
+	ownerCtx := asUser(author, domain.RoleAuthor)
+	playerCtx := asUser(player, domain.RolePlayer)
+
+	novelID := createNovel(t, s, author)
+
+	// Приватной новеллой поделиться нельзя, а чужой - тем более
+	if _, err := s.novel.CreateShareLink(ownerCtx, author, novelID); !errors.Is(err, service.ErrNovelPrivate) {
+		t.Fatalf("CreateShareLink(private): error = %v, want ErrNovelPrivate", err)
+	}
+	if _, err := s.novel.CreateShareLink(playerCtx, player, novelID); !errors.Is(err, service.ErrNovelNotFound) {
+		t.Fatalf("CreateShareLink(invisible novel): error = %v, want ErrNovelNotFound", err)
+	}
+	if err := s.novel.SetNovelVisibility(ownerCtx, author, novelID, domain.VisibilityPublic); err != nil {
+		t.Fatalf("SetNovelVisibility: %v", err)
+	}
+	if _, err := s.novel.CreateShareLink(playerCtx, player, novelID); !errors.Is(err, service.ErrPermissionDenied) {
+		t.Fatalf("CreateShareLink(not owner): error = %v, want ErrPermissionDenied", err)
+	}
+	if err := s.novel.SetNovelVisibility(ownerCtx, author, novelID, "secret"); !errors.Is(err, service.ErrInvalidVisibility) {
+		t.Fatalf("SetNovelVisibility(secret): error = %v, want ErrInvalidVisibility", err)
+	}
+
+	if err := s.novel.SetNovelVisibility(ownerCtx, author, novelID, domain.VisibilityUnlisted); err != nil {
+		t.Fatalf("SetNovelVisibility: %v", err)
+	}
+	first, err := s.novel.CreateShareLink(ownerCtx, author, novelID)
+	if err != nil {
+		t.Fatalf("CreateShareLink: %v", err)
+	}
+	if _, err := s.novel.OpenShareLink(playerCtx, player, first.ShareToken); err != nil {
+		t.Fatalf("OpenShareLink: %v", err)
+	}
+
+	// Новая ссылка отключает прежнюю, но открывшие ее сохраняют доступ
+	if _, err := s.novel.CreateShareLink(ownerCtx, author, novelID); err != nil {
+		t.Fatalf("CreateShareLink(again): %v", err)
+	}
+	if _, err := s.novel.OpenShareLink(asUser(other, domain.RolePlayer), other, first.ShareToken); !errors.Is(err, service.ErrShareLinkNotFound) {
+		t.Fatalf("OpenShareLink(replaced token): error = %v, want ErrShareLinkNotFound", err)
+	}
+	if _, err := s.novel.GetNovelDetails(playerCtx, novelID); err != nil {
+		t.Fatalf("GetNovelDetails after the link was replaced: %v", err)
+	}
+
+	// Ссылка на новеллу, ставшую приватной, не работает
+	third, err := s.novel.CreateShareLink(ownerCtx, author, novelID)
+	if err != nil {
+		t.Fatalf("CreateShareLink(third): %v", err)
+	}
+	if err := s.novel.SetNovelVisibility(ownerCtx, author, novelID, domain.VisibilityPrivate); err != nil {
+		t.Fatalf("SetNovelVisibility(private): %v", err)
+	}
+	if _, err := s.novel.OpenShareLink(asUser(other, domain.RolePlayer), other, third.ShareToken); !errors.Is(err, service.ErrShareLinkNotFound) {
+		t.Fatalf("OpenShareLink(private novel): error = %v, want ErrShareLinkNotFound", err)
+	}
+	if err := s.novel.SetNovelVisibility(ownerCtx, author, novelID, domain.VisibilityUnlisted); err != nil {
+		t.Fatalf("SetNovelVisibility(unlisted): %v", err)
+	}
+
+	// Удаление ссылки отзывает доступ
+	if err := s.novel.DeleteShareLink(ownerCtx, author, novelID); err != nil {
+		t.Fatalf("DeleteShareLink: %v", err)
+	}
+	if _, err := s.novel.GetNovelDetails(playerCtx, novelID); !errors.Is(err, service.ErrNovelNotFound) {
+		t.Fatalf("GetNovelDetails after the link was deleted: error = %v, want ErrNovelNotFound", err)
+	}
+}
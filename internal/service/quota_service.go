@@ -0,0 +1,215 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"novel-server/internal/config"
+	"novel-server/internal/domain"
+	"novel-server/internal/repository"
+	"sync"
+	"time"
+)
+
+// ErrQuotaExceeded - квота пользователя исчерпана
+var ErrQuotaExceeded = errors.New("quota exceeded")
+
+// QuotaExceededError сообщает, какая квота исчерпана и когда она обновится.
+// errors.Is(err, ErrQuotaExceeded) для нее возвращает true.
+type QuotaExceededError struct {
+	Kind       string // domain.Quota*
+	Limit      int64
+	RetryAfter time.Duration
+}
+
+func (e *QuotaExceededError) Error() string {
+	return fmt.Sprintf("%s quota exceeded (limit %d)", e.Kind, e.Limit)
+}
+
+func (e *QuotaExceededError) Unwrap() error {
+	return ErrQuotaExceeded
+}
+
+// QuotaService следит за лимитами генерации пользователей.
+// Окна квот фиксированные и считаются в UTC: сутки, час и календарный месяц.
+type QuotaService struct {
+	quotas repository.QuotaRepository
+	usage  repository.UsageRepository
+	cfg    config.QuotaConfig
+}
+
+// NewQuotaService создает новый экземпляр сервиса
+func NewQuotaService(quotas repository.QuotaRepository, usage repository.UsageRepository, cfg config.QuotaConfig) *QuotaService {
+	return &QuotaService{quotas: quotas, usage: usage, cfg: cfg}
+}
+
+// quotaWindow возвращает начало и конец текущего окна квоты kind
+func quotaWindow(kind string, now time.Time) (time.Time, time.Time) {
+	now = now.UTC()
+	switch kind {
+	case domain.QuotaDrafts:
+		start := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+		return start, start.AddDate(0, 0, 1)
+	case domain.QuotaScenes:
+		start := now.Truncate(time.Hour)
+		return start, start.Add(time.Hour)
+	default:
+		start := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+		return start, start.AddDate(0, 1, 0)
+	}
+}
+
+// requestLimit возвращает лимит запросов для квоты kind
+func (s *QuotaService) requestLimit(kind string) int {
+	switch kind {
+	case domain.QuotaDrafts:
+		return s.cfg.DraftsPerDay
+	case domain.QuotaScenes:
+		return s.cfg.ScenesPerHour
+	default:
+		return 0
+	}
+}
+
+// Check проверяет, что запрос по квоте kind можно сделать, но ничего не списывает:
+// месячный лимит токенов и, для domain.QuotaDrafts и domain.QuotaScenes, счетчик запросов
+// в текущем окне. Возвращает *QuotaExceededError, если запрос делать нельзя.
+func (s *QuotaService) Check(ctx context.Context, userID, kind string) error {
+	now := time.Now()
+	if err := s.checkTokens(ctx, userID, now); err != nil {
+		return err
+	}
+
+	limit := s.requestLimit(kind)
+	if limit <= 0 {
+		return nil
+	}
+	start, end := quotaWindow(kind, now)
+	used, err := s.quotas.GetQuotaUsage(ctx, userID, kind, start)
+	if err != nil {
+		return err
+	}
+	if used >= limit {
+		return &QuotaExceededError{Kind: kind, Limit: int64(limit), RetryAfter: end.Sub(now)}
+	}
+	return nil
+}
+
+// Consume списывает один запрос из квоты kind (domain.QuotaDrafts или domain.QuotaScenes).
+// Сначала проверяется месячный лимит токенов: если он исчерпан, запрос не списывается.
+// Для kind == domain.QuotaTokens проверяется только лимит токенов.
+// Возвращает *QuotaExceededError, если запрос делать нельзя.
+func (s *QuotaService) Consume(ctx context.Context, userID, kind string) error {
+	now := time.Now()
+	if err := s.checkTokens(ctx, userID, now); err != nil {
+		return err
+	}
+
+	limit := s.requestLimit(kind)
+	if limit <= 0 {
+		return nil
+	}
+	start, end := quotaWindow(kind, now)
+	_, ok, err := s.quotas.ConsumeQuota(ctx, userID, kind, start, limit)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		log.Printf("[QuotaService] %s quota exceeded for UserID %s (limit %d)", kind, userID, limit)
+		return &QuotaExceededError{Kind: kind, Limit: int64(limit), RetryAfter: end.Sub(now)}
+	}
+	return nil
+}
+
+// checkTokens проверяет месячный лимит токенов пользователя
+func (s *QuotaService) checkTokens(ctx context.Context, userID string, now time.Time) error {
+	if s.cfg.TokensPerMonth <= 0 {
+		return nil
+	}
+	start, end := quotaWindow(domain.QuotaTokens, now)
+	used, err := s.usage.CountUserTokens(ctx, userID, start)
+	if err != nil {
+		return err
+	}
+	if used >= s.cfg.TokensPerMonth {
+		log.Printf("[QuotaService] Token quota exceeded for UserID %s: %d/%d", userID, used, s.cfg.TokensPerMonth)
+		return &QuotaExceededError{Kind: domain.QuotaTokens, Limit: s.cfg.TokensPerMonth, RetryAfter: end.Sub(now)}
+	}
+	return nil
+}
+
+// quotaCharge - отложенное списание запроса из квоты (см. WithCharge)
+type quotaCharge struct {
+	quotas *QuotaService
+	userID string
+	kind   string
+	once   sync.Once
+	err    error
+}
+
+type quotaChargeKey struct{}
+
+// WithCharge возвращает контекст, в котором запрос списывается из квоты kind пользователя userID
+// не сразу, а когда сервис действительно обращается к модели (chargeQuota). Некорректные запросы,
+// запросы к недоступным новеллам и сцены из кеша поэтому квоту не расходуют.
+func (s *QuotaService) WithCharge(ctx context.Context, userID, kind string) context.Context {
+	return context.WithValue(ctx, quotaChargeKey{}, &quotaCharge{quotas: s, userID: userID, kind: kind})
+}
+
+// chargeQuota списывает запрос из квоты, отложенной в контексте WithCharge. Запрос списывается
+// один раз, сколько бы вызовов модели он ни сделал; без отложенной квоты ничего не делает.
+func chargeQuota(ctx context.Context) error {
+	charge, ok := ctx.Value(quotaChargeKey{}).(*quotaCharge)
+	if !ok {
+		return nil
+	}
+	charge.once.Do(func() {
+		charge.err = charge.quotas.Consume(ctx, charge.userID, charge.kind)
+	})
+	return charge.err
+}
+
+// Status возвращает использование и остаток всех квот пользователя
+func (s *QuotaService) Status(ctx context.Context, userID string) (*domain.QuotaStatus, error) {
+	now := time.Now()
+
+	drafts, err := s.requestUsage(ctx, userID, domain.QuotaDrafts, now)
+	if err != nil {
+		return nil, err
+	}
+	scenes, err := s.requestUsage(ctx, userID, domain.QuotaScenes, now)
+	if err != nil {
+		return nil, err
+	}
+
+	start, end := quotaWindow(domain.QuotaTokens, now)
+	tokens, err := s.usage.CountUserTokens(ctx, userID, start)
+	if err != nil {
+		return nil, err
+	}
+
+	return &domain.QuotaStatus{
+		Drafts: drafts,
+		Scenes: scenes,
+		Tokens: newQuotaUsage(s.cfg.TokensPerMonth, tokens, end),
+	}, nil
+}
+
+// requestUsage возвращает использование квоты запросов kind в текущем окне
+func (s *QuotaService) requestUsage(ctx context.Context, userID, kind string, now time.Time) (domain.QuotaUsage, error) {
+	start, end := quotaWindow(kind, now)
+	used, err := s.quotas.GetQuotaUsage(ctx, userID, kind, start)
+	if err != nil {
+		return domain.QuotaUsage{}, err
+	}
+	return newQuotaUsage(int64(s.requestLimit(kind)), int64(used), end), nil
+}
+
+// newQuotaUsage собирает использование квоты; limit <= 0 - квота не ограничена
+func newQuotaUsage(limit, used int64, resetsAt time.Time) domain.QuotaUsage {
+	if limit <= 0 {
+		return domain.QuotaUsage{Used: used, ResetsAt: resetsAt, Unlimited: true}
+	}
+	return domain.QuotaUsage{Limit: limit, Used: used, Remaining: max(limit-used, 0), ResetsAt: resetsAt}
+}
@@ -0,0 +1,121 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"novel-server/internal/config"
+	"novel-server/internal/domain"
+	"novel-server/internal/repository"
+	"novel-server/internal/service"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+// testQuotas - сервис квот поверх счетчиков в памяти с лимитом в один запрос
+type testQuotas struct {
+	*service.QuotaService
+	kind string
+}
+
+func newTestQuotas(kind string) *testQuotas {
+	quotas := service.NewQuotaService(repository.NewMemoryQuotaRepository(), repository.NewMemoryUsageRepository(),
+		config.QuotaConfig{DraftsPerDay: 1, ScenesPerHour: 1})
+	return &testQuotas{QuotaService: quotas, kind: kind}
+}
+
+// charged возвращает контекст запроса пользователя userID, как после QuotaMiddleware
+func (q *testQuotas) charged(userID string) context.Context {
+	return q.WithCharge(asUser(userID, domain.RolePlayer), userID, q.kind)
+}
+
+// used возвращает, сколько запросов пользователя userID списано из квоты
+func (q *testQuotas) used(t *testing.T, userID string) int64 {
+	t.Helper()
+	status, err := q.Status(context.Background(), userID)
+	if err != nil {
+		t.Fatalf("Status: %v", err)
+	}
+	if q.kind == domain.QuotaDrafts {
+		return status.Drafts.Used
+	}
+	return status.Scenes.Used
+}
+
+func TestSceneQuotaChargedOnlyForGeneration(t *testing.T) {
+	s := newTestServices(t, nil)
+	quotas := newTestQuotas(domain.QuotaScenes)
+	author, player := uuid.NewString(), uuid.NewString()
+	novelID := createNovel(t, s, author)
+
+	// Чужая приватная и несуществующая новеллы квоту не расходуют
+	for _, id := range []uuid.UUID{novelID, uuid.New()} {
+		_, err := s.content.GenerateNovelContent(quotas.charged(player), domain.NovelContentRequest{NovelID: id, UserID: player})
+		if !errors.Is(err, service.ErrNovelNotFound) {
+			t.Fatalf("GenerateNovelContent(%s): error = %v, want ErrNovelNotFound", id, err)
+		}
+	}
+	if _, err := s.content.GenerateNovelContent(quotas.charged(player), domain.NovelContentRequest{UserID: player}); err == nil {
+		t.Fatalf("GenerateNovelContent without novel_id succeeded")
+	}
+	if used := quotas.used(t, player); used != 0 {
+		t.Fatalf("scenes used after rejected requests = %d, want 0", used)
+	}
+
+	// Генерация первой сцены списывает запрос
+	if _, err := s.content.GenerateNovelContent(quotas.charged(author), domain.NovelContentRequest{NovelID: novelID, UserID: author}); err != nil {
+		t.Fatalf("GenerateNovelContent(first scene): %v", err)
+	}
+	if used := quotas.used(t, author); used != 1 {
+		t.Fatalf("scenes used after a generation = %d, want 1", used)
+	}
+	if err := quotas.Check(context.Background(), author, domain.QuotaScenes); !errors.Is(err, service.ErrQuotaExceeded) {
+		t.Fatalf("Check after the limit was reached: error = %v, want ErrQuotaExceeded", err)
+	}
+
+	// Та же сцена другому игроку берется из кеша и квоту не расходует
+	if err := s.novel.SetNovelVisibility(context.Background(), author, novelID, domain.VisibilityPublic); err != nil {
+		t.Fatalf("SetNovelVisibility: %v", err)
+	}
+	if _, err := s.content.GenerateNovelContent(quotas.charged(player), domain.NovelContentRequest{NovelID: novelID, UserID: player}); err != nil {
+		t.Fatalf("GenerateNovelContent(cached first scene): %v", err)
+	}
+	if used := quotas.used(t, player); used != 0 {
+		t.Fatalf("scenes used after a cached scene = %d, want 0", used)
+	}
+
+	// Квота, исчерпанная после проверки в middleware, не дает вызвать модель
+	calls := len(s.provider.Calls())
+	_, err := s.content.GenerateNovelContent(quotas.charged(author), repairClockRequest(author, novelID))
+	var quotaErr *service.QuotaExceededError
+	if !errors.As(err, &quotaErr) || quotaErr.Kind != domain.QuotaScenes {
+		t.Fatalf("GenerateNovelContent over the limit: error = %v, want a scenes QuotaExceededError", err)
+	}
+	if got := len(s.provider.Calls()); got != calls {
+		t.Fatalf("model calls over the limit = %d, want none", got-calls)
+	}
+}
+
+func TestDraftQuotaChargedOnlyForGeneration(t *testing.T) {
+	s := newTestServices(t, nil)
+	quotas := newTestQuotas(domain.QuotaDrafts)
+	author := uuid.NewString()
+
+	if _, err := s.novel.RefineDraft(quotas.charged(author), author, uuid.New(), "Make it darker"); !errors.Is(err, service.ErrDraftNotFound) {
+		t.Fatalf("RefineDraft(unknown draft): error = %v, want ErrDraftNotFound", err)
+	}
+	if used := quotas.used(t, author); used != 0 {
+		t.Fatalf("drafts used after a rejected refinement = %d, want 0", used)
+	}
+
+	draftID, _, err := s.novel.CreateDraft(quotas.charged(author), author, domain.NovelGenerationRequest{UserPrompt: "A mystery in a clockwork archive"})
+	if err != nil {
+		t.Fatalf("CreateDraft: %v", err)
+	}
+	if used := quotas.used(t, author); used != 1 {
+		t.Fatalf("drafts used after a generation = %d, want 1", used)
+	}
+	if _, err := s.novel.RefineDraft(quotas.charged(author), author, draftID, "Make it darker"); !errors.Is(err, service.ErrQuotaExceeded) {
+		t.Fatalf("RefineDraft over the limit: error = %v, want ErrQuotaExceeded", err)
+	}
+}
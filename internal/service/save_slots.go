@@ -0,0 +1,104 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"novel-server/internal/domain"
+	"novel-server/internal/repository"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+)
+
+// maxSaveSlotNameLength - максимальная длина имени сохранения (в символах)
+const maxSaveSlotNameLength = 100
+
+// Ошибки сохранений, которые обработчики переводят в HTTP-статусы
+var (
+	ErrSaveSlotNotFound    = errors.New("save slot not found")
+	ErrInvalidSaveSlotName = errors.New("invalid save slot name")
+	ErrNothingToSave       = errors.New("no progress to save")
+)
+
+// CreateSaveSlot сохраняет текущее прохождение пользователя в слот с именем name.
+// Сохранение с тем же именем перезаписывается.
+func (s *NovelService) CreateSaveSlot(ctx context.Context, userID string, novelID uuid.UUID, name string) (*domain.SaveSlot, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, fmt.Errorf("%w: name is required", ErrInvalidSaveSlotName)
+	}
+	if utf8.RuneCountInString(name) > maxSaveSlotNameLength {
+		return nil, fmt.Errorf("%w: name is longer than %d characters", ErrInvalidSaveSlotName, maxSaveSlotNameLength)
+	}
+
+	sceneIndex, err := s.novelRepo.GetUserNovelProgress(ctx, novelID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user progress: %w", err)
+	}
+	if sceneIndex < 0 {
+		return nil, ErrNothingToSave
+	}
+
+	track, err := s.novelRepo.ListUserStoryProgress(ctx, novelID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	slot, err := s.saveSlots.UpsertSaveSlot(ctx, &domain.SaveSlot{
+		NovelID:    novelID,
+		UserID:     userID,
+		Name:       name,
+		SceneIndex: sceneIndex,
+		Progress:   track,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("[NovelService] CreateSaveSlot - Saved NovelID %s for UserID %s to slot '%s' at scene %d",
+		novelID, userID, name, sceneIndex)
+	return slot, nil
+}
+
+// ListSaveSlots возвращает сохранения пользователя в новелле
+func (s *NovelService) ListSaveSlots(ctx context.Context, userID string, novelID uuid.UUID) ([]domain.SaveSlot, error) {
+	return s.saveSlots.ListSaveSlots(ctx, novelID, userID)
+}
+
+// LoadSaveSlot делает сохранение текущим прохождением пользователя: его прогресс заменяет
+// текущий, и GenerateNovelContent продолжает историю с сохраненной сцены.
+// Текущее прохождение не сохраняется автоматически. Возвращает сохраненную сцену.
+func (s *NovelService) LoadSaveSlot(ctx context.Context, userID string, novelID uuid.UUID, slotID uuid.UUID) (*domain.NovelContentResponse, error) {
+	// Доступ к новелле могли отозвать после сохранения
+	if _, err := checkNovelAccess(ctx, s.novelRepo, novelID, userID); err != nil {
+		return nil, err
+	}
+
+	slot, err := s.saveSlots.GetSaveSlot(ctx, novelID, userID, slotID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, ErrSaveSlotNotFound
+		}
+		return nil, err
+	}
+
+	if err := s.novelRepo.ReplaceUserStoryProgress(ctx, novelID, userID, slot.SceneIndex, slot.Progress); err != nil {
+		return nil, fmt.Errorf("failed to load save slot: %w", err)
+	}
+	log.Printf("[NovelService] LoadSaveSlot - Loaded slot '%s' of NovelID %s for UserID %s, scene %d",
+		slot.Name, novelID, userID, slot.SceneIndex)
+
+	return s.novelContentService.GetScene(ctx, novelID, userID, slot.SceneIndex)
+}
+
+// DeleteSaveSlot удаляет сохранение пользователя
+func (s *NovelService) DeleteSaveSlot(ctx context.Context, userID string, novelID uuid.UUID, slotID uuid.UUID) error {
+	err := s.saveSlots.DeleteSaveSlot(ctx, novelID, userID, slotID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return ErrSaveSlotNotFound
+	}
+	return err
+}
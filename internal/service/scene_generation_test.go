@@ -0,0 +1,141 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"novel-server/internal/domain"
+	"novel-server/internal/llm"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// gatedProvider задерживает ответы модели, пока включен gated и не закрыт release
+type gatedProvider struct {
+	llm.LLMProvider
+	gated   atomic.Bool
+	started chan struct{}
+	release chan struct{}
+}
+
+// wait сообщает о начале вызова и ждет разрешения ответить
+func (p *gatedProvider) wait(ctx context.Context) error {
+	if !p.gated.Load() {
+		return nil
+	}
+	p.started <- struct{}{}
+	select {
+	case <-p.release:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (p *gatedProvider) ChatCompletion(ctx context.Context, messages []llm.Message) (string, error) {
+	if err := p.wait(ctx); err != nil {
+		return "", err
+	}
+	return p.LLMProvider.ChatCompletion(ctx, messages)
+}
+
+func (p *gatedProvider) ChatCompletionStream(ctx context.Context, messages []llm.Message, opts llm.ChatOptions, onDelta llm.DeltaFunc) (*llm.ChatResult, error) {
+	if err := p.wait(ctx); err != nil {
+		return nil, err
+	}
+	return p.LLMProvider.ChatCompletionStream(ctx, messages, opts, onDelta)
+}
+
+// waitFor ждет выполнения условия cond
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// Запрос, начавший генерацию ветки, уходит по отмене своего ctx, а генерация продолжается
+// для второго игрока, ждущего ту же ветку. Потоковые события ушедшему запросу больше не приходят.
+func TestBranchGenerationOutlivesCancelledLeader(t *testing.T) {
+	gate := &gatedProvider{started: make(chan struct{}, 1), release: make(chan struct{})}
+	s := newTestServices(t, func(provider llm.LLMProvider) llm.LLMProvider {
+		gate.LLMProvider = provider
+		return gate
+	})
+	author, player := uuid.NewString(), uuid.NewString()
+	novelID := createNovel(t, s, author)
+	playFirstScene(t, s, author, novelID)
+	if err := s.novel.SetNovelVisibility(context.Background(), author, novelID, domain.VisibilityPublic); err != nil {
+		t.Fatalf("SetNovelVisibility: %v", err)
+	}
+	playFirstScene(t, s, player, novelID)
+	calls := len(s.provider.Calls())
+	gate.gated.Store(true)
+
+	// Автор начинает генерацию второй сцены и ждет ответа модели
+	authorCtx, cancelAuthor := context.WithCancel(context.Background())
+	defer cancelAuthor()
+	var authorReturned atomic.Bool
+	var lateEvents atomic.Int32
+	authorDone := make(chan error, 1)
+	go func() {
+		_, err := s.content.GenerateNovelContentStream(authorCtx, repairClockRequest(author, novelID), func(domain.Event, *domain.NovelState) error {
+			if authorReturned.Load() {
+				lateEvents.Add(1)
+			}
+			return nil
+		})
+		authorReturned.Store(true)
+		authorDone <- err
+	}()
+	<-gate.started
+
+	// Игрок приходит в ту же ветку и ждет генерацию автора
+	type result struct {
+		response *domain.NovelContentResponse
+		err      error
+	}
+	playerDone := make(chan result, 1)
+	go func() {
+		response, err := s.content.GenerateNovelContent(context.Background(), repairClockRequest(player, novelID))
+		playerDone <- result{response, err}
+	}()
+	waitFor(t, "the player to wait for the branch", func() bool { return s.content.GenerationWaiters() == 2 })
+
+	// Автор уходит, не дожидаясь модели
+	cancelAuthor()
+	select {
+	case err := <-authorDone:
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("cancelled author got %v, want context.Canceled", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("cancelled author is still waiting for the generation")
+	}
+	if got := s.content.GenerationWaiters(); got != 1 {
+		t.Fatalf("%d requests wait for the branch after the author left, want 1", got)
+	}
+
+	close(gate.release)
+	got := <-playerDone
+	if got.err != nil {
+		t.Fatalf("player: %v", got.err)
+	}
+	checkSecondScene(t, got.response)
+	if n := len(s.provider.Calls()) - calls; n != 1 {
+		t.Fatalf("branch was generated with %d model calls, want 1", n)
+	}
+	if n := lateEvents.Load(); n != 0 {
+		t.Fatalf("%d streamed events were delivered after the author returned", n)
+	}
+	if got := s.content.GenerationWaiters(); got != 0 {
+		t.Fatalf("%d requests still wait for the branch", got)
+	}
+}
@@ -0,0 +1,125 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"novel-server/internal/domain"
+	"novel-server/internal/repository"
+
+	"github.com/google/uuid"
+)
+
+// ErrSceneNotPlayed - пользователь еще не дошел до запрошенной сцены
+var ErrSceneNotPlayed = errors.New("scene has not been played yet")
+
+// GetScene возвращает уже пройденную пользователем сцену с индексом sceneIndex вместе
+// с состоянием (флаги, отношения, переменные) на момент этой сцены. Генерация не запускается,
+// прогресс пользователя не меняется.
+func (s *NovelContentService) GetScene(ctx context.Context, novelID uuid.UUID, userID string, sceneIndex int) (*domain.NovelContentResponse, error) {
+	if _, err := checkNovelAccess(ctx, s.novelRepo, novelID, userID); err != nil {
+		return nil, err
+	}
+	return s.playedScene(ctx, s.novelRepo, novelID, userID, sceneIndex)
+}
+
+// RestartFromScene откатывает прогресс пользователя к уже пройденной сцене sceneIndex:
+// прогресс последующих сцен удаляется, флаги, отношения и переменные восстанавливаются
+// на момент этой сцены. Возвращает сцену sceneIndex; следующий выбор продолжит историю с нее.
+// Сцена читается и прогресс откатывается в одной транзакции, поэтому возвращается ровно
+// то состояние, к которому откатился прогресс.
+func (s *NovelContentService) RestartFromScene(ctx context.Context, novelID uuid.UUID, userID string, sceneIndex int) (*domain.NovelContentResponse, error) {
+	if _, err := checkNovelAccess(ctx, s.novelRepo, novelID, userID); err != nil {
+		return nil, err
+	}
+
+	var response *domain.NovelContentResponse
+	err := s.novelRepo.WithTx(ctx, func(tx repository.NovelRepository) error {
+		var err error
+		response, err = s.playedScene(ctx, tx, novelID, userID, sceneIndex)
+		if err != nil {
+			return err
+		}
+		if err := tx.RewindUserProgress(ctx, novelID, userID, sceneIndex); err != nil {
+			return fmt.Errorf("failed to rewind user progress: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("[RestartFromScene] Restarted NovelID %s for UserID %s from scene %d", novelID, userID, sceneIndex)
+	return response, nil
+}
+
+// playedScene возвращает пройденную сцену sceneIndex с состоянием на ее момент, читая через репозиторий repo
+func (s *NovelContentService) playedScene(ctx context.Context, repo repository.NovelRepository, novelID uuid.UUID, userID string, sceneIndex int) (*domain.NovelContentResponse, error) {
+	state, err := loadPlayedState(ctx, repo, novelID, userID, sceneIndex)
+	if err != nil {
+		return nil, err
+	}
+
+	sceneContent, err := s.extractSceneContent(state, sceneIndex)
+	if err != nil {
+		return nil, fmt.Errorf("failed to extract scene %d: %w", sceneIndex, err)
+	}
+
+	return &domain.NovelContentResponse{
+		State:      *state,
+		NewContent: sceneContent,
+	}, nil
+}
+
+// loadPlayedState собирает состояние пользователя на момент сцены sceneIndex: сцены берутся
+// из сохраненного состояния novel_states, динамические элементы - из user_story_progress.
+// Читает через репозиторий repo. Возвращает ErrSceneNotPlayed, если пользователь до этой сцены не дошел.
+func loadPlayedState(ctx context.Context, repo repository.NovelRepository, novelID uuid.UUID, userID string, sceneIndex int) (*domain.NovelState, error) {
+	currentSceneIndex, err := repo.GetUserNovelProgress(ctx, novelID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user progress: %w", err)
+	}
+	if sceneIndex < 0 || sceneIndex > currentSceneIndex {
+		return nil, fmt.Errorf("%w: scene %d, current scene is %d", ErrSceneNotPlayed, sceneIndex, currentSceneIndex)
+	}
+
+	progress, err := repo.GetUserStoryProgress(ctx, novelID, userID, sceneIndex)
+	if err != nil && !errors.Is(err, repository.ErrNotFound) {
+		return nil, fmt.Errorf("failed to get user story progress: %w", err)
+	}
+
+	var stateData []byte
+	switch {
+	case progress != nil:
+		stateData, err = repo.GetNovelState(ctx, novelID, sceneIndex, progress.StateHash)
+		if errors.Is(err, repository.ErrNotFound) {
+			// Состояние с этим хешем не сохранилось - сцены берем из общего состояния,
+			// динамические элементы все равно восстановятся из прогресса
+			log.Printf("[loadPlayedState] No state with hash %s for scene %d, falling back to shared scene state", progress.StateHash, sceneIndex)
+			stateData, err = repo.GetNovelStateBySceneIndex(ctx, novelID, sceneIndex)
+		}
+	case sceneIndex == 0:
+		// Для первой сцены прогресс может не сохраняться: она общая для всех игроков
+		// и начинается с состояния из сетапа
+		stateData, err = repo.GetNovelStateBySceneIndex(ctx, novelID, 0)
+	default:
+		return nil, fmt.Errorf("%w: no progress saved for scene %d", ErrSceneNotPlayed, sceneIndex)
+	}
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, fmt.Errorf("%w: scene %d is not saved", ErrSceneNotPlayed, sceneIndex)
+		}
+		return nil, fmt.Errorf("failed to get novel state for scene %d: %w", sceneIndex, err)
+	}
+
+	var state domain.NovelState
+	if err := json.Unmarshal(stateData, &state); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal state for scene %d: %w", sceneIndex, err)
+	}
+
+	result := MergeStateWithProgress(&state, progress)
+	result.CurrentSceneIndex = sceneIndex
+	return result, nil
+}
@@ -0,0 +1,169 @@
+package service
+
+import (
+	"context"
+	"log"
+	"novel-server/internal/config"
+	"novel-server/internal/domain"
+	"novel-server/internal/repository"
+	"sync"
+	"time"
+)
+
+// maxSetupRetryBackoff ограничивает экспоненциальную задержку между попытками
+const maxSetupRetryBackoff = 30 * time.Minute
+
+// SetupWorkerPool обрабатывает очередь задач генерации сетапа новелл.
+// Задачи хранятся в Postgres, поэтому переживают перезапуск процесса,
+// а упавшие задачи остаются видимыми и могут быть перезапущены.
+type SetupWorkerPool struct {
+	jobs                repository.SetupJobRepository
+	novelContentService *NovelContentService
+	cfg                 config.SetupConfig
+	wake                chan struct{}
+	wg                  sync.WaitGroup
+}
+
+// NewSetupWorkerPool создает пул воркеров очереди сетапа
+func NewSetupWorkerPool(jobs repository.SetupJobRepository, novelContentService *NovelContentService, cfg config.SetupConfig) *SetupWorkerPool {
+	if cfg.Workers < 1 {
+		cfg.Workers = 1
+	}
+	if cfg.MaxAttempts < 1 {
+		cfg.MaxAttempts = 1
+	}
+	return &SetupWorkerPool{
+		jobs:                jobs,
+		novelContentService: novelContentService,
+		cfg:                 cfg,
+		wake:                make(chan struct{}, 1),
+	}
+}
+
+// Start возвращает в очередь зависшие задачи и запускает воркеры.
+// Воркеры работают до отмены ctx; дождаться их завершения можно через Wait.
+func (p *SetupWorkerPool) Start(ctx context.Context) {
+	requeued, err := p.jobs.RequeueStaleSetupJobs(ctx, p.cfg.StaleAfter)
+	if err != nil {
+		log.Printf("[SetupWorker] Error requeueing stale jobs: %v", err)
+	} else if requeued > 0 {
+		log.Printf("[SetupWorker] Requeued %d stale setup jobs", requeued)
+	}
+
+	for i := 0; i < p.cfg.Workers; i++ {
+		p.wg.Add(1)
+		go p.worker(ctx, i)
+	}
+	log.Printf("[SetupWorker] Started %d setup workers", p.cfg.Workers)
+}
+
+// Wait блокируется, пока все воркеры не завершатся.
+func (p *SetupWorkerPool) Wait() {
+	p.wg.Wait()
+}
+
+// Notify будит один из простаивающих воркеров, не дожидаясь следующего опроса очереди.
+func (p *SetupWorkerPool) Notify() {
+	select {
+	case p.wake <- struct{}{}:
+	default:
+	}
+}
+
+// MaxAttempts возвращает число попыток для новых задач
+func (p *SetupWorkerPool) MaxAttempts() int {
+	return p.cfg.MaxAttempts
+}
+
+// worker забирает задачи из очереди, пока не отменен ctx
+func (p *SetupWorkerPool) worker(ctx context.Context, id int) {
+	defer p.wg.Done()
+	ticker := time.NewTicker(p.cfg.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		if ctx.Err() != nil {
+			return
+		}
+
+		job, err := p.jobs.ClaimNextSetupJob(ctx)
+		if err != nil && ctx.Err() == nil {
+			log.Printf("[SetupWorker %d] Error claiming job: %v", id, err)
+		}
+		if job != nil {
+			p.runJob(ctx, id, job)
+			continue // Сразу проверяем, нет ли следующей задачи
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-p.wake:
+		case <-ticker.C:
+		}
+	}
+}
+
+// runJob выполняет одну попытку генерации сетапа и записывает результат
+func (p *SetupWorkerPool) runJob(ctx context.Context, workerID int, job *domain.SetupJob) {
+	log.Printf("[SetupWorker %d] Running setup for NovelID: %s (attempt %d/%d)", workerID, job.NovelID, job.Attempts, job.MaxAttempts)
+
+	jobCtx, cancel := context.WithTimeout(ctx, p.cfg.JobTimeout)
+	err := p.generateSetup(jobCtx, job)
+	cancel()
+
+	// Результат записываем даже при остановке сервера, поэтому не используем отмененный ctx
+	saveCtx, saveCancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer saveCancel()
+
+	if err == nil {
+		if err := p.jobs.CompleteSetupJob(saveCtx, job.JobID); err != nil {
+			log.Printf("[SetupWorker %d] Error completing job %s: %v", workerID, job.JobID, err)
+			return
+		}
+		log.Printf("[SetupWorker %d] Setup for NovelID %s is done", workerID, job.NovelID)
+		return
+	}
+
+	var retryAt *time.Time
+	switch {
+	case ctx.Err() != nil:
+		// Сервер останавливается - это не вина задачи, возвращаем ее в очередь
+		now := time.Now()
+		retryAt = &now
+	case job.Attempts < job.MaxAttempts:
+		next := time.Now().Add(p.backoff(job.Attempts))
+		retryAt = &next
+	}
+
+	if failErr := p.jobs.FailSetupJob(saveCtx, job.JobID, err.Error(), retryAt); failErr != nil {
+		log.Printf("[SetupWorker %d] Error recording failure of job %s: %v", workerID, job.JobID, failErr)
+	}
+	if retryAt != nil {
+		log.Printf("[SetupWorker %d] Setup for NovelID %s failed, retry at %s: %v", workerID, job.NovelID, retryAt.Format(time.RFC3339), err)
+	} else {
+		log.Printf("[SetupWorker %d] Setup for NovelID %s failed permanently after %d attempts: %v", workerID, job.NovelID, job.Attempts, err)
+	}
+}
+
+// generateSetup генерирует и сохраняет сетап новеллы. Ошибка сохранения возвращается
+// из GenerateNovelContent, поэтому отдельно проверять сохраненный сетап не нужно.
+func (p *SetupWorkerPool) generateSetup(ctx context.Context, job *domain.SetupJob) error {
+	_, err := p.novelContentService.GenerateNovelContent(ctx, domain.NovelContentRequest{
+		NovelID: job.NovelID,
+		UserID:  job.UserID,
+	})
+	return err
+}
+
+// backoff возвращает задержку перед следующей попыткой: base * 2^(attempts-1)
+func (p *SetupWorkerPool) backoff(attempts int) time.Duration {
+	delay := p.cfg.RetryBackoff
+	for i := 1; i < attempts && delay < maxSetupRetryBackoff; i++ {
+		delay *= 2
+	}
+	if delay > maxSetupRetryBackoff {
+		delay = maxSetupRetryBackoff
+	}
+	return delay
+}
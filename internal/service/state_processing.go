@@ -1,120 +1,178 @@
 package service
 
 import (
+	"errors"
+	"fmt"
 	"log"
 	"novel-server/internal/domain"
+	"reflect"
 )
 
-// processUserChoice обрабатывает последствия выбора пользователя
-func processUserChoice(state *domain.NovelState, scene domain.Scene, choiceText string) {
+// ErrChoiceLocked - игрок выбрал вариант, условие requires которого не выполнено
+var ErrChoiceLocked = errors.New("choice is locked")
+
+// processUserChoice обрабатывает последствия выбора пользователя.
+// Возвращает ErrChoiceLocked, если выбранный вариант недоступен в текущем состоянии.
+func processUserChoice(state *domain.NovelState, scene domain.Scene, choiceText string) error {
 	log.Printf("[processUserChoice] Processing choice: %s", choiceText)
 
 	// Сначала проверяем event типа choice (в конце сцены)
 	for _, event := range scene.Events {
-		if event.EventType == "choice" && event.Choices != nil {
+		if choiceEvent, ok := event.Payload.(domain.ChoiceEvent); ok {
 			// Проверяем каждый выбор
-			for _, choice := range event.Choices {
+			for _, choice := range choiceEvent.Choices {
 				if choice.Text == choiceText {
 					log.Printf("[processUserChoice] Found matching 'choice': %s", choiceText)
+					if err := checkChoiceAvailable(state, choice); err != nil {
+						return err
+					}
 					processChoiceConsequences(state, choice.Consequences)
-					return
+					return nil
 				}
 			}
 		}
 	}
 
 	// Если не нашли в обычных выборах, проверяем inline_choice и inline_response
-	processInlineChoice(state, scene, choiceText)
+	return processInlineChoice(state, scene, choiceText)
 }
 
 // processInlineChoice обрабатывает inline_choice и inline_response события
-func processInlineChoice(state *domain.NovelState, scene domain.Scene, choiceText string) {
-	var inlineChoiceId string
+func processInlineChoice(state *domain.NovelState, scene domain.Scene, choiceText string) error {
+	var inlineChoice *domain.InlineChoiceEvent
 
 	// Ищем событие типа inline_choice
 	for _, event := range scene.Events {
-		if event.EventType == "inline_choice" && event.Data != nil {
-			if choiceId, ok := event.Data["choice_id"].(string); ok {
-				inlineChoiceId = choiceId
-				break
-			}
+		if payload, ok := event.Payload.(domain.InlineChoiceEvent); ok {
+			inlineChoice = &payload
+			break
 		}
 	}
 
-	// Если нашли ID выбора, ищем соответствующий inline_response
-	if inlineChoiceId != "" {
+	// Если нашли выбор, ищем соответствующий inline_response
+	if inlineChoice != nil {
 		for _, event := range scene.Events {
-			if event.EventType == "inline_response" && event.Data != nil {
-				dataChoiceId, hasChoiceId := event.Data["choice_id"].(string)
-				responses, hasResponses := event.Data["responses"].([]interface{})
-
-				if hasChoiceId && hasResponses && dataChoiceId == inlineChoiceId {
-					// Перебираем все возможные ответы
-					for _, respItem := range responses {
-						response, ok := respItem.(map[string]interface{})
-						if !ok {
-							continue
-						}
-
-						respChoiceText, hasText := response["choice_text"].(string)
-						if !hasText || respChoiceText != choiceText {
-							continue
-						}
-
-						log.Printf("[processInlineChoice] Found matching inline choice: %s", choiceText)
-
-						// Обрабатываем последствия inline-выбора
-						// В примере inline_response не содержит consequences, но в будущем может содержать
-						if consequences, hasConsequences := response["consequences"].(map[string]interface{}); hasConsequences {
-							processChoiceConsequences(state, consequences)
-						}
-
-						return
-					}
+			inlineResponse, ok := event.Payload.(domain.InlineResponseEvent)
+			if !ok || inlineResponse.ChoiceID != inlineChoice.ChoiceID {
+				continue
+			}
+			// Перебираем все возможные ответы
+			for _, response := range inlineResponse.Responses {
+				if response.ChoiceText != choiceText {
+					continue
 				}
+
+				log.Printf("[processInlineChoice] Found matching inline choice: %s", choiceText)
+				return applyInlineChoice(state, *inlineChoice, response)
 			}
 		}
 	}
 
 	log.Printf("[processInlineChoice] No matching inline choice found for: %s", choiceText)
+	return nil
 }
 
-// processChoiceConsequences обрабатывает последствия выбора
-func processChoiceConsequences(state *domain.NovelState, consequences map[string]interface{}) {
+// applyInlineChoice применяет выбор варианта inline_choice: проверяет условие варианта,
+// затем применяет его последствия и последствия соответствующего inline_response
+func applyInlineChoice(state *domain.NovelState, inlineChoice domain.InlineChoiceEvent, response domain.InlineResponse) error {
+	for _, choice := range inlineChoice.Choices {
+		if choice.Text != response.ChoiceText {
+			continue
+		}
+		if err := checkChoiceAvailable(state, choice); err != nil {
+			return err
+		}
+		processChoiceConsequences(state, choice.Consequences)
+		break
+	}
+
+	// Поля relationship_changes, add_global_flags и story_variables inline_response
+	// работают как соответствующие поля consequences
+	processChoiceConsequences(state, &domain.Consequences{
+		GlobalFlags:    response.AddGlobalFlags,
+		Relationship:   response.RelationshipChanges,
+		StoryVariables: response.StoryVariables,
+	})
+	processChoiceConsequences(state, response.Consequences)
+	return nil
+}
+
+// checkChoiceAvailable возвращает ErrChoiceLocked, если условие requires варианта не выполнено.
+// Вариант, условие которого не удалось вычислить, тоже считается недоступным.
+func checkChoiceAvailable(state *domain.NovelState, choice domain.Choice) error {
+	available, err := choice.Available(state)
+	if err != nil {
+		log.Printf("[checkChoiceAvailable] Failed to evaluate requires of choice '%s': %v", choice.Text, err)
+	}
+	if !available {
+		return fmt.Errorf("%w: %q requires %s", ErrChoiceLocked, choice.Text, choice.Requires)
+	}
+	return nil
+}
+
+// processChoiceConsequences применяет последствия выбора к состоянию.
+// Эффекты, которые не удалось применить, пропускаются и попадают в лог.
+func processChoiceConsequences(state *domain.NovelState, consequences *domain.Consequences) {
 	if consequences == nil {
 		return
 	}
+	if err := consequences.Apply(state); err != nil {
+		log.Printf("[processChoiceConsequences] Some consequences were not applied: %v", err)
+	}
+}
 
-	// Обработка флагов
-	if flags, ok := consequences["global_flags"].([]interface{}); ok {
-		log.Printf("[processChoiceConsequences] Processing global flags")
-		for _, flag := range flags {
-			if flagStr, ok := flag.(string); ok {
-				state.GlobalFlags = append(state.GlobalFlags, flagStr)
-			}
-		}
+// snapshotState копирует поля состояния, которые меняют последствия выбора
+func snapshotState(state *domain.NovelState) domain.NovelState {
+	snapshot := domain.NovelState{
+		GlobalFlags:    append([]string(nil), state.GlobalFlags...),
+		Relationship:   make(map[string]int, len(state.Relationship)),
+		StoryVariables: make(map[string]interface{}, len(state.StoryVariables)),
+	}
+	for k, v := range state.Relationship {
+		snapshot.Relationship[k] = v
 	}
+	for k, v := range state.StoryVariables {
+		snapshot.StoryVariables[k] = v
+	}
+	return snapshot
+}
 
-	// Обработка отношений
-	if relationships, ok := consequences["relationship"].(map[string]interface{}); ok {
-		log.Printf("[processChoiceConsequences] Processing relationships")
-		for character, value := range relationships {
-			if intValue, ok := value.(float64); ok {
-				current, exists := state.Relationship[character]
-				if exists {
-					state.Relationship[character] = current + int(intValue)
-				} else {
-					state.Relationship[character] = int(intValue)
-				}
-			}
+// diffStateChanges возвращает изменения флагов, отношений и переменных между before и after
+func diffStateChanges(before domain.NovelState, after *domain.NovelState) domain.NovelStateChanges {
+	changes := domain.NovelStateChanges{
+		Relationship:   make(map[string]int),
+		StoryVariables: make(map[string]interface{}),
+		GlobalFlags:    []string{},
+	}
+	for _, flag := range after.GlobalFlags {
+		if !containsString(before.GlobalFlags, flag) {
+			changes.GlobalFlags = append(changes.GlobalFlags, flag)
+		}
+	}
+	for _, flag := range before.GlobalFlags {
+		if !containsString(after.GlobalFlags, flag) {
+			changes.RemovedGlobalFlags = append(changes.RemovedGlobalFlags, flag)
+		}
+	}
+	for character, value := range after.Relationship {
+		if old, ok := before.Relationship[character]; !ok || old != value {
+			changes.Relationship[character] = value
+		}
+	}
+	for key, value := range after.StoryVariables {
+		if old, ok := before.StoryVariables[key]; !ok || !reflect.DeepEqual(old, value) {
+			changes.StoryVariables[key] = value
 		}
 	}
+	return changes
+}
 
-	// Обработка переменных истории
-	if variables, ok := consequences["story_variables"].(map[string]interface{}); ok {
-		log.Printf("[processChoiceConsequences] Processing story variables")
-		for key, value := range variables {
-			state.StoryVariables[key] = value
+// containsString сообщает, есть ли value в values
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
 		}
 	}
+	return false
 }
@@ -0,0 +1,122 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"novel-server/internal/domain"
+	"novel-server/internal/repository"
+	"sort"
+
+	"github.com/google/uuid"
+)
+
+// GetStoryGraph строит граф ветвлений новеллы по сохраненным состояниям и путям игроков.
+// Граф доступен только автору новеллы.
+func (s *NovelService) GetStoryGraph(ctx context.Context, userID string, novelID uuid.UUID) (*domain.StoryGraph, error) {
+	if _, err := s.novelRepo.GetNovelMetadataByID(ctx, novelID, userID); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, ErrNovelNotFound
+		}
+		return nil, fmt.Errorf("failed to get novel: %w", err)
+	}
+
+	states, err := s.novelRepo.ListNovelStateRefs(ctx, novelID)
+	if err != nil {
+		return nil, err
+	}
+	steps, err := s.novelRepo.ListStoryPathSteps(ctx, novelID)
+	if err != nil {
+		return nil, err
+	}
+
+	graph := buildStoryGraph(novelID, states, steps)
+	log.Printf("[GetStoryGraph] Built story graph for NovelID %s: %d nodes, %d edges", novelID, len(graph.Nodes), len(graph.Edges))
+	return graph, nil
+}
+
+// buildStoryGraph собирает граф ветвлений. Узлы - все сохраненные состояния и состояния
+// из путей игроков. Ребра соединяют соседние сцены пути каждого игрока; выбором ребра
+// считается последний выбор, добавившийся в previous_choices при переходе.
+// У игрока хранится только текущий путь (после перезапуска старые шаги перезаписываются),
+// поэтому счетчики игроков отражают текущие пути.
+func buildStoryGraph(novelID uuid.UUID, states []domain.StoryStateRef, steps []domain.StoryPathStep) *domain.StoryGraph {
+	nodes := make(map[string]*domain.StoryGraphNode)
+	node := func(sceneIndex int, stateHash string) *domain.StoryGraphNode {
+		id := domain.StoryGraphNodeID(sceneIndex, stateHash)
+		n, ok := nodes[id]
+		if !ok {
+			n = &domain.StoryGraphNode{ID: id, SceneIndex: sceneIndex, StateHash: stateHash}
+			nodes[id] = n
+		}
+		return n
+	}
+
+	for _, state := range states {
+		node(state.SceneIndex, state.StateHash).Cached = true
+	}
+
+	type edgeKey struct{ from, to, choice string }
+	edges := make(map[edgeKey]int)
+	for i, step := range steps {
+		node(step.SceneIndex, step.StateHash).Players++
+
+		if i == 0 {
+			continue
+		}
+		prev := steps[i-1]
+		if prev.UserID != step.UserID || prev.SceneIndex+1 != step.SceneIndex {
+			// Начало пути другого игрока или разрыв в пути
+			continue
+		}
+		choice := ""
+		if len(step.PreviousChoices) > len(prev.PreviousChoices) {
+			choice = step.PreviousChoices[len(step.PreviousChoices)-1]
+		}
+		key := edgeKey{
+			from:   domain.StoryGraphNodeID(prev.SceneIndex, prev.StateHash),
+			to:     domain.StoryGraphNodeID(step.SceneIndex, step.StateHash),
+			choice: choice,
+		}
+		edges[key]++
+	}
+
+	graph := &domain.StoryGraph{
+		NovelID: novelID,
+		Nodes:   make([]domain.StoryGraphNode, 0, len(nodes)),
+		Edges:   make([]domain.StoryGraphEdge, 0, len(edges)),
+	}
+	for _, n := range nodes {
+		graph.Nodes = append(graph.Nodes, *n)
+	}
+	sort.Slice(graph.Nodes, func(i, j int) bool {
+		a, b := graph.Nodes[i], graph.Nodes[j]
+		if a.SceneIndex != b.SceneIndex {
+			return a.SceneIndex < b.SceneIndex
+		}
+		return a.StateHash < b.StateHash
+	})
+
+	for key, players := range edges {
+		graph.Edges = append(graph.Edges, domain.StoryGraphEdge{From: key.from, To: key.to, Choice: key.choice, Players: players})
+	}
+	sort.Slice(graph.Edges, func(i, j int) bool {
+		a, b := graph.Edges[i], graph.Edges[j]
+		if sa, sb := nodes[a.From].SceneIndex, nodes[b.From].SceneIndex; sa != sb {
+			return sa < sb
+		}
+		if a.From != b.From {
+			return a.From < b.From
+		}
+		if a.Players != b.Players {
+			return a.Players > b.Players
+		}
+		if a.To != b.To {
+			return a.To < b.To
+		}
+		return a.Choice < b.Choice
+	})
+
+	return graph
+}
@@ -0,0 +1,58 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"novel-server/internal/domain"
+	"novel-server/internal/repository"
+	"time"
+)
+
+// Ограничения выборки агрегатов использования модели
+const (
+	defaultUsagePeriod = 30 * 24 * time.Hour
+	defaultUsageLimit  = 100
+	maxUsageLimit      = 1000
+)
+
+// ErrInvalidUsageQuery - неизвестная группировка или некорректный период
+var ErrInvalidUsageQuery = errors.New("invalid usage query")
+
+// UsageService отдает статистику расхода токенов и стоимости вызовов модели
+type UsageService struct {
+	usage repository.UsageRepository
+}
+
+// NewUsageService создает новый экземпляр сервиса
+func NewUsageService(usage repository.UsageRepository) *UsageService {
+	return &UsageService{usage: usage}
+}
+
+// Summarize возвращает агрегаты расхода, сгруппированные по groupBy (domain.LLMUsageBy*).
+// Пустой период - последние 30 дней; лимит по умолчанию 100 строк.
+func (s *UsageService) Summarize(ctx context.Context, groupBy string, filter domain.LLMUsageFilter) ([]domain.LLMUsageSummary, error) {
+	switch groupBy {
+	case domain.LLMUsageByUser, domain.LLMUsageByNovel, domain.LLMUsageByDay:
+	default:
+		return nil, fmt.Errorf("%w: unknown grouping %q", ErrInvalidUsageQuery, groupBy)
+	}
+
+	if filter.To.IsZero() {
+		filter.To = time.Now()
+	}
+	if filter.From.IsZero() {
+		filter.From = filter.To.Add(-defaultUsagePeriod)
+	}
+	if !filter.From.Before(filter.To) {
+		return nil, fmt.Errorf("%w: 'from' must be before 'to'", ErrInvalidUsageQuery)
+	}
+	if filter.Limit <= 0 {
+		filter.Limit = defaultUsageLimit
+	}
+	if filter.Limit > maxUsageLimit {
+		filter.Limit = maxUsageLimit
+	}
+
+	return s.usage.SummarizeLLMUsage(ctx, groupBy, filter)
+}
@@ -0,0 +1,41 @@
+-- +migrate Up
+
+-- Очередь задач на генерацию сетапа новеллы (по одной задаче на новеллу)
+CREATE TABLE IF NOT EXISTS novel_setup_jobs (
+    job_id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    novel_id UUID NOT NULL UNIQUE REFERENCES novels(novel_id) ON DELETE CASCADE,
+    user_id VARCHAR(255) NOT NULL,
+    status VARCHAR(16) NOT NULL DEFAULT 'queued' CHECK (status IN ('queued', 'running', 'failed', 'done')),
+    attempts INTEGER NOT NULL DEFAULT 0,
+    max_attempts INTEGER NOT NULL DEFAULT 3,
+    last_error TEXT,
+    run_after TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    locked_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Индекс для выборки следующей задачи воркером
+CREATE INDEX IF NOT EXISTS idx_novel_setup_jobs_pending ON novel_setup_jobs(status, run_after);
+
+-- Индекс для списка задач пользователя
+CREATE INDEX IF NOT EXISTS idx_novel_setup_jobs_user_id ON novel_setup_jobs(user_id);
+
+CREATE TRIGGER update_novel_setup_jobs_updated_at
+    BEFORE UPDATE ON novel_setup_jobs
+    FOR EACH ROW
+    EXECUTE FUNCTION update_updated_at_column();
+
+-- Новеллы, сетап которых потерялся до появления очереди, ставим в очередь заново
+INSERT INTO novel_setup_jobs (novel_id, user_id)
+SELECT novel_id, user_id
+FROM novels
+WHERE setup_state_data IS NULL
+ON CONFLICT (novel_id) DO NOTHING;
+
+-- +migrate Down
+
+DROP TRIGGER IF EXISTS update_novel_setup_jobs_updated_at ON novel_setup_jobs;
+DROP INDEX IF EXISTS idx_novel_setup_jobs_user_id;
+DROP INDEX IF EXISTS idx_novel_setup_jobs_pending;
+DROP TABLE IF EXISTS novel_setup_jobs;
@@ -0,0 +1,24 @@
+-- +migrate Up
+
+-- Именованные сохранения прохождения (копия user_story_progress на момент сохранения)
+CREATE TABLE IF NOT EXISTS save_slots (
+    slot_id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    novel_id UUID NOT NULL REFERENCES novels(novel_id) ON DELETE CASCADE,
+    user_id VARCHAR(255) NOT NULL,
+    name VARCHAR(100) NOT NULL,
+    scene_index INTEGER NOT NULL,
+    progress JSONB NOT NULL DEFAULT '[]'::JSONB,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (novel_id, user_id, name)
+);
+
+CREATE TRIGGER update_save_slots_updated_at
+    BEFORE UPDATE ON save_slots
+    FOR EACH ROW
+    EXECUTE FUNCTION update_updated_at_column();
+
+-- +migrate Down
+
+DROP TRIGGER IF EXISTS update_save_slots_updated_at ON save_slots;
+DROP TABLE IF EXISTS save_slots;
@@ -0,0 +1,12 @@
+-- +migrate Up
+
+-- Версии промптов ("<name>/<version>"), которыми сгенерированы новелла, ее сетап и сцены
+ALTER TABLE novels ADD COLUMN IF NOT EXISTS prompt_version VARCHAR(100);
+ALTER TABLE novels ADD COLUMN IF NOT EXISTS setup_prompt_version VARCHAR(100);
+ALTER TABLE novel_states ADD COLUMN IF NOT EXISTS prompt_version VARCHAR(100);
+
+-- +migrate Down
+
+ALTER TABLE novel_states DROP COLUMN IF EXISTS prompt_version;
+ALTER TABLE novels DROP COLUMN IF EXISTS setup_prompt_version;
+ALTER TABLE novels DROP COLUMN IF EXISTS prompt_version;
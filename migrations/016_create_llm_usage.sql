@@ -0,0 +1,30 @@
+-- +migrate Up
+
+-- Учет токенов и стоимости каждого вызова модели.
+-- novel_id без внешнего ключа, чтобы расходы удаленных новелл оставались в статистике
+CREATE TABLE IF NOT EXISTS llm_usage (
+    usage_id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    user_id VARCHAR(255) NOT NULL DEFAULT '',
+    novel_id UUID,
+    operation VARCHAR(16) NOT NULL,
+    provider VARCHAR(50) NOT NULL,
+    model VARCHAR(255) NOT NULL,
+    prompt_tokens INTEGER NOT NULL DEFAULT 0,
+    completion_tokens INTEGER NOT NULL DEFAULT 0,
+    total_tokens INTEGER NOT NULL DEFAULT 0,
+    cost NUMERIC(14, 6) NOT NULL DEFAULT 0,
+    latency_ms INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Индексы для агрегатов за период
+CREATE INDEX IF NOT EXISTS idx_llm_usage_created_at ON llm_usage(created_at);
+CREATE INDEX IF NOT EXISTS idx_llm_usage_user_id ON llm_usage(user_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_llm_usage_novel_id ON llm_usage(novel_id, created_at);
+
+-- +migrate Down
+
+DROP INDEX IF EXISTS idx_llm_usage_novel_id;
+DROP INDEX IF EXISTS idx_llm_usage_user_id;
+DROP INDEX IF EXISTS idx_llm_usage_created_at;
+DROP TABLE IF EXISTS llm_usage;
@@ -0,0 +1,15 @@
+-- +migrate Up
+
+-- Счетчики запросов пользователя в окнах квот (сутки для черновиков, час для сцен).
+-- Расход токенов берется из llm_usage
+CREATE TABLE IF NOT EXISTS user_quota_counters (
+    user_id VARCHAR(255) NOT NULL,
+    kind VARCHAR(16) NOT NULL,
+    window_start TIMESTAMP WITH TIME ZONE NOT NULL,
+    used INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (user_id, kind, window_start)
+);
+
+-- +migrate Down
+
+DROP TABLE IF EXISTS user_quota_counters;
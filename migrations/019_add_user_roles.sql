@@ -0,0 +1,14 @@
+-- +migrate Up
+
+-- Роль пользователя (player < author < moderator < admin) и блокировка учетной записи.
+-- Уже зарегистрированные пользователи получают роль author, как и новые
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS role VARCHAR(20) NOT NULL DEFAULT 'author'
+        CHECK (role IN ('player', 'author', 'moderator', 'admin')),
+    ADD COLUMN IF NOT EXISTS disabled_at TIMESTAMP WITH TIME ZONE;
+
+-- +migrate Down
+
+ALTER TABLE users
+    DROP COLUMN IF EXISTS disabled_at,
+    DROP COLUMN IF EXISTS role;
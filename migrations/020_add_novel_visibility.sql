@@ -0,0 +1,26 @@
+-- +migrate Up
+
+-- Видимость новеллы. Все существующие новеллы становятся приватными: раньше их видели все
+ALTER TABLE novels
+    ADD COLUMN IF NOT EXISTS visibility VARCHAR(20) NOT NULL DEFAULT 'private'
+        CHECK (visibility IN ('private', 'unlisted', 'public')),
+    ADD COLUMN IF NOT EXISTS share_token VARCHAR(64) UNIQUE;
+
+-- Для списка публичных новелл
+CREATE INDEX IF NOT EXISTS idx_novels_visibility ON novels(visibility, created_at DESC);
+
+-- Пользователи, открывшие ссылку на скрытую новеллу
+CREATE TABLE IF NOT EXISTS novel_access_grants (
+    novel_id UUID NOT NULL REFERENCES novels(novel_id) ON DELETE CASCADE,
+    user_id VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (novel_id, user_id)
+);
+
+-- +migrate Down
+
+DROP TABLE IF EXISTS novel_access_grants;
+DROP INDEX IF EXISTS idx_novels_visibility;
+ALTER TABLE novels
+    DROP COLUMN IF EXISTS share_token,
+    DROP COLUMN IF EXISTS visibility;
@@ -0,0 +1,27 @@
+-- +migrate Up
+
+-- Номер текущей ревизии черновика
+ALTER TABLE novel_drafts ADD COLUMN IF NOT EXISTS revision INTEGER NOT NULL DEFAULT 1;
+
+-- История конфигов черновика: каждое создание, уточнение и откат добавляет ревизию
+CREATE TABLE IF NOT EXISTS novel_draft_revisions (
+    draft_id UUID NOT NULL REFERENCES novel_drafts(draft_id) ON DELETE CASCADE,
+    revision INTEGER NOT NULL,
+    source VARCHAR(20) NOT NULL CHECK (source IN ('create', 'refine', 'rollback')),
+    prompt TEXT NOT NULL DEFAULT '',
+    restored_from INTEGER,
+    config_json JSONB NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (draft_id, revision)
+);
+
+-- Существующие черновики получают первую ревизию; промпт, по которому они созданы, неизвестен
+INSERT INTO novel_draft_revisions (draft_id, revision, source, config_json, created_at)
+SELECT draft_id, 1, 'create', config_json, updated_at
+FROM novel_drafts
+ON CONFLICT (draft_id, revision) DO NOTHING;
+
+-- +migrate Down
+
+DROP TABLE IF EXISTS novel_draft_revisions;
+ALTER TABLE novel_drafts DROP COLUMN IF EXISTS revision;
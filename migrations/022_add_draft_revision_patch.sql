@@ -0,0 +1,9 @@
+-- +migrate Up
+
+-- Изменения, которые вернула модель при уточнении (JSON Merge Patch). Из них и промптов
+-- собирается история диалога для следующих уточнений
+ALTER TABLE novel_draft_revisions ADD COLUMN IF NOT EXISTS patch JSONB;
+
+-- +migrate Down
+
+ALTER TABLE novel_draft_revisions DROP COLUMN IF EXISTS patch;
@@ -0,0 +1,198 @@
+-- +migrate Up
+
+-- Схема для SQLite (DATABASE_DRIVER=sqlite), соответствует миграциям PostgreSQL 001-022.
+-- UUID хранятся строками, JSON - текстом. Время хранится в UTC и всегда передается
+-- из приложения, поэтому у колонок времени нет значений по умолчанию, а строки дат
+-- сравниваются и сортируются как время. Вместо триггеров updated_at обновляют запросы.
+
+CREATE TABLE IF NOT EXISTS novels (
+    novel_id TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL,
+    title TEXT NOT NULL,
+    short_description TEXT,
+    config_data TEXT NOT NULL,
+    is_adult_content INTEGER NOT NULL DEFAULT 0,
+    setup_state_data TEXT,
+    prompt_version TEXT,
+    setup_prompt_version TEXT,
+    visibility TEXT NOT NULL DEFAULT 'private' CHECK (visibility IN ('private', 'unlisted', 'public')),
+    share_token TEXT UNIQUE,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_novels_user_id ON novels(user_id);
+CREATE INDEX IF NOT EXISTS idx_novels_visibility ON novels(visibility, created_at DESC);
+
+-- Сцены новеллы, общие для всех игроков. Сетап хранится в novels.setup_state_data
+CREATE TABLE IF NOT EXISTS novel_states (
+    novel_id TEXT NOT NULL REFERENCES novels(novel_id) ON DELETE CASCADE,
+    scene_index INTEGER NOT NULL,
+    state_hash TEXT NOT NULL,
+    state_data TEXT NOT NULL,
+    prompt_version TEXT,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (novel_id, scene_index, state_hash)
+);
+
+CREATE INDEX IF NOT EXISTS idx_novel_states_state_hash ON novel_states(state_hash);
+
+CREATE TABLE IF NOT EXISTS user_novel_progress (
+    novel_id TEXT NOT NULL REFERENCES novels(novel_id) ON DELETE CASCADE,
+    user_id TEXT NOT NULL,
+    current_scene_index INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (novel_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_novel_progress_user_id ON user_novel_progress(user_id);
+
+CREATE TABLE IF NOT EXISTS user_story_progress (
+    novel_id TEXT NOT NULL REFERENCES novels(novel_id) ON DELETE CASCADE,
+    user_id TEXT NOT NULL,
+    scene_index INTEGER NOT NULL DEFAULT 0,
+    global_flags TEXT NOT NULL DEFAULT '[]',
+    relationship TEXT NOT NULL DEFAULT '{}',
+    story_variables TEXT NOT NULL DEFAULT '{}',
+    previous_choices TEXT NOT NULL DEFAULT '[]',
+    story_summary_so_far TEXT NOT NULL DEFAULT '',
+    future_direction TEXT NOT NULL DEFAULT '',
+    state_hash TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (novel_id, user_id, scene_index)
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_story_progress_state_hash ON user_story_progress(state_hash);
+CREATE INDEX IF NOT EXISTS idx_user_story_progress_user_id ON user_story_progress(user_id);
+
+CREATE TABLE IF NOT EXISTS novel_access_grants (
+    novel_id TEXT NOT NULL REFERENCES novels(novel_id) ON DELETE CASCADE,
+    user_id TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (novel_id, user_id)
+);
+
+CREATE TABLE IF NOT EXISTS novel_drafts (
+    draft_id TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL,
+    config_json TEXT NOT NULL,
+    revision INTEGER NOT NULL DEFAULT 1,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_novel_drafts_user_id ON novel_drafts(user_id);
+
+CREATE TABLE IF NOT EXISTS novel_draft_revisions (
+    draft_id TEXT NOT NULL REFERENCES novel_drafts(draft_id) ON DELETE CASCADE,
+    revision INTEGER NOT NULL,
+    source TEXT NOT NULL CHECK (source IN ('create', 'refine', 'rollback')),
+    prompt TEXT NOT NULL DEFAULT '',
+    restored_from INTEGER,
+    patch TEXT,
+    config_json TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (draft_id, revision)
+);
+
+CREATE TABLE IF NOT EXISTS novel_setup_jobs (
+    job_id TEXT PRIMARY KEY,
+    novel_id TEXT NOT NULL UNIQUE REFERENCES novels(novel_id) ON DELETE CASCADE,
+    user_id TEXT NOT NULL,
+    status TEXT NOT NULL DEFAULT 'queued' CHECK (status IN ('queued', 'running', 'failed', 'done')),
+    attempts INTEGER NOT NULL DEFAULT 0,
+    max_attempts INTEGER NOT NULL DEFAULT 3,
+    last_error TEXT,
+    run_after TIMESTAMP NOT NULL,
+    locked_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_novel_setup_jobs_pending ON novel_setup_jobs(status, run_after);
+CREATE INDEX IF NOT EXISTS idx_novel_setup_jobs_user_id ON novel_setup_jobs(user_id);
+
+CREATE TABLE IF NOT EXISTS save_slots (
+    slot_id TEXT PRIMARY KEY,
+    novel_id TEXT NOT NULL REFERENCES novels(novel_id) ON DELETE CASCADE,
+    user_id TEXT NOT NULL,
+    name TEXT NOT NULL,
+    scene_index INTEGER NOT NULL,
+    progress TEXT NOT NULL DEFAULT '[]',
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    UNIQUE (novel_id, user_id, name)
+);
+
+-- novel_id без внешнего ключа, чтобы расходы удаленных новелл оставались в статистике
+CREATE TABLE IF NOT EXISTS llm_usage (
+    usage_id TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL DEFAULT '',
+    novel_id TEXT,
+    operation TEXT NOT NULL,
+    provider TEXT NOT NULL,
+    model TEXT NOT NULL,
+    prompt_tokens INTEGER NOT NULL DEFAULT 0,
+    completion_tokens INTEGER NOT NULL DEFAULT 0,
+    total_tokens INTEGER NOT NULL DEFAULT 0,
+    cost REAL NOT NULL DEFAULT 0,
+    latency_ms INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_llm_usage_created_at ON llm_usage(created_at);
+CREATE INDEX IF NOT EXISTS idx_llm_usage_user_id ON llm_usage(user_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_llm_usage_novel_id ON llm_usage(novel_id, created_at);
+
+CREATE TABLE IF NOT EXISTS user_quota_counters (
+    user_id TEXT NOT NULL,
+    kind TEXT NOT NULL,
+    window_start TIMESTAMP NOT NULL,
+    used INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (user_id, kind, window_start)
+);
+
+CREATE TABLE IF NOT EXISTS users (
+    user_id TEXT PRIMARY KEY,
+    username TEXT NOT NULL,
+    password_hash TEXT NOT NULL,
+    role TEXT NOT NULL DEFAULT 'author' CHECK (role IN ('player', 'author', 'moderator', 'admin')),
+    disabled_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL
+);
+
+-- Логин уникален без учета регистра (логины состоят только из латиницы, цифр и . _ -)
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_username ON users(LOWER(username));
+
+CREATE TABLE IF NOT EXISTS refresh_tokens (
+    token_id TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL REFERENCES users(user_id) ON DELETE CASCADE,
+    family_id TEXT NOT NULL,
+    token_hash TEXT NOT NULL UNIQUE,
+    expires_at TIMESTAMP NOT NULL,
+    revoked_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_refresh_tokens_user_id ON refresh_tokens(user_id);
+CREATE INDEX IF NOT EXISTS idx_refresh_tokens_family_id ON refresh_tokens(family_id);
+
+-- +migrate Down
+
+DROP TABLE IF EXISTS refresh_tokens;
+DROP TABLE IF EXISTS users;
+DROP TABLE IF EXISTS user_quota_counters;
+DROP TABLE IF EXISTS llm_usage;
+DROP TABLE IF EXISTS save_slots;
+DROP TABLE IF EXISTS novel_setup_jobs;
+DROP TABLE IF EXISTS novel_draft_revisions;
+DROP TABLE IF EXISTS novel_drafts;
+DROP TABLE IF EXISTS novel_access_grants;
+DROP TABLE IF EXISTS user_story_progress;
+DROP TABLE IF EXISTS user_novel_progress;
+DROP TABLE IF EXISTS novel_states;
+DROP TABLE IF EXISTS novels;
@@ -33,37 +33,47 @@ process.on('uncaughtException', (error) => {
   process.exit(1);
 });
 
-// --- Получение UserID из аргументов командной строки или через ввод --- 
-async function getUserId() {
-    let userId = process.argv[2]; // Проверяем аргумент командной строки
-    if (userId) {
-        console.log(`Используется UserID из аргумента: ${userId}`);
-        return userId;
-    }
-
-    // Если аргумента нет, спрашиваем у пользователя
-    userId = await askQuestion(chalk.yellow('UserID не предоставлен в аргументах. Введите UserID (или нажмите Enter для генерации): '));
+// --- Получение логина и пароля из аргументов командной строки или через ввод ---
+async function getCredentials() {
+    let username = process.argv[2]; // Проверяем аргументы командной строки
+    let password = process.argv[3];
 
-    if (userId && userId.trim() !== '') {
-        console.log(`Используется введенный UserID: ${userId}`);
-        return userId.trim();
+    if (username) {
+        console.log(`Используется логин из аргумента: ${username}`);
     } else {
-        userId = `user_${Math.random().toString(36).substring(2, 9)}`; // Генерируем случайный ID
-        console.log(`UserID не введен. Используется сгенерированный ID: ${userId}`);
-        return userId;
+        username = (await askQuestion(chalk.yellow('Логин не предоставлен в аргументах. Введите логин: '))).trim();
     }
+    if (!password) {
+        password = await askQuestion(chalk.yellow('Введите пароль (не меньше 8 символов): '));
+    }
+
+    return { username, password };
 }
 // --------------------------------------------------------------------
 
 // --- Функция для получения JWT токена ---
-async function getAuthToken(userId) {
-    const url = `${config.baseUrl}/auth/token`;
-    log(`Запрос JWT токена для UserID: ${userId} по адресу ${url}...`, 'info');
+// Сначала пробуем войти; если учетной записи нет (401), регистрируем ее
+async function getAuthToken(credentials) {
+    const loginUrl = `${config.baseUrl}/auth/login`;
+    log(`Вход пользователя ${credentials.username} по адресу ${loginUrl}...`, 'info');
     try {
-        const response = await axios.post(url, { user_id: userId });
-        if (response.data && response.data.token) {
+        let tokens;
+        try {
+            const response = await axios.post(loginUrl, credentials);
+            tokens = response.data;
+        } catch (error) {
+            if (!error.response || error.response.status !== 401) {
+                throw error;
+            }
+            const registerUrl = `${config.baseUrl}/auth/register`;
+            log(`Вход не удался, регистрирую пользователя ${credentials.username} по адресу ${registerUrl}...`, 'warning');
+            const response = await axios.post(registerUrl, credentials);
+            tokens = response.data && response.data.tokens;
+        }
+
+        if (tokens && tokens.access_token) {
             log('Токен успешно получен!', 'success');
-            return response.data.token;
+            return tokens.access_token;
         } else {
             log('Ошибка: Не удалось получить токен из ответа сервера.', 'error');
             return null;
@@ -725,9 +735,9 @@ async function fetchNovelsList() {
 // Главная функция
 async function main() {
   try {
-    // Получаем UserID в начале
-    const currentUserId = await getUserId();
-    novelHistory.userId = currentUserId; // Устанавливаем UserID в историю
+    // Получаем логин и пароль в начале
+    const credentials = await getCredentials();
+    novelHistory.userId = credentials.username; // Сохраняем логин в историю
 
     // --- Меню выбора --- 
     console.log(chalk.cyan('\n===== ГЛАВНОЕ МЕНЮ ====='));
@@ -748,7 +758,7 @@ async function main() {
     let novelData;
 
     // --- Получаем JWT токен (нужен для обоих вариантов, кроме /novels) ---
-    jwtToken = await getAuthToken(currentUserId);
+    jwtToken = await getAuthToken(credentials);
     if (!jwtToken) {
         log('Не удалось получить токен аутентификации. Завершение работы.', 'error');
         rl.close(); // Закрываем readline перед выходом